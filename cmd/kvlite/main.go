@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -25,7 +26,14 @@ var (
 	maxWALSize       = flag.Int64("max-wal-size", 10*1024*1024, "Trigger compaction after this size (bytes)")
 	compactInterval  = flag.Duration("compact-interval", 1*time.Minute, "How often to check for compaction")
 	ttlCheckInterval = flag.Duration("ttl-check-interval", 1*time.Second, "How often to check for expired keys")
+	ttlCheckBudget   = flag.Duration("ttl-check-budget", 25*time.Millisecond, "Longest time one expiration check may hold the store")
 	enableAnalytics  = flag.Bool("enable-analytics", true, "Enable AI-powered analytics and smart scheduling")
+	databases        = flag.Int("databases", engine.DefaultDatabases, "Number of logical databases")
+	quotaFile        = flag.String("quota-file", "", "File holding per-database quotas (default: kvlite.quotas in the WAL path)")
+	pubsubBuffer     = flag.Int("pubsub-buffer", 0, "Messages queued for a subscriber before it is disconnected (default: 1024)")
+	keyspaceEvents   = flag.String("keyspace-events", "", "Keyspace event classes published to channels, e.g. set,del,expired or * (default: none)")
+	scriptTimeout    = flag.Duration("script-timeout", 0, "Longest a script may run before it is stopped (default: 5s)")
+	maxLineLength    = flag.Int("max-line-length", 0, "Longest command line accepted, in bytes (default: 64MB)")
 	version          = flag.Bool("version", false, "Print version and exit")
 )
 
@@ -55,6 +63,27 @@ func main() {
 	if *maxConnections != 0 {
 		cfg.MaxConnections = *maxConnections
 	}
+	if *quotaFile != "" {
+		cfg.QuotaFile = *quotaFile
+	}
+	if *pubsubBuffer != 0 {
+		cfg.PubSubBuffer = *pubsubBuffer
+	}
+	if *keyspaceEvents != "" {
+		cfg.KeyspaceEvents = *keyspaceEvents
+	}
+	if *scriptTimeout != 0 {
+		cfg.ScriptTimeout = *scriptTimeout
+	}
+	if *maxLineLength != 0 {
+		cfg.MaxLineLength = *maxLineLength
+	}
+	if cfg.QuotaFile == "" {
+		cfg.QuotaFile = filepath.Join(*walPath, "kvlite.quotas")
+	}
+	if err := cfg.LoadQuotas(); err != nil {
+		log.Fatalf("Configuration error: %v", err)
+	}
 
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
@@ -73,7 +102,10 @@ func main() {
 		MaxWALSize:         *maxWALSize,
 		CompactionInterval: *compactInterval,
 		TTLCheckInterval:   *ttlCheckInterval,
+		TTLCheckBudget:     *ttlCheckBudget,
 		EnableAnalytics:    *enableAnalytics,
+		Databases:          *databases,
+		Quotas:             cfg.Quotas,
 	})
 	if err != nil {
 		log.Fatalf("Failed to create engine: %v", err)
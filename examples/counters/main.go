@@ -106,6 +106,16 @@ func (c *Counter) Set(name string, value int64) error {
 	return nil
 }
 
+// Add adds delta to a counter atomically
+func (c *Counter) Add(name string, delta int64) (int64, error) {
+	response, err := c.sendCommand(fmt.Sprintf("INCRBY %s %d", name, delta))
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(response, 10, 64)
+}
+
 // Reset resets a counter to zero
 func (c *Counter) Reset(name string) error {
 	return c.Set(name, 0)
@@ -128,12 +138,43 @@ func (p *PageViewTracker) GetPageViews(path string) (int64, error) {
 	return p.counter.Get(key)
 }
 
-// TrackUniqueVisitor tracks unique visitors (simplified)
-func (p *PageViewTracker) TrackUniqueVisitor(path string, visitorID string) error {
-	// In production, use a set or hyperloglog for unique counting
-	key := fmt.Sprintf("visitors:%s:%s", path, visitorID)
-	_, err := p.counter.sendCommand(fmt.Sprintf("SETEX %s 86400 1", key)) // 24 hour TTL
-	return err
+// TrackUniqueVisitor adds a visitor to the HyperLogLog of this hour's
+// visitors for a path. Returns true if the visitor changed the estimate,
+// which almost always means it's the visitor's first view this hour.
+func (p *PageViewTracker) TrackUniqueVisitor(path string, visitorID string) (bool, error) {
+	key := uniqueVisitorsKey(path, time.Now())
+	response, err := p.counter.sendCommand(fmt.Sprintf("PFADD %s %s", key, visitorID))
+	if err != nil {
+		return false, err
+	}
+	if strings.HasPrefix(response, "-ERR") {
+		return false, fmt.Errorf("PFADD failed: %s", response)
+	}
+
+	added := response == "1"
+	if added {
+		// Keep two days of hourly estimates
+		p.counter.sendCommand(fmt.Sprintf("EXPIRE %s %d", key, 48*3600))
+	}
+	return added, nil
+}
+
+// GetUniqueVisitors returns the estimated number of unique visitors to a
+// path this hour. HyperLogLogs use at most 12 KB per key however many
+// visitors there are, at the cost of a 0.81% standard error.
+func (p *PageViewTracker) GetUniqueVisitors(path string) (int64, error) {
+	key := uniqueVisitorsKey(path, time.Now())
+	response, err := p.counter.sendCommand(fmt.Sprintf("PFCOUNT %s", key))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(response, 10, 64)
+}
+
+// uniqueVisitorsKey returns the key of the visitor HyperLogLog for a path
+// and hour
+func uniqueVisitorsKey(path string, hour time.Time) string {
+	return fmt.Sprintf("visitors:%s:%s", path, hour.Format("2006010215"))
 }
 
 // TimeWindowCounter tracks counts in time windows
@@ -237,6 +278,14 @@ func main() {
 		fmt.Printf("   %s: %d total views\n", page, views)
 	}
 
+	fmt.Println("\n   Unique visitors:")
+	for _, visitor := range []string{"alice", "bob", "alice", "carol", "bob"} {
+		first, _ := pageTracker.TrackUniqueVisitor("/home", visitor)
+		fmt.Printf("   %s visited /home (first visit this hour: %v)\n", visitor, first)
+	}
+	uniques, _ := pageTracker.GetUniqueVisitors("/home")
+	fmt.Printf("   /home: about %d unique visitors this hour\n", uniques)
+
 	// Example 3: Active Users Counter
 	fmt.Println("\n3. Active Users Counter")
 
@@ -284,9 +333,7 @@ func main() {
 		counter.Increment("stats:orders:total")
 		counter.Increment("stats:orders:today")
 		// Add revenue (simulated)
-		response, _ := counter.sendCommand("GET stats:revenue:today")
-		current, _ := strconv.ParseInt(response, 10, 64)
-		counter.Set("stats:revenue:today", current+199)
+		counter.Add("stats:revenue:today", 199)
 	}
 
 	total, _ := counter.Get("stats:orders:total")
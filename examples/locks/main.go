@@ -83,33 +83,28 @@ func (dl *DistributedLock) sendCommand(cmd string) (string, error) {
 func (dl *DistributedLock) Acquire() (bool, error) {
 	key := fmt.Sprintf("lock:%s", dl.lockName)
 
-	// Check if lock exists
-	response, err := dl.sendCommand(fmt.Sprintf("GET %s", key))
+	// Try to acquire the lock atomically: only set if nobody holds it.
+	// GET returns the previous holder so re-entrant acquires can be detected.
+	response, err := dl.sendCommand(fmt.Sprintf("SET %s %s NX GET EX %d", key, dl.lockID, dl.ttl))
 	if err != nil {
 		return false, err
 	}
 
-	if !strings.HasPrefix(response, "-ERR") {
-		// Lock exists - check if it's ours (for re-entrant locking)
-		if response == dl.lockID {
-			// Refresh TTL
-			dl.sendCommand(fmt.Sprintf("EXPIRE %s %d", key, dl.ttl))
-			return true, nil
-		}
-		// Lock held by someone else
-		return false, nil
-	}
-
-	// Try to acquire the lock using SETEX
-	response, err = dl.sendCommand(fmt.Sprintf("SETEX %s %d %s", key, dl.ttl, dl.lockID))
-	if err != nil {
-		return false, err
+	switch response {
+	case "(nil)":
+		// Nobody held the lock, it's ours now
+		return true, nil
+	case dl.lockID:
+		// Lock is already ours (re-entrant locking) - refresh TTL
+		dl.sendCommand(fmt.Sprintf("EXPIRE %s %d", key, dl.ttl))
+		return true, nil
 	}
 
-	if response == "+OK" {
-		return true, nil
+	if strings.HasPrefix(response, "-ERR") {
+		return false, fmt.Errorf("acquire failed: %s", response)
 	}
 
+	// Lock held by someone else
 	return false, nil
 }
 
@@ -134,6 +129,12 @@ func (dl *DistributedLock) AcquireWithRetry(maxAttempts int, retryDelay time.Dur
 func (dl *DistributedLock) Release() (bool, error) {
 	key := fmt.Sprintf("lock:%s", dl.lockName)
 
+	// Watch the lock so the delete is skipped if it changes hands
+	// between our ownership check and the DELETE
+	if _, err := dl.sendCommand(fmt.Sprintf("WATCH %s", key)); err != nil {
+		return false, err
+	}
+
 	// Check if we own the lock
 	response, err := dl.sendCommand(fmt.Sprintf("GET %s", key))
 	if err != nil {
@@ -142,11 +143,14 @@ func (dl *DistributedLock) Release() (bool, error) {
 
 	if response != dl.lockID {
 		// We don't own this lock
+		dl.sendCommand("UNWATCH")
 		return false, nil
 	}
 
-	// Delete the lock
-	response, err = dl.sendCommand(fmt.Sprintf("DELETE %s", key))
+	// Delete the lock atomically with respect to the check above
+	dl.sendCommand("MULTI")
+	dl.sendCommand(fmt.Sprintf("DELETE %s", key))
+	response, err = dl.sendCommand("EXEC")
 	if err != nil {
 		return false, err
 	}
@@ -88,37 +88,85 @@ func (rl *RateLimiter) FixedWindowLimit(identifier string, limit int, windowSeco
 }
 
 // SlidingWindowLogLimit implements sliding window log rate limiting
-// More accurate but uses more memory
+// More accurate but uses more memory: every accepted request is kept in a
+// sorted set scored by its timestamp in milliseconds
 func (rl *RateLimiter) SlidingWindowLogLimit(identifier string, limit int, windowSeconds int) (bool, error) {
-	now := time.Now().Unix()
-	windowStart := now - int64(windowSeconds)
+	now := time.Now()
+	windowStart := now.Add(-time.Duration(windowSeconds) * time.Second).UnixMilli()
 	key := fmt.Sprintf("ratelimit:sliding:%s", identifier)
 
-	// In a full implementation, we'd use a sorted set
-	// For simplicity, we'll use the fixed window approach with smaller windows
-	// This is a simplified demonstration
-
-	// Use current timestamp as part of the key for fine-grained tracking
-	currentSecond := now
-	countKey := fmt.Sprintf("%s:%d", key, currentSecond)
-
-	// Count requests in this second
-	response, _ := rl.sendCommand(fmt.Sprintf("INCR %s", countKey))
-	rl.sendCommand(fmt.Sprintf("EXPIRE %s %d", countKey, windowSeconds))
+	// Drop requests that have left the window
+	if _, err := rl.sendCommand(fmt.Sprintf("ZREMRANGEBYSCORE %s -inf %d", key, windowStart)); err != nil {
+		return false, err
+	}
 
+	response, err := rl.sendCommand(fmt.Sprintf("ZCARD %s", key))
+	if err != nil {
+		return false, err
+	}
 	count, _ := strconv.Atoi(response)
+	if count >= limit {
+		return false, nil
+	}
 
-	// For demo purposes, use simple window
-	// Real implementation would aggregate counts across the window
-	perSecondLimit := limit / windowSeconds
-	if perSecondLimit < 1 {
-		perSecondLimit = 1
+	// The member only needs to be unique; the score places it in the window
+	member := strconv.FormatInt(now.UnixNano(), 10)
+	if _, err := rl.sendCommand(fmt.Sprintf("ZADD %s %d %s", key, now.UnixMilli(), member)); err != nil {
+		return false, err
 	}
+	rl.sendCommand(fmt.Sprintf("EXPIRE %s %d", key, windowSeconds))
 
-	allowed := count <= perSecondLimit
-	_ = windowStart // Used in full implementation
+	return true, nil
+}
 
-	return allowed, nil
+// tokenBucketScript refills the bucket for the time elapsed since the last
+// request and takes a token. It runs on the server in one step, so
+// concurrent requests can't both take the last token.
+const tokenBucketScript = `
+local capacity, rate, now = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local tokens = tonumber(kv.call('GET', KEYS[1])) or capacity
+local last = tonumber(kv.call('GET', KEYS[2])) or now
+tokens = math.min(capacity, tokens + (now - last) * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+kv.call('SET', KEYS[1], string.format('%.2f', tokens), 'EX', 3600)
+kv.call('SET', KEYS[2], now, 'EX', 3600)
+return allowed .. ' ' .. math.floor(tokens)`
+
+// leakyBucketScript drains the bucket for the time elapsed since the last
+// request and adds the request if there is room
+const leakyBucketScript = `
+local capacity, rate, now = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local level = tonumber(kv.call('GET', KEYS[1])) or 0
+local last = tonumber(kv.call('GET', KEYS[2])) or now
+level = math.max(0, level - (now - last) * rate)
+local allowed = 0
+if level < capacity then
+  level = level + 1
+  allowed = 1
+end
+kv.call('SET', KEYS[1], string.format('%.2f', level), 'EX', 3600)
+kv.call('SET', KEYS[2], now, 'EX', 3600)
+return allowed .. ' ' .. (capacity - math.floor(level))`
+
+// eval runs a script with EVAL and parses its "allowed count" reply
+func (rl *RateLimiter) eval(script string, keys []string, args ...string) (bool, int, error) {
+	quoted := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(script)
+	cmd := fmt.Sprintf("EVAL \"%s\" %d %s %s", quoted, len(keys), strings.Join(keys, " "), strings.Join(args, " "))
+
+	response, err := rl.sendCommand(cmd)
+	if err != nil {
+		return false, 0, err
+	}
+	fields := strings.Fields(response)
+	if len(fields) != 2 || strings.HasPrefix(response, "-ERR") {
+		return false, 0, fmt.Errorf("unexpected reply: %s", response)
+	}
+	count, _ := strconv.Atoi(fields[1])
+	return fields[0] == "1", count, nil
 }
 
 // TokenBucketLimit implements token bucket rate limiting
@@ -127,48 +175,10 @@ func (rl *RateLimiter) TokenBucketLimit(identifier string, bucketSize int, refil
 	key := fmt.Sprintf("ratelimit:bucket:%s", identifier)
 	timestampKey := fmt.Sprintf("%s:ts", key)
 
-	now := time.Now().Unix()
-
-	// Get current tokens and last refill time
-	tokensResp, _ := rl.sendCommand(fmt.Sprintf("GET %s", key))
-	lastRefillResp, _ := rl.sendCommand(fmt.Sprintf("GET %s", timestampKey))
-
-	var tokens float64
-	var lastRefill int64
-
-	if strings.HasPrefix(tokensResp, "-ERR") {
-		// First request - full bucket
-		tokens = float64(bucketSize)
-		lastRefill = now
-	} else {
-		tokens, _ = strconv.ParseFloat(tokensResp, 64)
-		lastRefill, _ = strconv.ParseInt(lastRefillResp, 10, 64)
-	}
-
-	// Calculate tokens to add based on time elapsed
-	elapsed := float64(now - lastRefill)
-	tokensToAdd := elapsed * refillRate
-	tokens = tokens + tokensToAdd
-
-	// Cap at bucket size
-	if tokens > float64(bucketSize) {
-		tokens = float64(bucketSize)
-	}
-
-	// Check if we have a token to consume
-	allowed := tokens >= 1.0
-
-	if allowed {
-		tokens -= 1.0
-	}
-
-	// Save state
-	rl.sendCommand(fmt.Sprintf("SET %s %.2f", key, tokens))
-	rl.sendCommand(fmt.Sprintf("SET %s %d", timestampKey, now))
-	rl.sendCommand(fmt.Sprintf("EXPIRE %s 3600", key))          // 1 hour cleanup
-	rl.sendCommand(fmt.Sprintf("EXPIRE %s 3600", timestampKey)) // 1 hour cleanup
-
-	return allowed, int(tokens), nil
+	return rl.eval(tokenBucketScript, []string{key, timestampKey},
+		strconv.Itoa(bucketSize),
+		strconv.FormatFloat(refillRate, 'f', -1, 64),
+		strconv.FormatInt(time.Now().Unix(), 10))
 }
 
 // LeakyBucketLimit implements leaky bucket rate limiting
@@ -177,46 +187,10 @@ func (rl *RateLimiter) LeakyBucketLimit(identifier string, bucketSize int, leakR
 	key := fmt.Sprintf("ratelimit:leaky:%s", identifier)
 	timestampKey := fmt.Sprintf("%s:ts", key)
 
-	now := time.Now().Unix()
-
-	// Get current water level and last leak time
-	levelResp, _ := rl.sendCommand(fmt.Sprintf("GET %s", key))
-	lastLeakResp, _ := rl.sendCommand(fmt.Sprintf("GET %s", timestampKey))
-
-	var level float64
-	var lastLeak int64
-
-	if strings.HasPrefix(levelResp, "-ERR") {
-		level = 0
-		lastLeak = now
-	} else {
-		level, _ = strconv.ParseFloat(levelResp, 64)
-		lastLeak, _ = strconv.ParseInt(lastLeakResp, 10, 64)
-	}
-
-	// Calculate water that leaked out
-	elapsed := float64(now - lastLeak)
-	leaked := elapsed * leakRate
-	level = level - leaked
-
-	if level < 0 {
-		level = 0
-	}
-
-	// Check if bucket has room for another request
-	allowed := level < float64(bucketSize)
-
-	if allowed {
-		level += 1.0
-	}
-
-	// Save state
-	rl.sendCommand(fmt.Sprintf("SET %s %.2f", key, level))
-	rl.sendCommand(fmt.Sprintf("SET %s %d", timestampKey, now))
-	rl.sendCommand(fmt.Sprintf("EXPIRE %s 3600", key))
-	rl.sendCommand(fmt.Sprintf("EXPIRE %s 3600", timestampKey))
-
-	return allowed, bucketSize - int(level), nil
+	return rl.eval(leakyBucketScript, []string{key, timestampKey},
+		strconv.Itoa(bucketSize),
+		strconv.FormatFloat(leakRate, 'f', -1, 64),
+		strconv.FormatInt(time.Now().Unix(), 10))
 }
 
 func main() {
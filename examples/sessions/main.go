@@ -7,25 +7,28 @@ import (
 	"bufio"
 	"crypto/rand"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 )
 
 // Session represents a user session
 type Session struct {
-	ID        string    `json:"id"`
-	UserID    int       `json:"user_id"`
-	Username  string    `json:"username"`
-	Role      string    `json:"role"`
-	IPAddress string    `json:"ip_address"`
-	CreatedAt time.Time `json:"created_at"`
-	ExpiresAt time.Time `json:"expires_at"`
+	ID        string
+	UserID    int
+	Username  string
+	Role      string
+	IPAddress string
+	CreatedAt time.Time
+	ExpiresAt time.Time
 }
 
+// sessionFields lists the hash fields a session is stored in
+var sessionFields = []string{"user_id", "username", "role", "ip_address", "created_at", "expires_at"}
+
 // SessionManager handles session operations
 type SessionManager struct {
 	conn   net.Conn
@@ -73,6 +76,27 @@ func (sm *SessionManager) sendCommand(cmd string) (string, error) {
 	return strings.TrimSpace(response), nil
 }
 
+// sendCommandLines sends a command whose reply spans n lines
+func (sm *SessionManager) sendCommandLines(cmd string, n int) ([]string, error) {
+	first, err := sm.sendCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	lines := []string{first}
+	if strings.HasPrefix(first, "-ERR") {
+		return lines, nil
+	}
+
+	for len(lines) < n {
+		line, err := sm.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	return lines, nil
+}
+
 // generateSessionID creates a secure random session ID
 func generateSessionID() string {
 	bytes := make([]byte, 32)
@@ -92,23 +116,22 @@ func (sm *SessionManager) CreateSession(userID int, username, role, ipAddress st
 		ExpiresAt: time.Now().Add(time.Duration(sm.ttl) * time.Second),
 	}
 
-	// Serialize session data
-	data, err := json.Marshal(session)
-	if err != nil {
-		return nil, err
-	}
-
-	// Store with TTL using SETEX
+	// Store the fields in a hash and set its TTL in one transaction
 	key := fmt.Sprintf("session:%s", session.ID)
-	cmd := fmt.Sprintf("SETEX %s %d %s", key, sm.ttl, string(data))
-
-	response, err := sm.sendCommand(cmd)
+	hset := fmt.Sprintf("HSET %s user_id %d username %s role %s ip_address %s created_at %s expires_at %s",
+		key, session.UserID, session.Username, session.Role, session.IPAddress,
+		session.CreatedAt.Format(time.RFC3339), session.ExpiresAt.Format(time.RFC3339))
+
+	sm.sendCommand("MULTI")
+	sm.sendCommand(hset)
+	sm.sendCommand(fmt.Sprintf("EXPIRE %s %d", key, sm.ttl))
+	replies, err := sm.sendCommandLines("EXEC", 2)
 	if err != nil {
 		return nil, err
 	}
 
-	if response != "+OK" {
-		return nil, fmt.Errorf("failed to create session: %s", response)
+	if strings.HasPrefix(replies[0], "-ERR") {
+		return nil, fmt.Errorf("failed to create session: %s", replies[0])
 	}
 
 	// Also maintain user -> session mapping for single-session enforcement
@@ -121,23 +144,49 @@ func (sm *SessionManager) CreateSession(userID int, username, role, ipAddress st
 // GetSession retrieves a session by ID
 func (sm *SessionManager) GetSession(sessionID string) (*Session, error) {
 	key := fmt.Sprintf("session:%s", sessionID)
-	cmd := fmt.Sprintf("GET %s", key)
+	cmd := fmt.Sprintf("HMGET %s %s", key, strings.Join(sessionFields, " "))
 
-	response, err := sm.sendCommand(cmd)
+	values, err := sm.sendCommandLines(cmd, len(sessionFields))
 	if err != nil {
 		return nil, err
 	}
 
-	if strings.HasPrefix(response, "-ERR") {
+	if strings.HasPrefix(values[0], "-ERR") || values[0] == "(nil)" {
 		return nil, fmt.Errorf("session not found")
 	}
 
-	var session Session
-	if err := json.Unmarshal([]byte(response), &session); err != nil {
-		return nil, err
+	userID, err := strconv.Atoi(values[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid session: %w", err)
 	}
+	createdAt, _ := time.Parse(time.RFC3339, values[4])
+	expiresAt, _ := time.Parse(time.RFC3339, values[5])
 
-	return &session, nil
+	return &Session{
+		ID:        sessionID,
+		UserID:    userID,
+		Username:  values[1],
+		Role:      values[2],
+		IPAddress: values[3],
+		CreatedAt: createdAt,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// UpdateSessionField changes a single field of a session without
+// rewriting the rest of it
+func (sm *SessionManager) UpdateSessionField(sessionID, field, value string) error {
+	key := fmt.Sprintf("session:%s", sessionID)
+	response, err := sm.sendCommand(fmt.Sprintf("HSET %s %s %s", key, field, value))
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(response, "-ERR") {
+		return fmt.Errorf("failed to update session: %s", response)
+	}
+
+	return nil
 }
 
 // RefreshSession extends the session TTL
@@ -248,6 +297,11 @@ func main() {
 	} else {
 		fmt.Println("   Session TTL extended")
 	}
+	if err := sm.UpdateSessionField(session.ID, "role", "superadmin"); err != nil {
+		log.Printf("Failed to update session: %v", err)
+	} else {
+		fmt.Println("   Role updated in place (other fields and TTL untouched)")
+	}
 
 	// Example 4: Get user's current session
 	fmt.Println("\n4. Getting User's Current Session")
@@ -283,7 +337,7 @@ func main() {
 	fmt.Println("   Key pattern: session:{session_id}")
 	fmt.Println("   User mapping: user:session:{user_id} -> session_id")
 	fmt.Println("   TTL: Auto-expires after configured duration")
-	fmt.Println("   Data: JSON-serialized session object")
+	fmt.Println("   Data: hash with one field per session attribute")
 
 	fmt.Println("\nSession management demo complete!")
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 )
 
 // Config holds the server configuration
@@ -17,6 +18,29 @@ type Config struct {
 
 	// MaxConnections limits concurrent connections (0 = unlimited)
 	MaxConnections int
+
+	// QuotaFile holds the per-database quotas ("" = quotas are not saved)
+	QuotaFile string
+
+	// Quotas limits the usage of logical databases, by number
+	Quotas map[int]Quota
+
+	// PubSubBuffer is the number of lines queued for a subscriber before
+	// it is disconnected as a slow consumer (0 = default of 1024)
+	PubSubBuffer int
+
+	// KeyspaceEvents lists the classes of keyspace events published to the
+	// __keyspace@<db>__ and __keyevent@<db>__ channels, separated by commas,
+	// or "*" for all ("" = none)
+	KeyspaceEvents string
+
+	// ScriptTimeout is the longest a script run by EVAL may hold the store
+	// (0 = default of 5s)
+	ScriptTimeout time.Duration
+
+	// MaxLineLength is the longest command line accepted, in bytes; a
+	// client sending a longer one is disconnected (0 = default of 64MB)
+	MaxLineLength int
 }
 
 // Default returns the default configuration
@@ -48,6 +72,32 @@ func LoadFromEnv() *Config {
 		}
 	}
 
+	if quotaFile := os.Getenv("KVLITE_QUOTA_FILE"); quotaFile != "" {
+		cfg.QuotaFile = quotaFile
+	}
+
+	if buffer := os.Getenv("KVLITE_PUBSUB_BUFFER"); buffer != "" {
+		if b, err := strconv.Atoi(buffer); err == nil {
+			cfg.PubSubBuffer = b
+		}
+	}
+
+	if events := os.Getenv("KVLITE_KEYSPACE_EVENTS"); events != "" {
+		cfg.KeyspaceEvents = events
+	}
+
+	if timeout := os.Getenv("KVLITE_SCRIPT_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			cfg.ScriptTimeout = d
+		}
+	}
+
+	if maxLine := os.Getenv("KVLITE_MAX_LINE_LENGTH"); maxLine != "" {
+		if m, err := strconv.Atoi(maxLine); err == nil {
+			cfg.MaxLineLength = m
+		}
+	}
+
 	return cfg
 }
 
@@ -65,5 +115,19 @@ func (c *Config) Validate() error {
 	if c.MaxConnections < 0 {
 		return fmt.Errorf("invalid max connections: %d (must be >= 0)", c.MaxConnections)
 	}
+	if c.PubSubBuffer < 0 {
+		return fmt.Errorf("invalid pub/sub buffer: %d (must be >= 0)", c.PubSubBuffer)
+	}
+	if c.ScriptTimeout < 0 {
+		return fmt.Errorf("invalid script timeout: %v (must be >= 0)", c.ScriptTimeout)
+	}
+	if c.MaxLineLength < 0 {
+		return fmt.Errorf("invalid max line length: %d (must be >= 0)", c.MaxLineLength)
+	}
+	for db, q := range c.Quotas {
+		if err := q.Validate(); err != nil {
+			return fmt.Errorf("database %d: %w", db, err)
+		}
+	}
 	return nil
 }
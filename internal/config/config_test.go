@@ -4,6 +4,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func TestDefault(t *testing.T) {
@@ -230,3 +231,61 @@ func TestValidate_ZeroMaxConnections(t *testing.T) {
 		t.Errorf("Expected no error for MaxConnections 0 (unlimited), got: %v", err)
 	}
 }
+
+func TestLoadFromEnv_PubSub(t *testing.T) {
+	t.Setenv("KVLITE_PUBSUB_BUFFER", "64")
+	t.Setenv("KVLITE_KEYSPACE_EVENTS", "set,expired")
+	t.Setenv("KVLITE_SCRIPT_TIMEOUT", "250ms")
+	t.Setenv("KVLITE_MAX_LINE_LENGTH", "4096")
+
+	cfg := LoadFromEnv()
+
+	if cfg.PubSubBuffer != 64 {
+		t.Errorf("Expected PubSubBuffer 64, got %d", cfg.PubSubBuffer)
+	}
+	if cfg.KeyspaceEvents != "set,expired" {
+		t.Errorf("Expected KeyspaceEvents 'set,expired', got '%s'", cfg.KeyspaceEvents)
+	}
+	if cfg.ScriptTimeout != 250*time.Millisecond {
+		t.Errorf("Expected ScriptTimeout 250ms, got %v", cfg.ScriptTimeout)
+	}
+	if cfg.MaxLineLength != 4096 {
+		t.Errorf("Expected MaxLineLength 4096, got %d", cfg.MaxLineLength)
+	}
+}
+
+func TestValidate_InvalidPubSubBuffer(t *testing.T) {
+	cfg := &Config{
+		Host:         "localhost",
+		Port:         6380,
+		PubSubBuffer: -1,
+	}
+
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative PubSubBuffer, got nil")
+	}
+}
+
+func TestValidate_InvalidScriptTimeout(t *testing.T) {
+	cfg := &Config{
+		Host:          "localhost",
+		Port:          6380,
+		ScriptTimeout: -time.Second,
+	}
+
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative ScriptTimeout, got nil")
+	}
+}
+
+func TestValidate_InvalidMaxLineLength(t *testing.T) {
+	cfg := &Config{
+		Host:          "localhost",
+		Port:          6380,
+		MaxLineLength: -1,
+	}
+
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative MaxLineLength, got nil")
+	}
+}
@@ -0,0 +1,77 @@
+// internal/config/quota.go
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Quota limits the usage of one logical database. Zero fields mean no
+// limit.
+type Quota struct {
+	MaxKeys      int   `json:"max_keys,omitempty"`        // Number of keys
+	MaxBytes     int64 `json:"max_bytes,omitempty"`       // Approximate memory used by keys and values
+	MaxOpsPerSec int   `json:"max_ops_per_sec,omitempty"` // Operations started per second
+}
+
+// IsZero reports whether the quota sets no limit
+func (q Quota) IsZero() bool {
+	return q == Quota{}
+}
+
+// Validate checks that the limits are not negative
+func (q Quota) Validate() error {
+	if q.MaxKeys < 0 || q.MaxBytes < 0 || q.MaxOpsPerSec < 0 {
+		return fmt.Errorf("invalid quota: limits must be >= 0")
+	}
+	return nil
+}
+
+// LoadQuotas reads the per-database quotas from QuotaFile. A missing file
+// leaves Quotas empty.
+func (c *Config) LoadQuotas() error {
+	if c.QuotaFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.QuotaFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read quota file: %w", err)
+	}
+
+	var quotas map[int]Quota
+	if err := json.Unmarshal(data, &quotas); err != nil {
+		return fmt.Errorf("failed to decode quota file: %w", err)
+	}
+	c.Quotas = quotas
+	return nil
+}
+
+// SaveQuotas writes the per-database quotas to QuotaFile, replacing it
+// atomically. It does nothing without a QuotaFile.
+func (c *Config) SaveQuotas() error {
+	if c.QuotaFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(c.Quotas, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode quotas: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.QuotaFile), 0755); err != nil {
+		return fmt.Errorf("failed to create quota directory: %w", err)
+	}
+	tempPath := c.QuotaFile + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write quota file: %w", err)
+	}
+	if err := os.Rename(tempPath, c.QuotaFile); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename quota file: %w", err)
+	}
+	return nil
+}
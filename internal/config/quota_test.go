@@ -0,0 +1,43 @@
+// internal/config/quota_test.go
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestQuotas_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "kvlite.quotas")
+
+	cfg := &Config{QuotaFile: path}
+	if err := cfg.LoadQuotas(); err != nil {
+		t.Fatalf("Loading a missing file should not fail: %v", err)
+	}
+	if len(cfg.Quotas) != 0 {
+		t.Errorf("Expected no quotas, got %v", cfg.Quotas)
+	}
+
+	cfg.Quotas = map[int]Quota{
+		0: {MaxKeys: 100},
+		3: {MaxBytes: 1 << 20, MaxOpsPerSec: 50},
+	}
+	if err := cfg.SaveQuotas(); err != nil {
+		t.Fatalf("SaveQuotas failed: %v", err)
+	}
+
+	loaded := &Config{QuotaFile: path}
+	if err := loaded.LoadQuotas(); err != nil {
+		t.Fatalf("LoadQuotas failed: %v", err)
+	}
+	if len(loaded.Quotas) != 2 || loaded.Quotas[0] != cfg.Quotas[0] || loaded.Quotas[3] != cfg.Quotas[3] {
+		t.Errorf("Expected %v, got %v", cfg.Quotas, loaded.Quotas)
+	}
+}
+
+func TestValidate_InvalidQuota(t *testing.T) {
+	cfg := Default()
+	cfg.Quotas = map[int]Quota{1: {MaxKeys: -1}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for a negative quota")
+	}
+}
@@ -0,0 +1,281 @@
+// internal/engine/bitmap.go
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/lofoneh/kvlite/internal/store"
+	"github.com/lofoneh/kvlite/internal/wal"
+)
+
+// MaxBitOffset is the largest offset SetBit accepts
+const MaxBitOffset = store.MaxBitOffset
+
+// Operations accepted by BitOp
+const (
+	BitAnd = "AND"
+	BitOr  = "OR"
+	BitXor = "XOR"
+	BitNot = "NOT"
+)
+
+var (
+	// ErrBitOffset is returned for a bit offset above MaxBitOffset
+	ErrBitOffset = errors.New("bit offset is not an integer or out of range")
+	// ErrBitValue is returned when a bit is neither 0 nor 1
+	ErrBitValue = errors.New("bit is not an integer or out of range")
+	// ErrBitOp is returned for an unknown BitOp operation
+	ErrBitOp = errors.New("unknown BITOP operation")
+	// ErrBitOpNot is returned when BitNot is given other than one key
+	ErrBitOpNot = errors.New("BITOP NOT must be called with a single source key")
+)
+
+// BitRange selects part of a string for BitCount and BitPos
+type BitRange struct {
+	Start, End int64 // Inclusive; negative values count from the end
+	Bits       bool  // Start and End are bit offsets rather than byte offsets
+	OpenEnd    bool  // End wasn't given, see BitPos
+}
+
+// span returns the first and last bit offsets the range covers in a
+// string of length bytes. A nil range covers the whole string.
+func (r *BitRange) span(length int) (uint64, uint64, bool) {
+	if r == nil {
+		return 0, uint64(length)*8 - 1, length > 0
+	}
+	n := int64(length)
+	if r.Bits {
+		n *= 8
+	}
+	start, end, ok := store.ResolveRange(r.Start, r.End, n)
+	if !ok {
+		return 0, 0, false
+	}
+	if !r.Bits {
+		start, end = start*8, end*8+7
+	}
+	return uint64(start), uint64(end), true
+}
+
+// SetBit sets the bit at offset of the string stored at key to bit,
+// creating the string if needed, and returns the previous bit
+func (e *Engine) SetBit(key string, offset uint64, bit int) (int, error) {
+	var old int
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		old, err = tx.SetBit(key, offset, bit)
+		return err
+	})
+	return old, err
+}
+
+// GetBit returns the bit at offset of the string stored at key, 0 past its
+// end or if the key doesn't exist
+func (e *Engine) GetBit(key string, offset uint64) (int, error) {
+	var bit int
+	err := e.View(func(tx *Tx) error {
+		var err error
+		bit, err = tx.GetBit(key, offset)
+		return err
+	})
+	return bit, err
+}
+
+// BitCount returns the number of bits set in a range of the string stored
+// at key, or in all of it if r is nil
+func (e *Engine) BitCount(key string, r *BitRange) (int64, error) {
+	var n int64
+	err := e.View(func(tx *Tx) error {
+		var err error
+		n, err = tx.BitCount(key, r)
+		return err
+	})
+	return n, err
+}
+
+// BitPos returns the offset of the first bit equal to bit in a range of
+// the string stored at key, or in all of it if r is nil. Returns -1 if
+// there is none, except when looking for 0 without an end: the string is
+// then taken to be followed by zeros.
+func (e *Engine) BitPos(key string, bit int, r *BitRange) (int64, error) {
+	var pos int64
+	err := e.View(func(tx *Tx) error {
+		var err error
+		pos, err = tx.BitPos(key, bit, r)
+		return err
+	})
+	return pos, err
+}
+
+// BitOp stores in dst the result of combining the strings stored at keys
+// with op, and returns its length. Missing keys count as empty strings;
+// dst is removed if the result is empty.
+func (e *Engine) BitOp(op, dst string, keys ...string) (int, error) {
+	var n int
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		n, err = tx.BitOp(op, dst, keys...)
+		return err
+	})
+	return n, err
+}
+
+// SetBit sets a bit of the string stored at key. The change is logged as a
+// single bit, never as the whole string.
+func (tx *Tx) SetBit(key string, offset uint64, bit int) (int, error) {
+	if offset > MaxBitOffset {
+		return 0, ErrBitOffset
+	}
+	if bit != 0 && bit != 1 {
+		return 0, ErrBitValue
+	}
+	entry, err := tx.stringEntry(key)
+	if err != nil {
+		return 0, err
+	}
+	// The string grows to hold the byte of the bit
+	grown := int64(offset/8) + 1
+	if entry != nil {
+		grown -= int64(entry.StrLen())
+	}
+	if err := tx.reserve(key, max(grown, 0)); err != nil {
+		return 0, err
+	}
+
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(key)
+		tx.e.trackRequestRate()
+	}
+	old, err := tx.txn.SetBit(key, offset, bit)
+	if err != nil {
+		return 0, err
+	}
+	tx.log(wal.OpSetBit, key, strconv.Itoa(bit),
+		wal.WithField(strconv.FormatUint(offset, 10)), wal.WithVersion(tx.txn.Version(key)))
+	return old, nil
+}
+
+// GetBit returns a bit of the string stored at key
+func (tx *Tx) GetBit(key string, offset uint64) (int, error) {
+	entry, err := tx.bitmap(key)
+	if err != nil {
+		return 0, err
+	}
+	return entry.GetBit(offset), nil
+}
+
+// BitCount returns the number of bits set in a range of the string stored
+// at key
+func (tx *Tx) BitCount(key string, r *BitRange) (int64, error) {
+	entry, err := tx.bitmap(key)
+	if err != nil {
+		return 0, err
+	}
+	first, last, ok := r.span(entry.StrLen())
+	if !ok {
+		return 0, nil
+	}
+	return entry.BitCount(first, last), nil
+}
+
+// BitPos returns the offset of the first bit equal to bit in a range of
+// the string stored at key
+func (tx *Tx) BitPos(key string, bit int, r *BitRange) (int64, error) {
+	if bit != 0 && bit != 1 {
+		return 0, ErrBitValue
+	}
+	entry, err := tx.bitmap(key)
+	if err != nil {
+		return 0, err
+	}
+	if entry.StrLen() == 0 {
+		// A missing or empty string is all zeros
+		if bit == 0 {
+			return 0, nil
+		}
+		return -1, nil
+	}
+
+	first, last, ok := r.span(entry.StrLen())
+	if !ok {
+		return -1, nil
+	}
+	pos := entry.BitPos(bit, first, last)
+	if pos == -1 && bit == 0 && (r == nil || r.OpenEnd) {
+		return int64(last) + 1, nil
+	}
+	return pos, nil
+}
+
+// BitOp stores the combination of the strings stored at keys in dst,
+// logged as a single SET record
+func (tx *Tx) BitOp(op, dst string, keys ...string) (int, error) {
+	switch op {
+	case BitAnd, BitOr, BitXor:
+	case BitNot:
+		if len(keys) != 1 {
+			return 0, ErrBitOpNot
+		}
+	default:
+		return 0, ErrBitOp
+	}
+
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		entry, err := tx.bitmap(key)
+		if err != nil {
+			return 0, err
+		}
+		values[i] = entry.Bytes()
+	}
+
+	result := store.BitOp(op, values)
+	if len(result) == 0 {
+		if _, err := tx.Delete(dst); err != nil {
+			return 0, err
+		}
+		return 0, nil
+	}
+	if err := tx.reserveValue(dst, int64(len(result))); err != nil {
+		return 0, err
+	}
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(dst)
+		tx.e.trackRequestRate()
+	}
+	tx.put(dst, store.NewBitmapEntry(result))
+	return len(result), nil
+}
+
+// bitmap returns the string entry stored at key, an empty one if the key
+// doesn't exist, and records the read
+func (tx *Tx) bitmap(key string) (*store.Entry, error) {
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordRead(key)
+		tx.e.trackRequestRate()
+	}
+	entry, err := tx.stringEntry(key)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return store.NewEntry(""), nil
+	}
+	return entry, nil
+}
+
+// replaySetBit applies a SETBIT record from the WAL
+func (e *Engine) replaySetBit(record *wal.Record) error {
+	offset, err := strconv.ParseUint(record.Field, 10, 64)
+	if err != nil || offset > MaxBitOffset {
+		return fmt.Errorf("invalid bit offset %q", record.Field)
+	}
+	bit, err := strconv.Atoi(record.Value)
+	if err != nil || (bit != 0 && bit != 1) {
+		return fmt.Errorf("invalid bit %q", record.Value)
+	}
+	e.store.RestoreSetBit(record.Key, offset, bit, record.Version)
+	return nil
+}
@@ -0,0 +1,276 @@
+// internal/engine/bitmap_test.go
+package engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEngine_Bitmap(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if old, err := engine.SetBit("dau", 7, 1); old != 0 || err != nil {
+		t.Fatalf("SetBit: %d, %v", old, err)
+	}
+	if old, _ := engine.SetBit("dau", 7, 1); old != 1 {
+		t.Errorf("Expected previous bit 1, got %d", old)
+	}
+	_, _ = engine.SetBit("dau", 12, 1)
+	if v, _ := engine.Get("dau"); v != "\x01\x08" {
+		t.Errorf("Expected \\x01\\x08, got %q", v)
+	}
+	if bit, _ := engine.GetBit("dau", 12); bit != 1 {
+		t.Errorf("Expected bit 12 set, got %d", bit)
+	}
+	if bit, _ := engine.GetBit("missing", 12); bit != 0 {
+		t.Errorf("Expected 0 for a missing key, got %d", bit)
+	}
+
+	if _, err := engine.SetBit("dau", MaxBitOffset+1, 1); !errors.Is(err, ErrBitOffset) {
+		t.Errorf("Expected ErrBitOffset, got %v", err)
+	}
+	if _, err := engine.SetBit("dau", 0, 2); !errors.Is(err, ErrBitValue) {
+		t.Errorf("Expected ErrBitValue, got %v", err)
+	}
+
+	// SETBIT keeps the TTL
+	engine.Expire("dau", time.Hour)
+	_, _ = engine.SetBit("dau", 0, 1)
+	if engine.TTL("dau") <= 0 {
+		t.Error("Expected SetBit to keep the TTL")
+	}
+
+	_, _ = engine.HSet("hash", map[string]string{"f": "v"})
+	if _, err := engine.SetBit("hash", 0, 1); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	if _, err := engine.BitCount("hash", nil); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestEngine_BitCountAndPos(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	engine.Set("s", "\xff\xf0\x00")
+
+	counts := []struct {
+		r    *BitRange
+		want int64
+	}{
+		{nil, 12},
+		{&BitRange{Start: 1, End: 1}, 4},
+		{&BitRange{Start: -2, End: -1}, 4},
+		{&BitRange{Start: 5, End: 9, Bits: true}, 5},
+		{&BitRange{Start: 2, End: 0}, 0},
+	}
+	for _, c := range counts {
+		if got, _ := engine.BitCount("s", c.r); got != c.want {
+			t.Errorf("BitCount(%+v) = %d, want %d", c.r, got, c.want)
+		}
+	}
+
+	positions := []struct {
+		bit  int
+		r    *BitRange
+		want int64
+	}{
+		{0, nil, 12},
+		{1, &BitRange{Start: 2, End: -1}, -1},
+		{1, &BitRange{Start: 10, End: 20, Bits: true}, 10},
+		{0, &BitRange{Start: 0, End: 0}, -1},
+	}
+	for _, p := range positions {
+		if got, _ := engine.BitPos("s", p.bit, p.r); got != p.want {
+			t.Errorf("BitPos(%d, %+v) = %d, want %d", p.bit, p.r, got, p.want)
+		}
+	}
+
+	// Looking for a 0 in a string of ones without an end finds the bit
+	// right after it
+	engine.Set("ones", "\xff\xff")
+	if got, _ := engine.BitPos("ones", 0, nil); got != 16 {
+		t.Errorf("Expected 16, got %d", got)
+	}
+	if got, _ := engine.BitPos("ones", 0, &BitRange{Start: 1, End: -1, OpenEnd: true}); got != 16 {
+		t.Errorf("Expected 16 with an open end, got %d", got)
+	}
+	if got, _ := engine.BitPos("ones", 0, &BitRange{Start: 0, End: -1}); got != -1 {
+		t.Errorf("Expected -1 with an explicit end, got %d", got)
+	}
+	if got, _ := engine.BitPos("missing", 0, nil); got != 0 {
+		t.Errorf("Expected 0 for a missing key, got %d", got)
+	}
+	if got, _ := engine.BitPos("missing", 1, nil); got != -1 {
+		t.Errorf("Expected -1 for a missing key, got %d", got)
+	}
+}
+
+func TestEngine_BitOp(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	engine.Set("mon", "\xf0\x0f")
+	engine.Set("tue", "\xff")
+
+	if n, err := engine.BitOp(BitAnd, "both", "mon", "tue", "missing"); n != 2 || err != nil {
+		t.Fatalf("BitOp AND: %d, %v", n, err)
+	}
+	if v, _ := engine.Get("both"); v != "\x00\x00" {
+		t.Errorf("Expected AND with a missing key to be zeros, got %q", v)
+	}
+	_, _ = engine.BitOp(BitOr, "either", "mon", "tue")
+	if v, _ := engine.Get("either"); v != "\xff\x0f" {
+		t.Errorf("Expected \\xff\\x0f, got %q", v)
+	}
+	_, _ = engine.BitOp(BitNot, "inverted", "mon")
+	if v, _ := engine.Get("inverted"); v != "\x0f\xf0" {
+		t.Errorf("Expected \\x0f\\xf0, got %q", v)
+	}
+
+	if n, _ := engine.BitOp(BitXor, "either", "missing"); n != 0 || engine.Exists("either") {
+		t.Error("Expected an empty result to remove the destination")
+	}
+	if _, err := engine.BitOp(BitNot, "x", "mon", "tue"); !errors.Is(err, ErrBitOpNot) {
+		t.Errorf("Expected ErrBitOpNot, got %v", err)
+	}
+	if _, err := engine.BitOp("NAND", "x", "mon"); !errors.Is(err, ErrBitOp) {
+		t.Errorf("Expected ErrBitOp, got %v", err)
+	}
+}
+
+func TestEngine_SetBit_WALSize(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	engine.Set("big", strings.Repeat("x", 1<<20))
+	before, _ := engine.WALSize()
+	for i := uint64(0); i < 100; i++ {
+		_, _ = engine.SetBit("big", i*8000, 1)
+	}
+	after, _ := engine.WALSize()
+	if grown := after - before; grown <= 0 || grown > 100*200 {
+		t.Errorf("Expected small bit-level records, the WAL grew by %d bytes", grown)
+	}
+}
+
+func TestEngine_Bitmap_Recovery(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_, _ = engine1.SetBit("dau", 0, 1)
+	_, _ = engine1.SetBit("dau", 100, 1)
+	engine1.Expire("dau", time.Hour)
+	if err := engine1.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	// Bit changes after the snapshot come from the WAL
+	_, _ = engine1.SetBit("dau", 100, 0)
+	_, _ = engine1.SetBit("dau", 1000, 1)
+	_, _ = engine1.SetBit("fresh", 3, 1)
+	want, _ := engine1.Get("dau")
+	version := engine1.Version("dau")
+	engine1.Close()
+
+	engine2, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if v := engine2.Version("dau"); v != version {
+		t.Errorf("Expected version %d after recovery, got %d", version, v)
+	}
+	if got, _ := engine2.Get("dau"); got != want {
+		t.Errorf("Expected the bitmap to survive recovery, got %q", got)
+	}
+	if engine2.TTL("dau") <= 0 {
+		t.Error("Expected the bitmap TTL to survive recovery")
+	}
+	if got, _ := engine2.Get("fresh"); got != "\x10" {
+		t.Errorf("Expected \\x10, got %q", got)
+	}
+}
+
+func TestEngine_BitOp_Recovery(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	// NOT of these bytes holds a backslash followed by n, and the large
+	// result is over the 64KB a line scanner reads
+	engine1.Set("src", "\xa3\x91\x00\xff")
+	engine1.Set("large", strings.Repeat("\xa3\x91", 50*1024))
+	_, _ = engine1.BitOp(BitNot, "small", "src")
+	_, _ = engine1.BitOp(BitNot, "big", "large")
+	small, _ := engine1.Get("small")
+	big, _ := engine1.Get("big")
+	if !strings.Contains(small, "\\n") {
+		t.Fatalf("Expected the result to hold \\n, got %q", small)
+	}
+	engine1.Close()
+
+	engine2, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	defer engine2.Close()
+
+	if got, _ := engine2.Get("small"); got != small {
+		t.Errorf("Expected %q after recovery, got %q", small, got)
+	}
+	if got, _ := engine2.Get("big"); got != big {
+		t.Errorf("Expected the %d byte result to survive recovery", len(big))
+	}
+}
+
+func TestEngine_Bitmap_RecoveryAfterExpiry(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// The server stops before the TTL passes, so no DELETE is logged
+	engine1, err := New(Options{WALPath: tmpDir, TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_, _ = engine1.SetBit("bits", 0, 1)
+	engine1.Expire("bits", 50*time.Millisecond)
+	_, _ = engine1.SetBit("bits", 9, 1)
+	engine1.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Replaying the later bit must not bring the string back without its
+	// TTL
+	engine2, err := New(Options{WALPath: tmpDir, TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if engine2.Exists("bits") {
+		value, _ := engine2.Get("bits")
+		t.Errorf("Expected the expired bitmap to stay expired, got %q with TTL %v", value, engine2.TTL("bits"))
+	}
+}
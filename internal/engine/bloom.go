@@ -0,0 +1,193 @@
+// internal/engine/bloom.go
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lofoneh/kvlite/internal/store"
+	"github.com/lofoneh/kvlite/internal/wal"
+)
+
+var (
+	// ErrBloomExists is returned by BFReserve when the key already exists
+	ErrBloomExists = errors.New("item exists")
+	// ErrBloomParams is returned for an invalid error rate, capacity or
+	// expansion
+	ErrBloomParams = errors.New("error rate must be between 0 and 1, capacity and expansion at least 1")
+	// ErrBloomFull is returned when adding to a full non-scaling filter
+	ErrBloomFull = store.ErrBloomFull
+	// ErrBloomTooLarge is returned when a filter would need too much memory
+	ErrBloomTooLarge = store.ErrBloomTooLarge
+)
+
+// BloomOptions controls how a Bloom filter grows
+type BloomOptions struct {
+	Expansion  int  // Capacity growth factor of each new sub-filter, 0 means 2
+	NonScaling bool // Fail with ErrBloomFull once capacity items were added
+}
+
+// BFReserve creates an empty Bloom filter at key that holds capacity items
+// with the given false positive rate before it needs to grow
+func (e *Engine) BFReserve(key string, errorRate float64, capacity int, opts BloomOptions) error {
+	return e.Atomic(func(tx *Tx) error {
+		return tx.BFReserve(key, errorRate, capacity, opts)
+	})
+}
+
+// BFAdd adds an item to the Bloom filter stored at key, creating it with
+// default parameters if needed. Returns true if the item wasn't already
+// present.
+func (e *Engine) BFAdd(key, item string) (bool, error) {
+	added, err := e.BFMAdd(key, item)
+	if err != nil {
+		return false, err
+	}
+	return added[0], nil
+}
+
+// BFMAdd adds items to the Bloom filter stored at key, creating it with
+// default parameters if needed, and reports for each whether it was added
+func (e *Engine) BFMAdd(key string, items ...string) ([]bool, error) {
+	var added []bool
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		added, err = tx.BFMAdd(key, items...)
+		return err
+	})
+	return added, err
+}
+
+// BFExists reports whether an item may have been added to the Bloom filter
+// stored at key
+func (e *Engine) BFExists(key, item string) (bool, error) {
+	var ok bool
+	err := e.View(func(tx *Tx) error {
+		var err error
+		ok, err = tx.BFExists(key, item)
+		return err
+	})
+	return ok, err
+}
+
+// BFReserve creates an empty Bloom filter at key. The filter is logged by
+// its parameters, not its (empty) bits.
+func (tx *Tx) BFReserve(key string, errorRate float64, capacity int, opts BloomOptions) error {
+	if opts.Expansion == 0 {
+		opts.Expansion = store.DefaultBloomExpansion
+	}
+	if !(errorRate > 0 && errorRate < 1) || capacity < 1 || opts.Expansion < 1 {
+		return ErrBloomParams
+	}
+	if _, ok := tx.txn.GetEntry(key); ok {
+		return ErrBloomExists
+	}
+	b, err := store.NewBloom(errorRate, capacity, opts.Expansion, opts.NonScaling)
+	if err != nil {
+		return err
+	}
+	entry := store.NewBloomEntry(b)
+	if err := tx.reserveValue(key, entry.MemoryUsage()); err != nil {
+		return err
+	}
+
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(key)
+		tx.e.trackRequestRate()
+	}
+	tx.txn.Put(key, entry)
+	tx.log(wal.OpBFInit, key, fmt.Sprintf("%g %d %d %t", errorRate, capacity, opts.Expansion, opts.NonScaling),
+		wal.WithVersion(tx.txn.Version(key)))
+	return nil
+}
+
+// BFAdd adds an item to the Bloom filter stored at key
+func (tx *Tx) BFAdd(key, item string) (bool, error) {
+	added, err := tx.BFMAdd(key, item)
+	if err != nil {
+		return false, err
+	}
+	return added[0], nil
+}
+
+// BFMAdd adds items to the Bloom filter stored at key. Each item added is
+// logged on its own; items already present aren't logged.
+func (tx *Tx) BFMAdd(key string, items ...string) ([]bool, error) {
+	b, err := tx.txn.Bloom(key)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		err := tx.BFReserve(key, store.DefaultBloomErrorRate, store.DefaultBloomCapacity, BloomOptions{})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if err := tx.reserve(key, b.Growth(len(items))); err != nil {
+			return nil, err
+		}
+		if tx.e.enableAnalytics && tx.e.analytics != nil {
+			tx.e.analytics.RecordWrite(key)
+			tx.e.trackRequestRate()
+		}
+	}
+
+	added := make([]bool, 0, len(items))
+	for _, item := range items {
+		ok, err := tx.txn.BFAdd(key, item)
+		if err != nil {
+			return added, err
+		}
+		if ok {
+			tx.log(wal.OpBFAdd, key, item, wal.WithVersion(tx.txn.Version(key)))
+		}
+		added = append(added, ok)
+	}
+	return added, nil
+}
+
+// BFExists reports whether an item may have been added to the Bloom filter
+// stored at key
+func (tx *Tx) BFExists(key, item string) (bool, error) {
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordRead(key)
+		tx.e.trackRequestRate()
+	}
+	b, err := tx.txn.Bloom(key)
+	if b == nil || err != nil {
+		return false, err
+	}
+	return b.Exists(item), nil
+}
+
+// replayBloom applies a Bloom filter record from the WAL
+func (e *Engine) replayBloom(record *wal.Record) error {
+	switch record.Op {
+	case wal.OpBFInit:
+		parts := strings.Fields(record.Value)
+		if len(parts) != 4 {
+			return fmt.Errorf("invalid Bloom filter parameters %q", record.Value)
+		}
+		errorRate, err1 := strconv.ParseFloat(parts[0], 64)
+		capacity, err2 := strconv.Atoi(parts[1])
+		expansion, err3 := strconv.Atoi(parts[2])
+		nonScaling, err4 := strconv.ParseBool(parts[3])
+		if err := errors.Join(err1, err2, err3, err4); err != nil {
+			return fmt.Errorf("invalid Bloom filter parameters %q: %w", record.Value, err)
+		}
+		b, err := store.NewBloom(errorRate, capacity, expansion, nonScaling)
+		if err != nil {
+			return err
+		}
+		entry := store.NewBloomEntry(b)
+		entry.Version = record.Version
+		e.store.Restore(record.Key, entry)
+	case wal.OpBFAdd:
+		e.store.RestoreBloom(record.Key, record.Version, func(b *store.Bloom) {
+			b.Add(record.Value)
+		})
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// internal/engine/bloom_test.go
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestEngine_Bloom(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if err := engine.BFReserve("bf", 0.001, 1000, BloomOptions{}); err != nil {
+		t.Fatalf("BFReserve: %v", err)
+	}
+	if err := engine.BFReserve("bf", 0.001, 1000, BloomOptions{}); !errors.Is(err, ErrBloomExists) {
+		t.Errorf("Expected ErrBloomExists, got %v", err)
+	}
+	for _, bad := range []struct {
+		rate     float64
+		capacity int
+		opts     BloomOptions
+	}{{0, 10, BloomOptions{}}, {1, 10, BloomOptions{}}, {0.1, 0, BloomOptions{}}, {0.1, 10, BloomOptions{Expansion: -1}}} {
+		if err := engine.BFReserve("other", bad.rate, bad.capacity, bad.opts); !errors.Is(err, ErrBloomParams) {
+			t.Errorf("BFReserve(%v, %d, %+v): expected ErrBloomParams, got %v", bad.rate, bad.capacity, bad.opts, err)
+		}
+	}
+
+	if added, _ := engine.BFAdd("bf", "a"); !added {
+		t.Error("Expected a to be added")
+	}
+	if added, _ := engine.BFMAdd("bf", "a", "b", "b"); !reflect.DeepEqual(added, []bool{false, true, false}) {
+		t.Errorf("Unexpected BFMAdd result: %v", added)
+	}
+	if ok, _ := engine.BFExists("bf", "b"); !ok {
+		t.Error("Expected b to exist")
+	}
+	if ok, _ := engine.BFExists("missing", "b"); ok {
+		t.Error("Expected nothing to exist in a missing filter")
+	}
+
+	// BFAdd creates a filter with default parameters
+	if added, err := engine.BFAdd("auto", "x"); !added || err != nil {
+		t.Errorf("BFAdd on a new key: %v, %v", added, err)
+	}
+
+	_ = engine.BFReserve("fixed", 0.01, 2, BloomOptions{NonScaling: true})
+	added, err := engine.BFMAdd("fixed", "1", "2", "3")
+	if !errors.Is(err, ErrBloomFull) || len(added) != 2 {
+		t.Errorf("Expected ErrBloomFull after 2 items, got %v, %v", added, err)
+	}
+
+	engine.Set("str", "value")
+	if _, err := engine.BFAdd("str", "a"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestEngine_Bloom_Recovery(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_ = engine1.BFReserve("bf", 0.01, 10, BloomOptions{Expansion: 4})
+	for i := 0; i < 20; i++ {
+		_, _ = engine1.BFAdd("bf", fmt.Sprint(i))
+	}
+	if err := engine1.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	// Items added after the snapshot come from the WAL, including the
+	// ones that make the filter grow
+	for i := 20; i < 100; i++ {
+		_, _ = engine1.BFAdd("bf", fmt.Sprint(i))
+	}
+	_, _ = engine1.BFAdd("fresh", "x")
+	version := engine1.Version("bf")
+	engine1.Close()
+
+	engine2, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if v := engine2.Version("bf"); v != version {
+		t.Errorf("Expected version %d after recovery, got %d", version, v)
+	}
+	for i := 0; i < 100; i++ {
+		if ok, _ := engine2.BFExists("bf", fmt.Sprint(i)); !ok {
+			t.Fatalf("Item %d was lost in recovery", i)
+		}
+	}
+	if ok, _ := engine2.BFExists("fresh", "x"); !ok {
+		t.Error("Expected the default filter to survive recovery")
+	}
+}
@@ -0,0 +1,87 @@
+// internal/engine/cas.go
+package engine
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lofoneh/kvlite/internal/store"
+)
+
+// ErrVersionConflict is returned by CompareAndSwap when the key's version
+// doesn't match the expected one
+var ErrVersionConflict = errors.New("version conflict")
+
+// GetWithVersion retrieves a value together with its version. Like Get it
+// only takes the read lock and doesn't count against the quota.
+func (e *Engine) GetWithVersion(key string) (string, uint64, bool, error) {
+	if e.enableAnalytics && e.analytics != nil {
+		e.analytics.RecordRead(key)
+		e.trackRequestRate()
+	}
+
+	val, version, ok := e.store.GetWithVersion(key)
+	if !ok && e.store.Version(key) != 0 {
+		return "", 0, false, ErrWrongType
+	}
+	return val, version, ok, nil
+}
+
+// CompareAndSwap stores value if the key's current version equals expected
+// and returns the new version. An expected version of 0 only succeeds if the
+// key doesn't exist. The key's TTL is preserved. On mismatch the returned
+// error wraps ErrVersionConflict and the current version is returned. Keys
+// holding a type other than string fail with ErrWrongType.
+func (e *Engine) CompareAndSwap(key string, expected uint64, value string) (uint64, error) {
+	var version uint64
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		version, err = tx.CompareAndSwap(key, expected, value)
+		return err
+	})
+	return version, err
+}
+
+// GetWithVersion retrieves a value together with its version
+func (tx *Tx) GetWithVersion(key string) (string, uint64, bool, error) {
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordRead(key)
+		tx.e.trackRequestRate()
+	}
+	entry, err := tx.stringEntry(key)
+	if entry == nil || err != nil {
+		return "", 0, false, err
+	}
+	return entry.StringValue(), entry.Version, true, nil
+}
+
+// CompareAndSwap stores value if the key's current version equals expected
+func (tx *Tx) CompareAndSwap(key string, expected uint64, value string) (uint64, error) {
+	if err := tx.reserveValue(key, int64(len(value))); err != nil {
+		return 0, err
+	}
+	entry, err := tx.stringEntry(key)
+	if err != nil {
+		return 0, err
+	}
+
+	var current uint64
+	var expiresAt int64
+	if entry != nil {
+		current = entry.Version
+		expiresAt = entry.ExpiresAt
+	}
+
+	if current != expected {
+		return current, fmt.Errorf("%w: expected %d, current %d", ErrVersionConflict, expected, current)
+	}
+
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(key)
+		tx.e.trackRequestRate()
+	}
+
+	entry = &store.Entry{Value: value, ExpiresAt: expiresAt}
+	tx.put(key, entry)
+	return entry.Version, nil
+}
@@ -0,0 +1,144 @@
+// internal/engine/cas_test.go
+package engine
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEngine_CompareAndSwap(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	// Version 0 creates a missing key
+	v1, err := engine.CompareAndSwap("k", 0, "a")
+	if err != nil || v1 == 0 {
+		t.Fatalf("CAS create failed: version %d, %v", v1, err)
+	}
+
+	// Version 0 fails once the key exists
+	current, err := engine.CompareAndSwap("k", 0, "b")
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+	if current != v1 {
+		t.Errorf("Expected current version %d on conflict, got %d", v1, current)
+	}
+
+	v2, err := engine.CompareAndSwap("k", v1, "b")
+	if err != nil || v2 <= v1 {
+		t.Fatalf("CAS with matching version failed: version %d, %v", v2, err)
+	}
+
+	// A stale version fails and leaves the value alone
+	if _, err := engine.CompareAndSwap("k", v1, "c"); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict for stale version, got %v", err)
+	}
+	val, version, ok, _ := engine.GetWithVersion("k")
+	if !ok || val != "b" || version != v2 {
+		t.Errorf("Expected b@%d, got %s@%d (exists: %v)", v2, val, version, ok)
+	}
+}
+
+func TestEngine_CompareAndSwap_KeepsTTL(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_ = engine.SetWithTTL("k", "a", time.Hour)
+	_, version, _, _ := engine.GetWithVersion("k")
+
+	if _, err := engine.CompareAndSwap("k", version, "b"); err != nil {
+		t.Fatalf("CAS failed: %v", err)
+	}
+	if ttl := engine.TTL("k"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Expected TTL to be preserved, got %v", ttl)
+	}
+}
+
+func TestEngine_CompareAndSwap_Concurrent(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_ = engine.Set("k", "v")
+	_, version, _, _ := engine.GetWithVersion("k")
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	winners := 0
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := engine.CompareAndSwap("k", version, "new"); err == nil {
+				mu.Lock()
+				winners++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if winners != 1 {
+		t.Errorf("Expected exactly one CAS to win, got %d", winners)
+	}
+}
+
+func TestEngine_VersionRecovery(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_ = engine1.Set("a", "1")
+	_ = engine1.Set("b", "2")
+	engine1.Expire("a", time.Hour)
+	_, va, _, _ := engine1.GetWithVersion("a")
+
+	// Compact so that "b" comes from the snapshot, then delete it in the WAL
+	if err := engine1.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	_, vb, _, _ := engine1.GetWithVersion("b")
+	_, _ = engine1.Delete("b")
+	engine1.Close()
+
+	engine2, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if _, v, _, _ := engine2.GetWithVersion("a"); v != va {
+		t.Errorf("Expected version %d after recovery, got %d", va, v)
+	}
+	if ttl := engine2.TTL("a"); ttl <= 0 {
+		t.Error("Expected TTL set by Expire to survive recovery")
+	}
+
+	// A CAS from before the restart still works
+	if _, err := engine2.CompareAndSwap("a", va, "3"); err != nil {
+		t.Errorf("CAS with pre-restart version failed: %v", err)
+	}
+
+	// A recreated key never reuses the deleted key's version
+	v, err := engine2.CompareAndSwap("b", 0, "again")
+	if err != nil {
+		t.Fatalf("CAS create failed: %v", err)
+	}
+	if v <= vb {
+		t.Errorf("Recreated key reused an old version: %d <= %d", v, vb)
+	}
+}
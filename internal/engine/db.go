@@ -0,0 +1,197 @@
+// internal/engine/db.go
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/lofoneh/kvlite/internal/store"
+	"github.com/lofoneh/kvlite/internal/wal"
+)
+
+// DefaultDatabases is the number of logical databases of an engine when
+// Options.Databases isn't set
+const DefaultDatabases = 16
+
+var (
+	// ErrDBIndex is returned for a database number the engine doesn't have
+	ErrDBIndex = errors.New("DB index is out of range")
+	// ErrSameDB is returned when moving a key to the database it is in
+	ErrSameDB = errors.New("source and destination objects are the same")
+)
+
+// Logical databases are separate keyspaces in one engine. Each has its own
+// store, and all the stores share one lock and one version counter, so a
+// Tx can work across databases and versions stay unique. WAL records carry
+// the number of the database they apply to, and snapshots store each
+// database's keys separately.
+
+// DB returns the handle on logical database n. Handles are created with
+// the engine and can be used concurrently.
+func (e *Engine) DB(n int) (*Engine, error) {
+	if n < 0 || n >= len(e.dbs) {
+		return nil, ErrDBIndex
+	}
+	return e.dbs[n], nil
+}
+
+// Index returns the number of the database the handle operates on
+func (e *Engine) Index() int {
+	return e.db
+}
+
+// Databases returns the number of logical databases
+func (e *Engine) Databases() int {
+	return len(e.dbs)
+}
+
+// DBSizes returns the number of keys in each database, by number
+func (e *Engine) DBSizes() []int {
+	sizes := make([]int, len(e.dbs))
+	for i, db := range e.dbs {
+		sizes[i] = db.store.Len()
+	}
+	return sizes
+}
+
+// totalLen returns the number of keys in all databases
+func (c *core) totalLen() int {
+	n := 0
+	for _, db := range c.dbs {
+		n += db.store.Len()
+	}
+	return n
+}
+
+// DeleteExpired removes the expired keys of every database until
+// deadline, for the TTL manager. Each check starts at the next database,
+// so one with a large backlog can't keep the others from being visited.
+// The keys removed are logged as deletes.
+func (c *core) DeleteExpired(deadline time.Time) (deleted, backlog int) {
+	first := int(atomic.AddUint32(&c.expireNext, 1))
+	for i := range c.dbs {
+		n, left := c.dbs[(first+i)%len(c.dbs)].store.ExpireDue(deadline)
+		deleted += n
+		backlog += left
+	}
+	c.flushExpired()
+	return deleted, backlog
+}
+
+// ClearAll removes the keys of every database
+func (e *Engine) ClearAll() error {
+	return e.Atomic(func(tx *Tx) error {
+		return tx.ClearAll()
+	})
+}
+
+// Move moves key to database db, keeping its TTL. It returns false if the
+// key doesn't exist or db already holds it.
+func (e *Engine) Move(key string, db int) (bool, error) {
+	var moved bool
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		moved, err = tx.Move(key, db)
+		return err
+	})
+	return moved, err
+}
+
+// SwapDB exchanges the contents of two databases
+func (e *Engine) SwapDB(db1, db2 int) error {
+	return e.Atomic(func(tx *Tx) error {
+		return tx.SwapDB(db1, db2)
+	})
+}
+
+// DB returns a Tx on logical database n within the same transaction: its
+// writes are logged in the same batch
+func (tx *Tx) DB(n int) (*Tx, error) {
+	db, err := tx.e.DB(n)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{e: db, txn: tx.txn.On(db.store), records: tx.records}, nil
+}
+
+// Index returns the number of the database the Tx operates on
+func (tx *Tx) Index() int {
+	return tx.e.db
+}
+
+// ClearAll removes the keys of every database, logging a CLEAR for each
+// database that has keys
+func (tx *Tx) ClearAll() error {
+	for n := range tx.e.dbs {
+		db, err := tx.DB(n)
+		if err != nil {
+			return err
+		}
+		if db.txn.Len() == 0 {
+			continue
+		}
+		if err := db.Clear(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Move moves key to database n, keeping its TTL
+func (tx *Tx) Move(key string, n int) (bool, error) {
+	if n == tx.e.db {
+		return false, ErrSameDB
+	}
+	dst, err := tx.DB(n)
+	if err != nil {
+		return false, err
+	}
+	entry, ok := tx.txn.GetEntry(key)
+	if !ok || dst.Exists(key) {
+		return false, nil
+	}
+	if err := dst.reserveValue(key, entry.MemoryUsage()); err != nil {
+		return false, err
+	}
+	// Each store accounts for its own copy of the entry
+	moved := *entry
+	dst.put(key, &moved)
+	return tx.Delete(key)
+}
+
+// SwapDB exchanges the contents of two databases
+func (tx *Tx) SwapDB(n1, n2 int) error {
+	db1, err := tx.DB(n1)
+	if err != nil {
+		return err
+	}
+	db2, err := tx.DB(n2)
+	if err != nil {
+		return err
+	}
+	if n1 == n2 {
+		return nil
+	}
+	db1.txn.Swap(db2.e.store)
+	db1.log(wal.OpSwapDB, "", strconv.Itoa(n2))
+	return nil
+}
+
+// replaySwapDB applies a SWAPDB record, logged on the first database
+func (e *Engine) replaySwapDB(record *wal.Record) error {
+	n, err := strconv.Atoi(record.Value)
+	if err != nil {
+		return fmt.Errorf("invalid SWAPDB record: %w", err)
+	}
+	other, err := e.DB(n)
+	if err != nil {
+		return fmt.Errorf("failed to replay SWAPDB: %w", err)
+	}
+	return e.store.Update(func(txn *store.Txn) error {
+		txn.Swap(other.store)
+		return nil
+	})
+}
@@ -0,0 +1,222 @@
+// internal/engine/db_test.go
+package engine
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEngine_DBIsolation(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir(), Databases: 4})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if _, err := engine.DB(4); !errors.Is(err, ErrDBIndex) {
+		t.Errorf("Expected ErrDBIndex, got %v", err)
+	}
+	db1, _ := engine.DB(1)
+	if db1.Index() != 1 || engine.Index() != 0 {
+		t.Errorf("Unexpected indexes: %d, %d", engine.Index(), db1.Index())
+	}
+
+	_ = engine.Set("k", "zero")
+	_ = db1.Set("k", "one")
+	_ = db1.Set("only1", "x")
+
+	if v, _ := engine.Get("k"); v != "zero" {
+		t.Errorf("Expected zero in db 0, got %q", v)
+	}
+	if v, _ := db1.Get("k"); v != "one" {
+		t.Errorf("Expected one in db 1, got %q", v)
+	}
+	if engine.Exists("only1") {
+		t.Error("Key of db 1 visible in db 0")
+	}
+	if sizes := engine.DBSizes(); sizes[0] != 1 || sizes[1] != 2 || sizes[2] != 0 {
+		t.Errorf("Unexpected sizes: %v", sizes)
+	}
+
+	// Clear only touches one database, ClearAll all of them
+	_ = db1.Clear()
+	if engine.Len() != 1 || db1.Len() != 0 {
+		t.Errorf("Clear: expected 1 and 0 keys, got %d and %d", engine.Len(), db1.Len())
+	}
+	_ = db1.Set("k", "one")
+	_ = db1.ClearAll()
+	if engine.Len() != 0 || db1.Len() != 0 {
+		t.Errorf("ClearAll: expected no keys, got %d and %d", engine.Len(), db1.Len())
+	}
+}
+
+func TestEngine_Move(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir(), Databases: 4})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	db2, _ := engine.DB(2)
+
+	_ = engine.SetWithTTL("k", "v", time.Hour)
+	moved, err := engine.Move("k", 2)
+	if err != nil || !moved {
+		t.Fatalf("Move failed: %v, %v", moved, err)
+	}
+	if engine.Exists("k") {
+		t.Error("Moved key still in source")
+	}
+	if v, _ := db2.Get("k"); v != "v" {
+		t.Errorf("Expected v in target, got %q", v)
+	}
+	if ttl := db2.TTL("k"); ttl <= 0 {
+		t.Errorf("Expected TTL to be kept, got %v", ttl)
+	}
+
+	// Missing key, existing target and same database
+	if moved, _ := engine.Move("missing", 2); moved {
+		t.Error("Moved a missing key")
+	}
+	_ = engine.Set("k", "other")
+	if moved, _ := engine.Move("k", 2); moved {
+		t.Error("Overwrote a key in the target")
+	}
+	if _, err := engine.Move("k", 0); !errors.Is(err, ErrSameDB) {
+		t.Errorf("Expected ErrSameDB, got %v", err)
+	}
+	if _, err := engine.Move("k", 9); !errors.Is(err, ErrDBIndex) {
+		t.Errorf("Expected ErrDBIndex, got %v", err)
+	}
+}
+
+func TestEngine_SwapDB(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir(), Databases: 4})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	db3, _ := engine.DB(3)
+
+	_ = engine.Set("a", "0")
+	_ = db3.Set("b", "3")
+	before := engine.Version("a")
+
+	if err := engine.SwapDB(0, 3); err != nil {
+		t.Fatalf("SwapDB failed: %v", err)
+	}
+	if engine.Exists("a") || !engine.Exists("b") || !db3.Exists("a") {
+		t.Error("Databases not swapped")
+	}
+	// Versions move with the keys, so WATCH in the other database still
+	// sees them as unchanged
+	if db3.Version("a") != before {
+		t.Errorf("Version changed: %d != %d", db3.Version("a"), before)
+	}
+	if err := engine.SwapDB(0, 4); !errors.Is(err, ErrDBIndex) {
+		t.Errorf("Expected ErrDBIndex, got %v", err)
+	}
+}
+
+func TestEngine_DBRecovery(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir, Databases: 4})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	db1, _ := engine1.DB(1)
+	db2, _ := engine1.DB(2)
+	_ = engine1.Set("k", "zero")
+	_ = db1.Set("k", "one")
+	_, _ = db1.HSet("h", map[string]string{"f": "v"})
+	_ = db2.Set("moved", "x")
+	_, _ = db2.Move("moved", 3)
+	_ = engine1.SwapDB(1, 2)
+	engine1.Close()
+
+	check := func(e *Engine) {
+		t.Helper()
+		db2, _ := e.DB(2)
+		db3, _ := e.DB(3)
+		if v, _ := e.Get("k"); v != "zero" {
+			t.Errorf("db 0: expected zero, got %q", v)
+		}
+		if v, _ := db2.Get("k"); v != "one" {
+			t.Errorf("db 2: expected one, got %q", v)
+		}
+		if v, ok, _ := db2.HGet("h", "f"); !ok || v != "v" {
+			t.Errorf("db 2: expected hash field, got %q", v)
+		}
+		if !db3.Exists("moved") {
+			t.Error("db 3: expected moved key")
+		}
+		if sizes := e.DBSizes(); sizes[1] != 0 {
+			t.Errorf("db 1: expected no keys, got %d", sizes[1])
+		}
+	}
+
+	// Replay from the WAL
+	engine2, err := New(Options{WALPath: tmpDir, Databases: 4})
+	if err != nil {
+		t.Fatalf("Failed to recover engine: %v", err)
+	}
+	check(engine2)
+
+	// Then from a snapshot
+	if err := engine2.ForceCompact(); err != nil {
+		t.Fatalf("Compaction failed: %v", err)
+	}
+	engine2.Close()
+
+	engine3, err := New(Options{WALPath: tmpDir, Databases: 4})
+	if err != nil {
+		t.Fatalf("Failed to recover engine: %v", err)
+	}
+	defer engine3.Close()
+	check(engine3)
+}
+
+func TestEngine_Move_RecoveryLargeValues(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir, Databases: 2})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	// MOVE logs the whole value in one record, well over 64KB here
+	fields := make(map[string]string, 5000)
+	for i := 0; i < 5000; i++ {
+		fields["field:"+strconv.Itoa(i)] = `C:\new|` + strconv.Itoa(i)
+	}
+	_, _ = engine1.HSet("hash", fields)
+	_ = engine1.Set("str", strings.Repeat(`\n`, 100*1024))
+	for _, key := range []string{"hash", "str"} {
+		if moved, err := engine1.Move(key, 1); !moved || err != nil {
+			t.Fatalf("Move(%s) failed: %v, %v", key, moved, err)
+		}
+	}
+	engine1.Close()
+
+	engine2, err := New(Options{WALPath: tmpDir, Databases: 2})
+	if err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	defer engine2.Close()
+
+	db1, _ := engine2.DB(1)
+	if n, _ := db1.HLen("hash"); n != len(fields) {
+		t.Errorf("Expected %d fields after recovery, got %d", len(fields), n)
+	}
+	if v, _, _ := db1.HGet("hash", "field:7"); v != `C:\new|7` {
+		t.Errorf("Expected the field value to survive recovery, got %q", v)
+	}
+	if v, _ := db1.Get("str"); len(v) != 200*1024 {
+		t.Errorf("Expected the moved string to survive recovery, got %d bytes", len(v))
+	}
+	if engine2.Exists("hash") || engine2.Exists("str") {
+		t.Error("Expected the moved keys to stay out of database 0")
+	}
+}
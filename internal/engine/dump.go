@@ -0,0 +1,158 @@
+// internal/engine/dump.go
+package engine
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"time"
+
+	"github.com/lofoneh/kvlite/internal/store"
+)
+
+var (
+	// ErrBusyKey is returned by Restore when the key exists and Replace
+	// isn't set
+	ErrBusyKey = errors.New("BUSYKEY Target key name already exists")
+	// ErrDumpPayload is returned by Restore for data that isn't a valid
+	// dump of this version
+	ErrDumpPayload = errors.New("DUMP payload version or checksum are wrong")
+)
+
+// A dump holds one key's value, type and expiration, so that the key can
+// be moved between instances:
+//
+//	"KV" | version (1 byte) | type name | expiration | payload | CRC-32
+//
+// The type name and payload (see store.Entry.Payload) are prefixed with
+// their length as uvarints, the expiration is a varint of Unix nanoseconds,
+// 0 for none, and the IEEE CRC-32 of everything before it is stored big
+// endian. The key itself isn't part of the dump.
+const (
+	dumpMagic   = "KV"
+	dumpVersion = 1
+)
+
+// RestoreOptions controls how Restore writes a dump
+type RestoreOptions struct {
+	// ExpiresAt replaces the expiration in the dump, in Unix nanoseconds.
+	// 0 keeps the dump's.
+	ExpiresAt int64
+	// Replace overwrites the key if it exists
+	Replace bool
+}
+
+// Dump serializes the value at key with its type and expiration. It
+// returns false if the key doesn't exist.
+func (e *Engine) Dump(key string) ([]byte, bool) {
+	var data []byte
+	var ok bool
+	e.View(func(tx *Tx) error {
+		data, ok = tx.Dump(key)
+		return nil
+	})
+	return data, ok
+}
+
+// Restore stores the value of a dump at key. A dump whose expiration has
+// passed restores nothing, but still replaces the key with Replace.
+func (e *Engine) Restore(key string, data []byte, opts RestoreOptions) error {
+	return e.Atomic(func(tx *Tx) error {
+		return tx.Restore(key, data, opts)
+	})
+}
+
+// Dump serializes the value at key with its type and expiration
+func (tx *Tx) Dump(key string) ([]byte, bool) {
+	entry, ok := tx.txn.GetEntry(key)
+	if !ok {
+		return nil, false
+	}
+	return encodeDump(entry), true
+}
+
+// Restore stores the value of a dump at key
+func (tx *Tx) Restore(key string, data []byte, opts RestoreOptions) error {
+	entry, err := decodeDump(data)
+	if err != nil {
+		return err
+	}
+	if !opts.Replace && tx.Exists(key) {
+		return ErrBusyKey
+	}
+	if opts.ExpiresAt != 0 {
+		entry.ExpiresAt = opts.ExpiresAt
+	}
+	if entry.ExpiresAt != 0 && entry.ExpiresAt <= time.Now().UnixNano() {
+		_, err := tx.Delete(key)
+		return err
+	}
+	if err := tx.reserveValue(key, entry.MemoryUsage()); err != nil {
+		return err
+	}
+	tx.put(key, entry)
+	return nil
+}
+
+// encodeDump serializes an entry in the dump format
+func encodeDump(entry *store.Entry) []byte {
+	typeName, payload := entry.Type.String(), entry.Payload()
+
+	buf := make([]byte, 0, len(dumpMagic)+1+2*binary.MaxVarintLen64+len(typeName)+len(payload)+binary.MaxVarintLen64+4)
+	buf = append(buf, dumpMagic...)
+	buf = append(buf, dumpVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(typeName)))
+	buf = append(buf, typeName...)
+	buf = binary.AppendVarint(buf, entry.ExpiresAt)
+	buf = binary.AppendUvarint(buf, uint64(len(payload)))
+	buf = append(buf, payload...)
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+}
+
+// decodeDump rebuilds the entry serialized by encodeDump, checking the
+// version and checksum
+func decodeDump(data []byte) (*store.Entry, error) {
+	if len(data) < len(dumpMagic)+1+4 || string(data[:len(dumpMagic)]) != dumpMagic || data[len(dumpMagic)] != dumpVersion {
+		return nil, ErrDumpPayload
+	}
+	body, sum := data[:len(data)-4], data[len(data)-4:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return nil, ErrDumpPayload
+	}
+
+	r := body[len(dumpMagic)+1:]
+	typeName, r, ok := readDumpString(r)
+	if !ok {
+		return nil, ErrDumpPayload
+	}
+	expiresAt, n := binary.Varint(r)
+	if n <= 0 {
+		return nil, ErrDumpPayload
+	}
+	payload, r, ok := readDumpString(r[n:])
+	if !ok || len(r) != 0 {
+		return nil, ErrDumpPayload
+	}
+
+	t, err := store.ParseValueType(typeName)
+	if err != nil {
+		return nil, ErrDumpPayload
+	}
+	entry, err := store.NewEntryFromPayload(t, payload)
+	if err != nil {
+		return nil, ErrDumpPayload
+	}
+	entry.ExpiresAt = expiresAt
+	return entry, nil
+}
+
+// readDumpString reads a length-prefixed string, returning the rest of
+// the data
+func readDumpString(data []byte) (string, []byte, bool) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || size > uint64(len(data)-n) {
+		return "", nil, false
+	}
+	data = data[n:]
+	return string(data[:size]), data[size:], true
+}
@@ -0,0 +1,102 @@
+// internal/engine/dump_test.go
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEngine_DumpRestore(t *testing.T) {
+	src, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer src.Close()
+	dst, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer dst.Close()
+
+	if _, ok := src.Dump("missing"); ok {
+		t.Error("Expected no dump for a missing key")
+	}
+
+	_, _ = src.RPush("list", "a", "b", "c")
+	_ = src.Expire("list", time.Hour)
+	_, _ = src.ZAdd("zset", []ZMember{{Member: "m", Score: 2.5}}, ZAddOptions{})
+
+	// A key moves between instances with its type, value and TTL
+	data, ok := src.Dump("list")
+	if !ok {
+		t.Fatal("Dump failed")
+	}
+	if err := dst.Restore("copy", data, RestoreOptions{}); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if values, _ := dst.LRange("copy", 0, -1); len(values) != 3 || values[2] != "c" {
+		t.Errorf("Unexpected restored list: %v", values)
+	}
+	if ttl := dst.TTL("copy"); ttl < 59*time.Minute {
+		t.Errorf("Expected the TTL to be restored, got %v", ttl)
+	}
+	if dst.Type("copy") != "list" {
+		t.Errorf("Expected a list, got %s", dst.Type("copy"))
+	}
+
+	// An existing key is only replaced on request
+	data, _ = src.Dump("zset")
+	if err := dst.Restore("copy", data, RestoreOptions{}); !errors.Is(err, ErrBusyKey) {
+		t.Errorf("Expected ErrBusyKey, got %v", err)
+	}
+	if err := dst.Restore("copy", data, RestoreOptions{Replace: true, ExpiresAt: time.Now().Add(time.Minute).UnixNano()}); err != nil {
+		t.Fatalf("Restore with Replace failed: %v", err)
+	}
+	if score, ok, _ := dst.ZScore("copy", "m"); !ok || score != 2.5 {
+		t.Errorf("Expected the restored zset, got %v", score)
+	}
+	if ttl := dst.TTL("copy"); ttl > time.Minute {
+		t.Errorf("Expected the given expiration, got %v", ttl)
+	}
+
+	// An expiration in the past restores nothing
+	if err := dst.Restore("copy", data, RestoreOptions{Replace: true, ExpiresAt: 1}); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if dst.Exists("copy") {
+		t.Error("Expected an expired restore to leave no key")
+	}
+}
+
+func TestEngine_RestoreInvalid(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_ = engine.Set("k", "value")
+	data, _ := engine.Dump("k")
+
+	corrupt := func(i int) []byte {
+		bad := append([]byte(nil), data...)
+		bad[i] ^= 0xff
+		return bad
+	}
+	for name, bad := range map[string][]byte{
+		"empty":     nil,
+		"truncated": data[:len(data)-1],
+		"magic":     corrupt(0),
+		"version":   corrupt(2),
+		"payload":   corrupt(len(data) - 6),
+		"checksum":  corrupt(len(data) - 1),
+	} {
+		if err := engine.Restore("x", bad, RestoreOptions{}); !errors.Is(err, ErrDumpPayload) {
+			t.Errorf("%s: expected ErrDumpPayload, got %v", name, err)
+		}
+	}
+	if engine.Exists("x") {
+		t.Error("Expected nothing to be restored")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lofoneh/kvlite/internal/analytics"
@@ -14,22 +15,40 @@ import (
 	"github.com/lofoneh/kvlite/internal/wal"
 )
 
-// Engine coordinates the in-memory store, WAL, snapshots, TTL, and analytics for persistence
+// Engine coordinates the in-memory store, WAL, snapshots, TTL, and analytics for persistence.
+// An Engine operates on one logical database; DB returns the handle on
+// another one, which shares everything else.
 type Engine struct {
-	store            *store.Store
+	*core
+	db    int          // Number of the logical database
+	store *store.Store // Keyspace of the logical database
+	quota *quota       // Limits of the logical database, see quota.go
+}
+
+// core is the state shared by the handles on every logical database
+type core struct {
+	dbs              []*Engine // Handle on each logical database, by number
 	wal              *wal.WAL
 	snapshotWriter   *snapshot.Writer
 	ttlManager       *ttl.Manager
 	analytics        *analytics.Tracker
 	scheduler        *analytics.SmartScheduler
-	mu               sync.RWMutex // Protects compaction operations
+	mu               sync.RWMutex // Protects request rate tracking
+	compactMu        sync.Mutex   // Serializes compaction operations
 	compactionTicker *time.Ticker
 	stopCompaction   chan struct{}
 
 	// Compaction thresholds
 	maxWALEntries int64
 	maxWALSize    int64
-	walEntryCount int64 // Track number of entries
+	walEntryCount int64 // Track number of entries (accessed atomically)
+
+	expireNext uint32 // Database the next expiration check starts at (accessed atomically)
+
+	// Keyspace events, see events.go
+	events         eventHub
+	expired        []*wal.Record // Deletes of expired keys not logged yet, protected by the store lock
+	expiredPending int32         // Whether expired has records (accessed atomically)
 
 	// Analytics
 	enableAnalytics bool
@@ -45,7 +64,10 @@ type Options struct {
 	MaxWALSize         int64         // Trigger compaction after this size in bytes (default: 10MB)
 	CompactionInterval time.Duration // How often to check for compaction (default: 1 minute)
 	TTLCheckInterval   time.Duration // How often to check for expired keys (default: 1 second)
+	TTLCheckBudget     time.Duration // Longest time one expiration check may take (default: 25ms)
 	EnableAnalytics    bool          // Enable AI-powered analytics and smart scheduling
+	Databases          int           // Number of logical databases (default: 16)
+	Quotas             map[int]Quota // Limits of logical databases, by number
 }
 
 // New creates a new Engine and recovers from snapshot + WAL if they exist
@@ -63,6 +85,9 @@ func New(opts Options) (*Engine, error) {
 	if opts.TTLCheckInterval == 0 {
 		opts.TTLCheckInterval = 1 * time.Second
 	}
+	if opts.Databases <= 0 {
+		opts.Databases = DefaultDatabases
+	}
 
 	// Create store
 	st := store.New()
@@ -94,16 +119,9 @@ func New(opts Options) (*Engine, error) {
 		return nil, fmt.Errorf("failed to create snapshot writer: %w", err)
 	}
 
-	// Create TTL manager
-	ttlMgr := ttl.NewManager(st, ttl.Options{
-		CheckInterval: opts.TTLCheckInterval,
-	})
-
-	engine := &Engine{
-		store:           st,
+	c := &core{
 		wal:             w,
 		snapshotWriter:  sw,
-		ttlManager:      ttlMgr,
 		analytics:       analyticsTracker,
 		scheduler:       smartScheduler,
 		maxWALEntries:   opts.MaxWALEntries,
@@ -112,12 +130,39 @@ func New(opts Options) (*Engine, error) {
 		enableAnalytics: opts.EnableAnalytics,
 		lastRateCheck:   time.Now(),
 	}
+	c.dbs = make([]*Engine, opts.Databases)
+	for i := range c.dbs {
+		dbStore := st
+		if i > 0 {
+			dbStore = st.NewSibling()
+		}
+		c.dbs[i] = &Engine{core: c, db: i, store: dbStore, quota: &quota{}}
+	}
+	engine := c.dbs[0]
+	for n, limits := range opts.Quotas {
+		db, err := engine.DB(n)
+		if err == nil {
+			err = db.SetQuota(limits)
+		}
+		if err != nil {
+			w.Close()
+			return nil, fmt.Errorf("invalid quota for database %d: %w", n, err)
+		}
+	}
+
+	// Create TTL manager
+	ttlMgr := ttl.NewManager(c, ttl.Options{
+		CheckInterval: opts.TTLCheckInterval,
+		Budget:        opts.TTLCheckBudget,
+	})
+	c.ttlManager = ttlMgr
 
 	// Recover from snapshot and WAL
 	if err := engine.recover(opts.WALPath); err != nil {
 		w.Close()
 		return nil, fmt.Errorf("failed to recover: %w", err)
 	}
+	c.watchExpirations()
 
 	// Start background processes
 	engine.compactionTicker = time.NewTicker(opts.CompactionInterval)
@@ -143,6 +188,19 @@ func (e *Engine) recover(path string) error {
 		for key, value := range snap.Data {
 			e.store.Set(key, value)
 		}
+		if err := e.restoreEntries(snap.Entries); err != nil {
+			return err
+		}
+		for n, entries := range snap.Databases {
+			db, err := e.DB(n)
+			if err != nil {
+				return fmt.Errorf("failed to load database %d: %w", n, err)
+			}
+			if err := db.restoreEntries(entries); err != nil {
+				return err
+			}
+		}
+		e.store.SetLastVersion(snap.LastVersion)
 		log.Printf("Snapshot loaded: %d keys", snap.KeyCount)
 	} else {
 		log.Println("No snapshot found, starting fresh")
@@ -152,18 +210,70 @@ func (e *Engine) recover(path string) error {
 	log.Println("Replaying WAL...")
 	walCount := 0
 	err = e.wal.Replay(func(record *wal.Record) error {
+		db, err := e.DB(record.DB)
+		if err != nil {
+			return fmt.Errorf("failed to replay database %d: %w", record.DB, err)
+		}
 		switch record.Op {
 		case wal.OpSet:
-			e.store.Set(record.Key, record.Value)
+			entry, err := decodeEntry(record.Type, record.Value)
+			if err != nil {
+				return fmt.Errorf("failed to replay key %q: %w", record.Key, err)
+			}
+			entry.ExpiresAt = record.ExpiresAt
+			entry.Version = record.Version
+			db.store.Restore(record.Key, entry)
+		case wal.OpExpire:
+			db.store.RestoreExpiry(record.Key, record.ExpiresAt, record.Version)
+		case wal.OpHSet:
+			db.store.RestoreHashField(record.Key, record.Field, record.Value, record.Version)
+		case wal.OpHDel:
+			db.store.RestoreHashDelete(record.Key, record.Field, record.Version)
+		case wal.OpSAdd:
+			db.store.RestoreSetAdd(record.Key, record.Value, record.Version)
+		case wal.OpSRem:
+			db.store.RestoreSetRemove(record.Key, record.Value, record.Version)
+		case wal.OpZAdd, wal.OpZRem:
+			if err := db.replayZSet(record); err != nil {
+				return fmt.Errorf("failed to replay key %q: %w", record.Key, err)
+			}
+		case wal.OpLPush, wal.OpRPush, wal.OpLPop, wal.OpRPop, wal.OpLRem, wal.OpLTrim:
+			if err := db.replayList(record); err != nil {
+				return fmt.Errorf("failed to replay key %q: %w", record.Key, err)
+			}
+		case wal.OpXAdd, wal.OpXTrim, wal.OpXGroup, wal.OpXClaim, wal.OpXAck:
+			if err := db.replayStream(record); err != nil {
+				return fmt.Errorf("failed to replay key %q: %w", record.Key, err)
+			}
+		case wal.OpPFAdd:
+			db.replayHLL(record)
+		case wal.OpBFInit, wal.OpBFAdd:
+			if err := db.replayBloom(record); err != nil {
+				return fmt.Errorf("failed to replay key %q: %w", record.Key, err)
+			}
+		case wal.OpSetBit:
+			if err := db.replaySetBit(record); err != nil {
+				return fmt.Errorf("failed to replay key %q: %w", record.Key, err)
+			}
+		case wal.OpJSet, wal.OpJDel, wal.OpJApp:
+			if err := db.replayJSON(record); err != nil {
+				return fmt.Errorf("failed to replay key %q: %w", record.Key, err)
+			}
 		case wal.OpDelete:
-			e.store.Delete(record.Key)
+			db.store.Delete(record.Key)
+			db.store.SetLastVersion(record.Version)
 		case wal.OpClear:
-			e.store.Clear()
+			db.store.Clear()
+			db.store.SetLastVersion(record.Version)
+		case wal.OpSwapDB:
+			if err := db.replaySwapDB(record); err != nil {
+				return err
+			}
 		default:
 			return fmt.Errorf("unknown operation: %s", record.Op)
 		}
 		walCount++
-		e.walEntryCount++
+		atomic.AddInt64(&e.walEntryCount, 1)
 		return nil
 	})
 
@@ -172,33 +282,42 @@ func (e *Engine) recover(path string) error {
 	}
 
 	log.Printf("Recovery complete: %d keys in store, %d WAL entries replayed",
-		e.store.Len(), walCount)
+		e.totalLen(), walCount)
 	return nil
 }
 
-// Set stores a key-value pair and writes to WAL
-func (e *Engine) Set(key, value string) error {
-	// Record analytics
-	if e.enableAnalytics && e.analytics != nil {
-		e.analytics.RecordWrite(key)
-		e.trackRequestRate()
+// restoreEntries loads the entries of the database from a snapshot
+func (e *Engine) restoreEntries(entries map[string]snapshot.Entry) error {
+	for key, se := range entries {
+		entry, err := decodeEntry(se.Type, se.Value)
+		if err != nil {
+			return fmt.Errorf("failed to load key %q: %w", key, err)
+		}
+		entry.ExpiresAt = se.ExpiresAt
+		entry.Version = se.Version
+		e.store.Restore(key, entry)
 	}
+	return nil
+}
 
-	// Write to WAL first (durability)
-	record := wal.NewRecord(wal.OpSet, key, value)
-	if err := e.wal.Write(record); err != nil {
-		return fmt.Errorf("failed to write to WAL: %w", err)
+// decodeEntry rebuilds an entry from a payload written to the WAL or a
+// snapshot. An empty type name means a plain string.
+func decodeEntry(typeName, payload string) (*store.Entry, error) {
+	if typeName == "" {
+		return store.NewEntry(payload), nil
 	}
+	t, err := store.ParseValueType(typeName)
+	if err != nil {
+		return nil, err
+	}
+	return store.NewEntryFromPayload(t, payload)
+}
 
-	// Then update in-memory store
-	e.store.Set(key, value)
-
-	// Increment WAL entry count
-	e.mu.Lock()
-	e.walEntryCount++
-	e.mu.Unlock()
-
-	return nil
+// Set stores a key-value pair and writes to WAL
+func (e *Engine) Set(key, value string) error {
+	return e.Atomic(func(tx *Tx) error {
+		return tx.Set(key, value)
+	})
 }
 
 // Get retrieves a value by key
@@ -209,36 +328,43 @@ func (e *Engine) Get(key string) (string, bool) {
 		e.trackRequestRate()
 	}
 
-	return e.store.Get(key) // Store handles lazy expiration
+	value, ok := e.store.Get(key) // Store handles lazy expiration
+	if !ok {
+		e.flushExpired()
+	}
+	return value, ok
 }
 
 // SetWithTTL stores a key-value pair with TTL and writes to WAL
 func (e *Engine) SetWithTTL(key, value string, ttl time.Duration) error {
-	// Write to WAL first (durability)
-	record := wal.NewRecord(wal.OpSet, key, value)
-	if err := e.wal.Write(record); err != nil {
-		return fmt.Errorf("failed to write to WAL: %w", err)
-	}
-
-	// Then update in-memory store with TTL
-	e.store.SetWithTTL(key, value, ttl)
-
-	// Increment WAL entry count
-	e.mu.Lock()
-	e.walEntryCount++
-	e.mu.Unlock()
-
-	return nil
+	return e.Atomic(func(tx *Tx) error {
+		return tx.SetWithTTL(key, value, ttl)
+	})
 }
 
-// Expire sets TTL on an existing key
+// Expire sets TTL on an existing key and writes to WAL
 func (e *Engine) Expire(key string, ttl time.Duration) bool {
-	return e.store.Expire(key, ttl)
+	var ok bool
+	e.Atomic(func(tx *Tx) error {
+		ok = tx.Expire(key, ttl)
+		return nil
+	})
+	return ok
 }
 
-// Persist removes TTL from a key
+// Persist removes TTL from a key and writes to WAL
 func (e *Engine) Persist(key string) bool {
-	return e.store.Persist(key)
+	var ok bool
+	e.Atomic(func(tx *Tx) error {
+		ok = tx.Persist(key)
+		return nil
+	})
+	return ok
+}
+
+// Exists reports whether a key exists, whatever its type
+func (e *Engine) Exists(key string) bool {
+	return e.store.Version(key) != 0
 }
 
 // TTL returns the remaining time to live for a key
@@ -246,61 +372,56 @@ func (e *Engine) TTL(key string) time.Duration {
 	return e.store.TTL(key)
 }
 
+// Version returns the current version of a key, 0 if it doesn't exist
+// Every write to a key gives it a new version, which WATCH relies on
+func (e *Engine) Version(key string) uint64 {
+	return e.store.Version(key)
+}
+
+// Removals returns a counter bumped whenever keys of the database are
+// removed, which WATCH checks for keys that didn't exist
+func (e *Engine) Removals() uint64 {
+	return e.store.Removals()
+}
+
 // Keys returns all keys matching the pattern
 func (e *Engine) Keys(pattern string) []string {
 	return e.store.Keys(pattern)
 }
 
-// Scan returns keys with pagination
-func (e *Engine) Scan(cursor int, pattern string, count int) (int, []string, bool) {
-	return e.store.Scan(cursor, pattern, count)
+// Scan returns a page of the keys matching opts, in order, and the cursor
+// of the next page, "" once complete. Keys that exist for the whole scan
+// are returned exactly once.
+func (e *Engine) Scan(cursor string, opts ScanOptions) (string, []string) {
+	return e.store.Scan(cursor, opts)
+}
+
+// KeyRange returns the string keys between min and max with their values,
+// in lexicographical order. limit caps the number of pairs, 0 means no
+// limit.
+func (e *Engine) KeyRange(min, max LexBound, limit int) []KeyValue {
+	return e.store.KeyRange(min, max, limit)
 }
 
 // Delete removes a key-value pair and writes to WAL
 func (e *Engine) Delete(key string) (bool, error) {
-	// Check if key exists
-	_, exists := e.store.Get(key)
-	if !exists {
-		return false, nil
-	}
-
-	// Write to WAL first
-	record := wal.NewRecord(wal.OpDelete, key, "")
-	if err := e.wal.Write(record); err != nil {
-		return false, fmt.Errorf("failed to write to WAL: %w", err)
-	}
-
-	// Then delete from in-memory store
-	e.store.Delete(key)
-
-	// Increment WAL entry count
-	e.mu.Lock()
-	e.walEntryCount++
-	e.mu.Unlock()
-
-	return true, nil
+	var deleted bool
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		deleted, err = tx.Delete(key)
+		return err
+	})
+	return deleted, err
 }
 
-// Clear removes all keys and writes to WAL
+// Clear removes all keys of the database and writes to WAL
 func (e *Engine) Clear() error {
-	// Write to WAL first
-	record := wal.NewRecord(wal.OpClear, "", "")
-	if err := e.wal.Write(record); err != nil {
-		return fmt.Errorf("failed to write to WAL: %w", err)
-	}
-
-	// Then clear in-memory store
-	e.store.Clear()
-
-	// Increment WAL entry count
-	e.mu.Lock()
-	e.walEntryCount++
-	e.mu.Unlock()
-
-	return nil
+	return e.Atomic(func(tx *Tx) error {
+		return tx.Clear()
+	})
 }
 
-// Len returns the number of keys in the store
+// Len returns the number of keys in the database
 func (e *Engine) Len() int {
 	return e.store.Len()
 }
@@ -366,11 +487,9 @@ func (e *Engine) needsCompaction() bool {
 	enableAnalytics := e.enableAnalytics
 	scheduler := e.scheduler
 
-	e.mu.RLock()
-	walEntryCount := e.walEntryCount
+	walEntryCount := atomic.LoadInt64(&e.walEntryCount)
 	maxWALEntries := e.maxWALEntries
 	maxWALSize := e.maxWALSize
-	e.mu.RUnlock()
 
 	// Check hard limits first
 	if walEntryCount >= maxWALEntries {
@@ -400,36 +519,59 @@ func (e *Engine) Compact() error {
 	enableAnalytics := e.enableAnalytics
 	scheduler := e.scheduler
 
-	e.mu.Lock()
-	defer e.mu.Unlock()
+	e.compactMu.Lock()
+	defer e.compactMu.Unlock()
 
 	log.Println("Starting compaction...")
 	start := time.Now()
-	keyCount := e.store.Len()
+	keyCount := e.totalLen()
 	walSizeBefore, _ := e.wal.Size()
 
-	// Get current store state
-	data := make(map[string]string)
-	e.store.Range(func(key, value string) bool {
-		data[key] = value
-		return true
-	})
+	// Snapshot every database and truncate the WAL under the read lock
+	// shared by all databases. Every WAL write is made under the write lock,
+	// so no record can be logged after the snapshot and lost by truncating.
+	compacted := 0
+	err := e.store.View(func(txn *store.Txn) error {
+		lastVersion := txn.LastVersion()
+		dbs := make([]map[string]snapshot.Entry, len(e.dbs))
+		for i, db := range e.dbs {
+			data := make(map[string]snapshot.Entry)
+			txn.On(db.store).RangeWithTTL(func(key string, entry *store.Entry) bool {
+				se := snapshot.Entry{
+					Value:     entry.Payload(),
+					ExpiresAt: entry.ExpiresAt,
+					Version:   entry.Version,
+				}
+				if entry.Type != store.TypeString {
+					se.Type = entry.Type.String()
+				}
+				data[key] = se
+				return true
+			})
+			dbs[i] = data
+			compacted += len(data)
+		}
 
-	// Create snapshot (atomic write)
-	if err := e.snapshotWriter.Create(data); err != nil {
-		return fmt.Errorf("failed to create snapshot: %w", err)
-	}
+		// Create snapshot (atomic write)
+		if err := e.snapshotWriter.CreateDatabases(dbs, lastVersion); err != nil {
+			return fmt.Errorf("failed to create snapshot: %w", err)
+		}
 
-	// Truncate WAL (all data is now in snapshot)
-	if err := e.wal.Truncate(); err != nil {
-		return fmt.Errorf("failed to truncate WAL: %w", err)
-	}
+		// Truncate WAL (all data is now in snapshot)
+		if err := e.wal.Truncate(); err != nil {
+			return fmt.Errorf("failed to truncate WAL: %w", err)
+		}
 
-	// Reset entry count
-	e.walEntryCount = 0
+		// Reset entry count
+		atomic.StoreInt64(&e.walEntryCount, 0)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
 	elapsed := time.Since(start)
-	log.Printf("Compaction complete: %d keys compacted in %v", len(data), elapsed)
+	log.Printf("Compaction complete: %d keys compacted in %v", compacted, elapsed)
 
 	// Record compaction event for analytics
 	if enableAnalytics && scheduler != nil {
@@ -462,11 +604,9 @@ func (e *Engine) CompactionStats() map[string]interface{} {
 	analyticsTracker := e.analytics
 	scheduler := e.scheduler
 
-	e.mu.RLock()
-	walEntryCount := e.walEntryCount
+	walEntryCount := atomic.LoadInt64(&e.walEntryCount)
 	maxWALEntries := e.maxWALEntries
 	maxWALSize := e.maxWALSize
-	e.mu.RUnlock()
 
 	walSize, _ := e.wal.Size()
 	ttlStats := e.ttlManager.Stats()
@@ -480,6 +620,7 @@ func (e *Engine) CompactionStats() map[string]interface{} {
 		"ttl_total_expired": ttlStats.TotalExpired,
 		"ttl_last_check":    ttlStats.LastCheckTime,
 		"ttl_checks":        ttlStats.ChecksPerformed,
+		"ttl_backlog":       ttlStats.Backlog,
 	}
 
 	// Add analytics stats if enabled
@@ -2,6 +2,8 @@
 package engine
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 )
 
@@ -211,6 +213,137 @@ func TestEngine_MultipleCycles(t *testing.T) {
 	}
 }
 
+func TestEngine_CompactWhileWriting(t *testing.T) {
+	tmpDir := t.TempDir()
+	e1, err := New(Options{WALPath: tmpDir, Databases: 2})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	db1, _ := e1.DB(1)
+
+	// Writes to both databases race with compactions; none may be lost
+	var wg sync.WaitGroup
+	for _, e := range []*Engine{e1, db1} {
+		wg.Add(1)
+		go func(e *Engine) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				_ = e.Set(fmt.Sprintf("key%d", i), "v")
+			}
+		}(e)
+	}
+	for i := 0; i < 5; i++ {
+		if err := e1.Compact(); err != nil {
+			t.Errorf("Compact failed: %v", err)
+		}
+	}
+	wg.Wait()
+	e1.Close()
+
+	e2, err := New(Options{WALPath: tmpDir, Databases: 2})
+	if err != nil {
+		t.Fatalf("Failed to recover engine: %v", err)
+	}
+	defer e2.Close()
+	if sizes := e2.DBSizes(); sizes[0] != 200 || sizes[1] != 200 {
+		t.Errorf("Expected 200 keys in each database, got %v", sizes)
+	}
+}
+
+func TestEngine_KeyOrderAfterRecovery(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	e, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_ = e.Set("user:2", "b")
+	_ = e.Set("user:1", "a")
+	_ = e.Set("item:1", "x")
+	if err := e.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	_ = e.Set("user:3", "c")
+	_, _ = e.Delete("user:2")
+	_ = e.Set("user:0", "z")
+	e.Close()
+
+	e, err = New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer e.Close()
+
+	if got := e.Keys("user:*"); fmt.Sprint(got) != "[user:0 user:1 user:3]" {
+		t.Errorf("Expected recovered keys in order, got %v", got)
+	}
+	pairs := e.KeyRange(LexBound{Value: "user:1"}, LexBound{Inf: 1}, 0)
+	if fmt.Sprint(pairs) != "[{user:1 a} {user:3 c}]" {
+		t.Errorf("Expected recovered range in order, got %v", pairs)
+	}
+}
+
+func TestEngine_Atomic(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	_ = engine1.Set("from", "100")
+	err = engine1.Atomic(func(tx *Tx) error {
+		val, _ := tx.Get("from")
+		if _, err := tx.Delete("from"); err != nil {
+			return err
+		}
+		return tx.Set("to", val)
+	})
+	if err != nil {
+		t.Fatalf("Atomic failed: %v", err)
+	}
+
+	if _, ok := engine1.Get("from"); ok {
+		t.Error("from should be deleted")
+	}
+	if val, _ := engine1.Get("to"); val != "100" {
+		t.Errorf("Expected to=100, got %s", val)
+	}
+	engine1.Close()
+
+	// The batch is replayed on recovery
+	engine2, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if _, ok := engine2.Get("from"); ok {
+		t.Error("from should not exist after recovery")
+	}
+	if val, _ := engine2.Get("to"); val != "100" {
+		t.Errorf("Expected to=100 after recovery, got %s", val)
+	}
+}
+
+func TestEngine_Version(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if v := engine.Version("k"); v != 0 {
+		t.Errorf("Expected version 0 for missing key, got %d", v)
+	}
+	_ = engine.Set("k", "a")
+	v1 := engine.Version("k")
+	_ = engine.Set("k", "a")
+	if v2 := engine.Version("k"); v2 == v1 {
+		t.Error("Expected every write to change the version")
+	}
+}
+
 func BenchmarkEngine_Set(b *testing.B) {
 	tmpDir := b.TempDir()
 	engine, _ := New(Options{WALPath: tmpDir, SyncMode: false})
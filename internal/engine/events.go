@@ -0,0 +1,227 @@
+// internal/engine/events.go
+package engine
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lofoneh/kvlite/internal/store"
+	"github.com/lofoneh/kvlite/internal/wal"
+)
+
+// Every change to the keyspace goes through the WAL, so keyspace events
+// are derived from the records of each committed batch: a DELETE is a del,
+// or an expired when it carries wal.Expired, and any other write to a key
+// is a set. Expirations and the deletes they cause are logged like any
+// other write, so replaying the WAL removes the same keys in the same
+// order. Keys removed by the store when their expiration passes are queued
+// by the OnExpire hook and logged, under the store lock, ahead of the next
+// batch, or by the expiration check or read that removed them.
+
+// EventClass is a kind of keyspace event. Classes are bits, so they can be
+// combined to subscribe to several.
+type EventClass uint8
+
+const (
+	EventSet     EventClass = 1 << iota // A key was written
+	EventDel                            // A key was deleted
+	EventExpired                        // A key was removed because its expiration passed
+	EventEvicted                        // A key was removed to free memory; kvlite doesn't evict, so this is never published
+
+	AllEvents = EventSet | EventDel | EventExpired | EventEvicted
+)
+
+// eventClassNames are the names of the event classes, by bit
+var eventClassNames = []string{"set", "del", "expired", "evicted"}
+
+// String returns the names of the classes, separated by commas
+func (c EventClass) String() string {
+	var names []string
+	for i, name := range eventClassNames {
+		if c&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseEventClasses parses event class names separated by commas; "*"
+// selects all of them
+func ParseEventClasses(s string) (EventClass, error) {
+	var classes EventClass
+	for _, name := range strings.Split(strings.ToLower(s), ",") {
+		if name == "*" {
+			classes |= AllEvents
+			continue
+		}
+		found := false
+		for i, n := range eventClassNames {
+			if name == n {
+				classes |= 1 << i
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown event class '%s'", name)
+		}
+	}
+	return classes, nil
+}
+
+// KeyEvent is a change to a key
+type KeyEvent struct {
+	DB    int
+	Key   string
+	Class EventClass
+}
+
+// EventSubscription receives the keyspace events matching a pattern and
+// a set of classes on C. Events are never waited for: when C is full they
+// are dropped and counted.
+type EventSubscription struct {
+	C <-chan KeyEvent
+
+	c       chan KeyEvent
+	pattern string
+	classes EventClass
+	hub     *eventHub
+	dropped int64 // Accessed atomically
+}
+
+// Dropped returns the number of events dropped because C was full
+func (s *EventSubscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// Close stops the subscription and closes C
+func (s *EventSubscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	if _, ok := s.hub.subs[s]; ok {
+		delete(s.hub.subs, s)
+		atomic.AddInt32(&s.hub.n, -1)
+		close(s.c)
+	}
+}
+
+// eventHub delivers keyspace events to subscriptions
+type eventHub struct {
+	mu   sync.RWMutex
+	subs map[*EventSubscription]struct{}
+	n    int32 // Number of subscriptions, accessed atomically
+}
+
+// SubscribeEvents subscribes to the events of every database whose class
+// is in classes and whose key matches the glob pattern. buffer is the
+// capacity of the channel, at least 1.
+func (e *Engine) SubscribeEvents(pattern string, classes EventClass, buffer int) *EventSubscription {
+	if buffer < 1 {
+		buffer = 1
+	}
+	c := make(chan KeyEvent, buffer)
+	sub := &EventSubscription{C: c, c: c, pattern: pattern, classes: classes, hub: &e.events}
+
+	e.events.mu.Lock()
+	defer e.events.mu.Unlock()
+	if e.events.subs == nil {
+		e.events.subs = make(map[*EventSubscription]struct{})
+	}
+	e.events.subs[sub] = struct{}{}
+	atomic.AddInt32(&e.events.n, 1)
+	return sub
+}
+
+// publish delivers the events of a committed batch of records
+func (h *eventHub) publish(records []*wal.Record) {
+	if atomic.LoadInt32(&h.n) == 0 {
+		return
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, record := range records {
+		class := recordEventClass(record)
+		if class == 0 {
+			continue
+		}
+		event := KeyEvent{DB: record.DB, Key: record.Key, Class: class}
+		for sub := range h.subs {
+			if sub.classes&class == 0 || !store.MatchPattern(sub.pattern, record.Key) {
+				continue
+			}
+			select {
+			case sub.c <- event:
+			default:
+				atomic.AddInt64(&sub.dropped, 1)
+			}
+		}
+	}
+}
+
+// recordEventClass returns the class of the event a record causes, 0 for
+// records that don't change a single key
+func recordEventClass(record *wal.Record) EventClass {
+	switch record.Op {
+	case wal.OpDelete:
+		if record.Value == wal.Expired {
+			return EventExpired
+		}
+		return EventDel
+	case wal.OpClear, wal.OpSwapDB, wal.OpExpire, wal.OpBatch:
+		return 0
+	}
+	return EventSet
+}
+
+// watchExpirations makes every database queue the keys its store expires
+// to be logged. It is called once recovery is done, so replay logs nothing.
+func (c *core) watchExpirations() {
+	for _, db := range c.dbs {
+		db := db
+		db.store.OnExpire(func(key string) {
+			var opts []wal.RecordOption
+			if db.db != 0 {
+				opts = append(opts, wal.WithDB(db.db))
+			}
+			c.expired = append(c.expired, wal.NewRecord(wal.OpDelete, key, wal.Expired, opts...))
+			atomic.StoreInt32(&c.expiredPending, 1)
+		})
+	}
+}
+
+// commit logs a batch of records, after the deletes of the keys that
+// expired before it, and publishes their events. It returns the number of
+// records logged.
+// Caller must hold the store lock
+func (c *core) commit(records []*wal.Record) (int, error) {
+	if len(c.expired) > 0 {
+		records = append(c.expired, records...)
+		c.expired = nil
+		atomic.StoreInt32(&c.expiredPending, 0)
+	}
+	if err := c.wal.WriteBatch(records); err != nil {
+		return 0, err
+	}
+	c.events.publish(records)
+	return len(records), nil
+}
+
+// flushExpired logs the deletes of the keys expired outside of a
+// transaction, by the expiration check or a plain read
+func (c *core) flushExpired() {
+	if atomic.LoadInt32(&c.expiredPending) == 0 {
+		return
+	}
+	var logged int
+	err := c.dbs[0].store.Update(func(*store.Txn) error {
+		var err error
+		logged, err = c.commit(nil)
+		return err
+	})
+	atomic.AddInt64(&c.walEntryCount, int64(logged))
+	if err != nil {
+		log.Printf("Failed to log expired keys: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+// internal/engine/events_test.go
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lofoneh/kvlite/internal/wal"
+)
+
+func TestEngine_ExpirationsLogged(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := New(Options{WALPath: dir, TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	db1, _ := engine.DB(1)
+	_ = engine.SetWithTTL("lazy", "v", time.Millisecond)
+	_ = engine.SetWithTTL("overwritten", "v", time.Millisecond)
+	_ = db1.SetWithTTL("active", "v", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := engine.Get("lazy"); ok {
+		t.Fatal("Expected lazy to have expired")
+	}
+	_ = engine.Set("overwritten", "new")
+	if deleted, _ := engine.DeleteExpired(time.Time{}); deleted != 1 {
+		t.Fatalf("Expected 1 key removed by the check, got %d", deleted)
+	}
+
+	// Each expiration is a delete, logged before what followed it
+	var ops []string
+	engine.wal.Replay(func(record *wal.Record) error {
+		ops = append(ops, string(record.Op)+" "+record.Key+" "+record.Value)
+		if record.Op == wal.OpDelete && record.Key == "active" && record.DB != 1 {
+			t.Errorf("Expected the delete of active in database 1, got %d", record.DB)
+		}
+		return nil
+	})
+	want := []string{"DELETE lazy expired", "DELETE overwritten expired", "SET overwritten new", "DELETE active expired"}
+	if len(ops) < len(want) {
+		t.Fatalf("Expected %v at the end of the WAL, got %v", want, ops)
+	}
+	for i, op := range ops[len(ops)-len(want):] {
+		if op != want[i] {
+			t.Errorf("Expected record %q, got %q", want[i], op)
+		}
+	}
+	engine.Close()
+
+	// Replay removes the same keys
+	engine, err = New(Options{WALPath: dir})
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer engine.Close()
+	db1, _ = engine.DB(1)
+	if sizes := engine.DBSizes(); sizes[0] != 1 || sizes[1] != 0 {
+		t.Errorf("Expected only overwritten left, got sizes %v", sizes[:2])
+	}
+	if v, _ := engine.Get("overwritten"); v != "new" {
+		t.Errorf("Expected overwritten to be new, got %q", v)
+	}
+}
+
+func TestEngine_SubscribeEvents(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir(), TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	all := engine.SubscribeEvents("*", AllEvents, 16)
+	defer all.Close()
+	users := engine.SubscribeEvents("user:*", EventDel|EventExpired, 16)
+	defer users.Close()
+
+	db1, _ := engine.DB(1)
+	_ = engine.Set("user:1", "a")
+	_ = db1.SetWithTTL("user:2", "b", time.Millisecond)
+	_, _ = engine.Delete("user:1")
+	_, _ = engine.Delete("other")
+	time.Sleep(5 * time.Millisecond)
+	engine.DeleteExpired(time.Time{})
+
+	expect := func(sub *EventSubscription, want []KeyEvent) {
+		t.Helper()
+		for _, w := range want {
+			select {
+			case got := <-sub.C:
+				if got != w {
+					t.Errorf("Expected %+v, got %+v", w, got)
+				}
+			default:
+				t.Fatalf("Expected %+v, got nothing", w)
+			}
+		}
+		select {
+		case got := <-sub.C:
+			t.Errorf("Expected no more events, got %+v", got)
+		default:
+		}
+	}
+	expect(all, []KeyEvent{
+		{0, "user:1", EventSet},
+		{1, "user:2", EventSet},
+		{0, "user:1", EventDel},
+		{1, "user:2", EventExpired},
+	})
+	expect(users, []KeyEvent{
+		{0, "user:1", EventDel},
+		{1, "user:2", EventExpired},
+	})
+
+	// A full subscription drops events instead of blocking writes
+	small := engine.SubscribeEvents("*", EventSet, 1)
+	_ = engine.Set("a", "1")
+	_ = engine.Set("b", "2")
+	if n := small.Dropped(); n != 1 {
+		t.Errorf("Expected 1 dropped event, got %d", n)
+	}
+	small.Close()
+	if _, ok := <-small.C; !ok {
+		t.Error("Expected the buffered event before the channel closed")
+	}
+	if _, ok := <-small.C; ok {
+		t.Error("Expected C to be closed")
+	}
+	small.Close()
+}
+
+func TestParseEventClasses(t *testing.T) {
+	classes, err := ParseEventClasses("set,EXPIRED")
+	if err != nil || classes != EventSet|EventExpired {
+		t.Errorf("Expected set and expired, got %v, %v", classes, err)
+	}
+	if classes.String() != "set,expired" {
+		t.Errorf("Expected set,expired, got %q", classes.String())
+	}
+	if classes, _ := ParseEventClasses("*"); classes != AllEvents {
+		t.Errorf("Expected all classes, got %v", classes)
+	}
+	if _, err := ParseEventClasses("set,bogus"); err == nil {
+		t.Error("Expected an error for an unknown class")
+	}
+}
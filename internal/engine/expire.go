@@ -0,0 +1,88 @@
+// internal/engine/expire.go
+package engine
+
+import (
+	"time"
+)
+
+// ExpireCondition controls whether ExpireAt changes the expiration of a
+// key. A key without expiration counts as expiring never, so GT never
+// applies to it and LT always does.
+type ExpireCondition int
+
+const (
+	ExpireAlways    ExpireCondition = iota // Always set the expiration
+	ExpireIfNone                           // Only if the key has no expiration (NX)
+	ExpireIfSet                            // Only if the key has an expiration (XX)
+	ExpireIfGreater                        // Only if later than the current one (GT)
+	ExpireIfLess                           // Only if earlier than the current one (LT)
+)
+
+// ExpireAt sets the expiration of an existing key to an absolute time if
+// cond holds. A time that has already passed deletes the key. It returns
+// whether the key was changed.
+func (e *Engine) ExpireAt(key string, at time.Time, cond ExpireCondition) (bool, error) {
+	var ok bool
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		ok, err = tx.ExpireAt(key, at, cond)
+		return err
+	})
+	return ok, err
+}
+
+// ExpireTime returns the absolute expiration of a key, the zero time if it
+// has none. It returns false if the key doesn't exist.
+func (e *Engine) ExpireTime(key string) (time.Time, bool) {
+	return expireTime(e.store.ExpiresAt(key))
+}
+
+// ExpireAt sets the expiration of an existing key to an absolute time if
+// cond holds
+func (tx *Tx) ExpireAt(key string, at time.Time, cond ExpireCondition) (bool, error) {
+	entry, ok := tx.txn.GetEntry(key)
+	if !ok {
+		return false, nil
+	}
+
+	expiresAt, current := at.UnixNano(), entry.ExpiresAt
+	switch cond {
+	case ExpireIfNone:
+		ok = current == 0
+	case ExpireIfSet:
+		ok = current != 0
+	case ExpireIfGreater:
+		ok = current != 0 && expiresAt > current
+	case ExpireIfLess:
+		ok = current == 0 || expiresAt < current
+	}
+	if !ok {
+		return false, nil
+	}
+
+	if expiresAt <= time.Now().UnixNano() {
+		return tx.Delete(key)
+	}
+	tx.txn.ExpireAt(key, expiresAt)
+	tx.logExpiry(key)
+	return true, nil
+}
+
+// ExpireTime returns the absolute expiration of a key, the zero time if it
+// has none
+func (tx *Tx) ExpireTime(key string) (time.Time, bool) {
+	entry, ok := tx.txn.GetEntry(key)
+	if !ok {
+		return time.Time{}, false
+	}
+	return expireTime(entry.ExpiresAt, true)
+}
+
+// expireTime converts an expiration in Unix nanoseconds to a time, the
+// zero time for none
+func expireTime(expiresAt int64, ok bool) (time.Time, bool) {
+	if !ok || expiresAt == 0 {
+		return time.Time{}, ok
+	}
+	return time.Unix(0, expiresAt), true
+}
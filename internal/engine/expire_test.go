@@ -0,0 +1,123 @@
+// internal/engine/expire_test.go
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestEngine_ExpireAt(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	now := time.Now()
+	_ = engine.Set("k", "v")
+	if ok, _ := engine.ExpireAt("missing", now.Add(time.Hour), ExpireAlways); ok {
+		t.Error("Expected ExpireAt on a missing key to fail")
+	}
+	if at, ok := engine.ExpireTime("k"); !ok || !at.IsZero() {
+		t.Errorf("Expected no expiration, got %v, %v", at, ok)
+	}
+
+	// Conditions on a key without expiration
+	if ok, _ := engine.ExpireAt("k", now.Add(time.Hour), ExpireIfSet); ok {
+		t.Error("XX applied to a key without expiration")
+	}
+	if ok, _ := engine.ExpireAt("k", now.Add(time.Hour), ExpireIfGreater); ok {
+		t.Error("GT applied to a key without expiration")
+	}
+	if ok, _ := engine.ExpireAt("k", now.Add(time.Hour), ExpireIfNone); !ok {
+		t.Error("NX didn't apply to a key without expiration")
+	}
+
+	// Conditions on a key with an expiration
+	if ok, _ := engine.ExpireAt("k", now.Add(2*time.Hour), ExpireIfNone); ok {
+		t.Error("NX applied to a key with an expiration")
+	}
+	if ok, _ := engine.ExpireAt("k", now.Add(30*time.Minute), ExpireIfGreater); ok {
+		t.Error("GT applied to an earlier time")
+	}
+	if ok, _ := engine.ExpireAt("k", now.Add(2*time.Hour), ExpireIfGreater); !ok {
+		t.Error("GT didn't apply to a later time")
+	}
+	if ok, _ := engine.ExpireAt("k", now.Add(3*time.Hour), ExpireIfLess); ok {
+		t.Error("LT applied to a later time")
+	}
+	at := now.Add(90 * time.Minute)
+	if ok, _ := engine.ExpireAt("k", at, ExpireIfLess); !ok {
+		t.Error("LT didn't apply to an earlier time")
+	}
+	if got, _ := engine.ExpireTime("k"); !got.Equal(time.Unix(0, at.UnixNano())) {
+		t.Errorf("Expected expiration %v, got %v", at, got)
+	}
+
+	// A time in the past deletes the key
+	if ok, _ := engine.ExpireAt("k", now.Add(-time.Second), ExpireAlways); !ok {
+		t.Error("Expected ExpireAt in the past to report the key")
+	}
+	if engine.Exists("k") {
+		t.Error("Expected ExpireAt in the past to delete the key")
+	}
+}
+
+func TestEngine_ExpireAtRecovery(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	at := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	_ = engine1.Set("k", "v")
+	_, _ = engine1.ExpireAt("k", at, ExpireAlways)
+	_ = engine1.Set("gone", "v")
+	_, _ = engine1.ExpireAt("gone", time.Unix(1, 0), ExpireAlways)
+	engine1.Close()
+
+	// The absolute time is replayed, not a TTL relative to the restart
+	engine2, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer engine2.Close()
+	if got, ok := engine2.ExpireTime("k"); !ok || !got.Equal(at) {
+		t.Errorf("Expected expiration %v after recovery, got %v", at, got)
+	}
+	if engine2.Exists("gone") {
+		t.Error("Expected the expired key to stay deleted")
+	}
+}
+
+func TestEngine_DeleteExpired(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir(), Databases: 3, TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for n := 0; n < 3; n++ {
+		db, _ := engine.DB(n)
+		for i := 0; i < 100; i++ {
+			_ = db.SetWithTTL(fmt.Sprintf("short%d", i), "v", time.Millisecond)
+			_ = db.Set(fmt.Sprintf("persistent%d", i), "v")
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// A passed deadline leaves most of the keys for later
+	deleted, backlog := engine.DeleteExpired(time.Now().Add(-time.Second))
+	if deleted == 0 || deleted+backlog != 300 {
+		t.Errorf("Expected some keys deleted and the rest left, got %d and %d", deleted, backlog)
+	}
+	deleted2, backlog := engine.DeleteExpired(time.Time{})
+	if deleted+deleted2 != 300 || backlog != 0 {
+		t.Errorf("Expected every expired key deleted, got %d and %d left", deleted+deleted2, backlog)
+	}
+	if sizes := engine.DBSizes(); sizes[0] != 100 || sizes[1] != 100 || sizes[2] != 100 {
+		t.Errorf("Expected the persistent keys to stay, got %v", sizes)
+	}
+}
@@ -0,0 +1,231 @@
+// internal/engine/geo.go
+package engine
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/lofoneh/kvlite/internal/store"
+)
+
+// GeoPoint is a member of a geo set with its position and, in search
+// results, its distance in meters from the center
+type GeoPoint = store.GeoPoint
+
+// Orders of GeoSearch results
+const (
+	GeoUnsorted = iota // Cell order, or nearest first with a count
+	GeoAsc             // Nearest first
+	GeoDesc            // Farthest first
+)
+
+var (
+	// ErrGeoCoords is returned for a position outside the supported range
+	ErrGeoCoords = errors.New("invalid longitude,latitude pair")
+	// ErrGeoMember is returned when searching around a member that doesn't
+	// exist
+	ErrGeoMember = errors.New("could not decode requested zset member")
+	// ErrGeoOptions is returned for GEOADD options that don't apply
+	ErrGeoOptions = errors.New("GT and LT options are not supported by GEOADD")
+)
+
+// GeoQuery describes a GeoSearch. The center is the position of
+// FromMember if set, Lon and Lat otherwise. Lengths are in meters.
+type GeoQuery struct {
+	FromMember    string
+	Lon, Lat      float64
+	Radius        float64 // Search a circle if positive
+	Width, Height float64 // Search a box otherwise
+	Order         int     // GeoUnsorted, GeoAsc or GeoDesc
+	Count         int     // Return at most Count results, 0 means no limit
+}
+
+// Geo sets are sorted sets scored by the geohash of each member's
+// position, so they are logged and persisted as sorted sets and the
+// sorted set commands work on them.
+
+// GeoAdd sets the positions of members of the geo set stored at key,
+// creating it if needed. Options work as for ZAdd, except GT and LT.
+func (e *Engine) GeoAdd(key string, points []GeoPoint, opts ZAddOptions) (int, error) {
+	var n int
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		n, err = tx.GeoAdd(key, points, opts)
+		return err
+	})
+	return n, err
+}
+
+// GeoPos returns the positions of members of the geo set stored at key.
+// Missing members are left out of the result.
+func (e *Engine) GeoPos(key string, members ...string) (map[string]GeoPoint, error) {
+	var points map[string]GeoPoint
+	err := e.View(func(tx *Tx) error {
+		var err error
+		points, err = tx.GeoPos(key, members...)
+		return err
+	})
+	return points, err
+}
+
+// GeoDist returns the distance in meters between two members of the geo
+// set stored at key. ok is false if either is missing.
+func (e *Engine) GeoDist(key, member1, member2 string) (float64, bool, error) {
+	var dist float64
+	var ok bool
+	err := e.View(func(tx *Tx) error {
+		var err error
+		dist, ok, err = tx.GeoDist(key, member1, member2)
+		return err
+	})
+	return dist, ok, err
+}
+
+// GeoHash returns the standard geohashes of members of the geo set stored
+// at key. Missing members are left out of the result.
+func (e *Engine) GeoHash(key string, members ...string) (map[string]string, error) {
+	var hashes map[string]string
+	err := e.View(func(tx *Tx) error {
+		var err error
+		hashes, err = tx.GeoHash(key, members...)
+		return err
+	})
+	return hashes, err
+}
+
+// GeoSearch returns the members of the geo set stored at key within the
+// circle or box described by q
+func (e *Engine) GeoSearch(key string, q GeoQuery) ([]GeoPoint, error) {
+	var points []GeoPoint
+	err := e.View(func(tx *Tx) error {
+		var err error
+		points, err = tx.GeoSearch(key, q)
+		return err
+	})
+	return points, err
+}
+
+// GeoAdd sets the positions of members of the geo set stored at key,
+// logged as ZADD records
+func (tx *Tx) GeoAdd(key string, points []GeoPoint, opts ZAddOptions) (int, error) {
+	if opts.GT || opts.LT {
+		return 0, ErrGeoOptions
+	}
+	members := make([]ZMember, len(points))
+	for i, p := range points {
+		if !store.ValidGeoCoords(p.Lon, p.Lat) {
+			return 0, ErrGeoCoords
+		}
+		members[i] = ZMember{Member: p.Member, Score: store.GeoScore(p.Lon, p.Lat)}
+	}
+	return tx.ZAdd(key, members, opts)
+}
+
+// GeoPos returns the positions of members of the geo set stored at key
+func (tx *Tx) GeoPos(key string, members ...string) (map[string]GeoPoint, error) {
+	z, err := tx.zsetForRead(key)
+	if err != nil {
+		return nil, err
+	}
+	points := make(map[string]GeoPoint, len(members))
+	for _, m := range members {
+		if p, ok := geoPoint(z, m); ok {
+			points[m] = p
+		}
+	}
+	return points, nil
+}
+
+// GeoDist returns the distance in meters between two members of the geo
+// set stored at key
+func (tx *Tx) GeoDist(key, member1, member2 string) (float64, bool, error) {
+	z, err := tx.zsetForRead(key)
+	if err != nil {
+		return 0, false, err
+	}
+	p1, ok1 := geoPoint(z, member1)
+	p2, ok2 := geoPoint(z, member2)
+	if !ok1 || !ok2 {
+		return 0, false, nil
+	}
+	return store.GeoDistance(p1.Lon, p1.Lat, p2.Lon, p2.Lat), true, nil
+}
+
+// GeoHash returns the standard geohashes of members of the geo set stored
+// at key
+func (tx *Tx) GeoHash(key string, members ...string) (map[string]string, error) {
+	z, err := tx.zsetForRead(key)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string, len(members))
+	if z == nil {
+		return hashes, nil
+	}
+	for _, m := range members {
+		if score, ok := z.Score(m); ok {
+			hashes[m] = store.GeoHashString(score)
+		}
+	}
+	return hashes, nil
+}
+
+// GeoSearch returns the members of the geo set stored at key within the
+// circle or box described by q
+func (tx *Tx) GeoSearch(key string, q GeoQuery) ([]GeoPoint, error) {
+	z, err := tx.zsetForRead(key)
+	if err != nil {
+		return nil, err
+	}
+	shape := store.GeoShape{Lon: q.Lon, Lat: q.Lat, Radius: q.Radius, Width: q.Width, Height: q.Height}
+	if q.FromMember != "" {
+		p, ok := geoPoint(z, q.FromMember)
+		if !ok {
+			return nil, ErrGeoMember
+		}
+		shape.Lon, shape.Lat = p.Lon, p.Lat
+	} else if !store.ValidGeoCoords(q.Lon, q.Lat) {
+		return nil, ErrGeoCoords
+	}
+	if z == nil {
+		return []GeoPoint{}, nil
+	}
+
+	points := store.GeoSearch(z, shape)
+	order := q.Order
+	if order == GeoUnsorted && q.Count > 0 {
+		order = GeoAsc
+	}
+	if order != GeoUnsorted {
+		sort.Slice(points, func(i, j int) bool {
+			a, b := points[i], points[j]
+			if order == GeoDesc {
+				a, b = b, a
+			}
+			if a.Dist != b.Dist {
+				return a.Dist < b.Dist
+			}
+			return a.Member < b.Member
+		})
+	}
+	if q.Count > 0 && len(points) > q.Count {
+		points = points[:q.Count]
+	}
+	if points == nil {
+		points = []GeoPoint{}
+	}
+	return points, nil
+}
+
+// geoPoint returns the position of a member of a geo set, which may be nil
+func geoPoint(z *store.ZSet, member string) (GeoPoint, bool) {
+	if z == nil {
+		return GeoPoint{}, false
+	}
+	score, ok := z.Score(member)
+	if !ok {
+		return GeoPoint{}, false
+	}
+	lon, lat := store.GeoDecode(score)
+	return GeoPoint{Member: member, Lon: lon, Lat: lat}, true
+}
@@ -0,0 +1,153 @@
+// internal/engine/geo_test.go
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func sicily() []GeoPoint {
+	return []GeoPoint{
+		{Member: "palermo", Lon: 13.361389, Lat: 38.115556},
+		{Member: "catania", Lon: 15.087269, Lat: 37.502669},
+	}
+}
+
+func TestEngine_Geo(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if n, err := engine.GeoAdd("sicily", sicily(), ZAddOptions{}); n != 2 || err != nil {
+		t.Fatalf("GeoAdd: %d, %v", n, err)
+	}
+	moved := []GeoPoint{{Member: "palermo", Lon: 13.5, Lat: 38}}
+	if n, _ := engine.GeoAdd("sicily", moved, ZAddOptions{NX: true, CH: true}); n != 0 {
+		t.Errorf("Expected NX not to move palermo, got %d", n)
+	}
+	if _, err := engine.GeoAdd("sicily", moved, ZAddOptions{GT: true}); !errors.Is(err, ErrGeoOptions) {
+		t.Errorf("Expected ErrGeoOptions, got %v", err)
+	}
+	bad := []GeoPoint{{Member: "north", Lon: 0, Lat: 89}}
+	if _, err := engine.GeoAdd("sicily", bad, ZAddOptions{}); !errors.Is(err, ErrGeoCoords) {
+		t.Errorf("Expected ErrGeoCoords, got %v", err)
+	}
+
+	points, err := engine.GeoPos("sicily", "palermo", "missing")
+	if err != nil || len(points) != 1 {
+		t.Fatalf("GeoPos: %v, %v", points, err)
+	}
+	if p := points["palermo"]; math.Abs(p.Lon-13.361389) > 1e-5 || math.Abs(p.Lat-38.115556) > 1e-5 {
+		t.Errorf("Unexpected position %+v", p)
+	}
+
+	if d, ok, _ := engine.GeoDist("sicily", "palermo", "catania"); !ok || math.Abs(d-166274.15) > 1 {
+		t.Errorf("Expected about 166274 m, got %f (%v)", d, ok)
+	}
+	if _, ok, _ := engine.GeoDist("sicily", "palermo", "missing"); ok {
+		t.Error("Expected no distance to a missing member")
+	}
+
+	hashes, _ := engine.GeoHash("sicily", "palermo", "catania", "missing")
+	if hashes["palermo"] != "sqc8b49rny0" || hashes["catania"] != "sqdtr74hyu0" || len(hashes) != 2 {
+		t.Errorf("Unexpected geohashes %v", hashes)
+	}
+
+	// Geo sets are sorted sets
+	if n, _ := engine.ZCard("sicily"); n != 2 {
+		t.Errorf("Expected 2 members, got %d", n)
+	}
+	engine.Set("str", "x")
+	if _, err := engine.GeoPos("str", "a"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestEngine_GeoSearch(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_, _ = engine.GeoAdd("sicily", sicily(), ZAddOptions{})
+
+	members := func(points []GeoPoint) []string {
+		names := make([]string, len(points))
+		for i, p := range points {
+			names[i] = p.Member
+		}
+		return names
+	}
+
+	tests := []struct {
+		q    GeoQuery
+		want string
+	}{
+		{GeoQuery{Lon: 15, Lat: 37, Radius: 200000, Order: GeoAsc}, "[catania palermo]"},
+		{GeoQuery{Lon: 15, Lat: 37, Radius: 200000, Order: GeoDesc}, "[palermo catania]"},
+		{GeoQuery{Lon: 15, Lat: 37, Radius: 100000}, "[catania]"},
+		{GeoQuery{Lon: 15, Lat: 37, Radius: 200000, Count: 1}, "[catania]"},
+		{GeoQuery{Lon: 15, Lat: 37, Width: 400000, Height: 400000, Order: GeoAsc}, "[catania palermo]"},
+		{GeoQuery{FromMember: "palermo", Radius: 100000}, "[palermo]"},
+		{GeoQuery{Lon: 0, Lat: 0, Radius: 1000}, "[]"},
+	}
+	for _, tt := range tests {
+		points, err := engine.GeoSearch("sicily", tt.q)
+		if err != nil {
+			t.Errorf("%+v: %v", tt.q, err)
+			continue
+		}
+		if got := fmt.Sprint(members(points)); got != tt.want {
+			t.Errorf("%+v: expected %s, got %s", tt.q, tt.want, got)
+		}
+	}
+
+	points, _ := engine.GeoSearch("sicily", GeoQuery{Lon: 15, Lat: 37, Radius: 200000, Order: GeoAsc})
+	if math.Abs(points[0].Dist-56441.3) > 1 || math.Abs(points[1].Dist-190442.4) > 1 {
+		t.Errorf("Unexpected distances %+v", points)
+	}
+
+	if _, err := engine.GeoSearch("sicily", GeoQuery{FromMember: "missing", Radius: 1}); !errors.Is(err, ErrGeoMember) {
+		t.Errorf("Expected ErrGeoMember, got %v", err)
+	}
+	if _, err := engine.GeoSearch("sicily", GeoQuery{Lon: 200, Radius: 1}); !errors.Is(err, ErrGeoCoords) {
+		t.Errorf("Expected ErrGeoCoords, got %v", err)
+	}
+	if points, err := engine.GeoSearch("missing", GeoQuery{Radius: 1}); len(points) != 0 || err != nil {
+		t.Errorf("Expected no results for a missing key, got %v, %v", points, err)
+	}
+}
+
+func TestEngine_Geo_Recovery(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_, _ = engine1.GeoAdd("sicily", sicily()[:1], ZAddOptions{})
+	if err := engine1.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	_, _ = engine1.GeoAdd("sicily", sicily()[1:], ZAddOptions{})
+	version := engine1.Version("sicily")
+	engine1.Close()
+
+	engine2, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if v := engine2.Version("sicily"); v != version {
+		t.Errorf("Expected version %d after recovery, got %d", version, v)
+	}
+	if d, ok, _ := engine2.GeoDist("sicily", "palermo", "catania"); !ok || math.Abs(d-166274.15) > 1 {
+		t.Errorf("Expected both members to survive recovery, got %f (%v)", d, ok)
+	}
+}
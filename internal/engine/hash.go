@@ -0,0 +1,305 @@
+// internal/engine/hash.go
+package engine
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/lofoneh/kvlite/internal/store"
+	"github.com/lofoneh/kvlite/internal/wal"
+)
+
+// HSet sets fields in the hash stored at key, creating it if needed.
+// Returns the number of fields that were added (not updated).
+func (e *Engine) HSet(key string, fields map[string]string) (int, error) {
+	var added int
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		added, err = tx.HSet(key, fields)
+		return err
+	})
+	return added, err
+}
+
+// HGet returns a field of the hash stored at key
+func (e *Engine) HGet(key, field string) (string, bool, error) {
+	var val string
+	var ok bool
+	err := e.View(func(tx *Tx) error {
+		var err error
+		val, ok, err = tx.HGet(key, field)
+		return err
+	})
+	return val, ok, err
+}
+
+// HMGet returns the requested fields of the hash stored at key. Missing
+// fields are left out of the result.
+func (e *Engine) HMGet(key string, fields []string) (map[string]string, error) {
+	var values map[string]string
+	err := e.View(func(tx *Tx) error {
+		var err error
+		values, err = tx.HMGet(key, fields)
+		return err
+	})
+	return values, err
+}
+
+// HGetAll returns all fields of the hash stored at key
+func (e *Engine) HGetAll(key string) (map[string]string, error) {
+	var values map[string]string
+	err := e.View(func(tx *Tx) error {
+		var err error
+		values, err = tx.HGetAll(key)
+		return err
+	})
+	return values, err
+}
+
+// HDel removes fields from the hash stored at key and returns how many
+// existed. The key is removed together with its last field.
+func (e *Engine) HDel(key string, fields ...string) (int, error) {
+	var deleted int
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		deleted, err = tx.HDel(key, fields...)
+		return err
+	})
+	return deleted, err
+}
+
+// HExists reports whether a field exists in the hash stored at key
+func (e *Engine) HExists(key, field string) (bool, error) {
+	_, ok, err := e.HGet(key, field)
+	return ok, err
+}
+
+// HLen returns the number of fields in the hash stored at key
+func (e *Engine) HLen(key string) (int, error) {
+	var n int
+	err := e.View(func(tx *Tx) error {
+		var err error
+		n, err = tx.HLen(key)
+		return err
+	})
+	return n, err
+}
+
+// HKeys returns the field names of the hash stored at key, sorted
+func (e *Engine) HKeys(key string) ([]string, error) {
+	var fields []string
+	err := e.View(func(tx *Tx) error {
+		var err error
+		fields, err = tx.HKeys(key)
+		return err
+	})
+	return fields, err
+}
+
+// HVals returns the values of the hash stored at key, in field order
+func (e *Engine) HVals(key string) ([]string, error) {
+	var values []string
+	err := e.View(func(tx *Tx) error {
+		var err error
+		values, err = tx.HVals(key)
+		return err
+	})
+	return values, err
+}
+
+// HIncrBy adds delta to the integer stored in a hash field and returns the
+// new value. A missing field counts as 0.
+func (e *Engine) HIncrBy(key, field string, delta int64) (int64, error) {
+	var n int64
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		n, err = tx.HIncrBy(key, field, delta)
+		return err
+	})
+	return n, err
+}
+
+// HScan returns fields of the hash stored at key with pagination, as
+// alternating field and value. The next cursor is 0 when the scan is done.
+func (e *Engine) HScan(key string, cursor int, pattern string, count int) (int, []string, error) {
+	var next int
+	var pairs []string
+	err := e.View(func(tx *Tx) error {
+		var err error
+		next, pairs, err = tx.HScan(key, cursor, pattern, count)
+		return err
+	})
+	return next, pairs, err
+}
+
+// hset sets one hash field and logs it as a field-level record
+func (tx *Tx) hset(key, field, value string) (bool, error) {
+	added, err := tx.txn.HSet(key, field, value)
+	if err != nil {
+		return false, err
+	}
+	tx.log(wal.OpHSet, key, value, wal.WithField(field), wal.WithVersion(tx.txn.Version(key)))
+	return added, nil
+}
+
+// HSet sets fields in the hash stored at key
+func (tx *Tx) HSet(key string, fields map[string]string) (int, error) {
+	var size int64
+	for field, value := range fields {
+		size += store.ElementSize(field, value)
+	}
+	if err := tx.reserve(key, size); err != nil {
+		return 0, err
+	}
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(key)
+		tx.e.trackRequestRate()
+	}
+
+	added := 0
+	for field, value := range fields {
+		ok, err := tx.hset(key, field, value)
+		if err != nil {
+			return added, err
+		}
+		if ok {
+			added++
+		}
+	}
+	return added, nil
+}
+
+// HGet returns a field of the hash stored at key
+func (tx *Tx) HGet(key, field string) (string, bool, error) {
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordRead(key)
+		tx.e.trackRequestRate()
+	}
+	return tx.txn.HGet(key, field)
+}
+
+// HMGet returns the requested fields of the hash stored at key
+func (tx *Tx) HMGet(key string, fields []string) (map[string]string, error) {
+	all, err := tx.HGetAll(key)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			values[field] = value
+		}
+	}
+	return values, nil
+}
+
+// HGetAll returns all fields of the hash stored at key
+func (tx *Tx) HGetAll(key string) (map[string]string, error) {
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordRead(key)
+		tx.e.trackRequestRate()
+	}
+	return tx.txn.HGetAll(key)
+}
+
+// HDel removes fields from the hash stored at key
+func (tx *Tx) HDel(key string, fields ...string) (int, error) {
+	deleted := 0
+	for _, field := range fields {
+		ok, err := tx.txn.HDel(key, field)
+		if err != nil {
+			return deleted, err
+		}
+		if ok {
+			tx.log(wal.OpHDel, key, "", wal.WithField(field), wal.WithVersion(tx.txn.LastVersion()))
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// HLen returns the number of fields in the hash stored at key
+func (tx *Tx) HLen(key string) (int, error) {
+	return tx.txn.HLen(key)
+}
+
+// HKeys returns the field names of the hash stored at key, sorted
+func (tx *Tx) HKeys(key string) ([]string, error) {
+	all, err := tx.HGetAll(key)
+	if err != nil {
+		return nil, err
+	}
+	return sortedFields(all), nil
+}
+
+// HVals returns the values of the hash stored at key, in field order
+func (tx *Tx) HVals(key string) ([]string, error) {
+	all, err := tx.HGetAll(key)
+	if err != nil {
+		return nil, err
+	}
+	fields := sortedFields(all)
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		values[i] = all[field]
+	}
+	return values, nil
+}
+
+// HIncrBy adds delta to the integer stored in a hash field
+func (tx *Tx) HIncrBy(key, field string, delta int64) (int64, error) {
+	val, ok, err := tx.txn.HGet(key, field)
+	if err != nil {
+		return 0, err
+	}
+
+	var current int64
+	if ok {
+		current, err = strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return 0, ErrNotInteger
+		}
+	}
+	n, err := addInt64(current, delta)
+	if err != nil {
+		return 0, err
+	}
+	value := strconv.FormatInt(n, 10)
+	if err := tx.reserve(key, store.ElementSize(field, value)); err != nil {
+		return 0, err
+	}
+
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(key)
+		tx.e.trackRequestRate()
+	}
+	if _, err := tx.hset(key, field, value); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// HScan returns fields of the hash stored at key with pagination
+func (tx *Tx) HScan(key string, cursor int, pattern string, count int) (int, []string, error) {
+	next, fields, err := tx.txn.HScan(key, cursor, pattern, count)
+	if err != nil || len(fields) == 0 {
+		return next, nil, err
+	}
+
+	pairs := make([]string, 0, len(fields)*2)
+	for _, field := range fields {
+		value, _, _ := tx.txn.HGet(key, field)
+		pairs = append(pairs, field, value)
+	}
+	return next, pairs, nil
+}
+
+// sortedFields returns the keys of a hash in sorted order
+func sortedFields(hash map[string]string) []string {
+	fields := make([]string, 0, len(hash))
+	for field := range hash {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
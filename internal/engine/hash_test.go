@@ -0,0 +1,167 @@
+// internal/engine/hash_test.go
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEngine_Hash(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	added, err := engine.HSet("user", map[string]string{"name": "alice", "age": "30"})
+	if err != nil || added != 2 {
+		t.Fatalf("HSet: %d, %v", added, err)
+	}
+	if added, _ := engine.HSet("user", map[string]string{"age": "31", "city": "Accra"}); added != 1 {
+		t.Errorf("Expected 1 new field, got %d", added)
+	}
+
+	if val, ok, _ := engine.HGet("user", "age"); !ok || val != "31" {
+		t.Errorf("Expected age=31, got %q (exists: %v)", val, ok)
+	}
+	if keys, _ := engine.HKeys("user"); len(keys) != 3 || keys[0] != "age" || keys[2] != "name" {
+		t.Errorf("Unexpected HKeys: %v", keys)
+	}
+	if vals, _ := engine.HVals("user"); len(vals) != 3 || vals[0] != "31" {
+		t.Errorf("Unexpected HVals: %v", vals)
+	}
+	values, _ := engine.HMGet("user", []string{"name", "missing"})
+	if len(values) != 1 || values["name"] != "alice" {
+		t.Errorf("Unexpected HMGet: %v", values)
+	}
+
+	if n, err := engine.HIncrBy("user", "age", 2); err != nil || n != 33 {
+		t.Errorf("HIncrBy: %d, %v", n, err)
+	}
+	if _, err := engine.HIncrBy("user", "name", 1); !errors.Is(err, ErrNotInteger) {
+		t.Errorf("Expected ErrNotInteger, got %v", err)
+	}
+
+	if n, _ := engine.HDel("user", "name", "missing"); n != 1 {
+		t.Errorf("Expected 1 deleted field, got %d", n)
+	}
+	if ok, _ := engine.HExists("user", "name"); ok {
+		t.Error("Deleted field still exists")
+	}
+	if n, _ := engine.HLen("user"); n != 2 {
+		t.Errorf("Expected 2 fields, got %d", n)
+	}
+}
+
+func TestEngine_Hash_WrongType(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_ = engine.Set("str", "1")
+	_, _ = engine.HSet("hash", map[string]string{"f": "1"})
+
+	if _, err := engine.HSet("str", map[string]string{"f": "v"}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from HSet on string, got %v", err)
+	}
+	if _, err := engine.IncrBy("hash", 1); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from IncrBy on hash, got %v", err)
+	}
+	if _, err := engine.Append("hash", "x"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from Append on hash, got %v", err)
+	}
+	if _, _, err := engine.GetDel("hash"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from GetDel on hash, got %v", err)
+	}
+	if !engine.Exists("hash") {
+		t.Error("Exists should report hashes")
+	}
+
+	// SET replaces a value of any type
+	_ = engine.Set("hash", "now a string")
+	if val, ok := engine.Get("hash"); !ok || val != "now a string" {
+		t.Errorf("Expected SET to replace the hash, got %q", val)
+	}
+}
+
+func TestEngine_Hash_Recovery(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_, _ = engine1.HSet("snap", map[string]string{"a": "1", "b": "2"})
+	engine1.Expire("snap", time.Hour)
+	if err := engine1.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	// Field-level changes after the snapshot come from the WAL
+	_, _ = engine1.HSet("snap", map[string]string{"c": "3"})
+	_, _ = engine1.HDel("snap", "a")
+	_, _ = engine1.HSet("wal", map[string]string{"x|y": "line\nbreak"})
+	_, _ = engine1.HIncrBy("wal", "n", 5)
+	_, _ = engine1.HSet("gone", map[string]string{"f": "v"})
+	_, _ = engine1.HDel("gone", "f")
+	version := engine1.Version("snap")
+	engine1.Close()
+
+	engine2, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	all, _ := engine2.HGetAll("snap")
+	if len(all) != 2 || all["b"] != "2" || all["c"] != "3" {
+		t.Errorf("Unexpected recovered hash: %v", all)
+	}
+	if ttl := engine2.TTL("snap"); ttl <= 0 {
+		t.Error("Expected hash TTL to survive recovery")
+	}
+	if v := engine2.Version("snap"); v != version {
+		t.Errorf("Expected version %d after recovery, got %d", version, v)
+	}
+
+	all, _ = engine2.HGetAll("wal")
+	if all["x|y"] != "line\nbreak" || all["n"] != "5" {
+		t.Errorf("Unexpected recovered hash: %v", all)
+	}
+	if engine2.Exists("gone") {
+		t.Error("Hash emptied by HDel should not be recovered")
+	}
+}
+
+func TestEngine_Hash_RecoveryAfterExpiry(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// The server stops before the TTL passes, so no DELETE is logged
+	engine1, err := New(Options{WALPath: tmpDir, TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_, _ = engine1.HSet("h", map[string]string{"a": "1"})
+	engine1.Expire("h", 50*time.Millisecond)
+	_, _ = engine1.HSet("h", map[string]string{"b": "2"})
+	_, _ = engine1.HDel("h", "a")
+	engine1.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Replaying the later field records must not bring the hash back
+	// without its TTL
+	engine2, err := New(Options{WALPath: tmpDir, TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if engine2.Exists("h") {
+		all, _ := engine2.HGetAll("h")
+		t.Errorf("Expected the expired hash to stay expired, got %v with TTL %v", all, engine2.TTL("h"))
+	}
+}
@@ -0,0 +1,155 @@
+// internal/engine/hll.go
+package engine
+
+import (
+	"github.com/lofoneh/kvlite/internal/store"
+	"github.com/lofoneh/kvlite/internal/wal"
+)
+
+// PFAdd adds elements to the HyperLogLog stored at key, creating it if
+// needed. Returns true if the HyperLogLog was created or its estimate may
+// have changed.
+func (e *Engine) PFAdd(key string, elements ...string) (bool, error) {
+	var changed bool
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		changed, err = tx.PFAdd(key, elements...)
+		return err
+	})
+	return changed, err
+}
+
+// PFCount returns the estimated number of distinct elements added to the
+// HyperLogLogs stored at keys, counted as their union. Missing keys count
+// as empty.
+func (e *Engine) PFCount(keys ...string) (uint64, error) {
+	var n uint64
+	err := e.View(func(tx *Tx) error {
+		var err error
+		n, err = tx.PFCount(keys...)
+		return err
+	})
+	return n, err
+}
+
+// PFMerge stores in dst the union of dst and the HyperLogLogs stored at
+// keys
+func (e *Engine) PFMerge(dst string, keys ...string) error {
+	return e.Atomic(func(tx *Tx) error {
+		return tx.PFMerge(dst, keys...)
+	})
+}
+
+// PFAdd adds elements to the HyperLogLog stored at key. Each element that
+// changes a register is logged on its own; the others aren't logged.
+func (tx *Tx) PFAdd(key string, elements ...string) (bool, error) {
+	// A sparse HyperLogLog grows by a register per element at most
+	if err := tx.reserve(key, int64(4*len(elements))); err != nil {
+		return false, err
+	}
+	h, err := tx.txn.HLL(key)
+	if err != nil {
+		return false, err
+	}
+
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(key)
+		tx.e.trackRequestRate()
+	}
+
+	changed := false
+	if h == nil {
+		tx.put(key, store.NewHLLEntry())
+		changed = true
+	}
+	for _, element := range elements {
+		ok, err := tx.txn.PFAdd(key, element)
+		if err != nil {
+			return changed, err
+		}
+		if ok {
+			tx.log(wal.OpPFAdd, key, element, wal.WithVersion(tx.txn.Version(key)))
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// PFCount returns the estimated cardinality of the union of the
+// HyperLogLogs stored at keys
+func (tx *Tx) PFCount(keys ...string) (uint64, error) {
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		for _, key := range keys {
+			tx.e.analytics.RecordRead(key)
+		}
+		tx.e.trackRequestRate()
+	}
+
+	if len(keys) == 1 {
+		h, err := tx.txn.HLL(keys[0])
+		if h == nil || err != nil {
+			return 0, err
+		}
+		return h.Count(), nil
+	}
+	union, err := tx.union(nil, keys)
+	if err != nil {
+		return 0, err
+	}
+	return union.Count(), nil
+}
+
+// PFMerge stores the union of dst and the HyperLogLogs stored at keys in
+// dst, logged as a single SET record. dst keeps its expiration.
+func (tx *Tx) PFMerge(dst string, keys ...string) error {
+	current, err := tx.txn.HLL(dst)
+	if err != nil {
+		return err
+	}
+	union, err := tx.union(current, keys)
+	if err != nil {
+		return err
+	}
+
+	entry := store.NewHLLEntry()
+	entry.HLL = union
+	if err := tx.reserveValue(dst, entry.MemoryUsage()); err != nil {
+		return err
+	}
+
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(dst)
+		tx.e.trackRequestRate()
+	}
+	if old, ok := tx.txn.GetEntry(dst); ok {
+		entry.ExpiresAt = old.ExpiresAt
+	}
+	tx.put(dst, entry)
+	return nil
+}
+
+// union merges the HyperLogLogs stored at keys into a copy of base, or
+// into a new HyperLogLog if base is nil
+func (tx *Tx) union(base *store.HLL, keys []string) (*store.HLL, error) {
+	union := store.NewHLL()
+	if base != nil {
+		union = base.Clone()
+	}
+	for _, key := range keys {
+		h, err := tx.txn.HLL(key)
+		if err != nil {
+			return nil, err
+		}
+		if h != nil {
+			union.Merge(h)
+		}
+	}
+	return union, nil
+}
+
+// replayHLL applies a HyperLogLog record from the WAL
+func (e *Engine) replayHLL(record *wal.Record) {
+	e.store.RestoreHLL(record.Key, record.Version, func(h *store.HLL) {
+		h.Add(record.Value)
+	})
+}
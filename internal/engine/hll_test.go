@@ -0,0 +1,138 @@
+// internal/engine/hll_test.go
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestEngine_HLL(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if changed, err := engine.PFAdd("empty"); !changed || err != nil {
+		t.Errorf("PFAdd without elements should create the key: %v, %v", changed, err)
+	}
+	if n, _ := engine.PFCount("empty"); n != 0 {
+		t.Errorf("Expected 0, got %d", n)
+	}
+
+	if changed, _ := engine.PFAdd("mon", "a", "b", "c"); !changed {
+		t.Error("Expected PFAdd to report a change")
+	}
+	if changed, _ := engine.PFAdd("mon", "a", "b"); changed {
+		t.Error("Expected PFAdd of known elements to report no change")
+	}
+	_, _ = engine.PFAdd("tue", "c", "d")
+
+	if n, _ := engine.PFCount("mon"); n != 3 {
+		t.Errorf("Expected 3, got %d", n)
+	}
+	if n, _ := engine.PFCount("mon", "tue", "missing"); n != 4 {
+		t.Errorf("Expected a union of 4, got %d", n)
+	}
+
+	_, _ = engine.PFAdd("week", "z")
+	engine.Expire("week", time.Hour)
+	if err := engine.PFMerge("week", "mon", "tue"); err != nil {
+		t.Fatalf("PFMerge: %v", err)
+	}
+	if n, _ := engine.PFCount("week"); n != 5 {
+		t.Errorf("Expected the merge to keep dst's elements, got %d", n)
+	}
+	if engine.TTL("week") <= 0 {
+		t.Error("Expected PFMerge to keep dst's TTL")
+	}
+
+	engine.Set("str", "value")
+	if _, err := engine.PFAdd("str", "a"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	if _, err := engine.PFCount("mon", "str"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	if err := engine.PFMerge("str", "mon"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestEngine_HLL_Recovery(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	for i := 0; i < 5000; i++ {
+		_, _ = engine1.PFAdd("visitors", fmt.Sprintf("user:%d", i))
+	}
+	if err := engine1.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	// Register changes after the snapshot come from the WAL
+	for i := 5000; i < 6000; i++ {
+		_, _ = engine1.PFAdd("visitors", fmt.Sprintf("user:%d", i))
+	}
+	_, _ = engine1.PFAdd("small", "x")
+	_ = engine1.PFMerge("merged", "visitors", "small")
+	want, _ := engine1.PFCount("visitors")
+	version := engine1.Version("visitors")
+	engine1.Close()
+
+	engine2, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if v := engine2.Version("visitors"); v != version {
+		t.Errorf("Expected version %d after recovery, got %d", version, v)
+	}
+	if got, _ := engine2.PFCount("visitors"); got != want {
+		t.Errorf("Expected %d after recovery, got %d", want, got)
+	}
+	if got, _ := engine2.PFCount("merged"); got < want {
+		t.Errorf("Expected the merged HyperLogLog to survive recovery, got %d", got)
+	}
+}
+
+func TestEngine_HLL_RecoveryAfterExpiry(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// The server stops before the TTLs pass, so no DELETE is logged
+	engine1, err := New(Options{WALPath: tmpDir, TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_, _ = engine1.PFAdd("visitors", "a", "b")
+	engine1.Expire("visitors", 50*time.Millisecond)
+	_, _ = engine1.PFAdd("visitors", "c")
+
+	_ = engine1.BFReserve("bf", 0.01, 100, BloomOptions{})
+	_, _ = engine1.BFAdd("bf", "a")
+	engine1.Expire("bf", 50*time.Millisecond)
+	_, _ = engine1.BFAdd("bf", "b")
+	engine1.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Replaying the later additions must not bring the keys back without
+	// their TTL
+	engine2, err := New(Options{WALPath: tmpDir, TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	for _, key := range []string{"visitors", "bf"} {
+		if engine2.Exists(key) {
+			t.Errorf("Expected the expired key %s to stay expired, got TTL %v", key, engine2.TTL(key))
+		}
+	}
+}
@@ -0,0 +1,399 @@
+// internal/engine/json.go
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lofoneh/kvlite/internal/store"
+	"github.com/lofoneh/kvlite/internal/wal"
+)
+
+var (
+	// ErrJSONPath is returned for a path that can't be parsed
+	ErrJSONPath = store.ErrJSONPathSyntax
+	// ErrJSONInvalid is returned for a value that isn't valid JSON
+	ErrJSONInvalid = store.ErrJSONInvalid
+	// ErrJSONNotNumber is returned when incrementing a value that isn't a
+	// number
+	ErrJSONNotNumber = store.ErrJSONNotNumber
+	// ErrJSONNotArray is returned when appending to a value that isn't an
+	// array
+	ErrJSONNotArray = store.ErrJSONNotArray
+	// ErrJSONNotFinite is returned when an increment overflows
+	ErrJSONNotFinite = store.ErrJSONNotFinite
+	// ErrJSONNoPath is returned when a legacy path selects nothing
+	ErrJSONNoPath = errors.New("path does not exist")
+	// ErrJSONNoKey is returned when updating a document that doesn't exist
+	ErrJSONNoKey = errors.New("could not perform this operation on a key that doesn't exist")
+	// ErrJSONNewKey is returned when a new document is set at a path other
+	// than the root
+	ErrJSONNewKey = errors.New("new objects must be created at the root")
+)
+
+// Paths passed to the JSON methods use the JSONPath subset described by
+// store.JSONPath. Paths starting with $ select any number of values and
+// their results are JSON arrays; legacy paths (".a.b") select one value
+// and their results are that value.
+
+// JSONSet sets the value at path in the JSON document stored at key, if
+// cond holds for that location, and reports whether anything was written.
+// A new document can only be created at the root.
+func (e *Engine) JSONSet(key, path, value string, cond SetCondition) (bool, error) {
+	var ok bool
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		ok, err = tx.JSONSet(key, path, value, cond)
+		return err
+	})
+	return ok, err
+}
+
+// JSONGet returns the values selected by paths in the JSON document stored
+// at key, as JSON text. Without paths the whole document is returned; with
+// several the result is an object keyed by path. ok is false if the key
+// doesn't exist.
+func (e *Engine) JSONGet(key string, paths ...string) (string, bool, error) {
+	var result string
+	var ok bool
+	err := e.View(func(tx *Tx) error {
+		var err error
+		result, ok, err = tx.JSONGet(key, paths...)
+		return err
+	})
+	return result, ok, err
+}
+
+// JSONMGet returns the values selected by path in the JSON documents stored
+// at keys. Keys that don't exist, don't hold a document or where a legacy
+// path selects nothing are left out of the result.
+func (e *Engine) JSONMGet(path string, keys ...string) (map[string]string, error) {
+	var values map[string]string
+	err := e.View(func(tx *Tx) error {
+		var err error
+		values, err = tx.JSONMGet(path, keys...)
+		return err
+	})
+	return values, err
+}
+
+// JSONDel removes the values selected by path from the JSON document stored
+// at key, the whole key for the root, and returns how many were removed
+func (e *Engine) JSONDel(key, path string) (int, error) {
+	var n int
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		n, err = tx.JSONDel(key, path)
+		return err
+	})
+	return n, err
+}
+
+// JSONNumIncrBy adds delta to the numbers selected by path in the JSON
+// document stored at key and returns the new values as JSON. For a $ path
+// values that aren't numbers are reported as null.
+func (e *Engine) JSONNumIncrBy(key, path, delta string) (string, error) {
+	var result string
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		result, err = tx.JSONNumIncrBy(key, path, delta)
+		return err
+	})
+	return result, err
+}
+
+// JSONArrAppend appends values to the arrays selected by path in the JSON
+// document stored at key and returns their new lengths, -1 for values that
+// aren't arrays. A legacy path returns the length of the first array.
+func (e *Engine) JSONArrAppend(key, path string, values ...string) ([]int, error) {
+	var lengths []int
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		lengths, err = tx.JSONArrAppend(key, path, values...)
+		return err
+	})
+	return lengths, err
+}
+
+// JSONSet sets the value at path in the JSON document stored at key. Every
+// location written is logged as its own record holding only the new value.
+func (tx *Tx) JSONSet(key, path, value string, cond SetCondition) (bool, error) {
+	if err := tx.reserve(key, int64(len(value))); err != nil {
+		return false, err
+	}
+	p, err := store.ParseJSONPath(path)
+	if err != nil {
+		return false, err
+	}
+	if _, err := store.DecodeJSON(value); err != nil {
+		return false, err
+	}
+	doc, err := tx.txn.JSON(key)
+	if err != nil {
+		return false, err
+	}
+	if doc == nil && !p.IsRoot() && cond != SetIfExists {
+		return false, ErrJSONNewKey
+	}
+
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(key)
+		tx.e.trackRequestRate()
+	}
+	written, err := tx.txn.JSONSet(key, p, value, cond == SetIfNotExists, cond == SetIfExists)
+	if err != nil {
+		return false, err
+	}
+	for _, w := range written {
+		tx.log(wal.OpJSet, key, value, wal.WithField(w), wal.WithVersion(tx.txn.Version(key)))
+	}
+	return len(written) > 0, nil
+}
+
+// JSONGet returns the values selected by paths in the JSON document stored
+// at key
+func (tx *Tx) JSONGet(key string, paths ...string) (string, bool, error) {
+	doc, err := tx.jsonDoc(key)
+	if doc == nil || err != nil {
+		return "", false, err
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	parsed := make([]*store.JSONPath, len(paths))
+	for i, path := range paths {
+		if parsed[i], err = store.ParseJSONPath(path); err != nil {
+			return "", false, err
+		}
+	}
+	if len(paths) == 1 {
+		v, err := jsonSelect(doc, parsed[0])
+		if err != nil {
+			return "", false, err
+		}
+		return store.EncodeJSON(v), true, nil
+	}
+
+	results := make(map[string]interface{}, len(paths))
+	for i, path := range paths {
+		v, err := jsonSelect(doc, parsed[i])
+		if err != nil {
+			return "", false, err
+		}
+		results[path] = v
+	}
+	return store.EncodeJSON(results), true, nil
+}
+
+// JSONMGet returns the values selected by path in the JSON documents stored
+// at keys
+func (tx *Tx) JSONMGet(path string, keys ...string) (map[string]string, error) {
+	p, err := store.ParseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		doc, err := tx.jsonDoc(key)
+		if doc == nil || err != nil {
+			continue
+		}
+		if v, err := jsonSelect(doc, p); err == nil {
+			values[key] = store.EncodeJSON(v)
+		}
+	}
+	return values, nil
+}
+
+// JSONDel removes the values selected by path from the JSON document stored
+// at key, logging one record per location removed
+func (tx *Tx) JSONDel(key, path string) (int, error) {
+	p, err := store.ParseJSONPath(path)
+	if err != nil {
+		return 0, err
+	}
+	doc, err := tx.txn.JSON(key)
+	if doc == nil || err != nil {
+		return 0, err
+	}
+	if p.IsRoot() {
+		if _, err := tx.Delete(key); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}
+
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(key)
+		tx.e.trackRequestRate()
+	}
+	removed, err := tx.txn.JSONDel(key, p)
+	if err != nil {
+		return 0, err
+	}
+	// Removed in the order they must be replayed
+	for _, r := range removed {
+		tx.log(wal.OpJDel, key, "", wal.WithField(r), wal.WithVersion(tx.txn.Version(key)))
+	}
+	return len(removed), nil
+}
+
+// JSONNumIncrBy adds delta to the numbers selected by path in the JSON
+// document stored at key. Each new number is logged as a JSET record, so
+// replay doesn't depend on float rounding.
+func (tx *Tx) JSONNumIncrBy(key, path, delta string) (string, error) {
+	if err := tx.reserve(key, int64(len(delta))); err != nil {
+		return "", err
+	}
+	p, err := store.ParseJSONPath(path)
+	if err != nil {
+		return "", err
+	}
+	updates, err := tx.jsonUpdate(key, func() ([]store.JSONUpdate, error) {
+		return tx.txn.JSONNumIncrBy(key, p, delta)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	values := make([]interface{}, len(updates))
+	for i, u := range updates {
+		if u.Path == "" {
+			continue
+		}
+		values[i] = u.Value
+		tx.log(wal.OpJSet, key, store.EncodeJSON(u.Value),
+			wal.WithField(u.Path), wal.WithVersion(tx.txn.Version(key)))
+	}
+	if !p.Legacy() {
+		return store.EncodeJSON(values), nil
+	}
+	for _, v := range values {
+		if v != nil {
+			return store.EncodeJSON(v), nil
+		}
+	}
+	if len(values) == 0 {
+		return "", ErrJSONNoPath
+	}
+	return "", ErrJSONNotNumber
+}
+
+// JSONArrAppend appends values to the arrays selected by path in the JSON
+// document stored at key, logging the appended values once per array
+func (tx *Tx) JSONArrAppend(key, path string, values ...string) ([]int, error) {
+	if err := tx.reserve(key, elementsSize(values)); err != nil {
+		return nil, err
+	}
+	p, err := store.ParseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	updates, err := tx.jsonUpdate(key, func() ([]store.JSONUpdate, error) {
+		return tx.txn.JSONArrAppend(key, p, values...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	appended := "[" + strings.Join(values, ",") + "]"
+	lengths := make([]int, len(updates))
+	for i, u := range updates {
+		lengths[i] = -1
+		if u.Path == "" {
+			continue
+		}
+		lengths[i] = u.Value.(int)
+		tx.log(wal.OpJApp, key, appended, wal.WithField(u.Path), wal.WithVersion(tx.txn.Version(key)))
+	}
+	if !p.Legacy() {
+		return lengths, nil
+	}
+	for _, n := range lengths {
+		if n != -1 {
+			return []int{n}, nil
+		}
+	}
+	if len(lengths) == 0 {
+		return nil, ErrJSONNoPath
+	}
+	return nil, ErrJSONNotArray
+}
+
+// jsonUpdate runs an update of the JSON document stored at key, which must
+// exist
+func (tx *Tx) jsonUpdate(key string, fn func() ([]store.JSONUpdate, error)) ([]store.JSONUpdate, error) {
+	doc, err := tx.txn.JSON(key)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, ErrJSONNoKey
+	}
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(key)
+		tx.e.trackRequestRate()
+	}
+	return fn()
+}
+
+// jsonDoc returns the JSON document stored at key, nil if the key doesn't
+// exist, and records the read
+func (tx *Tx) jsonDoc(key string) (*store.JSONDoc, error) {
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordRead(key)
+		tx.e.trackRequestRate()
+	}
+	return tx.txn.JSON(key)
+}
+
+// jsonSelect returns the values selected by a path: an array for $ paths,
+// the first value for legacy paths
+func jsonSelect(doc *store.JSONDoc, p *store.JSONPath) (interface{}, error) {
+	values := doc.Get(p)
+	if !p.Legacy() {
+		return values, nil
+	}
+	if len(values) == 0 {
+		return nil, ErrJSONNoPath
+	}
+	return values[0], nil
+}
+
+// replayJSON applies a JSON record from the WAL
+func (e *Engine) replayJSON(record *wal.Record) error {
+	p, err := store.ParseJSONPath(record.Field)
+	if err != nil {
+		return fmt.Errorf("invalid JSON path %q", record.Field)
+	}
+
+	var apply func(d *store.JSONDoc)
+	switch record.Op {
+	case wal.OpJSet:
+		if _, err := store.DecodeJSON(record.Value); err != nil {
+			return fmt.Errorf("invalid JSON value %q", record.Value)
+		}
+		apply = func(d *store.JSONDoc) {
+			d.Set(p, record.Value, false, false)
+		}
+	case wal.OpJDel:
+		apply = func(d *store.JSONDoc) {
+			d.Delete(p)
+		}
+	case wal.OpJApp:
+		var values []json.RawMessage
+		if err := json.Unmarshal([]byte(record.Value), &values); err != nil {
+			return fmt.Errorf("invalid JSON array %q", record.Value)
+		}
+		apply = func(d *store.JSONDoc) {
+			for _, v := range values {
+				d.ArrAppend(p, string(v))
+			}
+		}
+	}
+	e.store.RestoreJSON(record.Key, record.Version, apply)
+	return nil
+}
@@ -0,0 +1,258 @@
+// internal/engine/json_test.go
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEngine_JSON(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if _, err := engine.JSONSet("user", "$.name", `"ann"`, SetAlways); !errors.Is(err, ErrJSONNewKey) {
+		t.Errorf("Expected ErrJSONNewKey, got %v", err)
+	}
+	if _, err := engine.JSONSet("user", "$", `{"name":`, SetAlways); !errors.Is(err, ErrJSONInvalid) {
+		t.Errorf("Expected ErrJSONInvalid, got %v", err)
+	}
+	if ok, err := engine.JSONSet("user", "$", `{"name":"ann","age":30,"tags":["a"]}`, SetAlways); !ok || err != nil {
+		t.Fatalf("JSONSet: %v, %v", ok, err)
+	}
+	if ok, _ := engine.JSONSet("user", "$.name", `"bob"`, SetIfNotExists); ok {
+		t.Error("Expected NX not to replace the name")
+	}
+	if ok, _ := engine.JSONSet("user", "$.city", `"oslo"`, SetIfNotExists); !ok {
+		t.Error("Expected NX to add the city")
+	}
+
+	tests := []struct {
+		paths []string
+		want  string
+	}{
+		{nil, `{"age":30,"city":"oslo","name":"ann","tags":["a"]}`},
+		{[]string{"$.name"}, `["ann"]`},
+		{[]string{".name"}, `"ann"`},
+		{[]string{"$.nope"}, `[]`},
+		{[]string{"$.age", ".tags"}, `{"$.age":[30],".tags":["a"]}`},
+	}
+	for _, tt := range tests {
+		got, ok, err := engine.JSONGet("user", tt.paths...)
+		if !ok || err != nil || got != tt.want {
+			t.Errorf("JSONGet %v: expected %s, got %s (%v, %v)", tt.paths, tt.want, got, ok, err)
+		}
+	}
+	if _, _, err := engine.JSONGet("user", ".nope"); !errors.Is(err, ErrJSONNoPath) {
+		t.Errorf("Expected ErrJSONNoPath, got %v", err)
+	}
+	if _, ok, _ := engine.JSONGet("missing"); ok {
+		t.Error("Expected a missing key not to be found")
+	}
+
+	if got, err := engine.JSONNumIncrBy("user", "$.age", "1.5"); got != "[31.5]" || err != nil {
+		t.Errorf("JSONNumIncrBy: %s, %v", got, err)
+	}
+	if got, _ := engine.JSONNumIncrBy("user", "$.*", "1"); got != "[32.5,null,null,null]" {
+		t.Errorf("Expected null for values that aren't numbers, got %s", got)
+	}
+	if _, err := engine.JSONNumIncrBy("user", ".name", "1"); !errors.Is(err, ErrJSONNotNumber) {
+		t.Errorf("Expected ErrJSONNotNumber, got %v", err)
+	}
+	if _, err := engine.JSONNumIncrBy("missing", "$", "1"); !errors.Is(err, ErrJSONNoKey) {
+		t.Errorf("Expected ErrJSONNoKey, got %v", err)
+	}
+
+	if n, err := engine.JSONArrAppend("user", "$.tags", `"b"`, `{"c":1}`); !reflect.DeepEqual(n, []int{3}) || err != nil {
+		t.Errorf("JSONArrAppend: %v, %v", n, err)
+	}
+	if n, _ := engine.JSONArrAppend("user", "$.*", "1"); !reflect.DeepEqual(n, []int{-1, -1, -1, 4}) {
+		t.Errorf("Expected -1 for values that aren't arrays, got %v", n)
+	}
+	if _, err := engine.JSONArrAppend("user", ".name", "1"); !errors.Is(err, ErrJSONNotArray) {
+		t.Errorf("Expected ErrJSONNotArray, got %v", err)
+	}
+
+	if n, err := engine.JSONDel("user", "$.tags[0]"); n != 1 || err != nil {
+		t.Errorf("JSONDel: %d, %v", n, err)
+	}
+	if got, _, _ := engine.JSONGet("user", "$.tags"); got != `[["b",{"c":1},1]]` {
+		t.Errorf("Unexpected tags: %s", got)
+	}
+	if n, _ := engine.JSONDel("user", "$"); n != 1 {
+		t.Errorf("Expected the document removed, got %d", n)
+	}
+	if engine.Exists("user") {
+		t.Error("Expected deleting the root to remove the key")
+	}
+
+	engine.Set("str", "x")
+	if _, err := engine.JSONSet("str", "$", "1", SetAlways); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	if _, err := engine.JSONDel("str", "$["); !errors.Is(err, ErrJSONPath) {
+		t.Errorf("Expected ErrJSONPath, got %v", err)
+	}
+}
+
+func TestEngine_JSONMGet(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_, _ = engine.JSONSet("a", "$", `{"n":1}`, SetAlways)
+	_, _ = engine.JSONSet("b", "$", `{"m":2}`, SetAlways)
+	engine.Set("s", "x")
+
+	values, err := engine.JSONMGet("$.n", "a", "b", "s", "missing")
+	if err != nil {
+		t.Fatalf("JSONMGet: %v", err)
+	}
+	want := map[string]string{"a": "[1]", "b": "[]"}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("Expected %v, got %v", want, values)
+	}
+	values, _ = engine.JSONMGet(".n", "a", "b")
+	if !reflect.DeepEqual(values, map[string]string{"a": "1"}) {
+		t.Errorf("Expected only a, got %v", values)
+	}
+}
+
+func TestEngine_JSON_WALSize(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	big := `{"blob":"` + strings.Repeat("x", 1<<20) + `","n":0}`
+	_, _ = engine.JSONSet("doc", "$", big, SetAlways)
+	before, _ := engine.WALSize()
+	for i := 0; i < 100; i++ {
+		_, _ = engine.JSONNumIncrBy("doc", "$.n", "1")
+	}
+	after, _ := engine.WALSize()
+	if grown := after - before; grown <= 0 || grown > 100*200 {
+		t.Errorf("Expected small path-level records, the WAL grew by %d bytes", grown)
+	}
+}
+
+func TestEngine_JSON_Recovery(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_, _ = engine1.JSONSet("doc", "$", `{"n":1,"list":[1,2,3],"m":{"a":1,"b":2}}`, SetAlways)
+	engine1.Expire("doc", time.Hour)
+	if err := engine1.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	// Changes after the snapshot come from the WAL
+	_, _ = engine1.JSONNumIncrBy("doc", "$.n", "0.1")
+	_, _ = engine1.JSONArrAppend("doc", "$.list", "4", `"five"`)
+	_, _ = engine1.JSONDel("doc", "$.list[*]")
+	_, _ = engine1.JSONArrAppend("doc", "$.list", `"x|y"`)
+	_, _ = engine1.JSONDel("doc", "$.m.a")
+	_, _ = engine1.JSONSet("doc", `$["new key"]`, `{"k":[true,null]}`, SetAlways)
+	_, _ = engine1.JSONSet("fresh", "$", `[1]`, SetAlways)
+	_, _ = engine1.JSONSet("gone", "$", `[1]`, SetAlways)
+	_, _ = engine1.JSONDel("gone", "$")
+	want, _, _ := engine1.JSONGet("doc")
+	version := engine1.Version("doc")
+	engine1.Close()
+
+	engine2, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if v := engine2.Version("doc"); v != version {
+		t.Errorf("Expected version %d after recovery, got %d", version, v)
+	}
+	if got, _, _ := engine2.JSONGet("doc"); got != want {
+		t.Errorf("Expected %s after recovery, got %s", want, got)
+	}
+	if engine2.TTL("doc") <= 0 {
+		t.Error("Expected the document TTL to survive recovery")
+	}
+	if got, _, _ := engine2.JSONGet("fresh"); got != "[1]" {
+		t.Errorf("Expected [1], got %s", got)
+	}
+	if engine2.Exists("gone") {
+		t.Error("Expected the deleted document to stay deleted")
+	}
+}
+
+func TestEngine_JSON_RecoveryEscapes(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	// Escapes in JSON strings put backslashes in the WAL values, and the
+	// large document is over the 64KB a line scanner reads
+	_, _ = engine1.JSONSet("doc", "$", `{"p":"C:\\new","q":"a\nb \"c\" \\\\n \u00e9"}`, SetAlways)
+	_, _ = engine1.JSONSet("doc", "$.r", `"tab\tand\\nslash"`, SetAlways)
+	_, _ = engine1.JSONArrAppend("doc", "$.list", `"x"`)
+	_, _ = engine1.JSONSet("doc", "$.list", `["\\n"]`, SetAlways)
+	_, _ = engine1.JSONArrAppend("doc", "$.list", `"\\\\"`)
+	_, _ = engine1.JSONSet("large", "$", `["`+strings.Repeat(`\\n`, 40*1024)+`"]`, SetAlways)
+	want, _, _ := engine1.JSONGet("doc")
+	large, _, _ := engine1.JSONGet("large")
+	engine1.Close()
+
+	engine2, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	defer engine2.Close()
+
+	if got, _, _ := engine2.JSONGet("doc"); got != want {
+		t.Errorf("Expected %s after recovery, got %s", want, got)
+	}
+	if got, _, _ := engine2.JSONGet("large"); got != large {
+		t.Errorf("Expected the %d byte document to survive recovery", len(large))
+	}
+}
+
+func TestEngine_JSON_RecoveryAfterExpiry(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// The server stops before the TTL passes, so no DELETE is logged
+	engine1, err := New(Options{WALPath: tmpDir, TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_, _ = engine1.JSONSet("doc", "$", `{"a":1}`, SetAlways)
+	engine1.Expire("doc", 50*time.Millisecond)
+	_, _ = engine1.JSONSet("doc", "$.b", `2`, SetAlways)
+	_, _ = engine1.JSONArrAppend("doc", "$.c", `3`)
+	engine1.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Replaying the later path records must not bring the document back
+	// without its TTL
+	engine2, err := New(Options{WALPath: tmpDir, TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if engine2.Exists("doc") {
+		doc, _, _ := engine2.JSONGet("doc")
+		t.Errorf("Expected the expired document to stay expired, got %s with TTL %v", doc, engine2.TTL("doc"))
+	}
+}
@@ -0,0 +1,141 @@
+// internal/engine/keys.go
+package engine
+
+import (
+	"errors"
+
+	"github.com/lofoneh/kvlite/internal/store"
+)
+
+// ErrNoSuchKey is returned when renaming a key that doesn't exist
+var ErrNoSuchKey = errors.New("no such key")
+
+// Rename renames src to dst, keeping its value and TTL and replacing dst
+// if it exists. With nx, dst is only written if it doesn't exist, and
+// false is returned otherwise. It fails with ErrNoSuchKey if src doesn't
+// exist.
+func (e *Engine) Rename(src, dst string, nx bool) (bool, error) {
+	var renamed bool
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		renamed, err = tx.Rename(src, dst, nx)
+		return err
+	})
+	return renamed, err
+}
+
+// Copy copies src to dst in database db, keeping its TTL. Without replace
+// it returns false if dst already exists.
+func (e *Engine) Copy(src, dst string, db int, replace bool) (bool, error) {
+	var copied bool
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		copied, err = tx.Copy(src, dst, db, replace)
+		return err
+	})
+	return copied, err
+}
+
+// Type returns the name of the type of the value at key, "none" if the key
+// doesn't exist
+func (e *Engine) Type(key string) string {
+	var name string
+	e.View(func(tx *Tx) error {
+		name = tx.Type(key)
+		return nil
+	})
+	return name
+}
+
+// RandomKey returns a key picked at random, false if the database is empty
+func (e *Engine) RandomKey() (string, bool) {
+	return e.store.RandomKey()
+}
+
+// Touch records an access to each of keys and returns how many exist
+func (e *Engine) Touch(keys ...string) int {
+	var n int
+	e.Atomic(func(tx *Tx) error {
+		n = tx.Touch(keys...)
+		return nil
+	})
+	return n
+}
+
+// Rename renames src to dst, keeping its value and TTL
+func (tx *Tx) Rename(src, dst string, nx bool) (bool, error) {
+	entry, ok := tx.txn.GetEntry(src)
+	if !ok {
+		return false, ErrNoSuchKey
+	}
+	if src == dst {
+		return !nx, nil
+	}
+	if nx && tx.Exists(dst) {
+		return false, nil
+	}
+	// The key count doesn't change, only the length of the key
+	limits, _ := tx.e.quota.get()
+	if err := tx.check(limits, false, int64(len(dst)-len(src))); err != nil {
+		return false, err
+	}
+	renamed := *entry
+	tx.put(dst, &renamed)
+	return tx.Delete(src)
+}
+
+// Copy copies src to dst in database n, keeping its TTL. The copy shares
+// nothing with the original.
+func (tx *Tx) Copy(src, dst string, n int, replace bool) (bool, error) {
+	target, err := tx.DB(n)
+	if err != nil {
+		return false, err
+	}
+	if n == tx.e.db && src == dst {
+		return false, ErrSameDB
+	}
+	entry, ok := tx.txn.GetEntry(src)
+	if !ok || (!replace && target.Exists(dst)) {
+		return false, nil
+	}
+	if err := target.reserveValue(dst, entry.MemoryUsage()); err != nil {
+		return false, err
+	}
+	dup, err := store.NewEntryFromPayload(entry.Type, entry.Payload())
+	if err != nil {
+		return false, err
+	}
+	dup.ExpiresAt = entry.ExpiresAt
+	target.put(dst, dup)
+	return true, nil
+}
+
+// Type returns the name of the type of the value at key, "none" if the key
+// doesn't exist
+func (tx *Tx) Type(key string) string {
+	entry, ok := tx.txn.GetEntry(key)
+	if !ok {
+		return "none"
+	}
+	return entry.Type.String()
+}
+
+// RandomKey returns a key picked at random, false if the database is empty
+func (tx *Tx) RandomKey() (string, bool) {
+	return tx.txn.RandomKey()
+}
+
+// Touch records an access to each of keys and returns how many exist
+func (tx *Tx) Touch(keys ...string) int {
+	n := 0
+	for _, key := range keys {
+		if !tx.Exists(key) {
+			continue
+		}
+		n++
+		if tx.e.enableAnalytics && tx.e.analytics != nil {
+			tx.e.analytics.RecordRead(key)
+		}
+	}
+	return n
+}
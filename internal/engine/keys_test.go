@@ -0,0 +1,201 @@
+// internal/engine/keys_test.go
+package engine
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEngine_Rename(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if _, err := engine.Rename("missing", "b", false); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("Expected ErrNoSuchKey, got %v", err)
+	}
+
+	_ = engine.SetWithTTL("a", "1", time.Hour)
+	_, _ = engine.RPush("b", "x")
+	if ok, err := engine.Rename("a", "b", false); !ok || err != nil {
+		t.Fatalf("Rename failed: %v, %v", ok, err)
+	}
+	if engine.Exists("a") {
+		t.Error("Expected a to be gone")
+	}
+	if v, _ := engine.Get("b"); v != "1" {
+		t.Errorf("Expected b=1 replacing the list, got %q", v)
+	}
+	if ttl := engine.TTL("b"); ttl <= 0 {
+		t.Errorf("Expected the TTL to be kept, got %v", ttl)
+	}
+
+	// NX leaves an existing key alone
+	_ = engine.Set("c", "2")
+	if ok, _ := engine.Rename("c", "b", true); ok {
+		t.Error("Expected RENAMENX onto an existing key to fail")
+	}
+	if ok, _ := engine.Rename("c", "d", true); !ok {
+		t.Error("Expected RENAMENX onto a new key to succeed")
+	}
+	if ok, err := engine.Rename("d", "d", false); !ok || err != nil {
+		t.Errorf("Expected renaming a key to itself to succeed, got %v, %v", ok, err)
+	}
+	if ok, _ := engine.Rename("d", "d", true); ok {
+		t.Error("Expected RENAMENX of a key to itself to return false")
+	}
+}
+
+func TestEngine_Copy(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir(), Databases: 2})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_, _ = engine.HSet("h", map[string]string{"f": "v"})
+	_ = engine.Expire("h", time.Hour)
+	if ok, err := engine.Copy("h", "h2", 0, false); !ok || err != nil {
+		t.Fatalf("Copy failed: %v, %v", ok, err)
+	}
+
+	// The copy is independent of the original
+	_, _ = engine.HSet("h2", map[string]string{"g": "w"})
+	if all, _ := engine.HGetAll("h"); len(all) != 1 {
+		t.Errorf("Writing the copy changed the original: %v", all)
+	}
+	if engine.TTL("h2") <= 0 {
+		t.Error("Expected the copy to keep the TTL")
+	}
+
+	if ok, _ := engine.Copy("h", "h2", 0, false); ok {
+		t.Error("Expected COPY onto an existing key to fail without REPLACE")
+	}
+	if ok, _ := engine.Copy("h", "h2", 0, true); !ok {
+		t.Error("Expected COPY with REPLACE to succeed")
+	}
+	if all, _ := engine.HGetAll("h2"); len(all) != 1 {
+		t.Errorf("Expected the replaced copy to have 1 field, got %v", all)
+	}
+	if ok, _ := engine.Copy("missing", "x", 0, false); ok {
+		t.Error("Expected COPY of a missing key to fail")
+	}
+	if _, err := engine.Copy("h", "h", 0, false); !errors.Is(err, ErrSameDB) {
+		t.Errorf("Expected ErrSameDB, got %v", err)
+	}
+	if _, err := engine.Copy("h", "h", 5, false); !errors.Is(err, ErrDBIndex) {
+		t.Errorf("Expected ErrDBIndex, got %v", err)
+	}
+
+	// Into another database
+	db1, _ := engine.DB(1)
+	if ok, _ := engine.Copy("h", "h", 1, false); !ok {
+		t.Fatal("Expected COPY to another database to succeed")
+	}
+	if v, ok, _ := db1.HGet("h", "f"); !ok || v != "v" {
+		t.Errorf("Expected the copy in db 1, got %q", v)
+	}
+}
+
+func TestEngine_TypeTouchRandomKey(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if _, ok := engine.RandomKey(); ok {
+		t.Error("Expected no key in an empty database")
+	}
+
+	_ = engine.Set("s", "v")
+	_, _ = engine.RPush("l", "x")
+	_, _ = engine.ZAdd("z", []ZMember{{Member: "m", Score: 1}}, ZAddOptions{})
+	for key, want := range map[string]string{"s": "string", "l": "list", "z": "zset", "missing": "none"} {
+		if got := engine.Type(key); got != want {
+			t.Errorf("Type(%s) = %q, want %q", key, got, want)
+		}
+	}
+
+	if n := engine.Touch("s", "l", "missing", "s"); n != 3 {
+		t.Errorf("Expected 3 touched keys, got %d", n)
+	}
+	if key, ok := engine.RandomKey(); !ok || !engine.Exists(key) {
+		t.Errorf("Expected an existing key, got %q", key)
+	}
+}
+
+func TestEngine_KeysRecovery(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir, Databases: 2})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_ = engine1.Set("a", "1")
+	_, _ = engine1.Rename("a", "b", false)
+	_, _ = engine1.RPush("l", "x", "y")
+	_, _ = engine1.Copy("l", "l", 1, false)
+	engine1.Close()
+
+	engine2, err := New(Options{WALPath: tmpDir, Databases: 2})
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if engine2.Exists("a") {
+		t.Error("Expected a to stay renamed")
+	}
+	if v, _ := engine2.Get("b"); v != "1" {
+		t.Errorf("Expected b=1, got %q", v)
+	}
+	db1, _ := engine2.DB(1)
+	if values, _ := db1.LRange("l", 0, -1); len(values) != 2 {
+		t.Errorf("Expected the copied list in db 1, got %v", values)
+	}
+}
+
+func TestEngine_KeysRecovery_LargeCollections(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir, Databases: 2})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	// RENAME and COPY log the whole collection in one record, well over
+	// 64KB here
+	members := make([]string, 8000)
+	for i := range members {
+		members[i] = "member:" + strconv.Itoa(i) + `\n|`
+	}
+	_, _ = engine1.SAdd("big", members...)
+	if _, err := engine1.Rename("big", "renamed", false); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if _, err := engine1.Copy("renamed", "copied", 1, false); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	engine1.Close()
+
+	engine2, err := New(Options{WALPath: tmpDir, Databases: 2})
+	if err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	defer engine2.Close()
+
+	if n, _ := engine2.SCard("renamed"); n != len(members) {
+		t.Errorf("Expected %d members after recovery, got %d", len(members), n)
+	}
+	if ok, _ := engine2.SIsMember("renamed", members[42]); !ok {
+		t.Errorf("Expected %q to survive recovery", members[42])
+	}
+	db1, _ := engine2.DB(1)
+	if n, _ := db1.SCard("copied"); n != len(members) {
+		t.Errorf("Expected %d members in the copy, got %d", len(members), n)
+	}
+}
@@ -0,0 +1,354 @@
+// internal/engine/list.go
+package engine
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/lofoneh/kvlite/internal/store"
+	"github.com/lofoneh/kvlite/internal/wal"
+)
+
+// ListSide selects the end of a list an operation works on
+type ListSide int
+
+const (
+	ListLeft  ListSide = iota // Head of the list
+	ListRight                 // Tail of the list
+)
+
+// LPush adds values at the head of the list stored at key, one after the
+// other, creating the list if needed. Returns the new length.
+func (e *Engine) LPush(key string, values ...string) (int, error) {
+	return e.push(key, ListLeft, values)
+}
+
+// RPush adds values at the tail of the list stored at key, creating the
+// list if needed. Returns the new length.
+func (e *Engine) RPush(key string, values ...string) (int, error) {
+	return e.push(key, ListRight, values)
+}
+
+// push runs LPush or RPush in a transaction
+func (e *Engine) push(key string, side ListSide, values []string) (int, error) {
+	var n int
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		n, err = tx.push(key, side, values)
+		return err
+	})
+	return n, err
+}
+
+// LPop removes and returns up to count elements from the head of the list
+// stored at key. Returns nil if the key doesn't exist.
+func (e *Engine) LPop(key string, count int) ([]string, error) {
+	return e.pop(key, ListLeft, count)
+}
+
+// RPop removes and returns up to count elements from the tail of the list
+// stored at key. Returns nil if the key doesn't exist.
+func (e *Engine) RPop(key string, count int) ([]string, error) {
+	return e.pop(key, ListRight, count)
+}
+
+// pop runs LPop or RPop in a transaction
+func (e *Engine) pop(key string, side ListSide, count int) ([]string, error) {
+	var values []string
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		values, err = tx.pop(key, side, count)
+		return err
+	})
+	return values, err
+}
+
+// PopFirst pops one element from the first non-empty list among keys, as
+// used by BLPOP and BRPOP. Returns the key it popped from and the element.
+func (e *Engine) PopFirst(keys []string, side ListSide) (string, string, bool, error) {
+	var key, value string
+	var ok bool
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		key, value, ok, err = tx.PopFirst(keys, side)
+		return err
+	})
+	return key, value, ok, err
+}
+
+// LLen returns the length of the list stored at key
+func (e *Engine) LLen(key string) (int, error) {
+	var n int
+	err := e.View(func(tx *Tx) error {
+		var err error
+		n, err = tx.LLen(key)
+		return err
+	})
+	return n, err
+}
+
+// LIndex returns the element at index in the list stored at key. Negative
+// indexes count from the tail.
+func (e *Engine) LIndex(key string, index int) (string, bool, error) {
+	var val string
+	var ok bool
+	err := e.View(func(tx *Tx) error {
+		var err error
+		val, ok, err = tx.LIndex(key, index)
+		return err
+	})
+	return val, ok, err
+}
+
+// LRange returns the elements from start to stop inclusive of the list
+// stored at key. Negative indexes count from the tail.
+func (e *Engine) LRange(key string, start, stop int) ([]string, error) {
+	var values []string
+	err := e.View(func(tx *Tx) error {
+		var err error
+		values, err = tx.LRange(key, start, stop)
+		return err
+	})
+	return values, err
+}
+
+// LRem removes elements equal to value from the list stored at key: the
+// first count from the head if count is positive, the last -count from the
+// tail if negative, all of them if 0. Returns the number removed.
+func (e *Engine) LRem(key string, count int, value string) (int, error) {
+	var removed int
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		removed, err = tx.LRem(key, count, value)
+		return err
+	})
+	return removed, err
+}
+
+// LTrim keeps only the elements from start to stop inclusive of the list
+// stored at key
+func (e *Engine) LTrim(key string, start, stop int) error {
+	return e.Atomic(func(tx *Tx) error {
+		return tx.LTrim(key, start, stop)
+	})
+}
+
+// LMove atomically pops an element from one end of src and pushes it onto
+// one end of dst. src and dst may be the same list, which rotates it.
+// Returns false if src doesn't exist.
+func (e *Engine) LMove(src, dst string, from, to ListSide) (string, bool, error) {
+	var val string
+	var ok bool
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		val, ok, err = tx.LMove(src, dst, from, to)
+		return err
+	})
+	return val, ok, err
+}
+
+// push adds values to one end of a list and logs each of them
+func (tx *Tx) push(key string, side ListSide, values []string) (int, error) {
+	if err := tx.reserve(key, elementsSize(values)); err != nil {
+		return 0, err
+	}
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(key)
+		tx.e.trackRequestRate()
+	}
+
+	var n int
+	for _, value := range values {
+		var err error
+		op := wal.OpRPush
+		if side == ListLeft {
+			n, err = tx.txn.LPush(key, value)
+			op = wal.OpLPush
+		} else {
+			n, err = tx.txn.RPush(key, value)
+		}
+		if err != nil {
+			return n, err
+		}
+		tx.log(op, key, value, wal.WithVersion(tx.txn.Version(key)))
+	}
+	return n, nil
+}
+
+// pop removes up to count elements from one end of a list and logs them
+func (tx *Tx) pop(key string, side ListSide, count int) ([]string, error) {
+	var values []string
+	for len(values) < count {
+		var val string
+		var ok bool
+		var err error
+		op := wal.OpRPop
+		if side == ListLeft {
+			val, ok, err = tx.txn.LPop(key)
+			op = wal.OpLPop
+		} else {
+			val, ok, err = tx.txn.RPop(key)
+		}
+		if err != nil {
+			return values, err
+		}
+		if !ok {
+			break
+		}
+		// Popping the last element removes the key, so log the last version
+		// rather than the key's, which is 0 by then
+		tx.log(op, key, "", wal.WithVersion(tx.txn.LastVersion()))
+		values = append(values, val)
+	}
+
+	if len(values) > 0 && tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(key)
+		tx.e.trackRequestRate()
+	}
+	return values, nil
+}
+
+// LPush adds values at the head of the list stored at key
+func (tx *Tx) LPush(key string, values ...string) (int, error) {
+	return tx.push(key, ListLeft, values)
+}
+
+// RPush adds values at the tail of the list stored at key
+func (tx *Tx) RPush(key string, values ...string) (int, error) {
+	return tx.push(key, ListRight, values)
+}
+
+// LPop removes and returns up to count elements from the head of a list
+func (tx *Tx) LPop(key string, count int) ([]string, error) {
+	return tx.pop(key, ListLeft, count)
+}
+
+// RPop removes and returns up to count elements from the tail of a list
+func (tx *Tx) RPop(key string, count int) ([]string, error) {
+	return tx.pop(key, ListRight, count)
+}
+
+// PopFirst pops one element from the first non-empty list among keys
+func (tx *Tx) PopFirst(keys []string, side ListSide) (string, string, bool, error) {
+	for _, key := range keys {
+		values, err := tx.pop(key, side, 1)
+		if err != nil {
+			return "", "", false, err
+		}
+		if len(values) > 0 {
+			return key, values[0], true, nil
+		}
+	}
+	return "", "", false, nil
+}
+
+// LLen returns the length of the list stored at key
+func (tx *Tx) LLen(key string) (int, error) {
+	return tx.txn.LLen(key)
+}
+
+// LIndex returns the element at index in the list stored at key
+func (tx *Tx) LIndex(key string, index int) (string, bool, error) {
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordRead(key)
+		tx.e.trackRequestRate()
+	}
+	return tx.txn.LIndex(key, index)
+}
+
+// LRange returns the elements from start to stop inclusive of a list
+func (tx *Tx) LRange(key string, start, stop int) ([]string, error) {
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordRead(key)
+		tx.e.trackRequestRate()
+	}
+	return tx.txn.LRange(key, start, stop)
+}
+
+// LRem removes elements equal to value from the list stored at key
+func (tx *Tx) LRem(key string, count int, value string) (int, error) {
+	removed, err := tx.txn.LRem(key, count, value)
+	if removed == 0 || err != nil {
+		return 0, err
+	}
+	tx.log(wal.OpLRem, key, value,
+		wal.WithField(strconv.Itoa(count)), wal.WithVersion(tx.txn.LastVersion()))
+	return removed, nil
+}
+
+// LTrim keeps only the elements from start to stop inclusive of a list
+func (tx *Tx) LTrim(key string, start, stop int) error {
+	ok, err := tx.txn.LTrim(key, start, stop)
+	if !ok || err != nil {
+		return err
+	}
+	tx.log(wal.OpLTrim, key, fmt.Sprintf("%d %d", start, stop),
+		wal.WithVersion(tx.txn.LastVersion()))
+	return nil
+}
+
+// LMove pops an element from one end of src and pushes it onto dst
+func (tx *Tx) LMove(src, dst string, from, to ListSide) (string, bool, error) {
+	// Check dst first so a type error leaves src untouched
+	if !tx.txn.IsList(dst) {
+		return "", false, ErrWrongType
+	}
+	index := -1
+	if from == ListLeft {
+		index = 0
+	}
+	value, ok, err := tx.txn.LIndex(src, index)
+	if !ok || err != nil {
+		return "", false, err
+	}
+	if err := tx.reserve(dst, store.ElementSize(value)); err != nil {
+		return "", false, err
+	}
+	values, err := tx.pop(src, from, 1)
+	if len(values) == 0 || err != nil {
+		return "", false, err
+	}
+	if _, err := tx.push(dst, to, values); err != nil {
+		return "", false, err
+	}
+	return values[0], true, nil
+}
+
+// replayList applies a list record from the WAL
+func (e *Engine) replayList(record *wal.Record) error {
+	switch record.Op {
+	case wal.OpLPush:
+		e.store.RestoreList(record.Key, record.Version, func(l *store.List) {
+			l.PushFront(record.Value)
+		})
+	case wal.OpRPush:
+		e.store.RestoreList(record.Key, record.Version, func(l *store.List) {
+			l.PushBack(record.Value)
+		})
+	case wal.OpLPop:
+		e.store.RestoreList(record.Key, record.Version, func(l *store.List) {
+			l.PopFront()
+		})
+	case wal.OpRPop:
+		e.store.RestoreList(record.Key, record.Version, func(l *store.List) {
+			l.PopBack()
+		})
+	case wal.OpLRem:
+		count, err := strconv.Atoi(record.Field)
+		if err != nil {
+			return fmt.Errorf("invalid LREM count %q: %w", record.Field, err)
+		}
+		e.store.RestoreList(record.Key, record.Version, func(l *store.List) {
+			l.Remove(count, record.Value)
+		})
+	case wal.OpLTrim:
+		var start, stop int
+		if _, err := fmt.Sscanf(record.Value, "%d %d", &start, &stop); err != nil {
+			return fmt.Errorf("invalid LTRIM range %q: %w", record.Value, err)
+		}
+		e.store.RestoreList(record.Key, record.Version, func(l *store.List) {
+			l.Trim(start, stop)
+		})
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+// internal/engine/list_test.go
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEngine_List(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if n, err := engine.RPush("jobs", "a", "b", "c"); err != nil || n != 3 {
+		t.Fatalf("RPush: %d, %v", n, err)
+	}
+	if n, _ := engine.LPush("jobs", "y", "z"); n != 5 {
+		t.Errorf("Expected length 5, got %d", n)
+	}
+	if all, _ := engine.LRange("jobs", 0, -1); !reflect.DeepEqual(all, []string{"z", "y", "a", "b", "c"}) {
+		t.Errorf("Unexpected LRange: %v", all)
+	}
+	if val, ok, _ := engine.LIndex("jobs", -2); !ok || val != "b" {
+		t.Errorf("Expected LIndex -2 = b, got %q", val)
+	}
+
+	if vals, _ := engine.LPop("jobs", 2); !reflect.DeepEqual(vals, []string{"z", "y"}) {
+		t.Errorf("Unexpected LPop: %v", vals)
+	}
+	if vals, _ := engine.RPop("jobs", 1); !reflect.DeepEqual(vals, []string{"c"}) {
+		t.Errorf("Unexpected RPop: %v", vals)
+	}
+	if vals, _ := engine.LPop("missing", 1); vals != nil {
+		t.Errorf("Expected nil from missing list, got %v", vals)
+	}
+
+	// LMOVE to itself rotates the list
+	if val, ok, _ := engine.LMove("jobs", "jobs", ListLeft, ListRight); !ok || val != "a" {
+		t.Errorf("Expected LMove a, got %q", val)
+	}
+	if all, _ := engine.LRange("jobs", 0, -1); !reflect.DeepEqual(all, []string{"b", "a"}) {
+		t.Errorf("Unexpected list after rotation: %v", all)
+	}
+
+	// A job moves to a processing list and is acknowledged with LREM
+	val, _, _ := engine.LMove("jobs", "processing", ListLeft, ListLeft)
+	if n, _ := engine.LRem("processing", 1, val); n != 1 {
+		t.Errorf("Expected LRem to remove 1, got %d", n)
+	}
+	if engine.Exists("processing") {
+		t.Error("Expected empty list to be removed")
+	}
+
+	key, val, ok, _ := engine.PopFirst([]string{"missing", "jobs"}, ListRight)
+	if !ok || key != "jobs" || val != "a" {
+		t.Errorf("Unexpected PopFirst: %s %s %v", key, val, ok)
+	}
+	if _, _, ok, _ := engine.PopFirst([]string{"jobs"}, ListRight); ok {
+		t.Error("PopFirst on empty lists should fail")
+	}
+}
+
+func TestEngine_List_WrongType(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_ = engine.Set("str", "1")
+	_, _ = engine.RPush("list", "a")
+
+	if _, err := engine.LPush("str", "x"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from LPush on string, got %v", err)
+	}
+	if _, err := engine.IncrBy("list", 1); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from IncrBy on list, got %v", err)
+	}
+
+	// A bad destination leaves the source alone
+	if _, _, err := engine.LMove("list", "str", ListLeft, ListLeft); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from LMove, got %v", err)
+	}
+	if n, _ := engine.LLen("list"); n != 1 {
+		t.Errorf("Expected source to keep its element, got length %d", n)
+	}
+}
+
+func TestEngine_List_Recovery(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_, _ = engine1.RPush("snap", "a", "b", "c", "d")
+	engine1.Expire("snap", time.Hour)
+	if err := engine1.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	// Element-level changes after the snapshot come from the WAL
+	_, _ = engine1.LPush("snap", "x|y")
+	_, _ = engine1.RPop("snap", 1)
+	_ = engine1.LTrim("snap", 0, 2)
+	_, _ = engine1.RPush("wal", "1", "2", "1", "3", "1")
+	_, _ = engine1.LRem("wal", -2, "1")
+	_, _, _ = engine1.LMove("wal", "moved", ListRight, ListLeft)
+	_, _ = engine1.RPush("gone", "v")
+	_, _ = engine1.LPop("gone", 1)
+	version := engine1.Version("snap")
+	engine1.Close()
+
+	engine2, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if all, _ := engine2.LRange("snap", 0, -1); !reflect.DeepEqual(all, []string{"x|y", "a", "b"}) {
+		t.Errorf("Unexpected recovered list: %v", all)
+	}
+	if ttl := engine2.TTL("snap"); ttl <= 0 {
+		t.Error("Expected list TTL to survive recovery")
+	}
+	if v := engine2.Version("snap"); v != version {
+		t.Errorf("Expected version %d after recovery, got %d", version, v)
+	}
+	if all, _ := engine2.LRange("wal", 0, -1); !reflect.DeepEqual(all, []string{"1", "2"}) {
+		t.Errorf("Unexpected recovered list: %v", all)
+	}
+	if all, _ := engine2.LRange("moved", 0, -1); !reflect.DeepEqual(all, []string{"3"}) {
+		t.Errorf("Unexpected recovered list: %v", all)
+	}
+	if engine2.Exists("gone") {
+		t.Error("List emptied by LPop should not be recovered")
+	}
+}
+
+func TestEngine_List_RecoveryAfterExpiry(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// The server stops before the TTL passes, so no DELETE is logged
+	engine1, err := New(Options{WALPath: tmpDir, TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_, _ = engine1.RPush("l", "a", "b")
+	engine1.Expire("l", 50*time.Millisecond)
+	_, _ = engine1.RPush("l", "c")
+	_, _ = engine1.LPush("l", "z")
+	engine1.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Replaying the later pushes must not bring the list back without its
+	// TTL
+	engine2, err := New(Options{WALPath: tmpDir, TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if engine2.Exists("l") {
+		items, _ := engine2.LRange("l", 0, -1)
+		t.Errorf("Expected the expired list to stay expired, got %v with TTL %v", items, engine2.TTL("l"))
+	}
+}
@@ -0,0 +1,160 @@
+// internal/engine/quota.go
+package engine
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lofoneh/kvlite/internal/config"
+	"github.com/lofoneh/kvlite/internal/store"
+)
+
+// ErrQuotaExceeded is returned for an operation that would take a database
+// over one of its quota limits
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quota limits the usage of one logical database. Zero fields mean no
+// limit.
+type Quota = config.Quota
+
+// QuotaUsage is the current usage of a database, to compare with its Quota
+type QuotaUsage struct {
+	Keys      int   // Number of keys
+	Bytes     int64 // Approximate memory used by keys and values
+	OpsPerSec int   // Operations started in the current second
+}
+
+// Quotas are enforced per database:
+//   - MaxOpsPerSec counts every call to Atomic, so every engine operation
+//     that may write; reads run through View or the plain string reads and
+//     are not counted. A MULTI/EXEC counts once.
+//   - MaxKeys and MaxBytes are checked by the writes that may add data,
+//     before they change anything: a new key must fit in MaxKeys, and the
+//     estimated size of the data written, less the size of any value it
+//     replaces, must fit in MaxBytes. Operations that don't grow the
+//     database are always allowed, so a database over its quota can be
+//     brought back under it.
+
+// quota holds the limits of a database and counts its operations
+type quota struct {
+	mu     sync.Mutex
+	limits Quota
+	second int64 // Unix second ops is counted for
+	ops    int   // Operations started during second
+}
+
+// allow counts an operation, failing if the database has already started
+// MaxOpsPerSec operations this second
+func (q *quota) allow() error {
+	now := time.Now().Unix()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if now != q.second {
+		q.second, q.ops = now, 0
+	}
+	if q.limits.MaxOpsPerSec > 0 && q.ops >= q.limits.MaxOpsPerSec {
+		return ErrQuotaExceeded
+	}
+	q.ops++
+	return nil
+}
+
+// get returns the limits and the number of operations in the current
+// second
+func (q *quota) get() (Quota, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ops := q.ops
+	if q.second != time.Now().Unix() {
+		ops = 0
+	}
+	return q.limits, ops
+}
+
+// SetQuota replaces the limits of the database. A zero Quota removes them.
+func (e *Engine) SetQuota(limits Quota) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	e.quota.mu.Lock()
+	defer e.quota.mu.Unlock()
+	e.quota.limits = limits
+	return nil
+}
+
+// Quota returns the limits of the database
+func (e *Engine) Quota() Quota {
+	limits, _ := e.quota.get()
+	return limits
+}
+
+// Quotas returns the limits of every database that has some, by number
+func (e *Engine) Quotas() map[int]Quota {
+	quotas := make(map[int]Quota)
+	for n, db := range e.dbs {
+		if limits := db.Quota(); !limits.IsZero() {
+			quotas[n] = limits
+		}
+	}
+	return quotas
+}
+
+// QuotaUsage returns the current usage of the database
+func (e *Engine) QuotaUsage() QuotaUsage {
+	_, ops := e.quota.get()
+	return QuotaUsage{
+		Keys:      e.store.Len(),
+		Bytes:     e.store.Bytes(),
+		OpsPerSec: ops,
+	}
+}
+
+// reserve checks that adding about size bytes to the value stored at key,
+// creating it if missing, fits in the quota of the database
+func (tx *Tx) reserve(key string, size int64) error {
+	limits, _ := tx.e.quota.get()
+	if limits.MaxKeys == 0 && limits.MaxBytes == 0 {
+		return nil
+	}
+	if tx.Exists(key) {
+		return tx.check(limits, false, size)
+	}
+	return tx.check(limits, true, tx.txn.Growth(key, size))
+}
+
+// reserveValue checks that replacing the value stored at key, if any, by
+// one of about size bytes fits in the quota of the database
+func (tx *Tx) reserveValue(key string, size int64) error {
+	limits, _ := tx.e.quota.get()
+	if limits.MaxKeys == 0 && limits.MaxBytes == 0 {
+		return nil
+	}
+	return tx.check(limits, !tx.Exists(key), tx.txn.Growth(key, size))
+}
+
+// elementsSize estimates the memory used by values added as elements of a
+// collection
+func elementsSize(values []string) int64 {
+	var size int64
+	for _, value := range values {
+		size += store.ElementSize(value)
+	}
+	return size
+}
+
+// check fails if a write adding grown bytes, and a key if newKey is set,
+// would take the database over its limits. Writes that don't grow it are
+// always allowed.
+func (tx *Tx) check(limits Quota, newKey bool, grown int64) error {
+	keys, bytes := tx.txn.Usage()
+	if limits.MaxBytes > 0 && grown > 0 && bytes+grown > limits.MaxBytes {
+		return ErrQuotaExceeded
+	}
+	// Usage counts expired keys that haven't been removed yet, so only
+	// count the live ones when that makes a difference
+	if limits.MaxKeys > 0 && newKey && keys >= limits.MaxKeys && tx.txn.Len() >= limits.MaxKeys {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// internal/engine/quota_test.go
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEngine_QuotaKeys(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir(), Databases: 2})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if err := engine.SetQuota(Quota{MaxKeys: 3}); err != nil {
+		t.Fatalf("SetQuota failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := engine.Set(fmt.Sprintf("k%d", i), "v"); err != nil {
+			t.Fatalf("Set %d failed: %v", i, err)
+		}
+	}
+
+	// New keys are rejected, whatever their type, existing ones can change
+	if err := engine.Set("k3", "v"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded, got %v", err)
+	}
+	if _, err := engine.HSet("h", map[string]string{"f": "v"}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded for HSET, got %v", err)
+	}
+	if err := engine.Set("k0", "updated"); err != nil {
+		t.Errorf("Updating an existing key failed: %v", err)
+	}
+	if engine.Len() != 3 {
+		t.Errorf("Expected 3 keys, got %d", engine.Len())
+	}
+
+	// Renaming doesn't add a key
+	if _, err := engine.Rename("k2", "renamed", false); err != nil {
+		t.Errorf("Rename in a full database failed: %v", err)
+	}
+	if _, err := engine.Rename("renamed", "k2", false); err != nil {
+		t.Errorf("Rename back failed: %v", err)
+	}
+
+	// Other databases have their own quota
+	db1, _ := engine.DB(1)
+	if err := db1.Set("k3", "v"); err != nil {
+		t.Errorf("Set in another database failed: %v", err)
+	}
+	if _, err := db1.Move("k3", 0); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded moving into a full database, got %v", err)
+	}
+
+	// Deleting makes room
+	if _, err := engine.Delete("k1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := engine.Set("k3", "v"); err != nil {
+		t.Errorf("Set after delete failed: %v", err)
+	}
+
+	// Expired keys don't count
+	_, _ = engine.Delete("k3")
+	_ = engine.SetWithTTL("short", "v", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if err := engine.Set("k3", "v"); err != nil {
+		t.Errorf("Expired key counted against the quota: %v", err)
+	}
+}
+
+func TestEngine_QuotaBytes(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_ = engine.SetQuota(Quota{MaxBytes: 1024})
+
+	// The size of the value counts, not only the usage before the write
+	if err := engine.Set("huge", strings.Repeat("x", 5<<20)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded for a 5MB value, got %v", err)
+	}
+	big := strings.Repeat("x", 600)
+	if err := engine.Set("a", big); err != nil {
+		t.Fatalf("Set under the limit failed: %v", err)
+	}
+	if err := engine.Set("b", big); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded, got %v", err)
+	}
+	if usage := engine.QuotaUsage(); usage.Bytes < 600 || usage.Keys != 1 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+
+	// Only the growth of a replaced value counts
+	if err := engine.Set("a", strings.Repeat("y", 900)); err != nil {
+		t.Errorf("Replacing a value under the limit failed: %v", err)
+	}
+	if _, err := engine.Append("a", big); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded for APPEND, got %v", err)
+	}
+
+	// Writes that add data fail, removals work
+	if _, err := engine.RPush("list", big); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded, got %v", err)
+	}
+	if _, err := engine.Delete("a"); err != nil {
+		t.Errorf("Delete over quota failed: %v", err)
+	}
+	if _, err := engine.RPush("list", big); err != nil {
+		t.Errorf("RPUSH under quota failed: %v", err)
+	}
+}
+
+func TestEngine_QuotaOpsPerSec(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir(), Quotas: map[int]Quota{0: {MaxOpsPerSec: 5}}})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	// Stay within one second so the window doesn't reset
+	for time.Now().Nanosecond() > 800*int(time.Millisecond) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	var rejected int
+	for i := 0; i < 10; i++ {
+		if err := engine.Set("k", "v"); errors.Is(err, ErrQuotaExceeded) {
+			rejected++
+		}
+	}
+	if rejected != 5 {
+		t.Errorf("Expected 5 rejected operations, got %d", rejected)
+	}
+	if usage := engine.QuotaUsage(); usage.OpsPerSec != 5 {
+		t.Errorf("Expected 5 ops in the current second, got %d", usage.OpsPerSec)
+	}
+
+	// Reads don't count against the quota
+	if _, _, ok, err := engine.GetWithVersion("k"); !ok || err != nil {
+		t.Errorf("Expected GetWithVersion over the quota to succeed, got %v, %v", ok, err)
+	}
+	if _, ok := engine.Get("k"); !ok {
+		t.Error("Expected Get over the quota to succeed")
+	}
+	if _, _, err := engine.HGet("h", "f"); err != nil {
+		t.Errorf("Expected HGet over the quota to succeed, got %v", err)
+	}
+	if _, err := engine.LRange("l", 0, -1); err != nil {
+		t.Errorf("Expected LRange over the quota to succeed, got %v", err)
+	}
+	if usage := engine.QuotaUsage(); usage.OpsPerSec != 5 {
+		t.Errorf("Expected reads not to be counted, got %d ops", usage.OpsPerSec)
+	}
+
+	if got := engine.Quotas(); len(got) != 1 || got[0].MaxOpsPerSec != 5 {
+		t.Errorf("Unexpected quotas: %v", got)
+	}
+	if err := engine.SetQuota(Quota{MaxKeys: -1}); err == nil {
+		t.Error("Expected error for a negative limit")
+	}
+	if _, err := New(Options{WALPath: t.TempDir(), Quotas: map[int]Quota{99: {MaxKeys: 1}}}); err == nil {
+		t.Error("Expected error for a quota on a missing database")
+	}
+}
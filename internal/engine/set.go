@@ -0,0 +1,436 @@
+// internal/engine/set.go
+package engine
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/lofoneh/kvlite/internal/store"
+	"github.com/lofoneh/kvlite/internal/wal"
+)
+
+// SAdd adds members to the set stored at key, creating it if needed.
+// Returns the number of members that were added (not already present).
+func (e *Engine) SAdd(key string, members ...string) (int, error) {
+	var added int
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		added, err = tx.SAdd(key, members...)
+		return err
+	})
+	return added, err
+}
+
+// SRem removes members from the set stored at key and returns how many
+// existed. The key is removed together with its last member.
+func (e *Engine) SRem(key string, members ...string) (int, error) {
+	var removed int
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		removed, err = tx.SRem(key, members...)
+		return err
+	})
+	return removed, err
+}
+
+// SIsMember reports whether member is in the set stored at key
+func (e *Engine) SIsMember(key, member string) (bool, error) {
+	var ok bool
+	err := e.View(func(tx *Tx) error {
+		var err error
+		ok, err = tx.SIsMember(key, member)
+		return err
+	})
+	return ok, err
+}
+
+// SMIsMember reports, for each member, whether it is in the set stored at key
+func (e *Engine) SMIsMember(key string, members []string) ([]bool, error) {
+	var found []bool
+	err := e.View(func(tx *Tx) error {
+		var err error
+		found, err = tx.SMIsMember(key, members)
+		return err
+	})
+	return found, err
+}
+
+// SMembers returns the members of the set stored at key, sorted
+func (e *Engine) SMembers(key string) ([]string, error) {
+	var members []string
+	err := e.View(func(tx *Tx) error {
+		var err error
+		members, err = tx.SMembers(key)
+		return err
+	})
+	return members, err
+}
+
+// SCard returns the number of members of the set stored at key
+func (e *Engine) SCard(key string) (int, error) {
+	var n int
+	err := e.View(func(tx *Tx) error {
+		var err error
+		n, err = tx.SCard(key)
+		return err
+	})
+	return n, err
+}
+
+// SPop removes and returns up to count random members of the set stored
+// at key
+func (e *Engine) SPop(key string, count int) ([]string, error) {
+	var members []string
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		members, err = tx.SPop(key, count)
+		return err
+	})
+	return members, err
+}
+
+// SRandMember returns random members of the set stored at key without
+// removing them: up to count distinct members if count is positive, or
+// exactly -count members, possibly repeated, if it is negative
+func (e *Engine) SRandMember(key string, count int) ([]string, error) {
+	var members []string
+	err := e.View(func(tx *Tx) error {
+		var err error
+		members, err = tx.SRandMember(key, count)
+		return err
+	})
+	return members, err
+}
+
+// SInter returns the members present in all of the sets stored at keys,
+// sorted. Missing keys count as empty sets.
+func (e *Engine) SInter(keys ...string) ([]string, error) {
+	return e.combine((*Tx).SInter, keys)
+}
+
+// SUnion returns the members present in any of the sets stored at keys,
+// sorted
+func (e *Engine) SUnion(keys ...string) ([]string, error) {
+	return e.combine((*Tx).SUnion, keys)
+}
+
+// SDiff returns the members of the first set that are in none of the
+// others, sorted
+func (e *Engine) SDiff(keys ...string) ([]string, error) {
+	return e.combine((*Tx).SDiff, keys)
+}
+
+// SInterStore stores the intersection of the sets at keys in dst,
+// replacing it, and returns its size. An empty result deletes dst.
+func (e *Engine) SInterStore(dst string, keys ...string) (int, error) {
+	return e.combineStore((*Tx).SInterStore, dst, keys)
+}
+
+// SUnionStore stores the union of the sets at keys in dst and returns its
+// size
+func (e *Engine) SUnionStore(dst string, keys ...string) (int, error) {
+	return e.combineStore((*Tx).SUnionStore, dst, keys)
+}
+
+// SDiffStore stores the difference of the sets at keys in dst and returns
+// its size
+func (e *Engine) SDiffStore(dst string, keys ...string) (int, error) {
+	return e.combineStore((*Tx).SDiffStore, dst, keys)
+}
+
+// SScan returns members of the set stored at key with pagination. The next
+// cursor is 0 when the scan is done.
+func (e *Engine) SScan(key string, cursor int, pattern string, count int) (int, []string, error) {
+	var next int
+	var members []string
+	err := e.View(func(tx *Tx) error {
+		var err error
+		next, members, err = tx.SScan(key, cursor, pattern, count)
+		return err
+	})
+	return next, members, err
+}
+
+// combine runs SInter, SUnion or SDiff in a transaction
+func (e *Engine) combine(op func(*Tx, ...string) ([]string, error), keys []string) ([]string, error) {
+	var members []string
+	err := e.View(func(tx *Tx) error {
+		var err error
+		members, err = op(tx, keys...)
+		return err
+	})
+	return members, err
+}
+
+// combineStore runs one of the STORE variants in a transaction
+func (e *Engine) combineStore(op func(*Tx, string, ...string) (int, error), dst string, keys []string) (int, error) {
+	var n int
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		n, err = op(tx, dst, keys...)
+		return err
+	})
+	return n, err
+}
+
+// SAdd adds members to the set stored at key
+func (tx *Tx) SAdd(key string, members ...string) (int, error) {
+	if err := tx.reserve(key, elementsSize(members)); err != nil {
+		return 0, err
+	}
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(key)
+		tx.e.trackRequestRate()
+	}
+
+	added := 0
+	for _, member := range members {
+		ok, err := tx.txn.SAdd(key, member)
+		if err != nil {
+			return added, err
+		}
+		if ok {
+			tx.log(wal.OpSAdd, key, member, wal.WithVersion(tx.txn.Version(key)))
+			added++
+		}
+	}
+	return added, nil
+}
+
+// SRem removes members from the set stored at key
+func (tx *Tx) SRem(key string, members ...string) (int, error) {
+	removed := 0
+	for _, member := range members {
+		ok, err := tx.txn.SRem(key, member)
+		if err != nil {
+			return removed, err
+		}
+		if ok {
+			tx.log(wal.OpSRem, key, member, wal.WithVersion(tx.txn.LastVersion()))
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// SIsMember reports whether member is in the set stored at key
+func (tx *Tx) SIsMember(key, member string) (bool, error) {
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordRead(key)
+		tx.e.trackRequestRate()
+	}
+	return tx.txn.SIsMember(key, member)
+}
+
+// SMIsMember reports, for each member, whether it is in the set at key
+func (tx *Tx) SMIsMember(key string, members []string) ([]bool, error) {
+	found := make([]bool, len(members))
+	for i, member := range members {
+		ok, err := tx.txn.SIsMember(key, member)
+		if err != nil {
+			return nil, err
+		}
+		found[i] = ok
+	}
+	return found, nil
+}
+
+// SMembers returns the members of the set stored at key, sorted
+func (tx *Tx) SMembers(key string) ([]string, error) {
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordRead(key)
+		tx.e.trackRequestRate()
+	}
+	return tx.txn.SMembers(key)
+}
+
+// SCard returns the number of members of the set stored at key
+func (tx *Tx) SCard(key string) (int, error) {
+	return tx.txn.SCard(key)
+}
+
+// SPop removes and returns up to count random members of a set
+func (tx *Tx) SPop(key string, count int) ([]string, error) {
+	members, err := tx.txn.SMembers(key)
+	if err != nil || len(members) == 0 {
+		return nil, err
+	}
+
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	if count < len(members) {
+		members = members[:count]
+	}
+	if _, err := tx.SRem(key, members...); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// SRandMember returns random members of a set without removing them
+func (tx *Tx) SRandMember(key string, count int) ([]string, error) {
+	members, err := tx.SMembers(key)
+	if err != nil || len(members) == 0 {
+		return nil, err
+	}
+
+	if count < 0 {
+		picked := make([]string, -count)
+		for i := range picked {
+			picked[i] = members[rand.Intn(len(members))]
+		}
+		return picked, nil
+	}
+
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	if count < len(members) {
+		members = members[:count]
+	}
+	return members, nil
+}
+
+// sets loads the members of the sets stored at keys
+func (tx *Tx) sets(keys []string) ([]map[string]struct{}, error) {
+	sets := make([]map[string]struct{}, len(keys))
+	for i, key := range keys {
+		members, err := tx.txn.SMembers(key)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = make(map[string]struct{}, len(members))
+		for _, m := range members {
+			sets[i][m] = struct{}{}
+		}
+	}
+	return sets, nil
+}
+
+// SInter returns the members present in all of the sets stored at keys
+func (tx *Tx) SInter(keys ...string) ([]string, error) {
+	sets, err := tx.sets(keys)
+	if err != nil || len(sets) == 0 {
+		return nil, err
+	}
+
+	var result []string
+	for m := range sets[0] {
+		inAll := true
+		for _, other := range sets[1:] {
+			if _, ok := other[m]; !ok {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			result = append(result, m)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// SUnion returns the members present in any of the sets stored at keys
+func (tx *Tx) SUnion(keys ...string) ([]string, error) {
+	sets, err := tx.sets(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	union := make(map[string]struct{})
+	for _, set := range sets {
+		for m := range set {
+			union[m] = struct{}{}
+		}
+	}
+	result := make([]string, 0, len(union))
+	for m := range union {
+		result = append(result, m)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// SDiff returns the members of the first set that are in none of the others
+func (tx *Tx) SDiff(keys ...string) ([]string, error) {
+	sets, err := tx.sets(keys)
+	if err != nil || len(sets) == 0 {
+		return nil, err
+	}
+
+	var result []string
+	for m := range sets[0] {
+		inOther := false
+		for _, other := range sets[1:] {
+			if _, ok := other[m]; ok {
+				inOther = true
+				break
+			}
+		}
+		if !inOther {
+			result = append(result, m)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// SInterStore stores the intersection of the sets at keys in dst
+func (tx *Tx) SInterStore(dst string, keys ...string) (int, error) {
+	members, err := tx.SInter(keys...)
+	if err != nil {
+		return 0, err
+	}
+	return tx.storeSet(dst, members)
+}
+
+// SUnionStore stores the union of the sets at keys in dst
+func (tx *Tx) SUnionStore(dst string, keys ...string) (int, error) {
+	members, err := tx.SUnion(keys...)
+	if err != nil {
+		return 0, err
+	}
+	return tx.storeSet(dst, members)
+}
+
+// SDiffStore stores the difference of the sets at keys in dst
+func (tx *Tx) SDiffStore(dst string, keys ...string) (int, error) {
+	members, err := tx.SDiff(keys...)
+	if err != nil {
+		return 0, err
+	}
+	return tx.storeSet(dst, members)
+}
+
+// storeSet replaces dst, whatever its type, with a set of members, logged
+// as a single SET record. An empty set deletes dst.
+func (tx *Tx) storeSet(dst string, members []string) (int, error) {
+	if len(members) == 0 {
+		if _, err := tx.Delete(dst); err != nil {
+			return 0, err
+		}
+		return 0, nil
+	}
+
+	entry := store.NewSetEntry()
+	for _, m := range members {
+		entry.Set[m] = struct{}{}
+	}
+	if err := tx.reserveValue(dst, entry.MemoryUsage()); err != nil {
+		return 0, err
+	}
+
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(dst)
+		tx.e.trackRequestRate()
+	}
+	tx.put(dst, entry)
+	return len(members), nil
+}
+
+// SScan returns members of the set stored at key with pagination
+func (tx *Tx) SScan(key string, cursor int, pattern string, count int) (int, []string, error) {
+	return tx.txn.SScan(key, cursor, pattern, count)
+}
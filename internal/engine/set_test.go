@@ -0,0 +1,237 @@
+// internal/engine/set_test.go
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEngine_Set(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if added, err := engine.SAdd("a", "x", "y", "z", "x"); err != nil || added != 3 {
+		t.Fatalf("SAdd: %d, %v", added, err)
+	}
+	_, _ = engine.SAdd("b", "y", "z", "w")
+
+	if ok, _ := engine.SIsMember("a", "x"); !ok {
+		t.Error("Expected x to be a member")
+	}
+	if found, _ := engine.SMIsMember("a", []string{"x", "w"}); !reflect.DeepEqual(found, []bool{true, false}) {
+		t.Errorf("Unexpected SMIsMember: %v", found)
+	}
+	if n, _ := engine.SCard("a"); n != 3 {
+		t.Errorf("Expected 3 members, got %d", n)
+	}
+
+	if inter, _ := engine.SInter("a", "b"); !reflect.DeepEqual(inter, []string{"y", "z"}) {
+		t.Errorf("Unexpected SInter: %v", inter)
+	}
+	if union, _ := engine.SUnion("a", "b", "missing"); !reflect.DeepEqual(union, []string{"w", "x", "y", "z"}) {
+		t.Errorf("Unexpected SUnion: %v", union)
+	}
+	if diff, _ := engine.SDiff("a", "b"); !reflect.DeepEqual(diff, []string{"x"}) {
+		t.Errorf("Unexpected SDiff: %v", diff)
+	}
+	if inter, _ := engine.SInter("a", "missing"); len(inter) != 0 {
+		t.Errorf("Intersection with a missing key should be empty, got %v", inter)
+	}
+
+	// STORE replaces the destination, whatever it held, and drops its TTL
+	_ = engine.SetWithTTL("dst", "string", time.Hour)
+	if n, err := engine.SUnionStore("dst", "a", "b"); err != nil || n != 4 {
+		t.Errorf("SUnionStore: %d, %v", n, err)
+	}
+	if members, _ := engine.SMembers("dst"); len(members) != 4 {
+		t.Errorf("Unexpected stored set: %v", members)
+	}
+	if ttl := engine.TTL("dst"); ttl != 0 {
+		t.Errorf("Expected stored set to have no TTL, got %v", ttl)
+	}
+	if n, _ := engine.SInterStore("dst", "a", "missing"); n != 0 || engine.Exists("dst") {
+		t.Error("Empty result should delete the destination")
+	}
+
+	if n, _ := engine.SRem("a", "x", "missing"); n != 1 {
+		t.Errorf("Expected 1 removed, got %d", n)
+	}
+}
+
+func TestEngine_Set_Random(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_, _ = engine.SAdd("s", "a", "b", "c")
+
+	if members, _ := engine.SRandMember("s", 10); len(members) != 3 {
+		t.Errorf("Expected all 3 distinct members, got %v", members)
+	}
+	if members, _ := engine.SRandMember("s", -5); len(members) != 5 {
+		t.Errorf("Expected 5 members with repeats, got %v", members)
+	}
+
+	popped, _ := engine.SPop("s", 2)
+	if len(popped) != 2 {
+		t.Fatalf("Expected 2 popped members, got %v", popped)
+	}
+	for _, m := range popped {
+		if ok, _ := engine.SIsMember("s", m); ok {
+			t.Errorf("Popped member %s is still in the set", m)
+		}
+	}
+	_, _ = engine.SPop("s", 5)
+	if engine.Exists("s") {
+		t.Error("Expected set to be removed with its last member")
+	}
+	if popped, _ := engine.SPop("s", 1); popped != nil {
+		t.Errorf("Expected nil from missing set, got %v", popped)
+	}
+}
+
+func TestEngine_Set_WrongType(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_ = engine.Set("str", "1")
+	_, _ = engine.SAdd("set", "a")
+
+	if _, err := engine.SAdd("str", "x"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from SAdd on string, got %v", err)
+	}
+	if _, err := engine.SUnion("set", "str"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from SUnion, got %v", err)
+	}
+	if _, err := engine.HSet("set", map[string]string{"f": "v"}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from HSet on set, got %v", err)
+	}
+}
+
+func TestEngine_Set_Recovery(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_, _ = engine1.SAdd("snap", "a", "b")
+	engine1.Expire("snap", time.Hour)
+	if err := engine1.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	// Member-level changes after the snapshot come from the WAL
+	_, _ = engine1.SAdd("snap", "c|d")
+	_, _ = engine1.SRem("snap", "a")
+	_, _ = engine1.SAdd("other", "b", "e")
+	_, _ = engine1.SInterStore("stored", "snap", "other")
+	_, _ = engine1.SAdd("gone", "v")
+	_, _ = engine1.SPop("gone", 1)
+	version := engine1.Version("snap")
+	engine1.Close()
+
+	engine2, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if members, _ := engine2.SMembers("snap"); !reflect.DeepEqual(members, []string{"b", "c|d"}) {
+		t.Errorf("Unexpected recovered set: %v", members)
+	}
+	if ttl := engine2.TTL("snap"); ttl <= 0 {
+		t.Error("Expected set TTL to survive recovery")
+	}
+	if v := engine2.Version("snap"); v != version {
+		t.Errorf("Expected version %d after recovery, got %d", version, v)
+	}
+	if members, _ := engine2.SMembers("stored"); !reflect.DeepEqual(members, []string{"b"}) {
+		t.Errorf("Unexpected recovered set: %v", members)
+	}
+	if engine2.Exists("gone") {
+		t.Error("Set emptied by SPop should not be recovered")
+	}
+}
+
+func TestEngine_SetStore_RecoveryLargeResults(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	// The destinations are logged as whole sets, well over 64KB here
+	var odd, even []string
+	for i := 0; i < 10000; i++ {
+		member := "member:" + strconv.Itoa(i) + `\n`
+		if i%2 == 0 {
+			even = append(even, member)
+		} else {
+			odd = append(odd, member)
+		}
+	}
+	_, _ = engine1.SAdd("odd", odd...)
+	_, _ = engine1.SAdd("even", even...)
+	_, _ = engine1.SUnionStore("union", "odd", "even")
+	_, _ = engine1.SDiffStore("diff", "union", "even")
+	_, _ = engine1.SInterStore("inter", "union", "odd")
+	engine1.Close()
+
+	engine2, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	defer engine2.Close()
+
+	want := map[string]int{"union": 10000, "diff": 5000, "inter": 5000}
+	for key, n := range want {
+		if got, _ := engine2.SCard(key); got != n {
+			t.Errorf("%s: expected %d members after recovery, got %d", key, n, got)
+		}
+	}
+	if ok, _ := engine2.SIsMember("diff", odd[0]); !ok {
+		t.Errorf("Expected %q to survive recovery", odd[0])
+	}
+}
+
+func TestEngine_Set_RecoveryAfterExpiry(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// The server stops before the TTL passes, so no DELETE is logged
+	engine1, err := New(Options{WALPath: tmpDir, TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_, _ = engine1.SAdd("s", "a", "b")
+	engine1.Expire("s", 50*time.Millisecond)
+	_, _ = engine1.SAdd("s", "c")
+	_, _ = engine1.SRem("s", "a")
+	engine1.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Replaying the later members must not bring the set back without its
+	// TTL
+	engine2, err := New(Options{WALPath: tmpDir, TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if engine2.Exists("s") {
+		members, _ := engine2.SMembers("s")
+		t.Errorf("Expected the expired set to stay expired, got %v with TTL %v", members, engine2.TTL("s"))
+	}
+}
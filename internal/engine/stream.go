@@ -0,0 +1,768 @@
+// internal/engine/stream.go
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lofoneh/kvlite/internal/store"
+	"github.com/lofoneh/kvlite/internal/wal"
+)
+
+// StreamID identifies a stream entry, see store.StreamID
+type StreamID = store.StreamID
+
+// StreamEntry is an entry of a stream, see store.StreamEntry
+type StreamEntry = store.StreamEntry
+
+// MaxStreamID is the greatest possible stream ID
+var MaxStreamID = store.MaxStreamID
+
+// ParseStreamID parses "ms-seq". A missing sequence number is 0.
+func ParseStreamID(s string) (StreamID, error) {
+	return store.ParseStreamID(s)
+}
+
+var (
+	// ErrInvalidStreamID is returned for a malformed stream ID
+	ErrInvalidStreamID = errors.New("invalid stream ID")
+	// ErrStreamIDTooSmall is returned when XAdd is given an ID that isn't
+	// greater than the last one in the stream
+	ErrStreamIDTooSmall = errors.New("the ID specified in XADD is equal or smaller than the target stream top item")
+	// ErrStreamIDZero is returned when XAdd is given the ID 0-0
+	ErrStreamIDZero = errors.New("the ID specified in XADD must be greater than 0-0")
+	// ErrNoGroup is returned when a stream or consumer group doesn't exist
+	ErrNoGroup = errors.New("NOGROUP no such key or consumer group")
+	// ErrGroupExists is returned when creating a consumer group twice
+	ErrGroupExists = errors.New("BUSYGROUP consumer group name already exists")
+	// ErrNoStream is returned when creating a group on a missing stream
+	// without MkStream
+	ErrNoStream = errors.New("the key must exist, use MKSTREAM to create an empty stream")
+)
+
+// XTrimStrategy selects how XTrim decides which entries to remove
+type XTrimStrategy int
+
+const (
+	TrimNone   XTrimStrategy = iota // Don't trim
+	TrimMaxLen                      // Keep at most MaxLen entries
+	TrimMinID                       // Remove entries with IDs below MinID
+)
+
+// XTrimOptions controls how a stream is trimmed
+type XTrimOptions struct {
+	Strategy XTrimStrategy
+	MaxLen   int
+	MinID    StreamID
+}
+
+// XAddOptions controls XAdd
+type XAddOptions struct {
+	NoMkStream bool         // Don't create the stream if it doesn't exist
+	Trim       XTrimOptions // Trim the stream after adding
+}
+
+// StreamRead is a position to read a stream from
+type StreamRead struct {
+	Key   string
+	After StreamID // Return entries with greater IDs
+	New   bool     // For XReadGroup: entries never delivered to the group, ignoring After
+}
+
+// StreamResult holds the entries read from one stream
+type StreamResult struct {
+	Key     string
+	Entries []StreamEntry
+}
+
+// PendingSummary describes the pending entries of a consumer group
+type PendingSummary struct {
+	Count     int
+	Min, Max  StreamID
+	Consumers []PendingConsumer // Sorted by name
+}
+
+// PendingConsumer is the number of pending entries of one consumer
+type PendingConsumer struct {
+	Name  string
+	Count int
+}
+
+// PendingInfo describes one pending entry
+type PendingInfo struct {
+	ID         StreamID
+	Consumer   string
+	Idle       time.Duration // Time since the last delivery
+	Deliveries int
+}
+
+// XAdd appends an entry with the given fields to the stream stored at key
+// and returns its ID. id is "*" to generate it from the clock, "ms-*" to
+// generate only the sequence number, or an explicit ID greater than the
+// last one. Returns false if the stream doesn't exist and opts.NoMkStream
+// is set.
+func (e *Engine) XAdd(key, id string, fields []string, opts XAddOptions) (StreamID, bool, error) {
+	var added StreamID
+	var ok bool
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		added, ok, err = tx.XAdd(key, id, fields, opts)
+		return err
+	})
+	return added, ok, err
+}
+
+// XTrim trims the stream stored at key and returns the number of entries
+// removed
+func (e *Engine) XTrim(key string, opts XTrimOptions) (int, error) {
+	var n int
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		n, err = tx.XTrim(key, opts)
+		return err
+	})
+	return n, err
+}
+
+// XLen returns the number of entries of the stream stored at key
+func (e *Engine) XLen(key string) (int, error) {
+	var n int
+	err := e.View(func(tx *Tx) error {
+		var err error
+		n, err = tx.XLen(key)
+		return err
+	})
+	return n, err
+}
+
+// XLastID returns the greatest ID ever added to the stream stored at key,
+// 0-0 if it doesn't exist
+func (e *Engine) XLastID(key string) (StreamID, error) {
+	var id StreamID
+	err := e.View(func(tx *Tx) error {
+		var err error
+		id, err = tx.XLastID(key)
+		return err
+	})
+	return id, err
+}
+
+// XRange returns up to count entries with IDs between start and end
+// inclusive, in descending order with rev. A count of 0 returns them all.
+func (e *Engine) XRange(key string, start, end StreamID, rev bool, count int) ([]StreamEntry, error) {
+	var entries []StreamEntry
+	err := e.View(func(tx *Tx) error {
+		var err error
+		entries, err = tx.XRange(key, start, end, rev, count)
+		return err
+	})
+	return entries, err
+}
+
+// XRead returns up to count entries after the given position of each
+// stream. Streams without new entries are left out of the result.
+func (e *Engine) XRead(reads []StreamRead, count int) ([]StreamResult, error) {
+	var results []StreamResult
+	err := e.View(func(tx *Tx) error {
+		var err error
+		results, err = tx.XRead(reads, count)
+		return err
+	})
+	return results, err
+}
+
+// XGroupCreate creates a consumer group on the stream stored at key that
+// will deliver the entries after id, or only new entries if id is "$".
+// With mkstream a missing stream is created empty.
+func (e *Engine) XGroupCreate(key, group, id string, mkstream bool) error {
+	return e.Atomic(func(tx *Tx) error {
+		return tx.XGroupCreate(key, group, id, mkstream)
+	})
+}
+
+// XGroupSetID sets the last delivered ID of a consumer group, "$" meaning
+// the last ID of the stream
+func (e *Engine) XGroupSetID(key, group, id string) error {
+	return e.Atomic(func(tx *Tx) error {
+		return tx.XGroupSetID(key, group, id)
+	})
+}
+
+// XGroupDestroy removes a consumer group and its pending entries
+// Returns true if the group existed
+func (e *Engine) XGroupDestroy(key, group string) (bool, error) {
+	var ok bool
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		ok, err = tx.XGroupDestroy(key, group)
+		return err
+	})
+	return ok, err
+}
+
+// XReadGroup reads streams on behalf of a consumer of a group. Reads with
+// New deliver entries never delivered to the group and add them to the
+// consumer's pending entries; the others return the consumer's pending
+// entries after the given ID.
+func (e *Engine) XReadGroup(group, consumer string, reads []StreamRead, count int) ([]StreamResult, error) {
+	var results []StreamResult
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		results, err = tx.XReadGroup(group, consumer, reads, count)
+		return err
+	})
+	return results, err
+}
+
+// XAck acknowledges entries for a consumer group, removing them from its
+// pending entries. Returns the number of entries that were pending.
+func (e *Engine) XAck(key, group string, ids ...StreamID) (int, error) {
+	var n int
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		n, err = tx.XAck(key, group, ids...)
+		return err
+	})
+	return n, err
+}
+
+// XPending summarizes the pending entries of a consumer group
+func (e *Engine) XPending(key, group string) (PendingSummary, error) {
+	var summary PendingSummary
+	err := e.View(func(tx *Tx) error {
+		var err error
+		summary, err = tx.XPending(key, group)
+		return err
+	})
+	return summary, err
+}
+
+// XPendingRange lists up to count pending entries of a consumer group with
+// IDs between start and end, optionally only those of one consumer or idle
+// for at least minIdle
+func (e *Engine) XPendingRange(key, group string, start, end StreamID, count int, consumer string, minIdle time.Duration) ([]PendingInfo, error) {
+	var pending []PendingInfo
+	err := e.View(func(tx *Tx) error {
+		var err error
+		pending, err = tx.XPendingRange(key, group, start, end, count, consumer, minIdle)
+		return err
+	})
+	return pending, err
+}
+
+// XClaim transfers pending entries idle for at least minIdle to consumer
+// and returns them. Entries that were deleted from the stream are dropped
+// from the pending entries instead. With justID the entries are returned
+// without fields and their delivery count is left unchanged.
+func (e *Engine) XClaim(key, group, consumer string, minIdle time.Duration, ids []StreamID, justID bool) ([]StreamEntry, error) {
+	var claimed []StreamEntry
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		claimed, err = tx.XClaim(key, group, consumer, minIdle, ids, justID)
+		return err
+	})
+	return claimed, err
+}
+
+// XAdd appends an entry to the stream stored at key
+func (tx *Tx) XAdd(key, id string, fields []string, opts XAddOptions) (StreamID, bool, error) {
+	// The entry's ID takes 16 bytes
+	if err := tx.reserve(key, store.ElementSize(fields...)+16); err != nil {
+		return StreamID{}, false, err
+	}
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(key)
+		tx.e.trackRequestRate()
+	}
+
+	st, err := tx.txn.Stream(key)
+	if err != nil {
+		return StreamID{}, false, err
+	}
+	if st == nil && opts.NoMkStream {
+		return StreamID{}, false, nil
+	}
+	var last StreamID
+	if st != nil {
+		last = st.LastID()
+	}
+	added, err := nextStreamID(last, id, time.Now().UnixMilli())
+	if err != nil {
+		return StreamID{}, false, err
+	}
+
+	if err := tx.txn.XAdd(key, added, fields); err != nil {
+		return StreamID{}, false, err
+	}
+	data, _ := json.Marshal(fields) // A slice of strings always marshals
+	tx.log(wal.OpXAdd, key, string(data), wal.WithField(added.String()), wal.WithVersion(tx.txn.Version(key)))
+
+	if _, err := tx.XTrim(key, opts.Trim); err != nil {
+		return added, true, err
+	}
+	return added, true, nil
+}
+
+// nextStreamID returns the ID of an entry added after last, as requested
+// by the XADD id argument
+func nextStreamID(last StreamID, id string, nowMs int64) (StreamID, error) {
+	if id == "*" {
+		if now := uint64(nowMs); now > last.Ms {
+			return StreamID{Ms: now}, nil
+		}
+		if last == MaxStreamID {
+			return StreamID{}, ErrStreamIDTooSmall
+		}
+		return last.Next(), nil
+	}
+
+	if msPart, ok := strings.CutSuffix(id, "-*"); ok {
+		ms, err := strconv.ParseUint(msPart, 10, 64)
+		if err != nil {
+			return StreamID{}, ErrInvalidStreamID
+		}
+		switch {
+		case ms < last.Ms, ms == last.Ms && last.Seq == math.MaxUint64:
+			return StreamID{}, ErrStreamIDTooSmall
+		case ms == last.Ms:
+			return StreamID{Ms: ms, Seq: last.Seq + 1}, nil
+		}
+		return StreamID{Ms: ms}, nil
+	}
+
+	next, err := store.ParseStreamID(id)
+	switch {
+	case err != nil:
+		return StreamID{}, ErrInvalidStreamID
+	case next == StreamID{}:
+		return StreamID{}, ErrStreamIDZero
+	case !last.Less(next):
+		return StreamID{}, ErrStreamIDTooSmall
+	}
+	return next, nil
+}
+
+// XTrim trims the stream stored at key
+func (tx *Tx) XTrim(key string, opts XTrimOptions) (int, error) {
+	st, err := tx.txn.Stream(key)
+	if st == nil || err != nil {
+		return 0, err
+	}
+
+	var min StreamID
+	switch opts.Strategy {
+	case TrimMaxLen:
+		if st.Len() <= opts.MaxLen {
+			return 0, nil
+		}
+		if opts.MaxLen <= 0 {
+			min = st.LastID().Next()
+		} else {
+			min = st.At(st.Len() - opts.MaxLen).ID
+		}
+	case TrimMinID:
+		min = opts.MinID
+	default:
+		return 0, nil
+	}
+
+	n, err := tx.txn.XTrim(key, min)
+	if n > 0 {
+		tx.log(wal.OpXTrim, key, min.String(), wal.WithVersion(tx.txn.Version(key)))
+	}
+	return n, err
+}
+
+// XLen returns the number of entries of the stream stored at key
+func (tx *Tx) XLen(key string) (int, error) {
+	st, err := tx.txn.Stream(key)
+	if st == nil || err != nil {
+		return 0, err
+	}
+	return st.Len(), nil
+}
+
+// XLastID returns the greatest ID ever added to the stream stored at key
+func (tx *Tx) XLastID(key string) (StreamID, error) {
+	st, err := tx.txn.Stream(key)
+	if st == nil || err != nil {
+		return StreamID{}, err
+	}
+	return st.LastID(), nil
+}
+
+// XRange returns entries with IDs between start and end
+func (tx *Tx) XRange(key string, start, end StreamID, rev bool, count int) ([]StreamEntry, error) {
+	st, err := tx.streamForRead(key)
+	if st == nil || err != nil {
+		return nil, err
+	}
+	return st.Range(start, end, rev, count), nil
+}
+
+// XRead returns entries after the given position of each stream
+func (tx *Tx) XRead(reads []StreamRead, count int) ([]StreamResult, error) {
+	var results []StreamResult
+	for _, r := range reads {
+		st, err := tx.streamForRead(r.Key)
+		if err != nil {
+			return nil, err
+		}
+		if st == nil {
+			continue
+		}
+		if entries := entriesAfter(st, r.After, count); len(entries) > 0 {
+			results = append(results, StreamResult{Key: r.Key, Entries: entries})
+		}
+	}
+	return results, nil
+}
+
+// entriesAfter returns up to count entries with IDs greater than id
+func entriesAfter(st *store.Stream, id StreamID, count int) []StreamEntry {
+	if id == MaxStreamID {
+		return nil
+	}
+	return st.Range(id.Next(), MaxStreamID, false, count)
+}
+
+// XGroupCreate creates a consumer group
+func (tx *Tx) XGroupCreate(key, group, id string, mkstream bool) error {
+	if err := tx.reserve(key, store.ElementSize(group)); err != nil {
+		return err
+	}
+	st, err := tx.txn.Stream(key)
+	if err != nil {
+		return err
+	}
+	if st == nil && !mkstream {
+		return ErrNoStream
+	}
+	if st != nil {
+		if _, ok := st.Groups[group]; ok {
+			return ErrGroupExists
+		}
+	}
+	lastDelivered, err := groupStartID(st, id)
+	if err != nil {
+		return err
+	}
+	return tx.setGroup(key, group, lastDelivered)
+}
+
+// XGroupSetID sets the last delivered ID of a consumer group
+func (tx *Tx) XGroupSetID(key, group, id string) error {
+	st, _, err := tx.group(key, group)
+	if err != nil {
+		return err
+	}
+	lastDelivered, err := groupStartID(st, id)
+	if err != nil {
+		return err
+	}
+	return tx.setGroup(key, group, lastDelivered)
+}
+
+// groupStartID parses the ID argument of XGROUP, where "$" is the last ID
+// of the stream
+func groupStartID(st *store.Stream, id string) (StreamID, error) {
+	if id == "$" {
+		if st == nil {
+			return StreamID{}, nil
+		}
+		return st.LastID(), nil
+	}
+	parsed, err := store.ParseStreamID(id)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+	return parsed, nil
+}
+
+// setGroup sets the last delivered ID of a group, creating it as needed
+func (tx *Tx) setGroup(key, group string, lastDelivered StreamID) error {
+	if err := tx.txn.XSetGroup(key, group, lastDelivered); err != nil {
+		return err
+	}
+	tx.log(wal.OpXGroup, key, lastDelivered.String(), wal.WithField(group), wal.WithVersion(tx.txn.Version(key)))
+	return nil
+}
+
+// XGroupDestroy removes a consumer group
+func (tx *Tx) XGroupDestroy(key, group string) (bool, error) {
+	ok, err := tx.txn.XDestroyGroup(key, group)
+	if ok {
+		tx.log(wal.OpXGroup, key, "", wal.WithField(group), wal.WithVersion(tx.txn.Version(key)))
+	}
+	return ok, err
+}
+
+// group returns the stream stored at key and one of its consumer groups,
+// failing with ErrNoGroup if either doesn't exist
+func (tx *Tx) group(key, group string) (*store.Stream, *store.ConsumerGroup, error) {
+	st, err := tx.txn.Stream(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if st == nil || st.Groups[group] == nil {
+		return nil, nil, ErrNoGroup
+	}
+	return st, st.Groups[group], nil
+}
+
+// XReadGroup reads streams on behalf of a consumer of a group
+func (tx *Tx) XReadGroup(group, consumer string, reads []StreamRead, count int) ([]StreamResult, error) {
+	// Check every group first since there is no rollback
+	for _, r := range reads {
+		if _, _, err := tx.group(r.Key, group); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	var results []StreamResult
+	for _, r := range reads {
+		if tx.e.enableAnalytics && tx.e.analytics != nil {
+			tx.e.analytics.RecordRead(r.Key)
+			tx.e.trackRequestRate()
+		}
+		st, g, _ := tx.group(r.Key, group)
+
+		var entries []StreamEntry
+		if r.New {
+			entries = entriesAfter(st, g.LastDelivered, count)
+			for _, entry := range entries {
+				pe := store.PendingEntry{Consumer: consumer, DeliveredAt: now, Deliveries: 1}
+				if old, ok := g.Pending[entry.ID]; ok {
+					pe.Deliveries = old.Deliveries + 1
+				}
+				if err := tx.claim(r.Key, group, entry.ID, pe); err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			for _, id := range g.PendingIDs() {
+				if count > 0 && len(entries) == count {
+					break
+				}
+				if !r.After.Less(id) || g.Pending[id].Consumer != consumer {
+					continue
+				}
+				// Entries trimmed from the stream are returned without fields
+				entry, _ := st.Get(id)
+				entry.ID = id
+				entries = append(entries, entry)
+			}
+		}
+		if len(entries) > 0 {
+			results = append(results, StreamResult{Key: r.Key, Entries: entries})
+		}
+	}
+	return results, nil
+}
+
+// claim records the delivery of an entry to a consumer
+func (tx *Tx) claim(key, group string, id StreamID, pe store.PendingEntry) error {
+	if err := tx.txn.XClaim(key, group, id, pe); err != nil {
+		return err
+	}
+	value := fmt.Sprintf("%s %d %d %s", id, pe.DeliveredAt, pe.Deliveries, pe.Consumer)
+	tx.log(wal.OpXClaim, key, value, wal.WithField(group), wal.WithVersion(tx.txn.Version(key)))
+	return nil
+}
+
+// XAck acknowledges entries for a consumer group
+func (tx *Tx) XAck(key, group string, ids ...StreamID) (int, error) {
+	n := 0
+	for _, id := range ids {
+		ok, err := tx.txn.XAck(key, group, id)
+		if err != nil {
+			return n, err
+		}
+		if ok {
+			tx.log(wal.OpXAck, key, id.String(), wal.WithField(group), wal.WithVersion(tx.txn.Version(key)))
+			n++
+		}
+	}
+	return n, nil
+}
+
+// XPending summarizes the pending entries of a consumer group
+func (tx *Tx) XPending(key, group string) (PendingSummary, error) {
+	_, g, err := tx.group(key, group)
+	if err != nil {
+		return PendingSummary{}, err
+	}
+
+	ids := g.PendingIDs()
+	summary := PendingSummary{Count: len(ids)}
+	if len(ids) == 0 {
+		return summary, nil
+	}
+	summary.Min, summary.Max = ids[0], ids[len(ids)-1]
+
+	counts := make(map[string]int)
+	for _, pe := range g.Pending {
+		counts[pe.Consumer]++
+	}
+	for name, n := range counts {
+		summary.Consumers = append(summary.Consumers, PendingConsumer{Name: name, Count: n})
+	}
+	sort.Slice(summary.Consumers, func(i, j int) bool {
+		return summary.Consumers[i].Name < summary.Consumers[j].Name
+	})
+	return summary, nil
+}
+
+// XPendingRange lists pending entries of a consumer group
+func (tx *Tx) XPendingRange(key, group string, start, end StreamID, count int, consumer string, minIdle time.Duration) ([]PendingInfo, error) {
+	_, g, err := tx.group(key, group)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixMilli()
+	var pending []PendingInfo
+	for _, id := range g.PendingIDs() {
+		if count > 0 && len(pending) == count {
+			break
+		}
+		pe := g.Pending[id]
+		idle := time.Duration(now-pe.DeliveredAt) * time.Millisecond
+		switch {
+		case id.Less(start), end.Less(id):
+			continue
+		case consumer != "" && pe.Consumer != consumer:
+			continue
+		case idle < minIdle:
+			continue
+		}
+		pending = append(pending, PendingInfo{ID: id, Consumer: pe.Consumer, Idle: idle, Deliveries: pe.Deliveries})
+	}
+	return pending, nil
+}
+
+// XClaim transfers pending entries to consumer
+func (tx *Tx) XClaim(key, group, consumer string, minIdle time.Duration, ids []StreamID, justID bool) ([]StreamEntry, error) {
+	st, g, err := tx.group(key, group)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixMilli()
+	var claimed []StreamEntry
+	for _, id := range ids {
+		pe, ok := g.Pending[id]
+		if !ok || time.Duration(now-pe.DeliveredAt)*time.Millisecond < minIdle {
+			continue
+		}
+		entry, ok := st.Get(id)
+		if !ok {
+			if _, err := tx.XAck(key, group, id); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		deliveries := pe.Deliveries
+		if !justID {
+			deliveries++
+		}
+		if err := tx.claim(key, group, id, store.PendingEntry{Consumer: consumer, DeliveredAt: now, Deliveries: deliveries}); err != nil {
+			return nil, err
+		}
+		if justID {
+			entry = StreamEntry{ID: id}
+		}
+		claimed = append(claimed, entry)
+	}
+	return claimed, nil
+}
+
+// streamForRead returns the stream stored at key and records the read
+func (tx *Tx) streamForRead(key string) (*store.Stream, error) {
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordRead(key)
+		tx.e.trackRequestRate()
+	}
+	return tx.txn.Stream(key)
+}
+
+// replayStream applies a stream record from the WAL
+func (e *Engine) replayStream(record *wal.Record) error {
+	switch record.Op {
+	case wal.OpXAdd:
+		id, err := store.ParseStreamID(record.Field)
+		if err != nil {
+			return err
+		}
+		var fields []string
+		if err := json.Unmarshal([]byte(record.Value), &fields); err != nil {
+			return fmt.Errorf("invalid stream fields: %w", err)
+		}
+		e.store.RestoreStream(record.Key, record.Version, func(st *store.Stream) {
+			if st.LastID().Less(id) {
+				st.Append(id, fields)
+			}
+		})
+
+	case wal.OpXTrim:
+		min, err := store.ParseStreamID(record.Value)
+		if err != nil {
+			return err
+		}
+		e.store.RestoreStream(record.Key, record.Version, func(st *store.Stream) {
+			st.TrimBefore(min)
+		})
+
+	case wal.OpXGroup:
+		if record.Value == "" {
+			e.store.RestoreStream(record.Key, record.Version, func(st *store.Stream) {
+				delete(st.Groups, record.Field)
+			})
+			return nil
+		}
+		id, err := store.ParseStreamID(record.Value)
+		if err != nil {
+			return err
+		}
+		e.store.RestoreStream(record.Key, record.Version, func(st *store.Stream) {
+			st.SetGroup(record.Field, id)
+		})
+
+	case wal.OpXClaim:
+		parts := strings.SplitN(record.Value, " ", 4)
+		if len(parts) != 4 {
+			return fmt.Errorf("invalid XCLAIM value %q", record.Value)
+		}
+		id, err := store.ParseStreamID(parts[0])
+		if err != nil {
+			return err
+		}
+		deliveredAt, err1 := strconv.ParseInt(parts[1], 10, 64)
+		deliveries, err2 := strconv.Atoi(parts[2])
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("invalid XCLAIM value %q", record.Value)
+		}
+		pe := store.PendingEntry{Consumer: parts[3], DeliveredAt: deliveredAt, Deliveries: deliveries}
+		e.store.RestoreStream(record.Key, record.Version, func(st *store.Stream) {
+			st.Claim(record.Field, id, pe)
+		})
+
+	case wal.OpXAck:
+		id, err := store.ParseStreamID(record.Value)
+		if err != nil {
+			return err
+		}
+		e.store.RestoreStream(record.Key, record.Version, func(st *store.Stream) {
+			st.Ack(record.Field, id)
+		})
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+// internal/engine/stream_test.go
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// streamIDs returns the IDs of entries as strings
+func streamIDs(entries []StreamEntry) []string {
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID.String()
+	}
+	return ids
+}
+
+func TestNextStreamID(t *testing.T) {
+	last := StreamID{Ms: 100, Seq: 4}
+	tests := []struct {
+		id   string
+		now  int64
+		want StreamID
+		err  error
+	}{
+		{"*", 200, StreamID{Ms: 200}, nil},
+		{"*", 100, StreamID{Ms: 100, Seq: 5}, nil},
+		{"*", 50, StreamID{Ms: 100, Seq: 5}, nil}, // Clock went backwards
+		{"100-*", 0, StreamID{Ms: 100, Seq: 5}, nil},
+		{"150-*", 0, StreamID{Ms: 150}, nil},
+		{"99-*", 0, StreamID{}, ErrStreamIDTooSmall},
+		{"100-5", 0, StreamID{Ms: 100, Seq: 5}, nil},
+		{"100-4", 0, StreamID{}, ErrStreamIDTooSmall},
+		{"x-*", 0, StreamID{}, ErrInvalidStreamID},
+		{"1-x", 0, StreamID{}, ErrInvalidStreamID},
+	}
+	for _, tt := range tests {
+		got, err := nextStreamID(last, tt.id, tt.now)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("nextStreamID(%q, %d) = %v, %v; want %v, %v", tt.id, tt.now, got, err, tt.want, tt.err)
+		}
+	}
+
+	if _, err := nextStreamID(StreamID{}, "0-0", 0); !errors.Is(err, ErrStreamIDZero) {
+		t.Errorf("Expected ErrStreamIDZero, got %v", err)
+	}
+	if got, _ := nextStreamID(StreamID{}, "0-*", 0); got != (StreamID{Seq: 1}) {
+		t.Errorf("Expected 0-1 on an empty stream, got %v", got)
+	}
+}
+
+func TestEngine_Stream(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for _, id := range []string{"1-1", "2-1", "3-1", "4-1"} {
+		if _, _, err := engine.XAdd("events", id, []string{"n", id}, XAddOptions{}); err != nil {
+			t.Fatalf("XAdd %s: %v", id, err)
+		}
+	}
+	auto, _, err := engine.XAdd("events", "*", []string{"n", "auto"}, XAddOptions{})
+	if err != nil || auto.Ms < 1000 {
+		t.Fatalf("Expected a clock-based ID, got %v, %v", auto, err)
+	}
+	if _, _, err := engine.XAdd("events", "4-1", nil, XAddOptions{}); !errors.Is(err, ErrStreamIDTooSmall) {
+		t.Errorf("Expected ErrStreamIDTooSmall, got %v", err)
+	}
+	if _, ok, _ := engine.XAdd("missing", "*", []string{"f", "v"}, XAddOptions{NoMkStream: true}); ok || engine.Exists("missing") {
+		t.Error("NoMkStream should not create the stream")
+	}
+
+	entries, _ := engine.XRange("events", StreamID{Ms: 2}, StreamID{Ms: 3, Seq: 1}, false, 0)
+	if got := streamIDs(entries); !reflect.DeepEqual(got, []string{"2-1", "3-1"}) {
+		t.Errorf("XRange: %v", got)
+	}
+	entries, _ = engine.XRange("events", StreamID{}, MaxStreamID, true, 2)
+	if len(entries) != 2 || entries[0].ID != auto {
+		t.Errorf("Reverse XRange should start with the newest entry, got %v", streamIDs(entries))
+	}
+
+	results, _ := engine.XRead([]StreamRead{{Key: "events", After: StreamID{Ms: 3, Seq: 1}}, {Key: "missing"}}, 1)
+	if len(results) != 1 || streamIDs(results[0].Entries)[0] != "4-1" {
+		t.Errorf("XRead: %+v", results)
+	}
+
+	if n, _ := engine.XTrim("events", XTrimOptions{Strategy: TrimMaxLen, MaxLen: 2}); n != 3 {
+		t.Errorf("Expected 3 trimmed, got %d", n)
+	}
+	if n, _ := engine.XTrim("events", XTrimOptions{Strategy: TrimMinID, MinID: auto}); n != 1 {
+		t.Errorf("Expected 1 trimmed, got %d", n)
+	}
+	_, _, _ = engine.XAdd("events", "*", []string{"n", "x"}, XAddOptions{Trim: XTrimOptions{Strategy: TrimMaxLen}})
+	if n, _ := engine.XLen("events"); n != 0 || !engine.Exists("events") {
+		t.Errorf("Expected an empty stream to be kept, got %d entries", n)
+	}
+}
+
+func TestEngine_StreamGroups(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if err := engine.XGroupCreate("jobs", "workers", "$", false); !errors.Is(err, ErrNoStream) {
+		t.Errorf("Expected ErrNoStream, got %v", err)
+	}
+	if err := engine.XGroupCreate("jobs", "workers", "$", true); err != nil {
+		t.Fatalf("XGroupCreate: %v", err)
+	}
+	if err := engine.XGroupCreate("jobs", "workers", "0", false); !errors.Is(err, ErrGroupExists) {
+		t.Errorf("Expected ErrGroupExists, got %v", err)
+	}
+	for _, id := range []string{"1-0", "2-0", "3-0"} {
+		_, _, _ = engine.XAdd("jobs", id, []string{"job", id}, XAddOptions{})
+	}
+
+	fresh := []StreamRead{{Key: "jobs", New: true}}
+	results, err := engine.XReadGroup("workers", "alice", fresh, 2)
+	if err != nil || len(results) != 1 || !reflect.DeepEqual(streamIDs(results[0].Entries), []string{"1-0", "2-0"}) {
+		t.Fatalf("XReadGroup alice: %+v, %v", results, err)
+	}
+	results, _ = engine.XReadGroup("workers", "bob", fresh, 0)
+	if len(results) != 1 || !reflect.DeepEqual(streamIDs(results[0].Entries), []string{"3-0"}) {
+		t.Errorf("XReadGroup bob: %+v", results)
+	}
+	if results, _ := engine.XReadGroup("workers", "bob", fresh, 0); len(results) != 0 {
+		t.Errorf("Expected nothing new, got %+v", results)
+	}
+	if _, err := engine.XReadGroup("nobody", "bob", fresh, 0); !errors.Is(err, ErrNoGroup) {
+		t.Errorf("Expected ErrNoGroup, got %v", err)
+	}
+
+	// Reading history returns only the consumer's own pending entries
+	results, _ = engine.XReadGroup("workers", "alice", []StreamRead{{Key: "jobs"}}, 0)
+	if len(results) != 1 || !reflect.DeepEqual(streamIDs(results[0].Entries), []string{"1-0", "2-0"}) {
+		t.Errorf("XReadGroup history: %+v", results)
+	}
+
+	summary, _ := engine.XPending("jobs", "workers")
+	wantConsumers := []PendingConsumer{{Name: "alice", Count: 2}, {Name: "bob", Count: 1}}
+	if summary.Count != 3 || summary.Min != (StreamID{Ms: 1}) || summary.Max != (StreamID{Ms: 3}) ||
+		!reflect.DeepEqual(summary.Consumers, wantConsumers) {
+		t.Errorf("XPending: %+v", summary)
+	}
+
+	if n, _ := engine.XAck("jobs", "workers", StreamID{Ms: 1}, StreamID{Ms: 9}); n != 1 {
+		t.Errorf("Expected 1 acknowledged, got %d", n)
+	}
+
+	if claimed, _ := engine.XClaim("jobs", "workers", "bob", time.Hour, []StreamID{{Ms: 2}}, false); len(claimed) != 0 {
+		t.Errorf("Entries idle for less than minIdle should not be claimed, got %v", claimed)
+	}
+	claimed, _ := engine.XClaim("jobs", "workers", "bob", 0, []StreamID{{Ms: 2}, {Ms: 1}}, false)
+	if !reflect.DeepEqual(streamIDs(claimed), []string{"2-0"}) || claimed[0].Fields[1] != "2-0" {
+		t.Errorf("XClaim: %+v", claimed)
+	}
+	pending, _ := engine.XPendingRange("jobs", "workers", StreamID{}, MaxStreamID, 0, "bob", 0)
+	if len(pending) != 2 || pending[0].ID != (StreamID{Ms: 2}) || pending[0].Deliveries != 2 {
+		t.Errorf("XPendingRange: %+v", pending)
+	}
+
+	// Entries trimmed from the stream drop out of the PEL when claimed
+	_, _ = engine.XTrim("jobs", XTrimOptions{Strategy: TrimMinID, MinID: StreamID{Ms: 3}})
+	if claimed, _ := engine.XClaim("jobs", "workers", "alice", 0, []StreamID{{Ms: 2}}, true); len(claimed) != 0 {
+		t.Errorf("Trimmed entries should not be claimed, got %v", claimed)
+	}
+	if summary, _ := engine.XPending("jobs", "workers"); summary.Count != 1 {
+		t.Errorf("Expected 1 pending entry left, got %d", summary.Count)
+	}
+
+	if ok, _ := engine.XGroupDestroy("jobs", "workers"); !ok {
+		t.Error("Expected XGroupDestroy to remove the group")
+	}
+	if _, err := engine.XPending("jobs", "workers"); !errors.Is(err, ErrNoGroup) {
+		t.Errorf("Expected ErrNoGroup, got %v", err)
+	}
+}
+
+func TestEngine_Stream_WrongType(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_ = engine.Set("str", "value")
+	if _, _, err := engine.XAdd("str", "*", []string{"f", "v"}, XAddOptions{}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	if _, err := engine.XRead([]StreamRead{{Key: "str"}}, 0); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestEngine_Stream_Recovery(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_, _, _ = engine1.XAdd("s", "1-0", []string{"f", "one"}, XAddOptions{})
+	_ = engine1.XGroupCreate("s", "g", "0", false)
+	_, _ = engine1.XReadGroup("g", "alice", []StreamRead{{Key: "s", New: true}}, 0)
+	if err := engine1.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	// Changes after the snapshot come from the WAL
+	_, _, _ = engine1.XAdd("s", "2-0", []string{"f", "two"}, XAddOptions{})
+	_, _, _ = engine1.XAdd("s", "3-0", []string{"f", "three"}, XAddOptions{})
+	_, _ = engine1.XReadGroup("g", "bob", []StreamRead{{Key: "s", New: true}}, 1)
+	_, _ = engine1.XAck("s", "g", StreamID{Ms: 1})
+	_, _ = engine1.XTrim("s", XTrimOptions{Strategy: TrimMaxLen, MaxLen: 2})
+	_ = engine1.XGroupCreate("s", "other", "$", false)
+	_, _ = engine1.XGroupDestroy("s", "other")
+	version := engine1.Version("s")
+	engine1.Close()
+
+	engine2, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if v := engine2.Version("s"); v != version {
+		t.Errorf("Expected version %d after recovery, got %d", version, v)
+	}
+
+	entries, _ := engine2.XRange("s", StreamID{}, MaxStreamID, false, 0)
+	if got := streamIDs(entries); !reflect.DeepEqual(got, []string{"2-0", "3-0"}) {
+		t.Errorf("Expected [2-0 3-0] after recovery, got %v", got)
+	}
+	summary, err := engine2.XPending("s", "g")
+	if err != nil || summary.Count != 1 || summary.Consumers[0].Name != "bob" {
+		t.Errorf("Expected bob's pending entry to survive recovery, got %+v, %v", summary, err)
+	}
+	results, _ := engine2.XReadGroup("g", "alice", []StreamRead{{Key: "s", New: true}}, 0)
+	if len(results) != 1 || !reflect.DeepEqual(streamIDs(results[0].Entries), []string{"3-0"}) {
+		t.Errorf("Expected delivery to resume after 2-0, got %+v", results)
+	}
+	if _, err := engine2.XPending("s", "other"); !errors.Is(err, ErrNoGroup) {
+		t.Errorf("Expected destroyed group to stay destroyed, got %v", err)
+	}
+}
+
+func TestEngine_Stream_RecoveryAfterExpiry(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// The server stops before the TTL passes, so no DELETE is logged
+	engine1, err := New(Options{WALPath: tmpDir, TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_, _, _ = engine1.XAdd("events", "1-1", []string{"n", "1"}, XAddOptions{})
+	engine1.Expire("events", 50*time.Millisecond)
+	_, _, _ = engine1.XAdd("events", "2-1", []string{"n", "2"}, XAddOptions{})
+	_ = engine1.XGroupCreate("events", "workers", "0", false)
+	engine1.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Replaying the later entries and groups must not bring the stream
+	// back without its TTL
+	engine2, err := New(Options{WALPath: tmpDir, TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if engine2.Exists("events") {
+		entries, _ := engine2.XRange("events", StreamID{}, StreamID{Ms: ^uint64(0), Seq: ^uint64(0)}, false, 0)
+		t.Errorf("Expected the expired stream to stay expired, got %v with TTL %v", streamIDs(entries), engine2.TTL("events"))
+	}
+}
@@ -0,0 +1,313 @@
+// internal/engine/strings.go
+package engine
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/lofoneh/kvlite/internal/store"
+)
+
+// Errors returned by the numeric string operations
+var (
+	ErrNotInteger = errors.New("value is not an integer")
+	ErrNotFloat   = errors.New("value is not a valid float")
+	ErrOverflow   = errors.New("increment or decrement would overflow")
+	ErrNaN        = errors.New("increment would produce NaN or Infinity")
+)
+
+// SetCondition controls whether SetIf writes the key
+type SetCondition int
+
+const (
+	SetAlways      SetCondition = iota // Always write
+	SetIfNotExists                     // Only write if the key doesn't exist (NX)
+	SetIfExists                        // Only write if the key exists (XX)
+)
+
+// Expiry describes the expiration a write applies to a key. The zero value
+// means the key is written without TTL.
+type Expiry struct {
+	TTL     time.Duration // Relative TTL (EX/PX)
+	At      time.Time     // Absolute expiration (EXAT/PXAT)
+	KeepTTL bool          // Keep the key's current expiration (KEEPTTL)
+	Persist bool          // Remove any expiration (GETEX PERSIST)
+}
+
+// expiresAt resolves the expiration to Unix nanoseconds, given the key's
+// current expiration
+func (x Expiry) expiresAt(current int64) int64 {
+	switch {
+	case x.KeepTTL:
+		return current
+	case x.TTL > 0:
+		return time.Now().Add(x.TTL).UnixNano()
+	case !x.At.IsZero():
+		return x.At.UnixNano()
+	default:
+		return 0
+	}
+}
+
+// isSet reports whether the expiry changes a key's expiration at all
+func (x Expiry) isSet() bool {
+	return x.TTL > 0 || !x.At.IsZero() || x.Persist
+}
+
+// SetResult describes the outcome of SetIf
+type SetResult struct {
+	Written bool   // Whether the value was stored
+	Old     string // Previous value, if the key existed
+	Existed bool   // Whether the key existed before the call
+}
+
+// SetIf stores a value if cond holds, checking and writing under one store
+// lock with one WAL record
+func (e *Engine) SetIf(key, value string, cond SetCondition, ttl Expiry) (SetResult, error) {
+	var res SetResult
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		res, err = tx.SetIf(key, value, cond, ttl)
+		return err
+	})
+	return res, err
+}
+
+// SetGet is SetIf for SET GET and GETSET, which return the old value: it
+// fails with ErrWrongType, writing nothing, if the key holds another type
+func (e *Engine) SetGet(key, value string, cond SetCondition, ttl Expiry) (SetResult, error) {
+	var res SetResult
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		res, err = tx.SetGet(key, value, cond, ttl)
+		return err
+	})
+	return res, err
+}
+
+// GetDel retrieves a value and deletes the key
+func (e *Engine) GetDel(key string) (string, bool, error) {
+	var val string
+	var ok bool
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		val, ok, err = tx.GetDel(key)
+		return err
+	})
+	return val, ok, err
+}
+
+// GetEx retrieves a value and updates its expiration
+func (e *Engine) GetEx(key string, ttl Expiry) (string, bool, error) {
+	var val string
+	var ok bool
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		val, ok, err = tx.GetEx(key, ttl)
+		return err
+	})
+	return val, ok, err
+}
+
+// SetIf stores a value if cond holds
+func (tx *Tx) SetIf(key, value string, cond SetCondition, ttl Expiry) (SetResult, error) {
+	if err := tx.reserveValue(key, int64(len(value))); err != nil {
+		return SetResult{}, err
+	}
+	var res SetResult
+	var current int64
+
+	if entry, ok := tx.txn.GetEntry(key); ok {
+		res.Old = entry.StringValue() // Empty if the key holds another type, see SetGet
+		res.Existed = true
+		current = entry.ExpiresAt
+	}
+
+	if (cond == SetIfNotExists && res.Existed) || (cond == SetIfExists && !res.Existed) {
+		return res, nil
+	}
+
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(key)
+		tx.e.trackRequestRate()
+	}
+
+	tx.put(key, &store.Entry{
+		Value:     value,
+		ExpiresAt: ttl.expiresAt(current),
+	})
+	res.Written = true
+	return res, nil
+}
+
+// SetGet stores a value if cond holds, failing if the key holds another
+// type than string
+func (tx *Tx) SetGet(key, value string, cond SetCondition, ttl Expiry) (SetResult, error) {
+	if _, err := tx.stringEntry(key); err != nil {
+		return SetResult{}, err
+	}
+	return tx.SetIf(key, value, cond, ttl)
+}
+
+// GetDel retrieves a value and deletes the key
+func (tx *Tx) GetDel(key string) (string, bool, error) {
+	entry, err := tx.stringEntry(key)
+	if entry == nil || err != nil {
+		return "", false, err
+	}
+	_, err = tx.Delete(key)
+	return entry.StringValue(), true, err
+}
+
+// GetEx retrieves a value and updates its expiration. The key is rewritten
+// with its new expiration so that the change is a single WAL record.
+func (tx *Tx) GetEx(key string, ttl Expiry) (string, bool, error) {
+	entry, err := tx.stringEntry(key)
+	if entry == nil || err != nil {
+		return "", false, err
+	}
+	value := entry.StringValue()
+	if ttl.isSet() {
+		tx.put(key, &store.Entry{
+			Value:     value,
+			ExpiresAt: ttl.expiresAt(entry.ExpiresAt),
+		})
+	}
+	return value, true, nil
+}
+
+// IncrBy adds delta to the integer stored at key and returns the new value.
+// A missing key counts as 0. The key's TTL is preserved.
+func (e *Engine) IncrBy(key string, delta int64) (int64, error) {
+	var n int64
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		n, err = tx.IncrBy(key, delta)
+		return err
+	})
+	return n, err
+}
+
+// IncrByFloat adds delta to the number stored at key and returns the new
+// value. A missing key counts as 0. The key's TTL is preserved.
+func (e *Engine) IncrByFloat(key string, delta float64) (float64, error) {
+	var f float64
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		f, err = tx.IncrByFloat(key, delta)
+		return err
+	})
+	return f, err
+}
+
+// Append appends value to the string stored at key, creating it if
+// missing, and returns the new length. The key's TTL is preserved.
+func (e *Engine) Append(key, value string) (int, error) {
+	var n int
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		n, err = tx.Append(key, value)
+		return err
+	})
+	return n, err
+}
+
+// IncrBy adds delta to the integer stored at key
+func (tx *Tx) IncrBy(key string, delta int64) (int64, error) {
+	entry, err := tx.stringEntry(key)
+	if err != nil {
+		return 0, err
+	}
+
+	var current int64
+	if entry != nil {
+		current, err = strconv.ParseInt(entry.StringValue(), 10, 64)
+		if err != nil {
+			return 0, ErrNotInteger
+		}
+	}
+
+	n, err := addInt64(current, delta)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.update(key, entry, strconv.FormatInt(n, 10)); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// addInt64 adds two integers, failing with ErrOverflow if the result
+// doesn't fit in an int64
+func addInt64(a, b int64) (int64, error) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, ErrOverflow
+	}
+	return a + b, nil
+}
+
+// IncrByFloat adds delta to the number stored at key
+func (tx *Tx) IncrByFloat(key string, delta float64) (float64, error) {
+	entry, err := tx.stringEntry(key)
+	if err != nil {
+		return 0, err
+	}
+
+	var current float64
+	if entry != nil {
+		current, err = strconv.ParseFloat(entry.StringValue(), 64)
+		if err != nil || math.IsNaN(current) || math.IsInf(current, 0) {
+			return 0, ErrNotFloat
+		}
+	}
+
+	f := current + delta
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, ErrNaN
+	}
+
+	if err := tx.update(key, entry, strconv.FormatFloat(f, 'f', -1, 64)); err != nil {
+		return 0, err
+	}
+	return f, nil
+}
+
+// Append appends value to the string stored at key
+func (tx *Tx) Append(key, value string) (int, error) {
+	entry, err := tx.stringEntry(key)
+	if err != nil {
+		return 0, err
+	}
+
+	newVal := value
+	if entry != nil {
+		newVal = entry.StringValue() + value
+	}
+
+	if err := tx.update(key, entry, newVal); err != nil {
+		return 0, err
+	}
+	return len(newVal), nil
+}
+
+// update writes a new value for a key read earlier in the transaction,
+// keeping its expiration. current is nil if the key didn't exist.
+func (tx *Tx) update(key string, current *store.Entry, value string) error {
+	if err := tx.reserveValue(key, int64(len(value))); err != nil {
+		return err
+	}
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(key)
+		tx.e.trackRequestRate()
+	}
+
+	entry := store.NewEntry(value)
+	if current != nil {
+		entry.ExpiresAt = current.ExpiresAt
+	}
+	tx.put(key, entry)
+	return nil
+}
@@ -0,0 +1,301 @@
+// internal/engine/strings_test.go
+package engine
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEngine_SetIf(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	res, err := engine.SetIf("k", "v1", SetIfNotExists, Expiry{})
+	if err != nil || !res.Written || res.Existed {
+		t.Errorf("NX on new key: %+v, %v", res, err)
+	}
+
+	res, _ = engine.SetIf("k", "v2", SetIfNotExists, Expiry{})
+	if res.Written || !res.Existed || res.Old != "v1" {
+		t.Errorf("NX on existing key: %+v", res)
+	}
+
+	res, _ = engine.SetIf("missing", "v", SetIfExists, Expiry{})
+	if res.Written {
+		t.Errorf("XX on missing key should not write: %+v", res)
+	}
+
+	res, _ = engine.SetIf("k", "v3", SetIfExists, Expiry{TTL: time.Hour})
+	if !res.Written || res.Old != "v1" {
+		t.Errorf("XX on existing key: %+v", res)
+	}
+	if ttl := engine.TTL("k"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Expected TTL of about an hour, got %v", ttl)
+	}
+
+	_, _ = engine.SetIf("k", "v4", SetAlways, Expiry{KeepTTL: true})
+	if ttl := engine.TTL("k"); ttl <= 0 {
+		t.Error("KeepTTL should keep the expiration")
+	}
+}
+
+func TestEngine_SetGet_WrongType(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_, _ = engine.HSet("h", map[string]string{"f": "v"})
+	if _, err := engine.SetGet("h", "v", SetAlways, Expiry{}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	if v, _, _ := engine.HGet("h", "f"); v != "v" {
+		t.Error("Expected the hash to be left alone")
+	}
+
+	_ = engine.Set("s", "old")
+	if res, err := engine.SetGet("s", "new", SetAlways, Expiry{}); err != nil || res.Old != "old" {
+		t.Errorf("SetGet on a string: %+v, %v", res, err)
+	}
+	if res, err := engine.SetGet("missing", "v", SetAlways, Expiry{}); err != nil || res.Existed {
+		t.Errorf("SetGet on a missing key: %+v, %v", res, err)
+	}
+}
+
+func TestEngine_SetIf_ConcurrentNX(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	winners := 0
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, _ := engine.SetIf("lock", "owner", SetIfNotExists, Expiry{TTL: time.Minute})
+			if res.Written {
+				mu.Lock()
+				winners++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if winners != 1 {
+		t.Errorf("Expected exactly one NX winner, got %d", winners)
+	}
+}
+
+func TestEngine_GetDel_GetEx(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_ = engine.Set("k", "v")
+
+	val, ok, err := engine.GetEx("k", Expiry{TTL: time.Hour})
+	if err != nil || !ok || val != "v" {
+		t.Errorf("GetEx = %q, %v, %v", val, ok, err)
+	}
+	if engine.TTL("k") <= 0 {
+		t.Error("GetEx should set a TTL")
+	}
+
+	_, _, _ = engine.GetEx("k", Expiry{Persist: true})
+	if engine.TTL("k") != 0 {
+		t.Error("GetEx with Persist should remove the TTL")
+	}
+
+	val, ok, err = engine.GetDel("k")
+	if err != nil || !ok || val != "v" {
+		t.Errorf("GetDel = %q, %v, %v", val, ok, err)
+	}
+	if _, ok := engine.Get("k"); ok {
+		t.Error("GetDel should delete the key")
+	}
+}
+
+func TestEngine_ExpiryRecovery(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_, _ = engine1.SetIf("long", "v", SetAlways, Expiry{TTL: time.Hour})
+	_, _ = engine1.SetIf("short", "v", SetAlways, Expiry{TTL: 50 * time.Millisecond})
+	engine1.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	engine2, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if ttl := engine2.TTL("long"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Expected TTL to survive recovery, got %v", ttl)
+	}
+	if _, ok := engine2.Get("short"); ok {
+		t.Error("Expected short-lived key to be expired after recovery")
+	}
+}
+
+func TestEngine_IncrBy(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if n, err := engine.IncrBy("n", 5); err != nil || n != 5 {
+		t.Errorf("IncrBy on missing key: %d, %v", n, err)
+	}
+	if n, err := engine.IncrBy("n", -7); err != nil || n != -2 {
+		t.Errorf("IncrBy with negative delta: %d, %v", n, err)
+	}
+
+	_ = engine.Set("max", strconv.FormatInt(math.MaxInt64, 10))
+	if _, err := engine.IncrBy("max", 1); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Expected ErrOverflow, got %v", err)
+	}
+	_ = engine.Set("min", strconv.FormatInt(math.MinInt64, 10))
+	if _, err := engine.IncrBy("min", -1); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Expected ErrOverflow, got %v", err)
+	}
+
+	_ = engine.Set("text", "hello")
+	if _, err := engine.IncrBy("text", 1); !errors.Is(err, ErrNotInteger) {
+		t.Errorf("Expected ErrNotInteger, got %v", err)
+	}
+	if val, _ := engine.Get("text"); val != "hello" {
+		t.Errorf("Failed increment changed the value: %s", val)
+	}
+}
+
+func TestEngine_IncrByFloat(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_ = engine.Set("f", "10.5")
+	if f, err := engine.IncrByFloat("f", 0.25); err != nil || f != 10.75 {
+		t.Errorf("IncrByFloat: %v, %v", f, err)
+	}
+	if val, _ := engine.Get("f"); val != "10.75" {
+		t.Errorf("Expected stored value 10.75, got %s", val)
+	}
+
+	_ = engine.Set("big", "1e308")
+	if _, err := engine.IncrByFloat("big", 1e308); !errors.Is(err, ErrNaN) {
+		t.Errorf("Expected ErrNaN on overflow to infinity, got %v", err)
+	}
+
+	_ = engine.Set("text", "abc")
+	if _, err := engine.IncrByFloat("text", 1); !errors.Is(err, ErrNotFloat) {
+		t.Errorf("Expected ErrNotFloat, got %v", err)
+	}
+}
+
+func TestEngine_Append(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if n, _ := engine.Append("s", "foo"); n != 3 {
+		t.Errorf("Append on missing key returned %d", n)
+	}
+	if n, _ := engine.Append("s", "bar"); n != 6 {
+		t.Errorf("Append returned %d", n)
+	}
+	if val, _ := engine.Get("s"); val != "foobar" {
+		t.Errorf("Expected foobar, got %s", val)
+	}
+}
+
+func TestEngine_IncrBy_KeepsTTL(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_ = engine.SetWithTTL("n", "1", time.Hour)
+	_, _ = engine.IncrBy("n", 1)
+	_, _ = engine.IncrByFloat("n", 0.5)
+	_, _ = engine.Append("n", "0")
+
+	if ttl := engine.TTL("n"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Expected TTL to be preserved, got %v", ttl)
+	}
+}
+
+func TestEngine_IncrBy_Concurrent(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, _ = engine.IncrBy("n", 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if val, _ := engine.Get("n"); val != "1000" {
+		t.Errorf("Expected 1000 after concurrent increments, got %s", val)
+	}
+}
+
+func TestEngine_IncrBy_Recovery(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_ = engine1.SetWithTTL("n", "1", time.Hour)
+	_, _ = engine1.IncrBy("n", 41)
+	engine1.Close()
+
+	engine2, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	if val, _ := engine2.Get("n"); val != "42" {
+		t.Errorf("Expected 42 after recovery, got %s", val)
+	}
+	if ttl := engine2.TTL("n"); ttl <= 0 {
+		t.Error("Expected TTL to survive recovery")
+	}
+}
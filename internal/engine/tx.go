@@ -0,0 +1,221 @@
+// internal/engine/tx.go
+package engine
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/lofoneh/kvlite/internal/store"
+	"github.com/lofoneh/kvlite/internal/wal"
+)
+
+// ErrWrongType is returned when an operation is applied to a key holding a
+// different kind of value
+var ErrWrongType = store.ErrWrongType
+
+// KeyValue is a string key with its value
+type KeyValue = store.KeyValue
+
+// ScanOptions filters and sizes the pages of Scan
+type ScanOptions = store.ScanOptions
+
+// Tx is a handle for running several operations atomically. It is only
+// valid inside the function passed to Engine.Atomic, which holds the store
+// lock for the whole call. Writes are applied to memory immediately and
+// logged to the WAL as a single batch when the function returns.
+type Tx struct {
+	e       *Engine
+	txn     *store.Txn
+	records *[]*wal.Record // Shared by the Tx of every database, see DB
+}
+
+// Atomic runs fn with exclusive access to the store and logs every write
+// it made as one WAL batch. There is no rollback: writes made before fn
+// returns an error are kept and logged. It fails with ErrQuotaExceeded
+// without running fn if the database is over its operation rate.
+func (e *Engine) Atomic(fn func(tx *Tx) error) error {
+	if err := e.quota.allow(); err != nil {
+		return err
+	}
+
+	var logged int
+	err := e.store.Update(func(txn *store.Txn) error {
+		var records []*wal.Record
+		tx := &Tx{e: e, txn: txn, records: &records}
+		fnErr := fn(tx)
+
+		var err error
+		if logged, err = e.commit(records); err != nil {
+			return fmt.Errorf("failed to write to WAL: %w", err)
+		}
+		return fnErr
+	})
+
+	// Increment WAL entry count
+	atomic.AddInt64(&e.walEntryCount, int64(logged))
+
+	return err
+}
+
+// View runs fn with shared access to the store, alongside other readers.
+// Like GetWithVersion it is not counted against MaxOpsPerSec. fn must only
+// read: keys found expired are skipped but not deleted, and nothing is logged.
+func (e *Engine) View(fn func(tx *Tx) error) error {
+	return e.store.View(func(txn *store.Txn) error {
+		var records []*wal.Record
+		return fn(&Tx{e: e, txn: txn, records: &records})
+	})
+}
+
+// log queues a WAL record to be written when the transaction commits,
+// tagged with the database of the Tx
+func (tx *Tx) log(op wal.OpType, key, value string, opts ...wal.RecordOption) {
+	if tx.e.db != 0 {
+		opts = append(opts[:len(opts):len(opts)], wal.WithDB(tx.e.db))
+	}
+	*tx.records = append(*tx.records, wal.NewRecord(op, key, value, opts...))
+}
+
+// put stores an entry and logs it as a SET carrying its expiration and
+// the version the store assigned to it. Values other than strings are
+// logged as an encoded payload.
+func (tx *Tx) put(key string, entry *store.Entry) {
+	tx.txn.Put(key, entry)
+
+	opts := []wal.RecordOption{wal.WithExpiry(entry.ExpiresAt), wal.WithVersion(entry.Version)}
+	if entry.Type != store.TypeString {
+		opts = append(opts, wal.WithType(entry.Type.String()))
+	}
+	tx.log(wal.OpSet, key, entry.Payload(), opts...)
+}
+
+// stringEntry returns the string stored at key, or nil if the key doesn't
+// exist. It fails with ErrWrongType if the key holds another type.
+func (tx *Tx) stringEntry(key string) (*store.Entry, error) {
+	entry, ok := tx.txn.GetEntry(key)
+	if !ok {
+		return nil, nil
+	}
+	if entry.Type != store.TypeString {
+		return nil, ErrWrongType
+	}
+	return entry, nil
+}
+
+// logExpiry logs the current expiration of a key changed in place
+func (tx *Tx) logExpiry(key string) {
+	if entry, ok := tx.txn.GetEntry(key); ok {
+		tx.log(wal.OpExpire, key, "",
+			wal.WithExpiry(entry.ExpiresAt), wal.WithVersion(entry.Version))
+	}
+}
+
+// Get retrieves a value by key
+func (tx *Tx) Get(key string) (string, bool) {
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordRead(key)
+		tx.e.trackRequestRate()
+	}
+	return tx.txn.Get(key)
+}
+
+// Set stores a key-value pair
+func (tx *Tx) Set(key, value string) error {
+	if err := tx.reserveValue(key, int64(len(value))); err != nil {
+		return err
+	}
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(key)
+		tx.e.trackRequestRate()
+	}
+	tx.put(key, store.NewEntry(value))
+	return nil
+}
+
+// SetWithTTL stores a key-value pair with TTL
+func (tx *Tx) SetWithTTL(key, value string, ttl time.Duration) error {
+	if err := tx.reserveValue(key, int64(len(value))); err != nil {
+		return err
+	}
+	tx.put(key, store.NewEntryWithTTL(value, ttl))
+	return nil
+}
+
+// Delete removes a key-value pair
+func (tx *Tx) Delete(key string) (bool, error) {
+	if !tx.txn.Delete(key) {
+		return false, nil
+	}
+	// The last version is logged so that recovery never hands out the
+	// deleted key's version again
+	tx.log(wal.OpDelete, key, "", wal.WithVersion(tx.txn.LastVersion()))
+	return true, nil
+}
+
+// Clear removes all keys
+func (tx *Tx) Clear() error {
+	tx.log(wal.OpClear, "", "", wal.WithVersion(tx.txn.LastVersion()))
+	tx.txn.Clear()
+	return nil
+}
+
+// Expire sets TTL on an existing key
+func (tx *Tx) Expire(key string, ttl time.Duration) bool {
+	if !tx.txn.Expire(key, ttl) {
+		return false
+	}
+	tx.logExpiry(key)
+	return true
+}
+
+// Persist removes TTL from a key
+func (tx *Tx) Persist(key string) bool {
+	if !tx.txn.Persist(key) {
+		return false
+	}
+	tx.logExpiry(key)
+	return true
+}
+
+// Exists reports whether a key exists, whatever its type
+func (tx *Tx) Exists(key string) bool {
+	_, ok := tx.txn.GetEntry(key)
+	return ok
+}
+
+// TTL returns the remaining time to live for a key
+func (tx *Tx) TTL(key string) time.Duration {
+	return tx.txn.TTL(key)
+}
+
+// Version returns the current version of a key, 0 if it doesn't exist
+func (tx *Tx) Version(key string) uint64 {
+	return tx.txn.Version(key)
+}
+
+// Removals returns a counter bumped whenever keys of the database are
+// removed
+func (tx *Tx) Removals() uint64 {
+	return tx.txn.Removals()
+}
+
+// Keys returns all keys matching the pattern
+func (tx *Tx) Keys(pattern string) []string {
+	return tx.txn.Keys(pattern)
+}
+
+// Scan returns a page of the keys matching opts and the next cursor
+func (tx *Tx) Scan(cursor string, opts ScanOptions) (string, []string) {
+	return tx.txn.Scan(cursor, opts)
+}
+
+// KeyRange returns the string keys between min and max with their values
+func (tx *Tx) KeyRange(min, max LexBound, limit int) []KeyValue {
+	return tx.txn.KeyRange(min, max, limit)
+}
+
+// Len returns the number of keys in the store
+func (tx *Tx) Len() int {
+	return tx.txn.Len()
+}
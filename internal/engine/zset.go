@@ -0,0 +1,442 @@
+// internal/engine/zset.go
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/lofoneh/kvlite/internal/store"
+	"github.com/lofoneh/kvlite/internal/wal"
+)
+
+// ZMember is a member of a sorted set together with its score
+type ZMember = store.ZMember
+
+// ScoreBound is one end of a score range, see store.ScoreBound
+type ScoreBound = store.ScoreBound
+
+// LexBound is one end of a lexicographical range, see store.LexBound
+type LexBound = store.LexBound
+
+var (
+	// ErrScoreNaN is returned when an increment would make a score NaN
+	ErrScoreNaN = errors.New("resulting score is not a number (NaN)")
+	// ErrZAddOptions is returned for an invalid combination of ZAdd options
+	ErrZAddOptions = errors.New("XX, NX, GT and LT options at the same time are not compatible")
+)
+
+// ZAddOptions controls how ZAdd treats new and existing members
+type ZAddOptions struct {
+	NX bool // Only add new members, never update
+	XX bool // Only update existing members, never add
+	GT bool // Only update when the new score is greater than the current one
+	LT bool // Only update when the new score is less than the current one
+	CH bool // Return the number of members added or changed, not only added
+}
+
+// Validate rejects option combinations that can never update anything
+func (o ZAddOptions) Validate() error {
+	if (o.NX && o.XX) || (o.NX && (o.GT || o.LT)) || (o.GT && o.LT) {
+		return ErrZAddOptions
+	}
+	return nil
+}
+
+// ZAdd sets the scores of members of the sorted set stored at key, creating
+// it if needed. Returns the number of members added, or added and changed
+// with opts.CH.
+func (e *Engine) ZAdd(key string, members []ZMember, opts ZAddOptions) (int, error) {
+	var n int
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		n, err = tx.ZAdd(key, members, opts)
+		return err
+	})
+	return n, err
+}
+
+// ZRem removes members from the sorted set stored at key and returns how
+// many existed. The key is removed together with its last member.
+func (e *Engine) ZRem(key string, members ...string) (int, error) {
+	var removed int
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		removed, err = tx.ZRem(key, members...)
+		return err
+	})
+	return removed, err
+}
+
+// ZScore returns the score of a member of the sorted set stored at key
+func (e *Engine) ZScore(key, member string) (float64, bool, error) {
+	var score float64
+	var ok bool
+	err := e.View(func(tx *Tx) error {
+		var err error
+		score, ok, err = tx.ZScore(key, member)
+		return err
+	})
+	return score, ok, err
+}
+
+// ZIncrBy adds delta to the score of a member, adding it with score delta
+// if needed, and returns the new score
+func (e *Engine) ZIncrBy(key, member string, delta float64) (float64, error) {
+	var score float64
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		score, err = tx.ZIncrBy(key, member, delta)
+		return err
+	})
+	return score, err
+}
+
+// ZCard returns the number of members of the sorted set stored at key
+func (e *Engine) ZCard(key string) (int, error) {
+	var n int
+	err := e.View(func(tx *Tx) error {
+		var err error
+		n, err = tx.ZCard(key)
+		return err
+	})
+	return n, err
+}
+
+// ZRank returns the 0-based rank of a member by ascending score, or by
+// descending score with rev
+func (e *Engine) ZRank(key, member string, rev bool) (int, bool, error) {
+	var rank int
+	var ok bool
+	err := e.View(func(tx *Tx) error {
+		var err error
+		rank, ok, err = tx.ZRank(key, member, rev)
+		return err
+	})
+	return rank, ok, err
+}
+
+// ZCount returns the number of members with scores between min and max
+func (e *Engine) ZCount(key string, min, max ScoreBound) (int, error) {
+	var n int
+	err := e.View(func(tx *Tx) error {
+		var err error
+		n, err = tx.ZCount(key, min, max)
+		return err
+	})
+	return n, err
+}
+
+// ZRangeByRank returns the members from start to stop inclusive by
+// ascending score, or descending with rev. Negative indexes count from the
+// end.
+func (e *Engine) ZRangeByRank(key string, start, stop int, rev bool) ([]ZMember, error) {
+	var members []ZMember
+	err := e.View(func(tx *Tx) error {
+		var err error
+		members, err = tx.ZRangeByRank(key, start, stop, rev)
+		return err
+	})
+	return members, err
+}
+
+// ZRangeByScore returns the members with scores between min and max,
+// skipping offset matches and returning at most count (all if negative)
+func (e *Engine) ZRangeByScore(key string, min, max ScoreBound, rev bool, offset, count int) ([]ZMember, error) {
+	var members []ZMember
+	err := e.View(func(tx *Tx) error {
+		var err error
+		members, err = tx.ZRangeByScore(key, min, max, rev, offset, count)
+		return err
+	})
+	return members, err
+}
+
+// ZRangeByLex returns the members between min and max in member order,
+// for sorted sets whose members all have the same score
+func (e *Engine) ZRangeByLex(key string, min, max LexBound, rev bool, offset, count int) ([]ZMember, error) {
+	var members []ZMember
+	err := e.View(func(tx *Tx) error {
+		var err error
+		members, err = tx.ZRangeByLex(key, min, max, rev, offset, count)
+		return err
+	})
+	return members, err
+}
+
+// ZRemRangeByScore removes the members with scores between min and max and
+// returns how many were removed
+func (e *Engine) ZRemRangeByScore(key string, min, max ScoreBound) (int, error) {
+	var removed int
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		removed, err = tx.ZRemRangeByScore(key, min, max)
+		return err
+	})
+	return removed, err
+}
+
+// ZPopMin removes and returns up to count members with the lowest scores
+func (e *Engine) ZPopMin(key string, count int) ([]ZMember, error) {
+	return e.zpop(key, count, false)
+}
+
+// ZPopMax removes and returns up to count members with the highest scores
+func (e *Engine) ZPopMax(key string, count int) ([]ZMember, error) {
+	return e.zpop(key, count, true)
+}
+
+// zpop runs ZPopMin or ZPopMax in a transaction
+func (e *Engine) zpop(key string, count int, max bool) ([]ZMember, error) {
+	var members []ZMember
+	err := e.Atomic(func(tx *Tx) error {
+		var err error
+		members, err = tx.zpop(key, count, max)
+		return err
+	})
+	return members, err
+}
+
+// zadd sets one member's score and logs it as a member-level record
+func (tx *Tx) zadd(key, member string, score float64) (bool, error) {
+	added, err := tx.txn.ZAdd(key, member, score)
+	if err != nil {
+		return false, err
+	}
+	tx.log(wal.OpZAdd, key, strconv.FormatFloat(score, 'g', -1, 64),
+		wal.WithField(member), wal.WithVersion(tx.txn.Version(key)))
+	return added, nil
+}
+
+// ZAdd sets the scores of members of the sorted set stored at key
+func (tx *Tx) ZAdd(key string, members []ZMember, opts ZAddOptions) (int, error) {
+	// Each member is stored with its 8 byte score
+	var size int64
+	for _, m := range members {
+		size += store.ElementSize(m.Member) + 8
+	}
+	if err := tx.reserve(key, size); err != nil {
+		return 0, err
+	}
+	if err := opts.Validate(); err != nil {
+		return 0, err
+	}
+	z, err := tx.txn.ZSet(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordWrite(key)
+		tx.e.trackRequestRate()
+	}
+
+	n := 0
+	for _, m := range members {
+		var current float64
+		var exists bool
+		if z != nil {
+			current, exists = z.Score(m.Member)
+		}
+
+		switch {
+		case exists && (opts.NX || current == m.Score):
+			continue
+		case exists && opts.GT && m.Score <= current:
+			continue
+		case exists && opts.LT && m.Score >= current:
+			continue
+		case !exists && opts.XX:
+			continue
+		}
+
+		if _, err := tx.zadd(key, m.Member, m.Score); err != nil {
+			return n, err
+		}
+		if !exists || opts.CH {
+			n++
+		}
+		if z == nil {
+			z, _ = tx.txn.ZSet(key)
+		}
+	}
+	return n, nil
+}
+
+// ZRem removes members from the sorted set stored at key
+func (tx *Tx) ZRem(key string, members ...string) (int, error) {
+	removed := 0
+	for _, member := range members {
+		ok, err := tx.txn.ZRem(key, member)
+		if err != nil {
+			return removed, err
+		}
+		if ok {
+			tx.log(wal.OpZRem, key, "", wal.WithField(member), wal.WithVersion(tx.txn.LastVersion()))
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// ZScore returns the score of a member of the sorted set stored at key
+func (tx *Tx) ZScore(key, member string) (float64, bool, error) {
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordRead(key)
+		tx.e.trackRequestRate()
+	}
+	z, err := tx.txn.ZSet(key)
+	if z == nil || err != nil {
+		return 0, false, err
+	}
+	score, ok := z.Score(member)
+	return score, ok, nil
+}
+
+// ZIncrBy adds delta to the score of a member and returns the new score
+func (tx *Tx) ZIncrBy(key, member string, delta float64) (float64, error) {
+	if err := tx.reserve(key, store.ElementSize(member)+8); err != nil {
+		return 0, err
+	}
+	current, _, err := tx.ZScore(key, member)
+	if err != nil {
+		return 0, err
+	}
+	score := current + delta
+	if math.IsNaN(score) {
+		return 0, ErrScoreNaN
+	}
+	if _, err := tx.zadd(key, member, score); err != nil {
+		return 0, err
+	}
+	return score, nil
+}
+
+// ZCard returns the number of members of the sorted set stored at key
+func (tx *Tx) ZCard(key string) (int, error) {
+	z, err := tx.txn.ZSet(key)
+	if z == nil || err != nil {
+		return 0, err
+	}
+	return z.Len(), nil
+}
+
+// ZRank returns the rank of a member of the sorted set stored at key
+func (tx *Tx) ZRank(key, member string, rev bool) (int, bool, error) {
+	z, err := tx.txn.ZSet(key)
+	if z == nil || err != nil {
+		return 0, false, err
+	}
+	rank, ok := z.Rank(member)
+	if ok && rev {
+		rank = z.Len() - 1 - rank
+	}
+	return rank, ok, nil
+}
+
+// ZCount returns the number of members with scores between min and max
+func (tx *Tx) ZCount(key string, min, max ScoreBound) (int, error) {
+	z, err := tx.txn.ZSet(key)
+	if z == nil || err != nil {
+		return 0, err
+	}
+	return z.CountByScore(min, max), nil
+}
+
+// ZRangeByRank returns the members from start to stop inclusive
+func (tx *Tx) ZRangeByRank(key string, start, stop int, rev bool) ([]ZMember, error) {
+	z, err := tx.zsetForRead(key)
+	if z == nil || err != nil {
+		return nil, err
+	}
+	return z.RangeByRank(start, stop, rev), nil
+}
+
+// ZRangeByScore returns the members with scores between min and max
+func (tx *Tx) ZRangeByScore(key string, min, max ScoreBound, rev bool, offset, count int) ([]ZMember, error) {
+	z, err := tx.zsetForRead(key)
+	if z == nil || err != nil {
+		return nil, err
+	}
+	return z.RangeByScore(min, max, rev, offset, count), nil
+}
+
+// ZRangeByLex returns the members between min and max in member order
+func (tx *Tx) ZRangeByLex(key string, min, max LexBound, rev bool, offset, count int) ([]ZMember, error) {
+	z, err := tx.zsetForRead(key)
+	if z == nil || err != nil {
+		return nil, err
+	}
+	return z.RangeByLex(min, max, rev, offset, count), nil
+}
+
+// ZRemRangeByScore removes the members with scores between min and max
+func (tx *Tx) ZRemRangeByScore(key string, min, max ScoreBound) (int, error) {
+	z, err := tx.txn.ZSet(key)
+	if z == nil || err != nil {
+		return 0, err
+	}
+	members := z.RangeByScore(min, max, false, 0, -1)
+	return tx.ZRem(key, memberNames(members)...)
+}
+
+// zpop removes up to count members from the low or high end of a sorted set
+func (tx *Tx) zpop(key string, count int, max bool) ([]ZMember, error) {
+	z, err := tx.txn.ZSet(key)
+	if z == nil || err != nil || count <= 0 {
+		return nil, err
+	}
+	members := z.RangeByRank(0, count-1, max)
+	if _, err := tx.ZRem(key, memberNames(members)...); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// ZPopMin removes and returns up to count members with the lowest scores
+func (tx *Tx) ZPopMin(key string, count int) ([]ZMember, error) {
+	return tx.zpop(key, count, false)
+}
+
+// ZPopMax removes and returns up to count members with the highest scores
+func (tx *Tx) ZPopMax(key string, count int) ([]ZMember, error) {
+	return tx.zpop(key, count, true)
+}
+
+// zsetForRead returns the sorted set stored at key and records the read
+func (tx *Tx) zsetForRead(key string) (*store.ZSet, error) {
+	if tx.e.enableAnalytics && tx.e.analytics != nil {
+		tx.e.analytics.RecordRead(key)
+		tx.e.trackRequestRate()
+	}
+	return tx.txn.ZSet(key)
+}
+
+// memberNames returns the members of a range without their scores
+func memberNames(members []ZMember) []string {
+	names := make([]string, len(members))
+	for i, m := range members {
+		names[i] = m.Member
+	}
+	return names
+}
+
+// replayZSet applies a sorted set record from the WAL
+func (e *Engine) replayZSet(record *wal.Record) error {
+	switch record.Op {
+	case wal.OpZAdd:
+		score, err := strconv.ParseFloat(record.Value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid score %q: %w", record.Value, err)
+		}
+		e.store.RestoreZSet(record.Key, record.Version, func(z *store.ZSet) {
+			z.Add(record.Field, score)
+		})
+	case wal.OpZRem:
+		e.store.RestoreZSet(record.Key, record.Version, func(z *store.ZSet) {
+			z.Remove(record.Field)
+		})
+	}
+	return nil
+}
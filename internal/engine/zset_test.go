@@ -0,0 +1,217 @@
+// internal/engine/zset_test.go
+package engine
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var (
+	negInf = ScoreBound{Value: math.Inf(-1)}
+	posInf = ScoreBound{Value: math.Inf(1)}
+)
+
+func TestEngine_ZSet(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	board := []ZMember{{Member: "alice", Score: 30}, {Member: "bob", Score: 10}, {Member: "carol", Score: 20}}
+	if n, err := engine.ZAdd("board", board, ZAddOptions{}); err != nil || n != 3 {
+		t.Fatalf("ZAdd: %d, %v", n, err)
+	}
+
+	if score, ok, _ := engine.ZScore("board", "carol"); !ok || score != 20 {
+		t.Errorf("Expected carol=20, got %v (exists: %v)", score, ok)
+	}
+	if score, _ := engine.ZIncrBy("board", "bob", 25); score != 35 {
+		t.Errorf("Expected bob=35, got %v", score)
+	}
+	if rank, ok, _ := engine.ZRank("board", "bob", true); !ok || rank != 0 {
+		t.Errorf("Expected bob to lead, got rank %d", rank)
+	}
+
+	top, _ := engine.ZRangeByRank("board", 0, 1, true)
+	if len(top) != 2 || top[0].Member != "bob" || top[1].Member != "alice" {
+		t.Errorf("Unexpected top 2: %v", top)
+	}
+	mid, _ := engine.ZRangeByScore("board", ScoreBound{Value: 20}, ScoreBound{Value: 35, Exclusive: true}, false, 0, -1)
+	if len(mid) != 2 || mid[0].Member != "carol" || mid[1].Member != "alice" {
+		t.Errorf("Unexpected score range: %v", mid)
+	}
+	if n, _ := engine.ZCount("board", negInf, posInf); n != 3 {
+		t.Errorf("Expected ZCount 3, got %d", n)
+	}
+
+	if popped, _ := engine.ZPopMin("board", 1); len(popped) != 1 || popped[0].Member != "carol" {
+		t.Errorf("Unexpected ZPopMin: %v", popped)
+	}
+	if popped, _ := engine.ZPopMax("board", 5); len(popped) != 2 || popped[0].Member != "bob" {
+		t.Errorf("Unexpected ZPopMax: %v", popped)
+	}
+	if engine.Exists("board") {
+		t.Error("Expected sorted set to be removed with its last member")
+	}
+}
+
+func TestEngine_ZAddOptions(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_, _ = engine.ZAdd("z", []ZMember{{Member: "a", Score: 5}}, ZAddOptions{})
+
+	tests := []struct {
+		name  string
+		opts  ZAddOptions
+		score float64
+		want  float64
+		n     int
+	}{
+		{"NX keeps existing", ZAddOptions{NX: true}, 1, 5, 0},
+		{"GT ignores lower", ZAddOptions{GT: true, CH: true}, 3, 5, 0},
+		{"GT takes higher", ZAddOptions{GT: true, CH: true}, 8, 8, 1},
+		{"LT takes lower", ZAddOptions{LT: true, CH: true}, 2, 2, 1},
+		{"XX updates", ZAddOptions{XX: true}, 4, 4, 0},
+	}
+	for _, tt := range tests {
+		n, err := engine.ZAdd("z", []ZMember{{Member: "a", Score: tt.score}}, tt.opts)
+		if err != nil || n != tt.n {
+			t.Errorf("%s: expected %d, got %d (%v)", tt.name, tt.n, n, err)
+		}
+		if score, _, _ := engine.ZScore("z", "a"); score != tt.want {
+			t.Errorf("%s: expected score %v, got %v", tt.name, tt.want, score)
+		}
+	}
+
+	_, _ = engine.ZAdd("z", []ZMember{{Member: "new", Score: 1}}, ZAddOptions{XX: true})
+	if _, ok, _ := engine.ZScore("z", "new"); ok {
+		t.Error("XX should not add members")
+	}
+	if _, err := engine.ZAdd("z", nil, ZAddOptions{NX: true, GT: true}); !errors.Is(err, ErrZAddOptions) {
+		t.Errorf("Expected ErrZAddOptions, got %v", err)
+	}
+
+	_, _ = engine.ZAdd("inf", []ZMember{{Member: "a", Score: math.Inf(1)}}, ZAddOptions{})
+	if _, err := engine.ZIncrBy("inf", "a", math.Inf(-1)); !errors.Is(err, ErrScoreNaN) {
+		t.Errorf("Expected ErrScoreNaN, got %v", err)
+	}
+}
+
+func TestEngine_ZSet_SlidingWindow(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	// A log of request timestamps, trimmed to the window on every request
+	for ts := 1; ts <= 10; ts++ {
+		_, _ = engine.ZAdd("log", []ZMember{{Member: string(rune('a' + ts)), Score: float64(ts)}}, ZAddOptions{})
+	}
+	if n, _ := engine.ZRemRangeByScore("log", negInf, ScoreBound{Value: 7}); n != 7 {
+		t.Errorf("Expected 7 expired entries, got %d", n)
+	}
+	if n, _ := engine.ZCard("log"); n != 3 {
+		t.Errorf("Expected 3 entries in window, got %d", n)
+	}
+}
+
+func TestEngine_ZSet_WrongType(t *testing.T) {
+	engine, err := New(Options{WALPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	_ = engine.Set("str", "1")
+	if _, err := engine.ZAdd("str", []ZMember{{Member: "a", Score: 1}}, ZAddOptions{}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from ZAdd on string, got %v", err)
+	}
+	if _, err := engine.ZRangeByRank("str", 0, -1, false); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from ZRangeByRank on string, got %v", err)
+	}
+}
+
+func TestEngine_ZSet_Recovery(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	engine1, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_, _ = engine1.ZAdd("snap", []ZMember{{Member: "a", Score: 1}, {Member: "b", Score: math.Inf(1)}}, ZAddOptions{})
+	engine1.Expire("snap", time.Hour)
+	if err := engine1.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	// Member-level changes after the snapshot come from the WAL
+	_, _ = engine1.ZIncrBy("snap", "a", 0.5)
+	_, _ = engine1.ZAdd("snap", []ZMember{{Member: "c|d", Score: -2}}, ZAddOptions{})
+	_, _ = engine1.ZPopMax("snap", 1)
+	version := engine1.Version("snap")
+	engine1.Close()
+
+	engine2, err := New(Options{WALPath: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	want := []ZMember{{Member: "c|d", Score: -2}, {Member: "a", Score: 1.5}}
+	if got, _ := engine2.ZRangeByRank("snap", 0, -1, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v after recovery, got %v", want, got)
+	}
+	if ttl := engine2.TTL("snap"); ttl <= 0 {
+		t.Error("Expected sorted set TTL to survive recovery")
+	}
+	if v := engine2.Version("snap"); v != version {
+		t.Errorf("Expected version %d after recovery, got %d", version, v)
+	}
+}
+
+func TestEngine_ZSet_RecoveryAfterExpiry(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// The server stops before the TTLs pass, so no DELETE is logged
+	engine1, err := New(Options{WALPath: tmpDir, TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	_, _ = engine1.ZAdd("z", []ZMember{{Member: "a", Score: 1}, {Member: "b", Score: 2}}, ZAddOptions{})
+	engine1.Expire("z", 50*time.Millisecond)
+	_, _ = engine1.ZAdd("z", []ZMember{{Member: "c", Score: 3}}, ZAddOptions{})
+	_, _ = engine1.ZRem("z", "a")
+
+	// Geo keys are sorted sets too
+	points := sicily()
+	_, _ = engine1.GeoAdd("geo", points[:1], ZAddOptions{})
+	engine1.Expire("geo", 50*time.Millisecond)
+	_, _ = engine1.GeoAdd("geo", points[1:], ZAddOptions{})
+	engine1.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Replaying the later changes must not bring the sets back without
+	// their TTL
+	engine2, err := New(Options{WALPath: tmpDir, TTLCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine2.Close()
+
+	for _, key := range []string{"z", "geo"} {
+		if engine2.Exists(key) {
+			members, _ := engine2.ZRangeByRank(key, 0, -1, false)
+			t.Errorf("Expected the expired sorted set %s to stay expired, got %v with TTL %v", key, members, engine2.TTL(key))
+		}
+	}
+}
@@ -0,0 +1,728 @@
+// internal/script/eval.go
+package script
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// maxCallDepth bounds the nesting of function calls
+	maxCallDepth = 200
+
+	// maxStringLen bounds the strings scripts can build
+	maxStringLen = 64 << 20
+
+	// checkInterval is the number of steps between deadline checks
+	checkInterval = 1000
+
+	// entrySize is roughly what a table entry costs, without its key and
+	// value
+	entrySize = 64
+)
+
+// scope holds the local variables of a block. Lookups scan from the end
+// so that a later local shadows an earlier one of the same name.
+type scope struct {
+	names  []string
+	cells  []*Value
+	parent *scope
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{parent: parent}
+}
+
+// declare adds a local variable
+func (sc *scope) declare(name string, v Value) {
+	cell := new(Value)
+	*cell = v
+	sc.names = append(sc.names, name)
+	sc.cells = append(sc.cells, cell)
+}
+
+// lookup returns the cell of a local variable, nil for a global
+func (sc *scope) lookup(name string) *Value {
+	for ; sc != nil; sc = sc.parent {
+		for i := len(sc.names) - 1; i >= 0; i-- {
+			if sc.names[i] == name {
+				return sc.cells[i]
+			}
+		}
+	}
+	return nil
+}
+
+// signal is how a statement ends
+type signal int
+
+const (
+	normal signal = iota
+	breaking
+	returning
+)
+
+// interp runs a script
+type interp struct {
+	globals  *Table
+	strlib   *Table // String library, for method calls on strings
+	deadline time.Time
+	steps    int
+	depth    int
+
+	// Bytes allocated so far and the limit, see alloc
+	allocated int64
+	maxMemory int64
+}
+
+// step counts an execution step, failing once the deadline has passed
+func (in *interp) step() error {
+	in.steps++
+	if in.steps%checkInterval == 0 && !in.deadline.IsZero() && time.Now().After(in.deadline) {
+		return ErrTimeout
+	}
+	return nil
+}
+
+// alloc counts n bytes allocated by the script, failing once the total
+// passes the limit of the run. Only strings and table entries are counted,
+// as they are what a script can grow without bound; everything else is
+// bounded by the deadline and the call depth.
+func (in *interp) alloc(n int) error {
+	in.allocated += int64(n)
+	if in.allocated > in.maxMemory {
+		return ErrMemory
+	}
+	return nil
+}
+
+// errorf returns a runtime error at line
+func errorf(line int, format string, args ...any) error {
+	return &Error{Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// atLine gives an error raised by a Go function the line of the call
+func atLine(err error, line int) error {
+	var e *Error
+	switch {
+	case errors.Is(err, ErrTimeout), errors.Is(err, ErrMemory):
+		return err
+	case errors.As(err, &e):
+		if e.Line == 0 {
+			e.Line = line
+		}
+		return e
+	}
+	return &Error{Line: line, Msg: err.Error()}
+}
+
+// execBlock runs a block in a new scope
+func (in *interp) execBlock(b *block, parent *scope) (signal, []Value, error) {
+	return in.execStmts(b.stmts, newScope(parent))
+}
+
+// execStmts runs statements in a scope
+func (in *interp) execStmts(stmts []stmt, sc *scope) (signal, []Value, error) {
+	for _, s := range stmts {
+		if err := in.step(); err != nil {
+			return normal, nil, err
+		}
+		sig, values, err := in.exec(s, sc)
+		if err != nil || sig != normal {
+			return sig, values, err
+		}
+	}
+	return normal, nil, nil
+}
+
+// exec runs a statement
+func (in *interp) exec(s stmt, sc *scope) (signal, []Value, error) {
+	switch s := s.(type) {
+	case *localStmt:
+		values, err := in.evalList(s.exprs, sc)
+		if err != nil {
+			return normal, nil, err
+		}
+		for i, name := range s.names {
+			sc.declare(name, valueAt(values, i))
+		}
+
+	case *localFunctionStmt:
+		sc.declare(s.name, nil)
+		*sc.lookup(s.name) = &closure{fn: s.fn, env: sc}
+
+	case *assignStmt:
+		return normal, nil, in.assign(s, sc)
+
+	case *callStmt:
+		_, err := in.evalMulti(s.call, sc)
+		return normal, nil, err
+
+	case *doStmt:
+		return in.execBlock(s.body, sc)
+
+	case *whileStmt:
+		for {
+			if err := in.step(); err != nil {
+				return normal, nil, err
+			}
+			cond, err := in.eval(s.cond, sc)
+			if err != nil || !truthy(cond) {
+				return normal, nil, err
+			}
+			sig, values, err := in.execBlock(s.body, sc)
+			if err != nil || sig == returning {
+				return sig, values, err
+			}
+			if sig == breaking {
+				return normal, nil, nil
+			}
+		}
+
+	case *repeatStmt:
+		for {
+			if err := in.step(); err != nil {
+				return normal, nil, err
+			}
+			// The condition sees the locals of the body
+			body := newScope(sc)
+			sig, values, err := in.execStmts(s.body.stmts, body)
+			if err != nil || sig == returning {
+				return sig, values, err
+			}
+			if sig == breaking {
+				return normal, nil, nil
+			}
+			cond, err := in.eval(s.cond, body)
+			if err != nil || truthy(cond) {
+				return normal, nil, err
+			}
+		}
+
+	case *ifStmt:
+		for i, c := range s.conds {
+			cond, err := in.eval(c, sc)
+			if err != nil {
+				return normal, nil, err
+			}
+			if truthy(cond) {
+				return in.execBlock(s.blocks[i], sc)
+			}
+		}
+		if s.orElse != nil {
+			return in.execBlock(s.orElse, sc)
+		}
+
+	case *numericForStmt:
+		return in.numericFor(s, sc)
+
+	case *genericForStmt:
+		return in.genericFor(s, sc)
+
+	case *returnStmt:
+		values, err := in.evalList(s.exprs, sc)
+		return returning, values, err
+
+	case *breakStmt:
+		return breaking, nil, nil
+
+	default:
+		return normal, nil, fmt.Errorf("unknown statement %T", s)
+	}
+	return normal, nil, nil
+}
+
+// assign evaluates the targets and values of an assignment, then stores
+// the values
+func (in *interp) assign(s *assignStmt, sc *scope) error {
+	type target struct {
+		cell     *Value
+		table    *Table
+		key      Value
+		name     string
+		nameLine int
+	}
+	targets := make([]target, len(s.targets))
+	for i, e := range s.targets {
+		switch e := e.(type) {
+		case *nameExpr:
+			if cell := sc.lookup(e.name); cell != nil {
+				targets[i].cell = cell
+			} else {
+				targets[i].name, targets[i].nameLine = e.name, e.line
+			}
+		case *indexExpr:
+			obj, err := in.eval(e.obj, sc)
+			if err != nil {
+				return err
+			}
+			t, ok := obj.(*Table)
+			if !ok {
+				return errorf(e.line, "attempt to index a %s value", typeName(obj))
+			}
+			key, err := in.eval(e.key, sc)
+			if err != nil {
+				return err
+			}
+			targets[i].table, targets[i].key = t, key
+		}
+	}
+
+	values, err := in.evalList(s.exprs, sc)
+	if err != nil {
+		return err
+	}
+	for i, t := range targets {
+		v := valueAt(values, i)
+		switch {
+		case t.cell != nil:
+			*t.cell = v
+		case t.table != nil:
+			if v != nil && t.table.Get(t.key) == nil {
+				if err := in.alloc(entrySize); err != nil {
+					return err
+				}
+			}
+			if err := t.table.Set(t.key, v); err != nil {
+				return atLine(err, s.line)
+			}
+		default:
+			return errorf(t.nameLine, "attempt to create global variable '%s'", t.name)
+		}
+	}
+	return nil
+}
+
+func (in *interp) numericFor(s *numericForStmt, sc *scope) (signal, []Value, error) {
+	var bounds [3]float64
+	bounds[2] = 1
+	for i, e := range []expr{s.start, s.limit, s.step} {
+		if e == nil {
+			continue
+		}
+		v, err := in.eval(e, sc)
+		if err != nil {
+			return normal, nil, err
+		}
+		n, ok := ToNumber(v)
+		if !ok {
+			what := [...]string{"initial value", "limit", "step"}[i]
+			return normal, nil, errorf(s.line, "'for' %s must be a number", what)
+		}
+		bounds[i] = n
+	}
+
+	start, limit, step := bounds[0], bounds[1], bounds[2]
+	for v := start; (step > 0 && v <= limit) || (step <= 0 && v >= limit); v += step {
+		if err := in.step(); err != nil {
+			return normal, nil, err
+		}
+		body := newScope(sc)
+		body.declare(s.name, v)
+		sig, values, err := in.execStmts(s.body.stmts, body)
+		if err != nil || sig == returning {
+			return sig, values, err
+		}
+		if sig == breaking {
+			break
+		}
+	}
+	return normal, nil, nil
+}
+
+func (in *interp) genericFor(s *genericForStmt, sc *scope) (signal, []Value, error) {
+	init, err := in.evalList(s.exprs, sc)
+	if err != nil {
+		return normal, nil, err
+	}
+	fn, state, control := valueAt(init, 0), valueAt(init, 1), valueAt(init, 2)
+	for {
+		if err := in.step(); err != nil {
+			return normal, nil, err
+		}
+		values, err := in.call(fn, []Value{state, control}, s.line)
+		if err != nil {
+			return normal, nil, err
+		}
+		if control = valueAt(values, 0); control == nil {
+			return normal, nil, nil
+		}
+		body := newScope(sc)
+		for i, name := range s.names {
+			body.declare(name, valueAt(values, i))
+		}
+		sig, values, err := in.execStmts(s.body.stmts, body)
+		if err != nil || sig == returning {
+			return sig, values, err
+		}
+		if sig == breaking {
+			return normal, nil, nil
+		}
+	}
+}
+
+// valueAt returns values[i], nil past the end
+func valueAt(values []Value, i int) Value {
+	if i < len(values) {
+		return values[i]
+	}
+	return nil
+}
+
+// evalList evaluates expressions; the values of a call in last position
+// are all kept
+func (in *interp) evalList(exprs []expr, sc *scope) ([]Value, error) {
+	values := make([]Value, 0, len(exprs))
+	for i, e := range exprs {
+		if i == len(exprs)-1 {
+			last, err := in.evalMulti(e, sc)
+			if err != nil {
+				return nil, err
+			}
+			return append(values, last...), nil
+		}
+		v, err := in.eval(e, sc)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// evalMulti evaluates an expression that may have several values
+func (in *interp) evalMulti(e expr, sc *scope) ([]Value, error) {
+	switch e := e.(type) {
+	case *callExpr:
+		fn, err := in.eval(e.fn, sc)
+		if err != nil {
+			return nil, err
+		}
+		args, err := in.evalList(e.args, sc)
+		if err != nil {
+			return nil, err
+		}
+		return in.call(fn, args, e.line)
+
+	case *methodExpr:
+		obj, err := in.eval(e.obj, sc)
+		if err != nil {
+			return nil, err
+		}
+		fn, err := in.index(obj, e.name, e.line)
+		if err != nil {
+			return nil, err
+		}
+		args, err := in.evalList(e.args, sc)
+		if err != nil {
+			return nil, err
+		}
+		return in.call(fn, append([]Value{obj}, args...), e.line)
+	}
+	v, err := in.eval(e, sc)
+	if err != nil {
+		return nil, err
+	}
+	return []Value{v}, nil
+}
+
+// eval evaluates an expression to a single value
+func (in *interp) eval(e expr, sc *scope) (Value, error) {
+	switch e := e.(type) {
+	case *constExpr:
+		return e.value, nil
+
+	case *nameExpr:
+		if cell := sc.lookup(e.name); cell != nil {
+			return *cell, nil
+		}
+		v := in.globals.Get(e.name)
+		if v == nil {
+			return nil, errorf(e.line, "attempt to access nonexistent global variable '%s'", e.name)
+		}
+		return v, nil
+
+	case *indexExpr:
+		obj, err := in.eval(e.obj, sc)
+		if err != nil {
+			return nil, err
+		}
+		key, err := in.eval(e.key, sc)
+		if err != nil {
+			return nil, err
+		}
+		return in.index(obj, key, e.line)
+
+	case *callExpr, *methodExpr:
+		values, err := in.evalMulti(e, sc)
+		return valueAt(values, 0), err
+
+	case *parenExpr:
+		return in.eval(e.x, sc)
+
+	case *functionExpr:
+		return &closure{fn: e, env: sc}, nil
+
+	case *tableExpr:
+		return in.table(e, sc)
+
+	case *unaryExpr:
+		x, err := in.eval(e.x, sc)
+		if err != nil {
+			return nil, err
+		}
+		return unary(e.op, x, e.line)
+
+	case *binaryExpr:
+		l, err := in.eval(e.l, sc)
+		if err != nil {
+			return nil, err
+		}
+		// and and or only evaluate their right operand when needed
+		switch e.op {
+		case "and":
+			if !truthy(l) {
+				return l, nil
+			}
+			return in.eval(e.r, sc)
+		case "or":
+			if truthy(l) {
+				return l, nil
+			}
+			return in.eval(e.r, sc)
+		}
+		r, err := in.eval(e.r, sc)
+		if err != nil {
+			return nil, err
+		}
+		v, err := binary(e.op, l, r, e.line)
+		if err != nil {
+			return nil, err
+		}
+		if str, ok := v.(string); ok {
+			if err := in.alloc(len(str)); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("unknown expression %T", e)
+}
+
+// index returns obj[key]; strings index the string library
+func (in *interp) index(obj, key Value, line int) (Value, error) {
+	switch obj := obj.(type) {
+	case *Table:
+		return obj.Get(key), nil
+	case string:
+		return in.strlib.Get(key), nil
+	}
+	return nil, errorf(line, "attempt to index a %s value", typeName(obj))
+}
+
+func (in *interp) table(e *tableExpr, sc *scope) (Value, error) {
+	t := NewTable()
+	n := 0
+	for i, item := range e.items {
+		if item.key != nil {
+			key, err := in.eval(item.key, sc)
+			if err != nil {
+				return nil, err
+			}
+			v, err := in.eval(item.value, sc)
+			if err != nil {
+				return nil, err
+			}
+			if err := in.alloc(entrySize); err != nil {
+				return nil, err
+			}
+			if err := t.Set(key, v); err != nil {
+				return nil, atLine(err, e.line)
+			}
+			continue
+		}
+
+		// A call in last position adds all its values
+		var values []Value
+		var err error
+		if i == len(e.items)-1 {
+			values, err = in.evalMulti(item.value, sc)
+		} else {
+			var v Value
+			v, err = in.eval(item.value, sc)
+			values = []Value{v}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := in.alloc(entrySize * len(values)); err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			n++
+			_ = t.Set(float64(n), v)
+		}
+	}
+	return t, nil
+}
+
+// call calls a function value
+func (in *interp) call(fn Value, args []Value, line int) ([]Value, error) {
+	if err := in.step(); err != nil {
+		return nil, err
+	}
+	if in.depth >= maxCallDepth {
+		return nil, errorf(line, "stack overflow")
+	}
+	in.depth++
+	defer func() { in.depth-- }()
+
+	switch fn := fn.(type) {
+	case *GoFunction:
+		values, err := fn.Fn(args)
+		if err != nil {
+			return nil, atLine(err, line)
+		}
+		return values, nil
+
+	case *closure:
+		sc := newScope(fn.env)
+		for i, name := range fn.fn.params {
+			sc.declare(name, valueAt(args, i))
+		}
+		sig, values, err := in.execStmts(fn.fn.body.stmts, sc)
+		if err != nil {
+			return nil, err
+		}
+		if sig == breaking {
+			return nil, errorf(line, "break outside a loop")
+		}
+		return values, nil
+	}
+	return nil, errorf(line, "attempt to call a %s value", typeName(fn))
+}
+
+func unary(op string, x Value, line int) (Value, error) {
+	switch op {
+	case "not":
+		return !truthy(x), nil
+	case "-":
+		n, ok := ToNumber(x)
+		if !ok {
+			return nil, errorf(line, "attempt to perform arithmetic on a %s value", typeName(x))
+		}
+		return -n, nil
+	case "#":
+		switch x := x.(type) {
+		case string:
+			return float64(len(x)), nil
+		case *Table:
+			return float64(x.Len()), nil
+		}
+		return nil, errorf(line, "attempt to get length of a %s value", typeName(x))
+	}
+	return nil, errorf(line, "unknown operator %s", op)
+}
+
+func binary(op string, l, r Value, line int) (Value, error) {
+	switch op {
+	case "==":
+		return equal(l, r), nil
+	case "~=":
+		return !equal(l, r), nil
+	case "<", "<=", ">", ">=":
+		return compare(op, l, r, line)
+	case "..":
+		return concat(l, r, line)
+	}
+
+	a, ok := ToNumber(l)
+	if !ok {
+		return nil, errorf(line, "attempt to perform arithmetic on a %s value", typeName(l))
+	}
+	b, ok := ToNumber(r)
+	if !ok {
+		return nil, errorf(line, "attempt to perform arithmetic on a %s value", typeName(r))
+	}
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		return a / b, nil
+	case "%":
+		return a - math.Floor(a/b)*b, nil
+	case "^":
+		return math.Pow(a, b), nil
+	}
+	return nil, errorf(line, "unknown operator %s", op)
+}
+
+// equal compares values without conversions
+func equal(l, r Value) bool {
+	if a, ok := l.(float64); ok {
+		b, ok := r.(float64)
+		return ok && a == b
+	}
+	switch l.(type) {
+	case *closure, *GoFunction, *Table, string, bool, nil:
+		return l == r
+	}
+	return false
+}
+
+// compare orders two numbers or two strings
+func compare(op string, l, r Value, line int) (Value, error) {
+	var less, eq bool
+	switch a := l.(type) {
+	case float64:
+		b, ok := r.(float64)
+		if !ok {
+			return nil, errorf(line, "attempt to compare number with %s", typeName(r))
+		}
+		less, eq = a < b, a == b
+	case string:
+		b, ok := r.(string)
+		if !ok {
+			return nil, errorf(line, "attempt to compare string with %s", typeName(r))
+		}
+		less, eq = a < b, a == b
+	default:
+		return nil, errorf(line, "attempt to compare two %s values", typeName(l))
+	}
+
+	switch op {
+	case "<":
+		return less, nil
+	case "<=":
+		return less || eq, nil
+	case ">":
+		return !less && !eq, nil
+	}
+	return !less, nil
+}
+
+// concat joins two strings or numbers
+func concat(l, r Value, line int) (Value, error) {
+	var parts [2]string
+	for i, v := range []Value{l, r} {
+		switch v := v.(type) {
+		case string:
+			parts[i] = v
+		case float64:
+			parts[i] = formatNumber(v)
+		default:
+			return nil, errorf(line, "attempt to concatenate a %s value", typeName(v))
+		}
+	}
+	if len(parts[0])+len(parts[1]) > maxStringLen {
+		return nil, errorf(line, "string length overflow")
+	}
+	return strings.Join(parts[:], ""), nil
+}
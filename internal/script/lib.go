@@ -0,0 +1,607 @@
+// internal/script/lib.go
+package script
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The standard library is the deterministic part of the Lua 5.1 one:
+// there is no io, os, load or math.random.
+
+// builtins returns the global table of a run
+func (in *interp) builtins() *Table {
+	g := NewTable()
+	set := func(t *Table, name string, fn func(args []Value) ([]Value, error)) {
+		_ = t.Set(name, &GoFunction{Name: name, Fn: fn})
+	}
+
+	set(g, "type", func(args []Value) ([]Value, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("bad argument #1 to 'type' (value expected)")
+		}
+		return []Value{typeName(args[0])}, nil
+	})
+	set(g, "tostring", func(args []Value) ([]Value, error) {
+		return []Value{ToString(valueAt(args, 0))}, nil
+	})
+	set(g, "tonumber", libToNumber)
+	set(g, "next", func(args []Value) ([]Value, error) {
+		t, err := argTable("next", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		k, v, err := t.Next(valueAt(args, 1))
+		if err != nil {
+			return nil, err
+		}
+		return []Value{k, v}, nil
+	})
+	next := g.Get("next")
+	set(g, "pairs", func(args []Value) ([]Value, error) {
+		t, err := argTable("pairs", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return []Value{next, t, nil}, nil
+	})
+	inext := &GoFunction{Name: "ipairs", Fn: func(args []Value) ([]Value, error) {
+		t, err := argTable("ipairs", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		i, err := argNumber("ipairs", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		i++
+		v := t.Get(i)
+		if v == nil {
+			return []Value{nil}, nil
+		}
+		return []Value{i, v}, nil
+	}}
+	set(g, "ipairs", func(args []Value) ([]Value, error) {
+		t, err := argTable("ipairs", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return []Value{inext, t, float64(0)}, nil
+	})
+	set(g, "unpack", libUnpack)
+	set(g, "error", func(args []Value) ([]Value, error) {
+		v := valueAt(args, 0)
+		return nil, &Error{Msg: ToString(v), Value: v}
+	})
+	set(g, "assert", func(args []Value) ([]Value, error) {
+		if len(args) == 0 || !truthy(args[0]) {
+			msg := "assertion failed!"
+			if len(args) > 1 {
+				msg = ToString(args[1])
+			}
+			return nil, &Error{Msg: msg}
+		}
+		return args, nil
+	})
+	set(g, "pcall", func(args []Value) ([]Value, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("bad argument #1 to 'pcall' (value expected)")
+		}
+		values, err := in.call(args[0], args[1:], 0)
+		var e *Error
+		switch {
+		case err == nil:
+			return append([]Value{true}, values...), nil
+		case errors.As(err, &e):
+			// Raised values are returned as they are, runtime errors as
+			// their message
+			if e.Value != nil && !isString(e.Value) {
+				return []Value{false, e.Value}, nil
+			}
+			return []Value{false, e.Error()}, nil
+		}
+		// Timeouts and memory errors can't be caught
+		return nil, err
+	})
+
+	m := NewTable()
+	_ = g.Set("math", m)
+	_ = m.Set("huge", math.Inf(1))
+	_ = m.Set("pi", math.Pi)
+	for name, fn := range map[string]func(float64) float64{
+		"floor": math.Floor, "ceil": math.Ceil, "abs": math.Abs, "sqrt": math.Sqrt,
+		"exp": math.Exp, "log": math.Log,
+	} {
+		name, fn := name, fn
+		set(m, name, func(args []Value) ([]Value, error) {
+			x, err := argNumber(name, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return []Value{fn(x)}, nil
+		})
+	}
+	for name, fn := range map[string]func(float64, float64) float64{
+		"fmod": math.Mod, "pow": math.Pow,
+	} {
+		name, fn := name, fn
+		set(m, name, func(args []Value) ([]Value, error) {
+			x, err := argNumber(name, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			y, err := argNumber(name, args, 1)
+			if err != nil {
+				return nil, err
+			}
+			return []Value{fn(x, y)}, nil
+		})
+	}
+	set(m, "max", func(args []Value) ([]Value, error) { return libExtreme("max", args, 1) })
+	set(m, "min", func(args []Value) ([]Value, error) { return libExtreme("min", args, -1) })
+
+	s := NewTable()
+	_ = g.Set("string", s)
+	in.strlib = s
+	set(s, "len", func(args []Value) ([]Value, error) {
+		str, err := argString("len", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return []Value{float64(len(str))}, nil
+	})
+	set(s, "sub", libSub)
+	set(s, "upper", in.allocating(stringFunc("upper", strings.ToUpper)))
+	set(s, "lower", in.allocating(stringFunc("lower", strings.ToLower)))
+	set(s, "reverse", in.allocating(stringFunc("reverse", func(str string) string {
+		b := []byte(str)
+		for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+			b[i], b[j] = b[j], b[i]
+		}
+		return string(b)
+	})))
+	set(s, "rep", in.allocating(func(args []Value) ([]Value, error) {
+		str, err := argString("rep", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		n, err := argNumber("rep", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 || str == "" {
+			return []Value{""}, nil
+		}
+		if float64(len(str))*n > maxStringLen {
+			return nil, fmt.Errorf("resulting string too large")
+		}
+		return []Value{strings.Repeat(str, int(n))}, nil
+	}))
+	set(s, "byte", libByte)
+	set(s, "char", in.allocating(func(args []Value) ([]Value, error) {
+		b := make([]byte, len(args))
+		for i := range args {
+			c, err := argNumber("char", args, i)
+			if err != nil {
+				return nil, err
+			}
+			if c < 0 || c > 255 {
+				return nil, fmt.Errorf("bad argument #%d to 'char' (value out of range)", i+1)
+			}
+			b[i] = byte(c)
+		}
+		return []Value{string(b)}, nil
+	}))
+	set(s, "format", in.allocating(libFormat))
+
+	t := NewTable()
+	_ = g.Set("table", t)
+	set(t, "insert", func(args []Value) ([]Value, error) {
+		if err := in.alloc(entrySize); err != nil {
+			return nil, err
+		}
+		return libInsert(args)
+	})
+	set(t, "remove", libRemove)
+	set(t, "concat", in.allocating(libConcat))
+	set(t, "unpack", libUnpack)
+	set(t, "sort", func(args []Value) ([]Value, error) {
+		return nil, in.sort(args)
+	})
+	return g
+}
+
+// allocating wraps a library function that builds strings, so that the
+// strings it returns count against the memory limit
+func (in *interp) allocating(fn func(args []Value) ([]Value, error)) func(args []Value) ([]Value, error) {
+	return func(args []Value) ([]Value, error) {
+		values, err := fn(args)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			if str, ok := v.(string); ok {
+				if err := in.alloc(len(str)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return values, nil
+	}
+}
+
+func isString(v Value) bool {
+	_, ok := v.(string)
+	return ok
+}
+
+// argNumber returns argument i as a number
+func argNumber(fn string, args []Value, i int) (float64, error) {
+	n, ok := ToNumber(valueAt(args, i))
+	if !ok {
+		return 0, fmt.Errorf("bad argument #%d to '%s' (number expected, got %s)", i+1, fn, typeName(valueAt(args, i)))
+	}
+	return n, nil
+}
+
+// optNumber returns argument i as a number, def if it is missing
+func optNumber(fn string, args []Value, i int, def float64) (float64, error) {
+	if valueAt(args, i) == nil {
+		return def, nil
+	}
+	return argNumber(fn, args, i)
+}
+
+// argString returns argument i as a string; numbers are converted
+func argString(fn string, args []Value, i int) (string, error) {
+	switch v := valueAt(args, i).(type) {
+	case string:
+		return v, nil
+	case float64:
+		return formatNumber(v), nil
+	}
+	return "", fmt.Errorf("bad argument #%d to '%s' (string expected, got %s)", i+1, fn, typeName(valueAt(args, i)))
+}
+
+// argTable returns argument i as a table
+func argTable(fn string, args []Value, i int) (*Table, error) {
+	t, ok := valueAt(args, i).(*Table)
+	if !ok {
+		return nil, fmt.Errorf("bad argument #%d to '%s' (table expected, got %s)", i+1, fn, typeName(valueAt(args, i)))
+	}
+	return t, nil
+}
+
+func stringFunc(name string, fn func(string) string) func(args []Value) ([]Value, error) {
+	return func(args []Value) ([]Value, error) {
+		str, err := argString(name, args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return []Value{fn(str)}, nil
+	}
+}
+
+func libToNumber(args []Value) ([]Value, error) {
+	v := valueAt(args, 0)
+	if valueAt(args, 1) == nil {
+		n, ok := ToNumber(v)
+		if !ok {
+			return []Value{nil}, nil
+		}
+		return []Value{n}, nil
+	}
+
+	base, err := argNumber("tonumber", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if base < 2 || base > 36 {
+		return nil, fmt.Errorf("bad argument #2 to 'tonumber' (base out of range)")
+	}
+	str, err := argString("tonumber", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(str), int(base), 64)
+	if err != nil {
+		return []Value{nil}, nil
+	}
+	return []Value{float64(n)}, nil
+}
+
+func libExtreme(name string, args []Value, sign float64) ([]Value, error) {
+	best, err := argNumber(name, args, 0)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(args); i++ {
+		n, err := argNumber(name, args, i)
+		if err != nil {
+			return nil, err
+		}
+		if (n-best)*sign > 0 {
+			best = n
+		}
+	}
+	return []Value{best}, nil
+}
+
+// strRange converts the 1-based, possibly negative, bounds i and j of a
+// string of length n to a slice range
+func strRange(i, j float64, n int) (int, int) {
+	if i < 0 {
+		i = math.Max(float64(n)+i+1, 1)
+	} else if i == 0 {
+		i = 1
+	}
+	if j < 0 {
+		j = float64(n) + j + 1
+	} else if j > float64(n) {
+		j = float64(n)
+	}
+	if i > j {
+		return 0, 0
+	}
+	return int(i) - 1, int(j)
+}
+
+func libSub(args []Value) ([]Value, error) {
+	str, err := argString("sub", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	i, err := optNumber("sub", args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	j, err := optNumber("sub", args, 2, -1)
+	if err != nil {
+		return nil, err
+	}
+	from, to := strRange(i, j, len(str))
+	return []Value{str[from:to]}, nil
+}
+
+func libByte(args []Value) ([]Value, error) {
+	str, err := argString("byte", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	i, err := optNumber("byte", args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	j, err := optNumber("byte", args, 2, i)
+	if err != nil {
+		return nil, err
+	}
+	from, to := strRange(i, j, len(str))
+	var values []Value
+	for _, c := range []byte(str[from:to]) {
+		values = append(values, float64(c))
+	}
+	return values, nil
+}
+
+// libFormat implements string.format for the d, i, u, c, x, X, o, e, E, f,
+// g, G, q and s conversions
+func libFormat(args []Value) ([]Value, error) {
+	format, err := argString("format", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	arg := 1
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		start := i
+		for i++; i < len(format) && strings.IndexByte("-+ #0123456789.", format[i]) >= 0; i++ {
+		}
+		if i >= len(format) {
+			return nil, fmt.Errorf("invalid option '%%' to 'format'")
+		}
+		spec, verb := format[start:i], format[i]
+		if verb == '%' {
+			b.WriteByte('%')
+			continue
+		}
+
+		switch verb {
+		case 'd', 'i', 'u', 'c', 'x', 'X', 'o':
+			n, err := argNumber("format", args, arg)
+			if err != nil {
+				return nil, err
+			}
+			switch verb {
+			case 'i', 'u':
+				verb = 'd'
+			}
+			fmt.Fprintf(&b, spec+string(verb), int64(n))
+		case 'e', 'E', 'f', 'g', 'G':
+			n, err := argNumber("format", args, arg)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(&b, spec+string(verb), n)
+		case 'q':
+			str, err := argString("format", args, arg)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteString(strconv.Quote(str))
+		case 's':
+			fmt.Fprintf(&b, spec+"s", ToString(valueAt(args, arg)))
+		default:
+			return nil, fmt.Errorf("invalid option '%%%c' to 'format'", verb)
+		}
+		arg++
+		if b.Len() > maxStringLen {
+			return nil, fmt.Errorf("resulting string too large")
+		}
+	}
+	return []Value{b.String()}, nil
+}
+
+func libUnpack(args []Value) ([]Value, error) {
+	t, err := argTable("unpack", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	i, err := optNumber("unpack", args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	j, err := optNumber("unpack", args, 2, float64(t.Len()))
+	if err != nil {
+		return nil, err
+	}
+	if j-i >= 1e6 {
+		return nil, fmt.Errorf("too many results to unpack")
+	}
+	var values []Value
+	for k := i; k <= j; k++ {
+		values = append(values, t.Get(k))
+	}
+	return values, nil
+}
+
+func libInsert(args []Value) ([]Value, error) {
+	t, err := argTable("insert", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	n := t.Len()
+	switch len(args) {
+	case 2:
+		t.Append(args[1])
+	case 3:
+		pos, err := argNumber("insert", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if pos < 1 || pos > float64(n+1) {
+			return nil, fmt.Errorf("bad argument #2 to 'insert' (position out of bounds)")
+		}
+		for k := float64(n); k >= pos; k-- {
+			_ = t.Set(k+1, t.Get(k))
+		}
+		_ = t.Set(pos, args[2])
+	default:
+		return nil, fmt.Errorf("wrong number of arguments to 'insert'")
+	}
+	return nil, nil
+}
+
+func libRemove(args []Value) ([]Value, error) {
+	t, err := argTable("remove", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	n := float64(t.Len())
+	if n == 0 {
+		return []Value{nil}, nil
+	}
+	pos, err := optNumber("remove", args, 1, n)
+	if err != nil {
+		return nil, err
+	}
+	if pos < 1 || pos > n {
+		return nil, fmt.Errorf("bad argument #2 to 'remove' (position out of bounds)")
+	}
+	v := t.Get(pos)
+	for k := pos; k < n; k++ {
+		_ = t.Set(k, t.Get(k+1))
+	}
+	_ = t.Set(n, nil)
+	return []Value{v}, nil
+}
+
+func libConcat(args []Value) ([]Value, error) {
+	t, err := argTable("concat", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	sep := ""
+	if valueAt(args, 1) != nil {
+		if sep, err = argString("concat", args, 1); err != nil {
+			return nil, err
+		}
+	}
+	i, err := optNumber("concat", args, 2, 1)
+	if err != nil {
+		return nil, err
+	}
+	j, err := optNumber("concat", args, 3, float64(t.Len()))
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	for k := i; k <= j; k++ {
+		v := t.Get(k)
+		switch v.(type) {
+		case string, float64:
+		default:
+			return nil, fmt.Errorf("invalid value (at index %d) in table for 'concat'", int(k))
+		}
+		if k > i {
+			b.WriteString(sep)
+		}
+		b.WriteString(ToString(v))
+		if b.Len() > maxStringLen {
+			return nil, fmt.Errorf("resulting string too large")
+		}
+	}
+	return []Value{b.String()}, nil
+}
+
+// sort implements table.sort, with < or a comparison function
+func (in *interp) sort(args []Value) error {
+	t, err := argTable("sort", args, 0)
+	if err != nil {
+		return err
+	}
+	less := valueAt(args, 1)
+
+	items := make([]Value, t.Len())
+	for i := range items {
+		items[i] = t.Get(float64(i + 1))
+	}
+	var failed error
+	sort.SliceStable(items, func(i, j int) bool {
+		if failed != nil {
+			return false
+		}
+		if less == nil {
+			v, err := compare("<", items[i], items[j], 0)
+			if err != nil {
+				failed = err
+				return false
+			}
+			return v.(bool)
+		}
+		values, err := in.call(less, []Value{items[i], items[j]}, 0)
+		if err != nil {
+			failed = err
+			return false
+		}
+		return truthy(valueAt(values, 0))
+	})
+	if failed != nil {
+		return failed
+	}
+	for i, v := range items {
+		_ = t.Set(float64(i+1), v)
+	}
+	return nil
+}
@@ -0,0 +1,796 @@
+// internal/script/parse.go
+package script
+
+import (
+	"fmt"
+)
+
+// The parser builds a syntax tree that eval.go walks. Expressions and
+// statements keep the line they start on for error messages.
+
+type expr interface{}
+
+type (
+	constExpr struct{ value Value }
+	nameExpr  struct {
+		name string
+		line int
+	}
+	indexExpr struct {
+		obj, key expr
+		line     int
+	}
+	callExpr struct {
+		fn   expr
+		args []expr
+		line int
+	}
+	methodExpr struct {
+		obj  expr
+		name string
+		args []expr
+		line int
+	}
+	functionExpr struct {
+		name   string // For error messages, "" for anonymous functions
+		params []string
+		body   *block
+		line   int
+	}
+	binaryExpr struct {
+		op   string
+		l, r expr
+		line int
+	}
+	unaryExpr struct {
+		op   string
+		x    expr
+		line int
+	}
+	parenExpr struct{ x expr }
+	tableExpr struct {
+		items []tableItem
+		line  int
+	}
+)
+
+// tableItem is a field of a table constructor; key is nil for positional
+// items
+type tableItem struct {
+	key, value expr
+}
+
+type stmt interface{}
+
+type (
+	localStmt struct {
+		names []string
+		exprs []expr
+		line  int
+	}
+	localFunctionStmt struct {
+		name string
+		fn   *functionExpr
+	}
+	assignStmt struct {
+		targets []expr
+		exprs   []expr
+		line    int
+	}
+	callStmt  struct{ call expr }
+	doStmt    struct{ body *block }
+	whileStmt struct {
+		cond expr
+		body *block
+	}
+	repeatStmt struct {
+		body *block
+		cond expr
+	}
+	ifStmt struct {
+		conds  []expr
+		blocks []*block
+		orElse *block // nil without else
+	}
+	numericForStmt struct {
+		name               string
+		start, limit, step expr // step is nil for 1
+		body               *block
+		line               int
+	}
+	genericForStmt struct {
+		names []string
+		exprs []expr
+		body  *block
+		line  int
+	}
+	returnStmt struct {
+		exprs []expr
+		line  int
+	}
+	breakStmt struct{ line int }
+)
+
+// block is a sequence of statements with its own scope
+type block struct {
+	stmts []stmt
+}
+
+// Binary operator priorities, left and right, as in the reference
+// implementation: ^ and .. are right associative
+var binaryPriority = map[string][2]int{
+	"or": {1, 1}, "and": {2, 2},
+	"<": {3, 3}, ">": {3, 3}, "<=": {3, 3}, ">=": {3, 3}, "~=": {3, 3}, "==": {3, 3},
+	"..": {5, 4},
+	"+":  {6, 6}, "-": {6, 6},
+	"*": {7, 7}, "/": {7, 7}, "%": {7, 7},
+	"^": {10, 9},
+}
+
+// unaryPriority binds tighter than every binary operator but ^
+const unaryPriority = 8
+
+// maxNesting bounds the nesting of blocks and expressions
+const maxNesting = 200
+
+// parser reads a syntax tree from tokens
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int // Nesting of the block or expression being read
+}
+
+// parse builds the syntax tree of a chunk
+func parse(src string) (*block, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "'<eof>' expected near '%s'", tok.text)
+	}
+	return body, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// is reports whether the next token is the keyword or operator text
+func (p *parser) is(text string) bool {
+	tok := p.peek()
+	return (tok.kind == tokKeyword || tok.kind == tokOp) && tok.text == text
+}
+
+// accept consumes the keyword or operator text if it is next
+func (p *parser) accept(text string) bool {
+	if p.is(text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expect consumes the keyword or operator text, failing if it isn't next
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		tok := p.peek()
+		return p.errorf(tok, "'%s' expected near %s", text, describe(tok))
+	}
+	return nil
+}
+
+// name consumes a name
+func (p *parser) name() (string, error) {
+	tok := p.peek()
+	if tok.kind != tokName {
+		return "", p.errorf(tok, "name expected near %s", describe(tok))
+	}
+	p.pos++
+	return tok.text, nil
+}
+
+func (p *parser) errorf(tok token, format string, args ...any) error {
+	return &Error{Line: tok.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// enter starts reading a nested block or expression
+func (p *parser) enter() error {
+	if p.depth++; p.depth > maxNesting {
+		return p.errorf(p.peek(), "too many nested blocks or expressions")
+	}
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+// describe quotes a token for error messages
+func describe(tok token) string {
+	if tok.kind == tokEOF {
+		return "<eof>"
+	}
+	return "'" + tok.text + "'"
+}
+
+// blockEnd reports whether the next token ends a block
+func (p *parser) blockEnd() bool {
+	tok := p.peek()
+	if tok.kind == tokEOF {
+		return true
+	}
+	if tok.kind != tokKeyword {
+		return false
+	}
+	switch tok.text {
+	case "end", "else", "elseif", "until":
+		return true
+	}
+	return false
+}
+
+// block reads statements up to the end of a block; return has to be the
+// last of them
+func (p *parser) block() (*block, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	b := &block{}
+	for !p.blockEnd() {
+		if p.is("return") {
+			s, err := p.returnStmt()
+			if err != nil {
+				return nil, err
+			}
+			b.stmts = append(b.stmts, s)
+			if !p.blockEnd() {
+				tok := p.peek()
+				return nil, p.errorf(tok, "'end' expected near %s", describe(tok))
+			}
+			break
+		}
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			b.stmts = append(b.stmts, s)
+		}
+	}
+	return b, nil
+}
+
+// statement reads one statement; it returns nil for an empty one
+func (p *parser) statement() (stmt, error) {
+	tok := p.peek()
+	switch {
+	case p.accept(";"):
+		return nil, nil
+
+	case p.accept("if"):
+		return p.ifStmt()
+
+	case p.accept("while"):
+		cond, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("do"); err != nil {
+			return nil, err
+		}
+		body, err := p.blockUntil("end")
+		if err != nil {
+			return nil, err
+		}
+		return &whileStmt{cond: cond, body: body}, nil
+
+	case p.accept("do"):
+		body, err := p.blockUntil("end")
+		if err != nil {
+			return nil, err
+		}
+		return &doStmt{body: body}, nil
+
+	case p.accept("for"):
+		return p.forStmt(tok.line)
+
+	case p.accept("repeat"):
+		body, err := p.blockUntil("until")
+		if err != nil {
+			return nil, err
+		}
+		cond, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return &repeatStmt{body: body, cond: cond}, nil
+
+	case p.accept("function"):
+		return p.functionStmt(tok.line)
+
+	case p.accept("local"):
+		if p.accept("function") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			fn, err := p.functionBody(name, tok.line, false)
+			if err != nil {
+				return nil, err
+			}
+			return &localFunctionStmt{name: name, fn: fn}, nil
+		}
+		return p.localStmt(tok.line)
+
+	case p.accept("break"):
+		return &breakStmt{line: tok.line}, nil
+	}
+	return p.exprStmt()
+}
+
+// blockUntil reads a block closed by the keyword end
+func (p *parser) blockUntil(end string) (*block, error) {
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(end); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (p *parser) ifStmt() (stmt, error) {
+	s := &ifStmt{}
+	for {
+		cond, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("then"); err != nil {
+			return nil, err
+		}
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		s.conds = append(s.conds, cond)
+		s.blocks = append(s.blocks, body)
+
+		switch {
+		case p.accept("elseif"):
+			continue
+		case p.accept("else"):
+			if s.orElse, err = p.blockUntil("end"); err != nil {
+				return nil, err
+			}
+			return s, nil
+		}
+		if err := p.expect("end"); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+}
+
+func (p *parser) forStmt(line int) (stmt, error) {
+	first, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.accept("=") {
+		s := &numericForStmt{name: first, line: line}
+		if s.start, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		if s.limit, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if p.accept(",") {
+			if s.step, err = p.expr(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expect("do"); err != nil {
+			return nil, err
+		}
+		if s.body, err = p.blockUntil("end"); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	s := &genericForStmt{names: []string{first}, line: line}
+	for p.accept(",") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		s.names = append(s.names, name)
+	}
+	if err := p.expect("in"); err != nil {
+		return nil, err
+	}
+	if s.exprs, err = p.exprList(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("do"); err != nil {
+		return nil, err
+	}
+	if s.body, err = p.blockUntil("end"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// functionStmt reads function a.b.c:m() ... end, an assignment of a
+// function
+func (p *parser) functionStmt(line int) (stmt, error) {
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	fullName := name
+	var target expr = &nameExpr{name: name, line: line}
+	method := false
+	for p.is(".") || p.is(":") {
+		method = p.advance().text == ":"
+		key, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		fullName += "." + key
+		target = &indexExpr{obj: target, key: &constExpr{value: key}, line: line}
+		if method {
+			break
+		}
+	}
+	fn, err := p.functionBody(fullName, line, method)
+	if err != nil {
+		return nil, err
+	}
+	return &assignStmt{targets: []expr{target}, exprs: []expr{fn}, line: line}, nil
+}
+
+// functionBody reads the parameters and body of a function; methods get
+// self as first parameter
+func (p *parser) functionBody(name string, line int, method bool) (*functionExpr, error) {
+	fn := &functionExpr{name: name, line: line}
+	if method {
+		fn.params = append(fn.params, "self")
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if !p.is(")") {
+		for {
+			if p.is("...") {
+				return nil, p.errorf(p.peek(), "variable arguments are not supported")
+			}
+			param, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			fn.params = append(fn.params, param)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	body, err := p.blockUntil("end")
+	if err != nil {
+		return nil, err
+	}
+	fn.body = body
+	return fn, nil
+}
+
+func (p *parser) localStmt(line int) (stmt, error) {
+	s := &localStmt{line: line}
+	for {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		s.names = append(s.names, name)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if p.accept("=") {
+		var err error
+		if s.exprs, err = p.exprList(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (p *parser) returnStmt() (stmt, error) {
+	tok := p.advance()
+	s := &returnStmt{line: tok.line}
+	if !p.blockEnd() && !p.is(";") {
+		var err error
+		if s.exprs, err = p.exprList(); err != nil {
+			return nil, err
+		}
+	}
+	p.accept(";")
+	return s, nil
+}
+
+// exprStmt reads a function call or an assignment
+func (p *parser) exprStmt() (stmt, error) {
+	tok := p.peek()
+	first, err := p.suffixedExpr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.is("=") && !p.is(",") {
+		switch first.(type) {
+		case *callExpr, *methodExpr:
+			return &callStmt{call: first}, nil
+		}
+		return nil, p.errorf(tok, "syntax error near %s", describe(p.peek()))
+	}
+
+	s := &assignStmt{targets: []expr{first}, line: tok.line}
+	for p.accept(",") {
+		target, err := p.suffixedExpr()
+		if err != nil {
+			return nil, err
+		}
+		s.targets = append(s.targets, target)
+	}
+	for _, target := range s.targets {
+		switch target.(type) {
+		case *nameExpr, *indexExpr:
+		default:
+			return nil, p.errorf(tok, "cannot assign to this expression")
+		}
+	}
+	if err := p.expect("="); err != nil {
+		return nil, err
+	}
+	if s.exprs, err = p.exprList(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (p *parser) exprList() ([]expr, error) {
+	var exprs []expr
+	for {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+		if !p.accept(",") {
+			return exprs, nil
+		}
+	}
+}
+
+func (p *parser) expr() (expr, error) {
+	return p.subExpr(0)
+}
+
+// subExpr reads an expression whose binary operators bind tighter than
+// limit
+func (p *parser) subExpr(limit int) (expr, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	var left expr
+	tok := p.peek()
+	if (tok.kind == tokKeyword && tok.text == "not") || (tok.kind == tokOp && (tok.text == "-" || tok.text == "#")) {
+		p.advance()
+		x, err := p.subExpr(unaryPriority)
+		if err != nil {
+			return nil, err
+		}
+		left = &unaryExpr{op: tok.text, x: x, line: tok.line}
+	} else {
+		var err error
+		if left, err = p.simpleExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		tok := p.peek()
+		if tok.kind != tokOp && tok.kind != tokKeyword {
+			return left, nil
+		}
+		prio, ok := binaryPriority[tok.text]
+		if !ok || prio[0] <= limit {
+			return left, nil
+		}
+		p.advance()
+		right, err := p.subExpr(prio[1])
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: tok.text, l: left, r: right, line: tok.line}
+	}
+}
+
+func (p *parser) simpleExpr() (expr, error) {
+	tok := p.peek()
+	switch {
+	case tok.kind == tokNumber:
+		p.advance()
+		return &constExpr{value: tok.num}, nil
+	case tok.kind == tokString:
+		p.advance()
+		return &constExpr{value: tok.text}, nil
+	case p.accept("nil"):
+		return &constExpr{value: nil}, nil
+	case p.accept("true"):
+		return &constExpr{value: true}, nil
+	case p.accept("false"):
+		return &constExpr{value: false}, nil
+	case p.is("..."):
+		return nil, p.errorf(tok, "variable arguments are not supported")
+	case p.is("{"):
+		return p.tableExpr()
+	case p.accept("function"):
+		return p.functionBody("", tok.line, false)
+	}
+	return p.suffixedExpr()
+}
+
+// suffixedExpr reads a name or parenthesized expression followed by
+// fields, indexes and calls
+func (p *parser) suffixedExpr() (expr, error) {
+	tok := p.peek()
+	var e expr
+	switch {
+	case tok.kind == tokName:
+		p.advance()
+		e = &nameExpr{name: tok.text, line: tok.line}
+	case p.accept("("):
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		e = &parenExpr{x: x}
+	default:
+		return nil, p.errorf(tok, "unexpected symbol near %s", describe(tok))
+	}
+
+	for {
+		tok := p.peek()
+		switch {
+		case p.accept("."):
+			key, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			e = &indexExpr{obj: e, key: &constExpr{value: key}, line: tok.line}
+		case p.accept("["):
+			key, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			e = &indexExpr{obj: e, key: key, line: tok.line}
+		case p.accept(":"):
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			args, err := p.callArgs()
+			if err != nil {
+				return nil, err
+			}
+			e = &methodExpr{obj: e, name: name, args: args, line: tok.line}
+		case p.is("(") || p.is("{") || tok.kind == tokString:
+			args, err := p.callArgs()
+			if err != nil {
+				return nil, err
+			}
+			e = &callExpr{fn: e, args: args, line: tok.line}
+		default:
+			return e, nil
+		}
+	}
+}
+
+// callArgs reads the arguments of a call: a parenthesized list, a string
+// or a table constructor
+func (p *parser) callArgs() ([]expr, error) {
+	tok := p.peek()
+	switch {
+	case tok.kind == tokString:
+		p.advance()
+		return []expr{&constExpr{value: tok.text}}, nil
+	case p.is("{"):
+		t, err := p.tableExpr()
+		if err != nil {
+			return nil, err
+		}
+		return []expr{t}, nil
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if p.accept(")") {
+		return nil, nil
+	}
+	args, err := p.exprList()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+func (p *parser) tableExpr() (expr, error) {
+	tok := p.advance() // {
+	t := &tableExpr{line: tok.line}
+	for !p.is("}") {
+		var item tableItem
+		var err error
+		switch {
+		case p.is("["):
+			p.advance()
+			if item.key, err = p.expr(); err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+		case p.peek().kind == tokName && p.tokens[p.pos+1].kind == tokOp && p.tokens[p.pos+1].text == "=":
+			item.key = &constExpr{value: p.advance().text}
+			p.advance() // =
+		}
+		if item.value, err = p.expr(); err != nil {
+			return nil, err
+		}
+		t.items = append(t.items, item)
+		if !p.accept(",") && !p.accept(";") {
+			break
+		}
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,98 @@
+// internal/script/script.go
+// Package script implements the sandboxed interpreter of server-side
+// scripts: a subset of Lua 5.1 without coroutines, metatables, variable
+// arguments or string patterns, and without any access to the host beyond
+// the functions it is given.
+package script
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTimeout is returned when a script runs past its deadline
+var ErrTimeout = errors.New("script timed out")
+
+// ErrMemory is returned when a script allocates more than its memory limit
+var ErrMemory = errors.New("script used too much memory")
+
+// DefaultMaxMemory is the memory limit of a run that doesn't set one
+const DefaultMaxMemory = 256 << 20
+
+// Error is a syntax or runtime error of a script
+type Error struct {
+	Line  int    // Line of the script, 0 if unknown
+	Msg   string // Description of the error
+	Value Value  // Value passed to error(), nil for other errors
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	}
+	return e.Msg
+}
+
+// Script is a compiled script. It holds no state between runs and can be
+// run concurrently.
+type Script struct {
+	body *block
+}
+
+// Compile parses a script
+func Compile(src string) (*Script, error) {
+	body, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return &Script{body: body}, nil
+}
+
+// RunOptions are the inputs of a run
+type RunOptions struct {
+	Keys     []string         // Available to the script as KEYS
+	Args     []string         // Available to the script as ARGV
+	Globals  map[string]Value // Extra global variables, e.g. host functions
+	Deadline time.Time        // Zero for no time limit
+	// MaxMemory bounds the bytes of strings and table entries the run
+	// allocates in total, freed or not; zero for DefaultMaxMemory
+	MaxMemory int64
+}
+
+// Run runs the script and returns its first return value. Scripts can't
+// create global variables, so runs don't affect each other.
+func (s *Script) Run(opts RunOptions) (result Value, err error) {
+	in := &interp{deadline: opts.Deadline, maxMemory: opts.MaxMemory}
+	if in.maxMemory == 0 {
+		in.maxMemory = DefaultMaxMemory
+	}
+	in.globals = in.builtins()
+	keys, args := NewTable(), NewTable()
+	for _, k := range opts.Keys {
+		keys.Append(k)
+	}
+	for _, a := range opts.Args {
+		args.Append(a)
+	}
+	_ = in.globals.Set("KEYS", keys)
+	_ = in.globals.Set("ARGV", args)
+	for name, v := range opts.Globals {
+		_ = in.globals.Set(name, v)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("script failed: %v", r)
+		}
+	}()
+
+	sig, values, err := in.execBlock(s.body, nil)
+	if err != nil {
+		return nil, err
+	}
+	if sig == breaking {
+		return nil, &Error{Msg: "break outside a loop"}
+	}
+	return valueAt(values, 0), nil
+}
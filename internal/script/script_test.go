@@ -0,0 +1,236 @@
+// internal/script/script_test.go
+package script
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// run compiles and runs src, failing the test on errors
+func run(t *testing.T, src string, opts RunOptions) Value {
+	t.Helper()
+	s, err := Compile(src)
+	if err != nil {
+		t.Fatalf("Compile(%q) failed: %v", src, err)
+	}
+	v, err := s.Run(opts)
+	if err != nil {
+		t.Fatalf("Run(%q) failed: %v", src, err)
+	}
+	return v
+}
+
+func TestScript_Language(t *testing.T) {
+	tests := []struct {
+		src  string
+		want Value
+	}{
+		{"return 1 + 2 * 3", float64(7)},
+		{"return 2 ^ 3 ^ 2", float64(512)},
+		{"return -2 ^ 2", float64(-4)},
+		{"return 7 % 3, 2", float64(1)},
+		{"return -7 % 3", float64(2)},
+		{"return 'a' .. 'b' .. 1", "ab1"},
+		{"return '10' + 5", float64(15)},
+		{"return 0x10", float64(16)},
+		{"return 1 < 2 and 'yes' or 'no'", "yes"},
+		{"return nil or false", false},
+		{"return not nil", true},
+		{"return #'hello'", float64(5)},
+		{"return [[long\nstring]]", "long\nstring"},
+		{`return "tab\tescape\65"`, "tab\tescapeA"},
+		{"local a, b = 1 return b", nil},
+		{"local a, b = 1, 2 a, b = b, a return a .. b", "21"},
+		{"local n = 0 for i = 1, 10 do n = n + i end return n", float64(55)},
+		{"local n = 0 for i = 10, 1, -2 do n = n + i end return n", float64(30)},
+		{"local n = 0 while true do n = n + 1 if n == 5 then break end end return n", float64(5)},
+		{"local n = 0 repeat local m = n + 1 n = m until m >= 3 return n", float64(3)},
+		{"local x = 5 if x > 10 then return 'big' elseif x > 3 then return 'medium' else return 'small' end", "medium"},
+		{"local function fib(n) if n < 2 then return n end return fib(n-1) + fib(n-2) end return fib(15)", float64(610)},
+		{"local function counter() local n = 0 return function() n = n + 1 return n end end local c = counter() c() return c()", float64(2)},
+		{"local t = {1, 2, 3, x = 'y', ['z'] = 4} return #t + t.z", float64(7)},
+		{"local t = {} t[#t+1] = 'a' t[#t+1] = 'b' return table.concat(t, ',')", "a,b"},
+		{"local function two() return 1, 2 end local t = {two()} return #t", float64(2)},
+		{"local function two() return 1, 2 end local t = {two(), 3} return #t", float64(2)},
+		{"local s = '' for k, v in pairs({a = 1, b = 2, c = 3}) do s = s .. k .. v end return s", "a1b2c3"},
+		{"local s = 0 for i, v in ipairs({5, 6, nil, 8}) do s = s + v end return s", float64(11)},
+		{"local obj = {n = 1} function obj:inc(d) self.n = self.n + d return self end return obj:inc(2):inc(3).n", float64(6)},
+		{"return ('abc'):upper()", "ABC"},
+		{"local x = 1 do local x = 2 end return x", float64(1)},
+		{"-- comment\nreturn --[[ block\ncomment ]] 1", float64(1)},
+	}
+	for _, tt := range tests {
+		if got := run(t, tt.src, RunOptions{}); got != tt.want {
+			t.Errorf("%q: expected %v, got %v", tt.src, tt.want, got)
+		}
+	}
+}
+
+func TestScript_Library(t *testing.T) {
+	tests := []struct {
+		src  string
+		want Value
+	}{
+		{"return tonumber('42')", float64(42)},
+		{"return tonumber('ff', 16)", float64(255)},
+		{"return tonumber('abc')", nil},
+		{"return tostring(1.5)", "1.5"},
+		{"return tostring(10)", "10"},
+		{"return type({})", "table"},
+		{"return math.floor(3.7) + math.ceil(1.2) + math.abs(-1)", float64(6)},
+		{"return math.max(1, 5, 3) - math.min(4, 2)", float64(3)},
+		{"return string.sub('hello', 2, -2)", "ell"},
+		{"return string.rep('ab', 3)", "ababab"},
+		{"return string.format('%s=%d (%.2f)', 'x', 3.9, 1)", "x=3 (1.00)"},
+		{"return string.byte('A')", float64(65)},
+		{"return string.char(104, 105)", "hi"},
+		{"local t = {1, 3} table.insert(t, 2, 2) table.insert(t, 4) return table.concat(t)", "1234"},
+		{"local t = {1, 2, 3} local v = table.remove(t, 1) return v .. table.concat(t)", "123"},
+		{"local t = {3, 1, 2} table.sort(t) return table.concat(t)", "123"},
+		{"local t = {3, 1, 2} table.sort(t, function(a, b) return a > b end) return table.concat(t)", "321"},
+		{"local a, b = unpack({1, 2}) return a + b", float64(3)},
+		{"local ok, err = pcall(error, 'boom') return tostring(ok) .. ' ' .. err", "false boom"},
+		{"local ok, err = pcall(error, {code = 7}) return err.code", float64(7)},
+		{"local ok, v = pcall(function() return 'fine' end) return v", "fine"},
+	}
+	for _, tt := range tests {
+		if got := run(t, tt.src, RunOptions{}); got != tt.want {
+			t.Errorf("%q: expected %v, got %v", tt.src, tt.want, got)
+		}
+	}
+}
+
+func TestScript_KeysArgsAndGlobals(t *testing.T) {
+	var calls []string
+	record := &GoFunction{Name: "record", Fn: func(args []Value) ([]Value, error) {
+		calls = append(calls, ToString(args[0]))
+		return []Value{float64(len(calls))}, nil
+	}}
+	fail := &GoFunction{Name: "fail", Fn: func(args []Value) ([]Value, error) {
+		return nil, errors.New("host failure")
+	}}
+
+	src := `
+		local n = 0
+		for i = 1, #KEYS do n = record(KEYS[i] .. '=' .. ARGV[i]) end
+		local ok, err = pcall(fail)
+		return n .. ' ' .. err`
+	got := run(t, src, RunOptions{
+		Keys:    []string{"a", "b"},
+		Args:    []string{"1", "2"},
+		Globals: map[string]Value{"record": record, "fail": fail},
+	})
+	if got != "2 host failure" {
+		t.Errorf("Unexpected result %q", got)
+	}
+	if strings.Join(calls, ",") != "a=1,b=2" {
+		t.Errorf("Unexpected calls %v", calls)
+	}
+}
+
+func TestScript_Errors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"return 1 +", "line 1: unexpected symbol near <eof>"},
+		{"x = 1", "line 1: attempt to create global variable 'x'"},
+		{"return undefined", "line 1: attempt to access nonexistent global variable 'undefined'"},
+		{"local t = nil\nreturn t.x", "line 2: attempt to index a nil value"},
+		{"return {} + 1", "line 1: attempt to perform arithmetic on a table value"},
+		{"return 1 < 'a'", "line 1: attempt to compare number with string"},
+		{"error('custom')", "line 1: custom"},
+		{"local function f() return f() + 1 end return f()", "stack overflow"},
+		{"return 'unfinished", "line 1: unfinished string"},
+		{"local function f(...) end", "variable arguments are not supported"},
+		{"return " + strings.Repeat("(", 300) + "1" + strings.Repeat(")", 300), "too many nested"},
+	}
+	for _, tt := range tests {
+		s, err := Compile(tt.src)
+		if err == nil {
+			_, err = s.Run(RunOptions{})
+		}
+		var e *Error
+		if !errors.As(err, &e) || !strings.Contains(e.Error(), tt.want) {
+			t.Errorf("%q: expected error %q, got %v", tt.src, tt.want, err)
+		}
+	}
+}
+
+func TestScript_Timeout(t *testing.T) {
+	s, err := Compile("local n = 0 while true do n = n + 1 end")
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	start := time.Now()
+	_, err = s.Run(RunOptions{Deadline: time.Now().Add(50 * time.Millisecond)})
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Expected ErrTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the script to stop near its deadline, ran for %v", elapsed)
+	}
+
+	// pcall can't catch a timeout
+	s, _ = Compile("pcall(function() while true do end end) return 'caught'")
+	if _, err := s.Run(RunOptions{Deadline: time.Now().Add(20 * time.Millisecond)}); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected ErrTimeout through pcall, got %v", err)
+	}
+}
+
+func TestScript_MemoryLimit(t *testing.T) {
+	tests := []string{
+		"local t = {} for i = 1, 1e9 do t[i] = i end",
+		"local t = {} for i = 1, 1e9 do table.insert(t, {}) end",
+		"local s = '' for i = 1, 1e9 do s = s .. 'x' end",
+		"local t = {} for i = 1, 1e9 do t[#t + 1] = string.rep('x', 1000) end",
+		"while true do local s = string.format('%s%s', 'a', string.rep('b', 4096)) end",
+		// pcall can't catch it either
+		"pcall(function() local t = {} while true do t[#t + 1] = 'x' end end) return 'caught'",
+	}
+	for _, src := range tests {
+		s, err := Compile(src)
+		if err != nil {
+			t.Fatalf("Compile(%q) failed: %v", src, err)
+		}
+		_, err = s.Run(RunOptions{Deadline: time.Now().Add(10 * time.Second), MaxMemory: 1 << 20})
+		if !errors.Is(err, ErrMemory) {
+			t.Errorf("%q: expected ErrMemory, got %v", src, err)
+		}
+	}
+
+	// Scripts within the limit run as before
+	s, _ := Compile("local t = {} for i = 1, 100 do t[i] = string.rep('x', 100) end return table.concat(t)")
+	result, err := s.Run(RunOptions{MaxMemory: 1 << 20})
+	if err != nil || len(result.(string)) != 10000 {
+		t.Errorf("Unexpected result %v, %v", result, err)
+	}
+}
+
+func TestTable_Order(t *testing.T) {
+	tbl := NewTable()
+	for _, k := range []string{"c", "a", "b"} {
+		_ = tbl.Set(k, k)
+	}
+	_ = tbl.Set("a", nil)
+	_ = tbl.Set("d", "d")
+
+	var keys []string
+	for k, _, _ := tbl.Next(nil); k != nil; k, _, _ = tbl.Next(k) {
+		keys = append(keys, k.(string))
+	}
+	if strings.Join(keys, "") != "cbd" {
+		t.Errorf("Expected insertion order cbd, got %v", keys)
+	}
+
+	arr := NewArray("x", "y", "z")
+	_ = arr.Set(float64(3), nil)
+	if arr.Len() != 2 {
+		t.Errorf("Expected length 2 after removing the last item, got %d", arr.Len())
+	}
+	if err := arr.Set(nil, 1); err == nil {
+		t.Error("Expected an error for a nil key")
+	}
+}
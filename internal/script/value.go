@@ -0,0 +1,240 @@
+// internal/script/value.go
+package script
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Value is a script value: nil, bool, float64, string, *Table, *GoFunction
+// or a function defined by the script
+type Value = any
+
+// GoFunction is a function implemented in Go that scripts can call. An
+// error returned by Fn is raised in the script.
+type GoFunction struct {
+	Name string
+	Fn   func(args []Value) ([]Value, error)
+}
+
+// closure is a function defined by the script with the scope it was
+// created in
+type closure struct {
+	fn  *functionExpr
+	env *scope
+}
+
+// Table is the associative array of the language. Entries are kept in
+// insertion order so that iteration, and anything a script derives from
+// it, is deterministic.
+type Table struct {
+	keys   []Value
+	values []Value       // nil for a removed entry, kept so iteration can go on
+	index  map[Value]int // Position of each key in keys
+	border int           // n such that t[n] is set and t[n+1] isn't
+}
+
+// NewTable returns an empty table
+func NewTable() *Table {
+	return &Table{index: make(map[Value]int)}
+}
+
+// NewArray returns a table holding values at keys 1 to n
+func NewArray(values ...Value) *Table {
+	t := NewTable()
+	for _, v := range values {
+		t.Append(v)
+	}
+	return t
+}
+
+// normalizeKey maps -0 to 0 so that both index the same entry
+func normalizeKey(key Value) Value {
+	if n, ok := key.(float64); ok && n == 0 {
+		return float64(0)
+	}
+	return key
+}
+
+// Get returns the value at key, nil if there is none
+func (t *Table) Get(key Value) Value {
+	if i, ok := t.index[normalizeKey(key)]; ok {
+		return t.values[i]
+	}
+	return nil
+}
+
+// Set stores value at key; a nil value removes the entry. Keys can't be
+// nil or NaN.
+func (t *Table) Set(key, value Value) error {
+	switch k := key.(type) {
+	case nil:
+		return fmt.Errorf("table index is nil")
+	case float64:
+		if math.IsNaN(k) {
+			return fmt.Errorf("table index is NaN")
+		}
+	}
+	key = normalizeKey(key)
+
+	if i, ok := t.index[key]; ok {
+		t.values[i] = value
+	} else if value != nil {
+		t.index[key] = len(t.keys)
+		t.keys = append(t.keys, key)
+		t.values = append(t.values, value)
+	}
+
+	if n, ok := key.(float64); ok && n == math.Trunc(n) {
+		switch {
+		case value != nil && int(n) == t.border+1:
+			t.border++
+			for t.Get(float64(t.border+1)) != nil {
+				t.border++
+			}
+		case value == nil && n >= 1 && int(n) <= t.border:
+			t.border = int(n) - 1
+		}
+	}
+	return nil
+}
+
+// Len returns the length of the array part: n such that t[n] is set and
+// t[n+1] isn't
+func (t *Table) Len() int {
+	return t.border
+}
+
+// Append stores value at key Len()+1
+func (t *Table) Append(value Value) {
+	_ = t.Set(float64(t.border+1), value)
+}
+
+// Next returns the entry following key in iteration order, starting with
+// the first one for a nil key. It returns a nil key after the last one.
+func (t *Table) Next(key Value) (Value, Value, error) {
+	i := 0
+	if key != nil {
+		pos, ok := t.index[normalizeKey(key)]
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid key to 'next'")
+		}
+		i = pos + 1
+	}
+	for ; i < len(t.keys); i++ {
+		if t.values[i] != nil {
+			return t.keys[i], t.values[i], nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// typeName returns the name of the type of a value, as type() does
+func typeName(v Value) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *Table:
+		return "table"
+	case *GoFunction, *closure:
+		return "function"
+	}
+	return "userdata"
+}
+
+// truthy reports whether a value counts as true: anything but nil and
+// false
+func truthy(v Value) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	}
+	return true
+}
+
+// ToString converts a value to a string as tostring() does
+func ToString(v Value) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return formatNumber(v)
+	case string:
+		return v
+	case *GoFunction:
+		return "builtin: " + v.Name
+	}
+	return fmt.Sprintf("%s: %p", typeName(v), v)
+}
+
+// formatNumber formats integers without a fraction and other numbers with
+// 14 significant digits
+func formatNumber(n float64) string {
+	switch {
+	case math.IsInf(n, 1):
+		return "inf"
+	case math.IsInf(n, -1):
+		return "-inf"
+	case math.IsNaN(n):
+		return "nan"
+	case n == math.Trunc(n) && math.Abs(n) < 1e15:
+		return strconv.FormatInt(int64(n), 10)
+	}
+	return strconv.FormatFloat(n, 'g', 14, 64)
+}
+
+// ToNumber converts a number or a numeric string to a number
+func ToNumber(v Value) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		return parseNumber(v)
+	}
+	return 0, false
+}
+
+// parseNumber parses a decimal or hexadecimal number, allowing surrounding
+// spaces
+func parseNumber(text string) (float64, bool) {
+	s := strings.TrimSpace(text)
+	neg := false
+	if strings.HasPrefix(s, "-") {
+		neg, s = true, s[1:]
+	}
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		n, err := strconv.ParseUint(s[2:], 16, 64)
+		if err != nil {
+			return 0, false
+		}
+		if neg {
+			return -float64(n), true
+		}
+		return float64(n), true
+	}
+	if neg {
+		s = "-" + s
+	}
+	// Only plain decimal notation, not the inf, nan and underscores
+	// strconv accepts
+	if s == "" || strings.Trim(s, "0123456789.eE+-") != "" {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
@@ -3,20 +3,84 @@ package snapshot
 
 import (
 	"bufio"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"time"
+	"unicode/utf8"
+)
+
+// Snapshot format versions
+const (
+	FormatV1 = 1 // Plain key-value data
+	FormatV2 = 2 // Entries with expiration and version
+	FormatV3 = 3 // Entries of several logical databases
 )
 
 // Snapshot represents a point-in-time backup of the store
 type Snapshot struct {
-	Timestamp int64             `json:"timestamp"` // Unix nano
-	Version   int               `json:"version"`   // Snapshot format version
-	KeyCount  int               `json:"key_count"` // Number of keys
-	Data      map[string]string `json:"data"`      // The actual key-value data
+	Timestamp   int64             `json:"timestamp"`              // Unix nano
+	Version     int               `json:"version"`                // Snapshot format version
+	KeyCount    int               `json:"key_count"`              // Number of keys
+	Data        map[string]string `json:"data,omitempty"`         // Key-value data (version 1)
+	Entries     map[string]Entry  `json:"entries,omitempty"`      // Full entries (version 2)
+	LastVersion uint64            `json:"last_version,omitempty"` // Highest key version handed out (version 2)
+
+	// Entries of the databases other than 0, which is in Entries (version 3)
+	Databases map[int]map[string]Entry `json:"databases,omitempty"`
+}
+
+// Entry is a single key in a version 2 snapshot
+type Entry struct {
+	Type      string `json:"type,omitempty"`       // Value type, empty for strings
+	Value     string `json:"value"`                // The string, or an encoded payload for other types
+	ExpiresAt int64  `json:"expires_at,omitempty"` // Unix nano, 0 means no expiration
+	Version   uint64 `json:"version,omitempty"`
+}
+
+// entryJSON is how an Entry is written. JSON strings can't hold arbitrary
+// bytes, so values that aren't valid UTF-8, such as bitmaps, are written
+// in base64.
+type entryJSON struct {
+	Type      string `json:"type,omitempty"`
+	Value     string `json:"value"`
+	Encoding  string `json:"encoding,omitempty"` // "base64" or empty for plain text
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+	Version   uint64 `json:"version,omitempty"`
+}
+
+// MarshalJSON writes the entry, base64-encoding binary values
+func (e Entry) MarshalJSON() ([]byte, error) {
+	out := entryJSON{Type: e.Type, Value: e.Value, ExpiresAt: e.ExpiresAt, Version: e.Version}
+	if !utf8.ValidString(e.Value) {
+		out.Value = base64.StdEncoding.EncodeToString([]byte(e.Value))
+		out.Encoding = "base64"
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON reads an entry written by MarshalJSON
+func (e *Entry) UnmarshalJSON(data []byte) error {
+	var in entryJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*e = Entry{Type: in.Type, Value: in.Value, ExpiresAt: in.ExpiresAt, Version: in.Version}
+	switch in.Encoding {
+	case "":
+	case "base64":
+		value, err := base64.StdEncoding.DecodeString(in.Value)
+		if err != nil {
+			return fmt.Errorf("invalid base64 value: %w", err)
+		}
+		e.Value = string(value)
+	default:
+		return fmt.Errorf("unknown value encoding: %q", in.Encoding)
+	}
+	return nil
 }
 
 // Options for snapshot operations
@@ -48,13 +112,54 @@ func NewWriter(opts Options) (*Writer, error) {
 // Create writes a snapshot of the provided data
 // Uses atomic write: write to temp file, then rename
 func (w *Writer) Create(data map[string]string) error {
-	snapshot := &Snapshot{
+	return w.write(&Snapshot{
 		Timestamp: time.Now().UnixNano(),
-		Version:   1,
+		Version:   FormatV1,
 		KeyCount:  len(data),
 		Data:      data,
+	})
+}
+
+// CreateEntries writes a version 2 snapshot that keeps each key's expiration
+// and version, plus the highest version handed out so far
+func (w *Writer) CreateEntries(entries map[string]Entry, lastVersion uint64) error {
+	return w.write(&Snapshot{
+		Timestamp:   time.Now().UnixNano(),
+		Version:     FormatV2,
+		KeyCount:    len(entries),
+		Entries:     entries,
+		LastVersion: lastVersion,
+	})
+}
+
+// CreateDatabases writes the entries of several logical databases, indexed
+// by database number. Database 0 goes in Entries, so a snapshot without
+// keys in other databases is written as version 2.
+func (w *Writer) CreateDatabases(dbs []map[string]Entry, lastVersion uint64) error {
+	snap := &Snapshot{
+		Timestamp:   time.Now().UnixNano(),
+		Version:     FormatV2,
+		Entries:     map[string]Entry{},
+		LastVersion: lastVersion,
 	}
+	for db, entries := range dbs {
+		snap.KeyCount += len(entries)
+		switch {
+		case db == 0:
+			snap.Entries = entries
+		case len(entries) > 0:
+			if snap.Databases == nil {
+				snap.Databases = make(map[int]map[string]Entry)
+			}
+			snap.Databases[db] = entries
+			snap.Version = FormatV3
+		}
+	}
+	return w.write(snap)
+}
 
+// write atomically replaces the snapshot file with the given snapshot
+func (w *Writer) write(snapshot *Snapshot) error {
 	// Create temporary file
 	tempPath := filepath.Join(w.path, fmt.Sprintf("kvlite.snapshot.tmp.%d", snapshot.Timestamp))
 	file, err := os.Create(tempPath)
@@ -198,7 +303,7 @@ type SnapshotInfo struct {
 func Export(data map[string]string, destPath string) error {
 	snapshot := &Snapshot{
 		Timestamp: time.Now().UnixNano(),
-		Version:   1,
+		Version:   FormatV1,
 		KeyCount:  len(data),
 		Data:      data,
 	}
@@ -224,7 +329,8 @@ func Export(data map[string]string, destPath string) error {
 	return file.Sync()
 }
 
-// Import reads a snapshot from an arbitrary path
+// Import reads a snapshot from an arbitrary path. Only the keys of
+// database 0 are returned.
 func Import(srcPath string) (map[string]string, error) {
 	file, err := os.Open(srcPath)
 	if err != nil {
@@ -238,6 +344,14 @@ func Import(srcPath string) (map[string]string, error) {
 		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
 	}
 
+	if snapshot.Version >= FormatV2 {
+		data := make(map[string]string, len(snapshot.Entries))
+		for key, entry := range snapshot.Entries {
+			data[key] = entry.Value
+		}
+		return data, nil
+	}
+
 	return snapshot.Data, nil
 }
 
@@ -253,13 +367,22 @@ func Verify(path string) error {
 	}
 
 	// Basic validation
-	if snapshot.Version != 1 {
+	var count int
+	switch snapshot.Version {
+	case FormatV1:
+		count = len(snapshot.Data)
+	case FormatV2, FormatV3:
+		count = len(snapshot.Entries)
+		for _, entries := range snapshot.Databases {
+			count += len(entries)
+		}
+	default:
 		return fmt.Errorf("unsupported snapshot version: %d", snapshot.Version)
 	}
 
-	if len(snapshot.Data) != snapshot.KeyCount {
+	if count != snapshot.KeyCount {
 		return fmt.Errorf("key count mismatch: expected %d, got %d",
-			snapshot.KeyCount, len(snapshot.Data))
+			snapshot.KeyCount, count)
 	}
 
 	return nil
@@ -269,7 +392,7 @@ func Verify(path string) error {
 func Stream(data map[string]string, w io.Writer) error {
 	snapshot := &Snapshot{
 		Timestamp: time.Now().UnixNano(),
-		Version:   1,
+		Version:   FormatV1,
 		KeyCount:  len(data),
 		Data:      data,
 	}
@@ -49,6 +49,90 @@ func TestSnapshot_CreateAndLoad(t *testing.T) {
 	}
 }
 
+func TestSnapshot_CreateEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	writer, err := NewWriter(Options{Path: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+
+	entries := map[string]Entry{
+		"plain":   {Value: "v1", Version: 3},
+		"expires": {Value: "v2", ExpiresAt: 1700000000000000000, Version: 7},
+		"binary":  {Value: "\x80\x00\xff\n", Version: 8}, // Not valid UTF-8, e.g. a bitmap
+	}
+	if err := writer.CreateEntries(entries, 9); err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+
+	snapshot, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load snapshot: %v", err)
+	}
+	if snapshot.Version != FormatV2 || snapshot.LastVersion != 9 {
+		t.Errorf("Expected format %d with last version 9, got %d/%d",
+			FormatV2, snapshot.Version, snapshot.LastVersion)
+	}
+	for k, want := range entries {
+		if got := snapshot.Entries[k]; got != want {
+			t.Errorf("Key %s: expected %+v, got %+v", k, want, got)
+		}
+	}
+
+	if err := Verify(tmpDir); err != nil {
+		t.Errorf("Verify failed for version 2 snapshot: %v", err)
+	}
+
+	data, err := Import(filepath.Join(tmpDir, "kvlite.snapshot"))
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if data["expires"] != "v2" || data["binary"] != entries["binary"].Value || len(data) != 3 {
+		t.Errorf("Unexpected imported data: %v", data)
+	}
+}
+
+func TestSnapshot_CreateDatabases(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	writer, err := NewWriter(Options{Path: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+
+	// Only database 0 has keys: written as version 2
+	dbs := []map[string]Entry{{"a": {Value: "1", Version: 1}}, {}, {}}
+	if err := writer.CreateDatabases(dbs, 5); err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+	snapshot, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load snapshot: %v", err)
+	}
+	if snapshot.Version != FormatV2 || snapshot.Databases != nil {
+		t.Errorf("Expected a version 2 snapshot, got version %d with %v", snapshot.Version, snapshot.Databases)
+	}
+
+	dbs[2] = map[string]Entry{"a": {Value: "2", Version: 2}, "b": {Value: "3", Version: 3}}
+	if err := writer.CreateDatabases(dbs, 5); err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+	snapshot, err = Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load snapshot: %v", err)
+	}
+	if snapshot.Version != FormatV3 || snapshot.KeyCount != 3 {
+		t.Errorf("Expected a version 3 snapshot of 3 keys, got version %d with %d", snapshot.Version, snapshot.KeyCount)
+	}
+	if snapshot.Entries["a"].Value != "1" || snapshot.Databases[2]["a"].Value != "2" || len(snapshot.Databases) != 1 {
+		t.Errorf("Unexpected databases: %v %v", snapshot.Entries, snapshot.Databases)
+	}
+	if err := Verify(tmpDir); err != nil {
+		t.Errorf("Verify failed for version 3 snapshot: %v", err)
+	}
+}
+
 func TestSnapshot_AtomicWrite(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -0,0 +1,253 @@
+// internal/store/bitmap.go
+package store
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// MaxBitOffset is the largest offset SetBit accepts, which caps bitmaps at
+// 512 MB
+const MaxBitOffset = 1<<32 - 1
+
+// Bit offsets address a string as a bitmap: bit 0 is the most significant
+// bit of the first byte. A string changed by SetBit keeps its bytes in
+// Entry.bits, so that further bits are set in place; the read functions
+// take either form.
+
+// byteString is a string or the bytes of one
+type byteString interface {
+	string | []byte
+}
+
+// GetBit returns the bit at offset in s, 0 past its end
+func GetBit[T byteString](s T, offset uint64) int {
+	if offset/8 >= uint64(len(s)) {
+		return 0
+	}
+	return int(s[offset/8]>>(7-offset%8)) & 1
+}
+
+// SetBit sets the bit at offset of b to bit (0 or 1), in place, and
+// returns b, grown with zero bytes if offset is past its end, and the
+// previous value of the bit
+func SetBit(b []byte, offset uint64, bit int) ([]byte, int) {
+	i := int(offset / 8)
+	if i >= len(b) {
+		b = append(b, make([]byte, i+1-len(b))...)
+	}
+	old := GetBit(b, offset)
+	mask := byte(0x80) >> (offset % 8)
+	if bit == 1 {
+		b[i] |= mask
+	} else {
+		b[i] &^= mask
+	}
+	return b, old
+}
+
+// ResolveRange turns an inclusive range whose ends may count from the end
+// (-1 is the last element) into offsets within [0, length). ok is false
+// if the range is empty.
+func ResolveRange(start, end, length int64) (int64, int64, bool) {
+	if start < 0 {
+		start += length
+	}
+	if end < 0 {
+		end += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= length {
+		end = length - 1
+	}
+	if start > end || length == 0 {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// BitCount returns the number of bits set from bit first to bit last of s,
+// inclusive. Both must be within s.
+func BitCount[T byteString](s T, first, last uint64) int64 {
+	fb, lb := first/8, last/8
+	head := byte(0xff) >> (first % 8)
+	tail := byte(0xff) << (7 - last%8)
+	if fb == lb {
+		return int64(bits.OnesCount8(s[fb] & head & tail))
+	}
+
+	n := bits.OnesCount8(s[fb]&head) + bits.OnesCount8(s[lb]&tail)
+	i := fb + 1
+	for ; i+8 <= lb; i += 8 {
+		n += bits.OnesCount64(binary.BigEndian.Uint64([]byte(s[i : i+8])))
+	}
+	for ; i < lb; i++ {
+		n += bits.OnesCount8(s[i])
+	}
+	return int64(n)
+}
+
+// BitPos returns the offset of the first bit equal to bit (0 or 1) from
+// bit first to bit last of s, inclusive, or -1 if there is none
+func BitPos[T byteString](s T, bit int, first, last uint64) int64 {
+	skip := byte(0)
+	if bit == 0 {
+		skip = 0xff
+	}
+	for pos := first; pos <= last; {
+		// Whole bytes without the bit are skipped at once
+		if pos%8 == 0 && pos+7 <= last && s[pos/8] == skip {
+			pos += 8
+			continue
+		}
+		if GetBit(s, pos) == bit {
+			return int64(pos)
+		}
+		pos++
+	}
+	return -1
+}
+
+// BitOp combines values byte by byte with op, one of AND, OR, XOR or NOT
+// (which takes a single value). Shorter values are padded with zero bytes,
+// so the result is as long as the longest value.
+func BitOp(op string, values [][]byte) []byte {
+	size := 0
+	for _, v := range values {
+		size = max(size, len(v))
+	}
+	out := make([]byte, size)
+	if op == "NOT" {
+		for i := range out {
+			out[i] = ^values[0][i]
+		}
+		return out
+	}
+
+	for i := range out {
+		var acc byte
+		for j, v := range values {
+			var c byte
+			if i < len(v) {
+				c = v[i]
+			}
+			switch {
+			case j == 0:
+				acc = c
+			case op == "AND":
+				acc &= c
+			case op == "OR":
+				acc |= c
+			case op == "XOR":
+				acc ^= c
+			}
+		}
+		out[i] = acc
+	}
+	return out
+}
+
+// NewBitmapEntry creates a string entry holding b, without TTL. b is kept,
+// not copied.
+func NewBitmapEntry(b []byte) *Entry {
+	return &Entry{bits: b}
+}
+
+// StringValue returns the value of a string entry
+func (e *Entry) StringValue() string {
+	if e.bits != nil {
+		return string(e.bits)
+	}
+	return e.Value
+}
+
+// StrLen returns the length of the value of a string entry
+func (e *Entry) StrLen() int {
+	if e.bits != nil {
+		return len(e.bits)
+	}
+	return len(e.Value)
+}
+
+// GetBit returns the bit at offset of a string entry, see GetBit
+func (e *Entry) GetBit(offset uint64) int {
+	if e.bits != nil {
+		return GetBit(e.bits, offset)
+	}
+	return GetBit(e.Value, offset)
+}
+
+// BitCount counts the bits set in a range of a string entry, see BitCount
+func (e *Entry) BitCount(first, last uint64) int64 {
+	if e.bits != nil {
+		return BitCount(e.bits, first, last)
+	}
+	return BitCount(e.Value, first, last)
+}
+
+// BitPos finds a bit in a range of a string entry, see BitPos
+func (e *Entry) BitPos(bit int, first, last uint64) int64 {
+	if e.bits != nil {
+		return BitPos(e.bits, bit, first, last)
+	}
+	return BitPos(e.Value, bit, first, last)
+}
+
+// Bytes returns the value of a string entry as bytes. The bytes of a
+// bitmap are returned as is, and must not be modified.
+func (e *Entry) Bytes() []byte {
+	if e.bits != nil {
+		return e.bits
+	}
+	return []byte(e.Value)
+}
+
+// setBit sets a bit of a string entry in place, see SetBit. The first
+// change copies the string into bytes.
+func (e *Entry) setBit(offset uint64, bit int) int {
+	if e.bits == nil {
+		e.bits = []byte(e.Value)
+		e.Value = ""
+	}
+	var old int
+	e.bits, old = SetBit(e.bits, offset, bit)
+	return old
+}
+
+// SetBit sets the bit at offset of the string stored at key, creating it
+// if needed and keeping its expiration, and returns the previous bit
+func (tx *Txn) SetBit(key string, offset uint64, bit int) (int, error) {
+	entry, ok := tx.lookup(key)
+	if !ok {
+		entry = NewBitmapEntry(nil)
+		entry.setBit(offset, bit)
+		tx.s.put(key, entry)
+		return 0, nil
+	}
+	if entry.Type != TypeString {
+		return 0, ErrWrongType
+	}
+	old := entry.setBit(offset, bit)
+	tx.s.touch(entry)
+	return old, nil
+}
+
+// RestoreSetBit replays a bit change, keeping its version. The string is
+// created if missing.
+func (s *Store) RestoreSetBit(key string, offset uint64, bit int, version uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.restored(key, TypeString)
+	if !ok {
+		return
+	}
+	if entry == nil {
+		entry = NewBitmapEntry(nil)
+		s.insert(key, entry)
+	}
+	entry.setBit(offset, bit)
+	s.stamp(entry, version)
+}
@@ -0,0 +1,152 @@
+// internal/store/bitmap_test.go
+package store
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSetBit(t *testing.T) {
+	b, old := SetBit(nil, 7, 1)
+	if string(b) != "\x01" || old != 0 {
+		t.Errorf("Expected \\x01 and 0, got %q and %d", b, old)
+	}
+	b, _ = SetBit(b, 0, 1)
+	if string(b) != "\x81" {
+		t.Errorf("Expected \\x81, got %q", b)
+	}
+	b, old = SetBit(b, 7, 0)
+	if string(b) != "\x80" || old != 1 {
+		t.Errorf("Expected \\x80 and 1, got %q and %d", b, old)
+	}
+	if b, _ = SetBit(b, 23, 1); string(b) != "\x80\x00\x01" {
+		t.Errorf("Expected zero padding, got %q", b)
+	}
+
+	if GetBit(b, 0) != 1 || GetBit(b, 1) != 0 || GetBit(b, 23) != 1 || GetBit(b, 1000) != 0 {
+		t.Errorf("Unexpected GetBit results for %q", b)
+	}
+
+	// Bits within the string are set in place
+	same, _ := SetBit(b, 1, 1)
+	if &same[0] != &b[0] || b[0] != 0xc0 {
+		t.Errorf("Expected the bit to be set in place, got %q", b)
+	}
+}
+
+func TestBitCountAndPos(t *testing.T) {
+	s := "\xff\xf0\x00" + strings.Repeat("\x00", 20) + "\x01"
+	last := uint64(len(s)*8 - 1)
+
+	tests := []struct {
+		first, last uint64
+		want        int64
+	}{
+		{0, last, 13},
+		{0, 7, 8},
+		{4, 11, 8},
+		{9, 10, 2},
+		{12, last - 1, 0},
+		{16, last, 1},
+	}
+	for _, tt := range tests {
+		if got := BitCount(s, tt.first, tt.last); got != tt.want {
+			t.Errorf("BitCount(%d, %d) = %d, want %d", tt.first, tt.last, got, tt.want)
+		}
+	}
+
+	if got := BitPos(s, 0, 0, last); got != 12 {
+		t.Errorf("Expected first 0 at 12, got %d", got)
+	}
+	if got := BitPos(s, 1, 16, last); got != int64(last) {
+		t.Errorf("Expected first 1 at %d, got %d", last, got)
+	}
+	if got := BitPos(s, 1, 16, last-1); got != -1 {
+		t.Errorf("Expected no 1, got %d", got)
+	}
+	if got := BitPos("\xff", 0, 0, 7); got != -1 {
+		t.Errorf("Expected no 0, got %d", got)
+	}
+}
+
+func TestResolveRange(t *testing.T) {
+	tests := []struct {
+		start, end, length int64
+		wantStart, wantEnd int64
+		ok                 bool
+	}{
+		{0, -1, 10, 0, 9, true},
+		{-3, -1, 10, 7, 9, true},
+		{-100, 100, 10, 0, 9, true},
+		{5, 2, 10, 0, 0, false},
+		{0, -1, 0, 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, end, ok := ResolveRange(tt.start, tt.end, tt.length)
+		if start != tt.wantStart || end != tt.wantEnd || ok != tt.ok {
+			t.Errorf("ResolveRange(%d, %d, %d) = %d, %d, %v", tt.start, tt.end, tt.length, start, end, ok)
+		}
+	}
+}
+
+func TestBitOp(t *testing.T) {
+	a, b := "\xf0\x0f", "\xff"
+	tests := []struct {
+		op     string
+		values []string
+		want   string
+	}{
+		{"AND", []string{a, b}, "\xf0\x00"},
+		{"OR", []string{a, b}, "\xff\x0f"},
+		{"XOR", []string{a, b}, "\x0f\x0f"},
+		{"NOT", []string{a}, "\x0f\xf0"},
+		{"OR", []string{"", ""}, ""},
+	}
+	for _, tt := range tests {
+		values := make([][]byte, len(tt.values))
+		for i, v := range tt.values {
+			values[i] = []byte(v)
+		}
+		if got := BitOp(tt.op, values); string(got) != tt.want {
+			t.Errorf("BitOp(%s) = %q, want %q", tt.op, got, tt.want)
+		}
+	}
+}
+
+func TestTxn_SetBit(t *testing.T) {
+	s := New()
+	_ = s.Update(func(tx *Txn) error {
+		if _, err := tx.SetBit("bits", 9, 1); err != nil {
+			t.Errorf("SetBit: %v", err)
+		}
+		if old, _ := tx.SetBit("bits", 9, 0); old != 1 {
+			t.Errorf("Expected previous bit 1, got %d", old)
+		}
+		return nil
+	})
+	if v, _ := s.Get("bits"); v != "\x00\x00" {
+		t.Errorf("Expected two zero bytes, got %q", v)
+	}
+
+	// A plain string becomes a bitmap, accounted at its new length
+	s.Set("plain", "\x00")
+	_ = s.Update(func(tx *Txn) error {
+		_, err := tx.SetBit("plain", 15, 1)
+		return err
+	})
+	if v, _ := s.Get("plain"); v != "\x00\x01" {
+		t.Errorf("Expected \\x00\\x01, got %q", v)
+	}
+	if want := 2*entryOverhead + int64(len("bits")+2+len("plain")+2); s.Bytes() != want {
+		t.Errorf("Expected %d bytes used, got %d", want, s.Bytes())
+	}
+
+	s.Put("h", NewHashEntry())
+	_ = s.Update(func(tx *Txn) error {
+		if _, err := tx.SetBit("h", 0, 1); !errors.Is(err, ErrWrongType) {
+			t.Errorf("Expected ErrWrongType, got %v", err)
+		}
+		return nil
+	})
+}
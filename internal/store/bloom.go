@@ -0,0 +1,303 @@
+// internal/store/bloom.go
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+const (
+	DefaultBloomErrorRate = 0.01 // Used by BF.ADD when the filter doesn't exist
+	DefaultBloomCapacity  = 100
+	DefaultBloomExpansion = 2
+
+	bloomTightening = 0.5     // Each new sub-filter has half the error rate of the previous one
+	bloomMaxBits    = 1 << 32 // 512 MB per sub-filter
+)
+
+var (
+	// ErrBloomFull is returned when adding to a full non-scaling filter
+	ErrBloomFull = errors.New("non scaling filter is full")
+	// ErrBloomTooLarge is returned when a filter would need too much memory
+	ErrBloomTooLarge = errors.New("filter would be too large")
+
+	errInvalidBloom = errors.New("invalid Bloom filter encoding")
+)
+
+// Bloom is a scalable Bloom filter: a chain of sub-filters, each one
+// larger and stricter than the last, so the overall error rate stays
+// close to ErrorRate however many items are added
+type Bloom struct {
+	ErrorRate  float64 // Target false positive rate of the first sub-filter
+	Capacity   int     // Items the first sub-filter holds before a new one is added
+	Expansion  int     // Capacity growth factor of each new sub-filter
+	NonScaling bool    // Fail with ErrBloomFull instead of adding sub-filters
+	filters    []*bloomFilter
+}
+
+// bloomFilter is a classic Bloom filter of len(bits)*64 bits and k hashes
+type bloomFilter struct {
+	bits     []uint64
+	k        int
+	capacity int
+	count    int
+}
+
+// NewBloom creates an empty filter. errorRate must be in (0, 1), capacity
+// and expansion at least 1.
+func NewBloom(errorRate float64, capacity, expansion int, nonScaling bool) (*Bloom, error) {
+	b := &Bloom{
+		ErrorRate:  errorRate,
+		Capacity:   capacity,
+		Expansion:  expansion,
+		NonScaling: nonScaling,
+	}
+	f, err := newBloomFilter(capacity, errorRate)
+	if err != nil {
+		return nil, err
+	}
+	b.filters = []*bloomFilter{f}
+	return b, nil
+}
+
+func newBloomFilter(capacity int, errorRate float64) (*bloomFilter, error) {
+	m := math.Ceil(-float64(capacity) * math.Log(errorRate) / (math.Ln2 * math.Ln2))
+	if m > bloomMaxBits {
+		return nil, ErrBloomTooLarge
+	}
+	k := int(math.Ceil(-math.Log2(errorRate)))
+	if k < 1 {
+		k = 1
+	}
+	words := int(math.Ceil(m / 64))
+	if words < 1 {
+		words = 1
+	}
+	return &bloomFilter{bits: make([]uint64, words), k: k, capacity: capacity}, nil
+}
+
+// Len returns the number of items added
+func (b *Bloom) Len() int {
+	n := 0
+	for _, f := range b.filters {
+		n += f.count
+	}
+	return n
+}
+
+// Filters returns the number of sub-filters
+func (b *Bloom) Filters() int {
+	return len(b.filters)
+}
+
+// Growth estimates the bytes of the sub-filter added to hold n more items,
+// zero if they fit in the last one
+func (b *Bloom) Growth(n int) int64 {
+	f := b.filters[len(b.filters)-1]
+	if b.NonScaling || f.count+n <= f.capacity {
+		return 0
+	}
+	return int64(8*len(f.bits)) * int64(b.Expansion)
+}
+
+// Exists reports whether item may have been added. False positives happen
+// at about the error rate, false negatives never.
+func (b *Bloom) Exists(item string) bool {
+	h1, h2 := bloomHashes(item)
+	for _, f := range b.filters {
+		if f.test(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add adds item and returns true if it wasn't already (probably) present
+func (b *Bloom) Add(item string) (bool, error) {
+	h1, h2 := bloomHashes(item)
+	for _, f := range b.filters {
+		if f.test(h1, h2) {
+			return false, nil
+		}
+	}
+
+	f := b.filters[len(b.filters)-1]
+	if f.count >= f.capacity {
+		if b.NonScaling {
+			return false, ErrBloomFull
+		}
+		if f.capacity > math.MaxInt/b.Expansion {
+			return false, ErrBloomTooLarge
+		}
+		errorRate := b.ErrorRate * math.Pow(bloomTightening, float64(len(b.filters)))
+		next, err := newBloomFilter(f.capacity*b.Expansion, errorRate)
+		if err != nil {
+			return false, err
+		}
+		b.filters = append(b.filters, next)
+		f = next
+	}
+	f.add(h1, h2)
+	f.count++
+	return true, nil
+}
+
+// bloomHashes derives the two hashes combined into each filter's k
+// positions (Kirsch-Mitzenmacher double hashing)
+func bloomHashes(item string) (uint64, uint64) {
+	h1 := hash64(item)
+	return h1, mix64(h1^0x9e3779b97f4a7c15) | 1
+}
+
+func (f *bloomFilter) test(h1, h2 uint64) bool {
+	m := uint64(len(f.bits)) * 64
+	for i := 0; i < f.k; i++ {
+		pos := (h1 + uint64(i)*h2) % m
+		if f.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *bloomFilter) add(h1, h2 uint64) {
+	m := uint64(len(f.bits)) * 64
+	for i := 0; i < f.k; i++ {
+		pos := (h1 + uint64(i)*h2) % m
+		f.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+// encode returns the binary form stored in snapshots: the parameters,
+// then each sub-filter's capacity, count, k and bits
+func (b *Bloom) encode() []byte {
+	buf := binary.BigEndian.AppendUint64(nil, math.Float64bits(b.ErrorRate))
+	buf = binary.AppendUvarint(buf, uint64(b.Capacity))
+	buf = binary.AppendUvarint(buf, uint64(b.Expansion))
+	if b.NonScaling {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(b.filters)))
+	for _, f := range b.filters {
+		buf = binary.AppendUvarint(buf, uint64(f.capacity))
+		buf = binary.AppendUvarint(buf, uint64(f.count))
+		buf = binary.AppendUvarint(buf, uint64(f.k))
+		buf = binary.AppendUvarint(buf, uint64(len(f.bits)))
+		for _, w := range f.bits {
+			buf = binary.LittleEndian.AppendUint64(buf, w)
+		}
+	}
+	return buf
+}
+
+// bloomReader reads the fields written by encode, remembering the first
+// error so that decodeBloom can check once at the end
+type bloomReader struct {
+	data []byte
+	err  error
+}
+
+func (r *bloomReader) uvarint() int {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 || v > math.MaxInt64 {
+		r.err = errInvalidBloom
+		r.data = nil
+		return 0
+	}
+	r.data = r.data[n:]
+	return int(v)
+}
+
+func (r *bloomReader) bytes(n int) []byte {
+	if n > len(r.data) {
+		r.err = errInvalidBloom
+		r.data = nil
+		return make([]byte, n)
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+// decodeBloom decodes a filter written by encode
+func decodeBloom(data []byte) (*Bloom, error) {
+	r := &bloomReader{data: data}
+	b := &Bloom{ErrorRate: math.Float64frombits(binary.BigEndian.Uint64(r.bytes(8)))}
+	b.Capacity = r.uvarint()
+	b.Expansion = r.uvarint()
+	b.NonScaling = r.bytes(1)[0] == 1
+	n := r.uvarint()
+	for i := 0; i < n && r.err == nil; i++ {
+		f := &bloomFilter{capacity: r.uvarint(), count: r.uvarint(), k: r.uvarint()}
+		words := r.uvarint()
+		if f.k < 1 || f.k > 64 || words == 0 || words > len(r.data)/8 {
+			return nil, errInvalidBloom
+		}
+		f.bits = make([]uint64, words)
+		for j := range f.bits {
+			f.bits[j] = binary.LittleEndian.Uint64(r.bytes(8))
+		}
+		b.filters = append(b.filters, f)
+	}
+	if r.err != nil || len(r.data) != 0 || len(b.filters) == 0 || b.Expansion < 1 {
+		return nil, errInvalidBloom
+	}
+	return b, nil
+}
+
+// bloom returns the Bloom filter stored at key, or nil if the key doesn't
+// exist
+func (tx *Txn) bloom(key string) (*Entry, error) {
+	entry, ok := tx.lookup(key)
+	if !ok {
+		return nil, nil
+	}
+	if entry.Type != TypeBloom {
+		return nil, ErrWrongType
+	}
+	return entry, nil
+}
+
+// RestoreBloom replays a Bloom filter operation, keeping its version.
+// Operations on a missing filter are ignored, since replay always sees
+// the record that created it first.
+func (s *Store) RestoreBloom(key string, version uint64, fn func(b *Bloom)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, _ := s.restored(key, TypeBloom)
+	if entry == nil {
+		return
+	}
+	fn(entry.Bloom)
+	s.stamp(entry, version)
+}
+
+// BFAdd adds item to the Bloom filter stored at key
+// Returns true if the item wasn't already present, false if it was or if
+// the key doesn't exist
+func (tx *Txn) BFAdd(key, item string) (bool, error) {
+	entry, err := tx.bloom(key)
+	if entry == nil || err != nil {
+		return false, err
+	}
+	added, err := entry.Bloom.Add(item)
+	if !added || err != nil {
+		return false, err
+	}
+	tx.s.touch(entry)
+	return true, nil
+}
+
+// Bloom returns the Bloom filter stored at key, or nil if the key doesn't
+// exist. It must only be read, and only until the transaction ends.
+func (tx *Txn) Bloom(key string) (*Bloom, error) {
+	entry, err := tx.bloom(key)
+	if entry == nil || err != nil {
+		return nil, err
+	}
+	return entry.Bloom, nil
+}
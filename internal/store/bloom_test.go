@@ -0,0 +1,128 @@
+// internal/store/bloom_test.go
+package store
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestBloom_AddExists(t *testing.T) {
+	b, err := NewBloom(0.01, 1000, 2, false)
+	if err != nil {
+		t.Fatalf("NewBloom: %v", err)
+	}
+	if added, _ := b.Add("a"); !added {
+		t.Error("Expected a new item to be added")
+	}
+	if added, _ := b.Add("a"); added {
+		t.Error("Expected a known item not to be added again")
+	}
+	if !b.Exists("a") || b.Len() != 1 {
+		t.Errorf("Expected a to exist with 1 item, got %d", b.Len())
+	}
+
+	for i := 0; i < 1000; i++ {
+		b.Add(fmt.Sprintf("in%d", i))
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if b.Exists(fmt.Sprintf("out%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 300 {
+		t.Errorf("Expected a false positive rate near 1%%, got %d in 10000", falsePositives)
+	}
+}
+
+func TestBloom_Scaling(t *testing.T) {
+	b, _ := NewBloom(0.01, 10, 2, false)
+	for i := 0; i < 100; i++ {
+		if _, err := b.Add(fmt.Sprint(i)); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	// 10 + 20 + 40 + 80 items of capacity
+	if b.Filters() != 4 {
+		t.Errorf("Expected 4 sub-filters, got %d", b.Filters())
+	}
+	for i := 0; i < 100; i++ {
+		if !b.Exists(fmt.Sprint(i)) {
+			t.Fatalf("Item %d was lost while scaling", i)
+		}
+	}
+
+	fixed, _ := NewBloom(0.01, 2, 2, true)
+	fixed.Add("a")
+	fixed.Add("b")
+	if _, err := fixed.Add("c"); !errors.Is(err, ErrBloomFull) {
+		t.Errorf("Expected ErrBloomFull, got %v", err)
+	}
+	if _, err := NewBloom(1e-9, 1<<40, 2, false); !errors.Is(err, ErrBloomTooLarge) {
+		t.Errorf("Expected ErrBloomTooLarge, got %v", err)
+	}
+}
+
+func TestBloom_Encoding(t *testing.T) {
+	b, _ := NewBloom(0.001, 5, 3, false)
+	for i := 0; i < 20; i++ {
+		b.Add(fmt.Sprint(i))
+	}
+	decoded, err := decodeBloom(b.encode())
+	if err != nil {
+		t.Fatalf("decodeBloom: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, b) {
+		t.Error("Round trip changed the filter")
+	}
+
+	data := b.encode()
+	for _, bad := range [][]byte{nil, data[:10], data[:len(data)-1], append(data, 0)} {
+		if _, err := decodeBloom(bad); err == nil {
+			t.Errorf("decodeBloom should fail for %d bytes", len(bad))
+		}
+	}
+}
+
+func TestTxn_BFAdd(t *testing.T) {
+	s := New()
+	s.Set("str", "value")
+	b, _ := NewBloom(0.01, 100, 2, false)
+	s.Put("bf", NewBloomEntry(b))
+
+	version := s.Version("bf")
+	_ = s.Update(func(tx *Txn) error {
+		if ok, err := tx.BFAdd("bf", "a"); !ok || err != nil {
+			t.Errorf("BFAdd: %v, %v", ok, err)
+		}
+		if ok, _ := tx.BFAdd("bf", "a"); ok {
+			t.Error("Expected a known item not to be added again")
+		}
+		if ok, err := tx.BFAdd("missing", "a"); ok || err != nil {
+			t.Errorf("Expected nothing to happen on a missing key, got %v, %v", ok, err)
+		}
+		if _, err := tx.BFAdd("str", "a"); !errors.Is(err, ErrWrongType) {
+			t.Errorf("Expected ErrWrongType, got %v", err)
+		}
+		return nil
+	})
+	if s.Version("bf") != version+1 {
+		t.Errorf("Expected one version bump, got %d -> %d", version, s.Version("bf"))
+	}
+}
+
+func TestEntry_BloomPayload(t *testing.T) {
+	b, _ := NewBloom(0.01, 10, 2, true)
+	b.Add("a")
+	entry := NewBloomEntry(b)
+
+	decoded, err := NewEntryFromPayload(TypeBloom, entry.Payload())
+	if err != nil {
+		t.Fatalf("NewEntryFromPayload failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Bloom, b) {
+		t.Errorf("Expected %+v, got %+v", b, decoded.Bloom)
+	}
+}
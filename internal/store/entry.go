@@ -2,13 +2,81 @@
 package store
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
 	"time"
 )
 
+// ErrWrongType is returned when an operation is applied to a key holding a
+// different kind of value
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// ValueType identifies the kind of value an entry holds
+type ValueType int
+
+const (
+	TypeString ValueType = iota // Plain string in Value
+	TypeHash                    // Field-value map in Hash
+	TypeList                    // Deque of strings in List
+	TypeSet                     // Unordered unique strings in Set
+	TypeZSet                    // Members ordered by score in ZSet
+	TypeStream                  // Append-only log of entries in Stream
+	TypeHLL                     // HyperLogLog cardinality estimator in HLL
+	TypeBloom                   // Scalable Bloom filter in Bloom
+	TypeJSON                    // Parsed JSON document in JSON
+)
+
+// typeNames maps value types to the names used by TYPE, the WAL and snapshots
+var typeNames = map[ValueType]string{
+	TypeString: "string",
+	TypeHash:   "hash",
+	TypeList:   "list",
+	TypeSet:    "set",
+	TypeZSet:   "zset",
+	TypeStream: "stream",
+	TypeHLL:    "hyperloglog",
+	TypeBloom:  "bloom",
+	TypeJSON:   "json",
+}
+
+// String returns the name of the value type
+func (t ValueType) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("type(%d)", int(t))
+}
+
+// ParseValueType returns the value type with the given name
+func ParseValueType(name string) (ValueType, error) {
+	for t, n := range typeNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown value type: %q", name)
+}
+
 // Entry represents a key-value pair with optional TTL
 type Entry struct {
 	Value     string
-	ExpiresAt int64 // Unix nanoseconds, 0 means no expiration
+	Type      ValueType           // Kind of value held, the zero value is a string
+	Hash      map[string]string   // Fields of a hash (TypeHash)
+	List      *List               // Elements of a list (TypeList)
+	Set       map[string]struct{} // Members of a set (TypeSet)
+	ZSet      *ZSet               // Members of a sorted set (TypeZSet)
+	Stream    *Stream             // Entries and consumer groups of a stream (TypeStream)
+	HLL       *HLL                // Registers of a HyperLogLog (TypeHLL)
+	Bloom     *Bloom              // Sub-filters of a Bloom filter (TypeBloom)
+	JSON      *JSONDoc            // Parsed JSON document (TypeJSON)
+	ExpiresAt int64               // Unix nanoseconds, 0 means no expiration
+	Version   uint64              // Assigned by the store on every write, used by WATCH
+
+	bits []byte // Bytes of a string changed by SetBit, which replace Value
+	size int64  // Bytes counted for the entry in its store's total, 0 while not stored
 }
 
 // NewEntry creates a new entry without TTL
@@ -56,14 +124,197 @@ func (e *Entry) TTL() time.Duration {
 
 // SetExpiration sets the expiration time
 func (e *Entry) SetExpiration(ttl time.Duration) {
-	if ttl > 0 {
-		e.ExpiresAt = time.Now().Add(ttl).UnixNano()
-	} else {
-		e.ExpiresAt = 0
+	e.ExpiresAt = expiresAtAfter(ttl)
+}
+
+// expiresAtAfter returns the expiration in Unix nanoseconds of a TTL
+// starting now, 0 for none
+func expiresAtAfter(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
 	}
+	return time.Now().Add(ttl).UnixNano()
 }
 
 // RemoveExpiration removes the TTL (makes entry persistent)
 func (e *Entry) RemoveExpiration() {
 	e.ExpiresAt = 0
 }
+
+// NewHashEntry creates an empty hash without TTL
+func NewHashEntry() *Entry {
+	return &Entry{
+		Type: TypeHash,
+		Hash: make(map[string]string),
+	}
+}
+
+// NewListEntry creates an empty list without TTL
+func NewListEntry() *Entry {
+	return &Entry{
+		Type: TypeList,
+		List: NewList(),
+	}
+}
+
+// NewSetEntry creates an empty set without TTL
+func NewSetEntry() *Entry {
+	return &Entry{
+		Type: TypeSet,
+		Set:  make(map[string]struct{}),
+	}
+}
+
+// NewZSetEntry creates an empty sorted set without TTL
+func NewZSetEntry() *Entry {
+	return &Entry{
+		Type: TypeZSet,
+		ZSet: NewZSet(),
+	}
+}
+
+// NewStreamEntry creates an empty stream without TTL
+func NewStreamEntry() *Entry {
+	return &Entry{
+		Type:   TypeStream,
+		Stream: NewStream(),
+	}
+}
+
+// NewHLLEntry creates an empty HyperLogLog without TTL
+func NewHLLEntry() *Entry {
+	return &Entry{
+		Type: TypeHLL,
+		HLL:  NewHLL(),
+	}
+}
+
+// NewBloomEntry wraps a Bloom filter in an entry without TTL
+func NewBloomEntry(b *Bloom) *Entry {
+	return &Entry{
+		Type:  TypeBloom,
+		Bloom: b,
+	}
+}
+
+// NewJSONEntry creates a JSON document holding v, a value decoded by
+// DecodeJSON, without TTL
+func NewJSONEntry(v interface{}) *Entry {
+	return &Entry{
+		Type: TypeJSON,
+		JSON: NewJSONDoc(v),
+	}
+}
+
+// Payload encodes the entry's value as a single string, for the WAL and
+// snapshots: the value itself for strings, an opaque base64 blob for
+// HyperLogLogs and Bloom filters, JSON for the other types (the document
+// itself for JSON values)
+func (e *Entry) Payload() string {
+	var v interface{}
+	switch e.Type {
+	case TypeString:
+		return e.StringValue()
+	case TypeHLL:
+		return base64.StdEncoding.EncodeToString(e.HLL.encode())
+	case TypeBloom:
+		return base64.StdEncoding.EncodeToString(e.Bloom.encode())
+	case TypeJSON:
+		return EncodeJSON(e.JSON.root)
+	case TypeHash:
+		v = e.Hash
+	case TypeList:
+		v = e.List.Values()
+	case TypeSet:
+		v = e.Members()
+	case TypeZSet:
+		// Scores are strings because JSON can't represent infinities
+		pairs := make([][2]string, 0, e.ZSet.Len())
+		for _, m := range e.ZSet.Members() {
+			pairs = append(pairs, [2]string{m.Member, strconv.FormatFloat(m.Score, 'g', -1, 64)})
+		}
+		v = pairs
+	case TypeStream:
+		v = e.Stream.payload()
+	}
+	data, _ := json.Marshal(v) // Only strings, numbers, maps and slices, so this can't fail
+	return string(data)
+}
+
+// NewEntryFromPayload decodes a value written by Payload
+func NewEntryFromPayload(t ValueType, payload string) (*Entry, error) {
+	switch t {
+	case TypeString:
+		return NewEntry(payload), nil
+	case TypeHash:
+		entry := NewHashEntry()
+		if err := json.Unmarshal([]byte(payload), &entry.Hash); err != nil {
+			return nil, fmt.Errorf("invalid hash payload: %w", err)
+		}
+		return entry, nil
+	case TypeList:
+		var values []string
+		if err := json.Unmarshal([]byte(payload), &values); err != nil {
+			return nil, fmt.Errorf("invalid list payload: %w", err)
+		}
+		entry := NewListEntry()
+		for _, v := range values {
+			entry.List.PushBack(v)
+		}
+		return entry, nil
+	case TypeSet:
+		var members []string
+		if err := json.Unmarshal([]byte(payload), &members); err != nil {
+			return nil, fmt.Errorf("invalid set payload: %w", err)
+		}
+		entry := NewSetEntry()
+		for _, m := range members {
+			entry.Set[m] = struct{}{}
+		}
+		return entry, nil
+	case TypeZSet:
+		var pairs [][2]string
+		if err := json.Unmarshal([]byte(payload), &pairs); err != nil {
+			return nil, fmt.Errorf("invalid sorted set payload: %w", err)
+		}
+		entry := NewZSetEntry()
+		for _, p := range pairs {
+			score, err := strconv.ParseFloat(p[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sorted set score %q: %w", p[1], err)
+			}
+			entry.ZSet.Add(p[0], score)
+		}
+		return entry, nil
+	case TypeStream:
+		stream, err := decodeStream(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stream payload: %w", err)
+		}
+		return &Entry{Type: TypeStream, Stream: stream}, nil
+	case TypeJSON:
+		v, err := DecodeJSON(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid json payload: %w", err)
+		}
+		return NewJSONEntry(v), nil
+	case TypeHLL, TypeBloom:
+		data, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s payload: %w", t, err)
+		}
+		if t == TypeHLL {
+			h, err := decodeHLL(data)
+			if err != nil {
+				return nil, err
+			}
+			return &Entry{Type: TypeHLL, HLL: h}, nil
+		}
+		b, err := decodeBloom(data)
+		if err != nil {
+			return nil, err
+		}
+		return NewBloomEntry(b), nil
+	}
+	return nil, fmt.Errorf("unsupported value type: %s", t)
+}
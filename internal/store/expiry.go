@@ -0,0 +1,175 @@
+// internal/store/expiry.go
+package store
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Active expiration only looks at the keys whose expiration has passed:
+// every key with an expiration is kept in a min-heap ordered by it, so a
+// check pops due keys off the top instead of scanning the whole keyspace.
+// The heap is updated wherever the store sets an expiration (insert,
+// Expire, Persist, ExpireAt, RestoreExpiry) and when a key is removed. An
+// expiration changed in place without telling the store is noticed when
+// the key reaches the top, and lazy expiration still applies to it.
+
+const (
+	// expireCheckEvery is how many keys ExpireDue visits between deadline
+	// checks
+	expireCheckEvery = 32
+	// dueSamples is how many keys due looks at to estimate a backlog
+	dueSamples = 1024
+)
+
+// expiryIndex is a min-heap of the keys that have an expiration, with the
+// position of each key so its expiration can be changed in O(log n)
+type expiryIndex struct {
+	items []expiryItem
+	pos   map[string]int
+}
+
+// expiryItem is a key and its expiration in Unix nanoseconds
+type expiryItem struct {
+	key string
+	at  int64
+}
+
+// heap.Interface, for container/heap only
+
+func (x *expiryIndex) Len() int           { return len(x.items) }
+func (x *expiryIndex) Less(i, j int) bool { return x.items[i].at < x.items[j].at }
+
+func (x *expiryIndex) Swap(i, j int) {
+	x.items[i], x.items[j] = x.items[j], x.items[i]
+	x.pos[x.items[i].key] = i
+	x.pos[x.items[j].key] = j
+}
+
+func (x *expiryIndex) Push(v any) {
+	item := v.(expiryItem)
+	x.pos[item.key] = len(x.items)
+	x.items = append(x.items, item)
+}
+
+func (x *expiryIndex) Pop() any {
+	item := x.items[len(x.items)-1]
+	x.items = x.items[:len(x.items)-1]
+	delete(x.pos, item.key)
+	return item
+}
+
+// set schedules key to expire at, in Unix nanoseconds; 0 unschedules it
+func (x *expiryIndex) set(key string, at int64) {
+	i, ok := x.pos[key]
+	switch {
+	case at == 0:
+		if ok {
+			heap.Remove(x, i)
+		}
+	case ok:
+		x.items[i].at = at
+		heap.Fix(x, i)
+	default:
+		if x.pos == nil {
+			x.pos = make(map[string]int)
+		}
+		heap.Push(x, expiryItem{key: key, at: at})
+	}
+}
+
+// next returns the key that expires first
+func (x *expiryIndex) next() (expiryItem, bool) {
+	if len(x.items) == 0 {
+		return expiryItem{}, false
+	}
+	return x.items[0], true
+}
+
+// due estimates the number of keys expiring at or before now from
+// dueSamples keys spread over the heap, so that it costs the same however
+// many there are. Every key is in the heap once, so the share of the
+// samples that are due is an unbiased estimate of the share of all keys.
+func (x *expiryIndex) due(now int64) int {
+	n := len(x.items)
+	step := max(n/dueSamples, 1)
+	sampled, due := 0, 0
+	for i := 0; i < n; i += step {
+		sampled++
+		if x.items[i].at <= now {
+			due++
+		}
+	}
+	if sampled == 0 {
+		return 0
+	}
+	return due * n / sampled
+}
+
+// expire sets the expiration of a stored entry, in Unix nanoseconds, 0
+// removes it
+// Caller must hold the write lock
+func (s *Store) expire(key string, entry *Entry, expiresAt int64) {
+	entry.ExpiresAt = expiresAt
+	s.expiries.set(key, expiresAt)
+}
+
+// OnExpire sets a function called with every key removed because its
+// expiration has passed, whether by ExpireDue or lazily when it is read or
+// overwritten. It is called with the write lock held, so it must not use
+// the store or its siblings.
+func (s *Store) OnExpire(fn func(key string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onExpire = fn
+}
+
+// expired removes a key whose expiration has passed and reports it
+// Caller must hold the write lock
+func (s *Store) expired(key string) {
+	s.remove(key)
+	if s.onExpire != nil {
+		s.onExpire(key)
+	}
+}
+
+// ExpireDue removes the keys whose expiration has passed, stopping once
+// deadline is past; a zero deadline removes them all. It returns the
+// number of keys removed and the number of expired keys left, estimated
+// when the deadline stopped it, see due.
+func (s *Store) ExpireDue(deadline time.Time) (deleted, backlog int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UnixNano()
+	for visited := 1; ; visited++ {
+		item, ok := s.expiries.next()
+		if !ok || item.at > now {
+			return deleted, 0
+		}
+		if visited%expireCheckEvery == 0 && !deadline.IsZero() && time.Now().After(deadline) {
+			// The key at the top is due, so there is one at least
+			return deleted, max(s.expiries.due(now), 1)
+		}
+
+		entry, ok := s.data[item.key]
+		switch {
+		case !ok:
+			s.expiries.set(item.key, 0)
+		case entry.ExpiresAt != item.at:
+			// Changed in place: move it to its actual expiration
+			s.expiries.set(item.key, entry.ExpiresAt)
+		default:
+			s.expired(item.key)
+			deleted++
+		}
+	}
+}
+
+// Expiring returns the number of keys with an expiration, expired ones
+// included until they are removed
+func (s *Store) Expiring() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.expiries.Len()
+}
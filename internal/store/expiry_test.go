@@ -0,0 +1,201 @@
+// internal/store/expiry_test.go
+package store
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestStore_ExpireDue(t *testing.T) {
+	s := New()
+	for i := 0; i < 1000; i++ {
+		s.Set(fmt.Sprintf("persistent%d", i), "v")
+	}
+	for i := 0; i < 10; i++ {
+		s.SetWithTTL(fmt.Sprintf("short%d", i), "v", time.Millisecond)
+		s.SetWithTTL(fmt.Sprintf("long%d", i), "v", time.Hour)
+	}
+	if n := s.Expiring(); n != 20 {
+		t.Fatalf("Expected 20 keys with an expiration, got %d", n)
+	}
+
+	// Persist and overwrite take keys out of the index, Expire adds them
+	s.Persist("long0")
+	s.Set("long1", "v")
+	s.Expire("persistent0", time.Millisecond)
+	_ = s.Update(func(tx *Txn) error {
+		tx.ExpireAt("persistent1", time.Now().Add(time.Millisecond).UnixNano())
+		return nil
+	})
+	s.Delete("short9")
+	if n := s.Expiring(); n != 19 {
+		t.Fatalf("Expected 19 keys with an expiration, got %d", n)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	deleted, backlog := s.ExpireDue(time.Time{})
+	if deleted != 11 || backlog != 0 {
+		t.Errorf("Expected 11 deleted and no backlog, got %d and %d", deleted, backlog)
+	}
+	if n := s.Expiring(); n != 8 {
+		t.Errorf("Expected 8 keys left with an expiration, got %d", n)
+	}
+	if s.Len() != 998+10 {
+		t.Errorf("Unexpected number of keys left: %d", s.Len())
+	}
+	if deleted, _ := s.ExpireDue(time.Time{}); deleted != 0 {
+		t.Errorf("Expected nothing left to expire, got %d", deleted)
+	}
+}
+
+func TestStore_ExpireDueDeadline(t *testing.T) {
+	s := New()
+	for i := 0; i < 1000; i++ {
+		s.SetWithTTL(fmt.Sprintf("k%d", i), "v", time.Millisecond)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// A passed deadline stops after the first batch and reports the rest
+	deleted, backlog := s.ExpireDue(time.Now().Add(-time.Second))
+	if deleted != expireCheckEvery-1 || backlog != 1000-deleted {
+		t.Errorf("Expected %d deleted and %d left, got %d and %d", expireCheckEvery-1, 1000-expireCheckEvery+1, deleted, backlog)
+	}
+	deleted, backlog = s.ExpireDue(time.Now().Add(time.Minute))
+	if deleted+expireCheckEvery-1 != 1000 || backlog != 0 {
+		t.Errorf("Expected the rest deleted, got %d and %d left", deleted, backlog)
+	}
+}
+
+func TestExpiryIndex_DueEstimate(t *testing.T) {
+	var x expiryIndex
+	for i := 0; i < 100000; i++ {
+		x.set(fmt.Sprintf("k%d", i), int64(i*7919%1000+1))
+	}
+
+	// Only a sample is looked at, so the count is an estimate
+	for _, now := range []int64{0, 100, 500, 1000} {
+		want := int(now) * 100
+		if n := x.due(now); n < want-5000 || n > want+5000 {
+			t.Errorf("due(%d) = %d, expected about %d", now, n, want)
+		}
+	}
+}
+
+func TestStore_ExpireDueInPlace(t *testing.T) {
+	s := New()
+	s.SetWithTTL("moved", "v", time.Millisecond)
+	s.SetWithTTL("lazy", "v", time.Millisecond)
+
+	// An expiration changed without telling the store is found at the top
+	entry, _ := s.GetEntry("moved")
+	entry.ExpiresAt = time.Now().Add(time.Hour).UnixNano()
+	time.Sleep(5 * time.Millisecond)
+
+	// Lazily expired keys leave the index
+	if _, ok := s.Get("lazy"); ok {
+		t.Fatal("Expected lazy to have expired")
+	}
+	if deleted, _ := s.ExpireDue(time.Time{}); deleted != 0 {
+		t.Errorf("Expected nothing deleted, got %d", deleted)
+	}
+	if _, ok := s.Get("moved"); !ok {
+		t.Error("Expected moved to be kept")
+	}
+	if n := s.Expiring(); n != 1 {
+		t.Errorf("Expected moved to stay in the index, got %d keys", n)
+	}
+}
+
+func TestStore_OnExpire(t *testing.T) {
+	s := New()
+	var expired []string
+	s.OnExpire(func(key string) { expired = append(expired, key) })
+
+	s.SetWithTTL("active", "v", time.Millisecond)
+	s.SetWithTTL("lazy", "v", time.Millisecond)
+	s.SetWithTTL("overwritten", "v", time.Millisecond)
+	s.SetWithTTL("kept", "v", time.Hour)
+	s.Set("deleted", "v")
+	time.Sleep(5 * time.Millisecond)
+
+	s.Get("lazy")
+	s.Set("overwritten", "new")
+	s.Delete("deleted")
+	s.ExpireDue(time.Time{})
+
+	want := []string{"lazy", "overwritten", "active"}
+	if fmt.Sprint(expired) != fmt.Sprint(want) {
+		t.Errorf("Expected %v reported, got %v", want, expired)
+	}
+	if v, _ := s.Get("overwritten"); v != "new" {
+		t.Errorf("Expected the new value, got %q", v)
+	}
+}
+
+func TestExpiryIndex_Heap(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var x expiryIndex
+	want := make(map[string]int64)
+	for i := 0; i < 2000; i++ {
+		key := fmt.Sprintf("k%d", rng.Intn(300))
+		at := int64(rng.Intn(1000))
+		if rng.Intn(4) == 0 {
+			at = 0
+		}
+		x.set(key, at)
+		if at == 0 {
+			delete(want, key)
+		} else {
+			want[key] = at
+		}
+	}
+
+	if x.Len() != len(want) {
+		t.Fatalf("Expected %d keys, got %d", len(want), x.Len())
+	}
+	due := 0
+	for _, at := range want {
+		if at <= 500 {
+			due++
+		}
+	}
+	if n := x.due(500); n != due {
+		t.Errorf("Expected %d keys due, got %d", due, n)
+	}
+
+	var times []int64
+	for _, at := range want {
+		times = append(times, at)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	for _, at := range times {
+		item, _ := x.next()
+		if item.at != at || want[item.key] != at {
+			t.Fatalf("Expected %d next, got %v", at, item)
+		}
+		x.set(item.key, 0)
+	}
+	if _, ok := x.next(); ok {
+		t.Error("Expected an empty index")
+	}
+}
+
+// BenchmarkStore_ExpireDue measures a check of a large store where few
+// keys expire, which only touches the top of the expiration index
+func BenchmarkStore_ExpireDue(b *testing.B) {
+	s := New()
+	for i := 0; i < 1000000; i++ {
+		s.Set(fmt.Sprintf("key%d", i), "v")
+	}
+	for i := 0; i < 1000; i++ {
+		s.SetWithTTL(fmt.Sprintf("ttl%d", i), "v", time.Hour)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.ExpireDue(time.Now().Add(time.Millisecond))
+	}
+}
@@ -0,0 +1,230 @@
+// internal/store/geo.go
+package store
+
+import (
+	"math"
+	"sort"
+)
+
+// Geo members are kept in a sorted set whose scores are 52-bit geohashes:
+// the longitude and latitude are each quantized to 26 bits and interleaved,
+// which fits exactly in a float64 and keeps nearby points at nearby scores.
+// A search only walks the score ranges of the cells around its center.
+
+// Range of the positions that can be stored
+const (
+	GeoLonMin = -180.0
+	GeoLonMax = 180.0
+	GeoLatMin = -85.05112878 // Limits of the Web Mercator projection
+	GeoLatMax = 85.05112878
+)
+
+const (
+	geoStep         = 26             // Bits per coordinate
+	geoEarthRadius  = 6372797.560856 // Meters, as used by the haversine formula
+	geoMetersPerLat = geoEarthRadius * math.Pi / 180
+	geoBase32       = "0123456789bcdefghjkmnpqrstuvwxyz" // Geohash alphabet
+)
+
+// GeoPoint is a member of a geo set with its position. Dist is the
+// distance in meters from the center of a search.
+type GeoPoint struct {
+	Member   string
+	Lon, Lat float64
+	Dist     float64
+}
+
+// GeoShape is the area of a search around a center. A positive Radius
+// selects a circle, otherwise Width and Height select a box. All
+// lengths are in meters.
+type GeoShape struct {
+	Lon, Lat      float64
+	Radius        float64
+	Width, Height float64
+}
+
+// ValidGeoCoords reports whether a position can be stored
+func ValidGeoCoords(lon, lat float64) bool {
+	return lon >= GeoLonMin && lon <= GeoLonMax && lat >= GeoLatMin && lat <= GeoLatMax
+}
+
+// GeoScore returns the sorted set score of a position
+func GeoScore(lon, lat float64) float64 {
+	return float64(geoEncode(lon, lat, geoStep, GeoLatMin, GeoLatMax))
+}
+
+// GeoDecode returns the position at the center of the cell a score
+// encodes
+func GeoDecode(score float64) (float64, float64) {
+	ilon, ilat := deinterleave(uint64(score))
+	cells := float64(uint64(1) << geoStep)
+	lon := GeoLonMin + (float64(ilon)+0.5)*(GeoLonMax-GeoLonMin)/cells
+	lat := GeoLatMin + (float64(ilat)+0.5)*(GeoLatMax-GeoLatMin)/cells
+	return math.Max(GeoLonMin, math.Min(GeoLonMax, lon)), math.Max(GeoLatMin, math.Min(GeoLatMax, lat))
+}
+
+// GeoHashString returns the standard 11 character geohash of the position
+// a score encodes. The latitude range is re-encoded to [-90, 90] as the
+// standard requires; the score's 52 bits fill 10 characters and the last
+// one is always '0'.
+func GeoHashString(score float64) string {
+	lon, lat := GeoDecode(score)
+	bits := geoEncode(lon, lat, geoStep, -90, 90)
+	buf := make([]byte, 11)
+	for i := 0; i < 10; i++ {
+		buf[i] = geoBase32[(bits>>(52-(i+1)*5))&0x1f]
+	}
+	buf[10] = '0'
+	return string(buf)
+}
+
+// GeoDistance returns the distance in meters between two positions
+func GeoDistance(lon1, lat1, lon2, lat2 float64) float64 {
+	rad := math.Pi / 180
+	u := math.Sin((lat2 - lat1) * rad / 2)
+	v := math.Sin((lon2 - lon1) * rad / 2)
+	a := u*u + math.Cos(lat1*rad)*math.Cos(lat2*rad)*v*v
+	return 2 * geoEarthRadius * math.Asin(math.Sqrt(a))
+}
+
+// GeoSearch returns the members of z within shape, in no particular order
+func GeoSearch(z *ZSet, shape GeoShape) []GeoPoint {
+	var found []GeoPoint
+	check := func(m ZMember) {
+		lon, lat := GeoDecode(m.Score)
+		if dist, ok := shape.contains(lon, lat); ok {
+			found = append(found, GeoPoint{Member: m.Member, Lon: lon, Lat: lat, Dist: dist})
+		}
+	}
+
+	step := shape.step()
+	if step == 0 {
+		for _, m := range z.Members() {
+			check(m)
+		}
+		return found
+	}
+	for _, r := range geoCellRanges(shape.Lon, shape.Lat, step) {
+		min := ScoreBound{Value: float64(r[0])}
+		max := ScoreBound{Value: float64(r[1]), Exclusive: true}
+		for _, m := range z.RangeByScore(min, max, false, 0, -1) {
+			check(m)
+		}
+	}
+	return found
+}
+
+// contains returns the distance from the center to a position and whether
+// the position is within the shape
+func (s GeoShape) contains(lon, lat float64) (float64, bool) {
+	dist := GeoDistance(s.Lon, s.Lat, lon, lat)
+	if s.Radius > 0 {
+		return dist, dist <= s.Radius
+	}
+	// North-south along the center's meridian, east-west along the
+	// position's parallel
+	if GeoDistance(s.Lon, s.Lat, s.Lon, lat) > s.Height/2 {
+		return 0, false
+	}
+	if GeoDistance(s.Lon, lat, lon, lat) > s.Width/2 {
+		return 0, false
+	}
+	return dist, true
+}
+
+// step returns the precision of the cells to search: the finest at which
+// the 3x3 cells around the center cover the whole shape, 0 if the shape
+// is too large for any
+func (s GeoShape) step() int {
+	halfLat, halfLon := s.Radius, s.Radius
+	if s.Radius <= 0 {
+		halfLat, halfLon = s.Height/2, s.Width/2
+	}
+	degLat := halfLat / geoMetersPerLat
+	// Parallels are shortest on the side of the shape nearest a pole
+	cos := math.Cos(math.Min(math.Abs(s.Lat)+degLat, 90) * math.Pi / 180)
+	if cos < 1e-9 {
+		return 0
+	}
+	degLon := halfLon / (geoMetersPerLat * cos)
+
+	for step := geoStep; step > 0; step-- {
+		cells := float64(uint64(1) << step)
+		if (GeoLonMax-GeoLonMin)/cells >= degLon && (GeoLatMax-GeoLatMin)/cells >= degLat {
+			return step
+		}
+	}
+	return 0
+}
+
+// geoCellRanges returns the 52-bit score ranges [min, max) of the cell
+// holding a position and of its neighbors, at the given precision
+func geoCellRanges(lon, lat float64, step int) [][2]uint64 {
+	ilon, ilat := deinterleave(geoEncode(lon, lat, step, GeoLatMin, GeoLatMax))
+	cells := int64(1) << step
+	shift := uint(2 * (geoStep - step))
+
+	seen := make(map[uint64]bool, 9)
+	var ranges [][2]uint64
+	for dlat := int64(-1); dlat <= 1; dlat++ {
+		y := int64(ilat) + dlat
+		if y < 0 || y >= cells {
+			continue
+		}
+		for dlon := int64(-1); dlon <= 1; dlon++ {
+			x := (int64(ilon) + dlon + cells) % cells // Longitude wraps around
+			cell := interleave(uint32(x), uint32(y))
+			if seen[cell] {
+				continue
+			}
+			seen[cell] = true
+			ranges = append(ranges, [2]uint64{cell << shift, (cell + 1) << shift})
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	return ranges
+}
+
+// geoEncode quantizes a position to step bits per coordinate and
+// interleaves them, longitude first
+func geoEncode(lon, lat float64, step int, latMin, latMax float64) uint64 {
+	cells := float64(uint64(1) << step)
+	quantize := func(v, min, max float64) uint32 {
+		i := (v - min) / (max - min) * cells
+		return uint32(math.Max(0, math.Min(cells-1, i)))
+	}
+	return interleave(quantize(lon, GeoLonMin, GeoLonMax), quantize(lat, latMin, latMax))
+}
+
+// interleave spreads the bits of x over the odd bits and those of y over
+// the even bits of the result
+func interleave(x, y uint32) uint64 {
+	return spread(x)<<1 | spread(y)
+}
+
+// deinterleave reverses interleave
+func deinterleave(v uint64) (uint32, uint32) {
+	return squash(v >> 1), squash(v)
+}
+
+// spread moves bit i of v to bit 2i
+func spread(v uint32) uint64 {
+	x := uint64(v)
+	x = (x | x<<16) & 0x0000FFFF0000FFFF
+	x = (x | x<<8) & 0x00FF00FF00FF00FF
+	x = (x | x<<4) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x<<2) & 0x3333333333333333
+	x = (x | x<<1) & 0x5555555555555555
+	return x
+}
+
+// squash moves bit 2i of v to bit i, dropping the odd bits
+func squash(v uint64) uint32 {
+	x := v & 0x5555555555555555
+	x = (x | x>>1) & 0x3333333333333333
+	x = (x | x>>2) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x>>4) & 0x00FF00FF00FF00FF
+	x = (x | x>>8) & 0x0000FFFF0000FFFF
+	x = (x | x>>16) & 0x00000000FFFFFFFF
+	return uint32(x)
+}
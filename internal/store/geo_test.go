@@ -0,0 +1,110 @@
+// internal/store/geo_test.go
+package store
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestGeo_EncodeDecode(t *testing.T) {
+	score := GeoScore(13.361389, 38.115556)
+	if score != math.Trunc(score) || score >= 1<<52 {
+		t.Fatalf("Expected a 52-bit integer score, got %f", score)
+	}
+	lon, lat := GeoDecode(score)
+	if math.Abs(lon-13.361389) > 1e-5 || math.Abs(lat-38.115556) > 1e-5 {
+		t.Errorf("Expected the position back, got %f %f", lon, lat)
+	}
+	if lon, lat := GeoDecode(GeoScore(GeoLonMax, GeoLatMax)); !ValidGeoCoords(lon, lat) {
+		t.Errorf("Expected corners to decode to valid positions, got %f %f", lon, lat)
+	}
+
+	for _, bad := range [][2]float64{{181, 0}, {-180.1, 0}, {0, 85.06}, {0, -90}} {
+		if ValidGeoCoords(bad[0], bad[1]) {
+			t.Errorf("Expected %v to be invalid", bad)
+		}
+	}
+}
+
+func TestGeo_HashString(t *testing.T) {
+	tests := []struct {
+		lon, lat float64
+		want     string
+	}{
+		{13.361389, 38.115556, "sqc8b49rny0"},
+		{15.087269, 37.502669, "sqdtr74hyu0"},
+	}
+	for _, tt := range tests {
+		if got := GeoHashString(GeoScore(tt.lon, tt.lat)); got != tt.want {
+			t.Errorf("%f,%f: expected %s, got %s", tt.lon, tt.lat, tt.want, got)
+		}
+	}
+}
+
+func TestGeo_Distance(t *testing.T) {
+	d := GeoDistance(13.361389, 38.115556, 15.087269, 37.502669)
+	if math.Abs(d-166274.15) > 1 {
+		t.Errorf("Expected about 166274 m, got %f", d)
+	}
+	if d := GeoDistance(179.9, 0, -179.9, 0); d > 23000 {
+		t.Errorf("Expected a short distance across the antimeridian, got %f", d)
+	}
+}
+
+// TestGeoSearch_MatchesScan checks the cell-based search against a scan
+// of every member
+func TestGeoSearch_MatchesScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	z := NewZSet()
+	for i := 0; i < 5000; i++ {
+		lon := rng.Float64()*360 - 180
+		lat := rng.Float64()*170 - 85
+		z.Add(fmt.Sprint(i), GeoScore(lon, lat))
+	}
+
+	shapes := []GeoShape{
+		{Lon: 0, Lat: 0, Radius: 500000},
+		{Lon: 179.5, Lat: 10, Radius: 800000},
+		{Lon: 20, Lat: 80, Radius: 1500000},
+		{Lon: -40, Lat: -30, Width: 2000000, Height: 600000},
+		{Lon: -179, Lat: 60, Width: 3000000, Height: 3000000},
+		{Lon: 10, Lat: 10, Radius: 30000000},
+		{Lon: 10, Lat: 10, Radius: 1},
+	}
+	for _, shape := range shapes {
+		var want []string
+		for _, m := range z.Members() {
+			lon, lat := GeoDecode(m.Score)
+			if _, ok := shape.contains(lon, lat); ok {
+				want = append(want, m.Member)
+			}
+		}
+		var got []string
+		for _, p := range GeoSearch(z, shape) {
+			got = append(got, p.Member)
+		}
+		sort.Strings(want)
+		sort.Strings(got)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%+v: expected %d members, got %d", shape, len(want), len(got))
+		}
+	}
+}
+
+func TestGeoSearch_Box(t *testing.T) {
+	z := NewZSet()
+	z.Add("palermo", GeoScore(13.361389, 38.115556))
+	z.Add("catania", GeoScore(15.087269, 37.502669))
+
+	found := GeoSearch(z, GeoShape{Lon: 15, Lat: 37, Width: 400000, Height: 400000})
+	if len(found) != 2 {
+		t.Fatalf("Expected 2 members, got %v", found)
+	}
+	found = GeoSearch(z, GeoShape{Lon: 15, Lat: 37, Width: 200000, Height: 400000})
+	if len(found) != 1 || found[0].Member != "catania" || math.Abs(found[0].Dist-56441.3) > 1 {
+		t.Errorf("Expected only catania about 56441 m away, got %v", found)
+	}
+}
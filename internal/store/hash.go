@@ -0,0 +1,154 @@
+// internal/store/hash.go
+package store
+
+import (
+	"sort"
+)
+
+// hash returns the hash stored at key, or nil if the key doesn't exist
+func (tx *Txn) hash(key string) (*Entry, error) {
+	entry, ok := tx.lookup(key)
+	if !ok {
+		return nil, nil
+	}
+	if entry.Type != TypeHash {
+		return nil, ErrWrongType
+	}
+	return entry, nil
+}
+
+// RestoreHashField replays a hash field write, keeping its version
+func (s *Store) RestoreHashField(key, field, value string, version uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.restored(key, TypeHash)
+	if !ok {
+		return
+	}
+	if entry == nil {
+		entry = NewHashEntry()
+		s.insert(key, entry)
+	}
+	entry.Hash[field] = value
+	s.stamp(entry, version)
+}
+
+// RestoreHashDelete replays a hash field deletion, keeping its version
+func (s *Store) RestoreHashDelete(key, field string, version uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, _ := s.restored(key, TypeHash)
+	if entry == nil {
+		return
+	}
+	delete(entry.Hash, field)
+	s.stamp(entry, version)
+	if len(entry.Hash) == 0 {
+		s.remove(key)
+	}
+}
+
+// HSet sets a field in the hash stored at key, creating the hash if needed
+// Returns true if the field is new
+func (tx *Txn) HSet(key, field, value string) (bool, error) {
+	entry, err := tx.hash(key)
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		entry = NewHashEntry()
+		entry.Hash[field] = value
+		tx.s.put(key, entry)
+		return true, nil
+	}
+
+	_, exists := entry.Hash[field]
+	entry.Hash[field] = value
+	tx.s.touch(entry)
+	return !exists, nil
+}
+
+// HGet returns a field of the hash stored at key
+func (tx *Txn) HGet(key, field string) (string, bool, error) {
+	entry, err := tx.hash(key)
+	if entry == nil || err != nil {
+		return "", false, err
+	}
+	value, ok := entry.Hash[field]
+	return value, ok, nil
+}
+
+// HDel removes a field from the hash stored at key. The key is removed
+// together with its last field.
+// Returns true if the field existed
+func (tx *Txn) HDel(key, field string) (bool, error) {
+	entry, err := tx.hash(key)
+	if entry == nil || err != nil {
+		return false, err
+	}
+	if _, ok := entry.Hash[field]; !ok {
+		return false, nil
+	}
+
+	delete(entry.Hash, field)
+	if len(entry.Hash) == 0 {
+		tx.s.remove(key)
+		return true, nil
+	}
+	tx.s.touch(entry)
+	return true, nil
+}
+
+// HLen returns the number of fields in the hash stored at key
+func (tx *Txn) HLen(key string) (int, error) {
+	entry, err := tx.hash(key)
+	if entry == nil || err != nil {
+		return 0, err
+	}
+	return len(entry.Hash), nil
+}
+
+// HGetAll returns a copy of the hash stored at key
+func (tx *Txn) HGetAll(key string) (map[string]string, error) {
+	entry, err := tx.hash(key)
+	if entry == nil || err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(entry.Hash))
+	for field, value := range entry.Hash {
+		fields[field] = value
+	}
+	return fields, nil
+}
+
+// HScan returns the fields of the hash stored at key matching pattern, in
+// field order, with pagination
+// Returns: next cursor (0 when done), fields
+func (tx *Txn) HScan(key string, cursor int, pattern string, count int) (int, []string, error) {
+	entry, err := tx.hash(key)
+	if entry == nil || err != nil {
+		return 0, nil, err
+	}
+	if count <= 0 {
+		count = 10 // Default page size
+	}
+
+	var fields []string
+	for field := range entry.Hash {
+		if matchPattern(pattern, field) {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	if cursor >= len(fields) {
+		return 0, nil, nil
+	}
+	end := cursor + count
+	if end >= len(fields) {
+		return 0, fields[cursor:], nil
+	}
+	return end, fields[cursor:end], nil
+}
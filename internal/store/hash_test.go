@@ -0,0 +1,116 @@
+// internal/store/hash_test.go
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTxn_Hash(t *testing.T) {
+	s := New()
+
+	_ = s.Update(func(tx *Txn) error {
+		if added, err := tx.HSet("h", "a", "1"); err != nil || !added {
+			t.Errorf("HSet new field: %v, %v", added, err)
+		}
+		if added, _ := tx.HSet("h", "a", "2"); added {
+			t.Error("HSet on existing field should not report it as added")
+		}
+		_, _ = tx.HSet("h", "b", "3")
+
+		if val, ok, _ := tx.HGet("h", "a"); !ok || val != "2" {
+			t.Errorf("Expected a=2, got %q (exists: %v)", val, ok)
+		}
+		if n, _ := tx.HLen("h"); n != 2 {
+			t.Errorf("Expected 2 fields, got %d", n)
+		}
+
+		next, fields, _ := tx.HScan("h", 0, "*", 1)
+		if next != 1 || len(fields) != 1 || fields[0] != "a" {
+			t.Errorf("Unexpected first HScan page: %d %v", next, fields)
+		}
+		next, fields, _ = tx.HScan("h", next, "*", 1)
+		if next != 0 || len(fields) != 1 || fields[0] != "b" {
+			t.Errorf("Unexpected last HScan page: %d %v", next, fields)
+		}
+		return nil
+	})
+
+	// Deleting the last field removes the key
+	v := s.Version("h")
+	_ = s.Update(func(tx *Txn) error {
+		_, _ = tx.HDel("h", "a")
+		return nil
+	})
+	if nv := s.Version("h"); nv <= v {
+		t.Errorf("Expected HDel to bump version, got %d then %d", v, nv)
+	}
+	_ = s.Update(func(tx *Txn) error {
+		_, _ = tx.HDel("h", "b")
+		return nil
+	})
+	if s.Version("h") != 0 {
+		t.Error("Expected key to be removed with its last field")
+	}
+}
+
+func TestTxn_Hash_WrongType(t *testing.T) {
+	s := New()
+	s.Set("str", "value")
+
+	_ = s.Update(func(tx *Txn) error {
+		if _, err := tx.HSet("str", "f", "v"); !errors.Is(err, ErrWrongType) {
+			t.Errorf("Expected ErrWrongType from HSet, got %v", err)
+		}
+		if _, _, err := tx.HGet("str", "f"); !errors.Is(err, ErrWrongType) {
+			t.Errorf("Expected ErrWrongType from HGet, got %v", err)
+		}
+		_, _ = tx.HSet("h", "f", "v")
+		return nil
+	})
+
+	// String reads don't see hashes
+	if _, ok := s.Get("h"); ok {
+		t.Error("Get should not return a hash")
+	}
+}
+
+func TestEntry_Payload(t *testing.T) {
+	entry := NewHashEntry()
+	entry.Hash["name"] = "alice"
+	entry.Hash["with,comma"] = "x=y"
+
+	decoded, err := NewEntryFromPayload(TypeHash, entry.Payload())
+	if err != nil {
+		t.Fatalf("NewEntryFromPayload failed: %v", err)
+	}
+	if decoded.Type != TypeHash || len(decoded.Hash) != 2 || decoded.Hash["with,comma"] != "x=y" {
+		t.Errorf("Unexpected decoded entry: %+v", decoded)
+	}
+
+	if typ, err := ParseValueType("hash"); err != nil || typ != TypeHash {
+		t.Errorf("ParseValueType(hash) = %v, %v", typ, err)
+	}
+	if _, err := ParseValueType("bogus"); err == nil {
+		t.Error("Expected error for unknown type name")
+	}
+}
+
+func TestStore_RestoreHash(t *testing.T) {
+	s := New()
+
+	s.RestoreHashField("h", "a", "1", 5)
+	s.RestoreHashField("h", "b", "2", 6)
+	if v := s.Version("h"); v != 6 {
+		t.Errorf("Expected version 6, got %d", v)
+	}
+
+	s.RestoreHashDelete("h", "a", 7)
+	s.RestoreHashDelete("h", "b", 8)
+	if s.Version("h") != 0 {
+		t.Error("Expected key to be removed with its last field")
+	}
+	if v := s.LastVersion(); v != 8 {
+		t.Errorf("Expected last version 8, got %d", v)
+	}
+}
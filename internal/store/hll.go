@@ -0,0 +1,289 @@
+// internal/store/hll.go
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	hllP         = 14                   // Bits of the hash used to pick a register
+	hllRegisters = 1 << hllP            // 16384 registers, for a standard error of 0.81%
+	hllMaxRank   = 64 - hllP + 1        // Largest value a register can hold
+	hllDenseSize = hllRegisters * 6 / 8 // 6 bits per register
+	hllSparseMax = 3000                 // Set registers above which the dense encoding is smaller
+	hllSparseTag = 'S'                  // First byte of an encoded sparse HyperLogLog
+	hllDenseTag  = 'D'                  // First byte of an encoded dense HyperLogLog
+)
+
+var errInvalidHLL = errors.New("invalid HyperLogLog encoding")
+
+// HLL is a HyperLogLog cardinality estimator. It starts with a sparse
+// encoding that only stores the registers that are set, and switches to a
+// dense array of 6-bit registers once that stops being smaller.
+type HLL struct {
+	sparse []uint32 // index<<8 | value of the set registers, sorted by index
+	dense  []byte   // Packed registers, nil while sparse
+}
+
+// NewHLL creates an empty HyperLogLog
+func NewHLL() *HLL {
+	return &HLL{}
+}
+
+// IsSparse reports whether the sparse encoding is in use
+func (h *HLL) IsSparse() bool {
+	return h.dense == nil
+}
+
+// Add adds an element and returns true if a register changed, i.e. if the
+// estimated cardinality may have changed
+func (h *HLL) Add(element string) bool {
+	x := hash64(element)
+	index := int(x & (hllRegisters - 1))
+	rank := hllMaxRank
+	if w := x >> hllP; w != 0 {
+		rank = bits.TrailingZeros64(w) + 1
+	}
+	return h.raise(index, uint8(rank))
+}
+
+// Merge raises every register to the matching one of other, so that h
+// estimates the cardinality of the union. Returns true if h changed.
+func (h *HLL) Merge(other *HLL) bool {
+	changed := false
+	other.each(func(index int, value uint8) {
+		if h.raise(index, value) {
+			changed = true
+		}
+	})
+	return changed
+}
+
+// Count returns the estimated number of distinct elements added
+func (h *HLL) Count() uint64 {
+	sum := 0.0
+	set := 0
+	h.each(func(_ int, value uint8) {
+		sum += math.Ldexp(1, -int(value))
+		set++
+	})
+	zeros := hllRegisters - set
+	sum += float64(zeros)
+
+	m := float64(hllRegisters)
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// Linear counting is more accurate while many registers are still empty
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// Clone returns an independent copy
+func (h *HLL) Clone() *HLL {
+	c := &HLL{}
+	if h.dense != nil {
+		c.dense = append([]byte(nil), h.dense...)
+	} else {
+		c.sparse = append([]uint32(nil), h.sparse...)
+	}
+	return c
+}
+
+// raise sets a register to value if that's higher than its current value
+func (h *HLL) raise(index int, value uint8) bool {
+	if h.dense != nil {
+		if h.denseGet(index) >= value {
+			return false
+		}
+		h.denseSet(index, value)
+		return true
+	}
+
+	i := sort.Search(len(h.sparse), func(i int) bool {
+		return int(h.sparse[i]>>8) >= index
+	})
+	if i < len(h.sparse) && int(h.sparse[i]>>8) == index {
+		if uint8(h.sparse[i]) >= value {
+			return false
+		}
+		h.sparse[i] = uint32(index)<<8 | uint32(value)
+		return true
+	}
+	h.sparse = append(h.sparse, 0)
+	copy(h.sparse[i+1:], h.sparse[i:])
+	h.sparse[i] = uint32(index)<<8 | uint32(value)
+	if len(h.sparse) > hllSparseMax {
+		h.toDense()
+	}
+	return true
+}
+
+// each calls fn for every register that is set
+func (h *HLL) each(fn func(index int, value uint8)) {
+	if h.dense == nil {
+		for _, r := range h.sparse {
+			fn(int(r>>8), uint8(r))
+		}
+		return
+	}
+	for i := 0; i < hllRegisters; i++ {
+		if v := h.denseGet(i); v != 0 {
+			fn(i, v)
+		}
+	}
+}
+
+func (h *HLL) toDense() {
+	// One byte of padding lets every register be read as two bytes
+	h.dense = make([]byte, hllDenseSize+1)
+	for _, r := range h.sparse {
+		h.denseSet(int(r>>8), uint8(r))
+	}
+	h.sparse = nil
+}
+
+func (h *HLL) denseGet(index int) uint8 {
+	offset := index * 6
+	b := offset / 8
+	v := uint16(h.dense[b]) | uint16(h.dense[b+1])<<8
+	return uint8(v>>(offset%8)) & 0x3f
+}
+
+func (h *HLL) denseSet(index int, value uint8) {
+	offset := index * 6
+	b, shift := offset/8, offset%8
+	v := uint16(h.dense[b]) | uint16(h.dense[b+1])<<8
+	v = v&^(0x3f<<shift) | uint16(value)<<shift
+	h.dense[b] = byte(v)
+	h.dense[b+1] = byte(v >> 8)
+}
+
+// encode returns the binary form stored in snapshots: a tag byte followed
+// by 3 bytes per set register when sparse, or the packed registers
+func (h *HLL) encode() []byte {
+	if h.dense != nil {
+		return append([]byte{hllDenseTag}, h.dense[:hllDenseSize]...)
+	}
+	buf := make([]byte, 1, 1+3*len(h.sparse))
+	buf[0] = hllSparseTag
+	for _, r := range h.sparse {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(r>>8))
+		buf = append(buf, uint8(r))
+	}
+	return buf
+}
+
+// decodeHLL decodes a HyperLogLog written by encode
+func decodeHLL(data []byte) (*HLL, error) {
+	if len(data) == 0 {
+		return nil, errInvalidHLL
+	}
+	h := NewHLL()
+	switch data[0] {
+	case hllSparseTag:
+		data = data[1:]
+		if len(data)%3 != 0 || len(data)/3 > hllSparseMax {
+			return nil, errInvalidHLL
+		}
+		prev := -1
+		for ; len(data) > 0; data = data[3:] {
+			index, value := int(binary.BigEndian.Uint16(data)), data[2]
+			if index <= prev || index >= hllRegisters || value == 0 || value > hllMaxRank {
+				return nil, errInvalidHLL
+			}
+			h.sparse = append(h.sparse, uint32(index)<<8|uint32(value))
+			prev = index
+		}
+	case hllDenseTag:
+		if len(data) != 1+hllDenseSize {
+			return nil, errInvalidHLL
+		}
+		h.dense = make([]byte, hllDenseSize+1)
+		copy(h.dense, data[1:])
+	default:
+		return nil, errInvalidHLL
+	}
+	return h, nil
+}
+
+// hash64 hashes an element for HyperLogLogs and Bloom filters. It must
+// never change, since persisted registers and bits depend on it.
+func hash64(s string) uint64 {
+	f := fnv.New64a()
+	f.Write([]byte(s))
+	return mix64(f.Sum64())
+}
+
+// mix64 is the MurmurHash3 finalizer, which spreads FNV's weak low bits
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// hll returns the HyperLogLog stored at key, or nil if the key doesn't exist
+func (tx *Txn) hll(key string) (*Entry, error) {
+	entry, ok := tx.lookup(key)
+	if !ok {
+		return nil, nil
+	}
+	if entry.Type != TypeHLL {
+		return nil, ErrWrongType
+	}
+	return entry, nil
+}
+
+// RestoreHLL replays a HyperLogLog operation, keeping its version. The
+// HyperLogLog is created if missing.
+func (s *Store) RestoreHLL(key string, version uint64, fn func(h *HLL)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.restored(key, TypeHLL)
+	if !ok {
+		return
+	}
+	if entry == nil {
+		entry = NewHLLEntry()
+		s.insert(key, entry)
+	}
+	fn(entry.HLL)
+	s.stamp(entry, version)
+}
+
+// PFAdd adds an element to the HyperLogLog stored at key, creating it if
+// needed. Returns true if a register changed.
+func (tx *Txn) PFAdd(key, element string) (bool, error) {
+	entry, err := tx.hll(key)
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		entry = NewHLLEntry()
+		tx.s.put(key, entry)
+	}
+	if !entry.HLL.Add(element) {
+		return false, nil
+	}
+	tx.s.touch(entry)
+	return true, nil
+}
+
+// HLL returns the HyperLogLog stored at key, or nil if the key doesn't
+// exist. It must only be read, and only until the transaction ends.
+func (tx *Txn) HLL(key string) (*HLL, error) {
+	entry, err := tx.hll(key)
+	if entry == nil || err != nil {
+		return nil, err
+	}
+	return entry.HLL, nil
+}
@@ -0,0 +1,142 @@
+// internal/store/hll_test.go
+package store
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestHLL_Count(t *testing.T) {
+	h := NewHLL()
+	if h.Count() != 0 {
+		t.Errorf("Expected 0 for an empty HyperLogLog, got %d", h.Count())
+	}
+	if !h.Add("a") || h.Add("a") {
+		t.Error("Add should only report a change the first time")
+	}
+
+	for _, n := range []int{100, 1000, 100000} {
+		h := NewHLL()
+		for i := 0; i < n; i++ {
+			h.Add(fmt.Sprintf("user:%d", i))
+		}
+		got := float64(h.Count())
+		if math.Abs(got-float64(n))/float64(n) > 0.03 {
+			t.Errorf("Expected about %d, got %.0f", n, got)
+		}
+		if n == 100 && !h.IsSparse() {
+			t.Error("A small HyperLogLog should stay sparse")
+		}
+		if n == 100000 && h.IsSparse() {
+			t.Error("A large HyperLogLog should be dense")
+		}
+	}
+}
+
+func TestHLL_Merge(t *testing.T) {
+	a, b := NewHLL(), NewHLL()
+	for i := 0; i < 5000; i++ {
+		a.Add(fmt.Sprintf("x%d", i))
+		b.Add(fmt.Sprintf("x%d", i+2500))
+	}
+	sparse := NewHLL()
+	sparse.Add("x1")
+
+	if a.Merge(sparse) {
+		t.Error("Merging a subset should not change anything")
+	}
+	union := a.Clone()
+	union.Merge(b)
+	if got := float64(union.Count()); math.Abs(got-7500)/7500 > 0.03 {
+		t.Errorf("Expected about 7500, got %.0f", got)
+	}
+	if a.Count() == union.Count() {
+		t.Error("Clone should be independent")
+	}
+}
+
+func TestHLL_Encoding(t *testing.T) {
+	for _, n := range []int{0, 10, 20000} {
+		h := NewHLL()
+		for i := 0; i < n; i++ {
+			h.Add(fmt.Sprint(i))
+		}
+		decoded, err := decodeHLL(h.encode())
+		if err != nil {
+			t.Fatalf("decodeHLL: %v", err)
+		}
+		if !reflect.DeepEqual(decoded, h) {
+			t.Errorf("%d elements: round trip changed the HyperLogLog", n)
+		}
+	}
+	if len(NewHLL().encode()) != 1 {
+		t.Error("An empty HyperLogLog should encode to a single byte")
+	}
+
+	for _, bad := range [][]byte{nil, {'X'}, {'S', 0, 1}, {'S', 0, 1, 0}, {'D', 1}} {
+		if _, err := decodeHLL(bad); err == nil {
+			t.Errorf("decodeHLL(%v) should fail", bad)
+		}
+	}
+}
+
+func TestTxn_PFAdd(t *testing.T) {
+	s := New()
+	s.Set("str", "value")
+
+	_ = s.Update(func(tx *Txn) error {
+		if ok, err := tx.PFAdd("h", "a"); !ok || err != nil {
+			t.Errorf("PFAdd: %v, %v", ok, err)
+		}
+		if _, err := tx.PFAdd("str", "a"); !errors.Is(err, ErrWrongType) {
+			t.Errorf("Expected ErrWrongType, got %v", err)
+		}
+		return nil
+	})
+
+	version := s.Version("h")
+	_ = s.Update(func(tx *Txn) error {
+		if ok, _ := tx.PFAdd("h", "a"); ok {
+			t.Error("Adding the same element should not change the HyperLogLog")
+		}
+		return nil
+	})
+	if s.Version("h") != version {
+		t.Error("A no-op PFAdd should not bump the version")
+	}
+}
+
+func TestStore_RestoreHLL(t *testing.T) {
+	s := New()
+	s.RestoreHLL("visitors", 7, func(h *HLL) { h.Add("a") })
+	if entry, ok := s.GetEntry("visitors"); !ok || entry.Type != TypeHLL || entry.Version != 7 {
+		t.Fatalf("Expected the HyperLogLog to be created at version 7, got %+v", entry)
+	}
+
+	// A record for a key of another type is skipped rather than overwrite it
+	s.Set("name", "value")
+	s.RestoreHLL("name", 9, func(h *HLL) { h.Add("a") })
+	if v, ok := s.Get("name"); !ok || v != "value" {
+		t.Errorf("Expected the string to be kept, got %q", v)
+	}
+}
+
+func TestEntry_HLLPayload(t *testing.T) {
+	entry := NewHLLEntry()
+	entry.HLL.Add("a")
+	entry.HLL.Add("b")
+
+	decoded, err := NewEntryFromPayload(TypeHLL, entry.Payload())
+	if err != nil {
+		t.Fatalf("NewEntryFromPayload failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.HLL, entry.HLL) {
+		t.Errorf("Expected %+v, got %+v", entry.HLL, decoded.HLL)
+	}
+	if _, err := NewEntryFromPayload(TypeHLL, "not base64!"); err == nil {
+		t.Error("Expected an error for an invalid payload")
+	}
+}
@@ -0,0 +1,653 @@
+// internal/store/json.go
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrJSONPathSyntax is returned for a path that can't be parsed
+	ErrJSONPathSyntax = errors.New("invalid JSON path")
+	// ErrJSONInvalid is returned for a value that isn't valid JSON
+	ErrJSONInvalid = errors.New("invalid JSON value")
+	// ErrJSONNotNumber is returned when incrementing a value that isn't a number
+	ErrJSONNotNumber = errors.New("value at path is not a number")
+	// ErrJSONNotArray is returned when appending to a value that isn't an array
+	ErrJSONNotArray = errors.New("value at path is not an array")
+	// ErrJSONNotFinite is returned when an increment overflows
+	ErrJSONNotFinite = errors.New("result is not a finite number")
+)
+
+type jsonStepKind int
+
+const (
+	stepKey   jsonStepKind = iota // Member of an object
+	stepIndex                     // Element of an array, negative counts from the end
+	stepAll                       // Every member or element (*)
+)
+
+type jsonStep struct {
+	kind  jsonStepKind
+	key   string
+	index int
+}
+
+// JSONPath is a parsed path into a JSON document. The supported subset of
+// JSONPath is the root $, members (.name or ["name"]), array indexes ([0],
+// [-1]) and wildcards (.* or [*]). Paths that don't start with $ use the
+// legacy syntax (".", ".a.b" or "a.b"), which selects at most one value.
+type JSONPath struct {
+	steps  []jsonStep
+	legacy bool
+}
+
+// ParseJSONPath parses a path
+func ParseJSONPath(s string) (*JSONPath, error) {
+	p := &JSONPath{}
+	switch {
+	case strings.HasPrefix(s, "$"):
+		s = s[1:]
+	case s == ".":
+		p.legacy = true
+		return p, nil
+	default:
+		p.legacy = true
+		if !strings.HasPrefix(s, ".") && !strings.HasPrefix(s, "[") {
+			s = "." + s
+		}
+	}
+
+	for len(s) > 0 {
+		var step jsonStep
+		var err error
+		switch s[0] {
+		case '.':
+			step, s, err = parseDotStep(s[1:])
+		case '[':
+			step, s, err = parseBracketStep(s[1:])
+		default:
+			err = ErrJSONPathSyntax
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.steps = append(p.steps, step)
+	}
+	return p, nil
+}
+
+// parseDotStep parses the step after a dot and returns the rest of the path
+func parseDotStep(s string) (jsonStep, string, error) {
+	if strings.HasPrefix(s, "*") {
+		return jsonStep{kind: stepAll}, s[1:], nil
+	}
+	n := strings.IndexAny(s, ".[")
+	if n == -1 {
+		n = len(s)
+	}
+	if n == 0 {
+		return jsonStep{}, "", ErrJSONPathSyntax
+	}
+	return jsonStep{kind: stepKey, key: s[:n]}, s[n:], nil
+}
+
+// parseBracketStep parses the step after an opening bracket and returns
+// the rest of the path
+func parseBracketStep(s string) (jsonStep, string, error) {
+	if len(s) == 0 {
+		return jsonStep{}, "", ErrJSONPathSyntax
+	}
+
+	var step jsonStep
+	switch s[0] {
+	case '"':
+		// JSON string, which may contain escaped quotes
+		end := 1
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) || json.Unmarshal([]byte(s[:end+1]), &step.key) != nil {
+			return jsonStep{}, "", ErrJSONPathSyntax
+		}
+		s = s[end+1:]
+	case '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end == -1 {
+			return jsonStep{}, "", ErrJSONPathSyntax
+		}
+		step.key = s[1 : end+1]
+		s = s[end+2:]
+	case '*':
+		step.kind = stepAll
+		s = s[1:]
+	default:
+		end := strings.IndexByte(s, ']')
+		if end == -1 {
+			return jsonStep{}, "", ErrJSONPathSyntax
+		}
+		index, err := strconv.Atoi(s[:end])
+		if err != nil {
+			return jsonStep{}, "", ErrJSONPathSyntax
+		}
+		step = jsonStep{kind: stepIndex, index: index}
+		s = s[end:]
+	}
+
+	if !strings.HasPrefix(s, "]") {
+		return jsonStep{}, "", ErrJSONPathSyntax
+	}
+	return step, s[1:], nil
+}
+
+// IsRoot reports whether the path selects the whole document
+func (p *JSONPath) IsRoot() bool {
+	return len(p.steps) == 0
+}
+
+// Legacy reports whether the path uses the legacy syntax, which selects at
+// most one value
+func (p *JSONPath) Legacy() bool {
+	return p.legacy
+}
+
+// String returns the path in normalized form, e.g. $["a"][0]
+func (p *JSONPath) String() string {
+	return formatJSONPath(p.steps)
+}
+
+func formatJSONPath(steps []jsonStep) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, step := range steps {
+		switch step.kind {
+		case stepKey:
+			key, _ := json.Marshal(step.key)
+			b.WriteString("[" + string(key) + "]")
+		case stepIndex:
+			b.WriteString("[" + strconv.Itoa(step.index) + "]")
+		case stepAll:
+			b.WriteString("[*]")
+		}
+	}
+	return b.String()
+}
+
+// jsonMatch is a value selected by a path together with the concrete path
+// (keys and non-negative indexes only) that leads to it
+type jsonMatch struct {
+	path  []jsonStep
+	value interface{}
+}
+
+// find returns the values selected by steps in document order
+func find(root interface{}, steps []jsonStep) []jsonMatch {
+	matches := []jsonMatch{{value: root}}
+	for _, step := range steps {
+		var next []jsonMatch
+		for _, m := range matches {
+			next = appendChildren(next, m, step)
+		}
+		matches = next
+	}
+	return matches
+}
+
+// appendChildren appends the children of m selected by step
+func appendChildren(out []jsonMatch, m jsonMatch, step jsonStep) []jsonMatch {
+	child := func(s jsonStep, v interface{}) jsonMatch {
+		path := make([]jsonStep, len(m.path), len(m.path)+1)
+		copy(path, m.path)
+		return jsonMatch{path: append(path, s), value: v}
+	}
+
+	switch v := m.value.(type) {
+	case map[string]interface{}:
+		switch step.kind {
+		case stepKey:
+			if c, ok := v[step.key]; ok {
+				out = append(out, child(step, c))
+			}
+		case stepAll:
+			for _, key := range sortedKeys(v) {
+				out = append(out, child(jsonStep{kind: stepKey, key: key}, v[key]))
+			}
+		}
+	case []interface{}:
+		switch step.kind {
+		case stepIndex:
+			if i, ok := arrayIndex(step.index, len(v)); ok {
+				out = append(out, child(jsonStep{kind: stepIndex, index: i}, v[i]))
+			}
+		case stepAll:
+			for i, c := range v {
+				out = append(out, child(jsonStep{kind: stepIndex, index: i}, c))
+			}
+		}
+	}
+	return out
+}
+
+// arrayIndex resolves a possibly negative index into an array of length n
+func arrayIndex(index, n int) (int, bool) {
+	if index < 0 {
+		index += n
+	}
+	return index, index >= 0 && index < n
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DecodeJSON parses a JSON value, keeping numbers as json.Number so that
+// integers keep their precision
+func DecodeJSON(s string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, ErrJSONInvalid
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, ErrJSONInvalid
+	}
+	return v, nil
+}
+
+// EncodeJSON formats a value decoded by DecodeJSON as compact JSON
+func EncodeJSON(v interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(v) // Decoded values can always be encoded
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// JSONDoc is a parsed JSON document
+type JSONDoc struct {
+	root interface{}
+	size int64 // Length of the encoded document, kept up to date by writes
+}
+
+// NewJSONDoc creates a document holding v, a value decoded by DecodeJSON
+func NewJSONDoc(v interface{}) *JSONDoc {
+	return &JSONDoc{root: v, size: jsonSize(v)}
+}
+
+// Size returns the length of the document encoded by EncodeJSON
+func (d *JSONDoc) Size() int64 {
+	return d.size
+}
+
+// jsonSize returns the length of v encoded by EncodeJSON
+func jsonSize(v interface{}) int64 {
+	return int64(len(EncodeJSON(v)))
+}
+
+// separatorSize is the length of the comma before a member or element
+// added to a container already holding n of them, or removed from one left
+// holding n
+func separatorSize(n int) int64 {
+	if n == 0 {
+		return 0
+	}
+	return 1
+}
+
+// Get returns the values selected by path, in document order
+func (d *JSONDoc) Get(path *JSONPath) []interface{} {
+	matches := find(d.root, path.steps)
+	values := make([]interface{}, len(matches))
+	for i, m := range matches {
+		values[i] = m.value
+	}
+	return values
+}
+
+// Set writes value, a JSON text, at every location selected by path. A
+// final member step also adds the member to objects that lack it. With nx
+// only new members are added, with xx only existing values replaced.
+// Returns the normalized concrete paths written.
+func (d *JSONDoc) Set(path *JSONPath, value string, nx, xx bool) ([]string, error) {
+	if _, err := DecodeJSON(value); err != nil {
+		return nil, err
+	}
+	decode := func() interface{} {
+		v, _ := DecodeJSON(value) // A fresh copy for every location
+		return v
+	}
+
+	if path.IsRoot() {
+		// The document exists, so only NX prevents replacing it
+		if nx {
+			return nil, nil
+		}
+		d.root = decode()
+		d.size = jsonSize(d.root)
+		return []string{"$"}, nil
+	}
+
+	last := path.steps[len(path.steps)-1]
+	var written []string
+	for _, parent := range find(d.root, path.steps[:len(path.steps)-1]) {
+		obj, isObj := parent.value.(map[string]interface{})
+		if isObj && last.kind == stepKey {
+			_, exists := obj[last.key]
+			if (nx && exists) || (xx && !exists) {
+				continue
+			}
+			v := decode()
+			if exists {
+				d.size -= jsonSize(obj[last.key])
+			} else {
+				// "key": and a comma if the object already has members
+				d.size += jsonSize(last.key) + 1 + separatorSize(len(obj))
+			}
+			obj[last.key] = v
+			d.size += jsonSize(v)
+			written = append(written, formatJSONPath(append(parent.path, last)))
+			continue
+		}
+		if nx {
+			// Anything else selects existing values only
+			continue
+		}
+		for _, m := range appendChildren(nil, parent, last) {
+			v := decode()
+			d.size += jsonSize(v) - jsonSize(d.at(m.path))
+			d.replace(m.path, v)
+			written = append(written, formatJSONPath(m.path))
+		}
+	}
+	return written, nil
+}
+
+// Delete removes the values selected by path and returns the normalized
+// concrete paths removed. Deleting the root empties the document.
+func (d *JSONDoc) Delete(path *JSONPath) []string {
+	if path.IsRoot() {
+		d.root = nil
+		d.size = jsonSize(nil)
+		return []string{"$"}
+	}
+
+	matches := find(d.root, path.steps)
+	removed := make([]string, 0, len(matches))
+	// Later array elements go first so earlier indexes stay valid
+	for i := len(matches) - 1; i >= 0; i-- {
+		m := matches[i]
+		parentPath, last := m.path[:len(m.path)-1], m.path[len(m.path)-1]
+		// The current value, which may have lost matches deleted before it
+		d.size -= jsonSize(d.at(m.path))
+		switch parent := d.at(parentPath).(type) {
+		case map[string]interface{}:
+			delete(parent, last.key)
+			d.size -= jsonSize(last.key) + 1 + separatorSize(len(parent))
+		case []interface{}:
+			d.replace(parentPath, append(parent[:last.index:last.index], parent[last.index+1:]...))
+			d.size -= separatorSize(len(parent) - 1)
+		}
+		removed = append(removed, formatJSONPath(m.path))
+	}
+	return removed
+}
+
+// JSONUpdate is the outcome of an update at one location selected by a
+// path. Path is empty and Value nil when the value there has the wrong
+// type.
+type JSONUpdate struct {
+	Path  string      // Normalized concrete path written
+	Value interface{} // The new number for NumIncrBy, the new length for ArrAppend
+}
+
+// NumIncrBy adds delta, a JSON number, to the numbers selected by path
+func (d *JSONDoc) NumIncrBy(path *JSONPath, delta string) ([]JSONUpdate, error) {
+	v, err := DecodeJSON(delta)
+	if err != nil {
+		return nil, ErrJSONNotNumber
+	}
+	by, ok := v.(json.Number)
+	if !ok {
+		return nil, ErrJSONNotNumber
+	}
+
+	matches := find(d.root, path.steps)
+	// Check every location first, updates can't be rolled back
+	sums := make([]json.Number, len(matches))
+	for i, m := range matches {
+		n, ok := m.value.(json.Number)
+		if !ok {
+			continue
+		}
+		sum, err := addJSONNumbers(n, by)
+		if err != nil {
+			return nil, err
+		}
+		sums[i] = sum
+	}
+
+	updates := make([]JSONUpdate, len(matches))
+	for i, m := range matches {
+		if sums[i] == "" {
+			continue
+		}
+		d.size += int64(len(sums[i])) - jsonSize(d.at(m.path))
+		d.replace(m.path, sums[i])
+		updates[i] = JSONUpdate{Path: formatJSONPath(m.path), Value: sums[i]}
+	}
+	return updates, nil
+}
+
+// addJSONNumbers adds two numbers, as integers if both are integers and the
+// sum doesn't overflow
+func addJSONNumbers(a, b json.Number) (json.Number, error) {
+	x, errX := a.Int64()
+	y, errY := b.Int64()
+	if errX == nil && errY == nil {
+		sum := x + y
+		if (sum > x) == (y > 0) {
+			return json.Number(strconv.FormatInt(sum, 10)), nil
+		}
+	}
+
+	fx, errX := a.Float64()
+	fy, errY := b.Float64()
+	sum := fx + fy
+	if errX != nil || errY != nil || math.IsInf(sum, 0) || math.IsNaN(sum) {
+		return "", ErrJSONNotFinite
+	}
+	return json.Number(strconv.FormatFloat(sum, 'g', -1, 64)), nil
+}
+
+// ArrAppend appends values, JSON texts, to the arrays selected by path
+func (d *JSONDoc) ArrAppend(path *JSONPath, values ...string) ([]JSONUpdate, error) {
+	for _, v := range values {
+		if _, err := DecodeJSON(v); err != nil {
+			return nil, err
+		}
+	}
+
+	matches := find(d.root, path.steps)
+	updates := make([]JSONUpdate, len(matches))
+	for i, m := range matches {
+		arr, ok := m.value.([]interface{})
+		if !ok {
+			continue
+		}
+		for _, v := range values {
+			decoded, _ := DecodeJSON(v)
+			d.size += jsonSize(decoded) + separatorSize(len(arr))
+			arr = append(arr, decoded)
+		}
+		d.replace(m.path, arr)
+		updates[i] = JSONUpdate{Path: formatJSONPath(m.path), Value: len(arr)}
+	}
+	return updates, nil
+}
+
+// at returns the value at a concrete path, which must exist
+func (d *JSONDoc) at(path []jsonStep) interface{} {
+	v := d.root
+	for _, step := range path {
+		switch c := v.(type) {
+		case map[string]interface{}:
+			v = c[step.key]
+		case []interface{}:
+			v = c[step.index]
+		}
+	}
+	return v
+}
+
+// replace stores v at a concrete path, whose parent must exist
+func (d *JSONDoc) replace(path []jsonStep, v interface{}) {
+	if len(path) == 0 {
+		d.root = v
+		return
+	}
+	last := path[len(path)-1]
+	switch parent := d.at(path[:len(path)-1]).(type) {
+	case map[string]interface{}:
+		parent[last.key] = v
+	case []interface{}:
+		parent[last.index] = v
+	}
+}
+
+// json returns the JSON document stored at key, or nil if the key doesn't
+// exist
+func (tx *Txn) json(key string) (*Entry, error) {
+	entry, ok := tx.lookup(key)
+	if !ok {
+		return nil, nil
+	}
+	if entry.Type != TypeJSON {
+		return nil, ErrWrongType
+	}
+	return entry, nil
+}
+
+// RestoreJSON replays a JSON operation, keeping its version. The document
+// is created if missing.
+func (s *Store) RestoreJSON(key string, version uint64, fn func(d *JSONDoc)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.restored(key, TypeJSON)
+	if !ok {
+		return
+	}
+	if entry == nil {
+		entry = NewJSONEntry(nil)
+		s.insert(key, entry)
+	}
+	fn(entry.JSON)
+	s.stamp(entry, version)
+}
+
+// JSONSet writes value at path in the document stored at key, see
+// JSONDoc.Set. A missing key is created when path is the root.
+func (tx *Txn) JSONSet(key string, path *JSONPath, value string, nx, xx bool) ([]string, error) {
+	entry, err := tx.json(key)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		if !path.IsRoot() || xx {
+			return nil, nil
+		}
+		v, err := DecodeJSON(value)
+		if err != nil {
+			return nil, err
+		}
+		tx.s.put(key, NewJSONEntry(v))
+		return []string{"$"}, nil
+	}
+
+	written, err := entry.JSON.Set(path, value, nx, xx)
+	if len(written) > 0 {
+		tx.s.touch(entry)
+	}
+	return written, err
+}
+
+// JSONDel removes the values selected by path from the document stored at
+// key. Deleting the root removes the key.
+func (tx *Txn) JSONDel(key string, path *JSONPath) ([]string, error) {
+	entry, err := tx.json(key)
+	if entry == nil || err != nil {
+		return nil, err
+	}
+	if path.IsRoot() {
+		tx.s.remove(key)
+		return []string{"$"}, nil
+	}
+	removed := entry.JSON.Delete(path)
+	if len(removed) > 0 {
+		tx.s.touch(entry)
+	}
+	return removed, nil
+}
+
+// JSONNumIncrBy adds delta to the numbers selected by path in the document
+// stored at key
+func (tx *Txn) JSONNumIncrBy(key string, path *JSONPath, delta string) ([]JSONUpdate, error) {
+	entry, err := tx.json(key)
+	if entry == nil || err != nil {
+		return nil, err
+	}
+	updates, err := entry.JSON.NumIncrBy(path, delta)
+	if changed(updates) {
+		tx.s.touch(entry)
+	}
+	return updates, err
+}
+
+// JSONArrAppend appends values to the arrays selected by path in the
+// document stored at key
+func (tx *Txn) JSONArrAppend(key string, path *JSONPath, values ...string) ([]JSONUpdate, error) {
+	entry, err := tx.json(key)
+	if entry == nil || err != nil {
+		return nil, err
+	}
+	updates, err := entry.JSON.ArrAppend(path, values...)
+	if changed(updates) {
+		tx.s.touch(entry)
+	}
+	return updates, err
+}
+
+// changed reports whether any location was updated
+func changed(updates []JSONUpdate) bool {
+	for _, u := range updates {
+		if u.Path != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// JSON returns the document stored at key, or nil if the key doesn't
+// exist. It must only be read, and only until the transaction ends.
+func (tx *Txn) JSON(key string) (*JSONDoc, error) {
+	entry, err := tx.json(key)
+	if entry == nil || err != nil {
+		return nil, err
+	}
+	return entry.JSON, nil
+}
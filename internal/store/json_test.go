@@ -0,0 +1,304 @@
+// internal/store/json_test.go
+package store
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func mustDoc(t *testing.T, s string) *JSONDoc {
+	t.Helper()
+	v, err := DecodeJSON(s)
+	if err != nil {
+		t.Fatalf("DecodeJSON(%s): %v", s, err)
+	}
+	return NewJSONDoc(v)
+}
+
+func mustPath(t *testing.T, s string) *JSONPath {
+	t.Helper()
+	p, err := ParseJSONPath(s)
+	if err != nil {
+		t.Fatalf("ParseJSONPath(%s): %v", s, err)
+	}
+	return p
+}
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		want   string
+		legacy bool
+	}{
+		{"$", "$", false},
+		{".", "$", true},
+		{"$.a.b", `$["a"]["b"]`, false},
+		{"$.a[0][-1]", `$["a"][0][-1]`, false},
+		{`$["a.b"]['c d']`, `$["a.b"]["c d"]`, false},
+		{`$["q\"q"]`, `$["q\"q"]`, false},
+		{"$.*[*]", "$[*][*]", false},
+		{".a.b", `$["a"]["b"]`, true},
+		{"a[1]", `$["a"][1]`, true},
+	}
+	for _, tt := range tests {
+		p, err := ParseJSONPath(tt.path)
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		if p.String() != tt.want || p.Legacy() != tt.legacy {
+			t.Errorf("%s: expected %s (legacy %v), got %s (legacy %v)",
+				tt.path, tt.want, tt.legacy, p.String(), p.Legacy())
+		}
+	}
+
+	for _, bad := range []string{"$.", "$..a", "$[", "$[x]", `$["a`, "$['a", "$[0", "$a"} {
+		if _, err := ParseJSONPath(bad); !errors.Is(err, ErrJSONPathSyntax) {
+			t.Errorf("%s: expected ErrJSONPathSyntax, got %v", bad, err)
+		}
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	v, err := DecodeJSON(`{"n":12345678901234567890,"s":"<a>"}`)
+	if err != nil {
+		t.Fatalf("DecodeJSON: %v", err)
+	}
+	// Large integers keep their digits and HTML isn't escaped
+	if got := EncodeJSON(v); got != `{"n":12345678901234567890,"s":"<a>"}` {
+		t.Errorf("Unexpected round trip: %s", got)
+	}
+
+	for _, bad := range []string{"", "{", "[1,]", "1 2", "nope"} {
+		if _, err := DecodeJSON(bad); !errors.Is(err, ErrJSONInvalid) {
+			t.Errorf("%q: expected ErrJSONInvalid, got %v", bad, err)
+		}
+	}
+}
+
+func TestJSONDoc_Get(t *testing.T) {
+	d := mustDoc(t, `{"a":{"b":1},"c":[1,2,3],"d":{"b":2}}`)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"$", `[{"a":{"b":1},"c":[1,2,3],"d":{"b":2}}]`},
+		{"$.a.b", `[1]`},
+		{"$.c[-1]", `[3]`},
+		{"$.c[5]", `[]`},
+		{"$.*.b", `[1,2]`},
+		{"$.c[*]", `[1,2,3]`},
+		{"$.missing.b", `[]`},
+	}
+	for _, tt := range tests {
+		if got := EncodeJSON(d.Get(mustPath(t, tt.path))); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestJSONDoc_Set(t *testing.T) {
+	d := mustDoc(t, `{"a":{"b":1},"c":[1,2]}`)
+
+	written, err := d.Set(mustPath(t, "$.a.x"), `"new"`, false, false)
+	if err != nil || !reflect.DeepEqual(written, []string{`$["a"]["x"]`}) {
+		t.Errorf("Set: %v, %v", written, err)
+	}
+	if written, _ := d.Set(mustPath(t, "$.a.b"), "2", true, false); len(written) != 0 {
+		t.Errorf("Expected NX not to replace a member, wrote %v", written)
+	}
+	if written, _ := d.Set(mustPath(t, "$.a.y"), "2", false, true); len(written) != 0 {
+		t.Errorf("Expected XX not to add a member, wrote %v", written)
+	}
+	written, _ = d.Set(mustPath(t, "$.c[-1]"), "9", false, false)
+	if !reflect.DeepEqual(written, []string{`$["c"][1]`}) {
+		t.Errorf("Expected the index to be resolved, got %v", written)
+	}
+	if written, _ := d.Set(mustPath(t, "$.c[5]"), "9", false, false); len(written) != 0 {
+		t.Errorf("Expected nothing written past the end of an array, got %v", written)
+	}
+	if written, _ := d.Set(mustPath(t, "$.nope.x"), "1", false, false); len(written) != 0 {
+		t.Errorf("Expected nothing written under a missing parent, got %v", written)
+	}
+	if _, err := d.Set(mustPath(t, "$.a"), "{bad", false, false); !errors.Is(err, ErrJSONInvalid) {
+		t.Errorf("Expected ErrJSONInvalid, got %v", err)
+	}
+
+	if got := EncodeJSON(d.root); got != `{"a":{"b":1,"x":"new"},"c":[1,9]}` {
+		t.Errorf("Unexpected document: %s", got)
+	}
+
+	// Values set at several locations don't share storage
+	_, _ = d.Set(mustPath(t, "$.*.z"), "[]", false, false)
+	_, _ = d.ArrAppend(mustPath(t, "$.a.z"), "1")
+	if got := EncodeJSON(d.Get(mustPath(t, "$.*.z"))); got != `[[1]]` {
+		t.Errorf("Expected only a.z to change, got %s", got)
+	}
+}
+
+func TestJSONDoc_Delete(t *testing.T) {
+	d := mustDoc(t, `{"a":[1,2,3,4],"b":{"x":1,"y":2}}`)
+
+	removed := d.Delete(mustPath(t, "$.a[*]"))
+	// Removed back to front so that replaying them one by one is correct
+	want := []string{`$["a"][3]`, `$["a"][2]`, `$["a"][1]`, `$["a"][0]`}
+	if !reflect.DeepEqual(removed, want) {
+		t.Errorf("Expected %v, got %v", want, removed)
+	}
+	if n := len(d.Delete(mustPath(t, "$.b.*"))); n != 2 {
+		t.Errorf("Expected 2 members removed, got %d", n)
+	}
+	if n := len(d.Delete(mustPath(t, "$.missing"))); n != 0 {
+		t.Errorf("Expected nothing removed, got %d", n)
+	}
+	if got := EncodeJSON(d.root); got != `{"a":[],"b":{}}` {
+		t.Errorf("Unexpected document: %s", got)
+	}
+}
+
+func TestJSONDoc_NumIncrBy(t *testing.T) {
+	d := mustDoc(t, `{"i":1,"f":1.5,"s":"x","big":9223372036854775807}`)
+
+	updates, err := d.NumIncrBy(mustPath(t, "$.*"), "2")
+	if err != nil {
+		t.Fatalf("NumIncrBy: %v", err)
+	}
+	var got []interface{}
+	for _, u := range updates {
+		got = append(got, u.Value)
+	}
+	// Keys in sorted order; the overflowing integer becomes a float
+	if s := EncodeJSON(got); s != `[9.223372036854776e+18,3.5,3,null]` {
+		t.Errorf("Unexpected results: %s", s)
+	}
+	if updates[3].Path != "" {
+		t.Errorf("Expected no path for a string, got %s", updates[3].Path)
+	}
+
+	if _, err := d.NumIncrBy(mustPath(t, "$.i"), `"1"`); !errors.Is(err, ErrJSONNotNumber) {
+		t.Errorf("Expected ErrJSONNotNumber, got %v", err)
+	}
+	if _, err := d.NumIncrBy(mustPath(t, "$.f"), "1e308"); err != nil {
+		t.Errorf("NumIncrBy: %v", err)
+	}
+	if _, err := d.NumIncrBy(mustPath(t, "$.f"), "1.7e308"); !errors.Is(err, ErrJSONNotFinite) {
+		t.Errorf("Expected ErrJSONNotFinite, got %v", err)
+	}
+}
+
+func TestJSONDoc_ArrAppend(t *testing.T) {
+	d := mustDoc(t, `{"a":[1],"b":"x"}`)
+
+	updates, err := d.ArrAppend(mustPath(t, "$.*"), "2", `{"c":3}`)
+	if err != nil {
+		t.Fatalf("ArrAppend: %v", err)
+	}
+	if updates[0].Value != 3 || updates[1].Path != "" {
+		t.Errorf("Unexpected updates: %+v", updates)
+	}
+	if got := EncodeJSON(d.root); got != `{"a":[1,2,{"c":3}],"b":"x"}` {
+		t.Errorf("Unexpected document: %s", got)
+	}
+	if _, err := d.ArrAppend(mustPath(t, "$.a"), "oops"); !errors.Is(err, ErrJSONInvalid) {
+		t.Errorf("Expected ErrJSONInvalid, got %v", err)
+	}
+}
+
+func TestJSONDoc_Size(t *testing.T) {
+	d := mustDoc(t, `{"a":{"b":1},"c":[],"d":{}}`)
+
+	steps := []func(){
+		func() { d.Set(mustPath(t, "$.a.x"), ` "new" `, false, false) },
+		func() { d.Set(mustPath(t, "$.a.b"), `[1, 2]`, false, false) },
+		func() { d.Set(mustPath(t, "$.d.e"), `"é\n"`, false, false) },
+		func() { d.Set(mustPath(t, "$.*.b"), `true`, false, false) },
+		func() { d.ArrAppend(mustPath(t, "$.c"), `1`, `{"z": 2}`) },
+		func() { d.NumIncrBy(mustPath(t, "$.c[*].z"), `1000`) },
+		func() { d.Delete(mustPath(t, "$.c[0]")) },
+		func() { d.Delete(mustPath(t, "$.*.b")) },
+		func() { d.Delete(mustPath(t, "$.d.e")) },
+		func() { d.Set(mustPath(t, "$"), `{"k": [1, 2, 3]}`, false, false) },
+		func() { d.Delete(mustPath(t, "$.k[*]")) },
+		func() { d.Delete(mustPath(t, "$")) },
+	}
+	for i, step := range steps {
+		step()
+		if want := int64(len(EncodeJSON(d.root))); d.Size() != want {
+			t.Fatalf("step %d: expected size %d of %s, got %d", i, want, EncodeJSON(d.root), d.Size())
+		}
+	}
+}
+
+func TestJSONEntry_Payload(t *testing.T) {
+	v, _ := DecodeJSON(`{"a":[1,"two",null,true],"b":1.25}`)
+	entry := NewJSONEntry(v)
+	payload := entry.Payload()
+	if payload != `{"a":[1,"two",null,true],"b":1.25}` {
+		t.Errorf("Expected the document as payload, got %s", payload)
+	}
+
+	decoded, err := NewEntryFromPayload(TypeJSON, payload)
+	if err != nil {
+		t.Fatalf("NewEntryFromPayload: %v", err)
+	}
+	if decoded.Type != TypeJSON || decoded.Payload() != payload {
+		t.Errorf("Expected the document to round trip, got %s", decoded.Payload())
+	}
+	if _, err := NewEntryFromPayload(TypeJSON, "{"); err == nil {
+		t.Error("Expected an error for an invalid payload")
+	}
+}
+
+func TestStore_JSON(t *testing.T) {
+	s := New()
+
+	s.Update(func(tx *Txn) error {
+		if _, err := tx.JSONSet("doc", mustPath(t, "$.a"), "1", false, false); err != nil {
+			t.Errorf("Expected a missing key to be left alone, got %v", err)
+		}
+		written, _ := tx.JSONSet("doc", mustPath(t, "$"), `{"a":1}`, false, true)
+		if len(written) != 0 {
+			t.Errorf("Expected XX not to create a key, wrote %v", written)
+		}
+		written, err := tx.JSONSet("doc", mustPath(t, "$"), `{"a":1}`, false, false)
+		if err != nil || len(written) != 1 {
+			t.Errorf("JSONSet: %v, %v", written, err)
+		}
+		return nil
+	})
+	v1 := s.Version("doc")
+
+	s.Update(func(tx *Txn) error {
+		if _, err := tx.JSONNumIncrBy("doc", mustPath(t, "$.missing"), "1"); err != nil {
+			t.Errorf("JSONNumIncrBy: %v", err)
+		}
+		return nil
+	})
+	if s.Version("doc") != v1 {
+		t.Error("Expected the version to stay the same when nothing changed")
+	}
+
+	s.Set("str", "x")
+	s.Update(func(tx *Txn) error {
+		if _, err := tx.JSON("str"); !errors.Is(err, ErrWrongType) {
+			t.Errorf("Expected ErrWrongType, got %v", err)
+		}
+		removed, _ := tx.JSONDel("doc", mustPath(t, "$"))
+		if len(removed) != 1 {
+			t.Errorf("Expected the root to be removed, got %v", removed)
+		}
+		return nil
+	})
+	if _, ok := s.Get("doc"); ok {
+		t.Error("Expected deleting the root to remove the key")
+	}
+
+	s.RestoreJSON("replayed", 42, func(d *JSONDoc) {
+		_, _ = d.Set(mustPath(t, "$"), `[1]`, false, false)
+	})
+	if e, ok := s.GetEntry("replayed"); !ok || e.Version != 42 || e.Payload() != "[1]" {
+		t.Errorf("Expected the replayed document, got %+v", e)
+	}
+}
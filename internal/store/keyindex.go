@@ -0,0 +1,318 @@
+// internal/store/keyindex.go
+package store
+
+import "sort"
+
+// btreeDegree is the minimum degree of the key index: every node but the
+// root holds between btreeDegree-1 and 2*btreeDegree-1 keys
+const btreeDegree = 32
+
+const btreeMaxKeys = 2*btreeDegree - 1
+
+// keyIndex is an ordered set of keys kept alongside the store's map. It is
+// a B-tree whose nodes also count the keys below them, so that finding a
+// key, or the key at a position, takes O(log n).
+type keyIndex struct {
+	root *btreeNode
+}
+
+type btreeNode struct {
+	keys     []string
+	children []*btreeNode // Empty for leaves, otherwise len(keys)+1
+	size     int          // Number of keys in the subtree
+}
+
+// Len returns the number of keys in the index
+func (ix *keyIndex) Len() int {
+	if ix.root == nil {
+		return 0
+	}
+	return ix.root.size
+}
+
+// Insert adds a key and reports whether it was missing
+func (ix *keyIndex) Insert(key string) bool {
+	if ix.root == nil {
+		ix.root = &btreeNode{keys: []string{key}, size: 1}
+		return true
+	}
+	if len(ix.root.keys) == btreeMaxKeys {
+		root := &btreeNode{children: []*btreeNode{ix.root}, size: ix.root.size}
+		root.splitChild(0)
+		ix.root = root
+	}
+	return ix.root.insert(key)
+}
+
+// Delete removes a key and reports whether it was present
+func (ix *keyIndex) Delete(key string) bool {
+	if ix.root == nil {
+		return false
+	}
+	removed := ix.root.remove(key)
+	if len(ix.root.keys) == 0 {
+		if ix.root.leaf() {
+			ix.root = nil
+		} else {
+			ix.root = ix.root.children[0]
+		}
+	}
+	return removed
+}
+
+// Rank returns the number of keys less than key
+func (ix *keyIndex) Rank(key string) int {
+	rank := 0
+	for n := ix.root; n != nil; {
+		i, found := n.find(key)
+		rank += i
+		if n.leaf() {
+			break
+		}
+		for _, c := range n.children[:i] {
+			rank += c.size
+		}
+		if found {
+			rank += n.children[i].size
+			break
+		}
+		n = n.children[i]
+	}
+	return rank
+}
+
+// Ascend calls fn for the keys from position rank on, in order, until fn
+// returns false
+func (ix *keyIndex) Ascend(rank int, fn func(key string) bool) {
+	if ix.root != nil {
+		ix.root.ascend(rank, fn)
+	}
+}
+
+// AscendFrom calls fn for the keys greater than or equal to start, in
+// order, until fn returns false
+func (ix *keyIndex) AscendFrom(start string, fn func(key string) bool) {
+	ix.Ascend(ix.Rank(start), fn)
+}
+
+func (n *btreeNode) leaf() bool {
+	return len(n.children) == 0
+}
+
+// find returns the position of the first key not less than key, and
+// whether it is key
+func (n *btreeNode) find(key string) (int, bool) {
+	i := sort.SearchStrings(n.keys, key)
+	return i, i < len(n.keys) && n.keys[i] == key
+}
+
+// recount recomputes the size of a node from its keys and children
+func (n *btreeNode) recount() {
+	n.size = len(n.keys)
+	for _, c := range n.children {
+		n.size += c.size
+	}
+}
+
+// splitChild splits the full child i around its median key, which moves
+// up into n
+func (n *btreeNode) splitChild(i int) {
+	child := n.children[i]
+	mid := btreeDegree - 1
+	right := &btreeNode{keys: append([]string(nil), child.keys[mid+1:]...)}
+	if !child.leaf() {
+		right.children = append([]*btreeNode(nil), child.children[mid+1:]...)
+		clear(child.children[mid+1:])
+		child.children = child.children[:mid+1]
+	}
+	median := child.keys[mid]
+	clear(child.keys[mid:])
+	child.keys = child.keys[:mid]
+	child.recount()
+	right.recount()
+
+	n.keys = insertAt(n.keys, i, median)
+	n.children = insertAt(n.children, i+1, right)
+}
+
+// insert adds key to the subtree of a node that isn't full
+func (n *btreeNode) insert(key string) bool {
+	i, found := n.find(key)
+	if found {
+		return false
+	}
+	if n.leaf() {
+		n.keys = insertAt(n.keys, i, key)
+		n.size++
+		return true
+	}
+
+	if len(n.children[i].keys) == btreeMaxKeys {
+		n.splitChild(i)
+		switch {
+		case key == n.keys[i]:
+			return false
+		case key > n.keys[i]:
+			i++
+		}
+	}
+	if !n.children[i].insert(key) {
+		return false
+	}
+	n.size++
+	return true
+}
+
+// remove deletes key from the subtree of a node that has at least
+// btreeDegree keys, or is the root
+func (n *btreeNode) remove(key string) bool {
+	i, found := n.find(key)
+	if n.leaf() {
+		if !found {
+			return false
+		}
+		n.keys = removeAt(n.keys, i)
+		n.size--
+		return true
+	}
+
+	if found {
+		left, right := n.children[i], n.children[i+1]
+		switch {
+		case len(left.keys) >= btreeDegree:
+			// Replace the key with its predecessor
+			pred := left.max()
+			n.keys[i] = pred
+			left.remove(pred)
+		case len(right.keys) >= btreeDegree:
+			// Replace the key with its successor
+			succ := right.min()
+			n.keys[i] = succ
+			right.remove(succ)
+		default:
+			n.merge(i)
+			left.remove(key)
+		}
+		n.size--
+		return true
+	}
+
+	// Make sure the child the key would be in can lose one
+	if len(n.children[i].keys) < btreeDegree {
+		switch {
+		case i > 0 && len(n.children[i-1].keys) >= btreeDegree:
+			n.rotateRight(i)
+		case i < len(n.keys) && len(n.children[i+1].keys) >= btreeDegree:
+			n.rotateLeft(i)
+		case i < len(n.keys):
+			n.merge(i)
+		default:
+			n.merge(i - 1)
+			i--
+		}
+	}
+	if !n.children[i].remove(key) {
+		return false
+	}
+	n.size--
+	return true
+}
+
+// rotateRight moves the last key of child i-1 up into n, and the key of n
+// between them down to the front of child i
+func (n *btreeNode) rotateRight(i int) {
+	left, child := n.children[i-1], n.children[i]
+	child.keys = insertAt(child.keys, 0, n.keys[i-1])
+	n.keys[i-1] = left.keys[len(left.keys)-1]
+	left.keys = removeAt(left.keys, len(left.keys)-1)
+	if !left.leaf() {
+		child.children = insertAt(child.children, 0, left.children[len(left.children)-1])
+		left.children = removeAt(left.children, len(left.children)-1)
+	}
+	left.recount()
+	child.recount()
+}
+
+// rotateLeft moves the first key of child i+1 up into n, and the key of n
+// between them down to the end of child i
+func (n *btreeNode) rotateLeft(i int) {
+	child, right := n.children[i], n.children[i+1]
+	child.keys = append(child.keys, n.keys[i])
+	n.keys[i] = right.keys[0]
+	right.keys = removeAt(right.keys, 0)
+	if !right.leaf() {
+		child.children = append(child.children, right.children[0])
+		right.children = removeAt(right.children, 0)
+	}
+	child.recount()
+	right.recount()
+}
+
+// merge joins child i+1 and the key between them into child i
+func (n *btreeNode) merge(i int) {
+	left, right := n.children[i], n.children[i+1]
+	left.keys = append(left.keys, n.keys[i])
+	left.keys = append(left.keys, right.keys...)
+	left.children = append(left.children, right.children...)
+	left.recount()
+	n.keys = removeAt(n.keys, i)
+	n.children = removeAt(n.children, i+1)
+}
+
+func (n *btreeNode) min() string {
+	for !n.leaf() {
+		n = n.children[0]
+	}
+	return n.keys[0]
+}
+
+func (n *btreeNode) max() string {
+	for !n.leaf() {
+		n = n.children[len(n.children)-1]
+	}
+	return n.keys[len(n.keys)-1]
+}
+
+// ascend calls fn for the keys of the subtree after the first skip ones,
+// and returns false once fn does
+func (n *btreeNode) ascend(skip int, fn func(key string) bool) bool {
+	for i := 0; i <= len(n.keys); i++ {
+		if !n.leaf() {
+			c := n.children[i]
+			if skip >= c.size {
+				skip -= c.size
+			} else {
+				if !c.ascend(skip, fn) {
+					return false
+				}
+				skip = 0
+			}
+		}
+		if i == len(n.keys) {
+			break
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if !fn(n.keys[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func insertAt[T any](s []T, i int, v T) []T {
+	var zero T
+	s = append(s, zero)
+	copy(s[i+1:], s[i:])
+	s[i] = v
+	return s
+}
+
+func removeAt[T any](s []T, i int) []T {
+	copy(s[i:], s[i+1:])
+	var zero T
+	s[len(s)-1] = zero
+	return s[:len(s)-1]
+}
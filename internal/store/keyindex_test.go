@@ -0,0 +1,71 @@
+// internal/store/keyindex_test.go
+package store
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestKeyIndex_MatchesSortedSet(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var ix keyIndex
+	set := make(map[string]bool)
+
+	for i := 0; i < 50000; i++ {
+		key := fmt.Sprintf("k%05d", rng.Intn(5000))
+		if rng.Intn(3) == 0 {
+			if got := ix.Delete(key); got != set[key] {
+				t.Fatalf("Delete(%q) = %v, want %v", key, got, set[key])
+			}
+			delete(set, key)
+		} else {
+			if got := ix.Insert(key); got == set[key] {
+				t.Fatalf("Insert(%q) = %v, want %v", key, got, !set[key])
+			}
+			set[key] = true
+		}
+		if ix.Len() != len(set) {
+			t.Fatalf("Len() = %d, want %d", ix.Len(), len(set))
+		}
+	}
+
+	want := make([]string, 0, len(set))
+	for key := range set {
+		want = append(want, key)
+	}
+	sort.Strings(want)
+
+	var got []string
+	ix.Ascend(0, func(key string) bool {
+		got = append(got, key)
+		return true
+	})
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("Expected keys in order, got %d keys, want %d", len(got), len(want))
+	}
+
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("k%05d", rng.Intn(5100))
+		rank := sort.SearchStrings(want, key)
+		if got := ix.Rank(key); got != rank {
+			t.Fatalf("Rank(%q) = %d, want %d", key, got, rank)
+		}
+		var first string
+		ix.Ascend(rank, func(k string) bool {
+			first = k
+			return false
+		})
+		if rank < len(want) && first != want[rank] {
+			t.Fatalf("Ascend(%d) started at %q, want %q", rank, first, want[rank])
+		}
+	}
+
+	for _, key := range want {
+		ix.Delete(key)
+	}
+	if ix.Len() != 0 || ix.root != nil {
+		t.Errorf("Expected an empty index, got %d keys", ix.Len())
+	}
+}
@@ -0,0 +1,362 @@
+// internal/store/list.go
+package store
+
+// minListCapacity is the smallest ring buffer a list allocates
+const minListCapacity = 8
+
+// List is a double-ended queue of strings backed by a ring buffer.
+// Pushes and pops at either end are amortized O(1) and indexing is O(1).
+type List struct {
+	buf  []string
+	head int // Index of the first element in buf
+	n    int // Number of elements
+}
+
+// NewList creates an empty list
+func NewList() *List {
+	return &List{buf: make([]string, minListCapacity)}
+}
+
+// Len returns the number of elements in the list
+func (l *List) Len() int {
+	return l.n
+}
+
+// at returns the buffer position of the i-th element
+func (l *List) at(i int) int {
+	return (l.head + i) % len(l.buf)
+}
+
+// resize moves the elements into a buffer of the given capacity
+func (l *List) resize(capacity int) {
+	if capacity < minListCapacity {
+		capacity = minListCapacity
+	}
+	buf := make([]string, capacity)
+	for i := 0; i < l.n; i++ {
+		buf[i] = l.buf[l.at(i)]
+	}
+	l.buf = buf
+	l.head = 0
+}
+
+// grow makes room for one more element
+func (l *List) grow() {
+	if l.n == len(l.buf) {
+		l.resize(len(l.buf) * 2)
+	}
+}
+
+// shrink releases memory once the list is mostly empty
+func (l *List) shrink() {
+	if len(l.buf) > minListCapacity && l.n <= len(l.buf)/4 {
+		l.resize(len(l.buf) / 2)
+	}
+}
+
+// PushFront adds an element at the head of the list
+func (l *List) PushFront(value string) {
+	l.grow()
+	l.head = (l.head - 1 + len(l.buf)) % len(l.buf)
+	l.buf[l.head] = value
+	l.n++
+}
+
+// PushBack adds an element at the tail of the list
+func (l *List) PushBack(value string) {
+	l.grow()
+	l.buf[l.at(l.n)] = value
+	l.n++
+}
+
+// PopFront removes and returns the head of the list
+func (l *List) PopFront() (string, bool) {
+	if l.n == 0 {
+		return "", false
+	}
+	value := l.buf[l.head]
+	l.buf[l.head] = ""
+	l.head = (l.head + 1) % len(l.buf)
+	l.n--
+	l.shrink()
+	return value, true
+}
+
+// PopBack removes and returns the tail of the list
+func (l *List) PopBack() (string, bool) {
+	if l.n == 0 {
+		return "", false
+	}
+	i := l.at(l.n - 1)
+	value := l.buf[i]
+	l.buf[i] = ""
+	l.n--
+	l.shrink()
+	return value, true
+}
+
+// Index returns the element at index; negative indexes count from the tail
+func (l *List) Index(index int) (string, bool) {
+	if index < 0 {
+		index += l.n
+	}
+	if index < 0 || index >= l.n {
+		return "", false
+	}
+	return l.buf[l.at(index)], true
+}
+
+// bounds converts an inclusive start/stop range, where negative indexes
+// count from the tail, into a half-open range of valid positions
+func (l *List) bounds(start, stop int) (int, int) {
+	if start < 0 {
+		start += l.n
+	}
+	if stop < 0 {
+		stop += l.n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= l.n {
+		stop = l.n - 1
+	}
+	if start > stop {
+		return 0, 0
+	}
+	return start, stop + 1
+}
+
+// Range returns the elements from start to stop inclusive
+func (l *List) Range(start, stop int) []string {
+	from, to := l.bounds(start, stop)
+	values := make([]string, 0, to-from)
+	for i := from; i < to; i++ {
+		values = append(values, l.buf[l.at(i)])
+	}
+	return values
+}
+
+// Values returns all elements from head to tail
+func (l *List) Values() []string {
+	return l.Range(0, -1)
+}
+
+// Trim keeps only the elements from start to stop inclusive
+func (l *List) Trim(start, stop int) {
+	l.replace(l.Range(start, stop))
+}
+
+// Remove deletes elements equal to value: the first count from the head
+// if count is positive, the last -count from the tail if it is negative,
+// all of them if it is 0. Returns the number of elements removed.
+func (l *List) Remove(count int, value string) int {
+	values := l.Values()
+	removed := 0
+	keep := make([]string, 0, len(values))
+
+	if count < 0 {
+		// Walk from the tail, then restore the original order
+		for i := len(values) - 1; i >= 0; i-- {
+			if values[i] == value && removed < -count {
+				removed++
+				continue
+			}
+			keep = append(keep, values[i])
+		}
+		for i, j := 0, len(keep)-1; i < j; i, j = i+1, j-1 {
+			keep[i], keep[j] = keep[j], keep[i]
+		}
+	} else {
+		for _, v := range values {
+			if v == value && (count == 0 || removed < count) {
+				removed++
+				continue
+			}
+			keep = append(keep, v)
+		}
+	}
+
+	if removed > 0 {
+		l.replace(keep)
+	}
+	return removed
+}
+
+// replace swaps the contents of the list for values
+func (l *List) replace(values []string) {
+	capacity := minListCapacity
+	for capacity < len(values) {
+		capacity *= 2
+	}
+	l.buf = make([]string, capacity)
+	copy(l.buf, values)
+	l.head = 0
+	l.n = len(values)
+}
+
+// list returns the list stored at key, or nil if the key doesn't exist
+func (tx *Txn) list(key string) (*Entry, error) {
+	entry, ok := tx.lookup(key)
+	if !ok {
+		return nil, nil
+	}
+	if entry.Type != TypeList {
+		return nil, ErrWrongType
+	}
+	return entry, nil
+}
+
+// RestoreList replays a list operation, keeping its version. The list is
+// created if missing and removed if fn leaves it empty.
+func (s *Store) RestoreList(key string, version uint64, fn func(l *List)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.restored(key, TypeList)
+	if !ok {
+		return
+	}
+	if entry == nil {
+		entry = NewListEntry()
+		s.insert(key, entry)
+	}
+	fn(entry.List)
+	s.stamp(entry, version)
+	if entry.List.Len() == 0 {
+		s.remove(key)
+	}
+}
+
+// push adds an element to the list stored at key, creating it if needed
+func (tx *Txn) push(key, value string, front bool) (int, error) {
+	entry, err := tx.list(key)
+	if err != nil {
+		return 0, err
+	}
+	if entry == nil {
+		entry = NewListEntry()
+		tx.s.put(key, entry)
+	} else {
+		tx.s.touch(entry)
+	}
+
+	if front {
+		entry.List.PushFront(value)
+	} else {
+		entry.List.PushBack(value)
+	}
+	return entry.List.Len(), nil
+}
+
+// pop removes an element from the list stored at key. The key is removed
+// together with its last element.
+func (tx *Txn) pop(key string, front bool) (string, bool, error) {
+	entry, err := tx.list(key)
+	if entry == nil || err != nil {
+		return "", false, err
+	}
+
+	var value string
+	if front {
+		value, _ = entry.List.PopFront()
+	} else {
+		value, _ = entry.List.PopBack()
+	}
+	tx.s.touch(entry)
+	if entry.List.Len() == 0 {
+		tx.s.remove(key)
+	}
+	return value, true, nil
+}
+
+// LPush adds an element at the head of the list stored at key
+// Returns the length of the list after the push
+func (tx *Txn) LPush(key, value string) (int, error) {
+	return tx.push(key, value, true)
+}
+
+// RPush adds an element at the tail of the list stored at key
+// Returns the length of the list after the push
+func (tx *Txn) RPush(key, value string) (int, error) {
+	return tx.push(key, value, false)
+}
+
+// LPop removes and returns the head of the list stored at key
+func (tx *Txn) LPop(key string) (string, bool, error) {
+	return tx.pop(key, true)
+}
+
+// RPop removes and returns the tail of the list stored at key
+func (tx *Txn) RPop(key string) (string, bool, error) {
+	return tx.pop(key, false)
+}
+
+// LLen returns the length of the list stored at key
+func (tx *Txn) LLen(key string) (int, error) {
+	entry, err := tx.list(key)
+	if entry == nil || err != nil {
+		return 0, err
+	}
+	return entry.List.Len(), nil
+}
+
+// LIndex returns the element at index in the list stored at key
+func (tx *Txn) LIndex(key string, index int) (string, bool, error) {
+	entry, err := tx.list(key)
+	if entry == nil || err != nil {
+		return "", false, err
+	}
+	value, ok := entry.List.Index(index)
+	return value, ok, nil
+}
+
+// LRange returns the elements from start to stop inclusive of the list
+// stored at key
+func (tx *Txn) LRange(key string, start, stop int) ([]string, error) {
+	entry, err := tx.list(key)
+	if entry == nil || err != nil {
+		return nil, err
+	}
+	return entry.List.Range(start, stop), nil
+}
+
+// LRem removes elements equal to value from the list stored at key, see
+// List.Remove. Returns the number of elements removed.
+func (tx *Txn) LRem(key string, count int, value string) (int, error) {
+	entry, err := tx.list(key)
+	if entry == nil || err != nil {
+		return 0, err
+	}
+	removed := entry.List.Remove(count, value)
+	if removed == 0 {
+		return 0, nil
+	}
+	tx.s.touch(entry)
+	if entry.List.Len() == 0 {
+		tx.s.remove(key)
+	}
+	return removed, nil
+}
+
+// LTrim keeps only the elements from start to stop inclusive of the list
+// stored at key. Returns true if the list existed.
+func (tx *Txn) LTrim(key string, start, stop int) (bool, error) {
+	entry, err := tx.list(key)
+	if entry == nil || err != nil {
+		return false, err
+	}
+	entry.List.Trim(start, stop)
+	tx.s.touch(entry)
+	if entry.List.Len() == 0 {
+		tx.s.remove(key)
+	}
+	return true, nil
+}
+
+// IsList reports whether key is missing or holds a list, i.e. whether
+// list operations on it would succeed
+func (tx *Txn) IsList(key string) bool {
+	_, err := tx.list(key)
+	return err == nil
+}
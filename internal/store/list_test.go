@@ -0,0 +1,133 @@
+// internal/store/list_test.go
+package store
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestList_Deque(t *testing.T) {
+	l := NewList()
+
+	// Push past the initial capacity from both ends so the ring wraps
+	for i := 0; i < 20; i++ {
+		l.PushBack(fmt.Sprint(i))
+		l.PushFront(fmt.Sprint(-i - 1))
+	}
+	if l.Len() != 40 {
+		t.Fatalf("Expected 40 elements, got %d", l.Len())
+	}
+	if v, _ := l.Index(0); v != "-20" {
+		t.Errorf("Expected head -20, got %s", v)
+	}
+	if v, _ := l.Index(-1); v != "19" {
+		t.Errorf("Expected tail 19, got %s", v)
+	}
+	if _, ok := l.Index(40); ok {
+		t.Error("Index past the end should fail")
+	}
+
+	for i := 0; i < 20; i++ {
+		if v, ok := l.PopBack(); !ok || v != fmt.Sprint(19-i) {
+			t.Fatalf("PopBack %d: got %s", i, v)
+		}
+	}
+	if v, _ := l.PopFront(); v != "-20" {
+		t.Errorf("Expected PopFront -20, got %s", v)
+	}
+	if l.Len() != 19 {
+		t.Errorf("Expected 19 elements, got %d", l.Len())
+	}
+}
+
+func TestList_RangeTrimRemove(t *testing.T) {
+	l := NewList()
+	for _, v := range []string{"a", "b", "a", "c", "a"} {
+		l.PushBack(v)
+	}
+
+	tests := []struct {
+		start, stop int
+		want        []string
+	}{
+		{0, -1, []string{"a", "b", "a", "c", "a"}},
+		{1, 2, []string{"b", "a"}},
+		{-2, -1, []string{"c", "a"}},
+		{-100, 0, []string{"a"}},
+		{3, 100, []string{"c", "a"}},
+		{4, 1, []string{}},
+		{10, 20, []string{}},
+	}
+	for _, tt := range tests {
+		if got := l.Range(tt.start, tt.stop); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Range(%d, %d) = %v, want %v", tt.start, tt.stop, got, tt.want)
+		}
+	}
+
+	if n := l.Remove(-1, "a"); n != 1 || !reflect.DeepEqual(l.Values(), []string{"a", "b", "a", "c"}) {
+		t.Errorf("Remove(-1) removed %d, left %v", n, l.Values())
+	}
+	if n := l.Remove(1, "a"); n != 1 || !reflect.DeepEqual(l.Values(), []string{"b", "a", "c"}) {
+		t.Errorf("Remove(1) removed %d, left %v", n, l.Values())
+	}
+
+	l.Trim(1, -1)
+	if !reflect.DeepEqual(l.Values(), []string{"a", "c"}) {
+		t.Errorf("Trim left %v", l.Values())
+	}
+	if n := l.Remove(0, "x"); n != 0 {
+		t.Errorf("Remove of a missing value removed %d", n)
+	}
+}
+
+func TestTxn_List(t *testing.T) {
+	s := New()
+	s.Set("str", "value")
+
+	_ = s.Update(func(tx *Txn) error {
+		_, _ = tx.RPush("l", "b")
+		if n, err := tx.LPush("l", "a"); err != nil || n != 2 {
+			t.Errorf("LPush: %d, %v", n, err)
+		}
+		if _, err := tx.RPush("str", "x"); !errors.Is(err, ErrWrongType) {
+			t.Errorf("Expected ErrWrongType, got %v", err)
+		}
+		if tx.IsList("str") || !tx.IsList("l") || !tx.IsList("missing") {
+			t.Error("IsList reported the wrong result")
+		}
+		return nil
+	})
+
+	// Popping the last element removes the key
+	_ = s.Update(func(tx *Txn) error {
+		if v, ok, _ := tx.LPop("l"); !ok || v != "a" {
+			t.Errorf("Expected LPop a, got %q", v)
+		}
+		if v, ok, _ := tx.RPop("l"); !ok || v != "b" {
+			t.Errorf("Expected RPop b, got %q", v)
+		}
+		if _, ok, _ := tx.RPop("l"); ok {
+			t.Error("Pop from a missing list should fail")
+		}
+		return nil
+	})
+	if s.Version("l") != 0 {
+		t.Error("Expected key to be removed with its last element")
+	}
+}
+
+func TestEntry_ListPayload(t *testing.T) {
+	entry := NewListEntry()
+	entry.List.PushBack("x")
+	entry.List.PushFront("w")
+
+	decoded, err := NewEntryFromPayload(TypeList, entry.Payload())
+	if err != nil {
+		t.Fatalf("NewEntryFromPayload failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.List.Values(), []string{"w", "x"}) {
+		t.Errorf("Expected [w x], got %v", decoded.List.Values())
+	}
+}
@@ -0,0 +1,156 @@
+// internal/store/memory.go
+package store
+
+// Memory accounting is approximate: each key costs a fixed overhead plus
+// its length and an estimate of its value. Collections are estimated from
+// a few sampled elements, so keeping the total up to date on every write
+// costs the same whatever their size.
+
+const (
+	entryOverhead   = 64 // Bytes counted per key for the map slot, index and Entry
+	elementOverhead = 16 // Bytes counted per element of a collection
+	memorySamples   = 8  // Elements sampled to estimate the size of a collection
+)
+
+// Bytes returns the approximate memory used by the keys and values of the
+// store
+func (s *Store) Bytes() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.bytes
+}
+
+// Usage returns the number of keys, expired ones included until they are
+// removed, and the approximate memory they use
+func (tx *Txn) Usage() (int, int64) {
+	return len(tx.s.data), tx.s.bytes
+}
+
+// Growth estimates by how many bytes the total grows when a value using
+// about size bytes is stored at key, replacing the current one if any
+func (tx *Txn) Growth(key string, size int64) int64 {
+	grown := entryOverhead + size
+	if old, ok := tx.s.data[key]; ok {
+		return grown - old.size
+	}
+	return grown + int64(len(key))
+}
+
+// ElementSize estimates the memory used by a collection element made of
+// parts, such as a hash field and its value
+func ElementSize(parts ...string) int64 {
+	size := int64(elementOverhead)
+	for _, part := range parts {
+		size += int64(len(part))
+	}
+	return size
+}
+
+// account updates the total for an entry stored under key, replacing old
+// (nil for a new key)
+// Caller must hold the write lock
+func (s *Store) account(key string, entry, old *Entry) {
+	if old != nil {
+		s.bytes -= old.size
+	} else {
+		s.bytes += int64(len(key))
+	}
+	entry.size = entryOverhead + entry.MemoryUsage()
+	s.bytes += entry.size
+}
+
+// unaccount removes an entry stored under key from the total
+// Caller must hold the write lock
+func (s *Store) unaccount(key string, entry *Entry) {
+	s.bytes -= int64(len(key)) + entry.size
+	entry.size = 0
+}
+
+// resize re-estimates an entry after an in-place change. Entries that
+// aren't stored yet are left to account.
+// Caller must hold the write lock
+func (s *Store) resize(entry *Entry) {
+	if entry.size == 0 {
+		return
+	}
+	size := entryOverhead + entry.MemoryUsage()
+	s.bytes += size - entry.size
+	entry.size = size
+}
+
+// MemoryUsage estimates the bytes held by the entry's value
+func (e *Entry) MemoryUsage() int64 {
+	switch e.Type {
+	case TypeString:
+		return int64(e.StrLen())
+	case TypeHash:
+		var sampled, n int64
+		for field, value := range e.Hash {
+			sampled += int64(len(field) + len(value))
+			if n++; n == memorySamples {
+				break
+			}
+		}
+		return estimate(sampled, n, len(e.Hash))
+	case TypeSet:
+		var sampled, n int64
+		for member := range e.Set {
+			sampled += int64(len(member))
+			if n++; n == memorySamples {
+				break
+			}
+		}
+		return estimate(sampled, n, len(e.Set))
+	case TypeList:
+		var sampled, n int64
+		step := e.List.Len()/memorySamples + 1
+		for i := 0; i < e.List.Len(); i += step {
+			value, _ := e.List.Index(i)
+			sampled += int64(len(value))
+			n++
+		}
+		return estimate(sampled, n, e.List.Len())
+	case TypeZSet:
+		var sampled, n int64
+		step := e.ZSet.Len()/memorySamples + 1
+		for rank := 1; rank <= e.ZSet.Len(); rank += step {
+			sampled += int64(len(e.ZSet.byRank(rank).member)) + 8
+			n++
+		}
+		return estimate(sampled, n, e.ZSet.Len())
+	case TypeStream:
+		var sampled, n int64
+		step := e.Stream.Len()/memorySamples + 1
+		for i := 0; i < e.Stream.Len(); i += step {
+			sampled += 16
+			for _, field := range e.Stream.entries[i].Fields {
+				sampled += int64(len(field))
+			}
+			n++
+		}
+		return estimate(sampled, n, e.Stream.Len())
+	case TypeHLL:
+		if e.HLL.dense != nil {
+			return int64(len(e.HLL.dense))
+		}
+		return int64(4 * len(e.HLL.sparse))
+	case TypeBloom:
+		var size int64
+		for _, f := range e.Bloom.filters {
+			size += int64(8 * len(f.bits))
+		}
+		return size
+	case TypeJSON:
+		return e.JSON.Size()
+	}
+	return 0
+}
+
+// estimate extrapolates the size of count elements from n sampled ones
+// totalling sampled bytes
+func estimate(sampled, n int64, count int) int64 {
+	if n == 0 {
+		return 0
+	}
+	return (sampled/n + elementOverhead) * int64(count)
+}
@@ -0,0 +1,64 @@
+// internal/store/memory_test.go
+package store
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestStore_Bytes(t *testing.T) {
+	s := New()
+	if s.Bytes() != 0 {
+		t.Fatalf("Expected 0 bytes for an empty store, got %d", s.Bytes())
+	}
+
+	s.Set("key", "value")
+	single := s.Bytes()
+	if single != entryOverhead+int64(len("key")+len("value")) {
+		t.Errorf("Unexpected size of a string: %d", single)
+	}
+
+	// Overwriting replaces the value's share
+	s.Set("key", "a much longer value")
+	if s.Bytes() != single+int64(len("a much longer value")-len("value")) {
+		t.Errorf("Unexpected size after overwrite: %d", s.Bytes())
+	}
+
+	// Collections grow with their elements
+	_ = s.Update(func(tx *Txn) error {
+		for i := 0; i < 100; i++ {
+			_, _ = tx.HSet("hash", fmt.Sprintf("field%03d", i), "value")
+			_, _ = tx.RPush("list", "element")
+			_, _ = tx.SAdd("set", fmt.Sprintf("member%03d", i))
+		}
+		return nil
+	})
+	// Every field and value is 8+5 bytes, so the estimate is exact
+	hashSize := entryOverhead + int64(len("hash")) + 100*(13+elementOverhead)
+	before := s.Bytes()
+	if !s.Delete("hash") {
+		t.Fatal("Expected hash to exist")
+	}
+	if freed := before - s.Bytes(); freed != hashSize {
+		t.Errorf("Expected the hash to account for %d bytes, got %d", hashSize, freed)
+	}
+
+	// Removing everything brings the total back to 0
+	s.Delete("key")
+	_ = s.Update(func(tx *Txn) error {
+		for i := 0; i < 100; i++ {
+			_, _, _ = tx.RPop("list")
+			_, _ = tx.SRem("set", fmt.Sprintf("member%03d", i))
+		}
+		return nil
+	})
+	if s.Bytes() != 0 {
+		t.Errorf("Expected 0 bytes after removing all elements, got %d", s.Bytes())
+	}
+
+	s.Set("a", "1")
+	s.Clear()
+	if s.Bytes() != 0 {
+		t.Errorf("Expected 0 bytes after Clear, got %d", s.Bytes())
+	}
+}
@@ -0,0 +1,162 @@
+// internal/store/set.go
+package store
+
+import (
+	"sort"
+)
+
+// Members returns the members of a set entry, sorted
+func (e *Entry) Members() []string {
+	members := make([]string, 0, len(e.Set))
+	for m := range e.Set {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// set returns the set stored at key, or nil if the key doesn't exist
+func (tx *Txn) set(key string) (*Entry, error) {
+	entry, ok := tx.lookup(key)
+	if !ok {
+		return nil, nil
+	}
+	if entry.Type != TypeSet {
+		return nil, ErrWrongType
+	}
+	return entry, nil
+}
+
+// RestoreSetAdd replays a set member addition, keeping its version
+func (s *Store) RestoreSetAdd(key, member string, version uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.restored(key, TypeSet)
+	if !ok {
+		return
+	}
+	if entry == nil {
+		entry = NewSetEntry()
+		s.insert(key, entry)
+	}
+	entry.Set[member] = struct{}{}
+	s.stamp(entry, version)
+}
+
+// RestoreSetRemove replays a set member removal, keeping its version
+func (s *Store) RestoreSetRemove(key, member string, version uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, _ := s.restored(key, TypeSet)
+	if entry == nil {
+		return
+	}
+	delete(entry.Set, member)
+	s.stamp(entry, version)
+	if len(entry.Set) == 0 {
+		s.remove(key)
+	}
+}
+
+// SAdd adds a member to the set stored at key, creating the set if needed
+// Returns true if the member is new
+func (tx *Txn) SAdd(key, member string) (bool, error) {
+	entry, err := tx.set(key)
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		entry = NewSetEntry()
+		entry.Set[member] = struct{}{}
+		tx.s.put(key, entry)
+		return true, nil
+	}
+
+	if _, ok := entry.Set[member]; ok {
+		return false, nil
+	}
+	entry.Set[member] = struct{}{}
+	tx.s.touch(entry)
+	return true, nil
+}
+
+// SRem removes a member from the set stored at key. The key is removed
+// together with its last member.
+// Returns true if the member existed
+func (tx *Txn) SRem(key, member string) (bool, error) {
+	entry, err := tx.set(key)
+	if entry == nil || err != nil {
+		return false, err
+	}
+	if _, ok := entry.Set[member]; !ok {
+		return false, nil
+	}
+
+	delete(entry.Set, member)
+	if len(entry.Set) == 0 {
+		tx.s.remove(key)
+		return true, nil
+	}
+	tx.s.touch(entry)
+	return true, nil
+}
+
+// SIsMember reports whether member is in the set stored at key
+func (tx *Txn) SIsMember(key, member string) (bool, error) {
+	entry, err := tx.set(key)
+	if entry == nil || err != nil {
+		return false, err
+	}
+	_, ok := entry.Set[member]
+	return ok, nil
+}
+
+// SCard returns the number of members of the set stored at key
+func (tx *Txn) SCard(key string) (int, error) {
+	entry, err := tx.set(key)
+	if entry == nil || err != nil {
+		return 0, err
+	}
+	return len(entry.Set), nil
+}
+
+// SMembers returns the members of the set stored at key, sorted
+func (tx *Txn) SMembers(key string) ([]string, error) {
+	entry, err := tx.set(key)
+	if entry == nil || err != nil {
+		return nil, err
+	}
+	return entry.Members(), nil
+}
+
+// SScan returns the members of the set stored at key matching pattern, in
+// sorted order, with pagination
+// Returns: next cursor (0 when done), members
+func (tx *Txn) SScan(key string, cursor int, pattern string, count int) (int, []string, error) {
+	entry, err := tx.set(key)
+	if entry == nil || err != nil {
+		return 0, nil, err
+	}
+	if count <= 0 {
+		count = 10 // Default page size
+	}
+
+	var members []string
+	for m := range entry.Set {
+		if matchPattern(pattern, m) {
+			members = append(members, m)
+		}
+	}
+	sort.Strings(members)
+
+	if cursor >= len(members) {
+		return 0, nil, nil
+	}
+	end := cursor + count
+	if end >= len(members) {
+		return 0, members[cursor:], nil
+	}
+	return end, members[cursor:end], nil
+}
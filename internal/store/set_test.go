@@ -0,0 +1,78 @@
+// internal/store/set_test.go
+package store
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTxn_Set(t *testing.T) {
+	s := New()
+	s.Set("str", "value")
+
+	_ = s.Update(func(tx *Txn) error {
+		if added, err := tx.SAdd("s", "b"); err != nil || !added {
+			t.Errorf("SAdd new member: %v, %v", added, err)
+		}
+		if added, _ := tx.SAdd("s", "b"); added {
+			t.Error("SAdd of an existing member should not report it as added")
+		}
+		_, _ = tx.SAdd("s", "a")
+		_, _ = tx.SAdd("s", "c")
+
+		if ok, _ := tx.SIsMember("s", "a"); !ok {
+			t.Error("Expected a to be a member")
+		}
+		if n, _ := tx.SCard("s"); n != 3 {
+			t.Errorf("Expected 3 members, got %d", n)
+		}
+		if members, _ := tx.SMembers("s"); !reflect.DeepEqual(members, []string{"a", "b", "c"}) {
+			t.Errorf("Unexpected SMembers: %v", members)
+		}
+
+		next, members, _ := tx.SScan("s", 0, "*", 2)
+		if next != 2 || !reflect.DeepEqual(members, []string{"a", "b"}) {
+			t.Errorf("Unexpected first SScan page: %d %v", next, members)
+		}
+		next, members, _ = tx.SScan("s", next, "*", 2)
+		if next != 0 || !reflect.DeepEqual(members, []string{"c"}) {
+			t.Errorf("Unexpected last SScan page: %d %v", next, members)
+		}
+
+		if _, err := tx.SAdd("str", "x"); !errors.Is(err, ErrWrongType) {
+			t.Errorf("Expected ErrWrongType, got %v", err)
+		}
+		return nil
+	})
+
+	// Removing the last member removes the key
+	_ = s.Update(func(tx *Txn) error {
+		for _, m := range []string{"a", "b", "c"} {
+			if ok, _ := tx.SRem("s", m); !ok {
+				t.Errorf("Expected SRem %s to succeed", m)
+			}
+		}
+		return nil
+	})
+	if s.Version("s") != 0 {
+		t.Error("Expected key to be removed with its last member")
+	}
+}
+
+func TestEntry_SetPayload(t *testing.T) {
+	entry := NewSetEntry()
+	entry.Set["y"] = struct{}{}
+	entry.Set["x"] = struct{}{}
+
+	if p := entry.Payload(); p != `["x","y"]` {
+		t.Errorf("Expected sorted payload, got %s", p)
+	}
+	decoded, err := NewEntryFromPayload(TypeSet, entry.Payload())
+	if err != nil {
+		t.Fatalf("NewEntryFromPayload failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Members(), []string{"x", "y"}) {
+		t.Errorf("Expected [x y], got %v", decoded.Members())
+	}
+}
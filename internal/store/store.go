@@ -2,20 +2,57 @@
 package store
 
 import (
+	"math/rand"
+	"strings"
 	"sync"
 	"time"
 )
 
-// Store implements a thread-safe in-memory key-value store with TTL support
+// Store implements a thread-safe in-memory key-value store with TTL support.
+// Stores created with NewSibling are separate keyspaces, such as logical
+// databases, that share one lock and one version counter.
 type Store struct {
-	mu   sync.RWMutex
-	data map[string]*Entry
+	*shared
+	data     map[string]*Entry
+	index    keyIndex    // The keys of data in order, protected by mu
+	bytes    int64       // Approximate memory used by data, see memory.go
+	expiries expiryIndex // The keys of data with an expiration, see expiry.go
+	removals uint64      // Number of removals, protected by mu, see Removals
+	onExpire func(key string)
+}
+
+// shared is the state common to a store and its siblings
+type shared struct {
+	mu      sync.RWMutex
+	version uint64 // Last version handed out, protected by mu
+}
+
+// randomKeyTries is how many random keys RandomKey tries before looking
+// for a live key in order
+const randomKeyTries = 16
+
+// KeyValue is a string key with its value
+type KeyValue struct {
+	Key   string
+	Value string
 }
 
 // New creates a new Store instance
 func New() *Store {
 	return &Store{
-		data: make(map[string]*Entry),
+		shared: &shared{},
+		data:   make(map[string]*Entry),
+	}
+}
+
+// NewSibling creates an empty store sharing s's lock and version counter.
+// Holding the lock of one store holds it for all its siblings, so a Txn
+// can work on several of them at once, and versions are unique across
+// them.
+func (s *Store) NewSibling() *Store {
+	return &Store{
+		shared: s.shared,
+		data:   make(map[string]*Entry),
 	}
 }
 
@@ -23,34 +60,197 @@ func New() *Store {
 func (s *Store) Set(key, value string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.data[key] = NewEntry(value)
+	s.put(key, NewEntry(value))
 }
 
 // SetWithTTL stores a key-value pair with TTL
 func (s *Store) SetWithTTL(key, value string, ttl time.Duration) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.data[key] = NewEntryWithTTL(value, ttl)
+	s.put(key, NewEntryWithTTL(value, ttl))
 }
 
-// Get retrieves a value by key (with lazy expiration)
-// Returns the value and true if found and not expired, empty string and false otherwise
-func (s *Store) Get(key string) (string, bool) {
+// Put stores a prepared entry, e.g. one with an absolute expiration
+func (s *Store) Put(key string, entry *Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(key, entry)
+}
+
+// Restore stores an entry recovered from disk, keeping its version.
+// Entries without a version (older WALs and snapshots) get a new one.
+// Versions handed out afterwards are always higher than any restored one.
+func (s *Store) Restore(key string, entry *Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stamp(entry, entry.Version)
+	s.insert(key, entry)
+}
+
+// RestoreExpiry replays an expiration change, keeping its version.
+// expiresAt is in Unix nanoseconds, 0 removes the expiration.
+func (s *Store) RestoreExpiry(key string, expiresAt int64, version uint64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	entry, ok := s.data[key]
 	if !ok {
-		return "", false
+		return
+	}
+	s.expire(key, entry, expiresAt)
+	s.stamp(entry, version)
+}
+
+// LastVersion returns the highest version handed out so far
+func (s *Store) LastVersion() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.version
+}
+
+// SetLastVersion raises the version counter to at least v, e.g. after
+// loading a snapshot whose deleted keys had used higher versions
+func (s *Store) SetLastVersion(v uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v > s.version {
+		s.version = v
+	}
+}
+
+// put stores an entry and stamps it with a new version
+// Caller must hold the write lock
+func (s *Store) put(key string, entry *Entry) {
+	s.version++
+	entry.Version = s.version
+	s.insert(key, entry)
+}
+
+// insert stores an entry under key, adding the key to the index if new
+// Caller must hold the write lock
+func (s *Store) insert(key string, entry *Entry) {
+	old, ok := s.data[key]
+	if ok && old.IsExpired() {
+		// Overwriting an expired key expires it first
+		s.expired(key)
+		old, ok = nil, false
+	}
+	if !ok {
+		s.index.Insert(key)
+	}
+	s.account(key, entry, old)
+	s.expiries.set(key, entry.ExpiresAt)
+	s.data[key] = entry
+}
+
+// remove deletes a key from the map and the index
+// Caller must hold the write lock
+func (s *Store) remove(key string) {
+	if entry, ok := s.data[key]; ok {
+		s.unaccount(key, entry)
+		s.expiries.set(key, 0)
+		delete(s.data, key)
+		s.index.Delete(key)
+		s.removals++
+	}
+}
+
+// reset removes all keys
+// Caller must hold the write lock
+func (s *Store) reset() {
+	s.data = make(map[string]*Entry)
+	s.index = keyIndex{}
+	s.bytes = 0
+	s.expiries = expiryIndex{}
+	s.removals++
+}
+
+// touch bumps the version of an existing entry after an in-place change
+// Caller must hold the write lock
+func (s *Store) touch(entry *Entry) {
+	s.version++
+	entry.Version = s.version
+	s.resize(entry)
+}
+
+// stamp gives an entry the version recorded for it on disk, or a new
+// version if none was recorded
+// Caller must hold the write lock
+func (s *Store) stamp(entry *Entry, version uint64) {
+	if version == 0 {
+		s.touch(entry)
+		return
+	}
+	if version > s.version {
+		s.version = version
+	}
+	entry.Version = version
+	s.resize(entry)
+}
+
+// lookup returns a live entry, deleting it if it has expired
+// Caller must hold the write lock
+func (s *Store) lookup(key string) (*Entry, bool) {
+	entry, ok := s.data[key]
+	if !ok {
+		return nil, false
 	}
 
 	// Lazy expiration: delete if expired
 	if entry.IsExpired() {
-		delete(s.data, key)
+		s.expired(key)
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// restored returns the entry a replayed record of type typ applies to, nil
+// if the key doesn't exist. Unlike lookup it doesn't expire keys: a key
+// whose TTL passed before the restart still takes the records logged while
+// it was live, and is removed by the DELETE logged when it expired or, if
+// the server stopped first, lazily once recovery is done. ok is false if
+// the key holds another type, in which case the record is skipped.
+// Caller must hold the write lock
+func (s *Store) restored(key string, typ ValueType) (entry *Entry, ok bool) {
+	entry, found := s.data[key]
+	if !found {
+		return nil, true
+	}
+	if entry.Type != typ {
+		return nil, false
+	}
+	return entry, true
+}
+
+// Get retrieves a string value by key (with lazy expiration)
+// Returns the value and true if found and not expired, empty string and false
+// otherwise, including when the key holds another type
+func (s *Store) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.lookup(key)
+	if !ok || entry.Type != TypeString {
 		return "", false
 	}
 
-	return entry.Value, true
+	return entry.StringValue(), true
+}
+
+// GetWithVersion retrieves a string value together with its version
+// Returns false if the key doesn't exist, has expired or holds another type
+func (s *Store) GetWithVersion(key string) (string, uint64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.data[key]
+	if !ok || entry.IsExpired() || entry.Type != TypeString {
+		return "", 0, false
+	}
+
+	return entry.StringValue(), entry.Version, true
 }
 
 // GetEntry retrieves the full entry (including TTL info)
@@ -76,7 +276,7 @@ func (s *Store) Delete(key string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	_, existed := s.data[key]
-	delete(s.data, key)
+	s.remove(key)
 	return existed
 }
 
@@ -91,7 +291,8 @@ func (s *Store) Expire(key string, ttl time.Duration) bool {
 		return false
 	}
 
-	entry.SetExpiration(ttl)
+	s.expire(key, entry, expiresAtAfter(ttl))
+	s.touch(entry)
 	return true
 }
 
@@ -106,7 +307,8 @@ func (s *Store) Persist(key string) bool {
 		return false
 	}
 
-	entry.RemoveExpiration()
+	s.expire(key, entry, 0)
+	s.touch(entry)
 	return true
 }
 
@@ -124,11 +326,54 @@ func (s *Store) TTL(key string) time.Duration {
 	return entry.TTL()
 }
 
+// ExpiresAt returns the absolute expiration of a key in Unix nanoseconds,
+// 0 if it has none
+// Returns false if the key doesn't exist or has expired
+func (s *Store) ExpiresAt(key string) (int64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.data[key]
+	if !ok || entry.IsExpired() {
+		return 0, false
+	}
+
+	return entry.ExpiresAt, true
+}
+
+// Version returns the current version of a key
+// Returns 0 if the key doesn't exist or has expired
+func (s *Store) Version(key string) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.data[key]
+	if !ok || entry.IsExpired() {
+		return 0
+	}
+
+	return entry.Version
+}
+
+// Removals returns a counter bumped whenever keys are removed. A missing
+// key has no version, so WATCH uses it to notice a key that was created and
+// removed again.
+func (s *Store) Removals() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.removals
+}
+
 // Len returns the number of non-expired keys in the store
 func (s *Store) Len() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.count()
+}
 
+// count returns the number of non-expired keys
+// Caller must hold the lock
+func (s *Store) count() int {
 	count := 0
 	for _, entry := range s.data {
 		if !entry.IsExpired() {
@@ -142,20 +387,20 @@ func (s *Store) Len() int {
 func (s *Store) Clear() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.data = make(map[string]*Entry)
+	s.reset()
 }
 
-// Range iterates over all non-expired key-value pairs
+// Range iterates over all non-expired string key-value pairs
 // The function f should return true to continue iteration, false to stop
 func (s *Store) Range(f func(key, value string) bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	for key, entry := range s.data {
-		if entry.IsExpired() {
+		if entry.IsExpired() || entry.Type != TypeString {
 			continue
 		}
-		if !f(key, entry.Value) {
+		if !f(key, entry.StringValue()) {
 			break
 		}
 	}
@@ -165,7 +410,12 @@ func (s *Store) Range(f func(key, value string) bool) {
 func (s *Store) RangeWithTTL(f func(key string, entry *Entry) bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	s.rangeWithTTL(f)
+}
 
+// rangeWithTTL iterates over all non-expired entries
+// Caller must hold the read lock
+func (s *Store) rangeWithTTL(f func(key string, entry *Entry) bool) {
 	for key, entry := range s.data {
 		if entry.IsExpired() {
 			continue
@@ -179,17 +429,40 @@ func (s *Store) RangeWithTTL(f func(key string, entry *Entry) bool) {
 // DeleteExpired removes all expired keys
 // Returns the number of keys deleted
 func (s *Store) DeleteExpired() int {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	deleted, _ := s.ExpireDue(time.Time{})
+	return deleted
+}
 
-	deleted := 0
-	for key, entry := range s.data {
-		if entry.IsExpired() {
-			delete(s.data, key)
-			deleted++
+// RandomKey returns a random non-expired key, false if there is none
+func (s *Store) RandomKey() (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.randomKey()
+}
+
+// randomKey picks keys at random ranks of the index until one hasn't
+// expired, then falls back to the first live key in order
+// Caller must hold the lock
+func (s *Store) randomKey() (string, bool) {
+	n := s.index.Len()
+	for try := 0; try < randomKeyTries && n > 0; try++ {
+		var key string
+		s.index.Ascend(rand.Intn(n), func(k string) bool {
+			key = k
+			return false
+		})
+		if !s.data[key].IsExpired() {
+			return key, true
 		}
 	}
-	return deleted
+
+	var key string
+	var ok bool
+	s.index.Ascend(0, func(k string) bool {
+		key, ok = k, !s.data[k].IsExpired()
+		return !ok
+	})
+	return key, ok
 }
 
 // Keys returns all non-expired keys matching the pattern
@@ -197,19 +470,42 @@ func (s *Store) DeleteExpired() int {
 func (s *Store) Keys(pattern string) []string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.keys(pattern)
+}
 
+// keys returns all non-expired keys matching the pattern, in order. Only
+// the keys starting with the pattern's literal prefix are visited.
+// Caller must hold the lock
+func (s *Store) keys(pattern string) []string {
 	var keys []string
-	for key, entry := range s.data {
-		if entry.IsExpired() {
-			continue
+	prefix := literalPrefix(pattern)
+	s.index.AscendFrom(prefix, func(key string) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
 		}
-		if matchPattern(pattern, key) {
+		if !s.data[key].IsExpired() && matchPattern(pattern, key) {
 			keys = append(keys, key)
 		}
-	}
+		return true
+	})
 	return keys
 }
 
+// literalPrefix returns the part of a pattern before its first wildcard,
+// which every matching key starts with
+func literalPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, "*?"); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// MatchPattern reports whether str matches a glob pattern, as used by
+// Keys and Scan
+func MatchPattern(pattern, str string) bool {
+	return matchPattern(pattern, str)
+}
+
 // matchPattern performs glob-style pattern matching
 // Supports: * (matches any sequence), ? (matches single char)
 func matchPattern(pattern, str string) bool {
@@ -282,46 +578,94 @@ func globMatch(pattern, str string, pIdx, sIdx int) bool {
 	return false
 }
 
-// Scan returns keys matching pattern with pagination
-// cursor: start position (0 to start)
-// count: max keys to return (0 = default 10)
-// Returns: next cursor, keys, hasMore
-func (s *Store) Scan(cursor int, pattern string, count int) (int, []string, bool) {
+// ScanOptions filters and sizes the pages of Scan
+type ScanOptions struct {
+	Match string // Glob pattern keys must match, empty matches all
+	Count int    // Number of keys to visit per page, 0 means 10
+	Type  string // Name of the type keys must hold, empty for any
+}
+
+// Scan returns a page of the keys matching opts, in order, and the cursor
+// of the next page. The cursor is the key to resume at: "" starts a scan,
+// and a next cursor of "" means the scan is complete. Every key that exists
+// for the whole scan is returned exactly once, whatever is written between
+// pages; keys added or removed meanwhile may or may not be.
+func (s *Store) Scan(cursor string, opts ScanOptions) (string, []string) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.scan(cursor, opts)
+}
 
+// scan implements Scan. A page visits up to Count keys from the cursor on,
+// so it costs O(log n + Count) even when few keys match.
+// Caller must hold the lock
+func (s *Store) scan(cursor string, opts ScanOptions) (string, []string) {
+	count := opts.Count
 	if count <= 0 {
 		count = 10 // Default page size
 	}
-
-	// Collect all matching keys
-	var allKeys []string
-	for key, entry := range s.data {
-		if entry.IsExpired() {
-			continue
-		}
-		if matchPattern(pattern, key) {
-			allKeys = append(allKeys, key)
-		}
+	pattern := opts.Match
+	if pattern == "" {
+		pattern = "*"
 	}
 
-	// Paginate
-	start := cursor
-	if start >= len(allKeys) {
-		return 0, []string{}, false
+	prefix := literalPrefix(pattern)
+	if cursor < prefix {
+		cursor = prefix
 	}
 
-	end := start + count
-	hasMore := end < len(allKeys)
-	if end > len(allKeys) {
-		end = len(allKeys)
-	}
+	keys := []string{}
+	next := ""
+	visited := 0
+	s.index.AscendFrom(cursor, func(key string) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
+		}
+		if visited == count {
+			next = key
+			return false
+		}
+		visited++
+		entry := s.data[key]
+		if entry.IsExpired() || !matchPattern(pattern, key) {
+			return true
+		}
+		if opts.Type == "" || entry.Type.String() == opts.Type {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return next, keys
+}
 
-	keys := allKeys[start:end]
-	nextCursor := 0
-	if hasMore {
-		nextCursor = end
-	}
+// KeyRange returns the non-expired string keys between min and max with
+// their values, in lexicographical order. limit caps the number of pairs,
+// 0 means no limit.
+func (s *Store) KeyRange(min, max LexBound, limit int) []KeyValue {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keyRange(min, max, limit)
+}
 
-	return nextCursor, keys, hasMore
+// keyRange implements KeyRange
+// Caller must hold the lock
+func (s *Store) keyRange(min, max LexBound, limit int) []KeyValue {
+	pairs := []KeyValue{}
+	if min.Inf > 0 || max.Inf < 0 {
+		return pairs
+	}
+	s.index.AscendFrom(min.Value, func(key string) bool {
+		if !lexLteMax(key, max) || (limit > 0 && len(pairs) == limit) {
+			return false
+		}
+		if !lexGteMin(key, min) {
+			return true
+		}
+		entry := s.data[key]
+		if !entry.IsExpired() && entry.Type == TypeString {
+			pairs = append(pairs, KeyValue{Key: key, Value: entry.StringValue()})
+		}
+		return true
+	})
+	return pairs
 }
@@ -2,8 +2,11 @@
 package store
 
 import (
+	"fmt"
+	"math/rand"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestStore_SetGet(t *testing.T) {
@@ -127,6 +130,405 @@ func TestStore_Concurrent(t *testing.T) {
 	// If we reach here without deadlock or race condition, test passes
 }
 
+func TestStore_Version(t *testing.T) {
+	s := New()
+
+	if v := s.Version("key1"); v != 0 {
+		t.Errorf("expected version 0 for missing key, got %d", v)
+	}
+
+	s.Set("key1", "a")
+	v1 := s.Version("key1")
+	if v1 == 0 {
+		t.Fatal("expected non-zero version after Set")
+	}
+
+	s.Set("key1", "b")
+	v2 := s.Version("key1")
+	if v2 <= v1 {
+		t.Errorf("expected version to increase, got %d then %d", v1, v2)
+	}
+
+	s.Expire("key1", time.Hour)
+	if v3 := s.Version("key1"); v3 <= v2 {
+		t.Errorf("expected Expire to bump version, got %d then %d", v2, v3)
+	}
+
+	s.Delete("key1")
+	if v := s.Version("key1"); v != 0 {
+		t.Errorf("expected version 0 after delete, got %d", v)
+	}
+}
+
+func TestStore_Restore(t *testing.T) {
+	s := New()
+
+	s.Restore("a", &Entry{Value: "1", Version: 10})
+	if v := s.Version("a"); v != 10 {
+		t.Errorf("expected restored version 10, got %d", v)
+	}
+
+	// Entries without a version get a new one above the restored ones
+	s.Restore("b", &Entry{Value: "2"})
+	if v := s.Version("b"); v != 11 {
+		t.Errorf("expected version 11 for unversioned entry, got %d", v)
+	}
+
+	s.SetLastVersion(20)
+	s.SetLastVersion(5) // Never goes backwards
+	s.Set("c", "3")
+	if v := s.Version("c"); v != 21 {
+		t.Errorf("expected version 21 after SetLastVersion, got %d", v)
+	}
+	if v := s.LastVersion(); v != 21 {
+		t.Errorf("expected last version 21, got %d", v)
+	}
+}
+
+func TestStore_Update(t *testing.T) {
+	s := New()
+	s.Set("a", "1")
+
+	err := s.Update(func(tx *Txn) error {
+		val, ok := tx.Get("a")
+		if !ok || val != "1" {
+			t.Errorf("expected a=1 inside Update, got %q (exists: %v)", val, ok)
+		}
+		tx.Set("b", "2")
+		if !tx.Delete("a") {
+			t.Error("expected Delete to report existing key")
+		}
+		if tx.Len() != 1 {
+			t.Errorf("expected 1 key inside Update, got %d", tx.Len())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	if _, ok := s.Get("a"); ok {
+		t.Error("expected a to be deleted")
+	}
+	if val, _ := s.Get("b"); val != "2" {
+		t.Errorf("expected b=2, got %q", val)
+	}
+}
+
+func TestStore_View(t *testing.T) {
+	s := New()
+	_ = s.Update(func(tx *Txn) error {
+		_, err := tx.HSet("h", "f", "v")
+		return err
+	})
+	s.SetWithTTL("gone", "1", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	err := s.View(func(tx *Txn) error {
+		if val, ok, err := tx.HGet("h", "f"); !ok || err != nil || val != "v" {
+			t.Errorf("expected h.f=v inside View, got %q, %v, %v", val, ok, err)
+		}
+		if _, ok := tx.GetEntry("gone"); ok {
+			t.Error("expected an expired key to be skipped inside View")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View failed: %v", err)
+	}
+
+	// Only writers delete expired keys
+	if _, ok := s.data["gone"]; !ok {
+		t.Error("expected View to leave the expired key in place")
+	}
+}
+
+func TestTxn_ExpireAt(t *testing.T) {
+	s := New()
+	s.Set("a", "1")
+	v := s.Version("a")
+	at := time.Now().Add(time.Hour).UnixNano()
+
+	_ = s.Update(func(tx *Txn) error {
+		if !tx.ExpireAt("a", at) {
+			t.Error("Expected ExpireAt to find a")
+		}
+		if tx.ExpireAt("missing", at) {
+			t.Error("Expected ExpireAt to report a missing key")
+		}
+		return nil
+	})
+	if entry, _ := s.GetEntry("a"); entry.ExpiresAt != at {
+		t.Errorf("Expected expiration %d, got %d", at, entry.ExpiresAt)
+	}
+	if s.Version("a") <= v {
+		t.Error("Expected ExpireAt to bump the version")
+	}
+
+	// A time in the past expires the key
+	_ = s.Update(func(tx *Txn) error {
+		tx.ExpireAt("a", time.Now().Add(-time.Second).UnixNano())
+		return nil
+	})
+	if _, ok := s.Get("a"); ok {
+		t.Error("Expected a to be expired")
+	}
+}
+
+func TestStore_KeysInOrder(t *testing.T) {
+	s := New()
+	for _, k := range []string{"user:2", "order:1", "user:10", "user:1", "session:1"} {
+		s.Set(k, "v")
+	}
+	s.SetWithTTL("user:3", "v", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	s.RestoreHashField("user:4", "name", "bob", 0)
+
+	got := s.Keys("user:*")
+	want := []string{"user:1", "user:10", "user:2", "user:4"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Keys(user:*) = %v, want %v", got, want)
+	}
+	if got := s.Keys("user:1?"); fmt.Sprint(got) != "[user:10]" {
+		t.Errorf("Keys(user:1?) = %v", got)
+	}
+	if got := s.Keys("*:1"); fmt.Sprint(got) != "[order:1 session:1 user:1]" {
+		t.Errorf("Keys(*:1) = %v", got)
+	}
+	if got := s.Keys("nothing*"); len(got) != 0 {
+		t.Errorf("Expected no keys, got %v", got)
+	}
+}
+
+func TestStore_ScanPages(t *testing.T) {
+	s := New()
+	var want []string
+	for i := 0; i < 25; i++ {
+		k := fmt.Sprintf("item:%02d", i)
+		s.Set(k, "v")
+		want = append(want, k)
+		s.Set(fmt.Sprintf("other:%02d", i), "v")
+	}
+
+	var got []string
+	cursor, pages := "", 0
+	for {
+		next, keys := s.Scan(cursor, ScanOptions{Match: "item:*", Count: 10})
+		got = append(got, keys...)
+		pages++
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if pages != 3 {
+		t.Errorf("Expected 3 pages, got %d", pages)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Scan returned %v, want %v", got, want)
+	}
+}
+
+func TestStore_ScanHints(t *testing.T) {
+	s := New()
+	for i := 0; i < 10; i++ {
+		s.Set(fmt.Sprintf("k%d", i), "v")
+	}
+	s.RestoreHashField("k5h", "f", "v", 0)
+	s.RestoreHashField("x", "f", "v", 0)
+
+	// COUNT bounds the keys visited, not the keys returned
+	next, keys := s.Scan("", ScanOptions{Match: "k?", Count: 3})
+	if fmt.Sprint(keys) != "[k0 k1 k2]" || next != "k3" {
+		t.Errorf("Expected k0-k2 and cursor k3, got %v %q", keys, next)
+	}
+	next, keys = s.Scan("k5", ScanOptions{Match: "*h", Count: 3})
+	if fmt.Sprint(keys) != "[k5h]" || next != "k7" {
+		t.Errorf("Expected k5h and cursor k7, got %v %q", keys, next)
+	}
+
+	_, keys = s.Scan("", ScanOptions{Count: 100, Type: "hash"})
+	if fmt.Sprint(keys) != "[k5h x]" {
+		t.Errorf("Expected only hashes, got %v", keys)
+	}
+	_, keys = s.Scan("", ScanOptions{Count: 100, Type: "zset"})
+	if len(keys) != 0 {
+		t.Errorf("Expected no sorted sets, got %v", keys)
+	}
+}
+
+// TestStore_ScanGuarantee checks, over random keyspaces, page sizes and
+// writes between pages, that a scan returns every key that exists for its
+// whole duration, and never returns a key twice
+func TestStore_ScanGuarantee(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for trial := 0; trial < 200; trial++ {
+		s := New()
+		universe := 50 + rng.Intn(500)
+		stable := make(map[string]bool)
+		for i := 0; i < universe; i++ {
+			key := fmt.Sprintf("k%d:%d", rng.Intn(3), i)
+			switch rng.Intn(3) {
+			case 0:
+				s.Set(key, "v")
+				stable[key] = true
+			case 1:
+				s.Set(key, "v")
+			}
+		}
+		// Keys that come and go during the scan, never one of the stable
+		// keys
+		churn := func() string {
+			for {
+				key := fmt.Sprintf("k%d:%d", rng.Intn(3), rng.Intn(universe*2))
+				if !stable[key] {
+					return key
+				}
+			}
+		}
+
+		opts := ScanOptions{Count: 1 + rng.Intn(20)}
+		if rng.Intn(2) == 0 {
+			opts.Match = "k1:*"
+		}
+
+		seen := make(map[string]bool)
+		cursor := ""
+		for {
+			next, keys := s.Scan(cursor, opts)
+			for _, key := range keys {
+				if seen[key] {
+					t.Fatalf("trial %d: %q returned twice", trial, key)
+				}
+				seen[key] = true
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+
+			for i := rng.Intn(10); i > 0; i-- {
+				if rng.Intn(2) == 0 {
+					s.Set(churn(), "v")
+				} else {
+					s.Delete(churn())
+				}
+			}
+		}
+
+		for key := range stable {
+			if matchPattern(opts.Match+"*", key) && !seen[key] {
+				t.Fatalf("trial %d: %q was never returned (options %+v)", trial, key, opts)
+			}
+		}
+	}
+}
+
+func TestStore_KeyRange(t *testing.T) {
+	s := New()
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		s.Set(k, "v"+k)
+	}
+	s.RestoreHashField("bb", "f", "v", 0)
+
+	format := func(pairs []KeyValue) string {
+		var out []string
+		for _, p := range pairs {
+			out = append(out, p.Key+"="+p.Value)
+		}
+		return fmt.Sprint(out)
+	}
+
+	tests := []struct {
+		min, max LexBound
+		limit    int
+		want     string
+	}{
+		{LexBound{Value: "b"}, LexBound{Value: "d"}, 0, "[b=vb c=vc d=vd]"},
+		{LexBound{Value: "b", Exclusive: true}, LexBound{Value: "d", Exclusive: true}, 0, "[c=vc]"},
+		{LexBound{Inf: -1}, LexBound{Inf: 1}, 2, "[a=va b=vb]"},
+		{LexBound{Value: "c"}, LexBound{Inf: 1}, 0, "[c=vc d=vd e=ve]"},
+		{LexBound{Value: "d"}, LexBound{Value: "b"}, 0, "[]"},
+	}
+	for _, tt := range tests {
+		if got := format(s.KeyRange(tt.min, tt.max, tt.limit)); got != tt.want {
+			t.Errorf("KeyRange(%v, %v, %d) = %s, want %s", tt.min, tt.max, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestStore_Siblings(t *testing.T) {
+	s := New()
+	other := s.NewSibling()
+	s.Set("a", "1")
+	other.Set("b", "2")
+
+	// Versions come from one counter
+	if s.Version("a") == other.Version("b") {
+		t.Error("Expected distinct versions across siblings")
+	}
+
+	// One transaction can write to both, and swap them
+	err := s.Update(func(tx *Txn) error {
+		tx.On(other).Set("c", "3")
+		tx.Swap(other)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if got := fmt.Sprint(s.Keys("*")); got != "[b c]" {
+		t.Errorf("Expected [b c] after swap, got %s", got)
+	}
+	if got := fmt.Sprint(other.Keys("*")); got != "[a]" {
+		t.Errorf("Expected [a] after swap, got %s", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic for a store that isn't a sibling")
+		}
+	}()
+	_ = s.Update(func(tx *Txn) error {
+		tx.On(New())
+		return nil
+	})
+}
+
+func TestStore_RandomKey(t *testing.T) {
+	s := New()
+	if _, ok := s.RandomKey(); ok {
+		t.Error("Expected no key in an empty store")
+	}
+
+	seen := map[string]bool{}
+	for _, k := range []string{"a", "b", "c"} {
+		s.Set(k, "v")
+	}
+	for i := 0; i < 200; i++ {
+		key, ok := s.RandomKey()
+		if !ok {
+			t.Fatal("Expected a key")
+		}
+		seen[key] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("Expected every key to be picked, got %v", seen)
+	}
+
+	// Expired keys are skipped even when they are the vast majority
+	s.Clear()
+	for i := 0; i < 100; i++ {
+		s.SetWithTTL(fmt.Sprintf("expired%d", i), "v", time.Nanosecond)
+	}
+	s.Set("live", "v")
+	time.Sleep(time.Millisecond)
+	if key, ok := s.RandomKey(); !ok || key != "live" {
+		t.Errorf("Expected live, got %q", key)
+	}
+}
+
 func BenchmarkStore_Set(b *testing.B) {
 	s := New()
 	b.ResetTimer()
@@ -0,0 +1,461 @@
+// internal/store/stream.go
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// StreamID identifies a stream entry: a Unix time in milliseconds and a
+// sequence number for entries added within the same millisecond
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// MaxStreamID is the greatest possible stream ID
+var MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+// ParseStreamID parses "ms-seq". A missing sequence number is 0.
+func ParseStreamID(s string) (StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, fmt.Errorf("invalid stream ID: %q", s)
+	}
+	var seq uint64
+	if hasSeq {
+		seq, err = strconv.ParseUint(seqPart, 10, 64)
+		if err != nil {
+			return StreamID{}, fmt.Errorf("invalid stream ID: %q", s)
+		}
+	}
+	return StreamID{Ms: ms, Seq: seq}, nil
+}
+
+// String formats the ID as "ms-seq"
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Less reports whether id sorts before other
+func (id StreamID) Less(other StreamID) bool {
+	if id.Ms != other.Ms {
+		return id.Ms < other.Ms
+	}
+	return id.Seq < other.Seq
+}
+
+// Next returns the smallest ID greater than id. The maximum ID has no
+// successor and is returned unchanged.
+func (id StreamID) Next() StreamID {
+	switch {
+	case id == MaxStreamID:
+		return id
+	case id.Seq == math.MaxUint64:
+		return StreamID{Ms: id.Ms + 1}
+	}
+	return StreamID{Ms: id.Ms, Seq: id.Seq + 1}
+}
+
+// Prev returns the greatest ID smaller than id. 0-0 has no predecessor and
+// is returned unchanged.
+func (id StreamID) Prev() StreamID {
+	switch {
+	case id == StreamID{}:
+		return id
+	case id.Seq == 0:
+		return StreamID{Ms: id.Ms - 1, Seq: math.MaxUint64}
+	}
+	return StreamID{Ms: id.Ms, Seq: id.Seq - 1}
+}
+
+// StreamEntry is one entry of a stream: its ID and field-value pairs
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string // Alternating fields and values, in the order added
+}
+
+// PendingEntry is an entry delivered to a consumer of a group and not yet
+// acknowledged
+type PendingEntry struct {
+	Consumer    string
+	DeliveredAt int64 // Unix milliseconds of the last delivery
+	Deliveries  int   // Number of times the entry was delivered
+}
+
+// ConsumerGroup tracks what has been delivered to the consumers of a group
+type ConsumerGroup struct {
+	LastDelivered StreamID                  // Greatest ID delivered to the group
+	Pending       map[StreamID]PendingEntry // Pending entries list
+}
+
+// PendingIDs returns the IDs of the pending entries, sorted
+func (g *ConsumerGroup) PendingIDs() []StreamID {
+	ids := make([]StreamID, 0, len(g.Pending))
+	for id := range g.Pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Less(ids[j]) })
+	return ids
+}
+
+// Stream is an append-only log of entries ordered by ID, plus the consumer
+// groups reading it
+type Stream struct {
+	entries []StreamEntry
+	lastID  StreamID // Greatest ID ever added, kept when entries are trimmed
+	Groups  map[string]*ConsumerGroup
+}
+
+// NewStream creates an empty stream
+func NewStream() *Stream {
+	return &Stream{Groups: make(map[string]*ConsumerGroup)}
+}
+
+// Len returns the number of entries
+func (st *Stream) Len() int {
+	return len(st.entries)
+}
+
+// LastID returns the greatest ID ever added to the stream
+func (st *Stream) LastID() StreamID {
+	return st.lastID
+}
+
+// Append adds an entry at the end of the stream. id must be greater than
+// LastID.
+func (st *Stream) Append(id StreamID, fields []string) {
+	st.entries = append(st.entries, StreamEntry{ID: id, Fields: fields})
+	st.lastID = id
+}
+
+// At returns the entry at position i, from the oldest
+func (st *Stream) At(i int) StreamEntry {
+	return st.entries[i]
+}
+
+// search returns the index of the first entry whose ID is not less than id
+func (st *Stream) search(id StreamID) int {
+	return sort.Search(len(st.entries), func(i int) bool {
+		return !st.entries[i].ID.Less(id)
+	})
+}
+
+// Get returns the entry with the given ID
+func (st *Stream) Get(id StreamID) (StreamEntry, bool) {
+	i := st.search(id)
+	if i < len(st.entries) && st.entries[i].ID == id {
+		return st.entries[i], true
+	}
+	return StreamEntry{}, false
+}
+
+// Range returns up to count entries with IDs between start and end
+// inclusive, in ascending order or descending with rev. A count of 0 or
+// less returns them all.
+func (st *Stream) Range(start, end StreamID, rev bool, count int) []StreamEntry {
+	if end.Less(start) {
+		return nil
+	}
+	lo := st.search(start)
+	hi := sort.Search(len(st.entries), func(i int) bool {
+		return end.Less(st.entries[i].ID)
+	})
+	n := hi - lo
+	if count > 0 && count < n {
+		n = count
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	result := make([]StreamEntry, n)
+	for i := range result {
+		if rev {
+			result[i] = st.entries[hi-1-i]
+		} else {
+			result[i] = st.entries[lo+i]
+		}
+	}
+	return result
+}
+
+// TrimBefore removes the entries with IDs less than min and returns how
+// many were removed
+func (st *Stream) TrimBefore(min StreamID) int {
+	i := st.search(min)
+	if i == 0 {
+		return 0
+	}
+	// Copy so that the trimmed entries can be collected
+	st.entries = append([]StreamEntry(nil), st.entries[i:]...)
+	return i
+}
+
+// streamPayload is the JSON form of a stream in the WAL and snapshots
+type streamPayload struct {
+	LastID  string                  `json:"last_id"`
+	Entries []streamEntryPayload    `json:"entries"`
+	Groups  map[string]groupPayload `json:"groups,omitempty"`
+}
+
+type streamEntryPayload struct {
+	ID     string   `json:"id"`
+	Fields []string `json:"fields"`
+}
+
+type groupPayload struct {
+	LastDelivered string           `json:"last_delivered"`
+	Pending       []pendingPayload `json:"pending,omitempty"`
+}
+
+type pendingPayload struct {
+	ID          string `json:"id"`
+	Consumer    string `json:"consumer"`
+	DeliveredAt int64  `json:"delivered_at"`
+	Deliveries  int    `json:"deliveries"`
+}
+
+// payload returns the JSON form of the stream
+func (st *Stream) payload() streamPayload {
+	p := streamPayload{
+		LastID:  st.lastID.String(),
+		Entries: make([]streamEntryPayload, len(st.entries)),
+	}
+	for i, e := range st.entries {
+		p.Entries[i] = streamEntryPayload{ID: e.ID.String(), Fields: e.Fields}
+	}
+	if len(st.Groups) > 0 {
+		p.Groups = make(map[string]groupPayload, len(st.Groups))
+	}
+	for name, g := range st.Groups {
+		gp := groupPayload{LastDelivered: g.LastDelivered.String()}
+		for _, id := range g.PendingIDs() {
+			pe := g.Pending[id]
+			gp.Pending = append(gp.Pending, pendingPayload{
+				ID:          id.String(),
+				Consumer:    pe.Consumer,
+				DeliveredAt: pe.DeliveredAt,
+				Deliveries:  pe.Deliveries,
+			})
+		}
+		p.Groups[name] = gp
+	}
+	return p
+}
+
+// decodeStream decodes a stream written by Payload
+func decodeStream(payload string) (*Stream, error) {
+	var p streamPayload
+	if err := json.Unmarshal([]byte(payload), &p); err != nil {
+		return nil, err
+	}
+
+	st := NewStream()
+	for _, e := range p.Entries {
+		id, err := ParseStreamID(e.ID)
+		if err != nil {
+			return nil, err
+		}
+		st.Append(id, e.Fields)
+	}
+	lastID, err := ParseStreamID(p.LastID)
+	if err != nil {
+		return nil, err
+	}
+	st.lastID = lastID
+
+	for name, gp := range p.Groups {
+		g := &ConsumerGroup{Pending: make(map[StreamID]PendingEntry, len(gp.Pending))}
+		if g.LastDelivered, err = ParseStreamID(gp.LastDelivered); err != nil {
+			return nil, err
+		}
+		for _, pp := range gp.Pending {
+			id, err := ParseStreamID(pp.ID)
+			if err != nil {
+				return nil, err
+			}
+			g.Pending[id] = PendingEntry{Consumer: pp.Consumer, DeliveredAt: pp.DeliveredAt, Deliveries: pp.Deliveries}
+		}
+		st.Groups[name] = g
+	}
+	return st, nil
+}
+
+// SetGroup sets the last delivered ID of a consumer group, creating the
+// group if needed
+func (st *Stream) SetGroup(name string, lastDelivered StreamID) {
+	g, ok := st.Groups[name]
+	if !ok {
+		g = &ConsumerGroup{Pending: make(map[StreamID]PendingEntry)}
+		st.Groups[name] = g
+	}
+	g.LastDelivered = lastDelivered
+}
+
+// Claim records that entry id was delivered to a consumer of a group,
+// advancing the group's last delivered ID if needed. It does nothing if the
+// group doesn't exist.
+func (st *Stream) Claim(group string, id StreamID, pe PendingEntry) {
+	g, ok := st.Groups[group]
+	if !ok {
+		return
+	}
+	g.Pending[id] = pe
+	if g.LastDelivered.Less(id) {
+		g.LastDelivered = id
+	}
+}
+
+// Ack removes id from the pending entries of a group
+// Returns true if it was pending
+func (st *Stream) Ack(group string, id StreamID) bool {
+	g, ok := st.Groups[group]
+	if !ok {
+		return false
+	}
+	if _, ok := g.Pending[id]; !ok {
+		return false
+	}
+	delete(g.Pending, id)
+	return true
+}
+
+// stream returns the stream stored at key, or nil if the key doesn't exist
+func (tx *Txn) stream(key string) (*Entry, error) {
+	entry, ok := tx.lookup(key)
+	if !ok {
+		return nil, nil
+	}
+	if entry.Type != TypeStream {
+		return nil, ErrWrongType
+	}
+	return entry, nil
+}
+
+// RestoreStream replays a stream operation, keeping its version. The
+// stream is created if missing. Unlike other types, an empty stream is
+// kept.
+func (s *Store) RestoreStream(key string, version uint64, fn func(st *Stream)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.restored(key, TypeStream)
+	if !ok {
+		return
+	}
+	if entry == nil {
+		entry = NewStreamEntry()
+		s.insert(key, entry)
+	}
+	fn(entry.Stream)
+	s.stamp(entry, version)
+}
+
+// streamForWrite returns the stream stored at key, creating it if needed
+// Caller must hold the write lock
+func (tx *Txn) streamForWrite(key string) (*Entry, error) {
+	entry, err := tx.stream(key)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		entry = NewStreamEntry()
+		tx.s.put(key, entry)
+		return entry, nil
+	}
+	tx.s.touch(entry)
+	return entry, nil
+}
+
+// XAdd appends an entry to the stream stored at key, creating the stream
+// if needed. id must be greater than the stream's last ID.
+func (tx *Txn) XAdd(key string, id StreamID, fields []string) error {
+	entry, err := tx.streamForWrite(key)
+	if err != nil {
+		return err
+	}
+	entry.Stream.Append(id, fields)
+	return nil
+}
+
+// XTrim removes the entries of the stream stored at key with IDs less than
+// min and returns how many were removed
+func (tx *Txn) XTrim(key string, min StreamID) (int, error) {
+	entry, err := tx.stream(key)
+	if entry == nil || err != nil {
+		return 0, err
+	}
+	n := entry.Stream.TrimBefore(min)
+	if n > 0 {
+		tx.s.touch(entry)
+	}
+	return n, nil
+}
+
+// XSetGroup sets the last delivered ID of a consumer group of the stream
+// stored at key, creating the stream and the group as needed
+func (tx *Txn) XSetGroup(key, group string, lastDelivered StreamID) error {
+	entry, err := tx.streamForWrite(key)
+	if err != nil {
+		return err
+	}
+	entry.Stream.SetGroup(group, lastDelivered)
+	return nil
+}
+
+// XDestroyGroup removes a consumer group from the stream stored at key
+// Returns true if the group existed
+func (tx *Txn) XDestroyGroup(key, group string) (bool, error) {
+	entry, err := tx.stream(key)
+	if entry == nil || err != nil {
+		return false, err
+	}
+	if _, ok := entry.Stream.Groups[group]; !ok {
+		return false, nil
+	}
+	delete(entry.Stream.Groups, group)
+	tx.s.touch(entry)
+	return true, nil
+}
+
+// XClaim records the delivery of entry id to a consumer of a group of the
+// stream stored at key
+func (tx *Txn) XClaim(key, group string, id StreamID, pe PendingEntry) error {
+	entry, err := tx.stream(key)
+	if entry == nil || err != nil {
+		return err
+	}
+	entry.Stream.Claim(group, id, pe)
+	tx.s.touch(entry)
+	return nil
+}
+
+// XAck acknowledges entry id for a group of the stream stored at key
+// Returns true if the entry was pending
+func (tx *Txn) XAck(key, group string, id StreamID) (bool, error) {
+	entry, err := tx.stream(key)
+	if entry == nil || err != nil {
+		return false, err
+	}
+	if !entry.Stream.Ack(group, id) {
+		return false, nil
+	}
+	tx.s.touch(entry)
+	return true, nil
+}
+
+// Stream returns the stream stored at key, or nil if the key doesn't
+// exist. It must only be read, and only until the transaction ends.
+func (tx *Txn) Stream(key string) (*Stream, error) {
+	entry, err := tx.stream(key)
+	if entry == nil || err != nil {
+		return nil, err
+	}
+	return entry.Stream, nil
+}
@@ -0,0 +1,150 @@
+// internal/store/stream_test.go
+package store
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStreamID(t *testing.T) {
+	id, err := ParseStreamID("1700000000000-3")
+	if err != nil || id != (StreamID{Ms: 1700000000000, Seq: 3}) {
+		t.Fatalf("ParseStreamID: %v, %v", id, err)
+	}
+	if id.String() != "1700000000000-3" {
+		t.Errorf("Expected round trip, got %s", id)
+	}
+	if id, _ := ParseStreamID("5"); id != (StreamID{Ms: 5}) {
+		t.Errorf("Expected missing sequence to be 0, got %v", id)
+	}
+	for _, bad := range []string{"", "x", "1-", "-1", "1-2-3"} {
+		if _, err := ParseStreamID(bad); err == nil {
+			t.Errorf("ParseStreamID(%q) should fail", bad)
+		}
+	}
+
+	if next := (StreamID{Ms: 1, Seq: MaxStreamID.Seq}).Next(); next != (StreamID{Ms: 2}) {
+		t.Errorf("Next should carry into ms, got %v", next)
+	}
+	if prev := (StreamID{Ms: 2}).Prev(); prev != (StreamID{Ms: 1, Seq: MaxStreamID.Seq}) {
+		t.Errorf("Prev should borrow from ms, got %v", prev)
+	}
+	if MaxStreamID.Next() != MaxStreamID || (StreamID{}).Prev() != (StreamID{}) {
+		t.Error("Next and Prev should saturate")
+	}
+}
+
+func TestStream_RangeAndTrim(t *testing.T) {
+	st := NewStream()
+	for i := uint64(1); i <= 5; i++ {
+		st.Append(StreamID{Ms: i}, []string{"n", string(rune('0' + i))})
+	}
+
+	ids := func(entries []StreamEntry) []uint64 {
+		var ms []uint64
+		for _, e := range entries {
+			ms = append(ms, e.ID.Ms)
+		}
+		return ms
+	}
+
+	if got := ids(st.Range(StreamID{Ms: 2}, StreamID{Ms: 4}, false, 0)); !reflect.DeepEqual(got, []uint64{2, 3, 4}) {
+		t.Errorf("Range: %v", got)
+	}
+	if got := ids(st.Range(StreamID{}, MaxStreamID, true, 2)); !reflect.DeepEqual(got, []uint64{5, 4}) {
+		t.Errorf("Reverse range: %v", got)
+	}
+	if got := st.Range(StreamID{Ms: 4}, StreamID{Ms: 2}, false, 0); got != nil {
+		t.Errorf("Inverted range should be empty, got %v", got)
+	}
+	if e, ok := st.Get(StreamID{Ms: 3}); !ok || e.Fields[1] != "3" {
+		t.Errorf("Get: %v, %v", e, ok)
+	}
+
+	if n := st.TrimBefore(StreamID{Ms: 3}); n != 2 || st.Len() != 3 {
+		t.Errorf("TrimBefore: removed %d, %d left", n, st.Len())
+	}
+	if st.LastID() != (StreamID{Ms: 5}) {
+		t.Errorf("LastID should survive trimming, got %v", st.LastID())
+	}
+	if st.At(0).ID != (StreamID{Ms: 3}) {
+		t.Errorf("Expected 3-0 first, got %v", st.At(0).ID)
+	}
+}
+
+func TestStream_Groups(t *testing.T) {
+	st := NewStream()
+	st.Append(StreamID{Ms: 1}, []string{"a", "1"})
+	st.Append(StreamID{Ms: 2}, []string{"b", "2"})
+
+	st.SetGroup("g", StreamID{})
+	st.Claim("g", StreamID{Ms: 2}, PendingEntry{Consumer: "bob", DeliveredAt: 10, Deliveries: 1})
+	st.Claim("g", StreamID{Ms: 1}, PendingEntry{Consumer: "alice", DeliveredAt: 10, Deliveries: 1})
+	st.Claim("missing", StreamID{Ms: 1}, PendingEntry{Consumer: "alice"})
+
+	g := st.Groups["g"]
+	if g.LastDelivered != (StreamID{Ms: 2}) {
+		t.Errorf("Claim should advance the last delivered ID, got %v", g.LastDelivered)
+	}
+	if got := g.PendingIDs(); !reflect.DeepEqual(got, []StreamID{{Ms: 1}, {Ms: 2}}) {
+		t.Errorf("PendingIDs: %v", got)
+	}
+	if !st.Ack("g", StreamID{Ms: 1}) || st.Ack("g", StreamID{Ms: 1}) {
+		t.Error("Ack should succeed once")
+	}
+	if len(st.Groups) != 1 {
+		t.Error("Claim on a missing group should not create it")
+	}
+}
+
+func TestTxn_Stream(t *testing.T) {
+	s := New()
+	s.Set("str", "value")
+
+	_ = s.Update(func(tx *Txn) error {
+		if err := tx.XAdd("s", StreamID{Ms: 1}, []string{"f", "v"}); err != nil {
+			t.Errorf("XAdd: %v", err)
+		}
+		if err := tx.XAdd("str", StreamID{Ms: 1}, nil); !errors.Is(err, ErrWrongType) {
+			t.Errorf("Expected ErrWrongType, got %v", err)
+		}
+		if err := tx.XSetGroup("fresh", "g", StreamID{}); err != nil {
+			t.Errorf("XSetGroup: %v", err)
+		}
+		return nil
+	})
+
+	version := s.Version("s")
+	_ = s.Update(func(tx *Txn) error {
+		if n, _ := tx.XTrim("s", StreamID{Ms: 2}); n != 1 {
+			t.Errorf("Expected 1 trimmed, got %d", n)
+		}
+		return nil
+	})
+	if s.Version("s") == version {
+		t.Error("Expected XTrim to bump the version")
+	}
+	if s.Version("s") == 0 || s.Version("fresh") == 0 {
+		t.Error("Empty streams should be kept")
+	}
+}
+
+func TestEntry_StreamPayload(t *testing.T) {
+	entry := NewStreamEntry()
+	st := entry.Stream
+	st.Append(StreamID{Ms: 1}, []string{"a", "1"})
+	st.Append(StreamID{Ms: 2, Seq: 7}, []string{"b", "two words"})
+	st.TrimBefore(StreamID{Ms: 2})
+	st.SetGroup("g", StreamID{Ms: 1})
+	st.Claim("g", StreamID{Ms: 2, Seq: 7}, PendingEntry{Consumer: "alice", DeliveredAt: 42, Deliveries: 3})
+	st.SetGroup("idle", StreamID{})
+
+	decoded, err := NewEntryFromPayload(TypeStream, entry.Payload())
+	if err != nil {
+		t.Fatalf("NewEntryFromPayload failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Stream, st) {
+		t.Errorf("Expected %+v, got %+v", st, decoded.Stream)
+	}
+}
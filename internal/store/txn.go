@@ -0,0 +1,204 @@
+// internal/store/txn.go
+package store
+
+import (
+	"time"
+)
+
+// Txn provides access to the store while Update holds the write lock, or
+// View the read lock. A Txn must not be used after the function passed to
+// Update or View returns.
+type Txn struct {
+	s    *Store
+	view bool // Only the read lock is held, see View
+}
+
+// Update runs fn with the store's write lock held, so that every read and
+// write made through the Txn is atomic with respect to other store users.
+// The error returned by fn is passed through.
+func (s *Store) Update(fn func(tx *Txn) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(&Txn{s: s})
+}
+
+// View runs fn with the store's read lock held, so that other readers run
+// alongside it. The Txn must only be used to read: expired keys are
+// skipped instead of being removed.
+func (s *Store) View(fn func(tx *Txn) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return fn(&Txn{s: s, view: true})
+}
+
+// On returns a Txn on a sibling of the store, covered by the same lock
+func (tx *Txn) On(s *Store) *Txn {
+	if s.shared != tx.s.shared {
+		panic("store: Txn.On with a store that isn't a sibling")
+	}
+	return &Txn{s: s, view: tx.view}
+}
+
+// lookup returns a live entry. Under Update an expired one is removed,
+// see Store.lookup.
+func (tx *Txn) lookup(key string) (*Entry, bool) {
+	if !tx.view {
+		return tx.s.lookup(key)
+	}
+	entry, ok := tx.s.data[key]
+	if !ok || entry.IsExpired() {
+		return nil, false
+	}
+	return entry, true
+}
+
+// Swap exchanges the contents of the store and a sibling
+func (tx *Txn) Swap(other *Store) {
+	if other.shared != tx.s.shared {
+		panic("store: Txn.Swap with a store that isn't a sibling")
+	}
+	tx.s.data, other.data = other.data, tx.s.data
+	tx.s.index, other.index = other.index, tx.s.index
+	tx.s.bytes, other.bytes = other.bytes, tx.s.bytes
+	tx.s.expiries, other.expiries = other.expiries, tx.s.expiries
+}
+
+// Get retrieves a string value by key (with lazy expiration)
+// Returns false if the key doesn't exist or holds another type
+func (tx *Txn) Get(key string) (string, bool) {
+	entry, ok := tx.lookup(key)
+	if !ok || entry.Type != TypeString {
+		return "", false
+	}
+	return entry.StringValue(), true
+}
+
+// GetEntry retrieves the full entry (including TTL info)
+// The entry must not be modified in place; use Put to replace it
+func (tx *Txn) GetEntry(key string) (*Entry, bool) {
+	return tx.lookup(key)
+}
+
+// Set stores a key-value pair without TTL
+func (tx *Txn) Set(key, value string) {
+	tx.s.put(key, NewEntry(value))
+}
+
+// SetWithTTL stores a key-value pair with TTL
+func (tx *Txn) SetWithTTL(key, value string, ttl time.Duration) {
+	tx.s.put(key, NewEntryWithTTL(value, ttl))
+}
+
+// Put stores a prepared entry, assigning it a new version
+func (tx *Txn) Put(key string, entry *Entry) {
+	tx.s.put(key, entry)
+}
+
+// Delete removes a key-value pair
+// Returns true if the key existed and had not expired
+func (tx *Txn) Delete(key string) bool {
+	_, existed := tx.lookup(key)
+	tx.s.remove(key)
+	return existed
+}
+
+// Expire sets a TTL on an existing key
+// Returns true if key exists, false otherwise
+func (tx *Txn) Expire(key string, ttl time.Duration) bool {
+	entry, ok := tx.lookup(key)
+	if !ok {
+		return false
+	}
+	tx.s.expire(key, entry, expiresAtAfter(ttl))
+	tx.s.touch(entry)
+	return true
+}
+
+// ExpireAt sets the absolute expiration of an existing key, in Unix
+// nanoseconds, 0 removes it
+// Returns true if key exists, false otherwise
+func (tx *Txn) ExpireAt(key string, expiresAt int64) bool {
+	entry, ok := tx.lookup(key)
+	if !ok {
+		return false
+	}
+	tx.s.expire(key, entry, expiresAt)
+	tx.s.touch(entry)
+	return true
+}
+
+// Persist removes TTL from a key
+// Returns true if key exists, false otherwise
+func (tx *Txn) Persist(key string) bool {
+	entry, ok := tx.lookup(key)
+	if !ok {
+		return false
+	}
+	tx.s.expire(key, entry, 0)
+	tx.s.touch(entry)
+	return true
+}
+
+// TTL returns the remaining time to live for a key
+// Returns 0 if no TTL or key doesn't exist
+func (tx *Txn) TTL(key string) time.Duration {
+	entry, ok := tx.lookup(key)
+	if !ok {
+		return 0
+	}
+	return entry.TTL()
+}
+
+// Version returns the current version of a key, 0 if it doesn't exist
+func (tx *Txn) Version(key string) uint64 {
+	entry, ok := tx.lookup(key)
+	if !ok {
+		return 0
+	}
+	return entry.Version
+}
+
+// Removals returns a counter bumped whenever keys are removed
+func (tx *Txn) Removals() uint64 {
+	return tx.s.removals
+}
+
+// LastVersion returns the highest version handed out so far
+func (tx *Txn) LastVersion() uint64 {
+	return tx.s.version
+}
+
+// Clear removes all keys from the store
+func (tx *Txn) Clear() {
+	tx.s.reset()
+}
+
+// Len returns the number of non-expired keys in the store
+func (tx *Txn) Len() int {
+	return tx.s.count()
+}
+
+// RandomKey returns a random non-expired key, false if there is none
+func (tx *Txn) RandomKey() (string, bool) {
+	return tx.s.randomKey()
+}
+
+// Keys returns all non-expired keys matching the pattern
+func (tx *Txn) Keys(pattern string) []string {
+	return tx.s.keys(pattern)
+}
+
+// Scan returns a page of the keys matching opts and the next cursor
+func (tx *Txn) Scan(cursor string, opts ScanOptions) (string, []string) {
+	return tx.s.scan(cursor, opts)
+}
+
+// RangeWithTTL iterates over all non-expired entries with TTL info
+func (tx *Txn) RangeWithTTL(f func(key string, entry *Entry) bool) {
+	tx.s.rangeWithTTL(f)
+}
+
+// KeyRange returns the string keys between min and max with their values
+func (tx *Txn) KeyRange(min, max LexBound, limit int) []KeyValue {
+	return tx.s.keyRange(min, max, limit)
+}
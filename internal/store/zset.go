@@ -0,0 +1,529 @@
+// internal/store/zset.go
+package store
+
+import (
+	"math/rand"
+)
+
+const (
+	zsetMaxLevel = 32   // Enough for 2^64 elements with p = 1/4
+	zsetP        = 0.25 // Probability of promoting a node one level up
+)
+
+// ZMember is a member of a sorted set together with its score
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// ScoreBound is one end of a score range. Use math.Inf for open ends.
+type ScoreBound struct {
+	Value     float64
+	Exclusive bool
+}
+
+// LexBound is one end of a lexicographical range. Inf is -1 for the
+// smallest possible member, 1 for the largest, and 0 for Value.
+type LexBound struct {
+	Value     string
+	Exclusive bool
+	Inf       int
+}
+
+// zskipNode is a skiplist node. Each level's span counts the nodes it
+// skips over, which makes rank lookups O(log n).
+type zskipNode struct {
+	member   string
+	score    float64
+	backward *zskipNode
+	level    []zskipLevel
+}
+
+type zskipLevel struct {
+	forward *zskipNode
+	span    int
+}
+
+// ZSet is a sorted set: members ordered by score, then by member, held in
+// a skiplist for ordered access and a map for O(1) score lookups
+type ZSet struct {
+	header *zskipNode
+	tail   *zskipNode
+	level  int
+	length int
+	dict   map[string]float64
+}
+
+// NewZSet creates an empty sorted set
+func NewZSet() *ZSet {
+	return &ZSet{
+		header: &zskipNode{level: make([]zskipLevel, zsetMaxLevel)},
+		level:  1,
+		dict:   make(map[string]float64),
+	}
+}
+
+// Len returns the number of members
+func (z *ZSet) Len() int {
+	return z.length
+}
+
+// Score returns the score of member
+func (z *ZSet) Score(member string) (float64, bool) {
+	score, ok := z.dict[member]
+	return score, ok
+}
+
+// Add sets the score of member, adding it if needed
+// Returns true if the member is new
+func (z *ZSet) Add(member string, score float64) bool {
+	old, exists := z.dict[member]
+	if exists {
+		if old == score {
+			return false
+		}
+		z.delete(old, member)
+	}
+	z.insert(score, member)
+	z.dict[member] = score
+	return !exists
+}
+
+// Remove deletes member
+// Returns true if it existed
+func (z *ZSet) Remove(member string) bool {
+	score, ok := z.dict[member]
+	if !ok {
+		return false
+	}
+	z.delete(score, member)
+	delete(z.dict, member)
+	return true
+}
+
+// Rank returns the 0-based position of member in ascending order
+func (z *ZSet) Rank(member string) (int, bool) {
+	score, ok := z.dict[member]
+	if !ok {
+		return 0, false
+	}
+
+	x := z.header
+	rank := 0
+	for i := z.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !zless(score, member, x.level[i].forward) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x != z.header && x.member == member {
+			return rank - 1, true
+		}
+	}
+	return 0, false
+}
+
+// RangeByRank returns the members from start to stop inclusive, where
+// negative indexes count from the end. With rev, positions count from the
+// highest score down.
+func (z *ZSet) RangeByRank(start, stop int, rev bool) []ZMember {
+	if start < 0 {
+		start += z.length
+	}
+	if stop < 0 {
+		stop += z.length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= z.length {
+		stop = z.length - 1
+	}
+	if start > stop {
+		return []ZMember{}
+	}
+
+	var x *zskipNode
+	if rev {
+		x = z.byRank(z.length - start)
+	} else {
+		x = z.byRank(start + 1)
+	}
+
+	result := make([]ZMember, 0, stop-start+1)
+	for i := start; i <= stop && x != nil; i++ {
+		result = append(result, ZMember{Member: x.member, Score: x.score})
+		x = z.next(x, rev)
+	}
+	return result
+}
+
+// RangeByScore returns the members with scores between min and max, in
+// ascending order, or descending with rev. The first offset matches are
+// skipped and at most count are returned; a negative count means no limit.
+func (z *ZSet) RangeByScore(min, max ScoreBound, rev bool, offset, count int) []ZMember {
+	var x *zskipNode
+	if rev {
+		x = z.lastInScoreRange(min, max)
+	} else {
+		x = z.firstInScoreRange(min, max)
+	}
+	return z.collect(x, rev, offset, count, func(n *zskipNode) bool {
+		return scoreGteMin(n.score, min) && scoreLteMax(n.score, max)
+	})
+}
+
+// RangeByLex returns the members between min and max in member order,
+// which is only meaningful when all members have the same score. Offset
+// and count work as for RangeByScore.
+func (z *ZSet) RangeByLex(min, max LexBound, rev bool, offset, count int) []ZMember {
+	var x *zskipNode
+	if rev {
+		x = z.lastInLexRange(min, max)
+	} else {
+		x = z.firstInLexRange(min, max)
+	}
+	return z.collect(x, rev, offset, count, func(n *zskipNode) bool {
+		return lexGteMin(n.member, min) && lexLteMax(n.member, max)
+	})
+}
+
+// CountByScore returns the number of members with scores between min and max
+func (z *ZSet) CountByScore(min, max ScoreBound) int {
+	first := z.firstInScoreRange(min, max)
+	if first == nil {
+		return 0
+	}
+	last := z.lastInScoreRange(min, max)
+	firstRank, _ := z.Rank(first.member)
+	lastRank, _ := z.Rank(last.member)
+	return lastRank - firstRank + 1
+}
+
+// Members returns all members in ascending order
+func (z *ZSet) Members() []ZMember {
+	return z.RangeByRank(0, -1, false)
+}
+
+// collect walks from x while in range, applying offset and count
+func (z *ZSet) collect(x *zskipNode, rev bool, offset, count int, inRange func(*zskipNode) bool) []ZMember {
+	result := []ZMember{}
+	for ; x != nil && offset > 0 && inRange(x); offset-- {
+		x = z.next(x, rev)
+	}
+	for x != nil && count != 0 && inRange(x) {
+		result = append(result, ZMember{Member: x.member, Score: x.score})
+		x = z.next(x, rev)
+		count--
+	}
+	return result
+}
+
+// next returns the node after x in ascending order, or before it with rev
+func (z *ZSet) next(x *zskipNode, rev bool) *zskipNode {
+	if rev {
+		return x.backward
+	}
+	return x.level[0].forward
+}
+
+// zless reports whether (score, member) sorts before node n
+func zless(score float64, member string, n *zskipNode) bool {
+	return score < n.score || (score == n.score && member < n.member)
+}
+
+// nodeBefore reports whether node n sorts before (score, member)
+func nodeBefore(n *zskipNode, score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+// randomLevel picks the level of a new node
+func randomLevel() int {
+	level := 1
+	for level < zsetMaxLevel && rand.Float64() < zsetP {
+		level++
+	}
+	return level
+}
+
+// insert adds a node; the member must not be in the skiplist
+func (z *ZSet) insert(score float64, member string) {
+	var update [zsetMaxLevel]*zskipNode
+	var rank [zsetMaxLevel]int
+
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		if i < z.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && nodeBefore(x.level[i].forward, score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	if level > z.level {
+		for i := z.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = z.header
+			update[i].level[i].span = z.length
+		}
+		z.level = level
+	}
+
+	x = &zskipNode{member: member, score: score, level: make([]zskipLevel, level)}
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < z.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != z.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		z.tail = x
+	}
+	z.length++
+}
+
+// delete removes the node holding (score, member)
+func (z *ZSet) delete(score float64, member string) {
+	var update [zsetMaxLevel]*zskipNode
+
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && nodeBefore(x.level[i].forward, score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return
+	}
+
+	for i := 0; i < z.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		z.tail = x.backward
+	}
+	for z.level > 1 && z.header.level[z.level-1].forward == nil {
+		z.level--
+	}
+	z.length--
+}
+
+// byRank returns the node at a 1-based rank
+func (z *ZSet) byRank(rank int) *zskipNode {
+	x := z.header
+	traversed := 0
+	for i := z.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+// scoreGteMin reports whether score is above the lower bound
+func scoreGteMin(score float64, min ScoreBound) bool {
+	if min.Exclusive {
+		return score > min.Value
+	}
+	return score >= min.Value
+}
+
+// scoreLteMax reports whether score is below the upper bound
+func scoreLteMax(score float64, max ScoreBound) bool {
+	if max.Exclusive {
+		return score < max.Value
+	}
+	return score <= max.Value
+}
+
+// firstInScoreRange returns the lowest node in the score range
+func (z *ZSet) firstInScoreRange(min, max ScoreBound) *zskipNode {
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !scoreGteMin(x.level[i].forward.score, min) {
+			x = x.level[i].forward
+		}
+	}
+	x = x.level[0].forward
+	if x == nil || !scoreLteMax(x.score, max) {
+		return nil
+	}
+	return x
+}
+
+// lastInScoreRange returns the highest node in the score range
+func (z *ZSet) lastInScoreRange(min, max ScoreBound) *zskipNode {
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && scoreLteMax(x.level[i].forward.score, max) {
+			x = x.level[i].forward
+		}
+	}
+	if x == z.header || !scoreGteMin(x.score, min) {
+		return nil
+	}
+	return x
+}
+
+// lexGteMin reports whether member is above the lower bound
+func lexGteMin(member string, min LexBound) bool {
+	switch {
+	case min.Inf < 0:
+		return true
+	case min.Inf > 0:
+		return false
+	case min.Exclusive:
+		return member > min.Value
+	}
+	return member >= min.Value
+}
+
+// lexLteMax reports whether member is below the upper bound
+func lexLteMax(member string, max LexBound) bool {
+	switch {
+	case max.Inf > 0:
+		return true
+	case max.Inf < 0:
+		return false
+	case max.Exclusive:
+		return member < max.Value
+	}
+	return member <= max.Value
+}
+
+// firstInLexRange returns the first node in the lexicographical range
+func (z *ZSet) firstInLexRange(min, max LexBound) *zskipNode {
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !lexGteMin(x.level[i].forward.member, min) {
+			x = x.level[i].forward
+		}
+	}
+	x = x.level[0].forward
+	if x == nil || !lexLteMax(x.member, max) {
+		return nil
+	}
+	return x
+}
+
+// lastInLexRange returns the last node in the lexicographical range
+func (z *ZSet) lastInLexRange(min, max LexBound) *zskipNode {
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && lexLteMax(x.level[i].forward.member, max) {
+			x = x.level[i].forward
+		}
+	}
+	if x == z.header || !lexGteMin(x.member, min) {
+		return nil
+	}
+	return x
+}
+
+// zset returns the sorted set stored at key, or nil if the key doesn't exist
+func (tx *Txn) zset(key string) (*Entry, error) {
+	entry, ok := tx.lookup(key)
+	if !ok {
+		return nil, nil
+	}
+	if entry.Type != TypeZSet {
+		return nil, ErrWrongType
+	}
+	return entry, nil
+}
+
+// RestoreZSet replays a sorted set operation, keeping its version. The set
+// is created if missing and removed if fn leaves it empty.
+func (s *Store) RestoreZSet(key string, version uint64, fn func(z *ZSet)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.restored(key, TypeZSet)
+	if !ok {
+		return
+	}
+	if entry == nil {
+		entry = NewZSetEntry()
+		s.insert(key, entry)
+	}
+	fn(entry.ZSet)
+	s.stamp(entry, version)
+	if entry.ZSet.Len() == 0 {
+		s.remove(key)
+	}
+}
+
+// ZAdd sets the score of a member of the sorted set stored at key,
+// creating the set if needed
+// Returns true if the member is new
+func (tx *Txn) ZAdd(key, member string, score float64) (bool, error) {
+	entry, err := tx.zset(key)
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		entry = NewZSetEntry()
+		entry.ZSet.Add(member, score)
+		tx.s.put(key, entry)
+		return true, nil
+	}
+
+	added := entry.ZSet.Add(member, score)
+	tx.s.touch(entry)
+	return added, nil
+}
+
+// ZRem removes a member from the sorted set stored at key. The key is
+// removed together with its last member.
+// Returns true if the member existed
+func (tx *Txn) ZRem(key, member string) (bool, error) {
+	entry, err := tx.zset(key)
+	if entry == nil || err != nil {
+		return false, err
+	}
+	if !entry.ZSet.Remove(member) {
+		return false, nil
+	}
+	if entry.ZSet.Len() == 0 {
+		tx.s.remove(key)
+		return true, nil
+	}
+	tx.s.touch(entry)
+	return true, nil
+}
+
+// ZSet returns the sorted set stored at key, or nil if the key doesn't
+// exist. It must only be read, and only until the transaction ends.
+func (tx *Txn) ZSet(key string) (*ZSet, error) {
+	entry, err := tx.zset(key)
+	if entry == nil || err != nil {
+		return nil, err
+	}
+	return entry.ZSet, nil
+}
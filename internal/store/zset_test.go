@@ -0,0 +1,165 @@
+// internal/store/zset_test.go
+package store
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var (
+	negInf = ScoreBound{Value: math.Inf(-1)}
+	posInf = ScoreBound{Value: math.Inf(1)}
+)
+
+func TestZSet_Order(t *testing.T) {
+	z := NewZSet()
+	z.Add("c", 2)
+	z.Add("a", 1)
+	z.Add("b", 2)
+	if added := z.Add("a", 3); added {
+		t.Error("Updating a score should not report the member as added")
+	}
+
+	want := []ZMember{{"b", 2}, {"c", 2}, {"a", 3}}
+	if got := z.Members(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if rank, ok := z.Rank("a"); !ok || rank != 2 {
+		t.Errorf("Expected rank 2, got %d", rank)
+	}
+	if got := z.RangeByRank(0, 1, true); !reflect.DeepEqual(got, []ZMember{{"a", 3}, {"c", 2}}) {
+		t.Errorf("Unexpected reverse range: %v", got)
+	}
+	if got := z.RangeByRank(5, 10, false); len(got) != 0 {
+		t.Errorf("Expected empty range, got %v", got)
+	}
+
+	two := ScoreBound{Value: 2}
+	if n := z.CountByScore(two, posInf); n != 3 {
+		t.Errorf("Expected 3 members >= 2, got %d", n)
+	}
+	if n := z.CountByScore(ScoreBound{Value: 2, Exclusive: true}, posInf); n != 1 {
+		t.Errorf("Expected 1 member > 2, got %d", n)
+	}
+	if got := z.RangeByScore(negInf, posInf, true, 1, 1); !reflect.DeepEqual(got, []ZMember{{"c", 2}}) {
+		t.Errorf("Unexpected limited reverse range: %v", got)
+	}
+
+	// Lex ranges are only defined when all scores are equal
+	lex := NewZSet()
+	for _, m := range []string{"d", "a", "c", "b"} {
+		lex.Add(m, 0)
+	}
+	lexMin := LexBound{Value: "b", Exclusive: true}
+	if got := lex.RangeByLex(lexMin, LexBound{Inf: 1}, false, 0, -1); !reflect.DeepEqual(got, []ZMember{{"c", 0}, {"d", 0}}) {
+		t.Errorf("Unexpected lex range: %v", got)
+	}
+	if got := lex.RangeByLex(LexBound{Inf: -1}, LexBound{Value: "c"}, true, 0, 2); !reflect.DeepEqual(got, []ZMember{{"c", 0}, {"b", 0}}) {
+		t.Errorf("Unexpected reverse lex range: %v", got)
+	}
+
+	if !z.Remove("c") || z.Remove("c") {
+		t.Error("Remove should succeed once")
+	}
+	if z.Len() != 2 {
+		t.Errorf("Expected 2 members, got %d", z.Len())
+	}
+}
+
+// TestZSet_Model checks the skiplist against a sorted slice under random
+// adds, updates and removes
+func TestZSet_Model(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	z := NewZSet()
+	model := make(map[string]float64)
+
+	for i := 0; i < 2000; i++ {
+		member := fmt.Sprintf("m%d", rng.Intn(200))
+		if rng.Intn(3) == 0 {
+			z.Remove(member)
+			delete(model, member)
+		} else {
+			score := float64(rng.Intn(50))
+			z.Add(member, score)
+			model[member] = score
+		}
+	}
+
+	want := make([]ZMember, 0, len(model))
+	for m, s := range model {
+		want = append(want, ZMember{m, s})
+	}
+	sort.Slice(want, func(i, j int) bool {
+		if want[i].Score != want[j].Score {
+			return want[i].Score < want[j].Score
+		}
+		return want[i].Member < want[j].Member
+	})
+
+	if got := z.Members(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Skiplist order differs from model")
+	}
+	for i, m := range want {
+		if rank, _ := z.Rank(m.Member); rank != i {
+			t.Fatalf("Rank of %s: expected %d, got %d", m.Member, i, rank)
+		}
+	}
+	min, max := ScoreBound{Value: 10}, ScoreBound{Value: 20, Exclusive: true}
+	count := 0
+	for _, m := range want {
+		if m.Score >= 10 && m.Score < 20 {
+			count++
+		}
+	}
+	if n := z.CountByScore(min, max); n != count {
+		t.Errorf("CountByScore: expected %d, got %d", count, n)
+	}
+	if got := z.RangeByScore(min, max, false, 0, -1); len(got) != count {
+		t.Errorf("RangeByScore: expected %d members, got %d", count, len(got))
+	}
+}
+
+func TestTxn_ZSet(t *testing.T) {
+	s := New()
+	s.Set("str", "value")
+
+	_ = s.Update(func(tx *Txn) error {
+		if added, err := tx.ZAdd("z", "a", 1); err != nil || !added {
+			t.Errorf("ZAdd: %v, %v", added, err)
+		}
+		if _, err := tx.ZAdd("str", "a", 1); !errors.Is(err, ErrWrongType) {
+			t.Errorf("Expected ErrWrongType, got %v", err)
+		}
+		if z, _ := tx.ZSet("z"); z == nil || z.Len() != 1 {
+			t.Error("Expected a sorted set with one member")
+		}
+		return nil
+	})
+
+	_ = s.Update(func(tx *Txn) error {
+		_, _ = tx.ZRem("z", "a")
+		return nil
+	})
+	if s.Version("z") != 0 {
+		t.Error("Expected key to be removed with its last member")
+	}
+}
+
+func TestEntry_ZSetPayload(t *testing.T) {
+	entry := NewZSetEntry()
+	entry.ZSet.Add("top", math.Inf(1))
+	entry.ZSet.Add("mid", 1.5)
+
+	decoded, err := NewEntryFromPayload(TypeZSet, entry.Payload())
+	if err != nil {
+		t.Fatalf("NewEntryFromPayload failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.ZSet.Members(), entry.ZSet.Members()) {
+		t.Errorf("Expected %v, got %v", entry.ZSet.Members(), decoded.ZSet.Members())
+	}
+}
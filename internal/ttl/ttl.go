@@ -14,26 +14,33 @@ type Manager struct {
 	stopChan      chan struct{}
 	wg            sync.WaitGroup
 	checkInterval time.Duration
+	budget        time.Duration
 	stats         Stats
 	mu            sync.RWMutex
 }
 
 // StoreInterface defines the methods needed from store
 type StoreInterface interface {
-	DeleteExpired() int
+	// DeleteExpired removes expired keys until deadline has passed, and
+	// returns the number removed and the number of expired keys left
+	DeleteExpired(deadline time.Time) (deleted, backlog int)
 }
 
 // Stats tracks expiration statistics
 type Stats struct {
-	TotalExpired     int64
-	LastCheckTime    time.Time
-	LastExpiredCount int
-	ChecksPerformed  int64
+	TotalExpired      int64
+	LastCheckTime     time.Time
+	LastCheckDuration time.Duration
+	LastExpiredCount  int
+	ChecksPerformed   int64
+	Backlog           int   // Expired keys left by the last check, estimated from a sample
+	BudgetExhausted   int64 // Checks that ran out of time before the backlog
 }
 
 // Options for TTL manager
 type Options struct {
 	CheckInterval time.Duration // How often to check for expired keys
+	Budget        time.Duration // Longest time a check may hold the store (default: 25ms)
 }
 
 // NewManager creates a new TTL manager
@@ -41,10 +48,14 @@ func NewManager(store StoreInterface, opts Options) *Manager {
 	if opts.CheckInterval == 0 {
 		opts.CheckInterval = 1 * time.Second // Default: check every second
 	}
+	if opts.Budget == 0 {
+		opts.Budget = 25 * time.Millisecond
+	}
 
 	return &Manager{
 		store:         store,
 		checkInterval: opts.CheckInterval,
+		budget:        opts.Budget,
 		stopChan:      make(chan struct{}),
 	}
 }
@@ -68,37 +79,52 @@ func (m *Manager) Stop() {
 	log.Println("TTL manager stopped")
 }
 
-// expirationLoop runs in the background and deletes expired keys
+// expirationLoop runs in the background and deletes expired keys. A check
+// that runs out of budget is followed by another one after a pause as
+// long as the budget, rather than at the next tick, until the backlog is
+// cleared.
 func (m *Manager) expirationLoop() {
 	defer m.wg.Done()
 
+	var again <-chan time.Time
 	for {
 		select {
 		case <-m.ticker.C:
-			m.checkAndDeleteExpired()
+		case <-again:
 		case <-m.stopChan:
 			return
 		}
+		again = nil
+		if m.checkAndDeleteExpired() > 0 {
+			again = time.After(m.budget)
+		}
 	}
 }
 
-// checkAndDeleteExpired checks for and deletes expired keys
-func (m *Manager) checkAndDeleteExpired() {
+// checkAndDeleteExpired deletes expired keys for at most the budget and
+// returns the number of expired keys left
+func (m *Manager) checkAndDeleteExpired() int {
 	start := time.Now()
-	deleted := m.store.DeleteExpired()
+	deleted, backlog := m.store.DeleteExpired(start.Add(m.budget))
 	elapsed := time.Since(start)
 
 	// Update stats
 	m.mu.Lock()
 	m.stats.TotalExpired += int64(deleted)
 	m.stats.LastCheckTime = start
+	m.stats.LastCheckDuration = elapsed
 	m.stats.LastExpiredCount = deleted
 	m.stats.ChecksPerformed++
+	m.stats.Backlog = backlog
+	if backlog > 0 {
+		m.stats.BudgetExhausted++
+	}
 	m.mu.Unlock()
 
 	if deleted > 0 {
-		log.Printf("Expired %d keys in %v", deleted, elapsed)
+		log.Printf("Expired %d keys in %v (%d left)", deleted, elapsed, backlog)
 	}
+	return backlog
 }
 
 // ForceCheck manually triggers an expiration check
@@ -11,16 +11,22 @@ import (
 type MockStore struct {
 	mu            sync.RWMutex
 	expiredCount  int
+	backlog       int // Expired keys left, one less per check
+	deadlines     []time.Time
 	deleteExpired func() int
 }
 
-func (m *MockStore) DeleteExpired() int {
+func (m *MockStore) DeleteExpired(deadline time.Time) (int, int) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.deadlines = append(m.deadlines, deadline)
+	if m.backlog > 0 {
+		m.backlog--
+	}
 	if m.deleteExpired != nil {
-		return m.deleteExpired()
+		return m.deleteExpired(), m.backlog
 	}
-	return m.expiredCount
+	return m.expiredCount, m.backlog
 }
 
 func TestManager_Start_Stop(t *testing.T) {
@@ -177,3 +183,44 @@ func TestManager_ConcurrentAccess(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestManager_Budget(t *testing.T) {
+	store := &MockStore{expiredCount: 100, backlog: 2}
+	mgr := NewManager(store, Options{
+		CheckInterval: time.Hour, // Won't trigger automatically
+		Budget:        10 * time.Millisecond,
+	})
+
+	start := time.Now()
+	mgr.ForceCheck()
+	store.mu.RLock()
+	deadline := store.deadlines[0]
+	store.mu.RUnlock()
+	if deadline.Before(start.Add(10*time.Millisecond)) || deadline.After(time.Now().Add(10*time.Millisecond)) {
+		t.Errorf("Expected a deadline one budget after the check started, got %v", deadline.Sub(start))
+	}
+
+	stats := mgr.Stats()
+	if stats.Backlog != 1 || stats.BudgetExhausted != 1 {
+		t.Errorf("Expected a backlog of 1 after one exhausted check, got %+v", stats)
+	}
+}
+
+func TestManager_BacklogRechecks(t *testing.T) {
+	store := &MockStore{expiredCount: 100, backlog: 4}
+	mgr := NewManager(store, Options{
+		CheckInterval: 100 * time.Millisecond,
+		Budget:        time.Millisecond,
+	})
+
+	// The first tick leaves a backlog, which is worked through without
+	// waiting for the next one
+	mgr.Start()
+	time.Sleep(150 * time.Millisecond)
+	mgr.Stop()
+
+	stats := mgr.Stats()
+	if stats.Backlog != 0 || stats.BudgetExhausted != 3 || stats.ChecksPerformed != 4 {
+		t.Errorf("Expected the backlog to be cleared in 3 more checks, got %+v", stats)
+	}
+}
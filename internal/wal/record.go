@@ -4,6 +4,7 @@ package wal
 import (
 	"fmt"
 	"hash/crc32"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -14,27 +15,138 @@ type OpType string
 
 const (
 	OpSet    OpType = "SET"
-	OpDelete OpType = "DELETE"
+	OpDelete OpType = "DELETE" // Delete Key; Value is Expired when its expiration passed
 	OpClear  OpType = "CLEAR"
+	OpBatch  OpType = "BATCH"  // Header for an atomic group; Value is the record count
+	OpExpire OpType = "EXPIRE" // Set the expiration of Key to ExpiresAt, 0 removes it
+	OpHSet   OpType = "HSET"   // Set Field of the hash at Key to Value
+	OpHDel   OpType = "HDEL"   // Delete Field of the hash at Key
+	OpLPush  OpType = "LPUSH"  // Add Value at the head of the list at Key
+	OpRPush  OpType = "RPUSH"  // Add Value at the tail of the list at Key
+	OpLPop   OpType = "LPOP"   // Remove the head of the list at Key
+	OpRPop   OpType = "RPOP"   // Remove the tail of the list at Key
+	OpLRem   OpType = "LREM"   // Remove elements equal to Value; Field is the count
+	OpLTrim  OpType = "LTRIM"  // Trim the list at Key; Value is "start stop"
+	OpSAdd   OpType = "SADD"   // Add member Value to the set at Key
+	OpSRem   OpType = "SREM"   // Remove member Value from the set at Key
+	OpZAdd   OpType = "ZADD"   // Set the score of member Field in the sorted set at Key to Value
+	OpZRem   OpType = "ZREM"   // Remove member Field from the sorted set at Key
+	OpXAdd   OpType = "XADD"   // Append entry Field to the stream at Key; Value is its fields as JSON
+	OpXTrim  OpType = "XTRIM"  // Remove the entries of the stream at Key with IDs below Value
+	OpXGroup OpType = "XGROUP" // Set the last delivered ID of group Field to Value; an empty Value removes the group
+	OpXClaim OpType = "XCLAIM" // Deliver an entry to group Field; Value is "id deliveredAt deliveries consumer"
+	OpXAck   OpType = "XACK"   // Remove entry Value from the pending entries of group Field
+	OpPFAdd  OpType = "PFADD"  // Add element Value to the HyperLogLog at Key
+	OpBFInit OpType = "BFINIT" // Create the Bloom filter at Key; Value is "errorRate capacity expansion nonScaling"
+	OpBFAdd  OpType = "BFADD"  // Add item Value to the Bloom filter at Key
+	OpSetBit OpType = "SETBIT" // Set bit Field (an offset) of the string at Key to Value
+	OpJSet   OpType = "JSET"   // Set the value at path Field of the JSON document at Key to Value
+	OpJDel   OpType = "JDEL"   // Delete the value at path Field of the JSON document at Key
+	OpJApp   OpType = "JAPP"   // Append the elements of Value, a JSON array, to the array at path Field
+	OpSwapDB OpType = "SWAPDB" // Swap the contents of database DB with database Value
 )
 
+// validOps lists the operations accepted by Decode
+var validOps = map[OpType]bool{
+	OpSet:    true,
+	OpDelete: true,
+	OpClear:  true,
+	OpBatch:  true,
+	OpExpire: true,
+	OpHSet:   true,
+	OpHDel:   true,
+	OpLPush:  true,
+	OpRPush:  true,
+	OpLPop:   true,
+	OpRPop:   true,
+	OpLRem:   true,
+	OpLTrim:  true,
+	OpSAdd:   true,
+	OpSRem:   true,
+	OpZAdd:   true,
+	OpZRem:   true,
+	OpXAdd:   true,
+	OpXTrim:  true,
+	OpXGroup: true,
+	OpXClaim: true,
+	OpXAck:   true,
+	OpPFAdd:  true,
+	OpBFInit: true,
+	OpBFAdd:  true,
+	OpSetBit: true,
+	OpJSet:   true,
+	OpJDel:   true,
+	OpJApp:   true,
+	OpSwapDB: true,
+}
+
 // Record represents a single WAL entry
 type Record struct {
 	Timestamp int64  // Unix timestamp in nanoseconds
 	Op        OpType // Operation type
 	Key       string // Key (empty for CLEAR)
 	Value     string // Value (empty for DELETE and CLEAR)
+	ExpiresAt int64  // Absolute expiration in Unix nanoseconds, 0 means none
+	Version   uint64 // Version assigned to the key written, 0 if unknown
+	Type      string // Value type of a SET whose Value is an encoded payload, empty for strings
+	Field     string // Field within the key for field-level operations
+	DB        int    // Logical database the record applies to
 	Checksum  uint32 // CRC32 checksum for integrity
 }
 
+// Expired is the Value of the DELETE record logged for a key removed
+// because its expiration passed, telling it apart from a DEL
+const Expired = "expired"
+
+// RecordOption sets optional metadata on a record
+type RecordOption func(*Record)
+
+// WithExpiry sets the absolute expiration (Unix nanoseconds) of the key written
+func WithExpiry(expiresAt int64) RecordOption {
+	return func(r *Record) {
+		r.ExpiresAt = expiresAt
+	}
+}
+
+// WithVersion sets the version assigned to the key written
+func WithVersion(version uint64) RecordOption {
+	return func(r *Record) {
+		r.Version = version
+	}
+}
+
+// WithType marks the value of a SET as an encoded payload of the given type
+func WithType(valueType string) RecordOption {
+	return func(r *Record) {
+		r.Type = valueType
+	}
+}
+
+// WithField sets the field a field-level operation applies to
+func WithField(field string) RecordOption {
+	return func(r *Record) {
+		r.Field = field
+	}
+}
+
+// WithDB sets the logical database the record applies to
+func WithDB(db int) RecordOption {
+	return func(r *Record) {
+		r.DB = db
+	}
+}
+
 // NewRecord creates a new WAL record
-func NewRecord(op OpType, key, value string) *Record {
+func NewRecord(op OpType, key, value string, opts ...RecordOption) *Record {
 	r := &Record{
 		Timestamp: time.Now().UnixNano(),
 		Op:        op,
 		Key:       key,
 		Value:     value,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
 	r.Checksum = r.calculateChecksum()
 	return r
 }
@@ -42,9 +154,80 @@ func NewRecord(op OpType, key, value string) *Record {
 // calculateChecksum computes CRC32 checksum of the record data
 func (r *Record) calculateChecksum() uint32 {
 	data := fmt.Sprintf("%d|%s|%s|%s", r.Timestamp, r.Op, r.Key, r.Value)
+	if meta := r.encodeMeta(); meta != "" {
+		data += "|" + meta
+	}
 	return crc32.ChecksumIEEE([]byte(data))
 }
 
+// encodeMeta encodes the optional metadata fields as comma-separated
+// name=value pairs. It returns "" when no metadata is set, so records
+// without metadata keep the original 5-field format.
+func (r *Record) encodeMeta() string {
+	var meta []string
+	if r.ExpiresAt != 0 {
+		meta = append(meta, "exp="+strconv.FormatInt(r.ExpiresAt, 10))
+	}
+	if r.Version != 0 {
+		meta = append(meta, "ver="+strconv.FormatUint(r.Version, 10))
+	}
+	if r.Type != "" {
+		meta = append(meta, "type="+url.QueryEscape(r.Type))
+	}
+	if r.Field != "" {
+		meta = append(meta, "field="+url.QueryEscape(r.Field))
+	}
+	if r.DB != 0 {
+		meta = append(meta, "db="+strconv.Itoa(r.DB))
+	}
+	return strings.Join(meta, ",")
+}
+
+// decodeMeta parses the metadata field written by encodeMeta
+func (r *Record) decodeMeta(meta string) error {
+	for _, pair := range strings.Split(meta, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid metadata: %q", pair)
+		}
+		switch name {
+		case "exp":
+			expiresAt, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid expiry: %w", err)
+			}
+			r.ExpiresAt = expiresAt
+		case "ver":
+			version, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid version: %w", err)
+			}
+			r.Version = version
+		case "db":
+			db, err := strconv.Atoi(value)
+			if err != nil || db < 0 {
+				return fmt.Errorf("invalid database: %q", value)
+			}
+			r.DB = db
+		case "type", "field":
+			decoded, err := url.QueryUnescape(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", name, err)
+			}
+			if name == "type" {
+				r.Type = decoded
+			} else {
+				r.Field = decoded
+			}
+		default:
+			// Unknown metadata from a newer version; it is still covered
+			// by the checksum, so fail rather than silently dropping it
+			return fmt.Errorf("unknown metadata: %q", name)
+		}
+	}
+	return nil
+}
+
 // Validate checks if the record's checksum is valid
 func (r *Record) Validate() error {
 	expected := r.calculateChecksum()
@@ -56,26 +239,64 @@ func (r *Record) Validate() error {
 
 // escape escapes special characters for safe storage
 func escape(s string) string {
-	s = strings.ReplaceAll(s, "\\", "\\\\") // Escape backslash first
-	s = strings.ReplaceAll(s, "|", "\\|")   // Escape pipe
-	s = strings.ReplaceAll(s, "\n", "\\n")  // Escape newline
-	return s
+	if !strings.ContainsAny(s, "\\|\n\r") {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s) + len(s)/8)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '|':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString("\\n")
+		case '\r':
+			b.WriteString("\\r")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
 }
 
-// unescape reverses the escaping
+// unescape reverses the escaping. It reads the escapes in a single pass,
+// so that an escaped backslash followed by n stays a backslash and an n.
 func unescape(s string) string {
-	s = strings.ReplaceAll(s, "\\n", "\n")  // Unescape newline
-	s = strings.ReplaceAll(s, "\\|", "|")   // Unescape pipe
-	s = strings.ReplaceAll(s, "\\\\", "\\") // Unescape backslash last
-	return s
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 == len(s) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
 }
 
 // Encode converts the record to a string format for writing to disk
 // Format: timestamp|operation|key|value|checksum\n
+// Records with metadata use: timestamp|operation|key|value|metadata|checksum\n
 func (r *Record) Encode() string {
 	key := escape(r.Key)
 	value := escape(r.Value)
 
+	if meta := r.encodeMeta(); meta != "" {
+		return fmt.Sprintf("%d|%s|%s|%s|%s|%d\n", r.Timestamp, r.Op, key, value, meta, r.Checksum)
+	}
 	return fmt.Sprintf("%d|%s|%s|%s|%d\n", r.Timestamp, r.Op, key, value, r.Checksum)
 }
 
@@ -88,8 +309,8 @@ func Decode(line string) (*Record, error) {
 
 	// Split carefully - we need to handle escaped pipes
 	parts := splitRecord(line)
-	if len(parts) != 5 {
-		return nil, fmt.Errorf("invalid record format: expected 5 fields, got %d", len(parts))
+	if len(parts) != 5 && len(parts) != 6 {
+		return nil, fmt.Errorf("invalid record format: expected 5 or 6 fields, got %d", len(parts))
 	}
 
 	// Parse timestamp
@@ -100,7 +321,7 @@ func Decode(line string) (*Record, error) {
 
 	// Parse operation
 	op := OpType(parts[1])
-	if op != OpSet && op != OpDelete && op != OpClear {
+	if !validOps[op] {
 		return nil, fmt.Errorf("invalid operation: %s", op)
 	}
 
@@ -108,8 +329,8 @@ func Decode(line string) (*Record, error) {
 	key := unescape(parts[2])
 	value := unescape(parts[3])
 
-	// Parse checksum
-	checksum, err := strconv.ParseUint(parts[4], 10, 32)
+	// Parse checksum (always the last field)
+	checksum, err := strconv.ParseUint(parts[len(parts)-1], 10, 32)
 	if err != nil {
 		return nil, fmt.Errorf("invalid checksum: %w", err)
 	}
@@ -122,6 +343,13 @@ func Decode(line string) (*Record, error) {
 		Checksum:  uint32(checksum),
 	}
 
+	// Parse optional metadata
+	if len(parts) == 6 {
+		if err := record.decodeMeta(parts[4]); err != nil {
+			return nil, err
+		}
+	}
+
 	// Validate checksum
 	if err := record.Validate(); err != nil {
 		return nil, fmt.Errorf("record validation failed: %w", err)
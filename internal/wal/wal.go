@@ -5,8 +5,11 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -78,6 +81,43 @@ func (w *WAL) Write(record *Record) error {
 	return nil
 }
 
+// WriteBatch appends a group of records to the WAL in a single write.
+// The group is preceded by a BATCH header so that Replay applies it
+// all-or-nothing: a batch cut short by a crash is discarded.
+func (w *WAL) WriteBatch(records []*Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if len(records) == 1 {
+		return w.Write(records[0])
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	header := NewRecord(OpBatch, "", strconv.Itoa(len(records)))
+	if _, err := w.writer.WriteString(header.Encode()); err != nil {
+		return fmt.Errorf("failed to write batch header: %w", err)
+	}
+	for _, record := range records {
+		if _, err := w.writer.WriteString(record.Encode()); err != nil {
+			return fmt.Errorf("failed to write record: %w", err)
+		}
+	}
+
+	if err := w.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush buffer: %w", err)
+	}
+
+	if w.syncMode {
+		if err := w.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync to disk: %w", err)
+		}
+	}
+
+	return nil
+}
+
 // Replay reads all records from the WAL and calls the provided function for each
 func (w *WAL) Replay(fn func(*Record) error) error {
 	w.mu.Lock()
@@ -94,12 +134,16 @@ func (w *WAL) Replay(fn func(*Record) error) error {
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	lines := newLineReader(file)
 	lineNum := 0
 
-	for scanner.Scan() {
+	// Records of the batch currently being read, applied once complete
+	var batch []*Record
+	batchSize := 0
+
+	for lines.Scan() {
 		lineNum++
-		line := scanner.Text()
+		line := lines.Text()
 
 		// Skip empty lines
 		if line == "" {
@@ -112,16 +156,48 @@ func (w *WAL) Replay(fn func(*Record) error) error {
 			return fmt.Errorf("failed to decode record at line %d: %w", lineNum, err)
 		}
 
+		if record.Op == OpBatch {
+			if batchSize > 0 {
+				return fmt.Errorf("nested batch at line %d", lineNum)
+			}
+			batchSize, err = strconv.Atoi(record.Value)
+			if err != nil || batchSize <= 0 {
+				return fmt.Errorf("invalid batch size at line %d: %q", lineNum, record.Value)
+			}
+			batch = make([]*Record, 0, batchSize)
+			continue
+		}
+
+		if batchSize > 0 {
+			batch = append(batch, record)
+			if len(batch) < batchSize {
+				continue
+			}
+			for _, r := range batch {
+				if err := fn(r); err != nil {
+					return fmt.Errorf("failed to apply batch ending at line %d: %w", lineNum, err)
+				}
+			}
+			batch = nil
+			batchSize = 0
+			continue
+		}
+
 		// Apply record
 		if err := fn(record); err != nil {
 			return fmt.Errorf("failed to apply record at line %d: %w", lineNum, err)
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
+	if err := lines.Err(); err != nil {
 		return fmt.Errorf("error reading WAL: %w", err)
 	}
 
+	if batchSize > 0 {
+		log.Printf("WAL ends with an incomplete batch (%d of %d records), discarding it",
+			len(batch), batchSize)
+	}
+
 	return nil
 }
 
@@ -203,12 +279,12 @@ func ReadAll(path string) ([]*Record, error) {
 	defer file.Close()
 
 	var records []*Record
-	scanner := bufio.NewScanner(file)
+	lines := newLineReader(file)
 	lineNum := 0
 
-	for scanner.Scan() {
+	for lines.Scan() {
 		lineNum++
-		line := scanner.Text()
+		line := lines.Text()
 
 		if line == "" {
 			continue
@@ -222,9 +298,53 @@ func ReadAll(path string) ([]*Record, error) {
 		records = append(records, record)
 	}
 
-	if err := scanner.Err(); err != nil && err != io.EOF {
+	if err := lines.Err(); err != nil {
 		return nil, fmt.Errorf("error reading WAL: %w", err)
 	}
 
 	return records, nil
 }
+
+// lineReader reads the lines of a WAL file like bufio.Scanner, but without
+// a limit on their length: a record holds a whole value, which can be far
+// larger than the default 64KB token size of a Scanner
+type lineReader struct {
+	r    *bufio.Reader
+	line string
+	err  error
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// Scan reads the next line, without its line ending. It returns false at
+// the end of the file or on an error.
+func (l *lineReader) Scan() bool {
+	if l.err != nil {
+		return false
+	}
+	line, err := l.r.ReadString('\n')
+	if err != nil {
+		l.err = err
+		if line == "" {
+			return false
+		}
+	}
+	line = strings.TrimSuffix(line, "\n")
+	l.line = strings.TrimSuffix(line, "\r")
+	return true
+}
+
+// Text returns the line read by the last Scan
+func (l *lineReader) Text() string {
+	return l.line
+}
+
+// Err returns the error that stopped Scan, nil at the end of the file
+func (l *lineReader) Err() error {
+	if l.err == io.EOF {
+		return nil
+	}
+	return l.err
+}
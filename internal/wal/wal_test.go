@@ -3,6 +3,7 @@ package wal
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -19,6 +20,8 @@ func TestRecord_EncodeDecodeValidate(t *testing.T) {
 		{"special chars in key", OpSet, "key|with|pipes", "value"},
 		{"special chars in value", OpSet, "key", "value|with|pipes"},
 		{"newlines", OpSet, "key\nwith\nnewlines", "value\nwith\nnewlines"},
+		{"escaped backslashes", OpSet, "key", `C:\new\|x\\n`},
+		{"carriage returns", OpSet, "key", "a\r\nb\r"},
 		{"empty key", OpSet, "", "value"},
 		{"long value", OpSet, "key", "a very long value with lots of text"},
 	}
@@ -59,6 +62,56 @@ func TestRecord_EncodeDecodeValidate(t *testing.T) {
 	}
 }
 
+func TestRecord_Metadata(t *testing.T) {
+	record := NewRecord(OpSet, "key", "value", WithExpiry(1700000000000000000), WithVersion(42))
+
+	decoded, err := Decode(record.Encode())
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if decoded.ExpiresAt != record.ExpiresAt {
+		t.Errorf("ExpiresAt mismatch: got %d, want %d", decoded.ExpiresAt, record.ExpiresAt)
+	}
+	if decoded.Version != 42 {
+		t.Errorf("Version mismatch: got %d, want 42", decoded.Version)
+	}
+
+	// Fields and types are escaped so they can hold the metadata separators
+	hset := NewRecord(OpHSet, "key", "value", WithField("a,b=c|d"), WithType("hash"))
+	decoded, err = Decode(hset.Encode())
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if decoded.Field != "a,b=c|d" || decoded.Type != "hash" {
+		t.Errorf("Field/Type mismatch: got %q/%q", decoded.Field, decoded.Type)
+	}
+
+	// Records for database 0 leave the database out
+	swap := NewRecord(OpSwapDB, "", "0", WithDB(3))
+	decoded, err = Decode(swap.Encode())
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if decoded.DB != 3 {
+		t.Errorf("DB mismatch: got %d, want 3", decoded.DB)
+	}
+	if strings.Contains(hset.Encode(), "db=") {
+		t.Errorf("Expected no database in %q", hset.Encode())
+	}
+
+	// Records without metadata keep the original 5-field format
+	plain := NewRecord(OpSet, "key", "value")
+	if n := len(splitRecord(strings.TrimSpace(plain.Encode()))); n != 5 {
+		t.Errorf("Expected 5 fields without metadata, got %d", n)
+	}
+
+	// Tampering with the metadata breaks the checksum
+	tampered := strings.Replace(record.Encode(), "exp=17", "exp=18", 1)
+	if _, err := Decode(tampered); err == nil {
+		t.Error("Expected checksum error for tampered metadata")
+	}
+}
+
 func TestRecord_CorruptedChecksum(t *testing.T) {
 	record := NewRecord(OpSet, "key", "value")
 
@@ -133,6 +186,132 @@ func TestWAL_WriteAndReplay(t *testing.T) {
 	}
 }
 
+func TestWAL_ReplayBinaryAndLargeValues(t *testing.T) {
+	tmpDir := t.TempDir()
+	wal, err := New(Options{Path: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to create WAL: %v", err)
+	}
+
+	binary := make([]byte, 256)
+	for i := range binary {
+		binary[i] = byte(i)
+	}
+	values := []string{
+		string(binary),
+		"\\n\\|\\\\n\\",
+		strings.Repeat("\\n\xff", 100*1024),
+		strings.Repeat("x", 1<<20),
+	}
+	for i, v := range values {
+		if err := wal.Write(NewRecord(OpSet, "key", v, WithVersion(uint64(i+1)))); err != nil {
+			t.Fatalf("Failed to write record: %v", err)
+		}
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatalf("Failed to close WAL: %v", err)
+	}
+
+	wal, err = New(Options{Path: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to reopen WAL: %v", err)
+	}
+	defer wal.Close()
+
+	var replayed []string
+	err = wal.Replay(func(r *Record) error {
+		replayed = append(replayed, r.Value)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to replay WAL: %v", err)
+	}
+	if len(replayed) != len(values) {
+		t.Fatalf("Expected %d records, got %d", len(values), len(replayed))
+	}
+	for i, v := range values {
+		if replayed[i] != v {
+			t.Errorf("Record %d: value of %d bytes changed on replay", i, len(v))
+		}
+	}
+
+	records, err := ReadAll(wal.Path())
+	if err != nil || len(records) != len(values) {
+		t.Errorf("ReadAll: %d records, %v", len(records), err)
+	}
+}
+
+func TestWAL_WriteBatch(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	wal, err := New(Options{Path: tmpDir, SyncMode: false})
+	if err != nil {
+		t.Fatalf("Failed to create WAL: %v", err)
+	}
+
+	_ = wal.Write(NewRecord(OpSet, "before", "1"))
+	batch := []*Record{
+		NewRecord(OpSet, "a", "1"),
+		NewRecord(OpSet, "b", "2"),
+		NewRecord(OpDelete, "before", ""),
+	}
+	if err := wal.WriteBatch(batch); err != nil {
+		t.Fatalf("Failed to write batch: %v", err)
+	}
+	wal.Close()
+
+	wal, _ = New(Options{Path: tmpDir, SyncMode: false})
+	defer wal.Close()
+
+	var replayed []*Record
+	err = wal.Replay(func(r *Record) error {
+		replayed = append(replayed, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to replay WAL: %v", err)
+	}
+
+	// The BATCH header itself is not passed to the callback
+	if len(replayed) != 4 {
+		t.Fatalf("Expected 4 records, got %d", len(replayed))
+	}
+	if replayed[1].Key != "a" || replayed[3].Op != OpDelete {
+		t.Errorf("Unexpected replay order: %v", replayed)
+	}
+}
+
+func TestWAL_IncompleteBatchDiscarded(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	wal, err := New(Options{Path: tmpDir, SyncMode: false})
+	if err != nil {
+		t.Fatalf("Failed to create WAL: %v", err)
+	}
+
+	// Simulate a crash after the header and first record of a 3-record batch
+	_ = wal.Write(NewRecord(OpSet, "kept", "1"))
+	_ = wal.Write(NewRecord(OpBatch, "", "3"))
+	_ = wal.Write(NewRecord(OpSet, "lost", "1"))
+	wal.Close()
+
+	wal, _ = New(Options{Path: tmpDir, SyncMode: false})
+	defer wal.Close()
+
+	var replayed []*Record
+	err = wal.Replay(func(r *Record) error {
+		replayed = append(replayed, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to replay WAL: %v", err)
+	}
+
+	if len(replayed) != 1 || replayed[0].Key != "kept" {
+		t.Errorf("Expected only the record before the batch, got %v", replayed)
+	}
+}
+
 func TestWAL_Truncate(t *testing.T) {
 	tmpDir := t.TempDir()
 
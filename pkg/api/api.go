@@ -3,8 +3,13 @@ package api
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"net"
 	"strconv"
 	"strings"
@@ -25,6 +30,12 @@ type Server struct {
 	activeConns  int32
 	shutdownChan chan struct{}
 	wg           sync.WaitGroup
+	waiters      *keyWaiters               // Connections blocked in BLPOP, BRPOP, BLMOVE, XREAD and XREADGROUP
+	quotaMu      sync.Mutex                // Serializes QUOTA SET and saving the quotas
+	pubsub       *broker                   // Channels and patterns subscribed to, see pubsub.go
+	events       *engine.EventSubscription // Keyspace events published to channels, if enabled
+	scripts      *scriptCache              // Scripts loaded by EVAL and SCRIPT LOAD, see script.go
+	extensions   *extensionRegistry        // Commands added with RegisterCommand, see extension.go
 }
 
 // NewServer creates a new Server instance
@@ -33,6 +44,10 @@ func NewServer(cfg *config.Config, eng *engine.Engine) *Server {
 		engine:       eng,
 		cfg:          cfg,
 		shutdownChan: make(chan struct{}),
+		waiters:      newKeyWaiters(),
+		pubsub:       newBroker(cfg.PubSubBuffer),
+		scripts:      newScriptCache(),
+		extensions:   newExtensionRegistry(),
 	}
 }
 
@@ -41,6 +56,14 @@ func (s *Server) Start() error {
 	if err := s.cfg.Validate(); err != nil {
 		return fmt.Errorf("invalid configuration: %w", err)
 	}
+	if s.cfg.KeyspaceEvents != "" {
+		classes, err := engine.ParseEventClasses(s.cfg.KeyspaceEvents)
+		if err != nil {
+			return fmt.Errorf("invalid configuration: keyspace events: %w", err)
+		}
+		s.events = s.engine.SubscribeEvents("*", classes, s.pubsub.buffer)
+		go s.forwardKeyspaceEvents(s.events)
+	}
 
 	ln, err := net.Listen("tcp", s.cfg.Address())
 	if err != nil {
@@ -89,6 +112,9 @@ func (s *Server) Start() error {
 // Shutdown gracefully stops the server
 func (s *Server) Shutdown() error {
 	close(s.shutdownChan)
+	if s.events != nil {
+		s.events.Close()
+	}
 	s.listenerMu.RLock()
 	ln := s.listener
 	s.listenerMu.RUnlock()
@@ -123,45 +149,244 @@ func (s *Server) handleConnection(conn net.Conn) {
 	clientAddr := conn.RemoteAddr().String()
 	log.Printf("client connected: %s", clientAddr)
 
-	scanner := bufio.NewScanner(conn)
+	reader := bufio.NewReader(conn)
 	writer := bufio.NewWriter(conn)
 
+	sess := newSession(s.engine)
+	sess.conn, sess.writer = conn, writer
+	defer func() {
+		if sess.sub != nil {
+			// Give the writer goroutine a moment to send what is queued
+			s.pubsub.remove(sess.sub)
+			_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+			<-sess.writerDone
+		}
+	}()
+
 	// Send welcome message
 	_, _ = writer.WriteString("+OK kvlite ready\n")
 	_ = writer.Flush()
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	maxLine := s.cfg.MaxLineLength
+	if maxLine == 0 {
+		maxLine = DefaultMaxLineLength
+	}
+
+	for {
+		line, err := readLine(reader, maxLine)
+		if errors.Is(err, errLineTooLong) {
+			// The rest of the line can't be told apart from the next
+			// commands, so the connection is closed
+			log.Printf("line from %s longer than %d bytes, closing", clientAddr, maxLine)
+			if sess.sub == nil {
+				_, _ = fmt.Fprintf(writer, "-ERR line too long (max %d bytes)\n", maxLine)
+				_ = writer.Flush()
+			}
+			break
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("error reading from %s: %v", clientAddr, err)
+			}
+			break
+		}
+
+		// Empty lines are skipped, but still reach the flush below so the
+		// replies before them aren't held back
+		if strings.TrimSpace(line) != "" {
+			response := s.processCommand(sess, line)
+			if sess.sub != nil {
+				// Subscriber mode: the writer goroutine owns the output
+				if response != "" {
+					s.pubsub.reply(sess.sub, response)
+				}
+				if strings.HasPrefix(response, "+OK goodbye") {
+					break
+				}
+				continue
+			}
+			_, _ = writer.WriteString(response + "\n")
 
-		// Empty line, skip
-		if strings.TrimSpace(line) == "" {
+			// Handle QUIT command
+			if strings.HasPrefix(response, "+OK goodbye") {
+				_ = writer.Flush()
+				break
+			}
+		} else if sess.sub != nil {
+			// The writer goroutine flushes in subscriber mode
 			continue
 		}
 
-		response := s.processCommand(line)
-		_, _ = writer.WriteString(response + "\n")
-		_ = writer.Flush()
+		// Pipelining: keep executing while complete commands are already
+		// buffered, and only flush once the client is waiting on us
+		if !hasBufferedLine(reader) {
+			if err := writer.Flush(); err != nil {
+				log.Printf("error writing to %s: %v", clientAddr, err)
+				break
+			}
+		}
+	}
 
-		// Handle QUIT command
-		if strings.HasPrefix(response, "+OK goodbye") {
-			break
+	log.Printf("client disconnected: %s", clientAddr)
+}
+
+// DefaultMaxLineLength is the longest command line accepted when the
+// configuration doesn't say
+const DefaultMaxLineLength = 64 << 20
+
+// errLineTooLong is returned by readLine for a line over the limit
+var errLineTooLong = errors.New("line too long")
+
+// readLine reads a line of at most max bytes, newline included. Unlike
+// ReadString it stops buffering once the line passes the limit.
+func readLine(r *bufio.Reader, max int) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > max {
+			return "", errLineTooLong
+		}
+		line = append(line, chunk...)
+		if err != bufio.ErrBufferFull {
+			return string(line), err
 		}
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("error reading from %s: %v", clientAddr, err)
+// hasBufferedLine reports whether the reader already holds a complete command,
+// i.e. whether the next ReadString can return without touching the network
+func hasBufferedLine(r *bufio.Reader) bool {
+	n := r.Buffered()
+	if n == 0 {
+		return false
 	}
-	log.Printf("client disconnected: %s", clientAddr)
+	buf, err := r.Peek(n)
+	if err != nil {
+		return false
+	}
+	return bytes.IndexByte(buf, '\n') >= 0
+}
+
+// quoteEscaper escapes a quoted value the way splitQuoted reads it
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+
+// stringReply returns a string value as a reply line. Arguments can't hold
+// line breaks, but the bytes of a bitmap can, so such a value is quoted
+// with the escapes of quoted arguments.
+func stringReply(value string) string {
+	if !strings.ContainsAny(value, "\r\n") {
+		return value
+	}
+	return `"` + quoteEscaper.Replace(value) + `"`
 }
 
-// processCommand parses and executes commands
-func (s *Server) processCommand(line string) string {
+// hasLineBreak reports whether one of args holds a CR or LF
+func hasLineBreak(args []string) bool {
+	for _, arg := range args {
+		if strings.ContainsAny(arg, "\r\n") {
+			return true
+		}
+	}
+	return false
+}
+
+// dataStore is the set of engine operations used by data commands. It is
+// implemented by *engine.Engine and, while EXEC runs, by *engine.Tx.
+type dataStore interface {
+	Get(key string) (string, bool)
+	Set(key, value string) error
+	SetWithTTL(key, value string, ttl time.Duration) error
+	Delete(key string) (bool, error)
+	Expire(key string, ttl time.Duration) bool
+	Persist(key string) bool
+	TTL(key string) time.Duration
+	Keys(pattern string) []string
+	Scan(cursor string, opts engine.ScanOptions) (string, []string)
+	KeyRange(min, max engine.LexBound, limit int) []engine.KeyValue
+	Clear() error
+	dbStore
+	keyStore
+	expireStore
+	SetIf(key, value string, cond engine.SetCondition, ttl engine.Expiry) (engine.SetResult, error)
+	SetGet(key, value string, cond engine.SetCondition, ttl engine.Expiry) (engine.SetResult, error)
+	GetDel(key string) (string, bool, error)
+	GetEx(key string, ttl engine.Expiry) (string, bool, error)
+	GetWithVersion(key string) (string, uint64, bool, error)
+	CompareAndSwap(key string, expected uint64, value string) (uint64, error)
+	IncrBy(key string, delta int64) (int64, error)
+	IncrByFloat(key string, delta float64) (float64, error)
+	Append(key, value string) (int, error)
+	Exists(key string) bool
+	hashStore
+	listStore
+	setStore
+	zsetStore
+	streamStore
+	hllStore
+	bloomStore
+	bitmapStore
+	jsonStore
+	geoStore
+}
+
+// processCommand parses a command line and executes it for a connection
+func (s *Server) processCommand(sess *session, line string) string {
 	parts := strings.Fields(line)
 	if len(parts) == 0 {
 		return "-ERR empty command"
 	}
 
 	cmd := strings.ToUpper(parts[0])
+	// A SET value starting with a double quote is a quoted string, which
+	// options may follow, see parseSetOptions
+	if scriptCommands[cmd] || (cmd == "SET" && len(parts) > 2 && strings.HasPrefix(parts[2], `"`)) {
+		var err error
+		if parts, err = splitQuoted(line); err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+	}
+	if jsonValueCommands[cmd] {
+		parts = splitJSON(line)
+	}
+
+	if s.subscribed(sess) && !pubsubCommands[cmd] && cmd != "PING" && cmd != "QUIT" {
+		return fmt.Sprintf("-ERR command '%s' not allowed in subscriber mode, only SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE, PUNSUBSCRIBE, PING and QUIT are", cmd)
+	}
+
+	switch cmd {
+	case "MULTI", "EXEC", "DISCARD", "WATCH", "UNWATCH":
+		return s.transactionCommand(sess, cmd, parts)
+	}
+
+	if sess.inMulti && cmd != "QUIT" {
+		return sess.queue(cmd, parts, s.transactional(cmd))
+	}
+
+	switch {
+	case cmd == "SELECT":
+		return s.selectDB(sess, parts)
+	case cmd == "QUOTA":
+		return s.quotaCommand(sess, parts)
+	case pubsubCommands[cmd]:
+		return s.pubsubCommand(sess, cmd, parts)
+	case blockingCommands[cmd]:
+		return s.blockingCommand(sess.db, cmd, parts)
+	case cmd == "XREAD" || cmd == "XREADGROUP":
+		return s.streamRead(sess.db, cmd, parts, true)
+	}
+
+	return s.executeCommand(sess.db, cmd, parts)
+}
+
+// executeCommand runs a single command. Data commands go through db so they
+// can run either directly against the engine or inside a transaction.
+func (s *Server) executeCommand(db dataStore, cmd string, parts []string) string {
+	// Replies are lines, so a value holding a line break couldn't be read
+	// back. Only quoted strings and scripts can pass one; script sources
+	// themselves may span lines.
+	if !scriptCommands[cmd] && hasLineBreak(parts[1:]) {
+		return "-ERR arguments can't contain line breaks"
+	}
 
 	switch cmd {
 	case "SET":
@@ -169,26 +394,163 @@ func (s *Server) processCommand(line string) string {
 			return "-ERR SET requires key and value"
 		}
 		key := parts[1]
-		value := strings.Join(parts[2:], " ")
-		if err := s.engine.Set(key, value); err != nil {
-			return fmt.Sprintf("-ERR failed to set: %v", err)
+
+		value, opts, err := parseSetOptions(parts)
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+
+		// Plain SET keeps the original fast path
+		if !opts.get && opts.cond == engine.SetAlways && opts.expiry == (engine.Expiry{}) {
+			if err := db.Set(key, value); err != nil {
+				return errReply("failed to set", err)
+			}
+			return "+OK"
+		}
+
+		set := db.SetIf
+		if opts.get {
+			set = db.SetGet
+		}
+		res, err := set(key, value, opts.cond, opts.expiry)
+		if err != nil {
+			return errReply("failed to set", err)
+		}
+		if opts.get {
+			if !res.Existed {
+				return "(nil)"
+			}
+			return stringReply(res.Old)
+		}
+		if !res.Written {
+			return "(nil)"
 		}
 		return "+OK"
 
-	case "SETEX":
+	case "SETNX":
+		if len(parts) < 3 {
+			return "-ERR SETNX requires key and value"
+		}
+		key := parts[1]
+		value := strings.Join(parts[2:], " ")
+		res, err := db.SetIf(key, value, engine.SetIfNotExists, engine.Expiry{})
+		if err != nil {
+			return errReply("failed to set", err)
+		}
+		if res.Written {
+			return "1"
+		}
+		return "0"
+
+	case "GETSET":
+		if len(parts) < 3 {
+			return "-ERR GETSET requires key and value"
+		}
+		key := parts[1]
+		value := strings.Join(parts[2:], " ")
+		res, err := db.SetGet(key, value, engine.SetAlways, engine.Expiry{})
+		if err != nil {
+			return errReply("failed to set", err)
+		}
+		if !res.Existed {
+			return "(nil)"
+		}
+		return stringReply(res.Old)
+
+	case "GETDEL":
+		if len(parts) < 2 {
+			return "-ERR GETDEL requires key"
+		}
+		val, ok, err := db.GetDel(parts[1])
+		if err != nil {
+			return errReply("failed to delete", err)
+		}
+		if !ok {
+			return "-ERR key not found"
+		}
+		return stringReply(val)
+
+	case "GETEX":
+		if len(parts) < 2 {
+			return "-ERR GETEX requires key"
+		}
+		var expiry engine.Expiry
+		switch {
+		case len(parts) == 3 && strings.ToUpper(parts[2]) == "PERSIST":
+			expiry.Persist = true
+		case len(parts) == 4:
+			var err error
+			expiry, err = parseExpiry(parts[2], parts[3])
+			if err != nil {
+				return fmt.Sprintf("-ERR %v", err)
+			}
+		case len(parts) != 2:
+			return "-ERR syntax error"
+		}
+		val, ok, err := db.GetEx(parts[1], expiry)
+		if err != nil {
+			return errReply("failed to set expiration", err)
+		}
+		if !ok {
+			return "-ERR key not found"
+		}
+		return stringReply(val)
+
+	case "GETV":
+		if len(parts) < 2 {
+			return "-ERR GETV requires key"
+		}
+		val, version, ok, err := db.GetWithVersion(parts[1])
+		if err != nil {
+			return errReply("failed to get", err)
+		}
+		if !ok {
+			return "-ERR key not found"
+		}
+		return fmt.Sprintf("%d %s", version, stringReply(val))
+
+	case "CAS":
 		if len(parts) < 4 {
+			return "-ERR CAS requires key, version, and value"
+		}
+		expected, err := strconv.ParseUint(parts[2], 10, 64)
+		if err != nil {
+			return "-ERR invalid version"
+		}
+		value := strings.Join(parts[3:], " ")
+		version, err := db.CompareAndSwap(parts[1], expected, value)
+		if errors.Is(err, engine.ErrVersionConflict) {
+			return fmt.Sprintf("-ERR CONFLICT version mismatch (current %d)", version)
+		}
+		if err != nil {
+			return errReply("failed to set", err)
+		}
+		return strconv.FormatUint(version, 10)
+
+	case "SETEX", "PSETEX":
+		if len(parts) < 4 {
+			if cmd == "PSETEX" {
+				return "-ERR PSETEX requires key, milliseconds, and value"
+			}
 			return "-ERR SETEX requires key, seconds, and value"
 		}
 		key := parts[1]
-		seconds, err := strconv.ParseInt(parts[2], 10, 64)
-		if err != nil || seconds <= 0 {
+		n, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
 			return "-ERR invalid TTL"
 		}
 		value := strings.Join(parts[3:], " ")
 
-		ttl := time.Duration(seconds) * time.Second
-		if err := s.engine.SetWithTTL(key, value, ttl); err != nil {
-			return fmt.Sprintf("-ERR failed to set: %v", err)
+		unit := time.Second
+		if cmd == "PSETEX" {
+			unit = time.Millisecond
+		}
+		ttl, err := parseTTL(n, unit)
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		if err := db.SetWithTTL(key, value, ttl); err != nil {
+			return errReply("failed to set", err)
 		}
 		return "+OK"
 
@@ -197,20 +559,23 @@ func (s *Server) processCommand(line string) string {
 			return "-ERR GET requires key"
 		}
 		key := parts[1]
-		val, ok := s.engine.Get(key)
+		val, ok := db.Get(key)
 		if !ok {
+			if db.Exists(key) {
+				return errReply("failed to get", engine.ErrWrongType)
+			}
 			return "-ERR key not found"
 		}
-		return val
+		return stringReply(val)
 
 	case "DELETE", "DEL":
 		if len(parts) < 2 {
 			return "-ERR DELETE requires key"
 		}
 		key := parts[1]
-		deleted, err := s.engine.Delete(key)
+		deleted, err := db.Delete(key)
 		if err != nil {
-			return fmt.Sprintf("-ERR failed to delete: %v", err)
+			return errReply("failed to delete", err)
 		}
 		if deleted {
 			return "+OK"
@@ -222,54 +587,20 @@ func (s *Server) processCommand(line string) string {
 			return "-ERR EXISTS requires key"
 		}
 		key := parts[1]
-		_, ok := s.engine.Get(key)
-		if ok {
+		if db.Exists(key) {
 			return "1"
 		}
 		return "0"
 
-	case "EXPIRE":
-		if len(parts) < 3 {
-			return "-ERR EXPIRE requires key and seconds"
-		}
-		key := parts[1]
-		seconds, err := strconv.ParseInt(parts[2], 10, 64)
-		if err != nil || seconds <= 0 {
-			return "-ERR invalid TTL"
-		}
-
-		ttl := time.Duration(seconds) * time.Second
-		if s.engine.Expire(key, ttl) {
-			return "1"
-		}
-		return "0"
-
-	case "TTL":
-		if len(parts) < 2 {
-			return "-ERR TTL requires key"
-		}
-		key := parts[1]
-
-		// Check if key exists first
-		_, exists := s.engine.Get(key)
-		if !exists {
-			return "-2" // Key doesn't exist
-		}
-
-		ttl := s.engine.TTL(key)
-		if ttl == 0 {
-			return "-1" // No TTL
-		}
-
-		seconds := int64(ttl.Seconds())
-		return fmt.Sprintf("%d", seconds)
+	case "EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT", "TTL", "PTTL", "EXPIRETIME", "PEXPIRETIME":
+		return executeExpireCommand(db, cmd, parts)
 
 	case "PERSIST":
 		if len(parts) < 2 {
 			return "-ERR PERSIST requires key"
 		}
 		key := parts[1]
-		if s.engine.Persist(key) {
+		if db.Persist(key) {
 			return "1"
 		}
 		return "0"
@@ -280,7 +611,7 @@ func (s *Server) processCommand(line string) string {
 			pattern = parts[1]
 		}
 
-		keys := s.engine.Keys(pattern)
+		keys := db.Keys(pattern)
 		if len(keys) == 0 {
 			return "(empty list)"
 		}
@@ -288,66 +619,98 @@ func (s *Server) processCommand(line string) string {
 		return strings.Join(keys, "\n")
 
 	case "SCAN":
-		cursor := 0
-		pattern := "*"
-		count := 10
-
 		if len(parts) < 2 {
 			return "-ERR SCAN requires cursor"
 		}
 
-		var err error
-		cursor, err = strconv.Atoi(parts[1])
+		cursor, err := decodeScanCursor(parts[1])
 		if err != nil {
 			return "-ERR invalid cursor"
 		}
 
 		// Parse optional arguments
-		for i := 2; i < len(parts); i++ {
-			arg := strings.ToUpper(parts[i])
-			switch arg {
-			case "MATCH":
-				if i+1 < len(parts) {
-					pattern = parts[i+1]
-					i++
-				}
-			case "COUNT":
-				if i+1 < len(parts) {
-					count, err = strconv.Atoi(parts[i+1])
-					if err != nil || count <= 0 {
-						return "-ERR invalid count"
-					}
-					i++
-				}
-			}
+		opts, err := parseKeyScanOptions(parts[2:])
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
 		}
 
-		nextCursor, keys, _ := s.engine.Scan(cursor, pattern, count)
+		next, keys := db.Scan(cursor, opts)
 
-		result := fmt.Sprintf("%d", nextCursor)
+		result := encodeScanCursor(next)
 		if len(keys) > 0 {
 			result += "\n" + strings.Join(keys, "\n")
 		}
 		return result
 
-	case "CLEAR":
-		if err := s.engine.Clear(); err != nil {
-			return fmt.Sprintf("-ERR failed to clear: %v", err)
+	case "RANGE":
+		if len(parts) != 3 && len(parts) != 5 {
+			return "-ERR RANGE requires start, end and optionally LIMIT n"
+		}
+		min, err := parseKeyBound(parts[1])
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		max, err := parseKeyBound(parts[2])
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		limit := 0
+		if len(parts) == 5 {
+			if strings.ToUpper(parts[3]) != "LIMIT" {
+				return "-ERR syntax error"
+			}
+			if limit, err = strconv.Atoi(parts[4]); err != nil || limit < 0 {
+				return "-ERR LIMIT must be a non-negative integer"
+			}
 		}
-		return "+OK"
+
+		pairs := db.KeyRange(min, max, limit)
+		if len(pairs) == 0 {
+			return "(empty list)"
+		}
+		results := make([]string, 0, len(pairs)*2)
+		for _, p := range pairs {
+			results = append(results, p.Key, stringReply(p.Value))
+		}
+		return strings.Join(results, "\n")
+
+	case "CLEAR", "FLUSHDB", "FLUSHALL", "MOVE", "SWAPDB":
+		return s.executeDBCommand(db, cmd, parts)
+
+	case "RENAME", "RENAMENX", "COPY", "TYPE", "RANDOMKEY", "TOUCH", "UNLINK", "DUMP", "RESTORE":
+		return s.executeKeyCommand(db, cmd, parts)
 
 	case "PING":
 		return "+PONG"
 
+	case "PUBLISH":
+		if len(parts) < 3 {
+			return "-ERR PUBLISH requires channel and message"
+		}
+		return strconv.Itoa(s.pubsub.publish(parts[1], strings.Join(parts[2:], " ")))
+
+	case "PUBSUB":
+		return s.pubsubInfo(parts)
+
+	case "EVAL", "EVALSHA":
+		return s.eval(db, cmd, parts)
+
+	case "SCRIPT":
+		return s.scriptCommand(parts)
+
 	case "QUIT":
 		return "+OK goodbye"
 
 	case "INFO":
 		walSize, _ := s.engine.WALSize()
-		return fmt.Sprintf("+OK keys=%d connections=%d wal_size=%d",
-			s.engine.Len(),
+		info := fmt.Sprintf("+OK keys=%d connections=%d wal_size=%d",
+			s.keyCount(),
 			atomic.LoadInt32(&s.activeConns),
 			walSize)
+		if sizes := formatDBSizes(s.engine.DBSizes()); sizes != "" {
+			info += " " + sizes
+		}
+		return info
 
 	case "SYNC":
 		if err := s.engine.Sync(); err != nil {
@@ -368,15 +731,17 @@ func (s *Server) processCommand(line string) string {
 		needsCompaction := stats["needs_compaction"].(bool)
 		ttlExpired := stats["ttl_total_expired"].(int64)
 		ttlChecks := stats["ttl_checks"].(int64)
+		ttlBacklog := stats["ttl_backlog"].(int)
 
-		result := fmt.Sprintf("+OK keys=%d connections=%d wal_size=%d wal_entries=%d needs_compaction=%v ttl_expired=%d ttl_checks=%d",
-			s.engine.Len(),
+		result := fmt.Sprintf("+OK keys=%d connections=%d wal_size=%d wal_entries=%d needs_compaction=%v ttl_expired=%d ttl_checks=%d ttl_backlog=%d",
+			s.keyCount(),
 			atomic.LoadInt32(&s.activeConns),
 			walSize,
 			walEntries,
 			needsCompaction,
 			ttlExpired,
-			ttlChecks)
+			ttlChecks,
+			ttlBacklog)
 
 		// Add analytics stats if enabled
 		if analyticsEnabled, ok := stats["analytics_enabled"].(bool); ok && analyticsEnabled {
@@ -464,8 +829,8 @@ func (s *Server) processCommand(line string) string {
 		for i := 1; i < len(parts); i += 2 {
 			key := parts[i]
 			value := parts[i+1]
-			if err := s.engine.Set(key, value); err != nil {
-				return fmt.Sprintf("-ERR failed at key %s: %v", key, err)
+			if err := db.Set(key, value); err != nil {
+				return errReply("failed at key "+key, err)
 			}
 		}
 		return "+OK"
@@ -478,9 +843,9 @@ func (s *Server) processCommand(line string) string {
 		// Batch get operation
 		var results []string
 		for _, key := range parts[1:] {
-			val, ok := s.engine.Get(key)
+			val, ok := db.Get(key)
 			if ok {
-				results = append(results, val)
+				results = append(results, stringReply(val))
 			} else {
 				results = append(results, "(nil)")
 			}
@@ -495,7 +860,7 @@ func (s *Server) processCommand(line string) string {
 		// Batch delete operation
 		deleted := 0
 		for _, key := range parts[1:] {
-			if ok, err := s.engine.Delete(key); err == nil && ok {
+			if ok, err := db.Delete(key); err == nil && ok {
 				deleted++
 			}
 		}
@@ -516,7 +881,7 @@ func (s *Server) processCommand(line string) string {
 	"connections": %d,
 	"wal_size": %d,
 	"wal_healthy": %v
-	}`, status, s.engine.Len(), atomic.LoadInt32(&s.activeConns), walSize, walErr == nil)
+	}`, status, s.keyCount(), atomic.LoadInt32(&s.activeConns), walSize, walErr == nil)
 
 		return health
 
@@ -550,78 +915,53 @@ func (s *Server) processCommand(line string) string {
 		if len(parts) < 2 {
 			return "-ERR INCR requires key"
 		}
-		key := parts[1]
-
-		// Get current value
-		val, exists := s.engine.Get(key)
-		current := int64(0)
-
-		if exists {
-			var err error
-			current, err = strconv.ParseInt(val, 10, 64)
-			if err != nil {
-				return "-ERR value is not an integer"
-			}
-		}
-
-		// Increment
-		current++
-		newVal := strconv.FormatInt(current, 10)
-
-		if err := s.engine.Set(key, newVal); err != nil {
-			return fmt.Sprintf("-ERR failed to set: %v", err)
-		}
-
-		return fmt.Sprintf("%d", current)
+		return incrReply(db.IncrBy(parts[1], 1))
 
 	case "DECR":
 		if len(parts) < 2 {
 			return "-ERR DECR requires key"
 		}
-		key := parts[1]
+		return incrReply(db.IncrBy(parts[1], -1))
 
-		// Get current value
-		val, exists := s.engine.Get(key)
-		current := int64(0)
-
-		if exists {
-			var err error
-			current, err = strconv.ParseInt(val, 10, 64)
-			if err != nil {
-				return "-ERR value is not an integer"
+	case "INCRBY", "DECRBY":
+		if len(parts) < 3 {
+			return fmt.Sprintf("-ERR %s requires key and increment", cmd)
+		}
+		delta, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			return "-ERR value is not an integer"
+		}
+		if cmd == "DECRBY" {
+			if delta == math.MinInt64 {
+				return fmt.Sprintf("-ERR %v", engine.ErrOverflow)
 			}
+			delta = -delta
 		}
+		return incrReply(db.IncrBy(parts[1], delta))
 
-		// Decrement
-		current--
-		newVal := strconv.FormatInt(current, 10)
-
-		if err := s.engine.Set(key, newVal); err != nil {
-			return fmt.Sprintf("-ERR failed to set: %v", err)
+	case "INCRBYFLOAT":
+		if len(parts) < 3 {
+			return "-ERR INCRBYFLOAT requires key and increment"
 		}
-
-		return fmt.Sprintf("%d", current)
+		delta, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+			return "-ERR value is not a valid float"
+		}
+		f, err := db.IncrByFloat(parts[1], delta)
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64)
 
 	case "APPEND":
 		if len(parts) < 3 {
 			return "-ERR APPEND requires key and value"
 		}
-		key := parts[1]
-		appendVal := strings.Join(parts[2:], " ")
-
-		// Get current value
-		val, exists := s.engine.Get(key)
-		if !exists {
-			val = ""
-		}
-
-		// Append
-		newVal := val + appendVal
-		if err := s.engine.Set(key, newVal); err != nil {
-			return fmt.Sprintf("-ERR failed to set: %v", err)
+		n, err := db.Append(parts[1], strings.Join(parts[2:], " "))
+		if err != nil {
+			return errReply("failed to set", err)
 		}
-
-		return fmt.Sprintf("%d", len(newVal))
+		return fmt.Sprintf("%d", n)
 
 	case "STRLEN":
 		if len(parts) < 2 {
@@ -629,14 +969,273 @@ func (s *Server) processCommand(line string) string {
 		}
 		key := parts[1]
 
-		val, exists := s.engine.Get(key)
+		val, exists := db.Get(key)
 		if !exists {
+			if db.Exists(key) {
+				return errReply("failed to get", engine.ErrWrongType)
+			}
 			return "0"
 		}
 
 		return fmt.Sprintf("%d", len(val))
 
+	case "HSET", "HGET", "HMGET", "HGETALL", "HDEL", "HEXISTS", "HLEN",
+		"HKEYS", "HVALS", "HINCRBY", "HSCAN":
+		return executeHashCommand(db, cmd, parts)
+
+	case "LPUSH", "RPUSH", "LPOP", "RPOP", "LLEN", "LINDEX", "LRANGE", "LREM",
+		"LTRIM", "LMOVE", "BLPOP", "BRPOP", "BLMOVE":
+		return s.executeListCommand(db, cmd, parts)
+
+	case "SADD", "SREM", "SISMEMBER", "SMISMEMBER", "SMEMBERS", "SCARD", "SPOP",
+		"SRANDMEMBER", "SINTER", "SUNION", "SDIFF", "SINTERSTORE", "SUNIONSTORE",
+		"SDIFFSTORE", "SSCAN":
+		return executeSetCommand(db, cmd, parts)
+
+	case "ZADD", "ZREM", "ZSCORE", "ZINCRBY", "ZCARD", "ZRANK", "ZREVRANK", "ZCOUNT",
+		"ZREMRANGEBYSCORE", "ZRANGE", "ZPOPMIN", "ZPOPMAX":
+		return executeZSetCommand(db, cmd, parts)
+
+	case "XADD", "XTRIM", "XLEN", "XRANGE", "XREVRANGE", "XREAD", "XREADGROUP", "XGROUP", "XACK",
+		"XPENDING", "XCLAIM":
+		return s.executeStreamCommand(db, cmd, parts)
+
+	case "PFADD", "PFCOUNT", "PFMERGE":
+		return executeHLLCommand(db, cmd, parts)
+
+	case "BF.RESERVE", "BF.ADD", "BF.MADD", "BF.EXISTS":
+		return executeBloomCommand(db, cmd, parts)
+
+	case "SETBIT", "GETBIT", "BITCOUNT", "BITPOS", "BITOP":
+		return executeBitmapCommand(db, cmd, parts)
+
+	case "JSON.SET", "JSON.GET", "JSON.MGET", "JSON.DEL", "JSON.NUMINCRBY", "JSON.ARRAPPEND":
+		return executeJSONCommand(db, cmd, parts)
+
+	case "GEOADD", "GEOPOS", "GEODIST", "GEOHASH", "GEOSEARCH":
+		return executeGeoCommand(db, cmd, parts)
+
 	default:
+		if ext := s.extensions.get(cmd); ext != nil {
+			return s.runExtension(db, cmd, ext, parts)
+		}
 		return fmt.Sprintf("-ERR unknown command '%s'", cmd)
 	}
 }
+
+// incrReply formats the result of an integer increment
+func incrReply(n int64, err error) string {
+	switch {
+	case errors.Is(err, engine.ErrNotInteger), errors.Is(err, engine.ErrOverflow):
+		return fmt.Sprintf("-ERR %v", err)
+	case err != nil:
+		return errReply("failed to set", err)
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// parseScanOptions parses the MATCH and COUNT options of the SCAN family
+func parseScanOptions(args []string) (string, int, error) {
+	pattern := "*"
+	count := 10
+
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			if i+1 < len(args) {
+				pattern = args[i+1]
+				i++
+			}
+		case "COUNT":
+			if i+1 < len(args) {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n <= 0 {
+					return "", 0, fmt.Errorf("invalid count")
+				}
+				count = n
+				i++
+			}
+		}
+	}
+	return pattern, count, nil
+}
+
+// parseKeyScanOptions parses the MATCH, COUNT and TYPE options of SCAN
+func parseKeyScanOptions(args []string) (engine.ScanOptions, error) {
+	var opts engine.ScanOptions
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		if strings.ToUpper(args[i]) == "TYPE" && i+1 < len(args) {
+			opts.Type = strings.ToLower(args[i+1])
+			i++
+			continue
+		}
+		rest = append(rest, args[i])
+	}
+	pattern, count, err := parseScanOptions(rest)
+	opts.Match, opts.Count = pattern, count
+	return opts, err
+}
+
+// SCAN cursors are the key the next page starts at, hex-encoded so that
+// "0", which starts and ends a scan, can't be mistaken for a key
+
+// decodeScanCursor returns the key a SCAN cursor resumes at
+func decodeScanCursor(cursor string) (string, error) {
+	if cursor == "0" {
+		return "", nil
+	}
+	key, err := hex.DecodeString(cursor)
+	if err != nil || len(key) == 0 {
+		return "", fmt.Errorf("invalid cursor")
+	}
+	return string(key), nil
+}
+
+// encodeScanCursor returns the SCAN cursor resuming at key
+func encodeScanCursor(key string) string {
+	if key == "" {
+		return "0"
+	}
+	return hex.EncodeToString([]byte(key))
+}
+
+// parseKeyBound parses one end of a RANGE: "-" or "+" for the open ends,
+// a key prefixed by "[" (inclusive) or "(" (exclusive), or a bare key,
+// which is inclusive
+func parseKeyBound(arg string) (engine.LexBound, error) {
+	switch {
+	case arg == "-", arg == "+", strings.HasPrefix(arg, "["), strings.HasPrefix(arg, "("):
+		return parseLexBound(arg)
+	}
+	return engine.LexBound{Value: arg}, nil
+}
+
+// errReply formats an engine error, prefixed with what failed. Type and
+// quota errors are returned as is.
+func errReply(what string, err error) string {
+	if errors.Is(err, engine.ErrWrongType) || errors.Is(err, engine.ErrQuotaExceeded) {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	return fmt.Sprintf("-ERR %s: %v", what, err)
+}
+
+// setOptions holds the options parsed from a SET command
+type setOptions struct {
+	cond   engine.SetCondition
+	expiry engine.Expiry
+	get    bool
+}
+
+// parseSetOptions parses the value and options of a SET command. The value
+// is one word or a quoted string, and the options follow it. If the word
+// after the value isn't an option, the rest of the line is part of the
+// value, so that a value with spaces is stored as it is even when its last
+// words look like options; such a value must be quoted to take options.
+func parseSetOptions(parts []string) (string, setOptions, error) {
+	var opts setOptions
+	if len(parts) == 3 || !isSetOption(parts[3]) {
+		return strings.Join(parts[2:], " "), opts, nil
+	}
+
+	hasExpiry := false
+	for i := 3; i < len(parts); i++ {
+		switch tok := strings.ToUpper(parts[i]); tok {
+		case "NX", "XX":
+			if opts.cond != engine.SetAlways {
+				return "", opts, fmt.Errorf("syntax error")
+			}
+			opts.cond = engine.SetIfNotExists
+			if tok == "XX" {
+				opts.cond = engine.SetIfExists
+			}
+		case "GET":
+			if opts.get {
+				return "", opts, fmt.Errorf("syntax error")
+			}
+			opts.get = true
+		case "KEEPTTL":
+			if hasExpiry {
+				return "", opts, fmt.Errorf("syntax error")
+			}
+			hasExpiry = true
+			opts.expiry.KeepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasExpiry || i+1 == len(parts) {
+				return "", opts, fmt.Errorf("syntax error")
+			}
+			expiry, err := parseExpiry(tok, parts[i+1])
+			if err != nil {
+				return "", opts, err
+			}
+			hasExpiry = true
+			opts.expiry = expiry
+			i++
+		default:
+			return "", opts, fmt.Errorf("syntax error")
+		}
+	}
+	return parts[2], opts, nil
+}
+
+// isSetOption reports whether tok is an option of SET
+func isSetOption(tok string) bool {
+	switch strings.ToUpper(tok) {
+	case "NX", "XX", "GET", "KEEPTTL":
+		return true
+	}
+	return isExpiryOption(tok)
+}
+
+// isExpiryOption reports whether tok is EX, PX, EXAT or PXAT
+func isExpiryOption(tok string) bool {
+	switch strings.ToUpper(tok) {
+	case "EX", "PX", "EXAT", "PXAT":
+		return true
+	}
+	return false
+}
+
+// parseExpiry parses an EX/PX/EXAT/PXAT option and its argument
+func parseExpiry(opt, arg string) (engine.Expiry, error) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || n <= 0 {
+		return engine.Expiry{}, fmt.Errorf("invalid TTL")
+	}
+
+	var at time.Time
+	switch strings.ToUpper(opt) {
+	case "EX":
+		ttl, err := parseTTL(n, time.Second)
+		return engine.Expiry{TTL: ttl}, err
+	case "PX":
+		ttl, err := parseTTL(n, time.Millisecond)
+		return engine.Expiry{TTL: ttl}, err
+	case "EXAT":
+		if n > maxExpiry.Unix() {
+			return engine.Expiry{}, fmt.Errorf("invalid TTL")
+		}
+		at = time.Unix(n, 0)
+	case "PXAT":
+		at = time.UnixMilli(n)
+	default:
+		return engine.Expiry{}, fmt.Errorf("syntax error")
+	}
+	if at.After(maxExpiry) {
+		return engine.Expiry{}, fmt.Errorf("invalid TTL")
+	}
+	return engine.Expiry{At: at}, nil
+}
+
+// maxExpiry is the latest expiration that fits in the Unix nanoseconds keys
+// store it as
+var maxExpiry = time.Unix(0, math.MaxInt64)
+
+// parseTTL converts n units to a TTL, failing unless it is positive and
+// expires before maxExpiry
+func parseTTL(n int64, unit time.Duration) (time.Duration, error) {
+	if n <= 0 || n > int64(time.Until(maxExpiry)/unit) {
+		return 0, fmt.Errorf("invalid TTL")
+	}
+	return time.Duration(n) * unit, nil
+}
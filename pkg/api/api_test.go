@@ -5,6 +5,7 @@ import (
 	"bufio"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -23,13 +24,15 @@ type testHelper struct {
 }
 
 func setupTestHelper(t *testing.T) *testHelper {
-	tmpDir := t.TempDir()
-
-	cfg := &config.Config{
+	return setupTestHelperWithConfig(t, &config.Config{
 		Host:           "localhost",
 		Port:           0, // Random port
 		MaxConnections: 0,
-	}
+	})
+}
+
+func setupTestHelperWithConfig(t *testing.T, cfg *config.Config) *testHelper {
+	tmpDir := t.TempDir()
 
 	eng, err := engine.New(engine.Options{
 		WALPath:         tmpDir,
@@ -133,6 +136,55 @@ func (h *testHelper) sendMultilineCommand(cmd string) []string {
 	return responses
 }
 
+// testConn is a persistent connection for tests that need per-connection
+// state such as MULTI or WATCH
+type testConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	t      *testing.T
+}
+
+func (h *testHelper) dial() *testConn {
+	conn, err := net.Dial("tcp", h.addr)
+	if err != nil {
+		h.t.Fatalf("Failed to connect: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	if _, err := reader.ReadString('\n'); err != nil {
+		h.t.Fatalf("Failed to read welcome: %v", err)
+	}
+
+	return &testConn{conn: conn, reader: reader, t: h.t}
+}
+
+// send writes a command and reads a single-line reply
+func (c *testConn) send(cmd string) string {
+	return c.sendLines(cmd, 1)[0]
+}
+
+// sendLines writes a command and reads exactly n reply lines
+func (c *testConn) sendLines(cmd string, n int) []string {
+	if _, err := fmt.Fprintf(c.conn, "%s\n", cmd); err != nil {
+		c.t.Fatalf("Failed to send %q: %v", cmd, err)
+	}
+
+	_ = c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	lines := make([]string, n)
+	for i := range lines {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("Failed to read reply to %q: %v", cmd, err)
+		}
+		lines[i] = strings.TrimSuffix(line, "\n")
+	}
+	return lines
+}
+
+func (c *testConn) close() {
+	c.conn.Close()
+}
+
 // Basic Command Tests
 
 func TestServer_PING(t *testing.T) {
@@ -189,6 +241,300 @@ func TestServer_SET_MissingArgs(t *testing.T) {
 	}
 }
 
+func TestServer_SET_NX_XX(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	if r := h.sendCommand("SET lock owner1 NX"); r != "+OK" {
+		t.Errorf("SET NX on new key should succeed, got: %s", r)
+	}
+	if r := h.sendCommand("SET lock owner2 NX"); r != "(nil)" {
+		t.Errorf("SET NX on existing key should fail, got: %s", r)
+	}
+	if r := h.sendCommand("GET lock"); r != "owner1" {
+		t.Errorf("Expected owner1, got: %s", r)
+	}
+
+	if r := h.sendCommand("SET missing value XX"); r != "(nil)" {
+		t.Errorf("SET XX on missing key should fail, got: %s", r)
+	}
+	if r := h.sendCommand("SET lock owner3 XX"); r != "+OK" {
+		t.Errorf("SET XX on existing key should succeed, got: %s", r)
+	}
+	if r := h.sendCommand("SET k v NX XX"); !strings.HasPrefix(r, "-ERR") {
+		t.Errorf("SET with NX and XX should fail, got: %s", r)
+	}
+}
+
+func TestServer_SET_GET_Option(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	if r := h.sendCommand("SET k first GET"); r != "(nil)" {
+		t.Errorf("SET GET on new key should return (nil), got: %s", r)
+	}
+	if r := h.sendCommand(`SET k "second value" GET`); r != "first" {
+		t.Errorf("SET GET should return old value, got: %s", r)
+	}
+	if r := h.sendCommand("GET k"); r != "second value" {
+		t.Errorf("Expected value with spaces to be kept, got: %s", r)
+	}
+	// NX with GET returns the old value without writing
+	if r := h.sendCommand("SET k third NX GET"); r != "second value" {
+		t.Errorf("SET NX GET should return old value, got: %s", r)
+	}
+	if r := h.sendCommand("GET k"); r != "second value" {
+		t.Errorf("SET NX GET should not overwrite, got: %s", r)
+	}
+}
+
+func TestServer_SET_ValuesLikeOptions(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	// Words after a value of several words are part of the value, even when
+	// they look like options
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"SET note hello world get", "hello world get"},
+		{"SET note buy milk nx", "buy milk nx"},
+		{"SET note one two XX", "one two XX"},
+		{"SET note keep this keepttl", "keep this keepttl"},
+		{"SET note call me ex 10", "call me ex 10"},
+		{"SET note C:\\new \"quoted\" EX 10", `C:\new "quoted" EX 10`},
+		{`SET note "please get"`, "please get"},
+		{`SET note "call me \"later\"" EX 100`, `call me "later"`},
+	}
+	for _, tt := range tests {
+		if r := h.sendCommand(tt.cmd); r != "+OK" {
+			t.Errorf("%s: expected +OK, got: %s", tt.cmd, r)
+			continue
+		}
+		if r := h.sendCommand("GET note"); r != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.cmd, tt.want, r)
+		}
+	}
+	if r := h.sendCommand("TTL note"); r != "100" && r != "99" {
+		t.Errorf("Expected the options after a quoted value to apply, got TTL %s", r)
+	}
+
+	// Options directly after a value of one word still apply
+	if r := h.sendCommand("SET note please GET"); r != `call me "later"` {
+		t.Errorf("Expected GET to return the old value, got: %s", r)
+	}
+	for _, cmd := range []string{`SET note "a b" EX`, `SET note "a b" NX junk`, `SET note "open`} {
+		if r := h.sendCommand(cmd); !strings.HasPrefix(r, "-ERR") {
+			t.Errorf("%s: expected an error, got: %s", cmd, r)
+		}
+	}
+
+	// Line breaks would split the value over several reply lines, so they
+	// are rejected, whether they come from a quoted value or a script
+	for _, cmd := range []string{
+		`SET note "two\nlines"`,
+		`SET note "carriage\rreturn" EX 10`,
+		`EVAL "return kv.call('SET', 'note', 'two\\nlines')" 0`,
+		`EVAL "return kv.call('HSET', 'h', 'f', 'two\\nlines')" 0`,
+	} {
+		if r := h.sendCommand(cmd); r != "-ERR arguments can't contain line breaks" {
+			t.Errorf("%s: expected line breaks to be rejected, got: %s", cmd, r)
+		}
+	}
+	if r := h.sendCommand("GET note"); r != "please" {
+		t.Errorf("Expected the value to be left alone, got: %s", r)
+	}
+}
+
+func TestServer_SET_Expiry(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	if r := h.sendCommand("SET session data EX 100"); r != "+OK" {
+		t.Fatalf("SET EX failed: %s", r)
+	}
+	if r := h.sendCommand("TTL session"); r != "99" && r != "100" {
+		t.Errorf("Expected TTL ~100, got: %s", r)
+	}
+
+	// KEEPTTL keeps the expiration across overwrites
+	h.sendCommand("SET session newdata KEEPTTL")
+	if r := h.sendCommand("TTL session"); r == "-1" {
+		t.Error("KEEPTTL should keep the expiration")
+	}
+
+	// Plain SET clears it
+	h.sendCommand("SET session newdata")
+	if r := h.sendCommand("TTL session"); r != "-1" {
+		t.Errorf("SET without options should clear TTL, got: %s", r)
+	}
+
+	h.sendCommand("SET short data PX 100")
+	time.Sleep(200 * time.Millisecond)
+	if r := h.sendCommand("GET short"); r != "-ERR key not found" {
+		t.Errorf("Key set with PX should have expired, got: %s", r)
+	}
+
+	at := time.Now().Add(time.Hour).Unix()
+	h.sendCommand(fmt.Sprintf("SET abs data EXAT %d", at))
+	if r := h.sendCommand("TTL abs"); r != "3599" && r != "3600" {
+		t.Errorf("Expected TTL ~3600 for EXAT, got: %s", r)
+	}
+
+	for _, cmd := range []string{"SET k v EX 0", "SET k v EX abc", "SET k v EX 10 PX 100", "SET k v EX 10 KEEPTTL"} {
+		if r := h.sendCommand(cmd); !strings.HasPrefix(r, "-ERR") {
+			t.Errorf("Expected error for %q, got: %s", cmd, r)
+		}
+	}
+
+	// Expirations past what a key can store are rejected rather than
+	// overflowing into the past
+	h.sendCommand("SET k v")
+	for _, cmd := range []string{
+		"SET k v EX 99999999999",
+		"SET k v PX 9223372036854775807",
+		"SET k v EXAT 99999999999",
+		"SET k v PXAT 9223372036854775807",
+		"GETEX k EX 99999999999",
+	} {
+		if r := h.sendCommand(cmd); r != "-ERR invalid TTL" {
+			t.Errorf("Expected invalid TTL for %q, got: %s", cmd, r)
+		}
+	}
+	if r := h.sendCommand("SET k v EX 3153600000"); r != "+OK" {
+		t.Errorf("Expected a TTL of a century to be accepted, got: %s", r)
+	}
+	if r := h.sendCommand("GET k"); r != "v" {
+		t.Errorf("Expected the key not to expire at once, got: %s", r)
+	}
+}
+
+func TestServer_SETNX(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	if r := h.sendCommand("SETNX k v1"); r != "1" {
+		t.Errorf("SETNX on new key should return 1, got: %s", r)
+	}
+	if r := h.sendCommand("SETNX k v2"); r != "0" {
+		t.Errorf("SETNX on existing key should return 0, got: %s", r)
+	}
+	if r := h.sendCommand("GET k"); r != "v1" {
+		t.Errorf("Expected v1, got: %s", r)
+	}
+}
+
+func TestServer_GETSET_GETDEL(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	if r := h.sendCommand("GETSET k v1"); r != "(nil)" {
+		t.Errorf("GETSET on new key should return (nil), got: %s", r)
+	}
+	if r := h.sendCommand("GETSET k v2"); r != "v1" {
+		t.Errorf("GETSET should return old value, got: %s", r)
+	}
+
+	if r := h.sendCommand("GETDEL k"); r != "v2" {
+		t.Errorf("GETDEL should return value, got: %s", r)
+	}
+	if r := h.sendCommand("EXISTS k"); r != "0" {
+		t.Errorf("GETDEL should delete the key, got EXISTS=%s", r)
+	}
+	if r := h.sendCommand("GETDEL k"); r != "-ERR key not found" {
+		t.Errorf("GETDEL on missing key should fail, got: %s", r)
+	}
+}
+
+func TestServer_GETSET_WrongType(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	h.sendCommand("HSET h f v")
+	h.sendCommand("RPUSH l a")
+	h.sendCommand("SADD s m")
+	for _, cmd := range []string{"SET h x GET", "GETSET h x", "SET l x GET", "GETSET l x", "SET s x NX GET", "GETSET s x"} {
+		if r := h.sendCommand(cmd); !strings.HasPrefix(r, "-ERR WRONGTYPE") {
+			t.Errorf("%s: expected WRONGTYPE, got: %s", cmd, r)
+		}
+	}
+	if r := h.sendCommand("HGET h f"); r != "v" {
+		t.Errorf("Expected the hash to be left alone, got: %s", r)
+	}
+	if r := h.sendCommand("TYPE l"); r != "+list" {
+		t.Errorf("Expected the list to be left alone, got: %s", r)
+	}
+	if r := h.sendCommand("SISMEMBER s m"); r != "1" {
+		t.Errorf("Expected the set to be left alone, got: %s", r)
+	}
+
+	// Without GET, SET still replaces a value of another type
+	if r := h.sendCommand("SET h x"); r != "+OK" {
+		t.Errorf("Expected SET to replace the hash, got: %s", r)
+	}
+}
+
+func TestServer_GETEX(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	h.sendCommand("SET k v")
+	if r := h.sendCommand("GETEX k EX 100"); r != "v" {
+		t.Errorf("GETEX should return value, got: %s", r)
+	}
+	if r := h.sendCommand("TTL k"); r == "-1" {
+		t.Error("GETEX EX should set a TTL")
+	}
+	if r := h.sendCommand("GETEX k PERSIST"); r != "v" {
+		t.Errorf("GETEX PERSIST should return value, got: %s", r)
+	}
+	if r := h.sendCommand("TTL k"); r != "-1" {
+		t.Errorf("GETEX PERSIST should remove TTL, got: %s", r)
+	}
+	if r := h.sendCommand("GETEX missing"); r != "-ERR key not found" {
+		t.Errorf("GETEX on missing key should fail, got: %s", r)
+	}
+}
+
+func TestServer_GETV_CAS(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	// Version 0 creates the key
+	created := h.sendCommand("CAS k 0 hello world")
+	if _, err := strconv.ParseUint(created, 10, 64); err != nil {
+		t.Fatalf("CAS create should return a version, got: %s", created)
+	}
+	if r := h.sendCommand("GETV k"); r != created+" hello world" {
+		t.Errorf("Expected GETV '%s hello world', got: %s", created, r)
+	}
+
+	updated := h.sendCommand("CAS k " + created + " v2")
+	if updated == created || strings.HasPrefix(updated, "-ERR") {
+		t.Fatalf("CAS with current version failed: %s", updated)
+	}
+
+	expected := "-ERR CONFLICT version mismatch (current " + updated + ")"
+	if r := h.sendCommand("CAS k " + created + " v3"); r != expected {
+		t.Errorf("Expected %q, got: %s", expected, r)
+	}
+	if r := h.sendCommand("GET k"); r != "v2" {
+		t.Errorf("Conflicting CAS was applied: %s", r)
+	}
+
+	if r := h.sendCommand("GETV missing"); r != "-ERR key not found" {
+		t.Errorf("GETV on missing key should fail, got: %s", r)
+	}
+	h.sendCommand("RPUSH l a")
+	if r := h.sendCommand("GETV l"); !strings.HasPrefix(r, "-ERR WRONGTYPE") {
+		t.Errorf("GETV on a list should fail with WRONGTYPE, got: %s", r)
+	}
+	if r := h.sendCommand("CAS k abc v"); r != "-ERR invalid version" {
+		t.Errorf("Expected invalid version error, got: %s", r)
+	}
+}
+
 func TestServer_GET_NonExistent(t *testing.T) {
 	h := setupTestHelper(t)
 	defer h.close()
@@ -439,6 +785,103 @@ func TestServer_SCAN_InvalidCursor(t *testing.T) {
 	}
 }
 
+func TestServer_SCAN_Paging(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	for i := 0; i < 12; i++ {
+		c.send(fmt.Sprintf("SET user:%02d v", i))
+		c.send(fmt.Sprintf("SET order:%02d v", i))
+	}
+
+	got := c.sendLines("SCAN 0 MATCH user:* COUNT 5", 6)
+	if strings.Join(got[1:], " ") != "user:00 user:01 user:02 user:03 user:04" {
+		t.Fatalf("Expected the first page in order, got %v", got)
+	}
+	got = c.sendLines("SCAN "+got[0]+" MATCH user:* COUNT 5", 6)
+	if strings.Join(got[1:], " ") != "user:05 user:06 user:07 user:08 user:09" {
+		t.Fatalf("Expected the second page in order, got %v", got)
+	}
+	got = c.sendLines("SCAN "+got[0]+" MATCH user:* COUNT 5", 3)
+	if strings.Join(got, " ") != "0 user:10 user:11" {
+		t.Errorf("Expected the last page with cursor 0, got %v", got)
+	}
+}
+
+func TestServer_SCAN_Hints(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("MSET a 1 b 2 c 3")
+	c.send("HSET h f v")
+	c.send("SADD s m")
+
+	got := c.sendLines("SCAN 0 TYPE hash COUNT 100", 2)
+	if strings.Join(got, " ") != "0 h" {
+		t.Errorf("Expected only the hash, got %v", got)
+	}
+
+	// COUNT bounds the keys visited, so a page can be empty
+	got = c.sendLines("SCAN 0 COUNT 2 TYPE set", 1)
+	if got[0] != encodeScanCursor("c") {
+		t.Errorf("Expected an empty page resuming at c, got %v", got)
+	}
+	got = c.sendLines("SCAN "+got[0]+" COUNT 2 TYPE set", 1)
+	if got[0] != encodeScanCursor("s") {
+		t.Errorf("Expected an empty page resuming at s, got %v", got)
+	}
+	got = c.sendLines("SCAN "+got[0]+" COUNT 2 TYPE set", 2)
+	if strings.Join(got, " ") != "0 s" {
+		t.Errorf("Expected the set on the last page, got %v", got)
+	}
+
+	if got := c.send("SCAN zz"); got != "-ERR invalid cursor" {
+		t.Errorf("Expected an invalid cursor error, got %q", got)
+	}
+}
+
+func TestServer_RANGE(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("MSET b 2 a 1 d 4 c 3")
+	c.send("HSET bb f v")
+
+	if got := c.sendLines("RANGE b d", 6); strings.Join(got, " ") != "b 2 c 3 d 4" {
+		t.Errorf("RANGE b d = %v", got)
+	}
+	if got := c.sendLines("RANGE - + LIMIT 1", 2); strings.Join(got, " ") != "a 1" {
+		t.Errorf("RANGE - + LIMIT 1 = %v", got)
+	}
+	if got := c.sendLines("RANGE (a (d", 4); strings.Join(got, " ") != "b 2 c 3" {
+		t.Errorf("RANGE (a (d = %v", got)
+	}
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"RANGE x z", "(empty list)"},
+		{"RANGE a", "-ERR RANGE requires start, end and optionally LIMIT n"},
+		{"RANGE a z COUNT 1", "-ERR syntax error"},
+		{"RANGE a z LIMIT -1", "-ERR LIMIT must be a non-negative integer"},
+	}
+	for _, tt := range tests {
+		if got := c.send(tt.cmd); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
 // Batch Operations Tests
 
 func TestServer_MSET_MGET(t *testing.T) {
@@ -536,6 +979,83 @@ func TestServer_DECR(t *testing.T) {
 	}
 }
 
+func TestServer_INCRBY_DECRBY(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	if r := h.sendCommand("INCRBY n 10"); r != "10" {
+		t.Errorf("Expected 10, got: %s", r)
+	}
+	if r := h.sendCommand("DECRBY n 15"); r != "-5" {
+		t.Errorf("Expected -5, got: %s", r)
+	}
+	if r := h.sendCommand("INCRBY n abc"); r != "-ERR value is not an integer" {
+		t.Errorf("Expected integer error, got: %s", r)
+	}
+
+	h.sendCommand("SET big 9223372036854775807")
+	if r := h.sendCommand("INCRBY big 1"); r != "-ERR increment or decrement would overflow" {
+		t.Errorf("Expected overflow error, got: %s", r)
+	}
+	if r := h.sendCommand("DECRBY n -9223372036854775808"); r != "-ERR increment or decrement would overflow" {
+		t.Errorf("Expected overflow error for DECRBY MinInt64, got: %s", r)
+	}
+}
+
+func TestServer_INCRBYFLOAT(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	h.sendCommand("SET price 10.5")
+	if r := h.sendCommand("INCRBYFLOAT price 0.1"); r != "10.6" {
+		t.Errorf("Expected 10.6, got: %s", r)
+	}
+	if r := h.sendCommand("INCRBYFLOAT price -5"); r != "5.6" {
+		t.Errorf("Expected 5.6, got: %s", r)
+	}
+	if r := h.sendCommand("INCRBYFLOAT price nan"); r != "-ERR value is not a valid float" {
+		t.Errorf("Expected float error, got: %s", r)
+	}
+}
+
+func TestServer_INCR_KeepsTTL(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	h.sendCommand("SETEX n 100 1")
+	h.sendCommand("INCR n")
+	h.sendCommand("APPEND n 0")
+	if r := h.sendCommand("TTL n"); r == "-1" || strings.HasPrefix(r, "-ERR") {
+		t.Errorf("INCR/APPEND should keep the TTL, got: %s", r)
+	}
+	if r := h.sendCommand("GET n"); r != "20" {
+		t.Errorf("Expected 20, got: %s", r)
+	}
+}
+
+func TestServer_INCR_Concurrent(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := h.dial()
+			defer c.close()
+			for j := 0; j < 20; j++ {
+				c.send("INCR hits")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if r := h.sendCommand("GET hits"); r != "100" {
+		t.Errorf("Expected 100 after concurrent INCR, got: %s", r)
+	}
+}
+
 // String Operations Tests
 
 func TestServer_APPEND(t *testing.T) {
@@ -895,6 +1415,78 @@ func TestServer_ConcurrentOperations(t *testing.T) {
 	}
 }
 
+func TestServer_EmptyLinesFlush(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	// The empty line is the last thing buffered, so the PING reply must
+	// be flushed when it is skipped
+	if _, err := c.conn.Write([]byte("PING\n\n")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	_ = c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if got, err := c.reader.ReadString('\n'); err != nil || got != "+PONG\n" {
+		t.Errorf("Expected +PONG, got %q, %v", got, err)
+	}
+}
+
+func TestServer_MaxLineLength(t *testing.T) {
+	h := setupTestHelperWithConfig(t, &config.Config{Host: "localhost", Port: 0, MaxLineLength: 1024})
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+	if got := c.send("SET k " + strings.Repeat("x", 1000)); got != "+OK" {
+		t.Errorf("Expected a line within the limit to work, got %q", got)
+	}
+	if got := c.send("SET k " + strings.Repeat("x", 2000)); got != "-ERR line too long (max 1024 bytes)" {
+		t.Errorf("Expected the long line to be rejected, got %q", got)
+	}
+	// and the connection to be closed
+	if _, err := c.reader.ReadString('\n'); err == nil {
+		t.Error("Expected the connection to be closed")
+	}
+	if got := h.sendCommand("STRLEN k"); got != "1000" {
+		t.Errorf("Expected the long SET not to run, got %s", got)
+	}
+}
+
+func TestServer_Pipelining(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	conn, err := net.Dial("tcp", h.addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	if _, err := reader.ReadString('\n'); err != nil {
+		t.Fatalf("Failed to read welcome: %v", err)
+	}
+
+	// Send every command in a single write before reading any reply
+	if _, err := conn.Write([]byte("SET p1 a\nSET p2 b\nGET p1\nINCR n\nINCR n\nGET p2\n")); err != nil {
+		t.Fatalf("Failed to write pipeline: %v", err)
+	}
+
+	expected := []string{"+OK", "+OK", "a", "1", "2", "b"}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for i, want := range expected {
+		got, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read reply %d: %v", i, err)
+		}
+		if got = strings.TrimSuffix(got, "\n"); got != want {
+			t.Errorf("Reply %d: expected %s, got %s", i, want, got)
+		}
+	}
+}
+
 func TestServer_Addr(t *testing.T) {
 	h := setupTestHelper(t)
 	defer h.close()
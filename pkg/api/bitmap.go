@@ -0,0 +1,145 @@
+// pkg/api/bitmap.go
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lofoneh/kvlite/internal/engine"
+)
+
+// bitmapStore is the part of dataStore used by the bitmap commands
+type bitmapStore interface {
+	SetBit(key string, offset uint64, bit int) (int, error)
+	GetBit(key string, offset uint64) (int, error)
+	BitCount(key string, r *engine.BitRange) (int64, error)
+	BitPos(key string, bit int, r *engine.BitRange) (int64, error)
+	BitOp(op, dst string, keys ...string) (int, error)
+}
+
+// executeBitmapCommand runs a bitmap command
+func executeBitmapCommand(db bitmapStore, cmd string, parts []string) string {
+	switch cmd {
+	case "SETBIT":
+		if len(parts) != 4 {
+			return "-ERR SETBIT requires key, offset and value"
+		}
+		offset, err := parseBitOffset(parts[2])
+		if err != nil {
+			return "-ERR " + err.Error()
+		}
+		bit, err := parseBit(parts[3])
+		if err != nil {
+			return "-ERR " + err.Error()
+		}
+		old, err := db.SetBit(parts[1], offset, bit)
+		if err != nil {
+			return errReply("failed to set bit", err)
+		}
+		return strconv.Itoa(old)
+
+	case "GETBIT":
+		if len(parts) != 3 {
+			return "-ERR GETBIT requires key and offset"
+		}
+		offset, err := parseBitOffset(parts[2])
+		if err != nil {
+			return "-ERR " + err.Error()
+		}
+		bit, err := db.GetBit(parts[1], offset)
+		if err != nil {
+			return errReply("failed to get bit", err)
+		}
+		return strconv.Itoa(bit)
+
+	case "BITCOUNT":
+		if len(parts) != 2 && len(parts) != 4 && len(parts) != 5 {
+			return "-ERR BITCOUNT requires key and optionally start, end and BYTE or BIT"
+		}
+		r, err := parseBitRange(parts[2:])
+		if err != nil {
+			return "-ERR " + err.Error()
+		}
+		n, err := db.BitCount(parts[1], r)
+		if err != nil {
+			return errReply("failed to count bits", err)
+		}
+		return strconv.FormatInt(n, 10)
+
+	case "BITPOS":
+		if len(parts) < 3 || len(parts) > 6 {
+			return "-ERR BITPOS requires key, bit and optionally start, end and BYTE or BIT"
+		}
+		bit, err := parseBit(parts[2])
+		if err != nil {
+			return "-ERR " + err.Error()
+		}
+		r, err := parseBitRange(parts[3:])
+		if err != nil {
+			return "-ERR " + err.Error()
+		}
+		pos, err := db.BitPos(parts[1], bit, r)
+		if err != nil {
+			return errReply("failed to find bit", err)
+		}
+		return strconv.FormatInt(pos, 10)
+
+	case "BITOP":
+		if len(parts) < 4 {
+			return "-ERR BITOP requires operation, destination key and at least one key"
+		}
+		n, err := db.BitOp(strings.ToUpper(parts[1]), parts[2], parts[3:]...)
+		if err != nil {
+			return errReply("failed to combine", err)
+		}
+		return strconv.Itoa(n)
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'", cmd)
+}
+
+// parseBitOffset parses the offset of SETBIT and GETBIT
+func parseBitOffset(s string) (uint64, error) {
+	offset, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || offset > engine.MaxBitOffset {
+		return 0, engine.ErrBitOffset
+	}
+	return offset, nil
+}
+
+// parseBit parses a bit value, which must be 0 or 1
+func parseBit(s string) (int, error) {
+	if s != "0" && s != "1" {
+		return 0, engine.ErrBitValue
+	}
+	return int(s[0] - '0'), nil
+}
+
+// parseBitRange parses the optional [start [end [BYTE|BIT]]] arguments of
+// BITCOUNT and BITPOS. No arguments means the whole string.
+func parseBitRange(args []string) (*engine.BitRange, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	r := &engine.BitRange{End: -1, OpenEnd: true}
+	var err error
+	if r.Start, err = strconv.ParseInt(args[0], 10, 64); err != nil {
+		return nil, fmt.Errorf("value is not an integer or out of range")
+	}
+	if len(args) > 1 {
+		if r.End, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+			return nil, fmt.Errorf("value is not an integer or out of range")
+		}
+		r.OpenEnd = false
+	}
+	if len(args) > 2 {
+		switch strings.ToUpper(args[2]) {
+		case "BYTE":
+		case "BIT":
+			r.Bits = true
+		default:
+			return nil, fmt.Errorf("syntax error")
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,125 @@
+// pkg/api/bitmap_test.go
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServer_BitmapCommands(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	steps := []struct {
+		cmd  string
+		want string
+	}{
+		{"SETBIT dau 7 1", "0"},
+		{"SETBIT dau 7 1", "1"},
+		{"SETBIT dau 12 1", "0"},
+		{"GETBIT dau 12", "1"},
+		{"GETBIT dau 100", "0"},
+		{"BITCOUNT dau", "2"},
+		{"BITCOUNT dau 1 -1", "1"},
+		{"BITCOUNT dau 0 7 BIT", "1"},
+		{"BITPOS dau 1", "7"},
+		{"BITPOS dau 1 1", "12"},
+		{"BITPOS dau 0 0 7 bit", "0"},
+		{"BITPOS missing 1", "-1"},
+		{"SET ones " + "\xff", "+OK"},
+		{"BITPOS ones 0", "8"},
+		{"BITPOS ones 0 0 -1", "-1"},
+		{"SETBIT other 15 1", "0"},
+		{"BITOP OR both dau other", "2"},
+		{"BITCOUNT both", "3"},
+		{"BITOP and both dau other", "2"},
+		{"BITCOUNT both", "0"},
+		{"BITOP NOT inv other", "2"},
+		{"BITCOUNT inv", "15"},
+		{"BITOP XOR gone missing", "0"},
+		{"EXISTS gone", "0"},
+	}
+	for _, step := range steps {
+		if r := h.sendCommand(step.cmd); r != step.want {
+			t.Errorf("%s: expected %s, got: %s", step.cmd, step.want, r)
+		}
+	}
+
+	errors := []string{
+		"SETBIT dau -1 1",
+		"SETBIT dau 4294967296 1",
+		"SETBIT dau 0 2",
+		"GETBIT dau x",
+		"BITCOUNT dau 0",
+		"BITCOUNT dau a b",
+		"BITCOUNT dau 0 1 WORD",
+		"BITPOS dau 2",
+		"BITOP NOT x dau other",
+		"BITOP NAND x dau",
+		"BITOP OR x",
+	}
+	for _, cmd := range errors {
+		if r := h.sendCommand(cmd); !strings.HasPrefix(r, "-ERR") {
+			t.Errorf("%s: expected error, got: %s", cmd, r)
+		}
+	}
+
+	h.sendCommand("SADD set m")
+	if r := h.sendCommand("SETBIT set 0 1"); !strings.Contains(r, "WRONGTYPE") {
+		t.Errorf("Expected WRONGTYPE, got: %s", r)
+	}
+	if r := h.sendCommand("BITOP OR x dau set"); !strings.Contains(r, "WRONGTYPE") {
+		t.Errorf("Expected WRONGTYPE, got: %s", r)
+	}
+}
+
+func TestServer_Bitmap_InMulti(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("MULTI")
+	c.send("SETBIT dau 3 1")
+	c.send("BITCOUNT dau")
+	replies := c.sendLines("EXEC", 2)
+	if strings.Join(replies, ",") != "0,1" {
+		t.Errorf("Expected EXEC replies [0 1], got %v", replies)
+	}
+}
+
+func TestServer_Bitmap_LineBreaks(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	// Bits 4 and 6 make the byte 0x0A, a line feed, which is quoted so that
+	// the reply stays on one line
+	c.send("SETBIT lf 4 1")
+	c.send("SETBIT lf 6 1")
+	c.send(`SET quote "\"x"`)
+	c.send("SETBIT quote 20 1")
+	c.send("SETBIT quote 22 1")
+	steps := []struct {
+		cmd  string
+		want string
+	}{
+		{"GET lf", `"\n"`},
+		{"GET quote", `"\"x\n"`},
+		{"PING", "+PONG"},
+	}
+	for _, step := range steps {
+		if r := c.send(step.cmd); r != step.want {
+			t.Errorf("%s: expected %s, got: %s", step.cmd, step.want, r)
+		}
+	}
+	if r := c.send("GETV lf"); !strings.HasSuffix(r, ` "\n"`) {
+		t.Errorf(`Expected GETV to end with "\n", got: %s`, r)
+	}
+	if replies := c.sendLines("MGET lf missing", 2); strings.Join(replies, ",") != `"\n",(nil)` {
+		t.Errorf("Expected MGET replies [\"\\n\" (nil)], got %v", replies)
+	}
+}
@@ -0,0 +1,106 @@
+// pkg/api/bloom.go
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lofoneh/kvlite/internal/engine"
+)
+
+// bloomStore is the part of dataStore used by the Bloom filter commands
+type bloomStore interface {
+	BFReserve(key string, errorRate float64, capacity int, opts engine.BloomOptions) error
+	BFAdd(key, item string) (bool, error)
+	BFMAdd(key string, items ...string) ([]bool, error)
+	BFExists(key, item string) (bool, error)
+}
+
+// executeBloomCommand runs a Bloom filter command
+func executeBloomCommand(db bloomStore, cmd string, parts []string) string {
+	switch cmd {
+	case "BF.RESERVE":
+		if len(parts) < 4 {
+			return "-ERR BF.RESERVE requires key, error rate and capacity"
+		}
+		errorRate, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil {
+			return "-ERR error rate is not a valid float"
+		}
+		capacity, err := strconv.Atoi(parts[3])
+		if err != nil {
+			return "-ERR capacity is not an integer"
+		}
+		opts, err := parseBloomOptions(parts[4:])
+		if err != nil {
+			return "-ERR " + err.Error()
+		}
+		if err := db.BFReserve(parts[1], errorRate, capacity, opts); err != nil {
+			return errReply("failed to reserve", err)
+		}
+		return "+OK"
+
+	case "BF.ADD", "BF.EXISTS":
+		if len(parts) != 3 {
+			return fmt.Sprintf("-ERR %s requires key and item", cmd)
+		}
+		var ok bool
+		var err error
+		if cmd == "BF.ADD" {
+			ok, err = db.BFAdd(parts[1], parts[2])
+		} else {
+			ok, err = db.BFExists(parts[1], parts[2])
+		}
+		if err != nil {
+			return errReply("failed to "+strings.ToLower(strings.TrimPrefix(cmd, "BF.")), err)
+		}
+		if ok {
+			return "1"
+		}
+		return "0"
+
+	case "BF.MADD":
+		if len(parts) < 3 {
+			return "-ERR BF.MADD requires key and at least one item"
+		}
+		added, err := db.BFMAdd(parts[1], parts[2:]...)
+		if err != nil {
+			return errReply("failed to add", err)
+		}
+		results := make([]string, len(added))
+		for i, ok := range added {
+			results[i] = "0"
+			if ok {
+				results[i] = "1"
+			}
+		}
+		return strings.Join(results, "\n")
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'", cmd)
+}
+
+// parseBloomOptions parses the EXPANSION and NONSCALING options of
+// BF.RESERVE
+func parseBloomOptions(args []string) (engine.BloomOptions, error) {
+	var opts engine.BloomOptions
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "EXPANSION":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("EXPANSION requires a value")
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				return opts, fmt.Errorf("EXPANSION must be a positive integer")
+			}
+			opts.Expansion = n
+			i++
+		case "NONSCALING":
+			opts.NonScaling = true
+		default:
+			return opts, fmt.Errorf("syntax error")
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,76 @@
+// pkg/api/bloom_test.go
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServer_BloomCommands(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	if r := h.sendCommand("BF.RESERVE seen 0.001 1000 EXPANSION 4"); r != "+OK" {
+		t.Errorf("Expected +OK, got: %s", r)
+	}
+	if r := h.sendCommand("BF.RESERVE seen 0.001 1000"); !strings.Contains(r, "item exists") {
+		t.Errorf("Expected item exists, got: %s", r)
+	}
+	if r := h.sendCommand("BF.ADD seen url1"); r != "1" {
+		t.Errorf("Expected 1, got: %s", r)
+	}
+	if r := h.sendCommand("BF.ADD seen url1"); r != "0" {
+		t.Errorf("Expected 0 for a known item, got: %s", r)
+	}
+	if r := h.sendCommand("BF.EXISTS seen url1"); r != "1" {
+		t.Errorf("Expected 1, got: %s", r)
+	}
+	if r := h.sendCommand("BF.EXISTS seen url2"); r != "0" {
+		t.Errorf("Expected 0, got: %s", r)
+	}
+	if r := h.sendCommand("BF.ADD auto x"); r != "1" {
+		t.Errorf("Expected BF.ADD to create the filter, got: %s", r)
+	}
+
+	h.sendCommand("BF.RESERVE small 0.01 1 NONSCALING")
+	h.sendCommand("BF.ADD small a")
+	if r := h.sendCommand("BF.ADD small b"); !strings.Contains(r, "non scaling filter is full") {
+		t.Errorf("Expected a full filter error, got: %s", r)
+	}
+
+	errors := []string{
+		"BF.RESERVE f 0 100",
+		"BF.RESERVE f 1.5 100",
+		"BF.RESERVE f abc 100",
+		"BF.RESERVE f 0.01 -5",
+		"BF.RESERVE f 0.01 100 EXPANSION 0",
+		"BF.RESERVE f 0.01 100 BOGUS",
+		"BF.ADD seen",
+		"BF.EXISTS seen",
+		"BF.MADD seen",
+	}
+	for _, cmd := range errors {
+		if r := h.sendCommand(cmd); !strings.HasPrefix(r, "-ERR") {
+			t.Errorf("%s: expected error, got: %s", cmd, r)
+		}
+	}
+
+	h.sendCommand("SET str value")
+	if r := h.sendCommand("BF.ADD str x"); !strings.Contains(r, "WRONGTYPE") {
+		t.Errorf("Expected WRONGTYPE, got: %s", r)
+	}
+}
+
+func TestServer_BloomMultiline(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("BF.ADD bf a")
+	got := c.sendLines("BF.MADD bf a b c", 3)
+	if strings.Join(got, ",") != "0,1,1" {
+		t.Errorf("Expected [0 1 1], got %v", got)
+	}
+}
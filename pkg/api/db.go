@@ -0,0 +1,118 @@
+// pkg/api/db.go
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dbStore is the part of dataStore used by the logical database commands
+type dbStore interface {
+	ClearAll() error
+	Move(key string, db int) (bool, error)
+	SwapDB(db1, db2 int) error
+}
+
+// executeDBCommand runs FLUSHDB, FLUSHALL, MOVE or SWAPDB. CLEAR is an
+// alias of FLUSHALL.
+func (s *Server) executeDBCommand(db dataStore, cmd string, parts []string) string {
+	switch cmd {
+	case "FLUSHDB":
+		if err := db.Clear(); err != nil {
+			return errReply("failed to clear", err)
+		}
+		return "+OK"
+
+	case "FLUSHALL", "CLEAR":
+		if err := db.ClearAll(); err != nil {
+			return errReply("failed to clear", err)
+		}
+		return "+OK"
+
+	case "MOVE":
+		if len(parts) != 3 {
+			return "-ERR MOVE requires key and db"
+		}
+		n, err := parseDBIndex(parts[2])
+		if err != nil {
+			return "-ERR " + err.Error()
+		}
+		moved, err := db.Move(parts[1], n)
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		if !moved {
+			return "0"
+		}
+		s.waiters.notify(parts[1])
+		return "1"
+
+	case "SWAPDB":
+		if len(parts) != 3 {
+			return "-ERR SWAPDB requires two db indexes"
+		}
+		n1, err := parseDBIndex(parts[1])
+		if err != nil {
+			return "-ERR " + err.Error()
+		}
+		n2, err := parseDBIndex(parts[2])
+		if err != nil {
+			return "-ERR " + err.Error()
+		}
+		if err := db.SwapDB(n1, n2); err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		// Any key may have gained data
+		s.waiters.notifyAll()
+		return "+OK"
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'", cmd)
+}
+
+// selectDB runs SELECT, switching the connection to another database
+func (s *Server) selectDB(sess *session, parts []string) string {
+	if len(parts) != 2 {
+		return "-ERR SELECT requires db"
+	}
+	n, err := parseDBIndex(parts[1])
+	if err != nil {
+		return "-ERR " + err.Error()
+	}
+	db, err := s.engine.DB(n)
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	sess.db = db
+	return "+OK"
+}
+
+// parseDBIndex parses a database number
+func parseDBIndex(arg string) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, fmt.Errorf("invalid DB index")
+	}
+	return n, nil
+}
+
+// formatDBSizes formats the key count of each database that has keys, for
+// INFO: "db0=3 db2=1"
+func formatDBSizes(sizes []int) string {
+	var fields []string
+	for n, size := range sizes {
+		if size > 0 {
+			fields = append(fields, "db"+strconv.Itoa(n)+"="+strconv.Itoa(size))
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// keyCount returns the number of keys in all databases
+func (s *Server) keyCount() int {
+	n := 0
+	for _, size := range s.engine.DBSizes() {
+		n += size
+	}
+	return n
+}
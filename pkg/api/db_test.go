@@ -0,0 +1,152 @@
+// pkg/api/db_test.go
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServer_SELECT(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("SET k zero")
+	if r := c.send("SELECT 1"); r != "+OK" {
+		t.Fatalf("SELECT failed: %s", r)
+	}
+	if r := c.send("GET k"); r != "-ERR key not found" {
+		t.Errorf("Key of db 0 visible in db 1: %s", r)
+	}
+	c.send("SET k one")
+
+	// Other connections start on database 0
+	if r := h.sendCommand("GET k"); r != "zero" {
+		t.Errorf("Expected zero on a new connection, got %s", r)
+	}
+
+	for _, cmd := range []string{"SELECT 16", "SELECT -1", "SELECT x", "SELECT"} {
+		if r := c.send(cmd); !strings.HasPrefix(r, "-ERR") {
+			t.Errorf("%s: expected error, got %s", cmd, r)
+		}
+	}
+	if r := c.send("GET k"); r != "one" {
+		t.Errorf("Failed SELECT changed the database: %s", r)
+	}
+}
+
+func TestServer_SELECT_MULTI(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("SELECT 2")
+	c.send("SET w 1")
+	c.send("WATCH w")
+	c.send("SELECT 0")
+
+	// WATCH is tied to the database the key was watched in
+	h.sendCommand("SET w 2")
+
+	c.send("MULTI")
+	c.send("SET a 0")
+	c.send("SELECT 3")
+	c.send("SET a 3")
+	replies := c.sendLines("EXEC", 3)
+	if strings.Join(replies, ",") != "+OK,+OK,+OK" {
+		t.Fatalf("Unexpected EXEC replies: %v", replies)
+	}
+
+	// The connection stays on the database selected in MULTI
+	if r := c.send("GET a"); r != "3" {
+		t.Errorf("Expected 3 in db 3, got %s", r)
+	}
+	if r := h.sendCommand("GET a"); r != "0" {
+		t.Errorf("Expected 0 in db 0, got %s", r)
+	}
+
+	// A change in the watched database aborts EXEC
+	c.send("SELECT 2")
+	c.send("WATCH w")
+	o := h.dial()
+	defer o.close()
+	o.send("SELECT 2")
+	o.send("SET w 3")
+	c.send("MULTI")
+	c.send("SET a 2")
+	if r := c.send("EXEC"); r != "(nil)" {
+		t.Errorf("Expected aborted EXEC, got %s", r)
+	}
+}
+
+func TestServer_MOVE_SWAPDB(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("SET k v")
+	if r := c.send("MOVE k 1"); r != "1" {
+		t.Errorf("Expected 1, got %s", r)
+	}
+	if r := c.send("MOVE k 1"); r != "0" {
+		t.Errorf("Expected 0 for a missing key, got %s", r)
+	}
+	if r := c.send("MOVE k 0"); !strings.HasPrefix(r, "-ERR") {
+		t.Errorf("Expected error for the same db, got %s", r)
+	}
+	c.send("SELECT 1")
+	if r := c.send("GET k"); r != "v" {
+		t.Errorf("Expected moved key in db 1, got %s", r)
+	}
+
+	if r := c.send("SWAPDB 0 1"); r != "+OK" {
+		t.Fatalf("SWAPDB failed: %s", r)
+	}
+	if r := c.send("EXISTS k"); r != "0" {
+		t.Errorf("Expected db 1 to be empty after swap, got %s", r)
+	}
+	if r := h.sendCommand("GET k"); r != "v" {
+		t.Errorf("Expected k in db 0 after swap, got %s", r)
+	}
+	if r := c.send("SWAPDB 0 99"); !strings.HasPrefix(r, "-ERR") {
+		t.Errorf("Expected error for a bad index, got %s", r)
+	}
+}
+
+func TestServer_FLUSHDB_FLUSHALL(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("SET a 1")
+	c.send("SELECT 1")
+	c.send("SET b 1")
+	c.send("SET c 1")
+
+	if r := h.sendCommand("INFO"); !strings.Contains(r, "keys=3 ") || !strings.HasSuffix(r, " db0=1 db1=2") {
+		t.Errorf("Unexpected INFO: %s", r)
+	}
+
+	if r := c.send("FLUSHDB"); r != "+OK" {
+		t.Fatalf("FLUSHDB failed: %s", r)
+	}
+	if r := h.sendCommand("GET a"); r != "1" {
+		t.Errorf("FLUSHDB cleared another database: %s", r)
+	}
+
+	c.send("SET b 1")
+	if r := c.send("FLUSHALL"); r != "+OK" {
+		t.Fatalf("FLUSHALL failed: %s", r)
+	}
+	if r := h.sendCommand("INFO"); !strings.Contains(r, "keys=0 ") || strings.Contains(r, "db0=") {
+		t.Errorf("Unexpected INFO after FLUSHALL: %s", r)
+	}
+}
@@ -0,0 +1,138 @@
+// pkg/api/expire.go
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lofoneh/kvlite/internal/engine"
+)
+
+// expireStore is the part of dataStore used by the expiration commands
+type expireStore interface {
+	ExpireAt(key string, at time.Time, cond engine.ExpireCondition) (bool, error)
+	ExpireTime(key string) (time.Time, bool)
+}
+
+// executeExpireCommand runs the commands that set or read expirations:
+//
+//	EXPIRE key seconds [NX|XX|GT|LT]     PEXPIRE key milliseconds [...]
+//	EXPIREAT key unix-seconds [...]      PEXPIREAT key unix-milliseconds [...]
+//	TTL key / PTTL key                   EXPIRETIME key / PEXPIRETIME key
+//
+// Expirations are stored as absolute times, so relative ones are resolved
+// when the command runs.
+func executeExpireCommand(db dataStore, cmd string, parts []string) string {
+	switch cmd {
+	case "EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT":
+		unit := "seconds"
+		if cmd[0] == 'P' {
+			unit = "milliseconds"
+		}
+		if len(parts) < 3 {
+			return fmt.Sprintf("-ERR %s requires key and %s", cmd, unit)
+		}
+		n, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			return "-ERR invalid TTL"
+		}
+		cond, err := parseExpireCondition(parts[3:])
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+
+		var at time.Time
+		switch cmd {
+		case "EXPIRE", "PEXPIRE":
+			unit := time.Second
+			if cmd == "PEXPIRE" {
+				unit = time.Millisecond
+			}
+			ttl, err := parseTTL(n, unit)
+			if err != nil {
+				return fmt.Sprintf("-ERR %v", err)
+			}
+			at = time.Now().Add(ttl)
+		case "EXPIREAT":
+			if n > maxExpiry.Unix() {
+				return "-ERR invalid TTL"
+			}
+			at = time.Unix(n, 0)
+		case "PEXPIREAT":
+			at = time.UnixMilli(n)
+		}
+		if at.After(maxExpiry) {
+			return "-ERR invalid TTL"
+		}
+
+		ok, err := db.ExpireAt(parts[1], at, cond)
+		if err != nil {
+			return errReply("failed to set expiration", err)
+		}
+		if ok {
+			return "1"
+		}
+		return "0"
+
+	case "TTL", "PTTL":
+		if len(parts) < 2 {
+			return fmt.Sprintf("-ERR %s requires key", cmd)
+		}
+		at, ok := db.ExpireTime(parts[1])
+		switch {
+		case !ok:
+			return "-2" // Key doesn't exist
+		case at.IsZero():
+			return "-1" // No TTL
+		}
+		ms := time.Until(at).Milliseconds()
+		if ms < 0 {
+			ms = 0
+		}
+		if cmd == "PTTL" {
+			return strconv.FormatInt(ms, 10)
+		}
+		// Rounded to the nearest second, so a fresh EXPIRE 100 reads 100
+		return strconv.FormatInt((ms+500)/1000, 10)
+
+	case "EXPIRETIME", "PEXPIRETIME":
+		if len(parts) < 2 {
+			return fmt.Sprintf("-ERR %s requires key", cmd)
+		}
+		at, ok := db.ExpireTime(parts[1])
+		switch {
+		case !ok:
+			return "-2"
+		case at.IsZero():
+			return "-1"
+		case cmd == "PEXPIRETIME":
+			return strconv.FormatInt(at.UnixMilli(), 10)
+		}
+		return strconv.FormatInt(at.Unix(), 10)
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'", cmd)
+}
+
+// parseExpireCondition parses the optional NX, XX, GT or LT flag of the
+// EXPIRE commands
+func parseExpireCondition(opts []string) (engine.ExpireCondition, error) {
+	if len(opts) == 0 {
+		return engine.ExpireAlways, nil
+	}
+	if len(opts) > 1 {
+		return 0, fmt.Errorf("NX, XX, GT and LT options at the same time are not compatible")
+	}
+	switch strings.ToUpper(opts[0]) {
+	case "NX":
+		return engine.ExpireIfNone, nil
+	case "XX":
+		return engine.ExpireIfSet, nil
+	case "GT":
+		return engine.ExpireIfGreater, nil
+	case "LT":
+		return engine.ExpireIfLess, nil
+	}
+	return 0, fmt.Errorf("unsupported option '%s'", opts[0])
+}
@@ -0,0 +1,169 @@
+// pkg/api/expire_test.go
+package api
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_PSETEX_PTTL(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	if r := h.sendCommand("PSETEX k 1500 v"); r != "+OK" {
+		t.Fatalf("PSETEX failed: %s", r)
+	}
+	ms, err := strconv.Atoi(h.sendCommand("PTTL k"))
+	if err != nil || ms <= 1000 || ms > 1500 {
+		t.Errorf("Expected a PTTL between 1000 and 1500, got %d (%v)", ms, err)
+	}
+	// TTL rounds to the nearest second
+	if r := h.sendCommand("TTL k"); r != "1" && r != "2" {
+		t.Errorf("Expected TTL 1 or 2, got %s", r)
+	}
+
+	if r := h.sendCommand("PTTL missing"); r != "-2" {
+		t.Errorf("Expected -2, got %s", r)
+	}
+	h.sendCommand("SET p v")
+	if r := h.sendCommand("PTTL p"); r != "-1" {
+		t.Errorf("Expected -1, got %s", r)
+	}
+
+	// Sub-second expirations
+	h.sendCommand("PSETEX short 50 v")
+	time.Sleep(100 * time.Millisecond)
+	if r := h.sendCommand("EXISTS short"); r != "0" {
+		t.Errorf("Expected the key to have expired, got %s", r)
+	}
+	if r := h.sendCommand("PSETEX k 0 v"); r != "-ERR invalid TTL" {
+		t.Errorf("Expected invalid TTL, got %s", r)
+	}
+}
+
+func TestServer_ExpireOverflow(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	// Expirations past what a key can store are rejected rather than
+	// overflowing into the past
+	h.sendCommand("SET k v")
+	for _, cmd := range []string{
+		"SETEX k 99999999999 v",
+		"PSETEX k 9223372036854775807 v",
+		"EXPIRE k 99999999999",
+		"PEXPIRE k 9223372036854775807",
+		"EXPIREAT k 99999999999",
+		"PEXPIREAT k 9223372036854775807",
+	} {
+		if r := h.sendCommand(cmd); r != "-ERR invalid TTL" {
+			t.Errorf("Expected invalid TTL for %q, got %s", cmd, r)
+		}
+	}
+	if r := h.sendCommand("GET k"); r != "v" {
+		t.Errorf("Expected the key to be left alone, got %s", r)
+	}
+	if r := h.sendCommand("TTL k"); r != "-1" {
+		t.Errorf("Expected no TTL, got %s", r)
+	}
+
+	if r := h.sendCommand("SETEX k 3153600000 v"); r != "+OK" {
+		t.Errorf("Expected a TTL of a century to be accepted, got %s", r)
+	}
+	if r := h.sendCommand("EXISTS k"); r != "1" {
+		t.Errorf("Expected the key not to expire at once, got %s", r)
+	}
+}
+
+func TestServer_EXPIREAT(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	h.sendCommand("SET k v")
+	at := time.Now().Add(time.Hour).Unix()
+	if r := h.sendCommand("EXPIREAT k " + strconv.FormatInt(at, 10)); r != "1" {
+		t.Fatalf("EXPIREAT failed: %s", r)
+	}
+	if r := h.sendCommand("EXPIRETIME k"); r != strconv.FormatInt(at, 10) {
+		t.Errorf("Expected EXPIRETIME %d, got %s", at, r)
+	}
+	if r := h.sendCommand("PEXPIRETIME k"); r != strconv.FormatInt(at*1000, 10) {
+		t.Errorf("Expected PEXPIRETIME %d, got %s", at*1000, r)
+	}
+
+	atMs := time.Now().Add(time.Minute).UnixMilli()
+	if r := h.sendCommand("PEXPIREAT k " + strconv.FormatInt(atMs, 10)); r != "1" {
+		t.Fatalf("PEXPIREAT failed: %s", r)
+	}
+	if r := h.sendCommand("PEXPIRETIME k"); r != strconv.FormatInt(atMs, 10) {
+		t.Errorf("Expected PEXPIRETIME %d, got %s", atMs, r)
+	}
+
+	// A time in the past deletes the key
+	if r := h.sendCommand("EXPIREAT k 1"); r != "1" {
+		t.Errorf("Expected 1, got %s", r)
+	}
+	if r := h.sendCommand("EXPIRETIME k"); r != "-2" {
+		t.Errorf("Expected the key to be deleted, got %s", r)
+	}
+	h.sendCommand("SET p v")
+	if r := h.sendCommand("EXPIRETIME p"); r != "-1" {
+		t.Errorf("Expected -1, got %s", r)
+	}
+}
+
+func TestServer_EXPIRE_Flags(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	h.sendCommand("SET k v")
+	steps := []struct {
+		cmd, want string
+	}{
+		{"EXPIRE k 100 XX", "0"},
+		{"EXPIRE k 100 GT", "0"},
+		{"EXPIRE k 100 NX", "1"},
+		{"EXPIRE k 200 NX", "0"},
+		{"EXPIRE k 50 GT", "0"},
+		{"EXPIRE k 200 GT", "1"},
+		{"EXPIRE k 300 LT", "0"},
+		{"PEXPIRE k 150000 LT", "1"},
+		{"EXPIRE k 120 XX", "1"},
+		{"TTL k", "120"},
+	}
+	for _, s := range steps {
+		if r := h.sendCommand(s.cmd); r != s.want {
+			t.Errorf("%s: expected %s, got %s", s.cmd, s.want, r)
+		}
+	}
+
+	h.sendCommand("SET p v")
+	if r := h.sendCommand("EXPIRE p 100 LT"); r != "1" {
+		t.Errorf("Expected LT to apply to a key without TTL, got %s", r)
+	}
+
+	for _, cmd := range []string{"EXPIRE k 10 NX XX", "EXPIRE k 10 FOO", "EXPIRE k x", "PEXPIRE k 0", "EXPIREAT k", "PTTL"} {
+		if r := h.sendCommand(cmd); !strings.HasPrefix(r, "-ERR") {
+			t.Errorf("%s: expected error, got %s", cmd, r)
+		}
+	}
+}
+
+func TestServer_EXPIRE_MULTI(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("SET k v")
+	c.send("MULTI")
+	c.send("PEXPIRE k 60000 NX")
+	c.send("PTTL k")
+	replies := c.sendLines("EXEC", 2)
+	if replies[0] != "1" || strings.HasPrefix(replies[1], "-") {
+		t.Errorf("Unexpected EXEC replies: %v", replies)
+	}
+}
@@ -0,0 +1,273 @@
+// pkg/api/extension.go
+package api
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lofoneh/kvlite/internal/engine"
+)
+
+// serverCommands are the built-in commands that aren't listed in
+// transactionalCommands, pubsubCommands, blockingCommands or
+// scriptCommands. Extensions can't use their names.
+var serverCommands = map[string]bool{
+	"MULTI":       true,
+	"EXEC":        true,
+	"DISCARD":     true,
+	"WATCH":       true,
+	"UNWATCH":     true,
+	"QUOTA":       true,
+	"QUIT":        true,
+	"PUBSUB":      true,
+	"STATS":       true,
+	"INFO":        true,
+	"HEALTH":      true,
+	"CONFIG":      true,
+	"COMPACT":     true,
+	"SYNC":        true,
+	"ANALYZE":     true,
+	"ANOMALIES":   true,
+	"HOTKEYS":     true,
+	"SUGGEST-TTL": true,
+}
+
+// CommandSpec describes the arguments of a command added with
+// RegisterCommand
+type CommandSpec struct {
+	Usage   string // Arguments shown when the count is wrong, e.g. "key limit window"
+	MinArgs int    // Minimum number of arguments, not counting the command name
+	MaxArgs int    // Maximum number of arguments, -1 for no limit
+}
+
+// CommandHandler runs a command added with RegisterCommand. It returns the
+// reply, which may be an error reply such as "-BUSY lock is held", or an
+// error that is replied as "-ERR <error>".
+type CommandHandler func(tx Tx, args Args) (string, error)
+
+// Tx is the handle of the database a registered command runs on. The
+// handler has exclusive access to the engine while it runs, so its reads
+// and writes are atomic; the writes are logged as one WAL batch, and like
+// those of EXEC they are kept if the handler fails halfway.
+type Tx interface {
+	// Get returns the string value of a key
+	Get(key string) (string, bool)
+	// Set stores a string value and clears any TTL
+	Set(key, value string) error
+	// SetWithTTL stores a string value that expires after ttl
+	SetWithTTL(key, value string, ttl time.Duration) error
+	// Delete removes a key of any type
+	Delete(key string) (bool, error)
+	// Exists reports whether a key exists, whatever its type
+	Exists(key string) bool
+	// Expire sets the TTL of an existing key
+	Expire(key string, ttl time.Duration) bool
+	// Persist removes the TTL of a key
+	Persist(key string) bool
+	// TTL returns the remaining time to live, 0 if the key doesn't exist
+	// or doesn't expire
+	TTL(key string) time.Duration
+	// IncrBy adds delta to an integer value, a missing key counting as 0
+	IncrBy(key string, delta int64) (int64, error)
+	// IncrByFloat adds delta to a float value, a missing key counting as 0
+	IncrByFloat(key string, delta float64) (float64, error)
+	// HGet returns a field of a hash
+	HGet(key, field string) (string, bool, error)
+	// HSet sets fields of a hash and returns how many were added
+	HSet(key string, fields map[string]string) (int, error)
+	// HIncrBy adds delta to an integer field of a hash
+	HIncrBy(key, field string, delta int64) (int64, error)
+	// Do runs any command a script could run with kv.call, in the same
+	// transaction, and returns its reply
+	Do(cmd string, args ...string) string
+}
+
+// commandTx is the Tx given to handlers
+type commandTx struct {
+	dataStore
+	s *Server
+}
+
+// Do implements Tx
+func (tx commandTx) Do(cmd string, args ...string) string {
+	cmd = strings.ToUpper(cmd)
+	if !tx.s.callable(cmd) {
+		return fmt.Sprintf("-ERR command '%s' cannot be used in extensions", cmd)
+	}
+	return tx.s.executeCommand(tx.dataStore, cmd, append([]string{cmd}, args...))
+}
+
+// Args are the arguments of a registered command, without the command name
+type Args []string
+
+// Int parses argument i as an integer
+func (a Args) Int(i int) (int64, error) {
+	if i >= len(a) {
+		return 0, fmt.Errorf("missing argument %d", i+1)
+	}
+	n, err := strconv.ParseInt(a[i], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("value is not an integer or out of range")
+	}
+	return n, nil
+}
+
+// Float parses argument i as a float
+func (a Args) Float(i int) (float64, error) {
+	if i >= len(a) {
+		return 0, fmt.Errorf("missing argument %d", i+1)
+	}
+	f, err := strconv.ParseFloat(a[i], 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, fmt.Errorf("value is not a valid float")
+	}
+	return f, nil
+}
+
+// Seconds parses argument i as a positive number of seconds
+func (a Args) Seconds(i int) (time.Duration, error) {
+	n, err := a.Int(i)
+	if err != nil {
+		return 0, fmt.Errorf("invalid TTL")
+	}
+	return parseTTL(n, time.Second)
+}
+
+// Rest joins the arguments from i on with spaces, the way SET reads values
+func (a Args) Rest(i int) string {
+	if i >= len(a) {
+		return ""
+	}
+	return strings.Join(a[i:], " ")
+}
+
+// Flag reports whether one of the arguments is name, ignoring case
+func (a Args) Flag(name string) bool {
+	for _, arg := range a {
+		if strings.EqualFold(arg, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// extension is a command added with RegisterCommand
+type extension struct {
+	spec    CommandSpec
+	handler CommandHandler
+}
+
+// extensionRegistry holds the commands added with RegisterCommand by name
+type extensionRegistry struct {
+	mu       sync.RWMutex
+	commands map[string]*extension
+}
+
+func newExtensionRegistry() *extensionRegistry {
+	return &extensionRegistry{commands: make(map[string]*extension)}
+}
+
+// get returns a registered command, nil if there is none
+func (r *extensionRegistry) get(name string) *extension {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.commands[name]
+}
+
+// RegisterCommand adds a command to the server, so that embedders can add
+// domain commands without changing the server. Names are case insensitive
+// and can't be those of built-in commands or contain spaces. Commands may
+// be registered while the server runs.
+//
+// The handler runs with exclusive access to the engine, on the database
+// selected by the connection. Registered commands may be queued by MULTI,
+// in which case they run in the transaction of EXEC, and called by scripts
+// with kv.call.
+func (s *Server) RegisterCommand(name string, spec CommandSpec, handler CommandHandler) error {
+	name = strings.ToUpper(name)
+	switch {
+	case name == "":
+		return fmt.Errorf("command name is empty")
+	case strings.ContainsAny(name, " \t\r\n\""):
+		return fmt.Errorf("command name %q contains spaces or quotes", name)
+	case handler == nil:
+		return fmt.Errorf("command %s has no handler", name)
+	case spec.MinArgs < 0 || (spec.MaxArgs >= 0 && spec.MaxArgs < spec.MinArgs):
+		return fmt.Errorf("command %s has an invalid argument range", name)
+	case builtinCommand(name):
+		return fmt.Errorf("command %s is a built-in command", name)
+	}
+
+	s.extensions.mu.Lock()
+	defer s.extensions.mu.Unlock()
+	if _, ok := s.extensions.commands[name]; ok {
+		return fmt.Errorf("command %s is already registered", name)
+	}
+	s.extensions.commands[name] = &extension{spec: spec, handler: handler}
+	return nil
+}
+
+// builtinCommand reports whether name is the name of a built-in command
+func builtinCommand(name string) bool {
+	return transactionalCommands[name] || pubsubCommands[name] || blockingCommands[name] ||
+		scriptCommands[name] || serverCommands[name]
+}
+
+// transactional reports whether cmd may be queued by MULTI
+func (s *Server) transactional(cmd string) bool {
+	return transactionalCommands[cmd] || s.extensions.get(cmd) != nil
+}
+
+// callable reports whether scripts and registered commands may run cmd:
+// the commands MULTI may queue, apart from SELECT and the scripting
+// commands
+func (s *Server) callable(cmd string) bool {
+	return s.transactional(cmd) && cmd != "SELECT" && !scriptCommands[cmd]
+}
+
+// runExtension runs a registered command, in a transaction of its own
+// unless db is already one
+func (s *Server) runExtension(db dataStore, cmd string, ext *extension, parts []string) string {
+	args := Args(parts[1:])
+	if len(args) < ext.spec.MinArgs || (ext.spec.MaxArgs >= 0 && len(args) > ext.spec.MaxArgs) {
+		if ext.spec.Usage == "" {
+			return fmt.Sprintf("-ERR wrong number of arguments for '%s'", cmd)
+		}
+		return fmt.Sprintf("-ERR wrong number of arguments for '%s', usage: %s %s", cmd, cmd, ext.spec.Usage)
+	}
+
+	if eng, ok := db.(*engine.Engine); ok {
+		var reply string
+		err := eng.Atomic(func(tx *engine.Tx) error {
+			reply = s.callExtension(tx, cmd, ext, args)
+			return nil
+		})
+		if err != nil {
+			return errReply(fmt.Sprintf("%s failed", cmd), err)
+		}
+		return reply
+	}
+	return s.callExtension(db, cmd, ext, args)
+}
+
+// callExtension calls the handler of a registered command and converts its
+// result to a reply. A panicking handler fails the command, not the server.
+func (s *Server) callExtension(db dataStore, cmd string, ext *extension, args Args) (reply string) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Command %s panicked: %v", cmd, r)
+			reply = fmt.Sprintf("-ERR command '%s' failed", cmd)
+		}
+	}()
+
+	reply, err := ext.handler(commandTx{dataStore: db, s: s}, args)
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	return reply
+}
@@ -0,0 +1,278 @@
+// pkg/api/extension_test.go
+package api
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// registerTestCommands adds a fixed window rate limiter and a lock to the
+// server of h
+func registerTestCommands(t *testing.T, h *testHelper) {
+	t.Helper()
+
+	// RATELIMIT key limit window: 1 if the call is allowed, 0 otherwise
+	err := h.server.RegisterCommand("ratelimit", CommandSpec{Usage: "key limit window", MinArgs: 3, MaxArgs: 3},
+		func(tx Tx, args Args) (string, error) {
+			limit, err := args.Int(1)
+			if err != nil {
+				return "", err
+			}
+			window, err := args.Seconds(2)
+			if err != nil {
+				return "", err
+			}
+			n, err := tx.IncrBy(args[0], 1)
+			if err != nil {
+				return "", err
+			}
+			if n == 1 {
+				tx.Expire(args[0], window)
+			}
+			if n > limit {
+				return "0", nil
+			}
+			return "1", nil
+		})
+	if err != nil {
+		t.Fatalf("RegisterCommand failed: %v", err)
+	}
+
+	// LOCK.ACQUIRE name owner ttl
+	err = h.server.RegisterCommand("LOCK.ACQUIRE", CommandSpec{Usage: "name owner ttl", MinArgs: 3, MaxArgs: 3},
+		func(tx Tx, args Args) (string, error) {
+			ttl, err := args.Seconds(2)
+			if err != nil {
+				return "", err
+			}
+			if owner, ok := tx.Get(args[0]); ok && owner != args[1] {
+				return "-BUSY lock is held by " + owner, nil
+			}
+			if err := tx.SetWithTTL(args[0], args[1], ttl); err != nil {
+				return "", err
+			}
+			return "+OK", nil
+		})
+	if err != nil {
+		t.Fatalf("RegisterCommand failed: %v", err)
+	}
+}
+
+func TestServer_RegisterCommand(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+	registerTestCommands(t, h)
+
+	c := h.dial()
+	defer c.close()
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"RATELIMIT api:alice 2 60", "1"},
+		{"ratelimit api:alice 2 60", "1"},
+		{"RATELIMIT api:alice 2 60", "0"},
+		{"RATELIMIT api:bob 2 60", "1"},
+		{"RATELIMIT api:bob x 60", "-ERR value is not an integer or out of range"},
+		{"RATELIMIT api:bob 2 0", "-ERR invalid TTL"},
+		{"RATELIMIT api:bob 2 9223372036", "-ERR invalid TTL"},
+		{"RATELIMIT api:bob 2", "-ERR wrong number of arguments for 'RATELIMIT', usage: RATELIMIT key limit window"},
+		{"LOCK.ACQUIRE jobs worker-1 30", "+OK"},
+		{"LOCK.ACQUIRE jobs worker-1 30", "+OK"},
+		{"LOCK.ACQUIRE jobs worker-2 30", "-BUSY lock is held by worker-1"},
+		{"GET jobs", "worker-1"},
+	}
+	for _, tt := range tests {
+		if got := c.send(tt.cmd); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.cmd, tt.want, got)
+		}
+	}
+	if ttl, _ := strconv.Atoi(c.send("TTL api:alice")); ttl <= 0 || ttl > 60 {
+		t.Errorf("Expected the window to expire within 60s, got %d", ttl)
+	}
+}
+
+func TestServer_RegisterCommandErrors(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+	registerTestCommands(t, h)
+
+	handler := func(tx Tx, args Args) (string, error) { return "+OK", nil }
+	tests := []struct {
+		name    string
+		spec    CommandSpec
+		handler CommandHandler
+	}{
+		{"", CommandSpec{MaxArgs: -1}, handler},
+		{"MY CMD", CommandSpec{MaxArgs: -1}, handler},
+		{"NOHANDLER", CommandSpec{MaxArgs: -1}, nil},
+		{"RANGE", CommandSpec{MinArgs: 2, MaxArgs: 1}, handler},
+		{"set", CommandSpec{MaxArgs: -1}, handler},
+		{"EXEC", CommandSpec{MaxArgs: -1}, handler},
+		{"BLPOP", CommandSpec{MaxArgs: -1}, handler},
+		{"EVAL", CommandSpec{MaxArgs: -1}, handler},
+		{"Lock.Acquire", CommandSpec{MaxArgs: -1}, handler},
+	}
+	for _, tt := range tests {
+		if err := h.server.RegisterCommand(tt.name, tt.spec, tt.handler); err == nil {
+			t.Errorf("Expected registering %q to fail", tt.name)
+		}
+	}
+}
+
+func TestServer_RegisterCommandReplies(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	commands := map[string]CommandHandler{
+		"FAIL": func(tx Tx, args Args) (string, error) {
+			return "", errors.New("domain failure")
+		},
+		"PANIC": func(tx Tx, args Args) (string, error) {
+			panic("boom")
+		},
+		"ECHO.ALL": func(tx Tx, args Args) (string, error) {
+			if args.Flag("upper") {
+				return strings.ToUpper(args.Rest(1)), nil
+			}
+			return args.Rest(0), nil
+		},
+		// Do runs built-in commands in the same transaction
+		"PUSH.COUNT": func(tx Tx, args Args) (string, error) {
+			if reply := tx.Do("rpush", args...); strings.HasPrefix(reply, "-") {
+				return reply, nil
+			}
+			return tx.Do("LLEN", args[0]), nil
+		},
+		"NESTED": func(tx Tx, args Args) (string, error) {
+			return tx.Do("EVAL", "return 1", "0"), nil
+		},
+	}
+	for name, handler := range commands {
+		if err := h.server.RegisterCommand(name, CommandSpec{MaxArgs: -1}, handler); err != nil {
+			t.Fatalf("RegisterCommand(%s) failed: %v", name, err)
+		}
+	}
+
+	c := h.dial()
+	defer c.close()
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"FAIL", "-ERR domain failure"},
+		{"PANIC", "-ERR command 'PANIC' failed"},
+		{"ECHO.ALL hello  world", "hello world"},
+		{"ECHO.ALL UPPER hello world", "HELLO WORLD"},
+		{"PUSH.COUNT list a b", "2"},
+		{"PUSH.COUNT list c", "3"},
+		{"NESTED", "-ERR command 'EVAL' cannot be used in extensions"},
+		{"PING", "+PONG"},
+	}
+	for _, tt := range tests {
+		if got := c.send(tt.cmd); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.cmd, tt.want, got)
+		}
+	}
+}
+
+func TestServer_RegisterCommandInMultiAndScripts(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+	registerTestCommands(t, h)
+
+	c := h.dial()
+	defer c.close()
+	c.send("MULTI")
+	if got := c.send("RATELIMIT k 1 60"); got != "+QUEUED" {
+		t.Fatalf("Expected RATELIMIT to be queued, got %q", got)
+	}
+	c.send("RATELIMIT k 1 60")
+	if got := c.sendLines("EXEC", 2); got[0] != "1" || got[1] != "0" {
+		t.Errorf("Unexpected EXEC replies: %v", got)
+	}
+
+	// Commands that aren't registered still abort the transaction
+	c.send("MULTI")
+	if got := c.send("NOTREGISTERED x"); !strings.HasPrefix(got, "-ERR command 'NOTREGISTERED' cannot be used in MULTI") {
+		t.Errorf("Expected an unknown command to be rejected, got %q", got)
+	}
+	c.send("EXEC")
+
+	got := c.send(`EVAL "return kv.call('LOCK.ACQUIRE', KEYS[1], 'script', 10)" 1 lock`)
+	if got != "+OK" {
+		t.Errorf("Expected scripts to call registered commands, got %q", got)
+	}
+	if got := c.send("LOCK.ACQUIRE lock other 10"); got != "-BUSY lock is held by script" {
+		t.Errorf("Unexpected reply %q", got)
+	}
+}
+
+func TestServer_RegisterCommandAtomic(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	// A read-modify-write that would lose updates if handlers interleaved
+	err := h.server.RegisterCommand("SLOWINCR", CommandSpec{MinArgs: 1, MaxArgs: 1}, func(tx Tx, args Args) (string, error) {
+		v, _ := tx.Get(args[0])
+		n, _ := strconv.Atoi(v)
+		time.Sleep(time.Microsecond)
+		return "+OK", tx.Set(args[0], strconv.Itoa(n+1))
+	})
+	if err != nil {
+		t.Fatalf("RegisterCommand failed: %v", err)
+	}
+
+	const clients, runs = 8, 25
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := h.dial()
+			defer c.close()
+			for j := 0; j < runs; j++ {
+				c.send("SLOWINCR counter")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := h.sendCommand("GET counter"); got != strconv.Itoa(clients*runs) {
+		t.Errorf("Expected %d, got %s", clients*runs, got)
+	}
+}
+
+func TestArgs(t *testing.T) {
+	args := Args{"42", "1.5", "abc", "NX", "10"}
+
+	if n, err := args.Int(0); err != nil || n != 42 {
+		t.Errorf("Int(0) = %d, %v", n, err)
+	}
+	if _, err := args.Int(2); err == nil {
+		t.Error("Expected Int(2) to fail")
+	}
+	if _, err := args.Int(9); err == nil || err.Error() != "missing argument 10" {
+		t.Errorf("Expected a missing argument, got %v", err)
+	}
+	if f, err := args.Float(1); err != nil || f != 1.5 {
+		t.Errorf("Float(1) = %v, %v", f, err)
+	}
+	if d, err := args.Seconds(4); err != nil || d != 10*time.Second {
+		t.Errorf("Seconds(4) = %v, %v", d, err)
+	}
+	if got := args.Rest(3); got != "NX 10" {
+		t.Errorf("Rest(3) = %q", got)
+	}
+	if got := args.Rest(5); got != "" {
+		t.Errorf("Rest(5) = %q", got)
+	}
+	if !args.Flag("nx") || args.Flag("XX") {
+		t.Error("Unexpected Flag results")
+	}
+}
@@ -0,0 +1,284 @@
+// pkg/api/geo.go
+package api
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/lofoneh/kvlite/internal/engine"
+)
+
+// geoStore is the part of dataStore used by the geo commands
+type geoStore interface {
+	GeoAdd(key string, points []engine.GeoPoint, opts engine.ZAddOptions) (int, error)
+	GeoPos(key string, members ...string) (map[string]engine.GeoPoint, error)
+	GeoDist(key, member1, member2 string) (float64, bool, error)
+	GeoHash(key string, members ...string) (map[string]string, error)
+	GeoSearch(key string, q engine.GeoQuery) ([]engine.GeoPoint, error)
+}
+
+// geoUnits maps distance units to meters
+var geoUnits = map[string]float64{
+	"M":  1,
+	"KM": 1000,
+	"FT": 0.3048,
+	"MI": 1609.34,
+}
+
+// executeGeoCommand runs a geo command
+func executeGeoCommand(db geoStore, cmd string, parts []string) string {
+	switch cmd {
+	case "GEOADD":
+		if len(parts) < 5 {
+			return "-ERR GEOADD requires key and longitude latitude member triples"
+		}
+		opts, i := parseZAddOptions(parts[2:])
+		args := parts[2+i:]
+		if len(args) == 0 || len(args)%3 != 0 {
+			return "-ERR GEOADD requires key and longitude latitude member triples"
+		}
+		points := make([]engine.GeoPoint, 0, len(args)/3)
+		for j := 0; j < len(args); j += 3 {
+			lon, lat, err := parseLonLat(args[j], args[j+1])
+			if err != nil {
+				return "-ERR " + err.Error()
+			}
+			points = append(points, engine.GeoPoint{Member: args[j+2], Lon: lon, Lat: lat})
+		}
+		n, err := db.GeoAdd(parts[1], points, opts)
+		if err != nil {
+			return errReply("failed to add", err)
+		}
+		return strconv.Itoa(n)
+
+	case "GEOPOS":
+		if len(parts) < 3 {
+			return "-ERR GEOPOS requires key and at least one member"
+		}
+		points, err := db.GeoPos(parts[1], parts[2:]...)
+		if err != nil {
+			return errReply("failed to get positions", err)
+		}
+		results := make([]string, 0, len(parts)-2)
+		for _, m := range parts[2:] {
+			p, ok := points[m]
+			if !ok {
+				results = append(results, "(nil)")
+				continue
+			}
+			results = append(results, formatCoord(p.Lon)+" "+formatCoord(p.Lat))
+		}
+		return strings.Join(results, "\n")
+
+	case "GEODIST":
+		if len(parts) != 4 && len(parts) != 5 {
+			return "-ERR GEODIST requires key, two members and optionally a unit"
+		}
+		unit := 1.0
+		if len(parts) == 5 {
+			var err error
+			if unit, err = parseGeoUnit(parts[4]); err != nil {
+				return "-ERR " + err.Error()
+			}
+		}
+		dist, ok, err := db.GeoDist(parts[1], parts[2], parts[3])
+		if err != nil {
+			return errReply("failed to get distance", err)
+		}
+		if !ok {
+			return "(nil)"
+		}
+		return formatDist(dist / unit)
+
+	case "GEOHASH":
+		if len(parts) < 3 {
+			return "-ERR GEOHASH requires key and at least one member"
+		}
+		hashes, err := db.GeoHash(parts[1], parts[2:]...)
+		if err != nil {
+			return errReply("failed to get geohashes", err)
+		}
+		results := make([]string, 0, len(parts)-2)
+		for _, m := range parts[2:] {
+			hash, ok := hashes[m]
+			if !ok {
+				hash = "(nil)"
+			}
+			results = append(results, hash)
+		}
+		return strings.Join(results, "\n")
+
+	case "GEOSEARCH":
+		if len(parts) < 2 {
+			return "-ERR GEOSEARCH requires key, FROMMEMBER or FROMLONLAT and BYRADIUS or BYBOX"
+		}
+		q, unit, with, err := parseGeoSearch(parts[2:])
+		if err != nil {
+			return "-ERR " + err.Error()
+		}
+		points, err := db.GeoSearch(parts[1], q)
+		if err != nil {
+			return errReply("failed to search", err)
+		}
+		if len(points) == 0 {
+			return "(empty list)"
+		}
+		results := make([]string, len(points))
+		for i, p := range points {
+			line := p.Member
+			if with.dist {
+				line += " " + formatDist(p.Dist/unit)
+			}
+			if with.coord {
+				line += " " + formatCoord(p.Lon) + " " + formatCoord(p.Lat)
+			}
+			results[i] = line
+		}
+		return strings.Join(results, "\n")
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'", cmd)
+}
+
+// geoWith holds the WITH* flags of GEOSEARCH
+type geoWith struct {
+	dist  bool
+	coord bool
+}
+
+// parseGeoSearch parses the arguments of GEOSEARCH after the key and
+// returns the query, the size of the unit distances are given in, and the
+// extra fields to reply with
+func parseGeoSearch(args []string) (engine.GeoQuery, float64, geoWith, error) {
+	var q engine.GeoQuery
+	var with geoWith
+	var unit float64
+	from, by := false, false
+	syntax := fmt.Errorf("syntax error")
+
+	for i := 0; i < len(args); i++ {
+		rest := len(args) - i - 1
+		switch strings.ToUpper(args[i]) {
+		case "FROMMEMBER":
+			if from || rest < 1 {
+				return q, 0, with, syntax
+			}
+			q.FromMember = args[i+1]
+			from = true
+			i++
+		case "FROMLONLAT":
+			if from || rest < 2 {
+				return q, 0, with, syntax
+			}
+			lon, lat, err := parseLonLat(args[i+1], args[i+2])
+			if err != nil {
+				return q, 0, with, err
+			}
+			q.Lon, q.Lat = lon, lat
+			from = true
+			i += 2
+		case "BYRADIUS":
+			if by || rest < 2 {
+				return q, 0, with, syntax
+			}
+			r, err := parseGeoLength(args[i+1])
+			if err != nil {
+				return q, 0, with, err
+			}
+			if unit, err = parseGeoUnit(args[i+2]); err != nil {
+				return q, 0, with, err
+			}
+			q.Radius = r * unit
+			by = true
+			i += 2
+		case "BYBOX":
+			if by || rest < 3 {
+				return q, 0, with, syntax
+			}
+			w, err := parseGeoLength(args[i+1])
+			if err != nil {
+				return q, 0, with, err
+			}
+			h, err := parseGeoLength(args[i+2])
+			if err != nil {
+				return q, 0, with, err
+			}
+			if unit, err = parseGeoUnit(args[i+3]); err != nil {
+				return q, 0, with, err
+			}
+			q.Width, q.Height = w*unit, h*unit
+			by = true
+			i += 3
+		case "ASC":
+			q.Order = engine.GeoAsc
+		case "DESC":
+			q.Order = engine.GeoDesc
+		case "COUNT":
+			if rest < 1 {
+				return q, 0, with, syntax
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				return q, 0, with, fmt.Errorf("COUNT must be > 0")
+			}
+			q.Count = n
+			i++
+		case "WITHDIST":
+			with.dist = true
+		case "WITHCOORD":
+			with.coord = true
+		default:
+			return q, 0, with, syntax
+		}
+	}
+	if !from {
+		return q, 0, with, fmt.Errorf("exactly one of FROMMEMBER or FROMLONLAT is required")
+	}
+	if !by {
+		return q, 0, with, fmt.Errorf("exactly one of BYRADIUS or BYBOX is required")
+	}
+	return q, unit, with, nil
+}
+
+// parseLonLat parses a longitude and a latitude
+func parseLonLat(lonArg, latArg string) (float64, float64, error) {
+	lon, err1 := strconv.ParseFloat(lonArg, 64)
+	lat, err2 := strconv.ParseFloat(latArg, 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("value is not a valid float")
+	}
+	return lon, lat, nil
+}
+
+// parseGeoLength parses a radius, width or height, which must not be
+// negative
+func parseGeoLength(arg string) (float64, error) {
+	v, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("value is not a valid float")
+	}
+	if v < 0 {
+		return 0, fmt.Errorf("radius, width and height cannot be negative")
+	}
+	return v, nil
+}
+
+// parseGeoUnit returns the size in meters of a unit: m, km, ft or mi
+func parseGeoUnit(arg string) (float64, error) {
+	unit, ok := geoUnits[strings.ToUpper(arg)]
+	if !ok {
+		return 0, fmt.Errorf("unsupported unit provided. please use M, KM, FT, MI")
+	}
+	return unit, nil
+}
+
+// formatDist formats a distance with the precision of GEODIST
+func formatDist(d float64) string {
+	return strconv.FormatFloat(d, 'f', 4, 64)
+}
+
+// formatCoord formats a longitude or latitude
+func formatCoord(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
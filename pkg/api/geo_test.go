@@ -0,0 +1,108 @@
+// pkg/api/geo_test.go
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServer_GeoCommands(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	steps := []struct {
+		cmd  string
+		want string
+	}{
+		{"GEOADD sicily 13.361389 38.115556 palermo 15.087269 37.502669 catania", "2"},
+		{"GEOADD sicily NX CH 13.5 38 palermo", "0"},
+		{"GEOADD sicily XX CH 13.361389 38.115556 palermo", "0"},
+		{"GEODIST sicily palermo catania", "166274.1516"},
+		{"GEODIST sicily palermo catania km", "166.2742"},
+		{"GEODIST sicily palermo missing", "(nil)"},
+		{"GEOPOS sicily palermo", "13.361389338970184 38.1155563954963"},
+		{"GEOHASH sicily palermo", "sqc8b49rny0"},
+		{"GEOSEARCH sicily FROMLONLAT 15 37 BYRADIUS 200 km DESC COUNT 1", "palermo"},
+		{"GEOSEARCH sicily FROMLONLAT 15 37 BYRADIUS 100 km", "catania"},
+		{"GEOSEARCH sicily FROMLONLAT 0 0 BYRADIUS 1 m", "(empty list)"},
+		{"ZCARD sicily", "2"},
+	}
+	for _, step := range steps {
+		if r := h.sendCommand(step.cmd); r != step.want {
+			t.Errorf("%s: expected %s, got: %s", step.cmd, step.want, r)
+		}
+	}
+
+	errors := []string{
+		"GEOADD sicily 13 38",
+		"GEOADD sicily x 38 a",
+		"GEOADD sicily 0 89 north",
+		"GEOADD sicily GT 1 1 a",
+		"GEODIST sicily palermo catania parsecs",
+		"GEOSEARCH sicily BYRADIUS 1 km",
+		"GEOSEARCH sicily FROMLONLAT 15 37",
+		"GEOSEARCH sicily FROMLONLAT 15 37 BYRADIUS -1 km",
+		"GEOSEARCH sicily FROMMEMBER missing BYRADIUS 1 km",
+		"GEOSEARCH sicily FROMLONLAT 15 37 BYRADIUS 1 km COUNT 0",
+		"GEOSEARCH sicily FROMLONLAT 15 37 BYBOX 1 km",
+		"GEOSEARCH sicily FROMLONLAT 15 37 BYRADIUS 1 km SIDEWAYS",
+	}
+	for _, cmd := range errors {
+		if r := h.sendCommand(cmd); !strings.HasPrefix(r, "-ERR") {
+			t.Errorf("%s: expected error, got: %s", cmd, r)
+		}
+	}
+
+	h.sendCommand("SET str x")
+	if r := h.sendCommand("GEOPOS str a"); !strings.Contains(r, "WRONGTYPE") {
+		t.Errorf("Expected WRONGTYPE, got: %s", r)
+	}
+}
+
+func TestServer_GeoSearch(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	h.sendCommand("GEOADD sicily 13.361389 38.115556 palermo 15.087269 37.502669 catania")
+
+	c := h.dial()
+	defer c.close()
+
+	tests := []struct {
+		cmd  string
+		want []string
+	}{
+		{"GEOSEARCH sicily FROMLONLAT 15 37 BYRADIUS 200 km ASC WITHDIST",
+			[]string{"catania 56.4413", "palermo 190.4424"}},
+		{"GEOSEARCH sicily FROMLONLAT 15 37 BYBOX 400 400 km DESC WITHDIST",
+			[]string{"palermo 190.4424", "catania 56.4413"}},
+		{"GEOSEARCH sicily FROMMEMBER palermo BYRADIUS 200 km COUNT 1 WITHCOORD",
+			[]string{"palermo 13.361389338970184 38.1155563954963"}},
+		{"GEOPOS sicily catania missing",
+			[]string{"15.087267458438873 37.50266842333161", "(nil)"}},
+		{"GEOHASH sicily palermo missing catania",
+			[]string{"sqc8b49rny0", "(nil)", "sqdtr74hyu0"}},
+	}
+	for _, tt := range tests {
+		replies := c.sendLines(tt.cmd, len(tt.want))
+		if strings.Join(replies, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: expected %v, got %v", tt.cmd, tt.want, replies)
+		}
+	}
+}
+
+func TestServer_Geo_InMulti(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("MULTI")
+	c.send("GEOADD shops 2.35 48.85 paris")
+	c.send("GEOSEARCH shops FROMLONLAT 2.35 48.85 BYRADIUS 1 km")
+	replies := c.sendLines("EXEC", 2)
+	if strings.Join(replies, ",") != "1,paris" {
+		t.Errorf("Expected EXEC replies [1 paris], got %v", replies)
+	}
+}
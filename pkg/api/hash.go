@@ -0,0 +1,181 @@
+// pkg/api/hash.go
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hashStore is the part of dataStore used by the hash commands
+type hashStore interface {
+	HSet(key string, fields map[string]string) (int, error)
+	HGet(key, field string) (string, bool, error)
+	HMGet(key string, fields []string) (map[string]string, error)
+	HGetAll(key string) (map[string]string, error)
+	HDel(key string, fields ...string) (int, error)
+	HLen(key string) (int, error)
+	HKeys(key string) ([]string, error)
+	HVals(key string) ([]string, error)
+	HIncrBy(key, field string, delta int64) (int64, error)
+	HScan(key string, cursor int, pattern string, count int) (int, []string, error)
+}
+
+// executeHashCommand runs a hash command
+func executeHashCommand(db hashStore, cmd string, parts []string) string {
+	switch cmd {
+	case "HSET":
+		if len(parts) < 4 || len(parts)%2 != 0 {
+			return "-ERR HSET requires key and field value pairs"
+		}
+		fields := make(map[string]string, (len(parts)-2)/2)
+		for i := 2; i < len(parts); i += 2 {
+			fields[parts[i]] = parts[i+1]
+		}
+		added, err := db.HSet(parts[1], fields)
+		if err != nil {
+			return errReply("failed to set", err)
+		}
+		return strconv.Itoa(added)
+
+	case "HGET":
+		if len(parts) < 3 {
+			return "-ERR HGET requires key and field"
+		}
+		val, ok, err := db.HGet(parts[1], parts[2])
+		if err != nil {
+			return errReply("failed to get", err)
+		}
+		if !ok {
+			return "(nil)"
+		}
+		return val
+
+	case "HMGET":
+		if len(parts) < 3 {
+			return "-ERR HMGET requires key and at least one field"
+		}
+		values, err := db.HMGet(parts[1], parts[2:])
+		if err != nil {
+			return errReply("failed to get", err)
+		}
+		results := make([]string, 0, len(parts)-2)
+		for _, field := range parts[2:] {
+			if val, ok := values[field]; ok {
+				results = append(results, val)
+			} else {
+				results = append(results, "(nil)")
+			}
+		}
+		return strings.Join(results, "\n")
+
+	case "HGETALL":
+		if len(parts) < 2 {
+			return "-ERR HGETALL requires key"
+		}
+		values, err := db.HGetAll(parts[1])
+		if err != nil {
+			return errReply("failed to get", err)
+		}
+		if len(values) == 0 {
+			return "(empty list)"
+		}
+		fields := make([]string, 0, len(values))
+		for field := range values {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		results := make([]string, 0, len(fields)*2)
+		for _, field := range fields {
+			results = append(results, field, values[field])
+		}
+		return strings.Join(results, "\n")
+
+	case "HDEL":
+		if len(parts) < 3 {
+			return "-ERR HDEL requires key and at least one field"
+		}
+		deleted, err := db.HDel(parts[1], parts[2:]...)
+		if err != nil {
+			return errReply("failed to delete", err)
+		}
+		return strconv.Itoa(deleted)
+
+	case "HEXISTS":
+		if len(parts) < 3 {
+			return "-ERR HEXISTS requires key and field"
+		}
+		_, ok, err := db.HGet(parts[1], parts[2])
+		if err != nil {
+			return errReply("failed to get", err)
+		}
+		if ok {
+			return "1"
+		}
+		return "0"
+
+	case "HLEN":
+		if len(parts) < 2 {
+			return "-ERR HLEN requires key"
+		}
+		n, err := db.HLen(parts[1])
+		if err != nil {
+			return errReply("failed to get", err)
+		}
+		return strconv.Itoa(n)
+
+	case "HKEYS", "HVALS":
+		if len(parts) < 2 {
+			return fmt.Sprintf("-ERR %s requires key", cmd)
+		}
+		var results []string
+		var err error
+		if cmd == "HKEYS" {
+			results, err = db.HKeys(parts[1])
+		} else {
+			results, err = db.HVals(parts[1])
+		}
+		if err != nil {
+			return errReply("failed to get", err)
+		}
+		if len(results) == 0 {
+			return "(empty list)"
+		}
+		return strings.Join(results, "\n")
+
+	case "HINCRBY":
+		if len(parts) < 4 {
+			return "-ERR HINCRBY requires key, field, and increment"
+		}
+		delta, err := strconv.ParseInt(parts[3], 10, 64)
+		if err != nil {
+			return "-ERR value is not an integer"
+		}
+		return incrReply(db.HIncrBy(parts[1], parts[2], delta))
+
+	case "HSCAN":
+		if len(parts) < 3 {
+			return "-ERR HSCAN requires key and cursor"
+		}
+		cursor, err := strconv.Atoi(parts[2])
+		if err != nil || cursor < 0 {
+			return "-ERR invalid cursor"
+		}
+		pattern, count, err := parseScanOptions(parts[3:])
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		next, pairs, err := db.HScan(parts[1], cursor, pattern, count)
+		if err != nil {
+			return errReply("failed to scan", err)
+		}
+		result := strconv.Itoa(next)
+		if len(pairs) > 0 {
+			result += "\n" + strings.Join(pairs, "\n")
+		}
+		return result
+	}
+
+	return fmt.Sprintf("-ERR unknown command '%s'", cmd)
+}
@@ -0,0 +1,105 @@
+// pkg/api/hash_test.go
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServer_HSET_HGET(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	if r := h.sendCommand("HSET user name alice age 30"); r != "2" {
+		t.Errorf("Expected 2 new fields, got: %s", r)
+	}
+	if r := h.sendCommand("HSET user age 31"); r != "0" {
+		t.Errorf("Expected 0 new fields on update, got: %s", r)
+	}
+	if r := h.sendCommand("HGET user age"); r != "31" {
+		t.Errorf("Expected 31, got: %s", r)
+	}
+	if r := h.sendCommand("HGET user missing"); r != "(nil)" {
+		t.Errorf("Expected (nil) for missing field, got: %s", r)
+	}
+	if r := h.sendCommand("HSET user name"); !strings.HasPrefix(r, "-ERR") {
+		t.Errorf("HSET without value should fail, got: %s", r)
+	}
+	if r := h.sendCommand("HEXISTS user name"); r != "1" {
+		t.Errorf("Expected HEXISTS 1, got: %s", r)
+	}
+	if r := h.sendCommand("HLEN user"); r != "2" {
+		t.Errorf("Expected HLEN 2, got: %s", r)
+	}
+	if r := h.sendCommand("HINCRBY user age 2"); r != "33" {
+		t.Errorf("Expected HINCRBY 33, got: %s", r)
+	}
+	if r := h.sendCommand("HDEL user name missing"); r != "1" {
+		t.Errorf("Expected HDEL 1, got: %s", r)
+	}
+	if r := h.sendCommand("HEXISTS user name"); r != "0" {
+		t.Errorf("Expected HEXISTS 0 after HDEL, got: %s", r)
+	}
+}
+
+func TestServer_HashMultiline(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("HSET h b 2 a 1 c 3")
+
+	expected := map[string][]string{
+		"HGETALL h":          {"a", "1", "b", "2", "c", "3"},
+		"HKEYS h":            {"a", "b", "c"},
+		"HVALS h":            {"1", "2", "3"},
+		"HMGET h c nope a":   {"3", "(nil)", "1"},
+		"HSCAN h 0 COUNT 2":  {"2", "a", "1", "b", "2"},
+		"HSCAN h 2 COUNT 2":  {"0", "c", "3"},
+		"HSCAN h 0 MATCH b*": {"0", "b", "2"},
+	}
+	for cmd, want := range expected {
+		got := c.sendLines(cmd, len(want))
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: expected %v, got %v", cmd, want, got)
+		}
+	}
+
+	if r := c.send("HGETALL missing"); r != "(empty list)" {
+		t.Errorf("Expected (empty list), got: %s", r)
+	}
+}
+
+func TestServer_WRONGTYPE(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	const wrongType = "-ERR WRONGTYPE Operation against a key holding the wrong kind of value"
+
+	h.sendCommand("SET str value")
+	h.sendCommand("HSET hash f v")
+
+	for _, cmd := range []string{
+		"HSET str f v",
+		"HGET str f",
+		"HGETALL str",
+		"GET hash",
+		"INCR hash",
+		"APPEND hash x",
+		"STRLEN hash",
+		"GETDEL hash",
+	} {
+		if r := h.sendCommand(cmd); r != wrongType {
+			t.Errorf("%s: expected WRONGTYPE, got: %s", cmd, r)
+		}
+	}
+
+	if r := h.sendCommand("EXISTS hash"); r != "1" {
+		t.Errorf("EXISTS should see hashes, got: %s", r)
+	}
+	if r := h.sendCommand("MGET str hash"); r != "value" {
+		t.Errorf("Expected first MGET line to be the string, got: %s", r)
+	}
+}
@@ -0,0 +1,52 @@
+// pkg/api/hll.go
+package api
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// hllStore is the part of dataStore used by the HyperLogLog commands
+type hllStore interface {
+	PFAdd(key string, elements ...string) (bool, error)
+	PFCount(keys ...string) (uint64, error)
+	PFMerge(dst string, keys ...string) error
+}
+
+// executeHLLCommand runs a HyperLogLog command
+func executeHLLCommand(db hllStore, cmd string, parts []string) string {
+	switch cmd {
+	case "PFADD":
+		if len(parts) < 2 {
+			return "-ERR PFADD requires key"
+		}
+		changed, err := db.PFAdd(parts[1], parts[2:]...)
+		if err != nil {
+			return errReply("failed to add", err)
+		}
+		if changed {
+			return "1"
+		}
+		return "0"
+
+	case "PFCOUNT":
+		if len(parts) < 2 {
+			return "-ERR PFCOUNT requires at least one key"
+		}
+		n, err := db.PFCount(parts[1:]...)
+		if err != nil {
+			return errReply("failed to count", err)
+		}
+		return strconv.FormatUint(n, 10)
+
+	case "PFMERGE":
+		if len(parts) < 2 {
+			return "-ERR PFMERGE requires destination key"
+		}
+		if err := db.PFMerge(parts[1], parts[2:]...); err != nil {
+			return errReply("failed to merge", err)
+		}
+		return "+OK"
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'", cmd)
+}
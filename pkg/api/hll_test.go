@@ -0,0 +1,65 @@
+// pkg/api/hll_test.go
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServer_HLLCommands(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	if r := h.sendCommand("PFADD page:home u1 u2 u3 u2"); r != "1" {
+		t.Errorf("Expected 1, got: %s", r)
+	}
+	if r := h.sendCommand("PFADD page:home u1"); r != "0" {
+		t.Errorf("Expected 0 for a known element, got: %s", r)
+	}
+	if r := h.sendCommand("PFCOUNT page:home"); r != "3" {
+		t.Errorf("Expected PFCOUNT 3, got: %s", r)
+	}
+	h.sendCommand("PFADD page:about u3 u4")
+	if r := h.sendCommand("PFCOUNT page:home page:about"); r != "4" {
+		t.Errorf("Expected a union of 4, got: %s", r)
+	}
+	if r := h.sendCommand("PFMERGE site page:home page:about"); r != "+OK" {
+		t.Errorf("Expected +OK, got: %s", r)
+	}
+	if r := h.sendCommand("PFCOUNT site"); r != "4" {
+		t.Errorf("Expected PFCOUNT 4 after PFMERGE, got: %s", r)
+	}
+	if r := h.sendCommand("PFCOUNT missing"); r != "0" {
+		t.Errorf("Expected 0 for a missing key, got: %s", r)
+	}
+
+	for _, cmd := range []string{"PFADD", "PFCOUNT", "PFMERGE"} {
+		if r := h.sendCommand(cmd); !strings.HasPrefix(r, "-ERR") {
+			t.Errorf("%s: expected error, got: %s", cmd, r)
+		}
+	}
+
+	h.sendCommand("SET str value")
+	if r := h.sendCommand("PFADD str x"); !strings.Contains(r, "WRONGTYPE") {
+		t.Errorf("Expected WRONGTYPE, got: %s", r)
+	}
+	if r := h.sendCommand("PFCOUNT site str"); !strings.Contains(r, "WRONGTYPE") {
+		t.Errorf("Expected WRONGTYPE, got: %s", r)
+	}
+}
+
+func TestServer_HLL_InMulti(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("MULTI")
+	c.send("PFADD visitors a b")
+	c.send("PFCOUNT visitors")
+	replies := c.sendLines("EXEC", 2)
+	if strings.Join(replies, ",") != "1,2" {
+		t.Errorf("Expected EXEC replies [1 2], got %v", replies)
+	}
+}
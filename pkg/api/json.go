@@ -0,0 +1,177 @@
+// pkg/api/json.go
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lofoneh/kvlite/internal/engine"
+)
+
+// jsonStore is the part of dataStore used by the JSON commands
+type jsonStore interface {
+	JSONSet(key, path, value string, cond engine.SetCondition) (bool, error)
+	JSONGet(key string, paths ...string) (string, bool, error)
+	JSONMGet(path string, keys ...string) (map[string]string, error)
+	JSONDel(key, path string) (int, error)
+	JSONNumIncrBy(key, path, delta string) (string, error)
+	JSONArrAppend(key, path string, values ...string) ([]int, error)
+}
+
+// jsonValueCommands are the JSON commands whose lines are split with
+// splitJSON, so that their values may contain whitespace
+var jsonValueCommands = map[string]bool{
+	"JSON.SET":       true,
+	"JSON.ARRAPPEND": true,
+}
+
+// splitJSON splits a command line like strings.Fields, except that from
+// the fourth argument on a JSON value is read as one argument, whitespace
+// included. Anything else, such as NX or a malformed value, runs to the
+// next whitespace as usual.
+func splitJSON(line string) []string {
+	parts := strings.Fields(line)
+	if len(parts) <= 3 {
+		return parts
+	}
+
+	// Skip the command, the key and the path
+	i := 0
+	for n := 0; n < 3; n++ {
+		i += strings.Index(line[i:], parts[n]) + len(parts[n])
+	}
+	parts = parts[:3]
+	for {
+		rest := strings.TrimLeft(line[i:], " \t\r\n")
+		if rest == "" {
+			return parts
+		}
+		i = len(line) - len(rest)
+
+		var raw json.RawMessage
+		dec := json.NewDecoder(strings.NewReader(rest))
+		if dec.Decode(&raw) == nil {
+			n := int(dec.InputOffset())
+			if n == len(rest) || strings.ContainsRune(" \t\r\n", rune(rest[n])) {
+				parts = append(parts, rest[:n])
+				i += n
+				continue
+			}
+		}
+		n := strings.IndexAny(rest, " \t\r\n")
+		if n == -1 {
+			n = len(rest)
+		}
+		parts = append(parts, rest[:n])
+		i += n
+	}
+}
+
+// executeJSONCommand runs a JSON command. Values are JSON texts, see
+// splitJSON.
+func executeJSONCommand(db jsonStore, cmd string, parts []string) string {
+	switch cmd {
+	case "JSON.SET":
+		if len(parts) != 4 && len(parts) != 5 {
+			return "-ERR JSON.SET requires key, path, value and optionally NX or XX"
+		}
+		cond := engine.SetAlways
+		if len(parts) == 5 {
+			switch strings.ToUpper(parts[4]) {
+			case "NX":
+				cond = engine.SetIfNotExists
+			case "XX":
+				cond = engine.SetIfExists
+			default:
+				return "-ERR syntax error"
+			}
+		}
+		ok, err := db.JSONSet(parts[1], parts[2], parts[3], cond)
+		if err != nil {
+			return errReply("failed to set", err)
+		}
+		if !ok {
+			return "(nil)"
+		}
+		return "+OK"
+
+	case "JSON.GET":
+		if len(parts) < 2 {
+			return "-ERR JSON.GET requires key and optionally paths"
+		}
+		value, ok, err := db.JSONGet(parts[1], parts[2:]...)
+		if err != nil {
+			return errReply("failed to get", err)
+		}
+		if !ok {
+			return "(nil)"
+		}
+		return value
+
+	case "JSON.MGET":
+		if len(parts) < 3 {
+			return "-ERR JSON.MGET requires at least one key and a path"
+		}
+		keys, path := parts[1:len(parts)-1], parts[len(parts)-1]
+		values, err := db.JSONMGet(path, keys...)
+		if err != nil {
+			return errReply("failed to get", err)
+		}
+		results := make([]string, len(keys))
+		for i, key := range keys {
+			value, ok := values[key]
+			if !ok {
+				value = "(nil)"
+			}
+			results[i] = value
+		}
+		return strings.Join(results, "\n")
+
+	case "JSON.DEL":
+		if len(parts) != 2 && len(parts) != 3 {
+			return "-ERR JSON.DEL requires key and optionally a path"
+		}
+		path := "$"
+		if len(parts) == 3 {
+			path = parts[2]
+		}
+		n, err := db.JSONDel(parts[1], path)
+		if err != nil {
+			return errReply("failed to delete", err)
+		}
+		return strconv.Itoa(n)
+
+	case "JSON.NUMINCRBY":
+		if len(parts) != 4 {
+			return "-ERR JSON.NUMINCRBY requires key, path and number"
+		}
+		value, err := db.JSONNumIncrBy(parts[1], parts[2], parts[3])
+		if err != nil {
+			return errReply("failed to increment", err)
+		}
+		return value
+
+	case "JSON.ARRAPPEND":
+		if len(parts) < 4 {
+			return "-ERR JSON.ARRAPPEND requires key, path and at least one value"
+		}
+		lengths, err := db.JSONArrAppend(parts[1], parts[2], parts[3:]...)
+		if err != nil {
+			return errReply("failed to append", err)
+		}
+		if len(lengths) == 0 {
+			return "(empty list)"
+		}
+		results := make([]string, len(lengths))
+		for i, n := range lengths {
+			results[i] = "(nil)"
+			if n != -1 {
+				results[i] = strconv.Itoa(n)
+			}
+		}
+		return strings.Join(results, "\n")
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'", cmd)
+}
@@ -0,0 +1,129 @@
+// pkg/api/json_test.go
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServer_JSONCommands(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	steps := []struct {
+		cmd  string
+		want string
+	}{
+		{`JSON.SET user $ {"name":"ann","age":30,"tags":["a"]}`, "+OK"},
+		{`JSON.SET user $.name "bob" NX`, "(nil)"},
+		{`JSON.SET user $.city "oslo" nx`, "+OK"},
+		{`JSON.SET user $.zip 1 XX`, "(nil)"},
+		{`JSON.GET user`, `{"age":30,"city":"oslo","name":"ann","tags":["a"]}`},
+		{`JSON.GET user $.name`, `["ann"]`},
+		{`JSON.GET user .name`, `"ann"`},
+		{`JSON.GET user $.age $.city`, `{"$.age":[30],"$.city":["oslo"]}`},
+		{`JSON.GET missing`, "(nil)"},
+		{`JSON.NUMINCRBY user $.age 2`, "[32]"},
+		{`JSON.NUMINCRBY user .age -0.5`, "31.5"},
+		{`JSON.ARRAPPEND user $.tags "b" {"c":1}`, "3"},
+		{`JSON.ARRAPPEND user $.nope 1`, "(empty list)"},
+		{`JSON.DEL user $.tags[0]`, "1"},
+		{`JSON.GET user $.tags`, `[["b",{"c":1}]]`},
+		{`JSON.DEL user $.nope`, "0"},
+		{`JSON.DEL missing`, "0"},
+		{`JSON.SET other $ {"age":7}`, "+OK"},
+		{`JSON.DEL other`, "1"},
+		{`EXISTS other`, "0"},
+	}
+	for _, step := range steps {
+		if r := h.sendCommand(step.cmd); r != step.want {
+			t.Errorf("%s: expected %s, got: %s", step.cmd, step.want, r)
+		}
+	}
+
+	errors := []string{
+		`JSON.SET user $`,
+		`JSON.SET user $ {bad`,
+		`JSON.SET user $.a 1 YY`,
+		`JSON.SET new $.a 1`,
+		`JSON.GET user $[`,
+		`JSON.GET user .nope`,
+		`JSON.NUMINCRBY user .name 1`,
+		`JSON.NUMINCRBY user $.age x`,
+		`JSON.NUMINCRBY missing $ 1`,
+		`JSON.ARRAPPEND user .name 1`,
+		`JSON.ARRAPPEND user $.tags`,
+		`JSON.MGET user`,
+	}
+	for _, cmd := range errors {
+		if r := h.sendCommand(cmd); !strings.HasPrefix(r, "-ERR") {
+			t.Errorf("%s: expected error, got: %s", cmd, r)
+		}
+	}
+
+	h.sendCommand("SET str x")
+	if r := h.sendCommand("JSON.GET str"); !strings.Contains(r, "WRONGTYPE") {
+		t.Errorf("Expected WRONGTYPE, got: %s", r)
+	}
+}
+
+func TestServer_JSONWhitespace(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	steps := []struct {
+		cmd  string
+		want string
+	}{
+		{`JSON.SET doc $ { "a": 1, "tags": [ "x y" ] }`, "+OK"},
+		{`JSON.SET doc $.note "hello world" NX`, "+OK"},
+		{`JSON.SET doc $.note "bye  now" XX`, "+OK"},
+		{`JSON.ARRAPPEND doc $.tags "two words" {"b": [1, 2]}`, "3"},
+		{`JSON.GET doc`, `{"a":1,"note":"bye  now","tags":["x y","two words",{"b":[1,2]}]}`},
+		{`JSON.SET doc $.a 1 2`, "-ERR syntax error"},
+		{`JSON.SET doc $.a 1NX`, "-ERR failed to set: invalid JSON value"},
+	}
+	for _, step := range steps {
+		if r := h.sendCommand(step.cmd); r != step.want {
+			t.Errorf("%s: expected %s, got: %s", step.cmd, step.want, r)
+		}
+	}
+}
+
+func TestServer_JSONMGet(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	h.sendCommand(`JSON.SET a $ {"n":1}`)
+	h.sendCommand(`JSON.SET b $ {"n":2}`)
+	h.sendCommand(`JSON.ARRAPPEND b $ 1`)
+	h.sendCommand(`JSON.SET c $ [1,2]`)
+
+	c := h.dial()
+	defer c.close()
+
+	replies := c.sendLines("JSON.MGET a missing b $.n", 3)
+	if strings.Join(replies, ",") != "[1],(nil),[2]" {
+		t.Errorf("Expected [1] (nil) [2], got %v", replies)
+	}
+	replies = c.sendLines("JSON.ARRAPPEND c $[*] 1", 2)
+	if strings.Join(replies, ",") != "(nil),(nil)" {
+		t.Errorf("Expected (nil) for values that aren't arrays, got %v", replies)
+	}
+}
+
+func TestServer_JSON_InMulti(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("MULTI")
+	c.send(`JSON.SET doc $ {"n":1}`)
+	c.send("JSON.NUMINCRBY doc $.n 1")
+	replies := c.sendLines("EXEC", 2)
+	if strings.Join(replies, ",") != "+OK,[2]" {
+		t.Errorf("Expected EXEC replies [+OK [2]], got %v", replies)
+	}
+}
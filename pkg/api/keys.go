@@ -0,0 +1,182 @@
+// pkg/api/keys.go
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lofoneh/kvlite/internal/engine"
+)
+
+// keyStore is the part of dataStore used by the generic key commands
+type keyStore interface {
+	Rename(src, dst string, nx bool) (bool, error)
+	Copy(src, dst string, db int, replace bool) (bool, error)
+	Type(key string) string
+	RandomKey() (string, bool)
+	Touch(keys ...string) int
+	Dump(key string) ([]byte, bool)
+	Restore(key string, data []byte, opts engine.RestoreOptions) error
+	Index() int
+}
+
+// executeKeyCommand runs the commands that work on keys of any type:
+// RENAME, RENAMENX, COPY, TYPE, RANDOMKEY, TOUCH, UNLINK, DUMP and RESTORE.
+// Dumps are sent base64 encoded.
+func (s *Server) executeKeyCommand(db dataStore, cmd string, parts []string) string {
+	switch cmd {
+	case "RENAME", "RENAMENX":
+		if len(parts) != 3 {
+			return fmt.Sprintf("-ERR %s requires key and newkey", cmd)
+		}
+		renamed, err := db.Rename(parts[1], parts[2], cmd == "RENAMENX")
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		if renamed {
+			s.waiters.notify(parts[2])
+		}
+		switch {
+		case cmd == "RENAME":
+			return "+OK"
+		case renamed:
+			return "1"
+		}
+		return "0"
+
+	case "COPY":
+		if len(parts) < 3 {
+			return "-ERR COPY requires source and destination"
+		}
+		n, replace := -1, false
+		for i := 3; i < len(parts); i++ {
+			switch strings.ToUpper(parts[i]) {
+			case "REPLACE":
+				replace = true
+			case "DB":
+				if i+1 >= len(parts) {
+					return "-ERR syntax error"
+				}
+				i++
+				var err error
+				if n, err = parseDBIndex(parts[i]); err != nil {
+					return "-ERR " + err.Error()
+				}
+			default:
+				return "-ERR syntax error"
+			}
+		}
+		if n < 0 {
+			n = db.Index()
+		}
+		copied, err := db.Copy(parts[1], parts[2], n, replace)
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		if !copied {
+			return "0"
+		}
+		s.waiters.notify(parts[2])
+		return "1"
+
+	case "TYPE":
+		if len(parts) != 2 {
+			return "-ERR TYPE requires key"
+		}
+		return "+" + db.Type(parts[1])
+
+	case "RANDOMKEY":
+		if len(parts) != 1 {
+			return "-ERR RANDOMKEY takes no arguments"
+		}
+		key, ok := db.RandomKey()
+		if !ok {
+			return "(nil)"
+		}
+		return key
+
+	case "TOUCH":
+		if len(parts) < 2 {
+			return "-ERR TOUCH requires at least one key"
+		}
+		return strconv.Itoa(db.Touch(parts[1:]...))
+
+	case "UNLINK":
+		if len(parts) < 2 {
+			return "-ERR UNLINK requires at least one key"
+		}
+		// Values are freed by the garbage collector, so this is DEL with a
+		// count
+		deleted := 0
+		for _, key := range parts[1:] {
+			ok, err := db.Delete(key)
+			if err != nil {
+				return errReply("failed to delete", err)
+			}
+			if ok {
+				deleted++
+			}
+		}
+		return strconv.Itoa(deleted)
+
+	case "DUMP":
+		if len(parts) != 2 {
+			return "-ERR DUMP requires key"
+		}
+		data, ok := db.Dump(parts[1])
+		if !ok {
+			return "(nil)"
+		}
+		return base64.StdEncoding.EncodeToString(data)
+
+	case "RESTORE":
+		return s.restore(db, parts)
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'", cmd)
+}
+
+// restore runs RESTORE key ttl payload [REPLACE] [ABSTTL]. ttl is in
+// milliseconds, a Unix time in milliseconds with ABSTTL, and 0 keeps the
+// expiration stored in the dump.
+func (s *Server) restore(db dataStore, parts []string) string {
+	if len(parts) < 4 {
+		return "-ERR RESTORE requires key, ttl and payload"
+	}
+	ttl, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || ttl < 0 {
+		return "-ERR invalid TTL"
+	}
+	data, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", engine.ErrDumpPayload)
+	}
+
+	var opts engine.RestoreOptions
+	absolute := false
+	for _, opt := range parts[4:] {
+		switch strings.ToUpper(opt) {
+		case "REPLACE":
+			opts.Replace = true
+		case "ABSTTL":
+			absolute = true
+		default:
+			return "-ERR syntax error"
+		}
+	}
+	switch {
+	case ttl == 0:
+	case absolute:
+		opts.ExpiresAt = time.UnixMilli(ttl).UnixNano()
+	default:
+		opts.ExpiresAt = time.Now().Add(time.Duration(ttl) * time.Millisecond).UnixNano()
+	}
+
+	if err := db.Restore(parts[1], data, opts); err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	s.waiters.notify(parts[1])
+	return "+OK"
+}
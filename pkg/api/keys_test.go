@@ -0,0 +1,162 @@
+// pkg/api/keys_test.go
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServer_RENAME(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	h.sendCommand("SET a 1")
+	h.sendCommand("EXPIRE a 100")
+	if r := h.sendCommand("RENAME a b"); r != "+OK" {
+		t.Fatalf("RENAME failed: %s", r)
+	}
+	if r := h.sendCommand("GET b"); r != "1" {
+		t.Errorf("Expected b=1, got %s", r)
+	}
+	if r := h.sendCommand("TTL b"); r == "-1" || strings.HasPrefix(r, "-ERR") {
+		t.Errorf("Expected the TTL to be kept, got %s", r)
+	}
+	if r := h.sendCommand("RENAME a b"); r != "-ERR no such key" {
+		t.Errorf("Expected no such key, got %s", r)
+	}
+
+	h.sendCommand("SET c 2")
+	if r := h.sendCommand("RENAMENX c b"); r != "0" {
+		t.Errorf("Expected RENAMENX onto an existing key to return 0, got %s", r)
+	}
+	if r := h.sendCommand("RENAMENX c d"); r != "1" {
+		t.Errorf("Expected RENAMENX to return 1, got %s", r)
+	}
+	if r := h.sendCommand("RENAME c"); !strings.HasPrefix(r, "-ERR") {
+		t.Errorf("Expected error, got %s", r)
+	}
+}
+
+func TestServer_COPY(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("SELECT 1")
+	c.send("RPUSH l a b")
+	if r := c.send("COPY l l2"); r != "1" {
+		t.Fatalf("COPY failed: %s", r)
+	}
+	if r := c.send("COPY l l2"); r != "0" {
+		t.Errorf("Expected COPY onto an existing key to return 0, got %s", r)
+	}
+	if r := c.send("COPY l l2 REPLACE"); r != "1" {
+		t.Errorf("Expected COPY REPLACE to return 1, got %s", r)
+	}
+	if r := c.send("COPY l l"); !strings.HasPrefix(r, "-ERR source and destination") {
+		t.Errorf("Expected same key error, got %s", r)
+	}
+
+	// DB copies into another database, here the default one
+	if r := c.send("COPY l copied DB 0"); r != "1" {
+		t.Fatalf("COPY DB failed: %s", r)
+	}
+	if r := h.sendMultilineCommand("LRANGE copied 0 -1"); strings.Join(r, ",") != "a,b" {
+		t.Errorf("Expected the list in db 0, got %v", r)
+	}
+
+	for _, cmd := range []string{"COPY l", "COPY l x DB", "COPY l x DB 99", "COPY l x FOO"} {
+		if r := c.send(cmd); !strings.HasPrefix(r, "-ERR") {
+			t.Errorf("%s: expected error, got %s", cmd, r)
+		}
+	}
+}
+
+func TestServer_TYPE_TOUCH_UNLINK(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	if r := h.sendCommand("RANDOMKEY"); r != "(nil)" {
+		t.Errorf("Expected (nil) for an empty database, got %s", r)
+	}
+
+	h.sendCommand("SET s v")
+	h.sendCommand("HSET h f v")
+	h.sendCommand("SADD set m")
+	for cmd, want := range map[string]string{
+		"TYPE s":       "+string",
+		"TYPE h":       "+hash",
+		"TYPE set":     "+set",
+		"TYPE missing": "+none",
+	} {
+		if r := h.sendCommand(cmd); r != want {
+			t.Errorf("%s: expected %s, got %s", cmd, want, r)
+		}
+	}
+
+	if r := h.sendCommand("TOUCH s h missing"); r != "2" {
+		t.Errorf("Expected TOUCH to count 2 keys, got %s", r)
+	}
+	if r := h.sendCommand("RANDOMKEY"); r != "s" && r != "h" && r != "set" {
+		t.Errorf("Unexpected random key: %s", r)
+	}
+	if r := h.sendCommand("UNLINK s h missing"); r != "2" {
+		t.Errorf("Expected UNLINK to remove 2 keys, got %s", r)
+	}
+	if r := h.sendCommand("RANDOMKEY"); r != "set" {
+		t.Errorf("Expected the last key, got %s", r)
+	}
+}
+
+func TestServer_DUMP_RESTORE(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	if r := h.sendCommand("DUMP missing"); r != "(nil)" {
+		t.Errorf("Expected (nil), got %s", r)
+	}
+
+	h.sendCommand("ZADD z 1 a 2 b")
+	h.sendCommand("EXPIRE z 100")
+	payload := h.sendCommand("DUMP z")
+	if strings.HasPrefix(payload, "-ERR") {
+		t.Fatalf("DUMP failed: %s", payload)
+	}
+
+	// TTL 0 keeps the expiration of the dump
+	if r := h.sendCommand("RESTORE z2 0 " + payload); r != "+OK" {
+		t.Fatalf("RESTORE failed: %s", r)
+	}
+	if r := h.sendMultilineCommand("ZRANGE z2 0 -1 WITHSCORES"); strings.Join(r, ",") != "a,1,b,2" {
+		t.Errorf("Unexpected restored zset: %v", r)
+	}
+	if r := h.sendCommand("TTL z2"); r == "-1" || strings.HasPrefix(r, "-ERR") {
+		t.Errorf("Expected the TTL to be restored, got %s", r)
+	}
+
+	if r := h.sendCommand("RESTORE z2 0 " + payload); !strings.HasPrefix(r, "-ERR BUSYKEY") {
+		t.Errorf("Expected BUSYKEY, got %s", r)
+	}
+	if r := h.sendCommand("RESTORE z2 5000 " + payload + " REPLACE"); r != "+OK" {
+		t.Errorf("RESTORE REPLACE failed: %s", r)
+	}
+	if r := h.sendCommand("TTL z2"); r != "4" && r != "5" {
+		t.Errorf("Expected a 5s TTL, got %s", r)
+	}
+
+	// An absolute expiration in the past restores nothing
+	if r := h.sendCommand("RESTORE z3 1 " + payload + " ABSTTL"); r != "+OK" {
+		t.Errorf("RESTORE ABSTTL failed: %s", r)
+	}
+	if r := h.sendCommand("EXISTS z3"); r != "0" {
+		t.Errorf("Expected no key, got %s", r)
+	}
+
+	for _, cmd := range []string{"RESTORE k 0 bm90IGEgZHVtcA==", "RESTORE k 0 !!!", "RESTORE k -1 " + payload, "RESTORE k 0"} {
+		if r := h.sendCommand(cmd); !strings.HasPrefix(r, "-ERR") {
+			t.Errorf("%s: expected error, got %s", cmd, r)
+		}
+	}
+}
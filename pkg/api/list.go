@@ -0,0 +1,372 @@
+// pkg/api/list.go
+package api
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lofoneh/kvlite/internal/engine"
+)
+
+// listStore is the part of dataStore used by the list commands
+type listStore interface {
+	LPush(key string, values ...string) (int, error)
+	RPush(key string, values ...string) (int, error)
+	LPop(key string, count int) ([]string, error)
+	RPop(key string, count int) ([]string, error)
+	PopFirst(keys []string, side engine.ListSide) (string, string, bool, error)
+	LLen(key string) (int, error)
+	LIndex(key string, index int) (string, bool, error)
+	LRange(key string, start, stop int) ([]string, error)
+	LRem(key string, count int, value string) (int, error)
+	LTrim(key string, start, stop int) error
+	LMove(src, dst string, from, to engine.ListSide) (string, bool, error)
+}
+
+// blockingCommands wait for data when run outside MULTI. Inside MULTI they
+// behave like their non-blocking counterparts.
+var blockingCommands = map[string]bool{
+	"BLPOP":  true,
+	"BRPOP":  true,
+	"BLMOVE": true,
+}
+
+// keyWaiters tracks blocked connections and wakes them when data may have
+// been added to one of the keys they wait on
+type keyWaiters struct {
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]bool
+}
+
+// newKeyWaiters creates an empty registry
+func newKeyWaiters() *keyWaiters {
+	return &keyWaiters{waiters: make(map[string]map[chan struct{}]bool)}
+}
+
+// wait registers interest in keys and returns the channel that is signaled
+// when one of them receives data
+func (w *keyWaiters) wait(keys []string) chan struct{} {
+	ch := make(chan struct{}, 1)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, key := range keys {
+		if w.waiters[key] == nil {
+			w.waiters[key] = make(map[chan struct{}]bool)
+		}
+		w.waiters[key][ch] = true
+	}
+	return ch
+}
+
+// cancel removes a channel registered by wait
+func (w *keyWaiters) cancel(keys []string, ch chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, key := range keys {
+		delete(w.waiters[key], ch)
+		if len(w.waiters[key]) == 0 {
+			delete(w.waiters, key)
+		}
+	}
+}
+
+// notify wakes every connection waiting on key. They race for the data, and
+// the ones that find nothing go back to waiting.
+func (w *keyWaiters) notify(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.waiters[key] {
+		select {
+		case ch <- struct{}{}:
+		default: // Already signaled
+		}
+	}
+}
+
+// notifyAll wakes every waiting connection
+func (w *keyWaiters) notifyAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, chans := range w.waiters {
+		for ch := range chans {
+			select {
+			case ch <- struct{}{}:
+			default: // Already signaled
+			}
+		}
+	}
+}
+
+// blockingCommand runs BLPOP, BRPOP or BLMOVE, parking the connection until
+// an element is available, the timeout expires or the server shuts down
+func (s *Server) blockingCommand(db listStore, cmd string, parts []string) string {
+	if len(parts) < 3 {
+		return fmt.Sprintf("-ERR %s requires keys and a timeout", cmd)
+	}
+	timeout, err := parseTimeout(parts[len(parts)-1])
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+
+	keys := parts[1 : len(parts)-1]
+	if cmd == "BLMOVE" {
+		keys = parts[1:2] // Only the source can unblock it
+	}
+
+	return s.block(keys, timeout, func() (string, bool) {
+		return s.popOrMove(db, cmd, parts)
+	})
+}
+
+// block calls attempt until it reports done, waiting for data on keys
+// between attempts. It gives up with (nil) after timeout, 0 meaning never,
+// or with an error when the server shuts down.
+func (s *Server) block(keys []string, timeout time.Duration, attempt func() (string, bool)) string {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		// Register before trying so that data added during the attempt
+		// still wakes us up
+		ch := s.waiters.wait(keys)
+		reply, done := attempt()
+		if done {
+			s.waiters.cancel(keys, ch)
+			return reply
+		}
+
+		select {
+		case <-ch:
+			s.waiters.cancel(keys, ch)
+		case <-expired:
+			s.waiters.cancel(keys, ch)
+			return "(nil)"
+		case <-s.shutdownChan:
+			s.waiters.cancel(keys, ch)
+			return "-ERR server shutting down"
+		}
+	}
+}
+
+// executeListCommand runs a list command. Blocking commands don't wait
+// here; they reply (nil) right away if there is nothing to pop.
+func (s *Server) executeListCommand(db listStore, cmd string, parts []string) string {
+	switch cmd {
+	case "LPUSH", "RPUSH":
+		if len(parts) < 3 {
+			return fmt.Sprintf("-ERR %s requires key and at least one value", cmd)
+		}
+		push := db.RPush
+		if cmd == "LPUSH" {
+			push = db.LPush
+		}
+		n, err := push(parts[1], parts[2:]...)
+		if err != nil {
+			return errReply("failed to push", err)
+		}
+		s.waiters.notify(parts[1])
+		return strconv.Itoa(n)
+
+	case "LPOP", "RPOP":
+		if len(parts) != 2 && len(parts) != 3 {
+			return fmt.Sprintf("-ERR %s requires key and optional count", cmd)
+		}
+		count := 1
+		if len(parts) == 3 {
+			var err error
+			count, err = strconv.Atoi(parts[2])
+			if err != nil || count < 1 {
+				return "-ERR count must be a positive integer"
+			}
+		}
+		pop := db.RPop
+		if cmd == "LPOP" {
+			pop = db.LPop
+		}
+		values, err := pop(parts[1], count)
+		if err != nil {
+			return errReply("failed to pop", err)
+		}
+		if len(values) == 0 {
+			return "(nil)"
+		}
+		return strings.Join(values, "\n")
+
+	case "LLEN":
+		if len(parts) != 2 {
+			return "-ERR LLEN requires key"
+		}
+		n, err := db.LLen(parts[1])
+		if err != nil {
+			return errReply("failed to get length", err)
+		}
+		return strconv.Itoa(n)
+
+	case "LINDEX":
+		if len(parts) != 3 {
+			return "-ERR LINDEX requires key and index"
+		}
+		index, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return "-ERR index must be an integer"
+		}
+		val, ok, err := db.LIndex(parts[1], index)
+		if err != nil {
+			return errReply("failed to get", err)
+		}
+		if !ok {
+			return "(nil)"
+		}
+		return val
+
+	case "LRANGE":
+		if len(parts) != 4 {
+			return "-ERR LRANGE requires key, start and stop"
+		}
+		start, stop, err := parseIndexRange(parts[2], parts[3])
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		values, err := db.LRange(parts[1], start, stop)
+		if err != nil {
+			return errReply("failed to get range", err)
+		}
+		if len(values) == 0 {
+			return "(empty list)"
+		}
+		return strings.Join(values, "\n")
+
+	case "LREM":
+		if len(parts) < 4 {
+			return "-ERR LREM requires key, count and value"
+		}
+		count, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return "-ERR count must be an integer"
+		}
+		n, err := db.LRem(parts[1], count, strings.Join(parts[3:], " "))
+		if err != nil {
+			return errReply("failed to remove", err)
+		}
+		return strconv.Itoa(n)
+
+	case "LTRIM":
+		if len(parts) != 4 {
+			return "-ERR LTRIM requires key, start and stop"
+		}
+		start, stop, err := parseIndexRange(parts[2], parts[3])
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		if err := db.LTrim(parts[1], start, stop); err != nil {
+			return errReply("failed to trim", err)
+		}
+		return "+OK"
+
+	case "LMOVE", "BLMOVE", "BLPOP", "BRPOP":
+		reply, _ := s.popOrMove(db, cmd, parts)
+		return reply
+	}
+
+	return fmt.Sprintf("-ERR unknown command '%s'", cmd)
+}
+
+// popOrMove runs one attempt of LMOVE, BLMOVE, BLPOP or BRPOP. It returns
+// the reply and false if there was nothing to pop, so that a blocking caller
+// knows to wait; errors and successful pops return true.
+func (s *Server) popOrMove(db listStore, cmd string, parts []string) (string, bool) {
+	if cmd == "BLPOP" || cmd == "BRPOP" {
+		if len(parts) < 3 {
+			return fmt.Sprintf("-ERR %s requires keys and a timeout", cmd), true
+		}
+		if _, err := parseTimeout(parts[len(parts)-1]); err != nil {
+			return fmt.Sprintf("-ERR %v", err), true
+		}
+		side := engine.ListRight
+		if cmd == "BLPOP" {
+			side = engine.ListLeft
+		}
+		key, val, ok, err := db.PopFirst(parts[1:len(parts)-1], side)
+		if err != nil {
+			return errReply("failed to pop", err), true
+		}
+		if !ok {
+			return "(nil)", false
+		}
+		return key + "\n" + val, true
+	}
+
+	switch {
+	case cmd == "LMOVE" && len(parts) != 5:
+		return "-ERR LMOVE requires source, destination and LEFT|RIGHT LEFT|RIGHT", true
+	case cmd == "BLMOVE" && len(parts) != 6:
+		return "-ERR BLMOVE requires source, destination, LEFT|RIGHT LEFT|RIGHT and timeout", true
+	}
+	from, err := parseListSide(parts[3])
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err), true
+	}
+	to, err := parseListSide(parts[4])
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err), true
+	}
+	if cmd == "BLMOVE" {
+		if _, err := parseTimeout(parts[5]); err != nil {
+			return fmt.Sprintf("-ERR %v", err), true
+		}
+	}
+	val, ok, err := db.LMove(parts[1], parts[2], from, to)
+	if err != nil {
+		return errReply("failed to move", err), true
+	}
+	if !ok {
+		return "(nil)", false
+	}
+	s.waiters.notify(parts[2])
+	return val, true
+}
+
+// parseListSide parses the LEFT or RIGHT argument of LMOVE
+func parseListSide(arg string) (engine.ListSide, error) {
+	switch strings.ToUpper(arg) {
+	case "LEFT":
+		return engine.ListLeft, nil
+	case "RIGHT":
+		return engine.ListRight, nil
+	}
+	return 0, fmt.Errorf("syntax error: expected LEFT or RIGHT, got %q", arg)
+}
+
+// parseIndexRange parses the start and stop arguments of LRANGE and LTRIM
+func parseIndexRange(startArg, stopArg string) (int, int, error) {
+	start, err := strconv.Atoi(startArg)
+	if err != nil {
+		return 0, 0, fmt.Errorf("start must be an integer")
+	}
+	stop, err := strconv.Atoi(stopArg)
+	if err != nil {
+		return 0, 0, fmt.Errorf("stop must be an integer")
+	}
+	return start, stop, nil
+}
+
+// parseTimeout parses the timeout of a blocking command, in seconds with
+// an optional fraction. 0 waits forever.
+func parseTimeout(arg string) (time.Duration, error) {
+	secs, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(secs) || secs > math.MaxInt64/float64(time.Second) {
+		return 0, fmt.Errorf("timeout is not a float or out of range")
+	}
+	if secs < 0 {
+		return 0, fmt.Errorf("timeout is negative")
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
@@ -0,0 +1,210 @@
+// pkg/api/list_test.go
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_ListCommands(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	if r := h.sendCommand("RPUSH jobs a b c"); r != "3" {
+		t.Errorf("Expected length 3, got: %s", r)
+	}
+	if r := h.sendCommand("LPUSH jobs z"); r != "4" {
+		t.Errorf("Expected length 4, got: %s", r)
+	}
+	if r := h.sendCommand("LLEN jobs"); r != "4" {
+		t.Errorf("Expected LLEN 4, got: %s", r)
+	}
+	if r := h.sendCommand("LINDEX jobs -1"); r != "c" {
+		t.Errorf("Expected c, got: %s", r)
+	}
+	if r := h.sendCommand("LINDEX jobs 10"); r != "(nil)" {
+		t.Errorf("Expected (nil), got: %s", r)
+	}
+	if r := h.sendCommand("LPOP jobs"); r != "z" {
+		t.Errorf("Expected z, got: %s", r)
+	}
+	if r := h.sendCommand("LMOVE jobs done RIGHT LEFT"); r != "c" {
+		t.Errorf("Expected c, got: %s", r)
+	}
+	if r := h.sendCommand("LMOVE jobs done UP LEFT"); !strings.HasPrefix(r, "-ERR") {
+		t.Errorf("LMOVE with a bad side should fail, got: %s", r)
+	}
+	if r := h.sendCommand("LREM jobs 0 a"); r != "1" {
+		t.Errorf("Expected LREM 1, got: %s", r)
+	}
+	if r := h.sendCommand("LTRIM jobs 1 -1"); r != "+OK" {
+		t.Errorf("Expected +OK, got: %s", r)
+	}
+	if r := h.sendCommand("EXISTS jobs"); r != "0" {
+		t.Errorf("Expected trimmed list to be removed, got: %s", r)
+	}
+	if r := h.sendCommand("RPOP missing"); r != "(nil)" {
+		t.Errorf("Expected (nil), got: %s", r)
+	}
+	if r := h.sendCommand("LPOP done 0"); !strings.HasPrefix(r, "-ERR") {
+		t.Errorf("LPOP with count 0 should fail, got: %s", r)
+	}
+
+	h.sendCommand("SET str value")
+	if r := h.sendCommand("LPUSH str x"); !strings.Contains(r, "WRONGTYPE") {
+		t.Errorf("Expected WRONGTYPE, got: %s", r)
+	}
+}
+
+func TestServer_ListMultiline(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("RPUSH l a b c d")
+
+	// Order matters: the pops change the list
+	steps := []struct {
+		cmd  string
+		want []string
+	}{
+		{"LRANGE l 0 -1", []string{"a", "b", "c", "d"}},
+		{"LRANGE l -2 10", []string{"c", "d"}},
+		{"BRPOP none l 1", []string{"l", "d"}},
+		{"LPOP l 2", []string{"a", "b"}},
+	}
+	for _, step := range steps {
+		got := c.sendLines(step.cmd, len(step.want))
+		if strings.Join(got, ",") != strings.Join(step.want, ",") {
+			t.Errorf("%s: expected %v, got %v", step.cmd, step.want, got)
+		}
+	}
+
+	if r := c.send("LRANGE missing 0 -1"); r != "(empty list)" {
+		t.Errorf("Expected (empty list), got: %s", r)
+	}
+}
+
+func TestServer_BLPOP_Blocks(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	waiter := h.dial()
+	defer waiter.close()
+
+	done := make(chan []string, 1)
+	go func() {
+		done <- waiter.sendLines("BLPOP q1 q2 0", 2)
+	}()
+
+	// The waiter stays blocked until something is pushed
+	select {
+	case r := <-done:
+		t.Fatalf("BLPOP returned before a push: %v", r)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	h.sendCommand("RPUSH q2 job1")
+	select {
+	case r := <-done:
+		if r[0] != "q2" || r[1] != "job1" {
+			t.Errorf("Expected q2 job1, got %v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BLPOP was not woken by RPUSH")
+	}
+
+	if r := h.sendCommand("LLEN q2"); r != "0" {
+		t.Errorf("Expected the pushed element to be consumed, got LLEN %s", r)
+	}
+}
+
+func TestServer_BLPOP_Timeout(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	start := time.Now()
+	if r := c.send("BLPOP empty 0.1"); r != "(nil)" {
+		t.Errorf("Expected (nil) on timeout, got: %s", r)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("BLPOP returned after %v, before its timeout", elapsed)
+	}
+	if r := c.send("BLPOP empty -1"); !strings.HasPrefix(r, "-ERR") {
+		t.Errorf("Negative timeout should fail, got: %s", r)
+	}
+}
+
+func TestServer_BLMOVE(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	waiter := h.dial()
+	defer waiter.close()
+
+	done := make(chan string, 1)
+	go func() {
+		done <- waiter.send("BLMOVE jobs processing LEFT RIGHT 1")
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	h.sendCommand("LPUSH jobs job1")
+
+	select {
+	case r := <-done:
+		if r != "job1" {
+			t.Errorf("Expected job1, got: %s", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BLMOVE was not woken by LPUSH")
+	}
+	if r := h.sendCommand("LINDEX processing 0"); r != "job1" {
+		t.Errorf("Expected job1 in processing, got: %s", r)
+	}
+}
+
+func TestServer_BLPOP_InMulti(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	// Inside MULTI a blocking pop doesn't wait
+	c.send("MULTI")
+	c.send("BLPOP empty 0")
+	if r := c.send("EXEC"); r != "(nil)" {
+		t.Errorf("Expected (nil) from EXEC, got: %s", r)
+	}
+}
+
+func TestServer_BLPOP_Shutdown(t *testing.T) {
+	h := setupTestHelper(t)
+
+	waiter := h.dial()
+	defer waiter.close()
+
+	done := make(chan string, 1)
+	go func() {
+		done <- waiter.send("BLPOP q 0")
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	go func() {
+		// Shutdown waits for connections, so close ours once it has replied
+		r := <-done
+		waiter.close()
+		done <- r
+	}()
+	h.close()
+
+	if r := <-done; !strings.HasPrefix(r, "-ERR") {
+		t.Errorf("Expected an error reply on shutdown, got: %s", r)
+	}
+}
@@ -0,0 +1,335 @@
+// pkg/api/pubsub.go
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lofoneh/kvlite/internal/engine"
+	"github.com/lofoneh/kvlite/internal/store"
+)
+
+// DefaultPubSubBuffer is the number of lines queued for a subscriber
+// before it is disconnected, when the configuration doesn't set one
+const DefaultPubSubBuffer = 1024
+
+// A connection enters subscriber mode with its first SUBSCRIBE or
+// PSUBSCRIBE. From then on everything sent to it goes through a queue
+// drained by a writer goroutine, so messages can be pushed while it waits
+// for commands. Each push is one line:
+//
+//	subscribe <channel> <count>      unsubscribe <channel> <count>
+//	psubscribe <pattern> <count>     punsubscribe <pattern> <count>
+//	message <channel> <payload>      pmessage <pattern> <channel> <payload>
+//
+// where count is the number of channels and patterns the connection is
+// still subscribed to. While it is above 0 only the subscription commands,
+// PING and QUIT are accepted. Publishing never waits for a subscriber: one
+// whose queue is full is disconnected.
+
+// pubsubCommands are the commands that manage the subscriptions of a
+// connection
+var pubsubCommands = map[string]bool{
+	"SUBSCRIBE":    true,
+	"UNSUBSCRIBE":  true,
+	"PSUBSCRIBE":   true,
+	"PUNSUBSCRIBE": true,
+}
+
+// subscriber is the subscriber mode state of a connection
+type subscriber struct {
+	conn     net.Conn
+	out      chan string     // Lines to write, closed when the connection ends
+	channels map[string]bool // Protected by the broker lock
+	patterns map[string]bool // Protected by the broker lock
+	dropped  int32           // Set once disconnected or closed (accessed atomically)
+}
+
+// count returns the number of subscriptions
+// Caller must hold the broker lock
+func (sub *subscriber) count() int {
+	return len(sub.channels) + len(sub.patterns)
+}
+
+// send queues a line, disconnecting the subscriber if its queue is full
+// Caller must hold the broker lock, for reading at least
+func (sub *subscriber) send(line string) bool {
+	if atomic.LoadInt32(&sub.dropped) != 0 {
+		return false
+	}
+	select {
+	case sub.out <- line:
+		return true
+	default:
+		if atomic.CompareAndSwapInt32(&sub.dropped, 0, 1) {
+			log.Printf("disconnecting slow subscriber %s", sub.conn.RemoteAddr())
+			sub.conn.Close()
+		}
+		return false
+	}
+}
+
+// writeLoop writes queued lines until the queue is closed, flushing
+// whenever it is empty
+func (sub *subscriber) writeLoop(w *bufio.Writer, done chan<- struct{}) {
+	defer close(done)
+	for line := range sub.out {
+		if _, err := w.WriteString(line + "\n"); err != nil {
+			break
+		}
+		if len(sub.out) == 0 {
+			if err := w.Flush(); err != nil {
+				break
+			}
+		}
+	}
+	// Let the connection end even if the client stopped reading
+	for range sub.out {
+	}
+}
+
+// broker routes published messages to subscribers
+type broker struct {
+	mu       sync.RWMutex
+	channels map[string]map[*subscriber]bool
+	patterns map[string]map[*subscriber]bool
+	buffer   int
+}
+
+// newBroker creates a broker queuing up to buffer lines per subscriber
+func newBroker(buffer int) *broker {
+	if buffer <= 0 {
+		buffer = DefaultPubSubBuffer
+	}
+	return &broker{
+		channels: make(map[string]map[*subscriber]bool),
+		patterns: make(map[string]map[*subscriber]bool),
+		buffer:   buffer,
+	}
+}
+
+// publish sends a message to the subscribers of channel and of the
+// patterns matching it, returning how many received it
+func (b *broker) publish(channel, message string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	n := 0
+	for sub := range b.channels[channel] {
+		if sub.send("message " + channel + " " + message) {
+			n++
+		}
+	}
+	for pattern, subs := range b.patterns {
+		if !store.MatchPattern(pattern, channel) {
+			continue
+		}
+		for sub := range subs {
+			if sub.send("pmessage " + pattern + " " + channel + " " + message) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// subscribe adds channels, or patterns with pattern set, to a subscriber,
+// confirming each
+func (b *broker) subscribe(sub *subscriber, names []string, pattern bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	kind, index, own := "subscribe", b.channels, sub.channels
+	if pattern {
+		kind, index, own = "psubscribe", b.patterns, sub.patterns
+	}
+	for _, name := range names {
+		if !own[name] {
+			own[name] = true
+			if index[name] == nil {
+				index[name] = make(map[*subscriber]bool)
+			}
+			index[name][sub] = true
+		}
+		sub.send(fmt.Sprintf("%s %s %d", kind, name, sub.count()))
+	}
+}
+
+// unsubscribe removes channels, or patterns with pattern set, from a
+// subscriber, confirming each; no names removes all of them
+func (b *broker) unsubscribe(sub *subscriber, names []string, pattern bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	kind, index, own := "unsubscribe", b.channels, sub.channels
+	if pattern {
+		kind, index, own = "punsubscribe", b.patterns, sub.patterns
+	}
+	if len(names) == 0 {
+		for name := range own {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			sub.send(fmt.Sprintf("%s (nil) %d", kind, sub.count()))
+		}
+	}
+	for _, name := range names {
+		if own[name] {
+			delete(own, name)
+			delete(index[name], sub)
+			if len(index[name]) == 0 {
+				delete(index, name)
+			}
+		}
+		sub.send(fmt.Sprintf("%s %s %d", kind, name, sub.count()))
+	}
+}
+
+// remove drops every subscription of a closing connection and closes its
+// queue
+func (b *broker) remove(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for name := range sub.channels {
+		delete(b.channels[name], sub)
+		if len(b.channels[name]) == 0 {
+			delete(b.channels, name)
+		}
+	}
+	for name := range sub.patterns {
+		delete(b.patterns[name], sub)
+		if len(b.patterns[name]) == 0 {
+			delete(b.patterns, name)
+		}
+	}
+	sub.channels, sub.patterns = nil, nil
+	atomic.StoreInt32(&sub.dropped, 1)
+	close(sub.out)
+}
+
+// reply queues the reply to a command of a connection in subscriber mode
+func (b *broker) reply(sub *subscriber, line string) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	sub.send(line)
+}
+
+// pubsubCommand runs SUBSCRIBE, UNSUBSCRIBE, PSUBSCRIBE and PUNSUBSCRIBE,
+// switching the connection to subscriber mode. Their replies are queued
+// directly, so it returns "" unless the command is invalid.
+func (s *Server) pubsubCommand(sess *session, cmd string, parts []string) string {
+	subscribing := cmd == "SUBSCRIBE" || cmd == "PSUBSCRIBE"
+	if subscribing && len(parts) < 2 {
+		return fmt.Sprintf("-ERR %s requires at least one channel", cmd)
+	}
+	if sess.sub == nil {
+		sess.startSubscriber(s.pubsub.buffer)
+	}
+
+	pattern := cmd[0] == 'P'
+	if subscribing {
+		s.pubsub.subscribe(sess.sub, parts[1:], pattern)
+	} else {
+		s.pubsub.unsubscribe(sess.sub, parts[1:], pattern)
+	}
+	return ""
+}
+
+// startSubscriber switches a connection to subscriber mode, flushing
+// what was already written to it
+func (sess *session) startSubscriber(buffer int) {
+	_ = sess.writer.Flush()
+	sess.sub = &subscriber{
+		conn:     sess.conn,
+		out:      make(chan string, buffer),
+		channels: make(map[string]bool),
+		patterns: make(map[string]bool),
+	}
+	sess.writerDone = make(chan struct{})
+	go sess.sub.writeLoop(sess.writer, sess.writerDone)
+}
+
+// subscribed reports whether the connection has subscriptions, which
+// restricts it to the subscriber mode commands
+func (s *Server) subscribed(sess *session) bool {
+	if sess.sub == nil {
+		return false
+	}
+	s.pubsub.mu.RLock()
+	defer s.pubsub.mu.RUnlock()
+	return sess.sub.count() > 0
+}
+
+// pubsubInfo runs PUBSUB CHANNELS [pattern], PUBSUB NUMSUB [channel ...]
+// and PUBSUB NUMPAT
+func (s *Server) pubsubInfo(parts []string) string {
+	if len(parts) < 2 {
+		return "-ERR PUBSUB requires a subcommand"
+	}
+	b := s.pubsub
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	switch strings.ToUpper(parts[1]) {
+	case "CHANNELS":
+		if len(parts) > 3 {
+			return "-ERR PUBSUB CHANNELS takes at most one pattern"
+		}
+		pattern := "*"
+		if len(parts) == 3 {
+			pattern = parts[2]
+		}
+		var channels []string
+		for name := range b.channels {
+			if store.MatchPattern(pattern, name) {
+				channels = append(channels, name)
+			}
+		}
+		if len(channels) == 0 {
+			return "(empty list)"
+		}
+		sort.Strings(channels)
+		return strings.Join(channels, "\n")
+
+	case "NUMSUB":
+		if len(parts) == 2 {
+			return "(empty list)"
+		}
+		results := make([]string, 0, 2*(len(parts)-2))
+		for _, name := range parts[2:] {
+			results = append(results, name, strconv.Itoa(len(b.channels[name])))
+		}
+		return strings.Join(results, "\n")
+
+	case "NUMPAT":
+		return strconv.Itoa(len(b.patterns))
+	}
+	return fmt.Sprintf("-ERR unknown PUBSUB subcommand '%s'", parts[1])
+}
+
+// keyspaceChannels returns the channels a keyspace event is published to:
+// __keyspace@<db>__:<key> with the event as message, and
+// __keyevent@<db>__:<event> with the key as message
+func keyspaceChannels(event engine.KeyEvent) (keyspace, keyevent string) {
+	return fmt.Sprintf("__keyspace@%d__:%s", event.DB, event.Key),
+		fmt.Sprintf("__keyevent@%d__:%s", event.DB, event.Class)
+}
+
+// forwardKeyspaceEvents publishes the keyspace events of the engine until
+// the subscription is closed
+func (s *Server) forwardKeyspaceEvents(sub *engine.EventSubscription) {
+	for event := range sub.C {
+		keyspace, keyevent := keyspaceChannels(event)
+		s.pubsub.publish(keyspace, event.Class.String())
+		s.pubsub.publish(keyevent, event.Key)
+	}
+}
@@ -0,0 +1,196 @@
+// pkg/api/pubsub_test.go
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lofoneh/kvlite/internal/config"
+)
+
+// readLine reads one pushed line
+func (c *testConn) readLine() string {
+	_ = c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("Failed to read pushed line: %v", err)
+	}
+	return strings.TrimSuffix(line, "\n")
+}
+
+func TestServer_PubSub(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	sub := h.dial()
+	defer sub.close()
+	psub := h.dial()
+	defer psub.close()
+	pub := h.dial()
+	defer pub.close()
+
+	if got := sub.sendLines("SUBSCRIBE news sports", 2); got[0] != "subscribe news 1" || got[1] != "subscribe sports 2" {
+		t.Fatalf("Unexpected SUBSCRIBE confirmations: %v", got)
+	}
+	if got := psub.send("PSUBSCRIBE new*"); got != "psubscribe new* 1" {
+		t.Fatalf("Unexpected PSUBSCRIBE confirmation: %q", got)
+	}
+
+	if got := pub.send("PUBLISH news hello  world"); got != "2" {
+		t.Errorf("Expected 2 receivers, got %s", got)
+	}
+	if got := sub.readLine(); got != "message news hello world" {
+		t.Errorf("Unexpected message: %q", got)
+	}
+	if got := psub.readLine(); got != "pmessage new* news hello world" {
+		t.Errorf("Unexpected pattern message: %q", got)
+	}
+	if got := pub.send("PUBLISH nobody hi"); got != "0" {
+		t.Errorf("Expected no receivers, got %s", got)
+	}
+
+	// Introspection
+	if got := pub.sendLines("PUBSUB CHANNELS", 2); got[0] != "news" || got[1] != "sports" {
+		t.Errorf("Unexpected channels: %v", got)
+	}
+	if got := pub.send("PUBSUB CHANNELS s*"); got != "sports" {
+		t.Errorf("Unexpected channels matching s*: %q", got)
+	}
+	if got := pub.sendLines("PUBSUB NUMSUB news other", 4); strings.Join(got, " ") != "news 1 other 0" {
+		t.Errorf("Unexpected NUMSUB: %v", got)
+	}
+	if got := pub.send("PUBSUB NUMPAT"); got != "1" {
+		t.Errorf("Expected 1 pattern, got %s", got)
+	}
+
+	// Subscriber mode only takes subscription commands
+	if got := sub.send("GET k"); !strings.HasPrefix(got, "-ERR") {
+		t.Errorf("Expected GET to be refused in subscriber mode, got %q", got)
+	}
+	if got := sub.send("PING"); got != "+PONG" {
+		t.Errorf("Expected PONG, got %q", got)
+	}
+
+	// Leaving every channel ends subscriber mode
+	if got := sub.sendLines("UNSUBSCRIBE", 2); got[0] != "unsubscribe news 1" || got[1] != "unsubscribe sports 0" {
+		t.Errorf("Unexpected UNSUBSCRIBE confirmations: %v", got)
+	}
+	if got := sub.send("SET k v"); got != "+OK" {
+		t.Errorf("Expected SET after unsubscribing, got %q", got)
+	}
+	if got := sub.send("UNSUBSCRIBE"); got != "unsubscribe (nil) 0" {
+		t.Errorf("Unexpected UNSUBSCRIBE without channels: %q", got)
+	}
+	if got := pub.send("PUBSUB CHANNELS"); got != "(empty list)" {
+		t.Errorf("Expected no channels, got %q", got)
+	}
+
+	// A closed connection leaves its patterns
+	psub.close()
+	waitFor(t, func() bool { return pub.send("PUBSUB NUMPAT") == "0" })
+}
+
+func TestServer_PubSubInMulti(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	sub := h.dial()
+	defer sub.close()
+	sub.send("SUBSCRIBE events")
+
+	c := h.dial()
+	defer c.close()
+	c.send("MULTI")
+	if got := c.send("PUBLISH events queued"); got != "+QUEUED" {
+		t.Fatalf("Expected PUBLISH to be queued, got %q", got)
+	}
+	if got := c.send("SUBSCRIBE x"); !strings.HasPrefix(got, "-ERR") {
+		t.Errorf("Expected SUBSCRIBE to be refused in MULTI, got %q", got)
+	}
+	c.send("DISCARD")
+
+	c.send("MULTI")
+	c.send("PUBLISH events queued")
+	if got := c.send("EXEC"); got != "1" {
+		t.Errorf("Expected EXEC to report 1 receiver, got %q", got)
+	}
+	if got := sub.readLine(); got != "message events queued" {
+		t.Errorf("Unexpected message: %q", got)
+	}
+}
+
+func TestServer_PubSubSlowConsumer(t *testing.T) {
+	h := setupTestHelperWithConfig(t, &config.Config{Host: "localhost", Port: 0, PubSubBuffer: 4})
+	defer h.close()
+
+	slow := h.dial()
+	defer slow.close()
+	slow.send("SUBSCRIBE firehose")
+
+	// The subscriber never reads: once the socket and its queue are full it
+	// is disconnected instead of holding up the publisher
+	pub := h.dial()
+	defer pub.close()
+	payload := strings.Repeat("x", 64*1024)
+	dropped := false
+	for i := 0; i < 1000 && !dropped; i++ {
+		dropped = pub.send("PUBLISH firehose "+payload) == "0"
+	}
+	if !dropped {
+		t.Fatal("Expected the slow subscriber to be disconnected")
+	}
+	waitFor(t, func() bool {
+		return strings.Join(pub.sendLines("PUBSUB NUMSUB firehose", 2), " ") == "firehose 0"
+	})
+}
+
+func TestServer_KeyspaceEvents(t *testing.T) {
+	h := setupTestHelperWithConfig(t, &config.Config{Host: "localhost", Port: 0, KeyspaceEvents: "set,expired"})
+	defer h.close()
+
+	sub := h.dial()
+	defer sub.close()
+	sub.sendLines("PSUBSCRIBE __keyevent@0__:* __keyspace@*__:user:*", 2)
+
+	c := h.dial()
+	defer c.close()
+	c.send("SET user:1 alice")
+	c.send("DEL user:1") // del isn't enabled
+	c.send("PSETEX user:2 1 bob")
+	time.Sleep(5 * time.Millisecond)
+	c.send("GET user:2")
+
+	want := []string{
+		"pmessage __keyspace@*__:user:* __keyspace@0__:user:1 set",
+		"pmessage __keyevent@0__:* __keyevent@0__:set user:1",
+		"pmessage __keyspace@*__:user:* __keyspace@0__:user:2 set",
+		"pmessage __keyevent@0__:* __keyevent@0__:set user:2",
+		"pmessage __keyspace@*__:user:* __keyspace@0__:user:2 expired",
+		"pmessage __keyevent@0__:* __keyevent@0__:expired user:2",
+	}
+	for _, w := range want {
+		if got := sub.readLine(); got != w {
+			t.Errorf("Expected %q, got %q", w, got)
+		}
+	}
+}
+
+func TestServer_KeyspaceEventsInvalid(t *testing.T) {
+	cfg := &config.Config{Host: "localhost", Port: 0, KeyspaceEvents: "bogus"}
+	server := NewServer(cfg, nil)
+	if err := server.Start(); err == nil || !strings.Contains(err.Error(), "keyspace events") {
+		t.Errorf("Expected an invalid configuration error, got %v", err)
+	}
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatal("Condition not met within a second")
+}
@@ -0,0 +1,74 @@
+// pkg/api/quota.go
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// quotaCommand runs QUOTA GET and QUOTA SET on the connection's database:
+//
+//	QUOTA GET
+//	QUOTA SET [KEYS n] [BYTES n] [OPS n]
+//
+// SET only changes the limits it names, 0 removes a limit. The limits of
+// every database are saved to the configured quota file.
+func (s *Server) quotaCommand(sess *session, parts []string) string {
+	if len(parts) < 2 {
+		return "-ERR QUOTA requires GET or SET"
+	}
+
+	switch strings.ToUpper(parts[1]) {
+	case "GET":
+		if len(parts) != 2 {
+			return "-ERR QUOTA GET takes no arguments"
+		}
+		limits, usage := sess.db.Quota(), sess.db.QuotaUsage()
+		return strings.Join([]string{
+			"keys", strconv.Itoa(usage.Keys),
+			"max_keys", strconv.Itoa(limits.MaxKeys),
+			"bytes", strconv.FormatInt(usage.Bytes, 10),
+			"max_bytes", strconv.FormatInt(limits.MaxBytes, 10),
+			"ops_per_sec", strconv.Itoa(usage.OpsPerSec),
+			"max_ops_per_sec", strconv.Itoa(limits.MaxOpsPerSec),
+		}, "\n")
+
+	case "SET":
+		if len(parts) < 4 || len(parts)%2 != 0 {
+			return "-ERR QUOTA SET requires limit and value pairs"
+		}
+
+		s.quotaMu.Lock()
+		defer s.quotaMu.Unlock()
+
+		limits := sess.db.Quota()
+		for i := 2; i < len(parts); i += 2 {
+			n, err := strconv.ParseInt(parts[i+1], 10, 64)
+			if err != nil || n < 0 {
+				return "-ERR invalid limit"
+			}
+			switch strings.ToUpper(parts[i]) {
+			case "KEYS":
+				limits.MaxKeys = int(n)
+			case "BYTES":
+				limits.MaxBytes = n
+			case "OPS":
+				limits.MaxOpsPerSec = int(n)
+			default:
+				return fmt.Sprintf("-ERR unknown limit '%s'", parts[i])
+			}
+		}
+
+		if err := sess.db.SetQuota(limits); err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		s.cfg.Quotas = s.engine.Quotas()
+		if err := s.cfg.SaveQuotas(); err != nil {
+			return fmt.Sprintf("-ERR failed to save quotas: %v", err)
+		}
+		return "+OK"
+	}
+
+	return fmt.Sprintf("-ERR unknown QUOTA subcommand '%s'", parts[1])
+}
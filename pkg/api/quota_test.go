@@ -0,0 +1,89 @@
+// pkg/api/quota_test.go
+package api
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lofoneh/kvlite/internal/config"
+)
+
+func TestServer_QUOTA(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	quotaFile := filepath.Join(t.TempDir(), "kvlite.quotas")
+	h.server.quotaMu.Lock()
+	h.server.cfg.QuotaFile = quotaFile
+	h.server.quotaMu.Unlock()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("SELECT 2")
+	if r := c.send("QUOTA SET KEYS 2 OPS 1000"); r != "+OK" {
+		t.Fatalf("QUOTA SET failed: %s", r)
+	}
+	c.send("SET a 1")
+	c.send("SET b 1")
+
+	// New keys are rejected, existing ones can change
+	if r := c.send("SET c 1"); r != "-ERR quota exceeded" {
+		t.Errorf("Expected quota error, got %s", r)
+	}
+	if r := c.send("SADD s x"); r != "-ERR quota exceeded" {
+		t.Errorf("Expected quota error for SADD, got %s", r)
+	}
+	if r := c.send("SET a 2"); r != "+OK" {
+		t.Errorf("Updating an existing key failed: %s", r)
+	}
+
+	// Inside MULTI each command is checked on its own
+	c.send("MULTI")
+	c.send("DEL a")
+	c.send("SET c 1")
+	c.send("SET d 1")
+	replies := c.sendLines("EXEC", 3)
+	if strings.Join(replies, ",") != "+OK,+OK,-ERR quota exceeded" {
+		t.Errorf("Unexpected EXEC replies: %v", replies)
+	}
+
+	replies = c.sendLines("QUOTA GET", 12)
+	usage := map[string]string{}
+	for i := 0; i+1 < len(replies); i += 2 {
+		usage[replies[i]] = replies[i+1]
+	}
+	if usage["keys"] != "2" || usage["max_keys"] != "2" || usage["max_bytes"] != "0" || usage["max_ops_per_sec"] != "1000" {
+		t.Errorf("Unexpected QUOTA GET: %v", usage)
+	}
+	if usage["bytes"] == "0" || usage["ops_per_sec"] == "0" {
+		t.Errorf("Expected usage to be counted: %v", usage)
+	}
+
+	// Database 0 has no quota
+	if r := h.sendCommand("SET c 1"); r != "+OK" {
+		t.Errorf("Quota applied to another database: %s", r)
+	}
+
+	// Limits are saved with the config
+	saved := &config.Config{QuotaFile: quotaFile}
+	if err := saved.LoadQuotas(); err != nil {
+		t.Fatalf("LoadQuotas failed: %v", err)
+	}
+	if q := saved.Quotas[2]; q.MaxKeys != 2 || q.MaxOpsPerSec != 1000 || len(saved.Quotas) != 1 {
+		t.Errorf("Unexpected saved quotas: %v", saved.Quotas)
+	}
+
+	// SET only changes the limits it names, 0 removes one
+	c.send("QUOTA SET KEYS 0")
+	if r := c.send("SET e 1"); r != "+OK" {
+		t.Errorf("Expected SET to work without a key limit, got %s", r)
+	}
+
+	for _, cmd := range []string{"QUOTA", "QUOTA SET", "QUOTA SET KEYS", "QUOTA SET KEYS -1", "QUOTA SET FOO 1", "QUOTA BAR"} {
+		if r := c.send(cmd); !strings.HasPrefix(r, "-ERR") {
+			t.Errorf("%s: expected error, got %s", cmd, r)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+// pkg/api/script.go
+package api
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lofoneh/kvlite/internal/engine"
+	"github.com/lofoneh/kvlite/internal/script"
+)
+
+// DefaultScriptTimeout is how long a script may run when the
+// configuration doesn't say
+const DefaultScriptTimeout = 5 * time.Second
+
+// scriptCommands are the commands whose lines are split with quoted
+// arguments, so that a script can hold spaces
+var scriptCommands = map[string]bool{
+	"EVAL":    true,
+	"EVALSHA": true,
+	"SCRIPT":  true,
+}
+
+// scriptCache holds the compiled scripts by the SHA1 digest of their
+// source
+type scriptCache struct {
+	mu      sync.RWMutex
+	scripts map[string]*script.Script
+}
+
+func newScriptCache() *scriptCache {
+	return &scriptCache{scripts: make(map[string]*script.Script)}
+}
+
+// load compiles a script unless it is cached, and returns its digest
+func (c *scriptCache) load(src string) (string, *script.Script, error) {
+	sum := sha1.Sum([]byte(src))
+	sha := hex.EncodeToString(sum[:])
+	if sc := c.get(sha); sc != nil {
+		return sha, sc, nil
+	}
+
+	sc, err := script.Compile(src)
+	if err != nil {
+		return "", nil, err
+	}
+	c.mu.Lock()
+	c.scripts[sha] = sc
+	c.mu.Unlock()
+	return sha, sc, nil
+}
+
+// get returns a cached script, nil if there is none
+func (c *scriptCache) get(sha string) *script.Script {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.scripts[strings.ToLower(sha)]
+}
+
+// flush removes every cached script
+func (c *scriptCache) flush() {
+	c.mu.Lock()
+	c.scripts = make(map[string]*script.Script)
+	c.mu.Unlock()
+}
+
+// scriptCommand runs SCRIPT LOAD, SCRIPT EXISTS and SCRIPT FLUSH
+func (s *Server) scriptCommand(parts []string) string {
+	if len(parts) < 2 {
+		return "-ERR SCRIPT requires LOAD, EXISTS or FLUSH"
+	}
+
+	switch strings.ToUpper(parts[1]) {
+	case "LOAD":
+		if len(parts) != 3 {
+			return "-ERR SCRIPT LOAD requires a script"
+		}
+		sha, _, err := s.scripts.load(parts[2])
+		if err != nil {
+			return fmt.Sprintf("-ERR script error: %v", err)
+		}
+		return sha
+
+	case "EXISTS":
+		if len(parts) < 3 {
+			return "-ERR SCRIPT EXISTS requires at least one digest"
+		}
+		results := make([]string, 0, len(parts)-2)
+		for _, sha := range parts[2:] {
+			if s.scripts.get(sha) != nil {
+				results = append(results, "1")
+			} else {
+				results = append(results, "0")
+			}
+		}
+		return strings.Join(results, "\n")
+
+	case "FLUSH":
+		s.scripts.flush()
+		return "+OK"
+	}
+
+	return fmt.Sprintf("-ERR unknown SCRIPT subcommand '%s'", parts[1])
+}
+
+// eval runs EVAL and EVALSHA:
+//
+//	EVAL script numkeys [key ...] [arg ...]
+//	EVALSHA sha1 numkeys [key ...] [arg ...]
+//
+// The script runs with exclusive access to the engine, in the transaction
+// of EXEC when it was queued by MULTI. Its writes are logged as one WAL
+// batch like those of EXEC, so replay doesn't run the script again; as in
+// EXEC they are kept if the script fails halfway, times out or runs out of
+// memory.
+func (s *Server) eval(db dataStore, cmd string, parts []string) string {
+	if len(parts) < 3 {
+		return fmt.Sprintf("-ERR %s requires a script and the number of keys", cmd)
+	}
+	numKeys, err := strconv.Atoi(parts[2])
+	if err != nil || numKeys < 0 {
+		return "-ERR invalid number of keys"
+	}
+	if numKeys > len(parts)-3 {
+		return "-ERR number of keys can't be greater than the number of arguments"
+	}
+
+	var sc *script.Script
+	if cmd == "EVALSHA" {
+		if sc = s.scripts.get(parts[1]); sc == nil {
+			return "-NOSCRIPT No matching script. Use EVAL."
+		}
+	} else if _, sc, err = s.scripts.load(parts[1]); err != nil {
+		return fmt.Sprintf("-ERR script error: %v", err)
+	}
+	keys, args := parts[3:3+numKeys], parts[3+numKeys:]
+
+	switch db := db.(type) {
+	case *engine.Tx:
+		return s.runScript(db, sc, keys, args)
+	case *engine.Engine:
+		var reply string
+		err := db.Atomic(func(tx *engine.Tx) error {
+			reply = s.runScript(tx, sc, keys, args)
+			return nil
+		})
+		if err != nil {
+			return errReply("script failed", err)
+		}
+		return reply
+	}
+	return fmt.Sprintf("-ERR %s is not available here", cmd)
+}
+
+// runScript runs a script in a transaction and converts its result to a
+// reply
+func (s *Server) runScript(tx *engine.Tx, sc *script.Script, keys, args []string) string {
+	timeout := s.cfg.ScriptTimeout
+	if timeout == 0 {
+		timeout = DefaultScriptTimeout
+	}
+
+	kv := s.scriptAPI(tx)
+	result, err := sc.Run(script.RunOptions{
+		Keys:     keys,
+		Args:     args,
+		Globals:  map[string]script.Value{"kv": kv, "redis": kv},
+		Deadline: time.Now().Add(timeout),
+	})
+
+	var e *script.Error
+	switch {
+	case errors.Is(err, script.ErrTimeout):
+		return fmt.Sprintf("-ERR script timed out after %v", timeout)
+	case errors.Is(err, script.ErrMemory):
+		return fmt.Sprintf("-ERR script used more than %d MB of memory", script.DefaultMaxMemory>>20)
+	case errors.As(err, &e):
+		// Errors raised with an error reply, such as those of kv.call, are
+		// returned as they are
+		if t, ok := e.Value.(*script.Table); ok {
+			if msg, ok := t.Get("err").(string); ok {
+				return "-" + msg
+			}
+		}
+		return fmt.Sprintf("-ERR script error: %v", err)
+	case err != nil:
+		return fmt.Sprintf("-ERR script error: %v", err)
+	}
+	return scriptReply(result)
+}
+
+// scriptAPI returns the kv table of functions scripts use to run commands
+// in tx
+func (s *Server) scriptAPI(tx *engine.Tx) *script.Table {
+	kv := script.NewTable()
+	set := func(name string, fn func(args []script.Value) ([]script.Value, error)) {
+		_ = kv.Set(name, &script.GoFunction{Name: name, Fn: fn})
+	}
+
+	call := func(raise bool) func(args []script.Value) ([]script.Value, error) {
+		return func(args []script.Value) ([]script.Value, error) {
+			reply := s.scriptCall(tx, args)
+			if reply == "-ERR key not found" {
+				// A missing key reads as (nil) does
+				return []script.Value{false}, nil
+			}
+			if strings.HasPrefix(reply, "-") {
+				t := errorTable(reply[1:])
+				if raise {
+					return nil, &script.Error{Msg: reply[1:], Value: t}
+				}
+				return []script.Value{t}, nil
+			}
+			return []script.Value{replyValue(reply)}, nil
+		}
+	}
+	set("call", call(true))
+	set("pcall", call(false))
+
+	set("error_reply", func(args []script.Value) ([]script.Value, error) {
+		msg := script.ToString(valueAt(args, 0))
+		if !strings.HasPrefix(msg, "ERR ") {
+			msg = "ERR " + msg
+		}
+		return []script.Value{errorTable(msg)}, nil
+	})
+	set("status_reply", func(args []script.Value) ([]script.Value, error) {
+		t := script.NewTable()
+		_ = t.Set("ok", script.ToString(valueAt(args, 0)))
+		return []script.Value{t}, nil
+	})
+	set("sha1hex", func(args []script.Value) ([]script.Value, error) {
+		sum := sha1.Sum([]byte(script.ToString(valueAt(args, 0))))
+		return []script.Value{hex.EncodeToString(sum[:])}, nil
+	})
+	return kv
+}
+
+// scriptCall runs a command for kv.call and kv.pcall. Only the commands
+// that may be queued by MULTI are available, apart from SELECT and the
+// scripting commands themselves, see callable.
+func (s *Server) scriptCall(tx *engine.Tx, args []script.Value) string {
+	if len(args) == 0 {
+		return "-ERR kv.call requires a command"
+	}
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		switch arg.(type) {
+		case string, float64:
+			parts[i] = script.ToString(arg)
+		default:
+			return "-ERR command arguments must be strings or numbers"
+		}
+	}
+
+	cmd := strings.ToUpper(parts[0])
+	if !s.callable(cmd) {
+		return fmt.Sprintf("-ERR command '%s' cannot be used in scripts", cmd)
+	}
+	return s.executeCommand(tx, cmd, parts)
+}
+
+// errorTable returns the {err = msg} table of an error reply
+func errorTable(msg string) *script.Table {
+	t := script.NewTable()
+	_ = t.Set("err", msg)
+	return t
+}
+
+// valueAt returns values[i], nil past the end
+func valueAt(values []script.Value, i int) script.Value {
+	if i < len(values) {
+		return values[i]
+	}
+	return nil
+}
+
+// replyValue converts a reply to a script value: (nil) is false, status
+// replies are {ok = status} tables and multi-line replies are arrays of
+// lines. Everything else, integers included, is a string.
+func replyValue(reply string) script.Value {
+	switch {
+	case reply == "(nil)":
+		return false
+	case reply == "(empty list)":
+		return script.NewTable()
+	case strings.HasPrefix(reply, "+"):
+		t := script.NewTable()
+		_ = t.Set("ok", reply[1:])
+		return t
+	case strings.Contains(reply, "\n"):
+		t := script.NewTable()
+		for _, line := range strings.Split(reply, "\n") {
+			if line == "(nil)" {
+				t.Append(false)
+			} else {
+				t.Append(line)
+			}
+		}
+		return t
+	}
+	return reply
+}
+
+// scriptReply converts the result of a script to a reply: numbers are
+// truncated to integers, true is 1, false and nil are (nil), and arrays
+// are returned one item per line
+func scriptReply(v script.Value) string {
+	switch v := v.(type) {
+	case nil:
+		return "(nil)"
+	case bool:
+		if v {
+			return "1"
+		}
+		return "(nil)"
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return script.ToString(v)
+		}
+		return strconv.FormatInt(int64(v), 10)
+	case string:
+		return v
+	case *script.Table:
+		if msg, ok := v.Get("err").(string); ok {
+			return "-" + msg
+		}
+		if status, ok := v.Get("ok").(string); ok {
+			return "+" + status
+		}
+		if v.Len() == 0 {
+			return "(empty list)"
+		}
+		lines := make([]string, v.Len())
+		for i := range lines {
+			lines[i] = scriptReply(v.Get(float64(i + 1)))
+		}
+		return strings.Join(lines, "\n")
+	}
+	return "(nil)"
+}
+
+// splitQuoted splits a command line into arguments like strings.Fields,
+// except that an argument starting with a double quote runs to the
+// closing quote. Inside quotes \", \\, \n, \r and \t are escapes.
+func splitQuoted(line string) ([]string, error) {
+	var parts []string
+	for i := 0; i < len(line); {
+		switch c := line[i]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+			continue
+
+		case c != '"':
+			start := i
+			for i < len(line) && !strings.ContainsRune(" \t\r\n", rune(line[i])) {
+				i++
+			}
+			parts = append(parts, line[start:i])
+			continue
+		}
+
+		var b strings.Builder
+		closed := false
+		for i++; i < len(line) && !closed; i++ {
+			c := line[i]
+			switch {
+			case c == '"':
+				closed = true
+			case c == '\\' && i+1 < len(line):
+				i++
+				switch line[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 'r':
+					b.WriteByte('\r')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(line[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		if !closed {
+			return nil, fmt.Errorf("unbalanced quotes")
+		}
+		parts = append(parts, b.String())
+	}
+	return parts, nil
+}
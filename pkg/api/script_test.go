@@ -0,0 +1,230 @@
+// pkg/api/script_test.go
+package api
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lofoneh/kvlite/internal/config"
+	"github.com/lofoneh/kvlite/internal/engine"
+)
+
+func TestServer_Eval(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{`EVAL "return kv.call('SET', KEYS[1], ARGV[1])" 1 greeting "hello world"`, "+OK"},
+		{`EVAL "return redis.call('GET', KEYS[1])" 1 greeting`, "hello world"},
+		{`EVAL "return kv.call('GET', 'missing')" 0`, "(nil)"},
+		{`EVAL "return tonumber(kv.call('INCRBY', 'n', 5)) * 2" 0`, "10"},
+		{`EVAL "return 3.9" 0`, "3"},
+		{`EVAL "return true" 0`, "1"},
+		{`EVAL "return kv.status_reply('DONE')" 0`, "+DONE"},
+		{`EVAL "return kv.error_reply('custom failure')" 0`, "-ERR custom failure"},
+		{`EVAL "return #ARGV .. ':' .. ARGV[2]" 0 a b c`, "3:b"},
+		{`EVAL "local s = 'a\\nb' return #s" 0`, "3"},
+	}
+	for _, tt := range tests {
+		if got := c.send(tt.cmd); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.cmd, tt.want, got)
+		}
+	}
+
+	// Arrays are returned one item per line
+	c.send("RPUSH list a b c")
+	if got := c.sendLines(`EVAL "local items = kv.call('LRANGE', KEYS[1], 0, -1) table.insert(items, #items) return items" 1 list`, 4); strings.Join(got, " ") != "a b c 3" {
+		t.Errorf("Unexpected array reply: %v", got)
+	}
+	if got := c.send(`EVAL "return {}" 0`); got != "(empty list)" {
+		t.Errorf("Expected an empty list, got %q", got)
+	}
+}
+
+func TestServer_EvalErrors(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+	c.send("LPUSH list a")
+
+	tests := []struct {
+		cmd    string
+		prefix string
+	}{
+		{`EVAL "return kv.call('GET', 'list')"`, "-ERR EVAL requires"},
+		{`EVAL "return 1" 2 onlyone`, "-ERR number of keys"},
+		{`EVAL "return 1" x`, "-ERR invalid number of keys"},
+		{`EVAL "return 1`, "-ERR unbalanced quotes"},
+		{`EVAL "return +" 0`, "-ERR script error: line 1:"},
+		{`EVAL "x = 1" 0`, "-ERR script error: line 1: attempt to create global variable 'x'"},
+		// Errors of kv.call are returned as they are
+		{`EVAL "return kv.call('GET', 'list')" 0`, "-ERR WRONGTYPE"},
+		{`EVAL "return kv.call('SUBSCRIBE', 'ch')" 0`, "-ERR command 'SUBSCRIBE' cannot be used in scripts"},
+		{`EVAL "return kv.call('SELECT', 1)" 0`, "-ERR command 'SELECT' cannot be used in scripts"},
+		{`EVAL "return kv.call('EVAL', 'return 1', 0)" 0`, "-ERR command 'EVAL' cannot be used in scripts"},
+		{`EVAL "return kv.call({})" 0`, "-ERR command arguments must be strings or numbers"},
+	}
+	for _, tt := range tests {
+		if got := c.send(tt.cmd); !strings.HasPrefix(got, tt.prefix) {
+			t.Errorf("%s: expected a reply starting with %q, got %q", tt.cmd, tt.prefix, got)
+		}
+	}
+
+	// kv.pcall returns the error as a table instead
+	got := c.send(`EVAL "local r = kv.pcall('GET', 'list') return type(r) .. ' ' .. r.err" 0`)
+	if !strings.HasPrefix(got, "table ERR WRONGTYPE") {
+		t.Errorf("Expected pcall to return the error, got %q", got)
+	}
+}
+
+func TestServer_EvalSha(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	sha := c.send(`SCRIPT LOAD "return kv.call('INCR', KEYS[1])"`)
+	if len(sha) != 40 {
+		t.Fatalf("Expected a SHA1 digest, got %q", sha)
+	}
+	if got := c.send("EVALSHA " + sha + " 1 hits"); got != "1" {
+		t.Errorf("Expected 1, got %q", got)
+	}
+	if got := c.send("EVALSHA " + strings.ToUpper(sha) + " 1 hits"); got != "2" {
+		t.Errorf("Expected digests to be case insensitive, got %q", got)
+	}
+	if got := c.sendLines("SCRIPT EXISTS "+sha+" 0000", 2); got[0] != "1" || got[1] != "0" {
+		t.Errorf("Unexpected SCRIPT EXISTS: %v", got)
+	}
+
+	// EVAL caches the scripts it runs
+	c.send(`EVAL "return 'cached'" 0`)
+	if got := c.send("EVALSHA " + c.send(`EVAL "return kv.sha1hex(\"return 'cached'\")" 0`) + " 0"); got != "cached" {
+		t.Errorf("Expected the script run by EVAL to be cached, got %q", got)
+	}
+
+	if got := c.send("SCRIPT FLUSH"); got != "+OK" {
+		t.Errorf("Expected +OK, got %q", got)
+	}
+	if got := c.send("EVALSHA " + sha + " 1 hits"); !strings.HasPrefix(got, "-NOSCRIPT") {
+		t.Errorf("Expected NOSCRIPT after SCRIPT FLUSH, got %q", got)
+	}
+}
+
+func TestServer_EvalAtomic(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	// A read-modify-write that would lose updates if scripts interleaved
+	const src = `EVAL "local n = tonumber(kv.call('GET', KEYS[1]) or '0') kv.call('SET', KEYS[1], n + 1) return n + 1" 1 counter`
+	const clients, runs = 8, 50
+
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := h.dial()
+			defer c.close()
+			for j := 0; j < runs; j++ {
+				c.send(src)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := h.sendCommand("GET counter"); got != strconv.Itoa(clients*runs) {
+		t.Errorf("Expected %d, got %s", clients*runs, got)
+	}
+}
+
+func TestServer_EvalInMulti(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+	c.send("MULTI")
+	c.send("SET k 1")
+	if got := c.send(`EVAL "return kv.call('INCR', 'k')" 0`); got != "+QUEUED" {
+		t.Fatalf("Expected EVAL to be queued, got %q", got)
+	}
+	if got := c.sendLines("EXEC", 2); got[0] != "+OK" || got[1] != "2" {
+		t.Errorf("Unexpected EXEC replies: %v", got)
+	}
+	if got := c.send("SCRIPT FLUSH"); got != "+OK" {
+		t.Errorf("Expected SCRIPT outside MULTI to work, got %q", got)
+	}
+}
+
+func TestServer_EvalTimeout(t *testing.T) {
+	h := setupTestHelperWithConfig(t, &config.Config{Host: "localhost", Port: 0, ScriptTimeout: 50 * time.Millisecond})
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	start := time.Now()
+	got := c.send(`EVAL "kv.call('SET', 'before', 'kept') while true do end" 0`)
+	if got != "-ERR script timed out after 50ms" {
+		t.Errorf("Expected a timeout, got %q", got)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the script to stop near its time limit, took %v", elapsed)
+	}
+
+	// Writes made before the limit are kept, and the store is released
+	if got := c.send("GET before"); got != "kept" {
+		t.Errorf("Expected the write before the timeout to be kept, got %q", got)
+	}
+}
+
+func TestServer_EvalPartialWrites(t *testing.T) {
+	dir := t.TempDir()
+	eng, err := engine.New(engine.Options{WALPath: dir})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	s := NewServer(&config.Config{Host: "localhost", Port: 0}, eng)
+
+	// There is no rollback: writes made before a script fails are kept,
+	// whether it raises an error, runs out of memory or times out
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`EVAL "kv.call('SET', 'a', '1') error('boom')" 0`, "-ERR script error: line 1: boom"},
+		{`EVAL "kv.call('SET', 'b', '2') kv.call('INCR', 'b') kv.call('HSET', 'b', 'f', 'v')" 0`, "-ERR WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{`EVAL "kv.call('SET', 'c', '3') local s = string.rep('x', 1048576) while true do local t = s .. 'y' end" 0`, "-ERR script used more than 256 MB of memory"},
+	}
+	for _, tt := range tests {
+		if got := s.processCommand(newSession(eng), tt.src); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.src, tt.want, got)
+		}
+	}
+	eng.Close()
+
+	// and logged, so they survive a restart
+	eng, err = engine.New(engine.Options{WALPath: dir})
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer eng.Close()
+	for key, want := range map[string]string{"a": "1", "b": "3", "c": "3"} {
+		if got, _ := eng.Get(key); got != want {
+			t.Errorf("Expected %s=%s after restart, got %q", key, want, got)
+		}
+	}
+}
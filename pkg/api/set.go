@@ -0,0 +1,191 @@
+// pkg/api/set.go
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// setStore is the part of dataStore used by the set commands
+type setStore interface {
+	SAdd(key string, members ...string) (int, error)
+	SRem(key string, members ...string) (int, error)
+	SIsMember(key, member string) (bool, error)
+	SMIsMember(key string, members []string) ([]bool, error)
+	SMembers(key string) ([]string, error)
+	SCard(key string) (int, error)
+	SPop(key string, count int) ([]string, error)
+	SRandMember(key string, count int) ([]string, error)
+	SInter(keys ...string) ([]string, error)
+	SUnion(keys ...string) ([]string, error)
+	SDiff(keys ...string) ([]string, error)
+	SInterStore(dst string, keys ...string) (int, error)
+	SUnionStore(dst string, keys ...string) (int, error)
+	SDiffStore(dst string, keys ...string) (int, error)
+	SScan(key string, cursor int, pattern string, count int) (int, []string, error)
+}
+
+// executeSetCommand runs a set command
+func executeSetCommand(db setStore, cmd string, parts []string) string {
+	switch cmd {
+	case "SADD", "SREM":
+		if len(parts) < 3 {
+			return fmt.Sprintf("-ERR %s requires key and at least one member", cmd)
+		}
+		var n int
+		var err error
+		if cmd == "SADD" {
+			n, err = db.SAdd(parts[1], parts[2:]...)
+		} else {
+			n, err = db.SRem(parts[1], parts[2:]...)
+		}
+		if err != nil {
+			return errReply("failed to update set", err)
+		}
+		return strconv.Itoa(n)
+
+	case "SISMEMBER":
+		if len(parts) != 3 {
+			return "-ERR SISMEMBER requires key and member"
+		}
+		ok, err := db.SIsMember(parts[1], parts[2])
+		if err != nil {
+			return errReply("failed to get", err)
+		}
+		if ok {
+			return "1"
+		}
+		return "0"
+
+	case "SMISMEMBER":
+		if len(parts) < 3 {
+			return "-ERR SMISMEMBER requires key and at least one member"
+		}
+		found, err := db.SMIsMember(parts[1], parts[2:])
+		if err != nil {
+			return errReply("failed to get", err)
+		}
+		results := make([]string, len(found))
+		for i, ok := range found {
+			results[i] = "0"
+			if ok {
+				results[i] = "1"
+			}
+		}
+		return strings.Join(results, "\n")
+
+	case "SMEMBERS":
+		if len(parts) != 2 {
+			return "-ERR SMEMBERS requires key"
+		}
+		return listReply(db.SMembers(parts[1]))
+
+	case "SCARD":
+		if len(parts) != 2 {
+			return "-ERR SCARD requires key"
+		}
+		n, err := db.SCard(parts[1])
+		if err != nil {
+			return errReply("failed to get", err)
+		}
+		return strconv.Itoa(n)
+
+	case "SPOP", "SRANDMEMBER":
+		if len(parts) != 2 && len(parts) != 3 {
+			return fmt.Sprintf("-ERR %s requires key and optional count", cmd)
+		}
+		count := 1
+		if len(parts) == 3 {
+			var err error
+			count, err = strconv.Atoi(parts[2])
+			if err != nil || (cmd == "SPOP" && count < 0) {
+				return "-ERR count must be a non-negative integer"
+			}
+		}
+		var members []string
+		var err error
+		if cmd == "SPOP" {
+			members, err = db.SPop(parts[1], count)
+		} else {
+			members, err = db.SRandMember(parts[1], count)
+		}
+		if len(parts) == 3 {
+			return listReply(members, err)
+		}
+		if err != nil {
+			return errReply("failed to get", err)
+		}
+		if len(members) == 0 {
+			return "(nil)"
+		}
+		return members[0]
+
+	case "SINTER", "SUNION", "SDIFF":
+		if len(parts) < 2 {
+			return fmt.Sprintf("-ERR %s requires at least one key", cmd)
+		}
+		switch cmd {
+		case "SINTER":
+			return listReply(db.SInter(parts[1:]...))
+		case "SUNION":
+			return listReply(db.SUnion(parts[1:]...))
+		default:
+			return listReply(db.SDiff(parts[1:]...))
+		}
+
+	case "SINTERSTORE", "SUNIONSTORE", "SDIFFSTORE":
+		if len(parts) < 3 {
+			return fmt.Sprintf("-ERR %s requires destination and at least one key", cmd)
+		}
+		var n int
+		var err error
+		switch cmd {
+		case "SINTERSTORE":
+			n, err = db.SInterStore(parts[1], parts[2:]...)
+		case "SUNIONSTORE":
+			n, err = db.SUnionStore(parts[1], parts[2:]...)
+		default:
+			n, err = db.SDiffStore(parts[1], parts[2:]...)
+		}
+		if err != nil {
+			return errReply("failed to store", err)
+		}
+		return strconv.Itoa(n)
+
+	case "SSCAN":
+		if len(parts) < 3 {
+			return "-ERR SSCAN requires key and cursor"
+		}
+		cursor, err := strconv.Atoi(parts[2])
+		if err != nil || cursor < 0 {
+			return "-ERR invalid cursor"
+		}
+		pattern, count, err := parseScanOptions(parts[3:])
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		next, members, err := db.SScan(parts[1], cursor, pattern, count)
+		if err != nil {
+			return errReply("failed to scan", err)
+		}
+		result := strconv.Itoa(next)
+		if len(members) > 0 {
+			result += "\n" + strings.Join(members, "\n")
+		}
+		return result
+	}
+
+	return fmt.Sprintf("-ERR unknown command '%s'", cmd)
+}
+
+// listReply formats members one per line, or (empty list)
+func listReply(members []string, err error) string {
+	if err != nil {
+		return errReply("failed to get", err)
+	}
+	if len(members) == 0 {
+		return "(empty list)"
+	}
+	return strings.Join(members, "\n")
+}
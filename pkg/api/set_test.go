@@ -0,0 +1,81 @@
+// pkg/api/set_test.go
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServer_SetCommands(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	if r := h.sendCommand("SADD tags go db go"); r != "2" {
+		t.Errorf("Expected 2 added, got: %s", r)
+	}
+	if r := h.sendCommand("SISMEMBER tags go"); r != "1" {
+		t.Errorf("Expected 1, got: %s", r)
+	}
+	if r := h.sendCommand("SISMEMBER tags rust"); r != "0" {
+		t.Errorf("Expected 0, got: %s", r)
+	}
+	if r := h.sendCommand("SCARD tags"); r != "2" {
+		t.Errorf("Expected SCARD 2, got: %s", r)
+	}
+	if r := h.sendCommand("SREM tags db rust"); r != "1" {
+		t.Errorf("Expected 1 removed, got: %s", r)
+	}
+	if r := h.sendCommand("SPOP tags"); r != "go" {
+		t.Errorf("Expected go, got: %s", r)
+	}
+	if r := h.sendCommand("SPOP tags"); r != "(nil)" {
+		t.Errorf("Expected (nil) from missing set, got: %s", r)
+	}
+	if r := h.sendCommand("SRANDMEMBER tags 3"); r != "(empty list)" {
+		t.Errorf("Expected (empty list), got: %s", r)
+	}
+	if r := h.sendCommand("SPOP tags -1"); !strings.HasPrefix(r, "-ERR") {
+		t.Errorf("SPOP with a negative count should fail, got: %s", r)
+	}
+
+	h.sendCommand("SET str value")
+	if r := h.sendCommand("SADD str x"); !strings.Contains(r, "WRONGTYPE") {
+		t.Errorf("Expected WRONGTYPE, got: %s", r)
+	}
+}
+
+func TestServer_SetMultiline(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("SADD a x y z")
+	c.send("SADD b y z w")
+
+	steps := []struct {
+		cmd  string
+		want []string
+	}{
+		{"SMEMBERS a", []string{"x", "y", "z"}},
+		{"SMISMEMBER a x w", []string{"1", "0"}},
+		{"SINTER a b", []string{"y", "z"}},
+		{"SUNION a b", []string{"w", "x", "y", "z"}},
+		{"SDIFF a b", []string{"x"}},
+		{"SDIFFSTORE c b a", []string{"1"}},
+		{"SMEMBERS c", []string{"w"}},
+		{"SSCAN a 0 COUNT 2", []string{"2", "x", "y"}},
+		{"SSCAN a 2 COUNT 2", []string{"0", "z"}},
+	}
+	for _, step := range steps {
+		got := c.sendLines(step.cmd, len(step.want))
+		if strings.Join(got, ",") != strings.Join(step.want, ",") {
+			t.Errorf("%s: expected %v, got %v", step.cmd, step.want, got)
+		}
+	}
+
+	if r := c.send("SMEMBERS missing"); r != "(empty list)" {
+		t.Errorf("Expected (empty list), got: %s", r)
+	}
+}
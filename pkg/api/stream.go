@@ -0,0 +1,508 @@
+// pkg/api/stream.go
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lofoneh/kvlite/internal/engine"
+)
+
+// streamStore is the part of dataStore used by the stream commands
+type streamStore interface {
+	XAdd(key, id string, fields []string, opts engine.XAddOptions) (engine.StreamID, bool, error)
+	XTrim(key string, opts engine.XTrimOptions) (int, error)
+	XLen(key string) (int, error)
+	XLastID(key string) (engine.StreamID, error)
+	XRange(key string, start, end engine.StreamID, rev bool, count int) ([]engine.StreamEntry, error)
+	XRead(reads []engine.StreamRead, count int) ([]engine.StreamResult, error)
+	XGroupCreate(key, group, id string, mkstream bool) error
+	XGroupSetID(key, group, id string) error
+	XGroupDestroy(key, group string) (bool, error)
+	XReadGroup(group, consumer string, reads []engine.StreamRead, count int) ([]engine.StreamResult, error)
+	XAck(key, group string, ids ...engine.StreamID) (int, error)
+	XPending(key, group string) (engine.PendingSummary, error)
+	XPendingRange(key, group string, start, end engine.StreamID, count int, consumer string, minIdle time.Duration) ([]engine.PendingInfo, error)
+	XClaim(key, group, consumer string, minIdle time.Duration, ids []engine.StreamID, justID bool) ([]engine.StreamEntry, error)
+}
+
+// executeStreamCommand runs a stream command. XREAD and XREADGROUP don't
+// block here; they reply (nil) right away if there is nothing to read.
+func (s *Server) executeStreamCommand(db streamStore, cmd string, parts []string) string {
+	switch cmd {
+	case "XADD":
+		if len(parts) < 5 {
+			return "-ERR XADD requires key, ID and field value pairs"
+		}
+		var opts engine.XAddOptions
+		i := 2
+	options:
+		for ; i < len(parts); i++ {
+			switch strings.ToUpper(parts[i]) {
+			case "NOMKSTREAM":
+				opts.NoMkStream = true
+			case "MAXLEN", "MINID":
+				trim, next, err := parseTrimOptions(parts, i)
+				if err != nil {
+					return fmt.Sprintf("-ERR %v", err)
+				}
+				opts.Trim = trim
+				i = next - 1
+			default:
+				break options
+			}
+		}
+		fields := parts[min(i+1, len(parts)):]
+		if i >= len(parts) || len(fields) == 0 || len(fields)%2 != 0 {
+			return "-ERR XADD requires key, ID and field value pairs"
+		}
+		id, ok, err := db.XAdd(parts[1], parts[i], fields, opts)
+		if err != nil {
+			return errReply("failed to add", err)
+		}
+		if !ok {
+			return "(nil)"
+		}
+		s.waiters.notify(parts[1])
+		return id.String()
+
+	case "XTRIM":
+		if len(parts) < 4 {
+			return "-ERR XTRIM requires key, MAXLEN or MINID and a threshold"
+		}
+		trim, next, err := parseTrimOptions(parts, 2)
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		if next != len(parts) {
+			return "-ERR syntax error"
+		}
+		n, err := db.XTrim(parts[1], trim)
+		if err != nil {
+			return errReply("failed to trim", err)
+		}
+		return strconv.Itoa(n)
+
+	case "XLEN":
+		if len(parts) != 2 {
+			return "-ERR XLEN requires key"
+		}
+		n, err := db.XLen(parts[1])
+		if err != nil {
+			return errReply("failed to get", err)
+		}
+		return strconv.Itoa(n)
+
+	case "XRANGE", "XREVRANGE":
+		if len(parts) != 4 && len(parts) != 6 {
+			return fmt.Sprintf("-ERR %s requires key, two IDs and an optional COUNT", cmd)
+		}
+		count := 0
+		if len(parts) == 6 {
+			var err error
+			count, err = strconv.Atoi(parts[5])
+			if strings.ToUpper(parts[4]) != "COUNT" || err != nil || count < 0 {
+				return "-ERR syntax error"
+			}
+			if count == 0 {
+				return "(empty list)"
+			}
+		}
+		// XREVRANGE takes the end of the range first
+		from, to := parts[2], parts[3]
+		if cmd == "XREVRANGE" {
+			from, to = to, from
+		}
+		start, err := parseRangeID(from, false)
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		end, err := parseRangeID(to, true)
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		entries, err := db.XRange(parts[1], start, end, cmd == "XREVRANGE", count)
+		if err != nil {
+			return errReply("failed to get range", err)
+		}
+		return entriesReply(entries)
+
+	case "XREAD", "XREADGROUP":
+		return s.streamRead(db, cmd, parts, false)
+
+	case "XGROUP":
+		return xgroup(db, parts)
+
+	case "XACK":
+		if len(parts) < 4 {
+			return "-ERR XACK requires key, group and at least one ID"
+		}
+		ids, err := parseStreamIDs(parts[3:])
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		n, err := db.XAck(parts[1], parts[2], ids...)
+		if err != nil {
+			return errReply("failed to acknowledge", err)
+		}
+		return strconv.Itoa(n)
+
+	case "XPENDING":
+		return xpending(db, parts)
+
+	case "XCLAIM":
+		if len(parts) < 6 {
+			return "-ERR XCLAIM requires key, group, consumer, min-idle-time and at least one ID"
+		}
+		minIdle, err := strconv.ParseInt(parts[4], 10, 64)
+		if err != nil || minIdle < 0 {
+			return "-ERR min-idle-time must be a non-negative integer"
+		}
+		idArgs, justID := parts[5:], false
+		if strings.ToUpper(idArgs[len(idArgs)-1]) == "JUSTID" {
+			idArgs, justID = idArgs[:len(idArgs)-1], true
+		}
+		ids, err := parseStreamIDs(idArgs)
+		if err != nil || len(ids) == 0 {
+			return "-ERR invalid stream ID"
+		}
+		claimed, err := db.XClaim(parts[1], parts[2], parts[3], time.Duration(minIdle)*time.Millisecond, ids, justID)
+		if err != nil {
+			return errReply("failed to claim", err)
+		}
+		return entriesReply(claimed)
+	}
+
+	return fmt.Sprintf("-ERR unknown command '%s'", cmd)
+}
+
+// xgroup runs XGROUP CREATE, SETID or DESTROY
+func xgroup(db streamStore, parts []string) string {
+	if len(parts) < 4 {
+		return "-ERR XGROUP requires a subcommand, key and group"
+	}
+	key, group := parts[2], parts[3]
+
+	switch sub := strings.ToUpper(parts[1]); sub {
+	case "CREATE", "SETID":
+		if len(parts) < 5 {
+			return fmt.Sprintf("-ERR XGROUP %s requires key, group and ID", sub)
+		}
+		var err error
+		switch {
+		case sub == "SETID" && len(parts) == 5:
+			err = db.XGroupSetID(key, group, parts[4])
+		case sub == "CREATE" && len(parts) == 5:
+			err = db.XGroupCreate(key, group, parts[4], false)
+		case sub == "CREATE" && len(parts) == 6 && strings.ToUpper(parts[5]) == "MKSTREAM":
+			err = db.XGroupCreate(key, group, parts[4], true)
+		default:
+			return "-ERR syntax error"
+		}
+		if err != nil {
+			return errReply("failed to update group", err)
+		}
+		return "+OK"
+
+	case "DESTROY":
+		if len(parts) != 4 {
+			return "-ERR XGROUP DESTROY requires key and group"
+		}
+		ok, err := db.XGroupDestroy(key, group)
+		if err != nil {
+			return errReply("failed to destroy group", err)
+		}
+		if ok {
+			return "1"
+		}
+		return "0"
+	}
+	return fmt.Sprintf("-ERR unknown XGROUP subcommand '%s'", parts[1])
+}
+
+// xpending runs XPENDING key group, which summarizes the pending entries,
+// or XPENDING key group [IDLE min-idle-time] start end count [consumer],
+// which lists them
+func xpending(db streamStore, parts []string) string {
+	if len(parts) < 3 {
+		return "-ERR XPENDING requires key and group"
+	}
+
+	if len(parts) == 3 {
+		summary, err := db.XPending(parts[1], parts[2])
+		if err != nil {
+			return errReply("failed to get pending entries", err)
+		}
+		if summary.Count == 0 {
+			return "0"
+		}
+		lines := []string{strconv.Itoa(summary.Count), summary.Min.String(), summary.Max.String()}
+		for _, c := range summary.Consumers {
+			lines = append(lines, fmt.Sprintf("%s %d", c.Name, c.Count))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	args := parts[3:]
+	var minIdle time.Duration
+	if strings.ToUpper(args[0]) == "IDLE" {
+		if len(args) < 2 {
+			return "-ERR syntax error"
+		}
+		ms, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || ms < 0 {
+			return "-ERR min-idle-time must be a non-negative integer"
+		}
+		minIdle = time.Duration(ms) * time.Millisecond
+		args = args[2:]
+	}
+	if len(args) != 3 && len(args) != 4 {
+		return "-ERR syntax error"
+	}
+	start, err := parseRangeID(args[0], false)
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	end, err := parseRangeID(args[1], true)
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+	count, err := strconv.Atoi(args[2])
+	if err != nil || count < 0 {
+		return "-ERR count must be a non-negative integer"
+	}
+	if count == 0 {
+		return "(empty list)"
+	}
+	var consumer string
+	if len(args) == 4 {
+		consumer = args[3]
+	}
+
+	pending, err := db.XPendingRange(parts[1], parts[2], start, end, count, consumer, minIdle)
+	if err != nil {
+		return errReply("failed to get pending entries", err)
+	}
+	if len(pending) == 0 {
+		return "(empty list)"
+	}
+	lines := make([]string, len(pending))
+	for i, p := range pending {
+		lines[i] = fmt.Sprintf("%s %s %d %d", p.ID, p.Consumer, p.Idle.Milliseconds(), p.Deliveries)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// streamReadArgs holds the arguments of XREAD or XREADGROUP
+type streamReadArgs struct {
+	group, consumer string // Only for XREADGROUP
+	count           int
+	block           bool
+	timeout         time.Duration
+	keys, ids       []string
+}
+
+// parseStreamRead parses XREAD [COUNT count] [BLOCK ms] STREAMS key ... id ...
+// or XREADGROUP GROUP group consumer [COUNT count] [BLOCK ms] STREAMS ...
+func parseStreamRead(cmd string, parts []string) (*streamReadArgs, error) {
+	args := &streamReadArgs{}
+	i := 1
+	if cmd == "XREADGROUP" {
+		if len(parts) < 4 || strings.ToUpper(parts[1]) != "GROUP" {
+			return nil, fmt.Errorf("XREADGROUP requires GROUP group consumer")
+		}
+		args.group, args.consumer = parts[2], parts[3]
+		i = 4
+	}
+
+	for ; i < len(parts); i++ {
+		switch strings.ToUpper(parts[i]) {
+		case "COUNT", "BLOCK":
+			if i+1 >= len(parts) {
+				return nil, fmt.Errorf("syntax error")
+			}
+			n, err := strconv.Atoi(parts[i+1])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("%s must be a non-negative integer", strings.ToUpper(parts[i]))
+			}
+			if strings.ToUpper(parts[i]) == "COUNT" {
+				args.count = n
+			} else {
+				args.block, args.timeout = true, time.Duration(n)*time.Millisecond
+			}
+			i++
+		case "STREAMS":
+			rest := parts[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				return nil, fmt.Errorf("unbalanced STREAMS list: each key needs an ID")
+			}
+			args.keys, args.ids = rest[:len(rest)/2], rest[len(rest)/2:]
+			return args, nil
+		default:
+			return nil, fmt.Errorf("syntax error")
+		}
+	}
+	return nil, fmt.Errorf("%s requires STREAMS", cmd)
+}
+
+// streamRead runs XREAD or XREADGROUP. With BLOCK and canBlock, it parks
+// the connection until an entry arrives, the timeout expires or the server
+// shuts down. XREADGROUP only blocks when every ID is ">".
+func (s *Server) streamRead(db streamStore, cmd string, parts []string, canBlock bool) string {
+	args, err := parseStreamRead(cmd, parts)
+	if err != nil {
+		return fmt.Sprintf("-ERR %v", err)
+	}
+
+	// "$" is resolved once so that a blocked XREAD waits for entries added
+	// after it was called
+	reads := make([]engine.StreamRead, len(args.keys))
+	history := false
+	for i, key := range args.keys {
+		reads[i].Key = key
+		switch id := args.ids[i]; {
+		case id == ">" && args.group != "":
+			reads[i].New = true
+		case id == "$" && args.group == "":
+			if reads[i].After, err = db.XLastID(key); err != nil {
+				return errReply("failed to read", err)
+			}
+		default:
+			if reads[i].After, err = engine.ParseStreamID(id); err != nil {
+				return "-ERR invalid stream ID"
+			}
+			history = args.group != ""
+		}
+	}
+
+	attempt := func() (string, bool) {
+		var results []engine.StreamResult
+		var err error
+		if args.group == "" {
+			results, err = db.XRead(reads, args.count)
+		} else {
+			results, err = db.XReadGroup(args.group, args.consumer, reads, args.count)
+		}
+		if err != nil {
+			return errReply("failed to read", err), true
+		}
+		if len(results) == 0 {
+			return "(nil)", false
+		}
+		var lines []string
+		for _, r := range results {
+			for _, e := range r.Entries {
+				lines = append(lines, r.Key+" "+formatStreamEntry(e))
+			}
+		}
+		return strings.Join(lines, "\n"), true
+	}
+
+	if !canBlock || !args.block || history {
+		reply, _ := attempt()
+		return reply
+	}
+	return s.block(args.keys, args.timeout, attempt)
+}
+
+// parseTrimOptions parses MAXLEN|MINID [=|~] threshold starting at parts[i]
+// and returns the index after it. Approximate trimming (~) is exact here.
+func parseTrimOptions(parts []string, i int) (engine.XTrimOptions, int, error) {
+	var opts engine.XTrimOptions
+	strategy := strings.ToUpper(parts[i])
+	i++
+	if i < len(parts) && (parts[i] == "=" || parts[i] == "~") {
+		i++
+	}
+	if i >= len(parts) {
+		return opts, i, fmt.Errorf("%s requires a threshold", strategy)
+	}
+
+	switch strategy {
+	case "MAXLEN":
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 {
+			return opts, i, fmt.Errorf("MAXLEN must be a non-negative integer")
+		}
+		opts.Strategy, opts.MaxLen = engine.TrimMaxLen, n
+	case "MINID":
+		id, err := engine.ParseStreamID(parts[i])
+		if err != nil {
+			return opts, i, fmt.Errorf("invalid stream ID")
+		}
+		opts.Strategy, opts.MinID = engine.TrimMinID, id
+	default:
+		return opts, i, fmt.Errorf("syntax error")
+	}
+	return opts, i + 1, nil
+}
+
+// parseRangeID parses one end of a stream range: "-", "+", an ID, or a
+// millisecond time alone, which covers every sequence number. A leading
+// "(" makes the bound exclusive.
+func parseRangeID(arg string, end bool) (engine.StreamID, error) {
+	switch arg {
+	case "-":
+		return engine.StreamID{}, nil
+	case "+":
+		return engine.MaxStreamID, nil
+	}
+
+	exclusive := strings.HasPrefix(arg, "(")
+	arg = strings.TrimPrefix(arg, "(")
+	id, err := engine.ParseStreamID(arg)
+	if err != nil {
+		return id, fmt.Errorf("invalid stream ID")
+	}
+	if end && !strings.Contains(arg, "-") {
+		id.Seq = engine.MaxStreamID.Seq
+	}
+
+	if exclusive {
+		switch {
+		case !end && id == engine.MaxStreamID, end && id == (engine.StreamID{}):
+			return id, fmt.Errorf("invalid ID for an exclusive range")
+		case end:
+			id = id.Prev()
+		default:
+			id = id.Next()
+		}
+	}
+	return id, nil
+}
+
+// parseStreamIDs parses a list of stream IDs
+func parseStreamIDs(args []string) ([]engine.StreamID, error) {
+	ids := make([]engine.StreamID, len(args))
+	for i, arg := range args {
+		id, err := engine.ParseStreamID(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stream ID")
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// formatStreamEntry formats an entry as its ID followed by its fields and
+// values, space separated
+func formatStreamEntry(e engine.StreamEntry) string {
+	if len(e.Fields) == 0 {
+		return e.ID.String()
+	}
+	return e.ID.String() + " " + strings.Join(e.Fields, " ")
+}
+
+// entriesReply formats entries one per line, or (empty list)
+func entriesReply(entries []engine.StreamEntry) string {
+	if len(entries) == 0 {
+		return "(empty list)"
+	}
+	lines := make([]string, len(entries))
+	for i, e := range entries {
+		lines[i] = formatStreamEntry(e)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,262 @@
+// pkg/api/stream_test.go
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_StreamCommands(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	if r := h.sendCommand("XADD events 1-1 type click"); r != "1-1" {
+		t.Errorf("Expected 1-1, got: %s", r)
+	}
+	if r := h.sendCommand("XADD events 1-* type view"); r != "1-2" {
+		t.Errorf("Expected 1-2, got: %s", r)
+	}
+	if r := h.sendCommand("XADD events * type buy"); !strings.HasSuffix(r, "-0") || r == "1-0" {
+		t.Errorf("Expected a clock-based ID, got: %s", r)
+	}
+	if r := h.sendCommand("XADD events 1-1 type late"); !strings.Contains(r, "equal or smaller") {
+		t.Errorf("Expected an ID ordering error, got: %s", r)
+	}
+	if r := h.sendCommand("XADD fresh NOMKSTREAM * f v"); r != "(nil)" {
+		t.Errorf("Expected (nil) with NOMKSTREAM, got: %s", r)
+	}
+	if r := h.sendCommand("XLEN events"); r != "3" {
+		t.Errorf("Expected XLEN 3, got: %s", r)
+	}
+	if r := h.sendCommand("XADD events MAXLEN = 2 5000000000000-0 type x"); r != "5000000000000-0" {
+		t.Errorf("Expected 5000000000000-0, got: %s", r)
+	}
+	if r := h.sendCommand("XLEN events"); r != "2" {
+		t.Errorf("Expected XLEN 2 after MAXLEN, got: %s", r)
+	}
+	if r := h.sendCommand("XTRIM events MINID ~ 5000000000000"); r != "1" {
+		t.Errorf("Expected 1 trimmed, got: %s", r)
+	}
+	if r := h.sendCommand("XRANGE events - +"); r != "5000000000000-0 type x" {
+		t.Errorf("Unexpected XRANGE: %s", r)
+	}
+
+	errors := []string{
+		"XADD events * odd",
+		"XADD events MAXLEN abc * f v",
+		"XADD events 0-0 f v",
+		"XRANGE events x +",
+		"XRANGE events (+ +",
+		"XTRIM events SIZE 1",
+		"XREAD STREAMS events",
+		"XREAD COUNT -1 STREAMS events 0",
+		"XACK events g bad",
+		"XGROUP NOPE events g",
+	}
+	for _, cmd := range errors {
+		if r := h.sendCommand(cmd); !strings.HasPrefix(r, "-ERR") {
+			t.Errorf("%s: expected error, got: %s", cmd, r)
+		}
+	}
+
+	h.sendCommand("SET str value")
+	if r := h.sendCommand("XADD str * f v"); !strings.Contains(r, "WRONGTYPE") {
+		t.Errorf("Expected WRONGTYPE, got: %s", r)
+	}
+}
+
+func TestServer_StreamMultiline(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	for _, id := range []string{"1-0", "2-0", "2-1", "3-0"} {
+		c.send("XADD s " + id + " n " + id)
+	}
+	c.send("XADD t 7-0 n other")
+
+	steps := []struct {
+		cmd  string
+		want []string
+	}{
+		{"XRANGE s 2 2", []string{"2-0 n 2-0", "2-1 n 2-1"}},
+		{"XRANGE s (1-0 + COUNT 2", []string{"2-0 n 2-0", "2-1 n 2-1"}},
+		{"XREVRANGE s + (2-1", []string{"3-0 n 3-0"}},
+		{"XREVRANGE s + - COUNT 2", []string{"3-0 n 3-0", "2-1 n 2-1"}},
+		{"XREAD COUNT 1 STREAMS s t 2-1 0", []string{"s 3-0 n 3-0", "t 7-0 n other"}},
+	}
+	for _, step := range steps {
+		got := c.sendLines(step.cmd, len(step.want))
+		if strings.Join(got, ",") != strings.Join(step.want, ",") {
+			t.Errorf("%s: expected %v, got %v", step.cmd, step.want, got)
+		}
+	}
+
+	if r := c.send("XREAD STREAMS s $"); r != "(nil)" {
+		t.Errorf("Expected (nil), got: %s", r)
+	}
+	if r := c.send("XRANGE missing - +"); r != "(empty list)" {
+		t.Errorf("Expected (empty list), got: %s", r)
+	}
+}
+
+func TestServer_StreamConsumerGroups(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	if r := c.send("XGROUP CREATE jobs workers $"); !strings.HasPrefix(r, "-ERR") {
+		t.Errorf("Expected an error without MKSTREAM, got: %s", r)
+	}
+	if r := c.send("XGROUP CREATE jobs workers $ MKSTREAM"); r != "+OK" {
+		t.Errorf("Expected +OK, got: %s", r)
+	}
+	if r := c.send("XGROUP CREATE jobs workers 0"); !strings.Contains(r, "BUSYGROUP") {
+		t.Errorf("Expected BUSYGROUP, got: %s", r)
+	}
+	for _, id := range []string{"1-0", "2-0", "3-0"} {
+		c.send("XADD jobs " + id + " job " + id)
+	}
+
+	steps := []struct {
+		cmd  string
+		want []string
+	}{
+		{"XREADGROUP GROUP workers alice COUNT 2 STREAMS jobs >", []string{"jobs 1-0 job 1-0", "jobs 2-0 job 2-0"}},
+		{"XREADGROUP GROUP workers bob STREAMS jobs >", []string{"jobs 3-0 job 3-0"}},
+		{"XREADGROUP GROUP workers alice STREAMS jobs 0", []string{"jobs 1-0 job 1-0", "jobs 2-0 job 2-0"}},
+		{"XPENDING jobs workers", []string{"3", "1-0", "3-0", "alice 2", "bob 1"}},
+		{"XACK jobs workers 1-0 9-0", []string{"1"}},
+		{"XCLAIM jobs workers bob 0 2-0 JUSTID", []string{"2-0"}},
+		{"XCLAIM jobs workers carol 0 3-0", []string{"3-0 job 3-0"}},
+	}
+	for _, step := range steps {
+		got := c.sendLines(step.cmd, len(step.want))
+		if strings.Join(got, ",") != strings.Join(step.want, ",") {
+			t.Errorf("%s: expected %v, got %v", step.cmd, step.want, got)
+		}
+	}
+
+	lines := c.sendLines("XPENDING jobs workers - + 10", 2)
+	if !strings.HasPrefix(lines[0], "2-0 bob ") || !strings.HasSuffix(lines[0], " 1") {
+		t.Errorf("JUSTID should keep the delivery count, got: %s", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "3-0 carol ") || !strings.HasSuffix(lines[1], " 2") {
+		t.Errorf("XCLAIM should count a delivery, got: %s", lines[1])
+	}
+	if r := c.send("XPENDING jobs workers IDLE 3600000 - + 10"); r != "(empty list)" {
+		t.Errorf("Expected no entry idle for an hour, got: %s", r)
+	}
+
+	if r := c.send("XREADGROUP GROUP workers alice STREAMS jobs >"); r != "(nil)" {
+		t.Errorf("Expected (nil), got: %s", r)
+	}
+	if r := c.send("XREADGROUP GROUP nobody alice STREAMS jobs >"); !strings.Contains(r, "NOGROUP") {
+		t.Errorf("Expected NOGROUP, got: %s", r)
+	}
+	if r := c.send("XGROUP SETID jobs workers 0"); r != "+OK" {
+		t.Errorf("Expected +OK, got: %s", r)
+	}
+	if r := c.send("XREADGROUP GROUP workers dave COUNT 1 STREAMS jobs >"); r != "jobs 1-0 job 1-0" {
+		t.Errorf("Expected redelivery after SETID, got: %s", r)
+	}
+	if r := c.send("XGROUP DESTROY jobs workers"); r != "1" {
+		t.Errorf("Expected 1, got: %s", r)
+	}
+}
+
+func TestServer_XREAD_Blocks(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	h.sendCommand("XADD s 1-0 n old")
+
+	waiter := h.dial()
+	defer waiter.close()
+
+	done := make(chan string, 1)
+	go func() {
+		done <- waiter.send("XREAD BLOCK 0 STREAMS s $")
+	}()
+
+	// The waiter stays blocked until a new entry is added
+	select {
+	case r := <-done:
+		t.Fatalf("XREAD returned before XADD: %s", r)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	h.sendCommand("XADD s 2-0 n new")
+	select {
+	case r := <-done:
+		if r != "s 2-0 n new" {
+			t.Errorf("Expected s 2-0 n new, got: %s", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("XREAD was not woken by XADD")
+	}
+}
+
+func TestServer_XREADGROUP_Blocks(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	h.sendCommand("XGROUP CREATE jobs workers $ MKSTREAM")
+
+	waiter := h.dial()
+	defer waiter.close()
+
+	done := make(chan string, 1)
+	go func() {
+		done <- waiter.send("XREADGROUP GROUP workers alice BLOCK 2000 STREAMS jobs >")
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	h.sendCommand("XADD jobs 1-0 job one")
+	select {
+	case r := <-done:
+		if r != "jobs 1-0 job one" {
+			t.Errorf("Expected jobs 1-0 job one, got: %s", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("XREADGROUP was not woken by XADD")
+	}
+	if r := h.sendCommand("XPENDING jobs workers"); !strings.HasPrefix(r, "1") {
+		t.Errorf("Expected the delivered entry to be pending, got: %s", r)
+	}
+
+	// History reads and timeouts don't wait
+	c := h.dial()
+	defer c.close()
+	if r := c.send("XREADGROUP GROUP workers bob BLOCK 0 STREAMS jobs 0"); r != "(nil)" {
+		t.Errorf("Expected (nil) for an empty history, got: %s", r)
+	}
+	start := time.Now()
+	if r := c.send("XREAD BLOCK 100 STREAMS jobs $"); r != "(nil)" {
+		t.Errorf("Expected (nil) on timeout, got: %s", r)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("XREAD returned after %v, before its timeout", elapsed)
+	}
+}
+
+func TestServer_XREAD_InMulti(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("MULTI")
+	c.send("XADD s 1-0 f v")
+	c.send("XREAD BLOCK 0 STREAMS s 0")
+	replies := c.sendLines("EXEC", 2)
+	if strings.Join(replies, ",") != "1-0,s 1-0 f v" {
+		t.Errorf("Expected EXEC replies [1-0 s 1-0 f v], got %v", replies)
+	}
+}
@@ -0,0 +1,322 @@
+// pkg/api/transaction.go
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/lofoneh/kvlite/internal/engine"
+)
+
+// transactionalCommands lists the commands that may be queued inside MULTI.
+// They only touch data through the dataStore handle, so they are safe to run
+// while EXEC holds the engine's store lock.
+var transactionalCommands = map[string]bool{
+	"SET":              true,
+	"SETEX":            true,
+	"SETNX":            true,
+	"GET":              true,
+	"GETSET":           true,
+	"GETDEL":           true,
+	"GETEX":            true,
+	"GETV":             true,
+	"CAS":              true,
+	"DELETE":           true,
+	"DEL":              true,
+	"EXISTS":           true,
+	"PSETEX":           true,
+	"EXPIRE":           true,
+	"PEXPIRE":          true,
+	"EXPIREAT":         true,
+	"PEXPIREAT":        true,
+	"TTL":              true,
+	"PTTL":             true,
+	"EXPIRETIME":       true,
+	"PEXPIRETIME":      true,
+	"PERSIST":          true,
+	"KEYS":             true,
+	"SCAN":             true,
+	"RANGE":            true,
+	"CLEAR":            true,
+	"FLUSHDB":          true,
+	"FLUSHALL":         true,
+	"MOVE":             true,
+	"SWAPDB":           true,
+	"SELECT":           true,
+	"RENAME":           true,
+	"RENAMENX":         true,
+	"COPY":             true,
+	"TYPE":             true,
+	"RANDOMKEY":        true,
+	"TOUCH":            true,
+	"UNLINK":           true,
+	"DUMP":             true,
+	"RESTORE":          true,
+	"MSET":             true,
+	"MGET":             true,
+	"MDEL":             true,
+	"INCR":             true,
+	"DECR":             true,
+	"INCRBY":           true,
+	"DECRBY":           true,
+	"INCRBYFLOAT":      true,
+	"APPEND":           true,
+	"STRLEN":           true,
+	"HSET":             true,
+	"HGET":             true,
+	"HMGET":            true,
+	"HGETALL":          true,
+	"HDEL":             true,
+	"HEXISTS":          true,
+	"HLEN":             true,
+	"HKEYS":            true,
+	"HVALS":            true,
+	"HINCRBY":          true,
+	"HSCAN":            true,
+	"LPUSH":            true,
+	"RPUSH":            true,
+	"LPOP":             true,
+	"RPOP":             true,
+	"LLEN":             true,
+	"LINDEX":           true,
+	"LRANGE":           true,
+	"LREM":             true,
+	"LTRIM":            true,
+	"LMOVE":            true,
+	"BLPOP":            true,
+	"BRPOP":            true,
+	"BLMOVE":           true,
+	"SADD":             true,
+	"SREM":             true,
+	"SISMEMBER":        true,
+	"SMISMEMBER":       true,
+	"SMEMBERS":         true,
+	"SCARD":            true,
+	"SPOP":             true,
+	"SRANDMEMBER":      true,
+	"SINTER":           true,
+	"SUNION":           true,
+	"SDIFF":            true,
+	"SINTERSTORE":      true,
+	"SUNIONSTORE":      true,
+	"SDIFFSTORE":       true,
+	"SSCAN":            true,
+	"ZADD":             true,
+	"ZREM":             true,
+	"ZSCORE":           true,
+	"ZINCRBY":          true,
+	"ZCARD":            true,
+	"ZRANK":            true,
+	"ZREVRANK":         true,
+	"ZCOUNT":           true,
+	"ZREMRANGEBYSCORE": true,
+	"ZRANGE":           true,
+	"ZPOPMIN":          true,
+	"ZPOPMAX":          true,
+	"XADD":             true,
+	"XTRIM":            true,
+	"XLEN":             true,
+	"XRANGE":           true,
+	"XREVRANGE":        true,
+	"XREAD":            true,
+	"XREADGROUP":       true,
+	"XGROUP":           true,
+	"XACK":             true,
+	"XPENDING":         true,
+	"XCLAIM":           true,
+	"PFADD":            true,
+	"PFCOUNT":          true,
+	"PFMERGE":          true,
+	"BF.RESERVE":       true,
+	"BF.ADD":           true,
+	"BF.MADD":          true,
+	"BF.EXISTS":        true,
+	"SETBIT":           true,
+	"GETBIT":           true,
+	"BITCOUNT":         true,
+	"BITPOS":           true,
+	"BITOP":            true,
+	"JSON.SET":         true,
+	"JSON.GET":         true,
+	"JSON.MGET":        true,
+	"JSON.DEL":         true,
+	"JSON.NUMINCRBY":   true,
+	"JSON.ARRAPPEND":   true,
+	"GEOADD":           true,
+	"GEOPOS":           true,
+	"GEODIST":          true,
+	"GEOHASH":          true,
+	"GEOSEARCH":        true,
+	"PING":             true,
+	"PUBLISH":          true,
+	"EVAL":             true,
+	"EVALSHA":          true,
+}
+
+// session holds per-connection state
+type session struct {
+	db      *engine.Engine          // Selected database
+	inMulti bool                    // Between MULTI and EXEC/DISCARD
+	queued  [][]string              // Commands queued by MULTI, already split into parts
+	dirty   bool                    // A command was rejected while queuing, EXEC will abort
+	watched map[watchKey]watchState // WATCHed keys and their state at WATCH time
+
+	// Subscriber mode, see pubsub.go
+	conn       net.Conn
+	writer     *bufio.Writer // Output of the connection, owned by the writer goroutine of sub once set
+	sub        *subscriber
+	writerDone chan struct{} // Closed when the writer goroutine of sub exits
+}
+
+// watchKey is a key WATCHed in a database
+type watchKey struct {
+	db  int
+	key string
+}
+
+// watchState is what WATCH records about a key. A missing key has version
+// 0 before it is created and after it is removed again, so for missing keys
+// EXEC also compares the removal counter of the database; a removal of any
+// other key of the database then aborts EXEC too.
+type watchState struct {
+	version  uint64
+	removals uint64
+}
+
+// changed reports whether the key watched as w has changed in db
+func (w watchState) changed(db *engine.Tx, key string) bool {
+	// Version removes the key first if it has expired
+	if db.Version(key) != w.version {
+		return true
+	}
+	return w.version == 0 && db.Removals() != w.removals
+}
+
+// newSession creates the state for a new connection, on database 0
+func newSession(db *engine.Engine) *session {
+	return &session{db: db}
+}
+
+// queue adds a command to the current transaction. Commands that aren't
+// allowed in MULTI make EXEC abort.
+func (sess *session) queue(cmd string, parts []string, allowed bool) string {
+	if !allowed {
+		sess.dirty = true
+		return fmt.Sprintf("-ERR command '%s' cannot be used in MULTI", cmd)
+	}
+	sess.queued = append(sess.queued, parts)
+	return "+QUEUED"
+}
+
+// reset leaves MULTI and forgets all watched keys
+func (sess *session) reset() {
+	sess.inMulti = false
+	sess.queued = nil
+	sess.dirty = false
+	sess.watched = nil
+}
+
+// transactionCommand handles MULTI, EXEC, DISCARD, WATCH and UNWATCH
+func (s *Server) transactionCommand(sess *session, cmd string, parts []string) string {
+	switch cmd {
+	case "MULTI":
+		if sess.inMulti {
+			return "-ERR MULTI calls can not be nested"
+		}
+		sess.inMulti = true
+		return "+OK"
+
+	case "DISCARD":
+		if !sess.inMulti {
+			return "-ERR DISCARD without MULTI"
+		}
+		sess.reset()
+		return "+OK"
+
+	case "WATCH":
+		if sess.inMulti {
+			return "-ERR WATCH inside MULTI is not allowed"
+		}
+		if len(parts) < 2 {
+			return "-ERR WATCH requires at least one key"
+		}
+		if sess.watched == nil {
+			sess.watched = make(map[watchKey]watchState)
+		}
+		for _, key := range parts[1:] {
+			k := watchKey{db: sess.db.Index(), key: key}
+			if _, ok := sess.watched[k]; !ok {
+				// Removals is read first so that a removal between
+				// the two reads can only abort EXEC, not go unnoticed
+				removals := sess.db.Removals()
+				sess.watched[k] = watchState{version: sess.db.Version(key), removals: removals}
+			}
+		}
+		return "+OK"
+
+	case "UNWATCH":
+		sess.watched = nil
+		return "+OK"
+
+	case "EXEC":
+		if !sess.inMulti {
+			return "-ERR EXEC without MULTI"
+		}
+		defer sess.reset()
+
+		if sess.dirty {
+			return "-ERR EXECABORT transaction discarded because of previous errors"
+		}
+		return s.exec(sess)
+	}
+
+	return fmt.Sprintf("-ERR unknown command '%s'", cmd)
+}
+
+// exec runs the queued commands atomically. It returns one reply line per
+// command, or (nil) if a watched key changed since WATCH. A queued SELECT
+// switches the database of the commands after it, and of the connection.
+func (s *Server) exec(sess *session) string {
+	var replies []string
+	aborted := false
+
+	err := sess.db.Atomic(func(tx *engine.Tx) error {
+		for k, w := range sess.watched {
+			db, err := tx.DB(k.db)
+			if err != nil {
+				return err
+			}
+			if w.changed(db, k.key) {
+				aborted = true
+				return nil
+			}
+		}
+
+		for _, parts := range sess.queued {
+			cmd := strings.ToUpper(parts[0])
+			if cmd == "SELECT" {
+				reply := s.selectDB(sess, parts)
+				if reply == "+OK" {
+					tx, _ = tx.DB(sess.db.Index())
+				}
+				replies = append(replies, reply)
+				continue
+			}
+			replies = append(replies, s.executeCommand(tx, cmd, parts))
+		}
+		return nil
+	})
+	if err != nil {
+		return errReply("transaction failed", err)
+	}
+
+	if aborted {
+		return "(nil)"
+	}
+	if len(replies) == 0 {
+		return "(empty list)"
+	}
+	return strings.Join(replies, "\n")
+}
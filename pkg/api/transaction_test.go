@@ -0,0 +1,237 @@
+// pkg/api/transaction_test.go
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServer_MULTI_EXEC(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	if r := c.send("MULTI"); r != "+OK" {
+		t.Fatalf("MULTI failed: %s", r)
+	}
+	for _, cmd := range []string{"SET a 1", "INCR a", "GET a"} {
+		if r := c.send(cmd); r != "+QUEUED" {
+			t.Fatalf("Expected +QUEUED for %q, got: %s", cmd, r)
+		}
+	}
+
+	// Nothing is visible before EXEC
+	if r := h.sendCommand("GET a"); r != "-ERR key not found" {
+		t.Errorf("Queued command ran before EXEC: %s", r)
+	}
+
+	replies := c.sendLines("EXEC", 3)
+	expected := []string{"+OK", "2", "2"}
+	for i := range expected {
+		if replies[i] != expected[i] {
+			t.Errorf("EXEC reply %d: expected %s, got %s", i, expected[i], replies[i])
+		}
+	}
+}
+
+func TestServer_MULTI_Errors(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	if r := c.send("EXEC"); r != "-ERR EXEC without MULTI" {
+		t.Errorf("Unexpected EXEC reply: %s", r)
+	}
+	if r := c.send("DISCARD"); r != "-ERR DISCARD without MULTI" {
+		t.Errorf("Unexpected DISCARD reply: %s", r)
+	}
+
+	c.send("MULTI")
+	if r := c.send("MULTI"); !strings.HasPrefix(r, "-ERR") {
+		t.Errorf("Nested MULTI should fail, got: %s", r)
+	}
+	if r := c.send("WATCH a"); !strings.HasPrefix(r, "-ERR") {
+		t.Errorf("WATCH inside MULTI should fail, got: %s", r)
+	}
+	c.send("SET a 1")
+	if r := c.send("COMPACT"); !strings.HasPrefix(r, "-ERR") {
+		t.Errorf("COMPACT should be rejected in MULTI, got: %s", r)
+	}
+	if r := c.send("EXEC"); !strings.HasPrefix(r, "-ERR EXECABORT") {
+		t.Errorf("EXEC after queuing error should abort, got: %s", r)
+	}
+
+	// The transaction is gone after EXECABORT
+	if r := c.send("GET a"); r != "-ERR key not found" {
+		t.Errorf("Aborted transaction was applied: %s", r)
+	}
+}
+
+func TestServer_DISCARD(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("MULTI")
+	c.send("SET a 1")
+	if r := c.send("DISCARD"); r != "+OK" {
+		t.Fatalf("DISCARD failed: %s", r)
+	}
+	if r := c.send("GET a"); r != "-ERR key not found" {
+		t.Errorf("Discarded command was applied: %s", r)
+	}
+}
+
+func TestServer_WATCH_Abort(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	h.sendCommand("SET balance 100")
+	if r := c.send("WATCH balance"); r != "+OK" {
+		t.Fatalf("WATCH failed: %s", r)
+	}
+
+	// Another client changes the watched key
+	h.sendCommand("SET balance 50")
+
+	c.send("MULTI")
+	c.send("SET balance 200")
+	if r := c.send("EXEC"); r != "(nil)" {
+		t.Errorf("EXEC should abort after watched key changed, got: %s", r)
+	}
+	if r := h.sendCommand("GET balance"); r != "50" {
+		t.Errorf("Aborted transaction was applied: %s", r)
+	}
+
+	// Watches are cleared by EXEC, so the next transaction succeeds
+	c.send("MULTI")
+	c.send("SET balance 200")
+	if r := c.send("EXEC"); r != "+OK" {
+		t.Errorf("EXEC without watches failed: %s", r)
+	}
+}
+
+func TestServer_WATCH_DeletedKey(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	// Watching a missing key aborts if it gets created
+	c.send("WATCH lock")
+	h.sendCommand("SET lock other")
+	c.send("MULTI")
+	c.send("SET lock mine")
+	if r := c.send("EXEC"); r != "(nil)" {
+		t.Errorf("EXEC should abort after watched key was created, got: %s", r)
+	}
+
+	// Watching an existing key aborts if it gets deleted
+	c.send("WATCH lock")
+	h.sendCommand("DEL lock")
+	c.send("MULTI")
+	c.send("SET lock mine")
+	if r := c.send("EXEC"); r != "(nil)" {
+		t.Errorf("EXEC should abort after watched key was deleted, got: %s", r)
+	}
+
+	// A missing key has no version before it is created and after it is
+	// deleted again, so these must abort too
+	steps := map[string][]string{
+		"created and deleted":  {"SET lock other", "DEL lock"},
+		"created and expired":  {"SET lock other PX 10"},
+		"created and flushed":  {"SET lock other", "FLUSHDB"},
+		"created and unlinked": {"HSET lock f v", "UNLINK lock"},
+	}
+	for name, cmds := range steps {
+		h.sendCommand("DEL lock")
+		c.send("WATCH lock")
+		for _, cmd := range cmds {
+			h.sendCommand(cmd)
+		}
+		time.Sleep(20 * time.Millisecond)
+		c.send("MULTI")
+		c.send("SET lock mine")
+		if r := c.send("EXEC"); r != "(nil)" {
+			t.Errorf("%s: EXEC should abort, got: %s", name, r)
+		}
+		if r := h.sendCommand("EXISTS lock"); r != "0" {
+			t.Errorf("%s: aborted transaction was applied", name)
+		}
+	}
+
+	// A missing key that nobody touches doesn't abort
+	c.send("WATCH lock")
+	c.send("MULTI")
+	c.send("SET lock mine")
+	if r := c.send("EXEC"); r != "+OK" {
+		t.Errorf("EXEC should succeed when the watched key stays missing, got: %s", r)
+	}
+}
+
+func TestServer_UNWATCH(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("WATCH k")
+	h.sendCommand("SET k changed")
+	c.send("UNWATCH")
+	c.send("MULTI")
+	c.send("SET k mine")
+	if r := c.send("EXEC"); r != "+OK" {
+		t.Errorf("EXEC after UNWATCH should succeed, got: %s", r)
+	}
+}
+
+func TestServer_WATCH_OptimisticIncrement(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	h.sendCommand("SET counter 0")
+
+	const workers = 5
+	const increments = 10
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := h.dial()
+			defer c.close()
+
+			for done := 0; done < increments; {
+				c.send("WATCH counter")
+				n, _ := strconv.Atoi(c.send("GET counter"))
+				c.send("MULTI")
+				c.send(fmt.Sprintf("SET counter %d", n+1))
+				if c.send("EXEC") == "+OK" {
+					done++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	expected := strconv.Itoa(workers * increments)
+	if r := h.sendCommand("GET counter"); r != expected {
+		t.Errorf("Expected counter %s after optimistic increments, got: %s", expected, r)
+	}
+}
@@ -0,0 +1,355 @@
+// pkg/api/zset.go
+package api
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/lofoneh/kvlite/internal/engine"
+)
+
+// zsetStore is the part of dataStore used by the sorted set commands
+type zsetStore interface {
+	ZAdd(key string, members []engine.ZMember, opts engine.ZAddOptions) (int, error)
+	ZRem(key string, members ...string) (int, error)
+	ZScore(key, member string) (float64, bool, error)
+	ZIncrBy(key, member string, delta float64) (float64, error)
+	ZCard(key string) (int, error)
+	ZRank(key, member string, rev bool) (int, bool, error)
+	ZCount(key string, min, max engine.ScoreBound) (int, error)
+	ZRangeByRank(key string, start, stop int, rev bool) ([]engine.ZMember, error)
+	ZRangeByScore(key string, min, max engine.ScoreBound, rev bool, offset, count int) ([]engine.ZMember, error)
+	ZRangeByLex(key string, min, max engine.LexBound, rev bool, offset, count int) ([]engine.ZMember, error)
+	ZRemRangeByScore(key string, min, max engine.ScoreBound) (int, error)
+	ZPopMin(key string, count int) ([]engine.ZMember, error)
+	ZPopMax(key string, count int) ([]engine.ZMember, error)
+}
+
+// executeZSetCommand runs a sorted set command
+func executeZSetCommand(db zsetStore, cmd string, parts []string) string {
+	switch cmd {
+	case "ZADD":
+		if len(parts) < 4 {
+			return "-ERR ZADD requires key and score member pairs"
+		}
+		opts, i := parseZAddOptions(parts[2:])
+		if err := opts.Validate(); err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		pairs := parts[2+i:]
+		if len(pairs) == 0 || len(pairs)%2 != 0 {
+			return "-ERR ZADD requires key and score member pairs"
+		}
+		members := make([]engine.ZMember, 0, len(pairs)/2)
+		for j := 0; j < len(pairs); j += 2 {
+			score, err := parseScore(pairs[j])
+			if err != nil {
+				return "-ERR value is not a valid float"
+			}
+			members = append(members, engine.ZMember{Member: pairs[j+1], Score: score})
+		}
+		n, err := db.ZAdd(parts[1], members, opts)
+		if err != nil {
+			return errReply("failed to add", err)
+		}
+		return strconv.Itoa(n)
+
+	case "ZREM":
+		if len(parts) < 3 {
+			return "-ERR ZREM requires key and at least one member"
+		}
+		n, err := db.ZRem(parts[1], parts[2:]...)
+		if err != nil {
+			return errReply("failed to remove", err)
+		}
+		return strconv.Itoa(n)
+
+	case "ZSCORE":
+		if len(parts) != 3 {
+			return "-ERR ZSCORE requires key and member"
+		}
+		score, ok, err := db.ZScore(parts[1], parts[2])
+		if err != nil {
+			return errReply("failed to get", err)
+		}
+		if !ok {
+			return "(nil)"
+		}
+		return formatScore(score)
+
+	case "ZINCRBY":
+		if len(parts) != 4 {
+			return "-ERR ZINCRBY requires key, increment and member"
+		}
+		delta, err := parseScore(parts[2])
+		if err != nil {
+			return "-ERR value is not a valid float"
+		}
+		score, err := db.ZIncrBy(parts[1], parts[3], delta)
+		if err != nil {
+			return errReply("failed to increment", err)
+		}
+		return formatScore(score)
+
+	case "ZCARD":
+		if len(parts) != 2 {
+			return "-ERR ZCARD requires key"
+		}
+		n, err := db.ZCard(parts[1])
+		if err != nil {
+			return errReply("failed to get", err)
+		}
+		return strconv.Itoa(n)
+
+	case "ZRANK", "ZREVRANK":
+		if len(parts) != 3 {
+			return fmt.Sprintf("-ERR %s requires key and member", cmd)
+		}
+		rank, ok, err := db.ZRank(parts[1], parts[2], cmd == "ZREVRANK")
+		if err != nil {
+			return errReply("failed to get", err)
+		}
+		if !ok {
+			return "(nil)"
+		}
+		return strconv.Itoa(rank)
+
+	case "ZCOUNT", "ZREMRANGEBYSCORE":
+		if len(parts) != 4 {
+			return fmt.Sprintf("-ERR %s requires key, min and max", cmd)
+		}
+		min, max, err := parseScoreRange(parts[2], parts[3])
+		if err != nil {
+			return fmt.Sprintf("-ERR %v", err)
+		}
+		var n int
+		if cmd == "ZCOUNT" {
+			n, err = db.ZCount(parts[1], min, max)
+		} else {
+			n, err = db.ZRemRangeByScore(parts[1], min, max)
+		}
+		if err != nil {
+			return errReply("failed to count", err)
+		}
+		return strconv.Itoa(n)
+
+	case "ZRANGE":
+		return zrange(db, parts)
+
+	case "ZPOPMIN", "ZPOPMAX":
+		if len(parts) != 2 && len(parts) != 3 {
+			return fmt.Sprintf("-ERR %s requires key and optional count", cmd)
+		}
+		count := 1
+		if len(parts) == 3 {
+			var err error
+			count, err = strconv.Atoi(parts[2])
+			if err != nil || count < 0 {
+				return "-ERR count must be a non-negative integer"
+			}
+		}
+		pop := db.ZPopMin
+		if cmd == "ZPOPMAX" {
+			pop = db.ZPopMax
+		}
+		members, err := pop(parts[1], count)
+		if err != nil {
+			return errReply("failed to pop", err)
+		}
+		return zmembersReply(members, true)
+	}
+
+	return fmt.Sprintf("-ERR unknown command '%s'", cmd)
+}
+
+// zrange runs ZRANGE key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count]
+// [WITHSCORES]. With BYSCORE or BYLEX and REV, start is the maximum.
+func zrange(db zsetStore, parts []string) string {
+	if len(parts) < 4 {
+		return "-ERR ZRANGE requires key, start and stop"
+	}
+
+	var byScore, byLex, rev, withScores, limited bool
+	offset, count := 0, -1
+	for i := 4; i < len(parts); i++ {
+		switch strings.ToUpper(parts[i]) {
+		case "BYSCORE":
+			byScore = true
+		case "BYLEX":
+			byLex = true
+		case "REV":
+			rev = true
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(parts) {
+				return "-ERR syntax error"
+			}
+			var err1, err2 error
+			offset, err1 = strconv.Atoi(parts[i+1])
+			count, err2 = strconv.Atoi(parts[i+2])
+			if err1 != nil || err2 != nil {
+				return "-ERR value is not an integer or out of range"
+			}
+			limited = true
+			i += 2
+		default:
+			return "-ERR syntax error"
+		}
+	}
+
+	switch {
+	case byScore && byLex:
+		return "-ERR syntax error"
+	case limited && !byScore && !byLex:
+		return "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX"
+	case withScores && byLex:
+		return "-ERR syntax error, WITHSCORES not supported in combination with BYLEX"
+	}
+
+	// Ranges by score or member are written from max to min with REV
+	from, to := parts[2], parts[3]
+	if rev && (byScore || byLex) {
+		from, to = to, from
+	}
+
+	var members []engine.ZMember
+	var err error
+	switch {
+	case byScore:
+		min, max, perr := parseScoreRange(from, to)
+		if perr != nil {
+			return fmt.Sprintf("-ERR %v", perr)
+		}
+		members, err = db.ZRangeByScore(parts[1], min, max, rev, offset, count)
+	case byLex:
+		min, max, perr := parseLexRange(from, to)
+		if perr != nil {
+			return fmt.Sprintf("-ERR %v", perr)
+		}
+		members, err = db.ZRangeByLex(parts[1], min, max, rev, offset, count)
+	default:
+		start, stop, perr := parseIndexRange(from, to)
+		if perr != nil {
+			return fmt.Sprintf("-ERR %v", perr)
+		}
+		members, err = db.ZRangeByRank(parts[1], start, stop, rev)
+	}
+	if err != nil {
+		return errReply("failed to get range", err)
+	}
+	return zmembersReply(members, withScores)
+}
+
+// parseZAddOptions parses the NX, XX, GT, LT and CH flags at the start of
+// args and returns how many were consumed
+func parseZAddOptions(args []string) (engine.ZAddOptions, int) {
+	var opts engine.ZAddOptions
+	for i, arg := range args {
+		switch strings.ToUpper(arg) {
+		case "NX":
+			opts.NX = true
+		case "XX":
+			opts.XX = true
+		case "GT":
+			opts.GT = true
+		case "LT":
+			opts.LT = true
+		case "CH":
+			opts.CH = true
+		default:
+			return opts, i
+		}
+	}
+	return opts, len(args)
+}
+
+// parseScore parses a score, accepting inf, +inf and -inf but not NaN
+func parseScore(arg string) (float64, error) {
+	score, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, fmt.Errorf("value is not a valid float")
+	}
+	return score, nil
+}
+
+// parseScoreRange parses the min and max of a score range, where a leading
+// "(" makes a bound exclusive
+func parseScoreRange(minArg, maxArg string) (engine.ScoreBound, engine.ScoreBound, error) {
+	min, err := parseScoreBound(minArg)
+	if err != nil {
+		return min, min, err
+	}
+	max, err := parseScoreBound(maxArg)
+	return min, max, err
+}
+
+// parseScoreBound parses one end of a score range
+func parseScoreBound(arg string) (engine.ScoreBound, error) {
+	var bound engine.ScoreBound
+	if strings.HasPrefix(arg, "(") {
+		bound.Exclusive = true
+		arg = arg[1:]
+	}
+	score, err := parseScore(arg)
+	if err != nil {
+		return bound, fmt.Errorf("min or max is not a float")
+	}
+	bound.Value = score
+	return bound, nil
+}
+
+// parseLexRange parses the min and max of a lexicographical range
+func parseLexRange(minArg, maxArg string) (engine.LexBound, engine.LexBound, error) {
+	min, err := parseLexBound(minArg)
+	if err != nil {
+		return min, min, err
+	}
+	max, err := parseLexBound(maxArg)
+	return min, max, err
+}
+
+// parseLexBound parses one end of a lexicographical range: "-" or "+" for
+// the open ends, or a member prefixed by "[" (inclusive) or "(" (exclusive)
+func parseLexBound(arg string) (engine.LexBound, error) {
+	switch {
+	case arg == "-":
+		return engine.LexBound{Inf: -1}, nil
+	case arg == "+":
+		return engine.LexBound{Inf: 1}, nil
+	case strings.HasPrefix(arg, "["):
+		return engine.LexBound{Value: arg[1:]}, nil
+	case strings.HasPrefix(arg, "("):
+		return engine.LexBound{Value: arg[1:], Exclusive: true}, nil
+	}
+	return engine.LexBound{}, fmt.Errorf("min or max not valid string range item")
+}
+
+// formatScore formats a score the way ZSCORE returns it
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+// zmembersReply formats members one per line, each followed by its score
+// if withScores is set, or (empty list)
+func zmembersReply(members []engine.ZMember, withScores bool) string {
+	if len(members) == 0 {
+		return "(empty list)"
+	}
+	lines := make([]string, 0, len(members)*2)
+	for _, m := range members {
+		lines = append(lines, m.Member)
+		if withScores {
+			lines = append(lines, formatScore(m.Score))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,138 @@
+// pkg/api/zset_test.go
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServer_ZSetCommands(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	if r := h.sendCommand("ZADD board 10 alice 20 bob 15 carol"); r != "3" {
+		t.Errorf("Expected 3 added, got: %s", r)
+	}
+	if r := h.sendCommand("ZADD board XX CH 25 bob 5 dave"); r != "1" {
+		t.Errorf("Expected 1 changed, got: %s", r)
+	}
+	if r := h.sendCommand("ZSCORE board bob"); r != "25" {
+		t.Errorf("Expected 25, got: %s", r)
+	}
+	if r := h.sendCommand("ZSCORE board dave"); r != "(nil)" {
+		t.Errorf("Expected (nil), got: %s", r)
+	}
+	if r := h.sendCommand("ZINCRBY board 2.5 alice"); r != "12.5" {
+		t.Errorf("Expected 12.5, got: %s", r)
+	}
+	if r := h.sendCommand("ZCARD board"); r != "3" {
+		t.Errorf("Expected ZCARD 3, got: %s", r)
+	}
+	if r := h.sendCommand("ZRANK board carol"); r != "1" {
+		t.Errorf("Expected rank 1, got: %s", r)
+	}
+	if r := h.sendCommand("ZREVRANK board bob"); r != "0" {
+		t.Errorf("Expected rev rank 0, got: %s", r)
+	}
+	if r := h.sendCommand("ZRANK board nobody"); r != "(nil)" {
+		t.Errorf("Expected (nil), got: %s", r)
+	}
+	if r := h.sendCommand("ZCOUNT board (12.5 +inf"); r != "2" {
+		t.Errorf("Expected ZCOUNT 2, got: %s", r)
+	}
+	if r := h.sendCommand("ZADD board -inf floor"); r != "1" {
+		t.Errorf("Expected 1 added, got: %s", r)
+	}
+	if r := h.sendCommand("ZSCORE board floor"); r != "-inf" {
+		t.Errorf("Expected -inf, got: %s", r)
+	}
+	if r := h.sendCommand("ZREMRANGEBYSCORE board -inf 12.5"); r != "2" {
+		t.Errorf("Expected 2 removed, got: %s", r)
+	}
+	if r := h.sendCommand("ZREM board carol bob nobody"); r != "2" {
+		t.Errorf("Expected 2 removed, got: %s", r)
+	}
+	if r := h.sendCommand("EXISTS board"); r != "0" {
+		t.Errorf("Empty sorted set should be removed, got: %s", r)
+	}
+
+	errors := []string{
+		"ZADD board NX XX 1 a",
+		"ZADD board GT LT 1 a",
+		"ZADD board GT NX 1 a",
+		"ZADD board nan a",
+		"ZADD board 1",
+		"ZADD board abc a",
+		"ZCOUNT board x 1",
+		"ZRANGE board 0 -1 LIMIT 0 1",
+		"ZRANGE board a b BYLEX WITHSCORES",
+		"ZRANGE board x y BYLEX",
+		"ZPOPMIN board -1",
+	}
+	for _, cmd := range errors {
+		if r := h.sendCommand(cmd); !strings.HasPrefix(r, "-ERR") {
+			t.Errorf("%s: expected error, got: %s", cmd, r)
+		}
+	}
+
+	h.sendCommand("SET str value")
+	if r := h.sendCommand("ZADD str 1 x"); !strings.Contains(r, "WRONGTYPE") {
+		t.Errorf("Expected WRONGTYPE, got: %s", r)
+	}
+}
+
+func TestServer_ZSetMultiline(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("ZADD board 1 a 2 b 3 c 4 d")
+	c.send("ZADD names 0 apple 0 banana 0 cherry 0 date")
+
+	steps := []struct {
+		cmd  string
+		want []string
+	}{
+		{"ZRANGE board 0 -1", []string{"a", "b", "c", "d"}},
+		{"ZRANGE board 0 1 WITHSCORES", []string{"a", "1", "b", "2"}},
+		{"ZRANGE board 0 1 REV", []string{"d", "c"}},
+		{"ZRANGE board (1 3 BYSCORE", []string{"b", "c"}},
+		{"ZRANGE board +inf -inf BYSCORE REV LIMIT 1 2", []string{"c", "b"}},
+		{"ZRANGE names [b (d BYLEX", []string{"banana", "cherry"}},
+		{"ZRANGE names + - BYLEX REV LIMIT 0 2", []string{"date", "cherry"}},
+		{"ZPOPMIN board", []string{"a", "1"}},
+		{"ZPOPMAX board 2", []string{"d", "4", "c", "3"}},
+		{"ZRANGE board 0 -1 WITHSCORES", []string{"b", "2"}},
+	}
+	for _, step := range steps {
+		got := c.sendLines(step.cmd, len(step.want))
+		if strings.Join(got, ",") != strings.Join(step.want, ",") {
+			t.Errorf("%s: expected %v, got %v", step.cmd, step.want, got)
+		}
+	}
+
+	if r := c.send("ZRANGE missing 0 -1"); r != "(empty list)" {
+		t.Errorf("Expected (empty list), got: %s", r)
+	}
+}
+
+func TestServer_ZSetTransaction(t *testing.T) {
+	h := setupTestHelper(t)
+	defer h.close()
+
+	c := h.dial()
+	defer c.close()
+
+	c.send("MULTI")
+	c.send("ZADD board 1 a")
+	c.send("ZINCRBY board 4 a")
+	replies := c.sendLines("EXEC", 2)
+	if strings.Join(replies, ",") != "1,5" {
+		t.Errorf("Expected EXEC replies [1 5], got %v", replies)
+	}
+	if r := c.send("ZSCORE board a"); r != "5" {
+		t.Errorf("Expected 5, got: %s", r)
+	}
+}
@@ -0,0 +1,385 @@
+// pkg/client/pipeline.go
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result is a reply to a pipelined command. It is populated by Pipeline.Exec.
+type Result interface {
+	Err() error
+	setReply(lines []string)
+	setErr(err error)
+}
+
+// baseResult holds the error shared by all result types
+type baseResult struct {
+	err error
+}
+
+// Err returns the error for this command, if any
+func (r *baseResult) Err() error {
+	return r.err
+}
+
+func (r *baseResult) setErr(err error) {
+	r.err = err
+}
+
+// replyError converts an -ERR reply into an error
+func replyError(line string) error {
+	if strings.HasPrefix(line, "-ERR") {
+		return errors.New(line)
+	}
+	return nil
+}
+
+// StatusResult is the reply to a command returning +OK style status
+type StatusResult struct {
+	baseResult
+	val string
+}
+
+// Val returns the status line
+func (r *StatusResult) Val() string {
+	return r.val
+}
+
+// Result returns the status line and error
+func (r *StatusResult) Result() (string, error) {
+	return r.val, r.err
+}
+
+func (r *StatusResult) setReply(lines []string) {
+	r.val = lines[0]
+	r.err = replyError(lines[0])
+}
+
+// StringResult is the reply to a command returning a single value
+type StringResult struct {
+	baseResult
+	val string
+}
+
+// Val returns the value
+func (r *StringResult) Val() string {
+	return r.val
+}
+
+// Result returns the value and error
+func (r *StringResult) Result() (string, error) {
+	return r.val, r.err
+}
+
+func (r *StringResult) setReply(lines []string) {
+	if err := replyError(lines[0]); err != nil {
+		r.err = err
+		return
+	}
+	r.val = lines[0]
+}
+
+// IntResult is the reply to a command returning an integer
+type IntResult struct {
+	baseResult
+	val int64
+}
+
+// Val returns the integer value
+func (r *IntResult) Val() int64 {
+	return r.val
+}
+
+// Result returns the integer value and error
+func (r *IntResult) Result() (int64, error) {
+	return r.val, r.err
+}
+
+func (r *IntResult) setReply(lines []string) {
+	if err := replyError(lines[0]); err != nil {
+		r.err = err
+		return
+	}
+	n, err := strconv.ParseInt(lines[0], 10, 64)
+	if err != nil {
+		r.err = fmt.Errorf("unexpected integer reply: %s", lines[0])
+		return
+	}
+	r.val = n
+}
+
+// BoolResult is the reply to a command returning 1 or 0
+type BoolResult struct {
+	baseResult
+	val bool
+}
+
+// Val returns the boolean value
+func (r *BoolResult) Val() bool {
+	return r.val
+}
+
+// Result returns the boolean value and error
+func (r *BoolResult) Result() (bool, error) {
+	return r.val, r.err
+}
+
+func (r *BoolResult) setReply(lines []string) {
+	if err := replyError(lines[0]); err != nil {
+		r.err = err
+		return
+	}
+	r.val = lines[0] == "1"
+}
+
+// StringSliceResult is the reply to a command returning one line per item
+type StringSliceResult struct {
+	baseResult
+	val []string
+}
+
+// Val returns the values
+func (r *StringSliceResult) Val() []string {
+	return r.val
+}
+
+// Result returns the values and error
+func (r *StringSliceResult) Result() ([]string, error) {
+	return r.val, r.err
+}
+
+func (r *StringSliceResult) setReply(lines []string) {
+	if err := replyError(lines[0]); err != nil {
+		r.err = err
+		return
+	}
+	r.val = lines
+}
+
+// pipelinedCmd is a queued command and the number of reply lines it produces
+type pipelinedCmd struct {
+	line   string
+	lines  int
+	result Result
+	err    error // Set for a command rejected when queued, which isn't sent
+}
+
+// multiLineCommands reply with one line per item, a number of lines Do
+// can't know
+var multiLineCommands = map[string]bool{
+	"KEYS": true, "SCAN": true, "MGET": true, "RANGE": true, "ANOMALIES": true,
+	"HGETALL": true, "HKEYS": true, "HVALS": true, "HMGET": true, "HSCAN": true,
+	"LRANGE": true, "SMEMBERS": true, "SMISMEMBER": true, "SINTER": true, "SUNION": true, "SDIFF": true, "SSCAN": true,
+	"ZRANGE": true, "ZPOPMIN": true, "ZPOPMAX": true,
+	"XRANGE": true, "XREVRANGE": true, "XREAD": true, "XREADGROUP": true, "XPENDING": true, "XCLAIM": true,
+	"GEOPOS": true, "GEOHASH": true, "GEOSEARCH": true,
+	"JSON.MGET": true, "BF.MADD": true, "EXEC": true, "PUBSUB": true,
+}
+
+// Pipeline queues commands and sends them to the server in a single write.
+// Replies are read back in order once Exec is called.
+type Pipeline struct {
+	client *Client
+	cmds   []pipelinedCmd
+}
+
+// Pipeline creates a new, empty pipeline
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{client: c}
+}
+
+// milliseconds formats a TTL for PSETEX and PEXPIRE. A positive TTL under
+// a millisecond is rounded up rather than sent as 0, which the server
+// rejects.
+func milliseconds(ttl time.Duration) string {
+	if ttl > 0 && ttl < time.Millisecond {
+		ttl = time.Millisecond
+	}
+	return strconv.FormatInt(ttl.Milliseconds(), 10)
+}
+
+// queue adds a command expecting the given number of reply lines
+func (p *Pipeline) queue(lines int, result Result, cmd string, args ...string) {
+	line := cmd
+	if len(args) > 0 {
+		line += " " + strings.Join(args, " ")
+	}
+	// Every command produces at least one line, e.g. an error for MGET with no keys
+	if lines < 1 {
+		lines = 1
+	}
+	p.cmds = append(p.cmds, pipelinedCmd{line: line, lines: lines, result: result})
+}
+
+// Set queues a SET command
+func (p *Pipeline) Set(key, value string) *StatusResult {
+	r := &StatusResult{}
+	p.queue(1, r, "SET", key, setValue(value))
+	return r
+}
+
+// SetWithTTL queues a PSETEX command
+func (p *Pipeline) SetWithTTL(key, value string, ttl time.Duration) *StatusResult {
+	r := &StatusResult{}
+	p.queue(1, r, "PSETEX", key, milliseconds(ttl), value)
+	return r
+}
+
+// Get queues a GET command
+func (p *Pipeline) Get(key string) *StringResult {
+	r := &StringResult{}
+	p.queue(1, r, "GET", key)
+	return r
+}
+
+// Delete queues a DELETE command
+func (p *Pipeline) Delete(key string) *StatusResult {
+	r := &StatusResult{}
+	p.queue(1, r, "DELETE", key)
+	return r
+}
+
+// Exists queues an EXISTS command
+func (p *Pipeline) Exists(key string) *BoolResult {
+	r := &BoolResult{}
+	p.queue(1, r, "EXISTS", key)
+	return r
+}
+
+// Expire queues a PEXPIRE command
+func (p *Pipeline) Expire(key string, ttl time.Duration) *BoolResult {
+	r := &BoolResult{}
+	p.queue(1, r, "PEXPIRE", key, milliseconds(ttl))
+	return r
+}
+
+// Incr queues an INCR command
+func (p *Pipeline) Incr(key string) *IntResult {
+	r := &IntResult{}
+	p.queue(1, r, "INCR", key)
+	return r
+}
+
+// Decr queues a DECR command
+func (p *Pipeline) Decr(key string) *IntResult {
+	r := &IntResult{}
+	p.queue(1, r, "DECR", key)
+	return r
+}
+
+// MGet queues an MGET command. Missing keys are returned as "(nil)".
+func (p *Pipeline) MGet(keys ...string) *StringSliceResult {
+	r := &StringSliceResult{}
+	p.queue(len(keys), r, "MGET", keys...)
+	return r
+}
+
+// Do queues an arbitrary command with a single-line reply. Commands known
+// to reply with several lines, such as HGETALL or LRANGE, are not sent and
+// fail with an error; use DoLines for those. So do commands such as LPOP
+// or SPOP given a count.
+func (p *Pipeline) Do(cmd string, args ...string) *StringResult {
+	r := &StringResult{}
+	if name := strings.ToUpper(cmd); multiLineCommands[name] {
+		err := fmt.Errorf("%s replies with several lines, use DoLines", name)
+		p.cmds = append(p.cmds, pipelinedCmd{result: r, err: err})
+		return r
+	}
+	p.queue(1, r, cmd, args...)
+	return r
+}
+
+// DoLines queues an arbitrary command whose reply has the given number of
+// lines, e.g. HMGET with one line per field. An error reply is read as a
+// single line.
+func (p *Pipeline) DoLines(lines int, cmd string, args ...string) *StringSliceResult {
+	r := &StringSliceResult{}
+	p.queue(lines, r, cmd, args...)
+	return r
+}
+
+// Len returns the number of queued commands
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+// Discard drops all queued commands
+func (p *Pipeline) Discard() {
+	p.cmds = nil
+}
+
+// Exec sends all queued commands in one write and reads their replies in
+// order. The returned error is only set for connection failures; per-command
+// errors are reported by each Result. The pipeline is empty afterwards.
+func (p *Pipeline) Exec() ([]Result, error) {
+	cmds := p.cmds
+	p.cmds = nil
+
+	results := make([]Result, len(cmds))
+	for i, cmd := range cmds {
+		results[i] = cmd.result
+	}
+	if len(cmds) == 0 {
+		return results, nil
+	}
+
+	conn, err := p.client.pool.Get()
+	if err != nil {
+		failAll(cmds, err)
+		return results, err
+	}
+	defer conn.Close()
+
+	for _, cmd := range cmds {
+		if cmd.err != nil {
+			continue
+		}
+		if _, err := conn.writer.WriteString(cmd.line + "\n"); err != nil {
+			conn.close()
+			failAll(cmds, err)
+			return results, err
+		}
+	}
+	if err := conn.writer.Flush(); err != nil {
+		conn.close()
+		failAll(cmds, err)
+		return results, err
+	}
+
+	for i, cmd := range cmds {
+		if cmd.err != nil {
+			cmd.result.setErr(cmd.err)
+			continue
+		}
+		lines := make([]string, 0, cmd.lines)
+		for len(lines) < cmd.lines {
+			line, err := conn.reader.ReadString('\n')
+			if err != nil {
+				conn.close()
+				failAll(cmds[i:], err)
+				return results, err
+			}
+			line = strings.TrimSpace(line)
+			lines = append(lines, line)
+
+			// Errors are always a single line, even for multi-line commands
+			if len(lines) == 1 && strings.HasPrefix(line, "-ERR") {
+				break
+			}
+		}
+		cmd.result.setReply(lines)
+	}
+
+	return results, nil
+}
+
+// failAll marks every command as failed with err
+func failAll(cmds []pipelinedCmd, err error) {
+	for _, cmd := range cmds {
+		cmd.result.setErr(err)
+	}
+}
@@ -0,0 +1,227 @@
+// pkg/client/pipeline_test.go
+package client
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lofoneh/kvlite/internal/config"
+	"github.com/lofoneh/kvlite/internal/engine"
+	"github.com/lofoneh/kvlite/pkg/api"
+)
+
+func TestPipeline_Exec(t *testing.T) {
+	ts := setupTestServer(t)
+	defer ts.close()
+
+	client, _ := NewClient(ts.addr)
+	defer client.Close()
+
+	pipe := client.Pipeline()
+	set := pipe.Set("pipe:a", "1")
+	incr := pipe.Incr("pipe:a")
+	get := pipe.Get("pipe:a")
+	missing := pipe.Get("pipe:missing")
+	exists := pipe.Exists("pipe:a")
+	mget := pipe.MGet("pipe:a", "pipe:missing")
+	ping := pipe.Do("PING")
+
+	if pipe.Len() != 7 {
+		t.Fatalf("Expected 7 queued commands, got %d", pipe.Len())
+	}
+
+	results, err := pipe.Exec()
+	if err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+	if len(results) != 7 {
+		t.Fatalf("Expected 7 results, got %d", len(results))
+	}
+	if pipe.Len() != 0 {
+		t.Errorf("Pipeline should be empty after Exec, got %d", pipe.Len())
+	}
+
+	if val, err := set.Result(); err != nil || val != "+OK" {
+		t.Errorf("SET = %q, %v", val, err)
+	}
+	if val, err := incr.Result(); err != nil || val != 2 {
+		t.Errorf("INCR = %d, %v", val, err)
+	}
+	if val, err := get.Result(); err != nil || val != "2" {
+		t.Errorf("GET = %q, %v", val, err)
+	}
+	if missing.Err() == nil {
+		t.Error("GET on missing key should return an error")
+	}
+	if !exists.Val() {
+		t.Error("EXISTS should be true")
+	}
+	if vals, err := mget.Result(); err != nil || len(vals) != 2 || vals[0] != "2" || vals[1] != "(nil)" {
+		t.Errorf("MGET = %v, %v", vals, err)
+	}
+	if ping.Val() != "+PONG" {
+		t.Errorf("PING = %q", ping.Val())
+	}
+}
+
+func TestPipeline_SubSecondTTL(t *testing.T) {
+	ts := setupTestServer(t)
+	defer ts.close()
+
+	client, _ := NewClient(ts.addr)
+	defer client.Close()
+
+	pipe := client.Pipeline()
+	set := pipe.SetWithTTL("ttl:set", "v", 200*time.Millisecond)
+	tiny := pipe.SetWithTTL("ttl:tiny", "v", 500*time.Microsecond)
+	pipe.Set("ttl:expire", "v")
+	expire := pipe.Expire("ttl:expire", 1500*time.Millisecond)
+	pttl := pipe.Do("PTTL", "ttl:expire")
+	if _, err := pipe.Exec(); err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+
+	// The TTLs are sent in milliseconds instead of being truncated to
+	// whole seconds
+	if val, err := set.Result(); err != nil || val != "+OK" {
+		t.Errorf("SetWithTTL(200ms) = %q, %v", val, err)
+	}
+	if val, err := tiny.Result(); err != nil || val != "+OK" {
+		t.Errorf("SetWithTTL(500µs) = %q, %v", val, err)
+	}
+	if !expire.Val() {
+		t.Errorf("Expire(1.5s) failed: %v", expire.Err())
+	}
+	if ms, err := strconv.Atoi(pttl.Val()); err != nil || ms <= 1000 || ms > 1500 {
+		t.Errorf("Expected a PTTL between 1000 and 1500, got %q", pttl.Val())
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if _, err := client.Get("ttl:set"); err == nil {
+		t.Error("Expected the key to expire after 200ms")
+	}
+}
+
+func TestPipeline_Empty(t *testing.T) {
+	ts := setupTestServer(t)
+	defer ts.close()
+
+	client, _ := NewClient(ts.addr)
+	defer client.Close()
+
+	results, err := client.Pipeline().Exec()
+	if err != nil {
+		t.Fatalf("Exec on empty pipeline failed: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("Expected no results, got %d", len(results))
+	}
+}
+
+func TestPipeline_ConnectionReusable(t *testing.T) {
+	ts := setupTestServer(t)
+	defer ts.close()
+
+	client, _ := NewClient(ts.addr)
+	defer client.Close()
+
+	pipe := client.Pipeline()
+	pipe.MGet() // error reply only, must not desync the connection
+	for i := 0; i < 100; i++ {
+		pipe.Set(fmt.Sprintf("bulk:%d", i), fmt.Sprintf("%d", i))
+	}
+	if _, err := pipe.Exec(); err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+
+	val, err := client.Get("bulk:99")
+	if err != nil || val != "99" {
+		t.Errorf("Get after pipeline = %q, %v", val, err)
+	}
+}
+
+func TestPipeline_MultiLineReplies(t *testing.T) {
+	ts := setupTestServer(t)
+	defer ts.close()
+
+	client, _ := NewClient(ts.addr)
+	defer client.Close()
+
+	pipe := client.Pipeline()
+	hset := pipe.Do("HSET", "pipe:h", "a", "1")
+	pipe.Do("HSET", "pipe:h", "b", "2")
+	all := pipe.Do("hgetall", "pipe:h")
+	hmget := pipe.DoLines(2, "HMGET", "pipe:h", "a", "b")
+	after := pipe.Do("HGET", "pipe:h", "b")
+	if _, err := pipe.Exec(); err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+
+	if val, err := hset.Result(); err != nil || val != "1" {
+		t.Errorf("HSET = %q, %v", val, err)
+	}
+	// Rejected without being sent, so later replies stay in step
+	if all.Err() == nil {
+		t.Error("Do should reject HGETALL")
+	}
+	if vals, err := hmget.Result(); err != nil || len(vals) != 2 || vals[0] != "1" || vals[1] != "2" {
+		t.Errorf("HMGET = %v, %v", vals, err)
+	}
+	if val, err := after.Result(); err != nil || val != "2" {
+		t.Errorf("HGET = %q, %v", val, err)
+	}
+}
+
+// benchmarkServer starts a server with logging silenced so that benchmark
+// result lines stay parseable by scripts/bench.sh
+func benchmarkServer(b *testing.B) (*Client, func()) {
+	tmpDir := b.TempDir()
+	log.SetOutput(io.Discard)
+
+	cfg := &config.Config{Host: "localhost", Port: 0}
+	eng, _ := engine.New(engine.Options{WALPath: tmpDir})
+	server := api.NewServer(cfg, eng)
+	go func() { _ = server.Start() }()
+	time.Sleep(100 * time.Millisecond)
+
+	client, _ := NewClient(server.Addr())
+
+	return client, func() {
+		client.Close()
+		_ = server.Shutdown()
+		eng.Close()
+		log.SetOutput(os.Stderr)
+	}
+}
+
+func BenchmarkClient_SetUnpipelined(b *testing.B) {
+	client, cleanup := benchmarkServer(b)
+	defer cleanup()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = client.Set(fmt.Sprintf("bench:%d", i%1000), "value")
+	}
+}
+
+func BenchmarkClient_SetPipelined(b *testing.B) {
+	client, cleanup := benchmarkServer(b)
+	defer cleanup()
+
+	const batch = 100
+	pipe := client.Pipeline()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pipe.Set(fmt.Sprintf("bench:%d", i%1000), "value")
+		if pipe.Len() == batch {
+			_, _ = pipe.Exec()
+		}
+	}
+	_, _ = pipe.Exec()
+}
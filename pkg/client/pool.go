@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -14,6 +15,7 @@ import (
 var (
 	ErrPoolClosed = errors.New("connection pool is closed")
 	ErrTimeout    = errors.New("operation timeout")
+	ErrConflict   = errors.New("version conflict")
 )
 
 // Connection wraps a net.Conn with read/write helpers
@@ -280,7 +282,7 @@ func (c *Client) Set(key, value string) error {
 	}
 	defer conn.Close()
 
-	response, err := conn.Do("SET", key, value)
+	response, err := conn.Do("SET", key, setValue(value))
 	if err != nil {
 		return err
 	}
@@ -292,6 +294,18 @@ func (c *Client) Set(key, value string) error {
 	return nil
 }
 
+// setValue returns value as SET reads it. Values with spaces, empty values
+// and values starting with a double quote are sent quoted, so that their
+// words are never taken for SET options. Line breaks are escaped rather
+// than sent raw, which the server rejects instead of reading them as the
+// end of the command.
+func setValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\r\n") && !strings.HasPrefix(value, `"`) {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`).Replace(value) + `"`
+}
+
 // Get retrieves a value by key
 func (c *Client) Get(key string) (string, error) {
 	conn, err := c.pool.Get()
@@ -312,6 +326,65 @@ func (c *Client) Get(key string) (string, error) {
 	return response, nil
 }
 
+// GetV retrieves a value together with its version, for use with CAS
+func (c *Client) GetV(key string) (string, uint64, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return "", 0, err
+	}
+	defer conn.Close()
+
+	response, err := conn.Do("GETV", key)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if strings.HasPrefix(response, "-ERR") {
+		return "", 0, errors.New(response)
+	}
+
+	versionStr, value, _ := strings.Cut(response, " ")
+	version, err := strconv.ParseUint(versionStr, 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid GETV response: %s", response)
+	}
+
+	return value, version, nil
+}
+
+// CAS stores value only if the key's version still equals expected, and
+// returns the new version. Use version 0 to create a key that must not
+// exist yet. If the version changed, the returned error wraps ErrConflict
+// and the key's current version is returned.
+func (c *Client) CAS(key string, expected uint64, value string) (uint64, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	response, err := conn.Do("CAS", key, strconv.FormatUint(expected, 10), value)
+	if err != nil {
+		return 0, err
+	}
+
+	var current uint64
+	if _, err := fmt.Sscanf(response, "-ERR CONFLICT version mismatch (current %d)", &current); err == nil {
+		return current, fmt.Errorf("%w: current version %d", ErrConflict, current)
+	}
+
+	if strings.HasPrefix(response, "-ERR") {
+		return 0, errors.New(response)
+	}
+
+	version, err := strconv.ParseUint(response, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CAS response: %s", response)
+	}
+
+	return version, nil
+}
+
 // Delete removes a key
 func (c *Client) Delete(key string) error {
 	conn, err := c.pool.Get()
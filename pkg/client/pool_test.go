@@ -2,6 +2,7 @@
 package client
 
 import (
+	"errors"
 	"sync"
 	"testing"
 	"time"
@@ -372,6 +373,33 @@ func TestClient_SetGet(t *testing.T) {
 	}
 }
 
+func TestClient_SetValuesLikeOptions(t *testing.T) {
+	ts := setupTestServer(t)
+	defer ts.close()
+
+	client, _ := NewClient(ts.addr)
+	defer client.Close()
+
+	for _, value := range []string{"please GET", "spaced  out", `say "hi" EX 10`, `C:\new dir`, `"`, ""} {
+		if err := client.Set("k", value); err != nil {
+			t.Errorf("Set(%q) failed: %v", value, err)
+			continue
+		}
+		if got, err := client.Get("k"); err != nil || got != value {
+			t.Errorf("Expected %q, got %q (%v)", value, got, err)
+		}
+	}
+
+	// Line breaks are rejected by the server instead of ending the command
+	// early, and the connection stays in sync
+	if err := client.Set("k", "two\nlines"); err == nil {
+		t.Error("Expected a value with a line break to be rejected")
+	}
+	if got, err := client.Get("k"); err != nil || got != "" {
+		t.Errorf("Expected the value to be left alone, got %q (%v)", got, err)
+	}
+}
+
 func TestClient_Get_NonExistent(t *testing.T) {
 	ts := setupTestServer(t)
 	defer ts.close()
@@ -385,6 +413,40 @@ func TestClient_Get_NonExistent(t *testing.T) {
 	}
 }
 
+func TestClient_CAS(t *testing.T) {
+	ts := setupTestServer(t)
+	defer ts.close()
+
+	client, _ := NewClient(ts.addr)
+	defer client.Close()
+
+	v1, err := client.CAS("cas_key", 0, "first value")
+	if err != nil {
+		t.Fatalf("CAS create failed: %v", err)
+	}
+
+	value, version, err := client.GetV("cas_key")
+	if err != nil {
+		t.Fatalf("GetV failed: %v", err)
+	}
+	if value != "first value" || version != v1 {
+		t.Errorf("Expected 'first value'@%d, got %q@%d", v1, value, version)
+	}
+
+	v2, err := client.CAS("cas_key", v1, "second")
+	if err != nil {
+		t.Fatalf("CAS update failed: %v", err)
+	}
+
+	current, err := client.CAS("cas_key", v1, "stale")
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict, got %v", err)
+	}
+	if current != v2 {
+		t.Errorf("Expected current version %d on conflict, got %d", v2, current)
+	}
+}
+
 func TestClient_Delete(t *testing.T) {
 	ts := setupTestServer(t)
 	defer ts.close()
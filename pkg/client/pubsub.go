@@ -0,0 +1,323 @@
+// pkg/client/pubsub.go
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reconnection backoff of a PubSub whose connection was lost
+const (
+	pubsubMinRetry = 50 * time.Millisecond
+	pubsubMaxRetry = 2 * time.Second
+)
+
+// Message is a message published on a subscribed channel
+type Message struct {
+	Channel string
+	Pattern string // Pattern the channel matched, "" for a channel subscription
+	Payload string
+}
+
+// PubSub is a connection in subscriber mode. Messages are delivered on
+// Channel in the order they were received. If the connection is lost it
+// reconnects and subscribes again to every channel and pattern, so only
+// the messages published while it was down are missed.
+type PubSub struct {
+	pool     *Pool
+	mu       sync.Mutex // Protects the fields below
+	conn     *Connection
+	channels map[string]bool
+	patterns map[string]bool
+	closed   bool
+
+	messages chan *Message
+	done     chan struct{}
+}
+
+// Publish sends a message to a channel and returns the number of
+// subscribers that received it
+func (c *Client) Publish(channel, message string) (int, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	response, err := conn.Do("PUBLISH", channel, message)
+	if err != nil {
+		return 0, err
+	}
+	if strings.HasPrefix(response, "-ERR") {
+		return 0, fmt.Errorf("publish failed: %s", response)
+	}
+	return strconv.Atoi(response)
+}
+
+// Subscribe opens a PubSub subscribed to channels. It returns once the
+// server has confirmed the subscriptions.
+func (c *Client) Subscribe(channels ...string) (*PubSub, error) {
+	return c.newPubSub(channels, nil)
+}
+
+// PSubscribe opens a PubSub subscribed to glob patterns of channels. It
+// returns once the server has confirmed the subscriptions.
+func (c *Client) PSubscribe(patterns ...string) (*PubSub, error) {
+	return c.newPubSub(nil, patterns)
+}
+
+// newPubSub opens a dedicated connection subscribed to channels and
+// patterns
+func (c *Client) newPubSub(channels, patterns []string) (*PubSub, error) {
+	if len(channels)+len(patterns) == 0 {
+		return nil, fmt.Errorf("subscribe requires at least one channel")
+	}
+	ps := &PubSub{
+		pool:     c.pool,
+		channels: make(map[string]bool),
+		patterns: make(map[string]bool),
+		messages: make(chan *Message, 100),
+		done:     make(chan struct{}),
+	}
+	for _, name := range channels {
+		ps.channels[name] = true
+	}
+	for _, name := range patterns {
+		ps.patterns[name] = true
+	}
+
+	conn, err := c.pool.dial()
+	if err != nil {
+		return nil, err
+	}
+	pending, err := ps.handshake(conn)
+	if err != nil {
+		conn.close()
+		return nil, err
+	}
+	ps.conn = conn
+	go ps.run(conn, pending)
+	return ps, nil
+}
+
+// Channel returns the channel messages are delivered on. It is closed by
+// Close.
+func (ps *PubSub) Channel() <-chan *Message {
+	return ps.messages
+}
+
+// Subscribe adds channels. It doesn't wait for the server: messages
+// published before it processed the command are missed.
+func (ps *PubSub) Subscribe(channels ...string) error {
+	return ps.update("SUBSCRIBE", ps.channels, channels, true)
+}
+
+// PSubscribe adds glob patterns of channels, without waiting for the
+// server
+func (ps *PubSub) PSubscribe(patterns ...string) error {
+	return ps.update("PSUBSCRIBE", ps.patterns, patterns, true)
+}
+
+// Unsubscribe removes channels, all of them if none are given
+func (ps *PubSub) Unsubscribe(channels ...string) error {
+	return ps.update("UNSUBSCRIBE", ps.channels, channels, false)
+}
+
+// PUnsubscribe removes patterns, all of them if none are given
+func (ps *PubSub) PUnsubscribe(patterns ...string) error {
+	return ps.update("PUNSUBSCRIBE", ps.patterns, patterns, false)
+}
+
+// update records a change to the subscriptions and sends it to the
+// server. While the connection is down the change is only recorded, and
+// made when it is restored.
+func (ps *PubSub) update(cmd string, set map[string]bool, names []string, add bool) error {
+	if add && len(names) == 0 {
+		return fmt.Errorf("%s requires at least one channel", strings.ToLower(cmd))
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.closed {
+		return ErrPoolClosed
+	}
+	switch {
+	case add:
+		for _, name := range names {
+			set[name] = true
+		}
+	case len(names) == 0:
+		for name := range set {
+			delete(set, name)
+		}
+	default:
+		for _, name := range names {
+			delete(set, name)
+		}
+	}
+	_ = ps.conn.send(cmd, names)
+	return nil
+}
+
+// Close unsubscribes from everything by closing the connection, and
+// closes Channel
+func (ps *PubSub) Close() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.closed {
+		return nil
+	}
+	ps.closed = true
+	close(ps.done)
+	ps.conn.close()
+	return nil
+}
+
+// run delivers the messages received on conn, reconnecting when it is
+// lost, until Close
+func (ps *PubSub) run(conn *Connection, pending []*Message) {
+	defer close(ps.messages)
+	for {
+		for _, msg := range pending {
+			select {
+			case ps.messages <- msg:
+			case <-ps.done:
+				return
+			}
+		}
+		pending = pending[:0]
+
+		line, err := conn.reader.ReadString('\n')
+		if err != nil {
+			if conn, pending = ps.reconnect(); conn == nil {
+				return
+			}
+			continue
+		}
+		if msg := parseMessage(line); msg != nil {
+			pending = append(pending, msg)
+		}
+	}
+}
+
+// reconnect dials until it can subscribe again, backing off between
+// attempts. It returns nil once the PubSub is closed.
+func (ps *PubSub) reconnect() (*Connection, []*Message) {
+	for delay := pubsubMinRetry; ; delay *= 2 {
+		if delay > pubsubMaxRetry {
+			delay = pubsubMaxRetry
+		}
+		select {
+		case <-ps.done:
+			return nil, nil
+		case <-time.After(delay):
+		}
+
+		conn, err := ps.pool.dial()
+		if err != nil {
+			continue
+		}
+		ps.mu.Lock()
+		if ps.closed {
+			ps.mu.Unlock()
+			conn.close()
+			return nil, nil
+		}
+		pending, err := ps.handshake(conn)
+		if err != nil {
+			ps.mu.Unlock()
+			conn.close()
+			continue
+		}
+		ps.conn = conn
+		ps.mu.Unlock()
+		return conn, pending
+	}
+}
+
+// handshake subscribes a new connection to the channels and patterns and
+// waits for the confirmations, returning the messages received meanwhile
+// Caller must hold mu, or own ps exclusively
+func (ps *PubSub) handshake(conn *Connection) ([]*Message, error) {
+	channels, patterns := sortedKeys(ps.channels), sortedKeys(ps.patterns)
+	if len(channels) > 0 {
+		if err := conn.send("SUBSCRIBE", channels); err != nil {
+			return nil, err
+		}
+	}
+	if len(patterns) > 0 {
+		if err := conn.send("PSUBSCRIBE", patterns); err != nil {
+			return nil, err
+		}
+	}
+
+	_ = conn.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer func() { _ = conn.conn.SetReadDeadline(time.Time{}) }()
+
+	var pending []*Message
+	for confirmed := 0; confirmed < len(channels)+len(patterns); {
+		line, err := conn.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "-ERR"):
+			return nil, fmt.Errorf("subscribe failed: %s", line)
+		case strings.HasPrefix(line, "subscribe ") || strings.HasPrefix(line, "psubscribe "):
+			confirmed++
+		default:
+			if msg := parseMessage(line); msg != nil {
+				pending = append(pending, msg)
+			}
+		}
+	}
+	return pending, nil
+}
+
+// send writes a command without reading the reply
+func (c *Connection) send(cmd string, args []string) error {
+	line := cmd
+	if len(args) > 0 {
+		line += " " + strings.Join(args, " ")
+	}
+	if _, err := c.writer.WriteString(line + "\n"); err != nil {
+		return err
+	}
+	return c.writer.Flush()
+}
+
+// parseMessage parses a message or pmessage line, returning nil for
+// anything else
+func parseMessage(line string) *Message {
+	line = strings.TrimRight(line, "\r\n")
+	switch {
+	case strings.HasPrefix(line, "message "):
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 3 {
+			return nil
+		}
+		return &Message{Channel: fields[1], Payload: fields[2]}
+	case strings.HasPrefix(line, "pmessage "):
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) < 4 {
+			return nil
+		}
+		return &Message{Pattern: fields[1], Channel: fields[2], Payload: fields[3]}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of a set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
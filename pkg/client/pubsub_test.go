@@ -0,0 +1,147 @@
+// pkg/client/pubsub_test.go
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+// receive waits for the next message of a PubSub
+func receive(t *testing.T, ps *PubSub) *Message {
+	t.Helper()
+	select {
+	case msg, ok := <-ps.Channel():
+		if !ok {
+			t.Fatal("Expected a message, the channel was closed")
+		}
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for a message")
+	}
+	return nil
+}
+
+// publishUntilReceived publishes until the server reports n receivers,
+// for subscriptions the server hasn't processed yet
+func publishUntilReceived(t *testing.T, client *Client, channel, message string, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		got, err := client.Publish(channel, message)
+		if err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+		if got == n {
+			return
+		}
+	}
+	t.Fatalf("No subscriber received %q on %s", message, channel)
+}
+
+func TestPubSub_Messages(t *testing.T) {
+	ts := setupTestServer(t)
+	defer ts.close()
+
+	client, err := NewClient(ts.addr)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	ps, err := client.Subscribe("invalidate")
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	defer ps.Close()
+
+	n, err := client.Publish("invalidate", "user:1 user:2")
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 receiver, got %d, %v", n, err)
+	}
+	if msg := receive(t, ps); msg.Channel != "invalidate" || msg.Payload != "user:1 user:2" || msg.Pattern != "" {
+		t.Errorf("Unexpected message: %+v", msg)
+	}
+
+	if err := ps.PSubscribe("cache.*"); err != nil {
+		t.Fatalf("PSubscribe failed: %v", err)
+	}
+	publishUntilReceived(t, client, "cache.users", "flush", 1)
+	if msg := receive(t, ps); msg.Pattern != "cache.*" || msg.Channel != "cache.users" || msg.Payload != "flush" {
+		t.Errorf("Unexpected pattern message: %+v", msg)
+	}
+
+	if err := ps.Unsubscribe("invalidate"); err != nil {
+		t.Fatalf("Unsubscribe failed: %v", err)
+	}
+	publishUntilReceived(t, client, "invalidate", "ignored", 0)
+
+	if _, err := client.Subscribe(); err == nil {
+		t.Error("Expected an error subscribing to nothing")
+	}
+}
+
+func TestPubSub_Reconnect(t *testing.T) {
+	ts := setupTestServer(t)
+	defer ts.close()
+
+	client, err := NewClient(ts.addr)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	ps, err := client.Subscribe("events")
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	defer ps.Close()
+	if err := ps.PSubscribe("jobs.*"); err != nil {
+		t.Fatalf("PSubscribe failed: %v", err)
+	}
+	publishUntilReceived(t, client, "jobs.done", "1", 1)
+	receive(t, ps)
+
+	// Drop the connection: the subscriptions are made again on a new one
+	ps.mu.Lock()
+	ps.conn.close()
+	ps.mu.Unlock()
+
+	publishUntilReceived(t, client, "events", "back", 1)
+	if msg := receive(t, ps); msg.Channel != "events" || msg.Payload != "back" {
+		t.Errorf("Unexpected message after reconnect: %+v", msg)
+	}
+	publishUntilReceived(t, client, "jobs.new", "2", 1)
+	if msg := receive(t, ps); msg.Pattern != "jobs.*" || msg.Channel != "jobs.new" {
+		t.Errorf("Unexpected pattern message after reconnect: %+v", msg)
+	}
+}
+
+func TestPubSub_Close(t *testing.T) {
+	ts := setupTestServer(t)
+	defer ts.close()
+
+	client, err := NewClient(ts.addr)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	ps, err := client.Subscribe("events")
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := ps.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	select {
+	case _, ok := <-ps.Channel():
+		if ok {
+			t.Error("Expected no message after Close")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected Channel to be closed")
+	}
+	if err := ps.Subscribe("more"); err != ErrPoolClosed {
+		t.Errorf("Expected ErrPoolClosed after Close, got %v", err)
+	}
+	_ = ps.Close()
+}
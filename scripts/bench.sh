@@ -60,6 +60,29 @@ run_go_benchmarks() {
     fi
 }
 
+# Compare pipelined vs unpipelined client throughput
+run_pipeline_benchmarks() {
+    echo ""
+    echo -e "${BLUE}Client Pipelining Benchmarks${NC}"
+    echo "─────────────────────────────────────────"
+
+    local bench_output=$(go test -run '^$' -bench='BenchmarkClient_Set(Unpipelined|Pipelined)' -benchmem ./pkg/client/ 2>&1)
+    echo "$bench_output" | grep -E "Benchmark|ok"
+
+    BENCH_UNPIPELINED=$(echo "$bench_output" | grep -E "BenchmarkClient_SetUnpipelined(-|\s)" | awk '{print $3}')
+    BENCH_PIPELINED=$(echo "$bench_output" | grep -E "BenchmarkClient_SetPipelined(-|\s)" | awk '{print $3}')
+
+    if [ -n "$BENCH_UNPIPELINED" ]; then
+        UNPIPELINED_OPS=$(awk "BEGIN {printf \"%.0f\", 1000000000 / $BENCH_UNPIPELINED}")
+    fi
+    if [ -n "$BENCH_PIPELINED" ]; then
+        PIPELINED_OPS=$(awk "BEGIN {printf \"%.0f\", 1000000000 / $BENCH_PIPELINED}")
+    fi
+    if [ -n "$BENCH_UNPIPELINED" ] && [ -n "$BENCH_PIPELINED" ]; then
+        PIPELINE_SPEEDUP=$(awk "BEGIN {printf \"%.1f\", $BENCH_UNPIPELINED / $BENCH_PIPELINED}")
+    fi
+}
+
 # Run simple network test
 run_network_test() {
     echo ""
@@ -146,6 +169,17 @@ show_summary() {
         echo "  • Concurrent: No data"
     fi
     
+    echo ""
+    echo "Client Pipelining (SET, batches of 100):"
+
+    if [ -n "$UNPIPELINED_OPS" ] && [ -n "$PIPELINED_OPS" ]; then
+        echo "  • Unpipelined: ${BENCH_UNPIPELINED} ns/op (${UNPIPELINED_OPS} ops/sec)"
+        echo "  • Pipelined: ${BENCH_PIPELINED} ns/op (${PIPELINED_OPS} ops/sec)"
+        echo "  • Speedup: ${PIPELINE_SPEEDUP}x"
+    else
+        echo "  • No data"
+    fi
+
     echo ""
     echo "Network Performance:"
     
@@ -165,6 +199,7 @@ show_summary() {
 main() {
     check_server
     run_go_benchmarks
+    run_pipeline_benchmarks
     run_network_test
     show_summary
 }